@@ -0,0 +1,311 @@
+// Package animation poses skeletons from keyframed clips, as loaded from
+// glTF, and works out the joint matrices that skin a mesh to the pose.
+// Clips are played by a Player, which blends any number of them by weight
+// and cross-fades between them.
+package animation
+
+import (
+	"math"
+	"sort"
+
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+)
+
+// Path is which part of a node's transform, or its mesh's morph target
+// weights, a Channel animates.
+type Path int
+
+const (
+	Translation Path = iota
+	Rotation
+	Scale
+	Weights
+)
+
+// Interpolation is how a Channel's values change between keyframes.
+type Interpolation int
+
+const (
+	// Linear interpolates translations and scales linearly and rotations
+	// spherically.
+	Linear Interpolation = iota
+	// Step holds each keyframe's value until the next.
+	Step
+	// CubicSpline is a Hermite spline through the keyframes, each of which
+	// has an in and out tangent either side of its value.
+	CubicSpline
+)
+
+// Channel animates one part of a node's transform.
+type Channel struct {
+	Node          int
+	Path          Path
+	Interpolation Interpolation
+	// Times are the keyframes' times in seconds, ascending.
+	Times []float32
+	// Values are the keyframes' values one after another, three floats
+	// each for translations and scales, a quaternion for rotations and a
+	// weight per morph target for weights. CubicSpline keyframes are an in
+	// tangent, value and out tangent.
+	Values []float32
+}
+
+// Clip is a named animation of a skeleton's nodes.
+type Clip struct {
+	Name     string
+	Channels []Channel
+	// Duration is the time of the last keyframe of any channel.
+	Duration float32
+}
+
+// Node is one of a skeleton's nodes.
+type Node struct {
+	Name string
+	// Parent is the index of the node's parent, -1 for a root.
+	Parent int
+	// Rest is where the node is when no clip animates it.
+	Rest scene.Transform
+	// Weights are the weights of the morph targets of the node's mesh when
+	// no clip animates them, nil when it has none.
+	Weights []float32
+}
+
+// Joint is a node a mesh is skinned to.
+type Joint struct {
+	Node int
+	// InverseBind takes a vertex from the mesh's space into the joint's
+	// when the mesh was bound to it.
+	InverseBind vmath.Mat4
+}
+
+// Skeleton is the hierarchy of nodes clips animate, and the joints meshes
+// are skinned to.
+type Skeleton struct {
+	Nodes  []Node
+	Joints []Joint
+	// order has parents before their children.
+	order []int
+}
+
+// NewSkeleton checks nodes form a hierarchy and joints refer to them.
+func NewSkeleton(nodes []Node, joints []Joint) (*Skeleton, error) {
+	s := &Skeleton{Nodes: nodes, Joints: joints}
+	for i, n := range nodes {
+		if n.Parent < -1 || n.Parent >= len(nodes) {
+			return nil, errors.Errorf("node %d's parent %d is out of range", i, n.Parent)
+		}
+	}
+	for i, j := range joints {
+		if j.Node < 0 || j.Node >= len(nodes) {
+			return nil, errors.Errorf("joint %d's node %d is out of range", i, j.Node)
+		}
+	}
+
+	// Each node goes after its parent, so a node still left once every
+	// placed node's children are placed is in a cycle
+	placed := make([]bool, len(nodes))
+	for len(s.order) < len(nodes) {
+		before := len(s.order)
+		for i, n := range nodes {
+			if !placed[i] && (n.Parent == -1 || placed[n.Parent]) {
+				placed[i] = true
+				s.order = append(s.order, i)
+			}
+		}
+		if len(s.order) == before {
+			return nil, errors.New("node hierarchy has a cycle")
+		}
+	}
+	return s, nil
+}
+
+// Pose is a transform for each of a skeleton's nodes.
+type Pose []scene.Transform
+
+// RestPose is every node at rest.
+func (s *Skeleton) RestPose() Pose {
+	pose := make(Pose, len(s.Nodes))
+	for i, n := range s.Nodes {
+		pose[i] = n.Rest
+	}
+	return pose
+}
+
+// JointMatrices fills out, which has a matrix per joint, with the
+// transforms skinning a mesh to pose.
+func (s *Skeleton) JointMatrices(pose Pose, out []vmath.Mat4) {
+	world := make([]vmath.Mat4, len(s.Nodes))
+	for _, i := range s.order {
+		world[i] = pose[i].Matrix()
+		if p := s.Nodes[i].Parent; p >= 0 {
+			world[i] = world[p].Mul(world[i])
+		}
+	}
+	for i, j := range s.Joints {
+		out[i] = world[j.Node].Mul(j.InverseBind)
+	}
+}
+
+// Sample sets the nodes c animates in pose to where they are t seconds in,
+// holding the first and last keyframes outside the clip.
+func (c *Clip) Sample(t float32, pose Pose) {
+	for _, ch := range c.Channels {
+		if ch.Node < 0 || ch.Node >= len(pose) || len(ch.Times) == 0 {
+			continue
+		}
+		n := &pose[ch.Node]
+		var v vmath.Vec4
+		switch ch.Path {
+		case Translation:
+			ch.sample(t, v[:3])
+			n.Translation = v.Vec3()
+		case Scale:
+			ch.sample(t, v[:3])
+			n.Scale = v.Vec3()
+		case Rotation:
+			ch.sample(t, v[:])
+			n.Rotation = normalize(v)
+		}
+	}
+}
+
+// SampleWeights sets the morph target weights c animates in weights, which
+// has a slice per node like Node.Weights, to what they are t seconds in.
+func (c *Clip) SampleWeights(t float32, weights [][]float32) {
+	for _, ch := range c.Channels {
+		if ch.Path != Weights || ch.Node < 0 || ch.Node >= len(weights) || len(ch.Times) == 0 {
+			continue
+		}
+		if w := weights[ch.Node]; len(w) == ch.components() {
+			ch.sample(t, w)
+		}
+	}
+}
+
+// components is how many floats each of the channel's values is.
+func (ch *Channel) components() int {
+	switch ch.Path {
+	case Rotation:
+		return 4
+	case Weights:
+		keys := len(ch.Times)
+		if ch.Interpolation == CubicSpline {
+			keys *= 3
+		}
+		if keys == 0 {
+			return 0
+		}
+		return len(ch.Values) / keys
+	}
+	return 3
+}
+
+// value is keyframe k's value, skipping CubicSpline's tangents.
+func (ch *Channel) value(k int) []float32 {
+	return ch.at(k, 1)
+}
+
+// at is element e of keyframe k, e being 0 to 2 for the in tangent, value
+// and out tangent with CubicSpline and 1 otherwise. It's zeros when the
+// values are short.
+func (ch *Channel) at(k, e int) []float32 {
+	n := ch.components()
+	start := k * n
+	if ch.Interpolation == CubicSpline {
+		start = (k*3 + e) * n
+	}
+	if start+n > len(ch.Values) {
+		return make([]float32, n)
+	}
+	return ch.Values[start : start+n]
+}
+
+// sample sets out, which has a float per component, to the channel's value
+// at t.
+func (ch *Channel) sample(t float32, out []float32) {
+	last := len(ch.Times) - 1
+	if t <= ch.Times[0] {
+		copy(out, ch.value(0))
+		return
+	}
+	if t >= ch.Times[last] {
+		copy(out, ch.value(last))
+		return
+	}
+	// The keyframe after t, there's always one before it
+	next := sort.Search(len(ch.Times), func(i int) bool { return ch.Times[i] > t })
+	k := next - 1
+	dt := ch.Times[next] - ch.Times[k]
+	u := (t - ch.Times[k]) / dt
+
+	switch ch.Interpolation {
+	case Step:
+		copy(out, ch.value(k))
+		return
+	case CubicSpline:
+		u2, u3 := u*u, u*u*u
+		p0, m0 := ch.value(k), ch.at(k, 2)
+		p1, m1 := ch.value(next), ch.at(next, 0)
+		for i := range out {
+			out[i] = (2*u3-3*u2+1)*p0[i] + (u3-2*u2+u)*dt*m0[i] +
+				(-2*u3+3*u2)*p1[i] + (u3-u2)*dt*m1[i]
+		}
+		return
+	}
+	if ch.Path == Rotation {
+		var a, b vmath.Vec4
+		copy(a[:], ch.value(k))
+		copy(b[:], ch.value(next))
+		q := slerp(a, b, u)
+		copy(out, q[:])
+		return
+	}
+	a, b := ch.value(k), ch.value(next)
+	for i := range out {
+		out[i] = a[i] + (b[i]-a[i])*u
+	}
+}
+
+func lerp(a, b vmath.Vec4, u float32) vmath.Vec4 {
+	var v vmath.Vec4
+	for i := range v {
+		v[i] = a[i] + (b[i]-a[i])*u
+	}
+	return v
+}
+
+func dot(a, b vmath.Vec4) float32 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] + a[3]*b[3]
+}
+
+func normalize(q vmath.Vec4) vmath.Vec4 {
+	l := float32(math.Sqrt(float64(dot(q, q))))
+	if l == 0 {
+		return vmath.Vec4{0, 0, 0, 1}
+	}
+	return vmath.Vec4{q[0] / l, q[1] / l, q[2] / l, q[3] / l}
+}
+
+// slerp interpolates unit quaternions a and b along the shortest arc.
+func slerp(a, b vmath.Vec4, u float32) vmath.Vec4 {
+	cos := dot(a, b)
+	if cos < 0 {
+		b, cos = vmath.Vec4{-b[0], -b[1], -b[2], -b[3]}, -cos
+	}
+	// Nearly the same rotation, where the angle is too small to divide by
+	if cos > 0.9995 {
+		return normalize(lerp(a, b, u))
+	}
+	theta := math.Acos(float64(cos))
+	sin := math.Sin(theta)
+	wa := float32(math.Sin((1-float64(u))*theta) / sin)
+	wb := float32(math.Sin(float64(u)*theta) / sin)
+	return vmath.Vec4{
+		a[0]*wa + b[0]*wb,
+		a[1]*wa + b[1]*wb,
+		a[2]*wa + b[2]*wb,
+		a[3]*wa + b[3]*wb,
+	}
+}
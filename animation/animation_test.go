@@ -0,0 +1,221 @@
+package animation
+
+import (
+	"math"
+	"testing"
+
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+// turnZ is the quaternion turning degrees around Z as a slice.
+func turnZ(degrees float32) []float32 {
+	q := vmath.AxisAngle(vmath.Radians(degrees), vmath.Vec3{0, 0, 1})
+	return q[:]
+}
+
+func nearVec(a, b []float32) bool {
+	for i := range a {
+		if !near(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// arm is a root with a child one along X, the child the only joint.
+func arm(t *testing.T) *Skeleton {
+	t.Helper()
+	child := scene.Identity()
+	child.Translation = vmath.Vec3{1, 0, 0}
+	s, err := NewSkeleton([]Node{
+		{Name: "hand", Parent: 1, Rest: child},
+		{Name: "shoulder", Parent: -1, Rest: scene.Identity()},
+	}, []Joint{{Node: 0, InverseBind: vmath.Translate(vmath.Vec3{-1, 0, 0})}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewSkeletonRejectsCycles(t *testing.T) {
+	_, err := NewSkeleton([]Node{
+		{Parent: 1, Rest: scene.Identity()},
+		{Parent: 0, Rest: scene.Identity()},
+	}, nil)
+	if err == nil {
+		t.Error("NewSkeleton accepted a cycle")
+	}
+	if _, err := NewSkeleton([]Node{{Parent: -1}}, []Joint{{Node: 1}}); err == nil {
+		t.Error("NewSkeleton accepted a joint out of range")
+	}
+}
+
+func TestJointMatricesAtRest(t *testing.T) {
+	s := arm(t)
+	out := make([]vmath.Mat4, 1)
+	s.JointMatrices(s.RestPose(), out)
+	// Bound where it rests, the joint leaves the mesh where it is
+	if ident := vmath.Ident4(); !nearVec(out[0][:], ident[:]) {
+		t.Errorf("joint matrix at rest = %v, want identity", out[0])
+	}
+}
+
+func TestJointMatricesFollowParents(t *testing.T) {
+	s := arm(t)
+	pose := s.RestPose()
+	pose[1].Rotation = vmath.AxisAngle(vmath.Radians(90), vmath.Vec3{0, 0, 1})
+	out := make([]vmath.Mat4, 1)
+	s.JointMatrices(pose, out)
+
+	// A vertex at the hand swings up Y with the shoulder
+	got := out[0].MulVec4(vmath.Vec4{1, 0, 0, 1})
+	if !nearVec(got[:], []float32{0, 1, 0, 1}) {
+		t.Errorf("hand vertex = %v, want 0 1 0", got)
+	}
+}
+
+func TestSampleInterpolation(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel Channel
+		time    float32
+		want    []float32
+	}{
+		{
+			name:    "linear",
+			channel: Channel{Path: Translation, Times: []float32{0, 2}, Values: []float32{0, 0, 0, 2, 4, 6}},
+			time:    0.5,
+			want:    []float32{0.5, 1, 1.5},
+		},
+		{
+			name:    "step",
+			channel: Channel{Path: Translation, Interpolation: Step, Times: []float32{0, 2}, Values: []float32{0, 0, 0, 2, 4, 6}},
+			time:    1.9,
+			want:    []float32{0, 0, 0},
+		},
+		{
+			name:    "before the first keyframe",
+			channel: Channel{Path: Scale, Times: []float32{1, 2}, Values: []float32{2, 2, 2, 4, 4, 4}},
+			time:    0,
+			want:    []float32{2, 2, 2},
+		},
+		{
+			name:    "after the last keyframe",
+			channel: Channel{Path: Scale, Times: []float32{1, 2}, Values: []float32{2, 2, 2, 4, 4, 4}},
+			time:    3,
+			want:    []float32{4, 4, 4},
+		},
+		{
+			// Flat tangents ease in and out, halfway is still halfway
+			name: "cubic spline",
+			channel: Channel{Path: Translation, Interpolation: CubicSpline, Times: []float32{0, 1}, Values: []float32{
+				0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 2, 0, 0, 0, 0, 0,
+			}},
+			time: 0.5,
+			want: []float32{1, 0, 0},
+		},
+		{
+			name:    "spherical",
+			channel: Channel{Path: Rotation, Times: []float32{0, 1}, Values: append(turnZ(0), turnZ(90)...)},
+			time:    0.5,
+			want:    turnZ(45),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clip := &Clip{Channels: []Channel{tt.channel}}
+			pose := Pose{scene.Identity()}
+			clip.Sample(tt.time, pose)
+			var got []float32
+			switch tt.channel.Path {
+			case Translation:
+				got = pose[0].Translation[:]
+			case Scale:
+				got = pose[0].Scale[:]
+			case Rotation:
+				got = pose[0].Rotation[:]
+			}
+			if !nearVec(got, tt.want) {
+				t.Errorf("sampled %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayerBlendsAndCrossFades(t *testing.T) {
+	s := arm(t)
+	move := func(x float32) *Clip {
+		return &Clip{Duration: 1, Channels: []Channel{{
+			Node: 1, Path: Translation, Times: []float32{0, 1}, Values: []float32{x, 0, 0, x, 0, 0},
+		}}}
+	}
+	left, right := move(-2), move(2)
+
+	p := NewPlayer(s)
+	if got := p.Pose()[1].Translation; got != (vmath.Vec3{}) {
+		t.Errorf("nothing playing, shoulder at %v, want rest", got)
+	}
+
+	p.Play(left)
+	p.Play(right).Weight = 3
+	if got := p.Pose()[1].Translation[0]; !near(got, 1) {
+		t.Errorf("blended shoulder x = %v, want 1", got)
+	}
+
+	p.CrossFade(left, 0)
+	if len(p.Tracks()) != 1 {
+		t.Fatalf("%d tracks after switching, want 1", len(p.Tracks()))
+	}
+	p.CrossFade(right, 1)
+	p.Update(0.25)
+	if got := p.Pose()[1].Translation[0]; !near(got, -1) {
+		t.Errorf("a quarter into the fade, shoulder x = %v, want -1", got)
+	}
+	p.Update(1)
+	if len(p.Tracks()) != 1 || p.Tracks()[0].Clip != right || p.Tracks()[0].Weight != 1 {
+		t.Errorf("after the fade tracks are %+v, want only right at full weight", p.Tracks())
+	}
+}
+
+func TestPlayerLoops(t *testing.T) {
+	p := NewPlayer(arm(t))
+	track := p.Play(&Clip{Duration: 2})
+	p.Update(5)
+	if !near(track.Time, 1) {
+		t.Errorf("looping time = %v, want 1", track.Time)
+	}
+	track.Loop = false
+	p.Update(5)
+	if track.Time != 2 {
+		t.Errorf("held time = %v, want 2", track.Time)
+	}
+}
+
+func TestPlayerBlendsMorphWeights(t *testing.T) {
+	s, err := NewSkeleton([]Node{{Parent: -1, Rest: scene.Identity(), Weights: []float32{0.5, 0}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPlayer(s)
+	if got := p.Weights()[0]; !nearVec(got, []float32{0.5, 0}) {
+		t.Errorf("nothing playing, weights %v, want the defaults", got)
+	}
+
+	// Two targets over two keyframes, the second's weights as a scalar
+	// accessor would have them
+	open := &Clip{Duration: 1, Channels: []Channel{{
+		Path: Weights, Times: []float32{0, 1}, Values: []float32{0, 0, 0, 1},
+	}}}
+	p.Play(open).Time = 0.5
+	p.Play(&Clip{Duration: 1})
+	if got := p.Weights()[0]; !nearVec(got, []float32{0.25, 0.25}) {
+		t.Errorf("blended weights %v, want 0.25 0.25", got)
+	}
+}
@@ -0,0 +1,237 @@
+package animation
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// Track is a clip being played.
+type Track struct {
+	Clip *Clip
+	// Time is how far into the clip it is in seconds.
+	Time float32
+	// Speed scales how fast Time advances, 1 is real time.
+	Speed float32
+	// Weight is how much of the blended pose is the clip's.
+	Weight float32
+	// Loop starts the clip again after its end, otherwise it holds there.
+	Loop bool
+
+	// fade is how fast Weight changes a second, the track stops once
+	// it's faded out.
+	fade float32
+}
+
+// Player plays clips on a skeleton, blending the poses of every track by
+// their weights. It isn't safe for concurrent use.
+type Player struct {
+	skeleton *Skeleton
+	tracks   []*Track
+	pose     Pose
+	scratch  Pose
+	// weights and weightsScratch are like pose and scratch for the morph
+	// target weights.
+	weights        [][]float32
+	weightsScratch [][]float32
+}
+
+// NewPlayer plays clips on s, which is at rest until one is played.
+func NewPlayer(s *Skeleton) *Player {
+	return &Player{skeleton: s}
+}
+
+// Skeleton is the skeleton being posed.
+func (p *Player) Skeleton() *Skeleton {
+	return p.skeleton
+}
+
+// Tracks are the clips playing, oldest first.
+func (p *Player) Tracks() []*Track {
+	return p.tracks
+}
+
+// Play starts clip looping at full weight alongside anything already
+// playing.
+func (p *Player) Play(clip *Clip) *Track {
+	t := &Track{Clip: clip, Speed: 1, Weight: 1, Loop: true}
+	p.tracks = append(p.tracks, t)
+	return t
+}
+
+// CrossFade starts clip looping and, over duration seconds, fades it in
+// while every other track fades out. A duration of zero switches straight
+// away.
+func (p *Player) CrossFade(clip *Clip, duration float32) *Track {
+	if duration <= 0 {
+		p.tracks = p.tracks[:0]
+		return p.Play(clip)
+	}
+	for _, t := range p.tracks {
+		t.fade = -t.Weight / duration
+	}
+	t := p.Play(clip)
+	t.Weight = 0
+	t.fade = 1 / duration
+	return t
+}
+
+// Stop removes t.
+func (p *Player) Stop(t *Track) {
+	for i, other := range p.tracks {
+		if other == t {
+			p.tracks = append(p.tracks[:i], p.tracks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Update advances every track dt seconds, applying fades.
+func (p *Player) Update(dt float32) {
+	tracks := p.tracks[:0]
+	for _, t := range p.tracks {
+		t.Time += dt * t.Speed
+		if d := t.Clip.Duration; d > 0 {
+			if t.Loop {
+				t.Time = float32(math.Mod(float64(t.Time), float64(d)))
+				if t.Time < 0 {
+					t.Time += d
+				}
+			} else if t.Time > d {
+				t.Time = d
+			}
+		}
+
+		if t.fade != 0 {
+			t.Weight += t.fade * dt
+			switch {
+			case t.Weight <= 0 && t.fade < 0:
+				continue
+			case t.Weight >= 1 && t.fade > 0:
+				t.Weight, t.fade = 1, 0
+			}
+		}
+		tracks = append(tracks, t)
+	}
+	p.tracks = tracks
+}
+
+// Pose is the tracks' poses blended by weight, the rest pose when nothing
+// has any. It's reused by the next call.
+func (p *Player) Pose() Pose {
+	rest := p.skeleton.RestPose()
+	if p.pose == nil {
+		p.pose = make(Pose, len(rest))
+		p.scratch = make(Pose, len(rest))
+	}
+
+	var total float32
+	for _, t := range p.tracks {
+		if t.Weight > 0 {
+			total += t.Weight
+		}
+	}
+	if total == 0 {
+		copy(p.pose, rest)
+		return p.pose
+	}
+
+	first := true
+	for _, t := range p.tracks {
+		if t.Weight <= 0 {
+			continue
+		}
+		copy(p.scratch, rest)
+		t.Clip.Sample(t.Time, p.scratch)
+		w := t.Weight / total
+		for i, n := range p.scratch {
+			out := &p.pose[i]
+			if first {
+				out.Translation = n.Translation.Mul(w)
+				out.Scale = n.Scale.Mul(w)
+				out.Rotation = scale(n.Rotation, w)
+				continue
+			}
+			out.Translation = out.Translation.Add(n.Translation.Mul(w))
+			out.Scale = out.Scale.Add(n.Scale.Mul(w))
+			// q and -q are the same rotation, adding the one on the
+			// same side keeps the sum from cancelling out
+			rw := w
+			if dot(out.Rotation, n.Rotation) < 0 {
+				rw = -w
+			}
+			out.Rotation = add(out.Rotation, scale(n.Rotation, rw))
+		}
+		first = false
+	}
+	for i := range p.pose {
+		p.pose[i].Rotation = normalize(p.pose[i].Rotation)
+	}
+	return p.pose
+}
+
+// Weights are the tracks' morph target weights blended by weight, a slice
+// per node like Node.Weights. It's reused by the next call.
+func (p *Player) Weights() [][]float32 {
+	nodes := p.skeleton.Nodes
+	if p.weights == nil {
+		p.weights = make([][]float32, len(nodes))
+		p.weightsScratch = make([][]float32, len(nodes))
+		for i, n := range nodes {
+			if n.Weights != nil {
+				p.weights[i] = make([]float32, len(n.Weights))
+				p.weightsScratch[i] = make([]float32, len(n.Weights))
+			}
+		}
+	}
+
+	var total float32
+	for _, t := range p.tracks {
+		if t.Weight > 0 {
+			total += t.Weight
+		}
+	}
+	for i, n := range nodes {
+		if total == 0 {
+			copy(p.weights[i], n.Weights)
+			continue
+		}
+		for j := range p.weights[i] {
+			p.weights[i][j] = 0
+		}
+	}
+	if total == 0 {
+		return p.weights
+	}
+
+	for _, t := range p.tracks {
+		if t.Weight <= 0 {
+			continue
+		}
+		for i, n := range nodes {
+			copy(p.weightsScratch[i], n.Weights)
+		}
+		t.Clip.SampleWeights(t.Time, p.weightsScratch)
+		w := t.Weight / total
+		for i, sampled := range p.weightsScratch {
+			for j, v := range sampled {
+				p.weights[i][j] += v * w
+			}
+		}
+	}
+	return p.weights
+}
+
+// JointMatrices fills out, which has a matrix per joint, with the
+// transforms skinning a mesh to the blended pose.
+func (p *Player) JointMatrices(out []vmath.Mat4) {
+	p.skeleton.JointMatrices(p.Pose(), out)
+}
+
+func scale(q vmath.Vec4, s float32) vmath.Vec4 {
+	return vmath.Vec4{q[0] * s, q[1] * s, q[2] * s, q[3] * s}
+}
+
+func add(a, b vmath.Vec4) vmath.Vec4 {
+	return vmath.Vec4{a[0] + b[0], a[1] + b[1], a[2] + b[2], a[3] + b[3]}
+}
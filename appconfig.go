@@ -0,0 +1,73 @@
+package main
+
+import (
+	"image"
+
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+const (
+	defaultWidth  = 1280
+	defaultHeight = 720
+	defaultTitle  = "Learn Vulkan"
+)
+
+// AppConfig describes the window the application opens. The zero value is
+// a resizable, decorated 1280x720 window centred on the primary monitor.
+type AppConfig struct {
+	// Width and Height are the windowed size in screen coordinates, zero
+	// falls back to 1280x720. Headless renders at this size in pixels.
+	Width  int
+	Height int
+	// Title names the window and the Vulkan instance, empty means
+	// "Learn Vulkan".
+	Title string
+	// FixedSize stops the window from being resized by the user.
+	FixedSize bool
+	// Undecorated leaves off the title bar and borders.
+	Undecorated bool
+	// Icon is the window icon at one or more sizes, the platform picks the
+	// closest. Nil keeps the default icon.
+	Icon []image.Image
+	// Position is where the window's top left corner starts relative to
+	// Monitor, nil centres it.
+	Position *image.Point
+	// Monitor is the index or a name substring of the monitor the window
+	// starts on and Fullscreen and Borderless cover, empty meaning the
+	// primary monitor.
+	Monitor string
+}
+
+func (c AppConfig) withDefaults() AppConfig {
+	if c.Width <= 0 {
+		c.Width = defaultWidth
+	}
+	if c.Height <= 0 {
+		c.Height = defaultHeight
+	}
+	if c.Title == "" {
+		c.Title = defaultTitle
+	}
+	return c
+}
+
+// placeWindow moves the window to its starting position on the monitor.
+func (app *HelloTriangleApplication) placeWindow() {
+	x, y := app.monitor.GetPos()
+	if p := app.config.Position; p != nil {
+		app.window.SetPos(x+p.X, y+p.Y)
+		return
+	}
+
+	mode := app.monitor.GetVideoMode()
+	w, h := app.window.GetSize()
+	app.window.SetPos(x+(mode.Width-w)/2, y+(mode.Height-h)/2)
+}
+
+// glfwBool converts to GLFW's True and False for hints and attributes.
+func glfwBool(b bool) int {
+	if b {
+		return glfw.True
+	}
+	return glfw.False
+}
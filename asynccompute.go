@@ -0,0 +1,192 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const defaultAsyncComputeKey = glfw.KeyF6
+
+func (app *HelloTriangleApplication) asyncComputeKey() glfw.Key {
+	if app.AsyncComputeKey == 0 {
+		return defaultAsyncComputeKey
+	}
+	return app.AsyncComputeKey
+}
+
+// asyncComputeAvailable reports whether particles can be stepped on a
+// compute queue of their own. Without a non-graphics compute family it'd
+// only be the graphics queue again, and with several windows they'd each
+// have to wait for the primary window's step. External particles aren't
+// stepped at all.
+func (app *HelloTriangleApplication) asyncComputeAvailable() bool {
+	return app.particlesEnabled() && !app.externalParticles && app.queueFamilies.DedicatedCompute() && len(app.Windows) == 0
+}
+
+// particleFamilies are the queue families sharing the particle buffers.
+// They're shared concurrently when the step can run on the compute queue so
+// switching between that and the graphics queue never has to hand them
+// over, the transfer family uploads them.
+func (app *HelloTriangleApplication) particleFamilies() []uint32 {
+	if !app.asyncComputeAvailable() {
+		return nil
+	}
+	return uniqueFamilies(app.queueFamilies.Graphics, app.queueFamilies.Compute, app.queueFamilies.Transfer)
+}
+
+// createAsyncCompute creates what stepping particles on the compute queue
+// takes: a command buffer and a semaphore the draws wait on per frame in
+// flight, and a semaphore per particle buffer the step overwriting it waits
+// on until the draws reading it are done. It's created whenever it's
+// available so the AsyncCompute option only picks how it starts.
+func (app *HelloTriangleApplication) createAsyncCompute() error {
+	if !app.asyncComputeAvailable() {
+		if app.AsyncCompute {
+			app.logger.Info("Stepping particles on the graphics queue", logging.F("reason", "no dedicated compute queue family"))
+		}
+		return nil
+	}
+
+	pool, err := commands.NewPool(app.device, uint32(app.queueFamilies.Compute))
+	if err != nil {
+		return errors.Wrap(err, "can't create particle compute command pool")
+	}
+	app.particleComputePool = pool
+	if app.particleComputeBuffers, err = pool.Allocate(app.framesInFlight()); err != nil {
+		return errors.Wrap(err, "can't allocate particle compute command buffers")
+	}
+
+	semaphoreInfo := &vk.SemaphoreCreateInfo{
+		SType: vk.StructureTypeSemaphoreCreateInfo,
+	}
+	app.particleStepped = make([]vk.Semaphore, app.framesInFlight())
+	for i := range app.particleStepped {
+		if err := vk.Error(vk.CreateSemaphore(app.device, semaphoreInfo, nil, &app.particleStepped[i])); err != nil {
+			return errors.Wrapf(err, "can't create particle stepped semaphore for frame %d", i)
+		}
+		app.track("semaphore", app.particleStepped[i])
+		app.name(app.particleStepped[i], "particles stepped %d", i)
+	}
+	for i := range app.particleReleased {
+		if err := vk.Error(vk.CreateSemaphore(app.device, semaphoreInfo, nil, &app.particleReleased[i])); err != nil {
+			return errors.Wrapf(err, "can't create particle released semaphore for buffer %d", i)
+		}
+		app.track("semaphore", app.particleReleased[i])
+		app.name(app.particleReleased[i], "particles %d released", i)
+	}
+
+	app.asyncCompute = app.AsyncCompute
+	app.logger.Info("Async compute available",
+		logging.F("computeFamily", app.queueFamilies.Compute),
+		logging.F("enabled", app.asyncCompute))
+	return nil
+}
+
+// toggleAsyncCompute switches stepping particles between the compute and
+// graphics queues, so frame times can be compared with and without the
+// overlap. Everything in flight finishes first so no semaphore is left
+// signaled with nothing waiting on it.
+func (app *HelloTriangleApplication) toggleAsyncCompute() error {
+	if app.particleComputePool == nil {
+		app.logger.Info("Can't switch async compute", logging.F("reason", "not available"))
+		return nil
+	}
+	if err := app.waitIdle(); err != nil {
+		return err
+	}
+	// Waiting idle doesn't unsignal them, only waiting on them does, so
+	// they're recreated rather than waited on by steps that won't come
+	for i, pending := range app.particleReleasePending {
+		if !pending {
+			continue
+		}
+		app.release(app.particleReleased[i])
+		vk.DestroySemaphore(app.device, app.particleReleased[i], nil)
+		semaphoreInfo := &vk.SemaphoreCreateInfo{
+			SType: vk.StructureTypeSemaphoreCreateInfo,
+		}
+		if err := vk.Error(vk.CreateSemaphore(app.device, semaphoreInfo, nil, &app.particleReleased[i])); err != nil {
+			app.particleReleased[i] = vk.NullSemaphore
+			return errors.Wrapf(err, "can't create particle released semaphore for buffer %d", i)
+		}
+		app.track("semaphore", app.particleReleased[i])
+		app.name(app.particleReleased[i], "particles %d released", i)
+		app.particleReleasePending[i] = false
+	}
+	app.asyncCompute = !app.asyncCompute
+	app.logger.Info("Switched async compute", logging.F("enabled", app.asyncCompute))
+	return nil
+}
+
+// submitParticleStep steps the simulation on the compute queue into the
+// particle buffer that isn't current, which becomes current, when async
+// compute is on and the current window is the primary one. It returns the
+// semaphore the frame's draws have to wait on, null when there isn't one.
+// The step waits for the draws that last read the buffer it overwrites,
+// which signaled its released semaphore.
+func (app *HelloTriangleApplication) submitParticleStep(frame int) (vk.Semaphore, error) {
+	if !app.asyncCompute || app.appWindow != app.windows[0] {
+		return vk.NullSemaphore, nil
+	}
+
+	// The frame's fence has been waited on, and its draws waited on its
+	// last step, so the command buffer is free to record again
+	cb := app.particleComputeBuffers[frame]
+	src := app.particleCurrent
+	if err := commands.Record(cb, app.cmdParticleStep); err != nil {
+		return vk.NullSemaphore, errors.Wrap(err, "can't record particle step")
+	}
+
+	submitInfo := vk.SubmitInfo{
+		SType:                vk.StructureTypeSubmitInfo,
+		CommandBufferCount:   1,
+		PCommandBuffers:      []vk.CommandBuffer{cb},
+		SignalSemaphoreCount: 1,
+		PSignalSemaphores:    []vk.Semaphore{app.particleStepped[frame]},
+	}
+	dst := 1 - src
+	if app.particleReleasePending[dst] {
+		submitInfo.WaitSemaphoreCount = 1
+		submitInfo.PWaitSemaphores = []vk.Semaphore{app.particleReleased[dst]}
+		submitInfo.PWaitDstStageMask = []vk.PipelineStageFlags{vk.PipelineStageFlags(vk.PipelineStageComputeShaderBit)}
+		app.particleReleasePending[dst] = false
+	}
+	if err := vk.Error(vk.QueueSubmit(app.computeQueue, 1, []vk.SubmitInfo{submitInfo}, vk.NullFence)); err != nil {
+		return vk.NullSemaphore, errors.Wrap(err, "can't submit particle step")
+	}
+	return app.particleStepped[frame], nil
+}
+
+// particleReleaseSemaphore is what the current window's draws signal once
+// they're done reading the current particle buffer, null when nothing will
+// wait on it. The step overwriting the buffer waits on it.
+func (app *HelloTriangleApplication) particleReleaseSemaphore() vk.Semaphore {
+	if !app.asyncCompute || app.appWindow != app.windows[0] {
+		return vk.NullSemaphore
+	}
+	app.particleReleasePending[app.particleCurrent] = true
+	return app.particleReleased[app.particleCurrent]
+}
+
+func (app *HelloTriangleApplication) destroyAsyncCompute() {
+	for _, s := range app.particleStepped {
+		app.release(s)
+		vk.DestroySemaphore(app.device, s, nil)
+	}
+	app.particleStepped = nil
+	for i, s := range app.particleReleased {
+		if s != vk.NullSemaphore {
+			app.release(s)
+			vk.DestroySemaphore(app.device, s, nil)
+			app.particleReleased[i] = vk.NullSemaphore
+		}
+	}
+	if app.particleComputePool != nil {
+		app.particleComputePool.Destroy()
+		app.particleComputePool = nil
+	}
+	app.particleComputeBuffers = nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/delaneyj/learnvulkan/stats"
+	"github.com/delaneyj/learnvulkan/swapchain"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// benchWarmupFrames are drawn before Bench's frames and left out of the
+// report, so pipeline creation and first uploads don't skew it.
+const benchWarmupFrames = 30
+
+// BenchReport is what Bench writes, so runs can be compared across commits
+// and drivers. Times are in milliseconds.
+type BenchReport struct {
+	GPU         string `json:"gpu"`
+	Driver      string `json:"driver"`
+	API         string `json:"api"`
+	PresentMode string `json:"present_mode"`
+	Width       uint32 `json:"width"`
+	Height      uint32 `json:"height"`
+	// Frames is how many frames the numbers cover, fewer than Bench when
+	// the window was closed early.
+	Frames int `json:"frames"`
+	// FrameTime is the time between presents.
+	FrameTime BenchTiming `json:"frame_time"`
+	// CPU is how long frames took to record and submit.
+	CPU BenchTiming `json:"cpu"`
+	// GPU is how long each profiled scope took on the GPU, empty when the
+	// device can't write timestamps.
+	GPU map[string]BenchTiming `json:"gpu"`
+	// DrawCalls is the mean number of draw calls per frame.
+	DrawCalls uint64 `json:"draw_calls"`
+}
+
+// BenchTiming is stats.Timing in milliseconds.
+type BenchTiming struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func newBenchTiming(t stats.Timing) BenchTiming {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return BenchTiming{
+		Min: ms(t.Min),
+		Avg: ms(t.Mean),
+		P50: ms(t.P50),
+		P95: ms(t.P95),
+		P99: ms(t.P99),
+		Max: ms(t.Max),
+	}
+}
+
+// prepareBench turns off vsync and turns on GPU profiling for Bench,
+// unless a present mode was asked for.
+func (app *HelloTriangleApplication) prepareBench() {
+	if app.Bench <= 0 {
+		return
+	}
+	if app.PresentMode == "" {
+		app.PresentMode = swapchain.PresentModeName(vk.PresentModeImmediate)
+	}
+	app.ProfileGPU = true
+}
+
+// benchFinished reports whether the primary window has drawn Bench's
+// frames.
+func (app *HelloTriangleApplication) benchFinished() bool {
+	return app.Bench > 0 && app.windows[0].frameCount >= uint64(benchWarmupFrames+app.Bench)
+}
+
+// writeBenchReport writes the primary window's BenchReport as JSON to
+// BenchOutput.
+func (app *HelloTriangleApplication) writeBenchReport() error {
+	w := app.windows[0]
+	s := w.frameStats.Summary()
+
+	frames := int(w.frameCount) - benchWarmupFrames
+	if frames < 0 {
+		frames = 0
+	}
+	if frames > app.Bench {
+		frames = app.Bench
+	}
+
+	properties := app.vulkan().PhysicalDeviceProperties(app.physicalDevice)
+	report := BenchReport{
+		GPU:         vk.ToString(properties.DeviceName[:]),
+		Driver:      driverVersionString(properties.VendorID, properties.DriverVersion),
+		API:         versionString(properties.ApiVersion),
+		PresentMode: swapchain.PresentModeName(w.swapchain.PresentMode),
+		Width:       w.target.Extent.Width,
+		Height:      w.target.Extent.Height,
+		Frames:      frames,
+		FrameTime:   newBenchTiming(s.Present),
+		CPU:         newBenchTiming(s.CPU),
+		GPU:         make(map[string]BenchTiming, len(s.GPU)),
+		DrawCalls:   s.Counts[drawCallsCount],
+	}
+	for scope, t := range s.GPU {
+		report.GPU[scope] = newBenchTiming(t)
+	}
+
+	out := app.BenchOutput
+	if out == nil {
+		out = os.Stdout
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(report), "can't write benchmark report")
+}
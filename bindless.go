@@ -0,0 +1,203 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Bindings within materialSet when bindless, matching bindless.glsl.
+const (
+	bindlessMaterialsBinding = iota
+	bindlessTexturesBinding
+)
+
+// maxBindlessTextures is the size of the texture table. Devices with
+// descriptor indexing allow at least 500,000 update after bind samplers per
+// stage, this is just what a scene is expected to need.
+const maxBindlessTextures = 4096
+
+// BindlessMaterial matches the std430 Material struct in bindless.glsl, a
+// material's factors followed by the index of each of its textures in the
+// texture table.
+type BindlessMaterial struct {
+	Factors           MaterialFactors
+	BaseColor         uint32
+	MetallicRoughness uint32
+	Normal            uint32
+	Occlusion         uint32
+	Emissive          uint32
+	_                 [3]uint32
+}
+
+// MaterialConstants is pushed per mesh group when bindless, matching the
+// end of the push_constant block in bindless.frag and gbufferbindless.frag.
+type MaterialConstants struct {
+	Material uint32
+}
+
+var materialConstants = pipeline.NewPushConstants[MaterialConstants](
+	vk.ShaderStageFlags(vk.ShaderStageFragmentBit), drawConstants.Size())
+
+// wantsBindless is whether materials would be bound bindless on a device
+// with descriptor indexing.
+func (app *HelloTriangleApplication) wantsBindless() bool {
+	return !app.MaterialSets
+}
+
+// fragmentConstants is the push constant range the fragment shader reads,
+// DrawConstants followed by MaterialConstants when bindless.
+func (app *HelloTriangleApplication) fragmentConstants() vk.PushConstantRange {
+	r := drawConstants.Range()
+	if app.bindless {
+		r.Size = materialConstants.Offset + materialConstants.Size()
+	}
+	return r
+}
+
+// createBindlessMaterials uploads every material's factors along with its
+// textures' indices in the texture table, once every material's been
+// created.
+func (app *HelloTriangleApplication) createBindlessMaterials() error {
+	if !app.bindless {
+		if app.wantsBindless() {
+			app.logger.Info("Binding a descriptor set per material", logging.F("reason", "no device supports descriptor indexing"))
+		}
+		return nil
+	}
+
+	index := map[*gpu.Image]uint32{}
+	texture := func(img *gpu.Image) uint32 {
+		i, ok := index[img]
+		if !ok {
+			i = uint32(len(app.bindlessTextures))
+			index[img] = i
+			app.bindlessTextures = append(app.bindlessTextures, img)
+		}
+		return i
+	}
+
+	materials := make([]BindlessMaterial, len(app.materials))
+	for i, m := range app.materials {
+		materials[i] = BindlessMaterial{
+			Factors:           m.Values,
+			BaseColor:         texture(m.BaseColor),
+			MetallicRoughness: texture(m.MetallicRoughness),
+			Normal:            texture(m.Normal),
+			Occlusion:         texture(m.Occlusion),
+			Emissive:          texture(m.Emissive),
+		}
+	}
+	if len(app.bindlessTextures) > maxBindlessTextures {
+		return errors.Errorf("materials use %d textures, the texture table holds %d", len(app.bindlessTextures), maxBindlessTextures)
+	}
+
+	b, err := gpu.NewStorageBuffer(app.gpuContext(), materials)
+	if err != nil {
+		return errors.Wrap(err, "can't upload bindless materials")
+	}
+	app.bindlessMaterials = b
+	app.name(b.Handle, "bindless materials")
+
+	app.logger.Info("Binding materials bindless",
+		logging.F("materials", len(materials)),
+		logging.F("textures", len(app.bindlessTextures)))
+	return nil
+}
+
+// createBindlessSet creates the current window's material table, a set of
+// the materials and every texture from a pool of its own since update after
+// bind sets can't share the descriptor allocator's.
+func (app *HelloTriangleApplication) createBindlessSet() error {
+	pool, err := descriptors.NewUpdateAfterBindPool(app.device, app.shaderBindings, materialSet, 1)
+	if err != nil {
+		return err
+	}
+	app.bindlessPool = pool
+
+	allocInfo := &vk.DescriptorSetAllocateInfo{
+		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     pool,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vk.DescriptorSetLayout{app.materialSetLayout},
+	}
+	var set vk.DescriptorSet
+	if err := vk.Error(vk.AllocateDescriptorSets(app.device, allocInfo, &set)); err != nil {
+		return errors.Wrap(err, "can't allocate bindless material set")
+	}
+	app.bindlessSet = set
+
+	images := make([]vk.DescriptorImageInfo, len(app.bindlessTextures))
+	for i, img := range app.bindlessTextures {
+		images[i] = vk.DescriptorImageInfo{
+			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+			ImageView:   img.View,
+			Sampler:     app.textureSampler,
+		}
+	}
+	// The rest of the table is left unwritten, it's partially bound
+	writes := []vk.WriteDescriptorSet{
+		{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      bindlessMaterialsBinding,
+			DescriptorType:  vk.DescriptorTypeStorageBuffer,
+			DescriptorCount: 1,
+			PBufferInfo: []vk.DescriptorBufferInfo{{
+				Buffer: app.bindlessMaterials.Handle,
+				Offset: 0,
+				Range:  app.bindlessMaterials.Size,
+			}},
+		},
+		{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      bindlessTexturesBinding,
+			DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+			DescriptorCount: uint32(len(images)),
+			PImageInfo:      images,
+		},
+	}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+	return nil
+}
+
+// bindMaterialTable binds the current window's material table for layout
+// when bindless, once before any of bindMaterial's pushes.
+func (app *HelloTriangleApplication) bindMaterialTable(cb vk.CommandBuffer, layout vk.PipelineLayout) {
+	if !app.bindless {
+		return
+	}
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, layout, materialSet,
+		1, []vk.DescriptorSet{app.bindlessSet}, 0, nil)
+}
+
+// bindMaterial selects material for the following draws, pushing its index
+// into the table when bindless and binding its set otherwise.
+func (app *HelloTriangleApplication) bindMaterial(cb vk.CommandBuffer, layout vk.PipelineLayout, material int) {
+	if app.bindless {
+		materialConstants.Push(cb, layout, MaterialConstants{Material: uint32(material)})
+		return
+	}
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, layout, materialSet,
+		1, []vk.DescriptorSet{app.materialSets[material]}, 0, nil)
+}
+
+func (app *HelloTriangleApplication) destroyBindlessSet() {
+	if app.bindlessPool != vk.NullDescriptorPool {
+		vk.DestroyDescriptorPool(app.device, app.bindlessPool, nil)
+		app.bindlessPool = vk.NullDescriptorPool
+	}
+	app.bindlessSet = vk.NullDescriptorSet
+}
+
+func (app *HelloTriangleApplication) destroyBindlessMaterials() {
+	if app.bindlessMaterials != nil {
+		app.bindlessMaterials.Destroy()
+		app.bindlessMaterials = nil
+	}
+	app.bindlessTextures = nil
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/postprocess"
+	"github.com/delaneyj/learnvulkan/renderpass"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// sceneFormat is the HDR color the scene is drawn in with bloom on,
+	// renderable, sampleable and storable everywhere.
+	sceneFormat = vk.FormatR16g16b16a16Sfloat
+	// bloomLevels is the length of the bloom chain, the first level is half
+	// the target's size and each after that half again.
+	bloomLevels = 6
+	// bloomDispatches is how many times bloom.comp runs per frame, see
+	// bloomPasses.
+	bloomDispatches = 2*bloomLevels - 1
+	// bloomGroupSize is bloom.comp's local size in x and y.
+	bloomGroupSize = 8
+	// compositeVertices is the fullscreen triangle lighting.vert draws.
+	compositeVertices = 3
+)
+
+// Passes of bloom.comp, matching its mode constants.
+const (
+	bloomPrefilter uint32 = iota
+	bloomDownsample
+	bloomUpsample
+)
+
+// BloomConfig tunes the bloom, the scene UI edits it while running.
+type BloomConfig struct {
+	// Threshold is the HDR brightness above which light blooms, with a
+	// soft knee of half of it below.
+	Threshold float32
+	// Intensity scales the bloom added back onto the scene.
+	Intensity float32
+}
+
+var defaultBloomConfig = BloomConfig{
+	Threshold: 1,
+	Intensity: 0.3,
+}
+
+// BloomConstants is pushed once per bloom dispatch, matching the
+// push_constant block in bloom.comp.
+type BloomConstants struct {
+	Mode      uint32
+	Threshold float32
+	Knee      float32
+}
+
+var bloomConstants = pipeline.NewPushConstants[BloomConstants](vk.ShaderStageFlags(vk.ShaderStageComputeBit), 0)
+
+// CompositeConstants is pushed once per composite pass, matching the
+// push_constant block in composite.frag.
+type CompositeConstants struct {
+	Intensity float32
+}
+
+var compositeConstants = pipeline.NewPushConstants[CompositeConstants](vk.ShaderStageFlags(vk.ShaderStageFragmentBit), 0)
+
+// sceneImage is the name the HDR scene goes by in the post-process chain.
+const sceneImage = "scene"
+
+// bloomLevel is the name of the bloom chain's level i.
+func bloomLevel(i int) string {
+	return fmt.Sprintf("bloom %d", i)
+}
+
+// bloomPass is a single bloom.comp dispatch reading src into dst.
+type bloomPass struct {
+	mode     uint32
+	src, dst *gpu.Image
+}
+
+// bloomEffect blooms the scene into a chain of levels, each half the size
+// of the one before, with bloom.comp.
+type bloomEffect struct {
+	app *HelloTriangleApplication
+}
+
+func (bloomEffect) Name() string { return "bloom" }
+
+func (bloomEffect) Inputs() []string { return []string{sceneImage} }
+
+func (bloomEffect) Outputs() []postprocess.Output {
+	outputs := make([]postprocess.Output, bloomLevels)
+	for i := range outputs {
+		outputs[i] = postprocess.Output{
+			Name:    bloomLevel(i),
+			Format:  sceneFormat,
+			Divisor: 2 << i,
+			Access:  postprocess.Storage,
+		}
+	}
+	return outputs
+}
+
+func (e bloomEffect) Bind(images postprocess.Images) { e.app.updateBloomSets(images) }
+
+func (e bloomEffect) Record(cb vk.CommandBuffer, frame postprocess.Frame) {
+	e.app.recordBloom(cb, frame.Images)
+}
+
+// compositeEffect adds the first bloom level to the scene and tonemaps it
+// into the target image.
+type compositeEffect struct {
+	app *HelloTriangleApplication
+}
+
+func (compositeEffect) Name() string { return "composite" }
+
+func (compositeEffect) Inputs() []string { return []string{sceneImage, bloomLevel(0)} }
+
+func (compositeEffect) Outputs() []postprocess.Output { return nil }
+
+func (e compositeEffect) Bind(images postprocess.Images) { e.app.updateCompositeSet(images) }
+
+func (e compositeEffect) Record(cb vk.CommandBuffer, frame postprocess.Frame) {
+	e.app.recordComposite(cb, frame.TargetIndex)
+}
+
+// bloomEnabled is whether the scene is drawn in HDR and bloomed and
+// tonemapped into the target.
+func (app *HelloTriangleApplication) bloomEnabled() bool {
+	return app.Bloom != nil
+}
+
+// sceneTarget is the format and final layout of the color the render pass
+// draws the scene into, the HDR scene image with bloom and the target
+// without. The scene is left as a color attachment for the post-process
+// chain's barrier to wait on its writes.
+func (app *HelloTriangleApplication) sceneTarget() (vk.Format, vk.ImageLayout) {
+	if app.bloomEnabled() {
+		return sceneFormat, vk.ImageLayoutColorAttachmentOptimal
+	}
+	return app.target.Format, app.target.FinalLayout
+}
+
+// sceneView is the view the render pass draws the scene into for the target
+// image viewed by iv.
+func (app *HelloTriangleApplication) sceneView(iv vk.ImageView) vk.ImageView {
+	if app.bloomEnabled() {
+		return app.sceneColor.View
+	}
+	return iv
+}
+
+// createBloom creates the sampler, layouts and compute pipeline every
+// window's bloom shares when Bloom is set.
+func (app *HelloTriangleApplication) createBloom() error {
+	if !app.bloomEnabled() {
+		return nil
+	}
+	app.bloom = *app.Bloom
+
+	samplerInfo := &vk.SamplerCreateInfo{
+		SType:        vk.StructureTypeSamplerCreateInfo,
+		MagFilter:    vk.FilterLinear,
+		MinFilter:    vk.FilterLinear,
+		AddressModeU: vk.SamplerAddressModeClampToEdge,
+		AddressModeV: vk.SamplerAddressModeClampToEdge,
+		AddressModeW: vk.SamplerAddressModeClampToEdge,
+		MipmapMode:   vk.SamplerMipmapModeNearest,
+	}
+	var sampler vk.Sampler
+	if err := vk.Error(vk.CreateSampler(app.device, samplerInfo, nil, &sampler)); err != nil {
+		return errors.Wrap(err, "can't create bloom sampler")
+	}
+	app.track("sampler", sampler)
+	app.bloomSampler = sampler
+
+	code := app.shaderCode("bloom.comp", shaders.Bloom())
+	comp, err := spirv.Reflect(code)
+	if err != nil {
+		return errors.Wrap(err, "can't reflect bloom shader")
+	}
+	if app.bloomSetLayout, app.bloomBindings, err = app.singleSetLayout("bloom shader", comp); err != nil {
+		return err
+	}
+	layout, err := pipeline.NewLayout(app.device, []vk.DescriptorSetLayout{app.bloomSetLayout}, []vk.PushConstantRange{bloomConstants.Range()})
+	if err != nil {
+		return err
+	}
+	app.bloomPipelineLayout = layout
+	app.name(layout, "bloom pipeline layout")
+
+	compute, err := pipeline.NewCompute(app.device, layout, code)
+	if err != nil {
+		return errors.Wrap(err, "can't create bloom pipeline")
+	}
+	app.bloomPipeline = compute
+	app.track("pipeline", compute)
+	app.name(compute, "bloom pipeline")
+
+	vert, err := spirv.Reflect(app.shaderCode("lighting.vert", shaders.LightingVert()))
+	if err != nil {
+		return errors.Wrap(err, "can't reflect composite vertex shader")
+	}
+	frag, err := spirv.Reflect(app.shaderCode("composite.frag", shaders.CompositeFrag()))
+	if err != nil {
+		return errors.Wrap(err, "can't reflect composite fragment shader")
+	}
+	if app.compositeSetLayout, app.compositeBindings, err = app.singleSetLayout("composite shaders", vert, frag); err != nil {
+		return err
+	}
+	layout, err = pipeline.NewLayout(app.device, []vk.DescriptorSetLayout{app.compositeSetLayout}, []vk.PushConstantRange{compositeConstants.Range()})
+	if err != nil {
+		return err
+	}
+	app.compositePipelineLayout = layout
+	app.name(layout, "composite pipeline layout")
+	return nil
+}
+
+// singleSetLayout creates the descriptor set layout for modules, which are
+// expected to only use set 0.
+func (app *HelloTriangleApplication) singleSetLayout(what string, modules ...*spirv.Module) (vk.DescriptorSetLayout, []pipeline.StageBinding, error) {
+	bindings, err := pipeline.MergeBindings(modules...)
+	if err != nil {
+		return vk.NullDescriptorSetLayout, nil, err
+	}
+	layouts, err := pipeline.NewSetLayouts(app.device, bindings)
+	if err != nil {
+		return vk.NullDescriptorSetLayout, nil, err
+	}
+	if len(layouts) != 1 {
+		for _, l := range layouts {
+			vk.DestroyDescriptorSetLayout(app.device, l, nil)
+		}
+		return vk.NullDescriptorSetLayout, nil, errors.Errorf("%s use %d descriptor sets, expected 1", what, len(layouts))
+	}
+	return layouts[0], bindings, nil
+}
+
+// createPostProcess creates the HDR scene image and builds the
+// post-process chain over it at the target's size.
+func (app *HelloTriangleApplication) createPostProcess() error {
+	if !app.bloomEnabled() {
+		return nil
+	}
+
+	extent := app.target.Extent
+	scene, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:  extent.Width,
+		Height: extent.Height,
+		Format: sceneFormat,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit | vk.ImageUsageSampledBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create HDR scene image")
+	}
+	app.sceneColor = scene
+	app.name(scene.Handle, "HDR scene")
+
+	if app.postChain == nil {
+		app.postPool = postprocess.NewPool(app.gpuContext())
+		app.postPool.Name = func(img *gpu.Image, name string) {
+			app.name(img.Handle, "post-process %s", name)
+		}
+		app.postChain = postprocess.NewChain(app.postPool,
+			bloomEffect{app},
+			compositeEffect{app},
+		)
+	}
+	return app.postChain.Build(extent, postprocess.Images{sceneImage: scene})
+}
+
+func (app *HelloTriangleApplication) destroyPostProcess() {
+	for _, fb := range app.compositeFramebuffers {
+		app.release(fb)
+		vk.DestroyFramebuffer(app.device, fb, nil)
+	}
+	app.compositeFramebuffers = nil
+	if app.postChain != nil {
+		app.postChain.Release()
+		app.postPool.Trim()
+	}
+	if app.sceneColor != nil {
+		app.sceneColor.Destroy()
+		app.sceneColor = nil
+	}
+}
+
+// bloomPasses are the dispatches, in order, blooming the scene: a
+// thresholded downsample into the first level, downsamples through the
+// rest and upsamples back up adding each level onto the one above.
+func bloomPasses(images postprocess.Images) []bloomPass {
+	chain := make([]*gpu.Image, bloomLevels)
+	for i := range chain {
+		chain[i] = images[bloomLevel(i)]
+	}
+	passes := []bloomPass{{mode: bloomPrefilter, src: images[sceneImage], dst: chain[0]}}
+	for i := 1; i < len(chain); i++ {
+		passes = append(passes, bloomPass{mode: bloomDownsample, src: chain[i-1], dst: chain[i]})
+	}
+	for i := len(chain) - 2; i >= 0; i-- {
+		passes = append(passes, bloomPass{mode: bloomUpsample, src: chain[i+1], dst: chain[i]})
+	}
+	return passes
+}
+
+// createBloomSets allocates the current window's bloom and composite sets.
+// Their number doesn't depend on the target's size so they're only
+// rewritten when the swapchain is recreated.
+func (app *HelloTriangleApplication) createBloomSets() error {
+	if !app.bloomEnabled() {
+		return nil
+	}
+
+	app.bloomSets = make([]vk.DescriptorSet, bloomDispatches)
+	for i := range app.bloomSets {
+		set, err := app.descriptorAllocator.Allocate(app.bloomSetLayout)
+		if err != nil {
+			return errors.Wrapf(err, "can't allocate bloom pass %d descriptor set", i)
+		}
+		app.bloomSets[i] = set
+	}
+	set, err := app.descriptorAllocator.Allocate(app.compositeSetLayout)
+	if err != nil {
+		return errors.Wrap(err, "can't allocate composite descriptor set")
+	}
+	app.compositeSet = set
+	app.postChain.Bind()
+	return nil
+}
+
+// sampledWrite points binding of set at img through the bloom sampler.
+func (app *HelloTriangleApplication) sampledWrite(set vk.DescriptorSet, binding uint32, img *gpu.Image) vk.WriteDescriptorSet {
+	return vk.WriteDescriptorSet{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          set,
+		DstBinding:      binding,
+		DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+		DescriptorCount: 1,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+			ImageView:   img.View,
+			Sampler:     app.bloomSampler,
+		}},
+	}
+}
+
+// updateBloomSets points the bloom sets at the chain's scene image and
+// bloom levels, once they're allocated.
+func (app *HelloTriangleApplication) updateBloomSets(images postprocess.Images) {
+	if app.bloomSets == nil {
+		return
+	}
+
+	var writes []vk.WriteDescriptorSet
+	for i, pass := range bloomPasses(images) {
+		set := app.bloomSets[i]
+		writes = append(writes, app.sampledWrite(set, 0, pass.src), vk.WriteDescriptorSet{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      1,
+			DescriptorType:  vk.DescriptorTypeStorageImage,
+			DescriptorCount: 1,
+			PImageInfo: []vk.DescriptorImageInfo{{
+				ImageLayout: vk.ImageLayoutGeneral,
+				ImageView:   pass.dst.View,
+			}},
+		})
+	}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+}
+
+// updateCompositeSet points the composite set at the chain's scene image
+// and first bloom level, once it's allocated.
+func (app *HelloTriangleApplication) updateCompositeSet(images postprocess.Images) {
+	if app.compositeSet == vk.NullDescriptorSet {
+		return
+	}
+
+	writes := []vk.WriteDescriptorSet{
+		app.sampledWrite(app.compositeSet, 0, images[sceneImage]),
+		app.sampledWrite(app.compositeSet, 1, images[bloomLevel(0)]),
+	}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+}
+
+// createCompositeRenderPass builds the pass tonemapping the HDR scene into
+// the target. Every pixel is written so the target isn't cleared.
+func (app *HelloTriangleApplication) createCompositeRenderPass() error {
+	if !app.bloomEnabled() {
+		return nil
+	}
+
+	b := renderpass.NewBuilder()
+	desc := renderpass.ColorAttachment(app.target.Format, vk.SampleCount1Bit, app.target.FinalLayout)
+	desc.LoadOp = vk.AttachmentLoadOpDontCare
+	color := b.Attachment(desc)
+	b.Subpass(renderpass.Subpass{
+		Colors: []uint32{color},
+	})
+	b.Dependency(renderpass.ExternalColorDependency())
+
+	renderPass, err := b.Build(app.device)
+	if err != nil {
+		return errors.Wrap(err, "can't build composite render pass")
+	}
+	app.compositeRenderPass = renderPass
+	return nil
+}
+
+// createCompositeFramebuffers creates a framebuffer per target image for
+// the composite pass.
+func (app *HelloTriangleApplication) createCompositeFramebuffers() error {
+	if !app.bloomEnabled() {
+		return nil
+	}
+
+	extent := app.target.Extent
+	app.compositeFramebuffers = make([]vk.Framebuffer, 0, len(app.imageViews))
+	for i, iv := range app.imageViews {
+		createInfo := &vk.FramebufferCreateInfo{
+			SType:           vk.StructureTypeFramebufferCreateInfo,
+			RenderPass:      app.compositeRenderPass,
+			AttachmentCount: 1,
+			PAttachments:    []vk.ImageView{iv},
+			Width:           extent.Width,
+			Height:          extent.Height,
+			Layers:          1,
+		}
+
+		var fb vk.Framebuffer
+		if err := vk.Error(vk.CreateFramebuffer(app.device, createInfo, nil, &fb)); err != nil {
+			return errors.Wrapf(err, "can't create composite framebuffer %d", i)
+		}
+		app.track("framebuffer", fb)
+		app.compositeFramebuffers = append(app.compositeFramebuffers, fb)
+	}
+	return nil
+}
+
+// createCompositePipeline creates the fullscreen pipeline of the composite
+// pass.
+func (app *HelloTriangleApplication) createCompositePipeline() error {
+	if !app.bloomEnabled() {
+		return nil
+	}
+
+	vertShaderModule, err := app.createShaderModule(app.shaderCode("lighting.vert", shaders.LightingVert()))
+	if err != nil {
+		return errors.Wrap(err, "can't create composite vertex shader")
+	}
+	defer vk.DestroyShaderModule(app.device, vertShaderModule, nil)
+
+	fragShaderModule, err := app.createShaderModule(app.shaderCode("composite.frag", shaders.CompositeFrag()))
+	if err != nil {
+		return errors.Wrap(err, "can't create composite fragment shader")
+	}
+	defer vk.DestroyShaderModule(app.device, fragShaderModule, nil)
+
+	extent := app.target.Extent
+	pipelineInfos := []vk.GraphicsPipelineCreateInfo{{
+		SType:      vk.StructureTypeGraphicsPipelineCreateInfo,
+		StageCount: 2,
+		PStages: []vk.PipelineShaderStageCreateInfo{
+			{
+				SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+				Stage:  vk.ShaderStageVertexBit,
+				Module: vertShaderModule,
+				PName:  "main\x00",
+			},
+			{
+				SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+				Stage:  vk.ShaderStageFragmentBit,
+				Module: fragShaderModule,
+				PName:  "main\x00",
+			},
+		},
+		PVertexInputState: &vk.PipelineVertexInputStateCreateInfo{
+			SType: vk.StructureTypePipelineVertexInputStateCreateInfo,
+		},
+		PInputAssemblyState: &vk.PipelineInputAssemblyStateCreateInfo{
+			SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+			Topology: vk.PrimitiveTopologyTriangleList,
+		},
+		PViewportState: &vk.PipelineViewportStateCreateInfo{
+			SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+			ViewportCount: 1,
+			PViewports: []vk.Viewport{{
+				Width:    float32(extent.Width),
+				Height:   float32(extent.Height),
+				MinDepth: 0,
+				MaxDepth: 1,
+			}},
+			ScissorCount: 1,
+			PScissors:    []vk.Rect2D{{Extent: extent}},
+		},
+		PRasterizationState: &vk.PipelineRasterizationStateCreateInfo{
+			SType:       vk.StructureTypePipelineRasterizationStateCreateInfo,
+			PolygonMode: vk.PolygonModeFill,
+			LineWidth:   1,
+			CullMode:    vk.CullModeFlags(vk.CullModeNone),
+			FrontFace:   vk.FrontFaceCounterClockwise,
+		},
+		PMultisampleState: &vk.PipelineMultisampleStateCreateInfo{
+			SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+			RasterizationSamples: vk.SampleCount1Bit,
+			MinSampleShading:     1,
+		},
+		PColorBlendState: &vk.PipelineColorBlendStateCreateInfo{
+			SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+			AttachmentCount: 1,
+			PAttachments: []vk.PipelineColorBlendAttachmentState{{
+				ColorWriteMask: vk.ColorComponentFlags(
+					vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit,
+				),
+			}},
+		},
+		Layout:            app.compositePipelineLayout,
+		RenderPass:        app.compositeRenderPass,
+		Subpass:           0,
+		BasePipelineIndex: -1,
+	}}
+
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, 1, pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create composite pipeline")
+	}
+	app.track("pipeline", pipelines[0])
+	app.compositePipeline = pipelines[0]
+	app.name(app.compositePipeline, "composite pipeline")
+	return nil
+}
+
+func (app *HelloTriangleApplication) destroyCompositePipeline() {
+	if app.compositePipeline != vk.NullPipeline {
+		app.destroyPipeline(app.compositePipeline)
+		app.compositePipeline = vk.NullPipeline
+	}
+}
+
+// beginScene readies the HDR scene image for the render pass, the previous
+// frame's post-process chain may still be reading it.
+func (app *HelloTriangleApplication) beginScene(cb vk.CommandBuffer) {
+	if app.sceneColor != nil {
+		app.sceneColor.CmdTransitionTo(cb, vk.ImageLayoutColorAttachmentOptimal)
+	}
+}
+
+// recordPostProcess records the post-process chain over the scene the
+// render pass drew.
+func (app *HelloTriangleApplication) recordPostProcess(cb vk.CommandBuffer, imageIndex uint32) {
+	if app.postChain != nil {
+		app.postChain.Record(cb, imageIndex)
+	}
+}
+
+// recordBloom runs the bloom chain over the scene. The chain leaves every
+// level in GENERAL layout, each is moved to SHADER_READ_ONLY_OPTIMAL to be
+// read by the next dispatch, the transitions doubling as the barriers
+// between them.
+func (app *HelloTriangleApplication) recordBloom(cb vk.CommandBuffer, images postprocess.Images) {
+	scope := app.profiler.Begin(cb, "bloom")
+	defer scope.End(cb)
+
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointCompute, app.bloomPipeline)
+	constants := BloomConstants{
+		Threshold: app.bloom.Threshold,
+		Knee:      app.bloom.Threshold / 2,
+	}
+	for i, pass := range bloomPasses(images) {
+		pass.src.CmdTransitionTo(cb, vk.ImageLayoutShaderReadOnlyOptimal)
+		pass.dst.CmdTransitionTo(cb, vk.ImageLayoutGeneral)
+		vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointCompute, app.bloomPipelineLayout, 0,
+			1, []vk.DescriptorSet{app.bloomSets[i]}, 0, nil)
+		constants.Mode = pass.mode
+		bloomConstants.Push(cb, app.bloomPipelineLayout, constants)
+		vk.CmdDispatch(cb,
+			(pass.dst.Width+bloomGroupSize-1)/bloomGroupSize,
+			(pass.dst.Height+bloomGroupSize-1)/bloomGroupSize,
+			1)
+	}
+}
+
+// recordComposite adds the bloom to the scene and tonemaps it into the
+// target image.
+func (app *HelloTriangleApplication) recordComposite(cb vk.CommandBuffer, imageIndex uint32) {
+	scope := app.profiler.Begin(cb, "composite")
+	defer scope.End(cb)
+
+	vk.CmdBeginRenderPass(cb, &vk.RenderPassBeginInfo{
+		SType:       vk.StructureTypeRenderPassBeginInfo,
+		RenderPass:  app.compositeRenderPass,
+		Framebuffer: app.compositeFramebuffers[imageIndex],
+		RenderArea:  vk.Rect2D{Extent: app.target.Extent},
+	}, vk.SubpassContentsInline)
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.compositePipeline)
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, app.compositePipelineLayout, 0,
+		1, []vk.DescriptorSet{app.compositeSet}, 0, nil)
+	compositeConstants.Push(cb, app.compositePipelineLayout, CompositeConstants{
+		Intensity: app.bloom.Intensity,
+	})
+	vk.CmdDraw(cb, compositeVertices, 1, 0, 0)
+	app.countDraws(1)
+	vk.CmdEndRenderPass(cb)
+}
+
+func (app *HelloTriangleApplication) destroyBloom() {
+	if app.bloomPipeline != vk.NullPipeline {
+		app.release(app.bloomPipeline)
+		vk.DestroyPipeline(app.device, app.bloomPipeline, nil)
+	}
+	for _, l := range []vk.PipelineLayout{app.bloomPipelineLayout, app.compositePipelineLayout} {
+		if l != vk.NullPipelineLayout {
+			vk.DestroyPipelineLayout(app.device, l, nil)
+		}
+	}
+	for _, l := range []vk.DescriptorSetLayout{app.bloomSetLayout, app.compositeSetLayout} {
+		if l != vk.NullDescriptorSetLayout {
+			vk.DestroyDescriptorSetLayout(app.device, l, nil)
+		}
+	}
+	if app.bloomSampler != vk.NullSampler {
+		app.release(app.bloomSampler)
+		vk.DestroySampler(app.device, app.bloomSampler, nil)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"time"
+
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+)
+
+const (
+	// defaultMemoryBudgetWarning is the fraction of a heap's budget that
+	// once in use gets warned about.
+	defaultMemoryBudgetWarning = 0.9
+	// memoryBudgetInterval is how often the budget is checked while running.
+	memoryBudgetInterval = time.Second
+)
+
+// memoryBudget reports every heap's usage and budget, false when the device
+// doesn't have VK_EXT_memory_budget.
+func (app *HelloTriangleApplication) memoryBudget() ([]memory.HeapBudget, bool) {
+	if !app.hasDeviceExtension(memory.BudgetExtension) {
+		return nil, false
+	}
+	return memory.Budget(app.physicalDevice), true
+}
+
+func (app *HelloTriangleApplication) memoryBudgetWarning() float64 {
+	if app.MemoryBudgetWarning <= 0 {
+		return defaultMemoryBudgetWarning
+	}
+	return app.MemoryBudgetWarning
+}
+
+// logMemoryBudget logs every heap's usage and budget.
+func (app *HelloTriangleApplication) logMemoryBudget() {
+	heaps, ok := app.memoryBudget()
+	if !ok {
+		return
+	}
+	for _, h := range heaps {
+		app.logger.Info("Memory heap",
+			logging.F("heap", h.Heap),
+			logging.F("deviceLocal", h.DeviceLocal),
+			logging.F("usedMiB", h.Usage>>20),
+			logging.F("budgetMiB", h.Budget>>20),
+			logging.F("sizeMiB", h.Size>>20),
+		)
+	}
+}
+
+// checkMemoryBudget warns about and calls OnMemoryBudget for heaps whose
+// usage has gone over MemoryBudgetWarning of their budget, once each time
+// they cross it. It only queries the budget every memoryBudgetInterval.
+func (app *HelloTriangleApplication) checkMemoryBudget(now time.Time) {
+	if now.Sub(app.lastBudgetCheck) < memoryBudgetInterval {
+		return
+	}
+	app.lastBudgetCheck = now
+
+	heaps, ok := app.memoryBudget()
+	if !ok {
+		return
+	}
+	if app.overBudget == nil {
+		app.overBudget = map[int]bool{}
+	}
+
+	warning := app.memoryBudgetWarning()
+	for _, h := range heaps {
+		over := h.Fraction() > warning
+		if over && !app.overBudget[h.Heap] {
+			app.logger.Warn("Memory heap nearly over budget",
+				logging.F("heap", h.Heap),
+				logging.F("usedMiB", h.Usage>>20),
+				logging.F("budgetMiB", h.Budget>>20),
+			)
+			if app.OnMemoryBudget != nil {
+				app.OnMemoryBudget(h)
+			}
+		}
+		app.overBudget[h.Heap] = over
+	}
+}
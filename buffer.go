@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+)
+
+// uploadStagingBuffers is how many staging buffers the uploader rotates
+// through, two lets one be filled while the other's copies run.
+const uploadStagingBuffers = 2
+
+// gpuContext is what the gpu package needs to create and fill buffers,
+// copies go through the graphics queue and the uploader once it exists.
+func (app *HelloTriangleApplication) gpuContext() gpu.Context {
+	return gpu.Context{
+		Device:    app.device,
+		Allocator: app.allocator,
+		Commands:  app.commandPool,
+		Queue:     app.graphicsQueue,
+		Uploader:  app.uploader,
+		Leaks:     app.leaks,
+	}
+}
+
+// createUploader creates the uploader, copying on the dedicated transfer
+// queue when there is one so big uploads don't hold up rendering.
+func (app *HelloTriangleApplication) createUploader() error {
+	var transfer *gpu.TransferQueue
+	if app.queueFamilies.DedicatedTransfer() {
+		pool, err := commands.NewPool(app.device, uint32(app.queueFamilies.Transfer))
+		if err != nil {
+			return errors.Wrap(err, "can't create transfer command pool")
+		}
+		app.transferCommandPool = pool
+		transfer = &gpu.TransferQueue{Queue: app.transferQueue, Commands: pool}
+		app.logger.Info("Uploading on the dedicated transfer queue", logging.F("family", app.queueFamilies.Transfer))
+	}
+
+	uploader, err := gpu.NewUploader(app.gpuContext(), transfer, uploadStagingBuffers, 0)
+	if err != nil {
+		return err
+	}
+	app.uploader = uploader
+	return nil
+}
+
+// finishUploads submits everything recorded into the uploader and waits
+// for it, so the texture and meshes are filled before the first frame.
+func (app *HelloTriangleApplication) finishUploads() error {
+	submitted, err := app.uploader.Flush()
+	if err != nil {
+		return errors.Wrap(err, "can't submit uploads")
+	}
+	return errors.Wrap(app.uploader.Wait(submitted), "can't wait for uploads")
+}
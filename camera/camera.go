@@ -0,0 +1,98 @@
+// Package camera positions the viewer. Camera produces the view and
+// projection matrices and the controllers move it from GLFW input.
+package camera
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// maxPitch stops the camera looking straight up or down, where yaw is
+// undefined and LookAt's up vector is parallel to the view direction.
+const maxPitch = 89 * math.Pi / 180
+
+// Up is the world's up direction.
+var Up = vmath.Vec3{0, 0, 1}
+
+// Camera is a perspective camera in a Z up world. Yaw turns it around Z
+// from the +X axis and Pitch tilts it up towards +Z, both in radians.
+type Camera struct {
+	Position vmath.Vec3
+	Yaw      float32
+	Pitch    float32
+	// FovY is the vertical field of view in radians, Near and Far the
+	// depth range.
+	FovY float32
+	Near float32
+	Far  float32
+}
+
+// New creates a camera at eye looking at target with a 45 degree field of
+// view.
+func New(eye, target vmath.Vec3) *Camera {
+	c := &Camera{
+		Position: eye,
+		FovY:     vmath.Radians(45),
+		Near:     0.1,
+		Far:      100,
+	}
+	c.LookAt(target)
+	return c
+}
+
+// LookAt turns the camera towards target.
+func (c *Camera) LookAt(target vmath.Vec3) {
+	dir := target.Sub(c.Position).Normalize()
+	c.Yaw = float32(math.Atan2(float64(dir[1]), float64(dir[0])))
+	c.Pitch = float32(math.Asin(float64(dir[2])))
+	c.clampPitch()
+}
+
+// Forward is the unit vector the camera looks along.
+func (c *Camera) Forward() vmath.Vec3 {
+	sinYaw, cosYaw := math.Sincos(float64(c.Yaw))
+	sinPitch, cosPitch := math.Sincos(float64(c.Pitch))
+	return vmath.Vec3{
+		float32(cosPitch * cosYaw),
+		float32(cosPitch * sinYaw),
+		float32(sinPitch),
+	}
+}
+
+// Right is the unit vector to the camera's right, it's always horizontal.
+func (c *Camera) Right() vmath.Vec3 {
+	return c.Forward().Cross(Up).Normalize()
+}
+
+// View is the world to view space matrix.
+func (c *Camera) View() vmath.Mat4 {
+	return vmath.LookAt(c.Position, c.Position.Add(c.Forward()), Up)
+}
+
+// Projection is the view to clip space matrix for a viewport with the given
+// width to height ratio.
+func (c *Camera) Projection(aspect float32) vmath.Mat4 {
+	return vmath.Perspective(c.FovY, aspect, c.Near, c.Far)
+}
+
+func (c *Camera) clampPitch() {
+	if c.Pitch > maxPitch {
+		c.Pitch = maxPitch
+	}
+	if c.Pitch < -maxPitch {
+		c.Pitch = -maxPitch
+	}
+}
+
+// Controller moves a camera from input, Update is called once a frame with
+// the seconds since the last one.
+type Controller interface {
+	Update(c *Camera, dt float32)
+}
+
+// Scroller is implemented by controllers that use the scroll wheel, GLFW
+// only reports it through a callback so it has to be forwarded.
+type Scroller interface {
+	Scroll(xoff, yoff float64)
+}
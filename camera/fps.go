@@ -0,0 +1,90 @@
+package camera
+
+import (
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+// FPS flies the camera with WASD, Q and E to go down and up, and looks
+// around with the mouse while the right button is held. The cursor is
+// captured while looking so it can't leave the window.
+type FPS struct {
+	Window *glfw.Window
+	// Speed is in units a second, holding shift doubles it.
+	Speed float32
+	// Sensitivity is radians turned per screen coordinate of mouse movement.
+	Sensitivity float32
+
+	looking      bool
+	lastX, lastY float64
+}
+
+// NewFPS creates an FPS controller for the window.
+func NewFPS(w *glfw.Window) *FPS {
+	return &FPS{
+		Window:      w,
+		Speed:       2,
+		Sensitivity: 0.003,
+	}
+}
+
+func (f *FPS) Update(c *Camera, dt float32) {
+	f.look(c)
+
+	var move [3]float32
+	keys := []struct {
+		key  glfw.Key
+		axis int
+		sign float32
+	}{
+		{glfw.KeyW, 0, 1},
+		{glfw.KeyS, 0, -1},
+		{glfw.KeyD, 1, 1},
+		{glfw.KeyA, 1, -1},
+		{glfw.KeyE, 2, 1},
+		{glfw.KeyQ, 2, -1},
+	}
+	for _, k := range keys {
+		if f.Window.GetKey(k.key) == glfw.Press {
+			move[k.axis] += k.sign
+		}
+	}
+	if move == [3]float32{} {
+		return
+	}
+
+	speed := f.Speed * dt
+	if f.Window.GetKey(glfw.KeyLeftShift) == glfw.Press {
+		speed *= 2
+	}
+	delta := c.Forward().Mul(move[0]).
+		Add(c.Right().Mul(move[1])).
+		Add(Up.Mul(move[2]))
+	c.Position = c.Position.Add(delta.Normalize().Mul(speed))
+}
+
+func (f *FPS) look(c *Camera) {
+	held := f.Window.GetMouseButton(glfw.MouseButtonRight) == glfw.Press
+	if held != f.looking {
+		f.looking = held
+		mode := glfw.CursorNormal
+		if held {
+			mode = glfw.CursorDisabled
+		}
+		f.Window.SetInputMode(glfw.CursorMode, mode)
+		if held && glfw.RawMouseMotionSupported() {
+			f.Window.SetInputMode(glfw.RawMouseMotion, glfw.True)
+		}
+		// The cursor can jump when it's captured, start measuring from there
+		f.lastX, f.lastY = f.Window.GetCursorPos()
+		return
+	}
+	if !held {
+		return
+	}
+
+	x, y := f.Window.GetCursorPos()
+	c.Yaw -= float32(x-f.lastX) * f.Sensitivity
+	c.Pitch -= float32(y-f.lastY) * f.Sensitivity
+	c.clampPitch()
+	f.lastX, f.lastY = x, y
+}
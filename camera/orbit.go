@@ -0,0 +1,71 @@
+package camera
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+// Orbit circles the camera around Target. Dragging with the left button
+// rotates and scrolling zooms in and out.
+type Orbit struct {
+	Window *glfw.Window
+	Target vmath.Vec3
+	// Distance from Target, kept between MinDistance and MaxDistance.
+	Distance    float32
+	MinDistance float32
+	MaxDistance float32
+	// Sensitivity is radians turned per screen coordinate dragged.
+	Sensitivity float32
+	// Zoom is the fraction of the distance each scroll step moves.
+	Zoom float32
+
+	dragging     bool
+	lastX, lastY float64
+	scroll       float64
+}
+
+// NewOrbit creates an orbit controller for the window around target,
+// starting from wherever c is.
+func NewOrbit(w *glfw.Window, c *Camera, target vmath.Vec3) *Orbit {
+	c.LookAt(target)
+	return &Orbit{
+		Window:      w,
+		Target:      target,
+		Distance:    c.Position.Sub(target).Len(),
+		MinDistance: 0.5,
+		MaxDistance: 50,
+		Sensitivity: 0.005,
+		Zoom:        0.1,
+	}
+}
+
+// Scroll accumulates scroll wheel movement until the next Update.
+func (o *Orbit) Scroll(xoff, yoff float64) {
+	o.scroll += yoff
+}
+
+func (o *Orbit) Update(c *Camera, dt float32) {
+	held := o.Window.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press
+	x, y := o.Window.GetCursorPos()
+	if held && o.dragging {
+		c.Yaw -= float32(x-o.lastX) * o.Sensitivity
+		c.Pitch += float32(y-o.lastY) * o.Sensitivity
+		c.clampPitch()
+	}
+	o.dragging = held
+	o.lastX, o.lastY = x, y
+
+	// Scrolling up zooms in
+	o.Distance *= float32(math.Pow(float64(1-o.Zoom), o.scroll))
+	o.scroll = 0
+	if o.Distance < o.MinDistance {
+		o.Distance = o.MinDistance
+	}
+	if o.Distance > o.MaxDistance {
+		o.Distance = o.MaxDistance
+	}
+
+	c.Position = o.Target.Sub(c.Forward().Mul(o.Distance))
+}
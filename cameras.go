@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/camera"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+// Camera controllers for the Camera option.
+const (
+	CameraOrbit = "orbit"
+	CameraFPS   = "fps"
+)
+
+var (
+	cameraEye    = vmath.Vec3{2, 2, 2}
+	cameraTarget = vmath.Vec3{0, 0, 0}
+)
+
+// createCamera gives the current window a camera looking at the scene and,
+// unless headless, the controller the Camera option asks for.
+func (app *HelloTriangleApplication) createCamera() error {
+	app.camera = camera.New(cameraEye, cameraTarget)
+	if app.window == nil {
+		return nil
+	}
+
+	switch app.Camera {
+	case "", CameraOrbit:
+		app.cameraController = camera.NewOrbit(app.window, app.camera, cameraTarget)
+	case CameraFPS:
+		app.cameraController = camera.NewFPS(app.window)
+	default:
+		return errors.Errorf("unknown camera '%s', expected %s or %s", app.Camera, CameraOrbit, CameraFPS)
+	}
+
+	// The UI, created after the camera, gets first say over scrolling
+	win := app.appWindow
+	s, _ := app.cameraController.(camera.Scroller)
+	app.window.SetScrollCallback(func(w *glfw.Window, xoff, yoff float64) {
+		if win.uiRenderer != nil {
+			app.uiPlatform.Scroll(xoff, yoff)
+		}
+		if s != nil && !app.uiWantsMouse(win) {
+			s.Scroll(xoff, yoff)
+		}
+	})
+	return nil
+}
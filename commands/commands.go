@@ -0,0 +1,132 @@
+// Package commands wraps command pools and the recording of command buffers.
+package commands
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Pool is a command pool for a single queue family whose buffers can be
+// individually reset and re-recorded every frame.
+type Pool struct {
+	device vk.Device
+
+	Handle           vk.CommandPool
+	QueueFamilyIndex uint32
+}
+
+// NewPool creates a command pool on the given queue family.
+func NewPool(device vk.Device, queueFamilyIndex uint32) (*Pool, error) {
+	createInfo := &vk.CommandPoolCreateInfo{
+		SType:            vk.StructureTypeCommandPoolCreateInfo,
+		Flags:            vk.CommandPoolCreateFlags(vk.CommandPoolCreateResetCommandBufferBit),
+		QueueFamilyIndex: queueFamilyIndex,
+	}
+
+	var handle vk.CommandPool
+	if err := vk.Error(vk.CreateCommandPool(device, createInfo, nil, &handle)); err != nil {
+		return nil, errors.Wrap(err, "can't create command pool")
+	}
+
+	return &Pool{
+		device:           device,
+		Handle:           handle,
+		QueueFamilyIndex: queueFamilyIndex,
+	}, nil
+}
+
+// Allocate allocates count primary command buffers from the pool.
+func (p *Pool) Allocate(count int) ([]vk.CommandBuffer, error) {
+	return p.allocate(count, vk.CommandBufferLevelPrimary)
+}
+
+// AllocateSecondary allocates count secondary command buffers from the
+// pool, for recording parts of a render pass to execute from a primary one.
+func (p *Pool) AllocateSecondary(count int) ([]vk.CommandBuffer, error) {
+	return p.allocate(count, vk.CommandBufferLevelSecondary)
+}
+
+func (p *Pool) allocate(count int, level vk.CommandBufferLevel) ([]vk.CommandBuffer, error) {
+	buffers := make([]vk.CommandBuffer, count)
+	allocInfo := &vk.CommandBufferAllocateInfo{
+		SType:              vk.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        p.Handle,
+		Level:              level,
+		CommandBufferCount: uint32(count),
+	}
+	if err := vk.Error(vk.AllocateCommandBuffers(p.device, allocInfo, buffers)); err != nil {
+		return nil, errors.Wrapf(err, "can't allocate %d command buffers", count)
+	}
+	return buffers, nil
+}
+
+// Free returns command buffers to the pool.
+func (p *Pool) Free(buffers []vk.CommandBuffer) {
+	if len(buffers) == 0 {
+		return
+	}
+	vk.FreeCommandBuffers(p.device, p.Handle, uint32(len(buffers)), buffers)
+}
+
+// Destroy destroys the pool along with every buffer allocated from it.
+func (p *Pool) Destroy() {
+	if p.Handle != vk.NullCommandPool {
+		vk.DestroyCommandPool(p.device, p.Handle, nil)
+		p.Handle = vk.NullCommandPool
+	}
+}
+
+// Record resets cb and records whatever fn issues into it, the buffer must
+// come from a pool created by NewPool and not be pending execution.
+func Record(cb vk.CommandBuffer, fn func(cb vk.CommandBuffer)) error {
+	return record(cb, 0, fn)
+}
+
+func record(cb vk.CommandBuffer, flags vk.CommandBufferUsageFlags, fn func(cb vk.CommandBuffer)) error {
+	if err := vk.Error(vk.ResetCommandBuffer(cb, 0)); err != nil {
+		return errors.Wrap(err, "can't reset command buffer")
+	}
+
+	beginInfo := &vk.CommandBufferBeginInfo{
+		SType: vk.StructureTypeCommandBufferBeginInfo,
+		Flags: flags,
+	}
+	if err := vk.Error(vk.BeginCommandBuffer(cb, beginInfo)); err != nil {
+		return errors.Wrap(err, "can't begin recording command buffer")
+	}
+
+	fn(cb)
+
+	if err := vk.Error(vk.EndCommandBuffer(cb)); err != nil {
+		return errors.Wrap(err, "can't end recording command buffer")
+	}
+	return nil
+}
+
+// OneTimeSubmit records fn into a temporary command buffer, submits it to
+// queue and waits for it to finish, meant for uploads and layout transitions.
+func (p *Pool) OneTimeSubmit(queue vk.Queue, fn func(cb vk.CommandBuffer)) error {
+	buffers, err := p.Allocate(1)
+	if err != nil {
+		return errors.Wrap(err, "can't allocate one time command buffer")
+	}
+	defer p.Free(buffers)
+
+	cb := buffers[0]
+	if err := record(cb, vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit), fn); err != nil {
+		return errors.Wrap(err, "can't record one time command buffer")
+	}
+
+	submitInfo := []vk.SubmitInfo{{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    buffers,
+	}}
+	if err := vk.Error(vk.QueueSubmit(queue, 1, submitInfo, vk.NullFence)); err != nil {
+		return errors.Wrap(err, "can't submit one time command buffer")
+	}
+	if err := vk.Error(vk.QueueWaitIdle(queue)); err != nil {
+		return errors.Wrap(err, "can't wait for one time command buffer")
+	}
+	return nil
+}
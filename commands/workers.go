@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Workers records secondary command buffers on several goroutines at once.
+// Command pools can't be used from two goroutines at the same time, so each
+// worker has a pool of its own with a secondary buffer per frame in flight.
+type Workers struct {
+	pools []*Pool
+	// buffers holds each worker's secondary buffer for each frame.
+	buffers [][]vk.CommandBuffer
+}
+
+// NewWorkers creates count workers recording for queueFamilyIndex with
+// frames frames in flight.
+func NewWorkers(device vk.Device, queueFamilyIndex uint32, count, frames int) (*Workers, error) {
+	if count < 1 {
+		return nil, errors.Errorf("recording needs at least 1 worker, not %d", count)
+	}
+
+	w := &Workers{}
+	for i := 0; i < count; i++ {
+		pool, err := NewPool(device, queueFamilyIndex)
+		if err != nil {
+			w.Destroy()
+			return nil, errors.Wrapf(err, "can't create command pool for worker %d", i)
+		}
+		w.pools = append(w.pools, pool)
+
+		buffers, err := pool.AllocateSecondary(frames)
+		if err != nil {
+			w.Destroy()
+			return nil, errors.Wrapf(err, "can't allocate secondary command buffers for worker %d", i)
+		}
+		w.buffers = append(w.buffers, buffers)
+	}
+	return w, nil
+}
+
+// Count is the number of workers.
+func (w *Workers) Count() int {
+	return len(w.pools)
+}
+
+// Record calls fn on every worker at once, each recording into its own
+// secondary buffer for frame that continues subpass of renderPass in
+// framebuffer. It returns the buffers for the primary buffer to execute, in
+// worker order, once every worker's done. frame's previous recordings must
+// have finished executing.
+func (w *Workers) Record(frame int, renderPass vk.RenderPass, subpass uint32, framebuffer vk.Framebuffer, fn func(worker int, cb vk.CommandBuffer)) ([]vk.CommandBuffer, error) {
+	return w.RecordInheriting(frame, vk.CommandBufferInheritanceInfo{
+		SType:       vk.StructureTypeCommandBufferInheritanceInfo,
+		RenderPass:  renderPass,
+		Subpass:     subpass,
+		Framebuffer: framebuffer,
+	}, fn)
+}
+
+// RecordInheriting is Record for buffers that continue whatever inheritance
+// describes, such as dynamic rendering chained on its PNext in place of a
+// render pass. Anything chained has to be kept alive until it returns.
+func (w *Workers) RecordInheriting(frame int, inheritance vk.CommandBufferInheritanceInfo, fn func(worker int, cb vk.CommandBuffer)) ([]vk.CommandBuffer, error) {
+	buffers := make([]vk.CommandBuffer, len(w.pools))
+	errs := make([]error, len(w.pools))
+
+	var wg sync.WaitGroup
+	for i := range w.pools {
+		i := i
+		buffers[i] = w.buffers[i][frame]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = recordSecondary(buffers[i], inheritance, func(cb vk.CommandBuffer) {
+				fn(i, cb)
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, errors.Wrapf(err, "worker %d can't record", i)
+		}
+	}
+	return buffers, nil
+}
+
+// Destroy destroys every worker's pool and the buffers allocated from them.
+func (w *Workers) Destroy() {
+	for _, pool := range w.pools {
+		pool.Destroy()
+	}
+	w.pools = nil
+	w.buffers = nil
+}
+
+func recordSecondary(cb vk.CommandBuffer, inheritance vk.CommandBufferInheritanceInfo, fn func(cb vk.CommandBuffer)) error {
+	if err := vk.Error(vk.ResetCommandBuffer(cb, 0)); err != nil {
+		return errors.Wrap(err, "can't reset secondary command buffer")
+	}
+
+	beginInfo := &vk.CommandBufferBeginInfo{
+		SType:            vk.StructureTypeCommandBufferBeginInfo,
+		Flags:            vk.CommandBufferUsageFlags(vk.CommandBufferUsageRenderPassContinueBit | vk.CommandBufferUsageOneTimeSubmitBit),
+		PInheritanceInfo: []vk.CommandBufferInheritanceInfo{inheritance},
+	}
+	if err := vk.Error(vk.BeginCommandBuffer(cb, beginInfo)); err != nil {
+		return errors.Wrap(err, "can't begin recording secondary command buffer")
+	}
+
+	fn(cb)
+
+	if err := vk.Error(vk.EndCommandBuffer(cb)); err != nil {
+		return errors.Wrap(err, "can't end recording secondary command buffer")
+	}
+	return nil
+}
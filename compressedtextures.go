@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/dds"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/ktx"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/models"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// compressedTexture is whether img is a KTX2 or DDS file, whose mip chain
+// was made offline, which createCompressedTexture uploads as it is instead
+// of decoding it.
+func compressedTexture(img *models.Image) bool {
+	if img.Path != "" {
+		switch strings.ToLower(filepath.Ext(img.Path)) {
+		case ".ktx2", ".dds":
+			return true
+		}
+		return false
+	}
+	return ktx.IsKTX2(img.Data) || dds.IsDDS(img.Data)
+}
+
+// loadCompressedTexture uploads img's KTX2 or DDS file in the format it was
+// written in, sampled in format's color space like PNGs and JPEGs decoded
+// into it.
+func (app *HelloTriangleApplication) loadCompressedTexture(img *models.Image, format vk.Format, name string) (*gpu.Image, error) {
+	srgb := isSRGB(format)
+	data := img.Data
+	if img.Path != "" {
+		var err error
+		if data, err = os.ReadFile(img.Path); err != nil {
+			return nil, errors.Wrapf(err, "can't read %s", name)
+		}
+	}
+	if dds.IsDDS(data) {
+		t, err := dds.Decode(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't decode %s", name)
+		}
+		return app.createCompressedTexture(textureFormat(vk.Format(t.Format), srgb), t.Width, t.Height, t.Levels, name)
+	}
+	t, err := ktx.Decode(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't decode %s", name)
+	}
+	if t.Codec != ktx.None {
+		return nil, errors.Errorf("%s is Basis Universal %s, which isn't transcoded, encode it as BC7 or ASTC instead", name, t.Codec)
+	}
+	return app.createCompressedTexture(textureFormat(vk.Format(t.Format), srgb), t.Width, t.Height, t.Levels, name)
+}
+
+// createCompressedTexture uploads a mip chain made offline, levels, to a
+// sampled image of format. Block compressed formats need their family's
+// feature, which enabledDeviceFeatures turns on when the device has it, so
+// the device is asked whether it can sample format first.
+func (app *HelloTriangleApplication) createCompressedTexture(format vk.Format, width, height uint32, levels [][]byte, name string) (*gpu.Image, error) {
+	var formatProperties vk.FormatProperties
+	vk.GetPhysicalDeviceFormatProperties(app.physicalDevice, format, &formatProperties)
+	formatProperties.Deref()
+	if formatProperties.OptimalTilingFeatures&vk.FormatFeatureFlags(vk.FormatFeatureSampledImageBit) == 0 {
+		return nil, errors.Errorf("%s's format %d can't be sampled by this GPU", name, format)
+	}
+
+	img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:     width,
+		Height:    height,
+		MipLevels: uint32(len(levels)),
+		Format:    format,
+		Tiling:    vk.ImageTilingOptimal,
+		Usage:     vk.ImageUsageFlags(vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
+		Memory:    memory.GPUOnly,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't create %s image", name)
+	}
+	app.name(img.Handle, "%s", name)
+
+	if err := app.uploader.ImageLevels(img, levels); err != nil {
+		img.Destroy()
+		return nil, errors.Wrapf(err, "can't stage %s levels", name)
+	}
+	if err := app.uploader.Record(func(cb vk.CommandBuffer) {
+		img.CmdTransitionTo(cb, vk.ImageLayoutShaderReadOnlyOptimal)
+	}); err != nil {
+		img.Destroy()
+		return nil, errors.Wrapf(err, "can't record %s layout transition", name)
+	}
+	return img, nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"math"
+	"time"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpgpu"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// saxpyGroupSize is saxpy.comp's local size in x.
+	saxpyGroupSize = 256
+	// computeExampleCount is how many elements the compute example sums.
+	computeExampleCount = 1 << 20
+	// computeExampleA is the compute example's a in a * x + y.
+	computeExampleA = 2.5
+)
+
+// SaxpyConstants matches the push_constant block in saxpy.comp.
+type SaxpyConstants struct {
+	A     float32
+	Count uint32
+}
+
+var saxpyConstants = pipeline.NewPushConstants[SaxpyConstants](vk.ShaderStageFlags(vk.ShaderStageComputeBit), 0)
+
+// runComputeExample works out a * x + y over a million floats with
+// saxpy.comp on the compute queue, reads y back and checks every element
+// against the same sum done in Go. It's everything a compute dispatch
+// needs and nothing else: a set layout for the storage buffers, a compute
+// pipeline, a dispatch, a copy into host visible memory and a fence to
+// wait for it all.
+func (app *HelloTriangleApplication) runComputeExample() error {
+	n := computeExampleCount
+	x, y := make([]float32, n), make([]float32, n)
+	for i := range x {
+		x[i] = float32(i)
+		y[i] = float32(n - i)
+	}
+	size := vk.DeviceSize(n * int(unsafe.Sizeof(float32(0))))
+
+	// The inputs are written straight into host visible storage buffers, the
+	// result is copied out of y into a buffer the host can read
+	ctx := app.gpuContext()
+	xBuffer, err := gpu.NewBuffer(ctx, size, vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit), memory.CPUToGPU)
+	if err != nil {
+		return errors.Wrap(err, "can't create x buffer")
+	}
+	defer xBuffer.Destroy()
+	yBuffer, err := gpu.NewBuffer(ctx, size, vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit|vk.BufferUsageTransferSrcBit), memory.CPUToGPU)
+	if err != nil {
+		return errors.Wrap(err, "can't create y buffer")
+	}
+	defer yBuffer.Destroy()
+	readback, err := gpu.NewBuffer(ctx, size, vk.BufferUsageFlags(vk.BufferUsageTransferDstBit), memory.GPUToCPU)
+	if err != nil {
+		return errors.Wrap(err, "can't create readback buffer")
+	}
+	defer readback.Destroy()
+
+	if err := xBuffer.Upload(floatBytes(x)); err != nil {
+		return errors.Wrap(err, "can't write x")
+	}
+	if err := yBuffer.Upload(floatBytes(y)); err != nil {
+		return errors.Wrap(err, "can't write y")
+	}
+
+	// Binding 0 is x and binding 1 is y, both storage buffers
+	var bindings []pipeline.StageBinding
+	for binding := uint32(0); binding < 2; binding++ {
+		b := pipeline.StageBinding{Stages: vk.ShaderStageFlags(vk.ShaderStageComputeBit)}
+		b.Binding.Binding = binding
+		b.Type = vk.DescriptorTypeStorageBuffer
+		b.Count = 1
+		bindings = append(bindings, b)
+	}
+	setLayouts, err := pipeline.NewSetLayouts(app.device, bindings)
+	if err != nil {
+		return err
+	}
+	defer vk.DestroyDescriptorSetLayout(app.device, setLayouts[0], nil)
+
+	layout, err := pipeline.NewLayout(app.device, setLayouts, []vk.PushConstantRange{saxpyConstants.Range()})
+	if err != nil {
+		return err
+	}
+	defer vk.DestroyPipelineLayout(app.device, layout, nil)
+
+	compute, err := pipeline.NewCompute(app.device, layout, app.shaderCode("saxpy.comp", shaders.Saxpy()))
+	if err != nil {
+		return errors.Wrap(err, "can't create saxpy pipeline")
+	}
+	defer vk.DestroyPipeline(app.device, compute, nil)
+
+	allocator := descriptors.NewAllocator(app.device, descriptors.Ratios(bindings), 1)
+	defer allocator.Destroy()
+	set, err := allocator.Allocate(setLayouts[0])
+	if err != nil {
+		return errors.Wrap(err, "can't allocate saxpy descriptor set")
+	}
+	writes := make([]vk.WriteDescriptorSet, 0, 2)
+	for binding, b := range []*gpu.Buffer{xBuffer, yBuffer} {
+		writes = append(writes, vk.WriteDescriptorSet{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      uint32(binding),
+			DescriptorType:  vk.DescriptorTypeStorageBuffer,
+			DescriptorCount: 1,
+			PBufferInfo: []vk.DescriptorBufferInfo{{
+				Buffer: b.Handle,
+				Offset: 0,
+				Range:  b.Size,
+			}},
+		})
+	}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+
+	pool, err := commands.NewPool(app.device, uint32(app.queueFamilies.Compute))
+	if err != nil {
+		return errors.Wrap(err, "can't create compute command pool")
+	}
+	defer pool.Destroy()
+	cbs, err := pool.Allocate(1)
+	if err != nil {
+		return errors.Wrap(err, "can't allocate compute command buffer")
+	}
+	cb := cbs[0]
+
+	if err := commands.Record(cb, func(cb vk.CommandBuffer) {
+		vk.CmdBindPipeline(cb, vk.PipelineBindPointCompute, compute)
+		vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointCompute, layout, 0, 1, []vk.DescriptorSet{set}, 0, nil)
+		saxpyConstants.Push(cb, layout, SaxpyConstants{A: computeExampleA, Count: uint32(n)})
+		vk.CmdDispatch(cb, uint32((n+saxpyGroupSize-1)/saxpyGroupSize), 1, 1)
+
+		// The shader's writes to y have to land before the copy reads it
+		cmdBufferBarrier(cb, yBuffer.Handle,
+			vk.PipelineStageComputeShaderBit, vk.AccessShaderWriteBit,
+			vk.PipelineStageTransferBit, vk.AccessTransferReadBit)
+		vk.CmdCopyBuffer(cb, yBuffer.Handle, readback.Handle, 1, []vk.BufferCopy{{Size: size}})
+		// and the copy's before the host reads the readback buffer
+		cmdBufferBarrier(cb, readback.Handle,
+			vk.PipelineStageTransferBit, vk.AccessTransferWriteBit,
+			vk.PipelineStageHostBit, vk.AccessHostReadBit)
+	}); err != nil {
+		return errors.Wrap(err, "can't record compute command buffer")
+	}
+
+	var fence vk.Fence
+	fenceInfo := &vk.FenceCreateInfo{SType: vk.StructureTypeFenceCreateInfo}
+	if err := vk.Error(vk.CreateFence(app.device, fenceInfo, nil, &fence)); err != nil {
+		return errors.Wrap(err, "can't create compute fence")
+	}
+	defer vk.DestroyFence(app.device, fence, nil)
+
+	start := time.Now()
+	submitInfo := []vk.SubmitInfo{{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    []vk.CommandBuffer{cb},
+	}}
+	if err := vk.Error(vk.QueueSubmit(app.computeQueue, 1, submitInfo, fence)); err != nil {
+		return errors.Wrap(err, "can't submit compute command buffer")
+	}
+	if err := vk.Error(vk.WaitForFences(app.device, 1, []vk.Fence{fence}, vk.True, math.MaxUint64)); err != nil {
+		return errors.Wrap(err, "can't wait for compute fence")
+	}
+	elapsed := time.Since(start)
+
+	result := make([]float32, n)
+	if err := readback.Download(floatBytes(result)); err != nil {
+		return errors.Wrap(err, "can't read back y")
+	}
+	// Every value involved is exactly representable, so the GPU has to get
+	// the same answer to the bit
+	for i := range result {
+		if want := computeExampleA*x[i] + y[i]; result[i] != want {
+			return errors.Errorf("saxpy element %d is %g, want %g", i, result[i], want)
+		}
+	}
+
+	app.logger.Info("Compute example passed",
+		logging.F("elements", n),
+		logging.F("dedicatedQueue", app.queueFamilies.DedicatedCompute()),
+		logging.F("elapsed", elapsed),
+	)
+	return nil
+}
+
+// cmdBufferBarrier records a barrier making src's accesses to the whole of
+// buffer visible to dst's.
+func cmdBufferBarrier(cb vk.CommandBuffer, buffer vk.Buffer, srcStage vk.PipelineStageFlagBits, srcAccess vk.AccessFlagBits, dstStage vk.PipelineStageFlagBits, dstAccess vk.AccessFlagBits) {
+	vk.CmdPipelineBarrier(cb,
+		vk.PipelineStageFlags(srcStage),
+		vk.PipelineStageFlags(dstStage),
+		0,
+		0, nil,
+		1, []vk.BufferMemoryBarrier{{
+			SType:               vk.StructureTypeBufferMemoryBarrier,
+			SrcAccessMask:       vk.AccessFlags(srcAccess),
+			DstAccessMask:       vk.AccessFlags(dstAccess),
+			SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+			DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+			Buffer:              buffer,
+			Offset:              0,
+			Size:                vk.DeviceSize(vk.WholeSize),
+		}},
+		0, nil,
+	)
+}
+
+// floatBytes is the memory of values as bytes.
+func floatBytes(values []float32) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(&values[0])), len(values)*int(unsafe.Sizeof(values[0])))
+}
+
+const (
+	// reduceGroupSize is reduce.comp's local size in x.
+	reduceGroupSize = 256
+	// gpgpuExampleCount is how many uints the GPGPU example sums, few
+	// enough that the total fits in 32 bits.
+	gpgpuExampleCount = 1 << 16
+)
+
+// ReduceConstants matches the push_constant block in reduce.comp.
+type ReduceConstants struct {
+	Count uint32
+}
+
+// runGPGPUExample sums 0 up to 65535 with reduce.comp through the gpgpu
+// package, adding them up in Go as well while the GPU is busy and checking
+// the two agree.
+func (app *HelloTriangleApplication) runGPGPUExample() error {
+	d, err := gpgpu.NewDevice(app.device, app.allocator, app.computeQueue, uint32(app.queueFamilies.Compute))
+	if err != nil {
+		return err
+	}
+	defer d.Destroy()
+
+	kernel, err := d.NewKernel(app.shaderCode("reduce.comp", shaders.Reduce()))
+	if err != nil {
+		return errors.Wrap(err, "can't create reduce kernel")
+	}
+	defer kernel.Destroy()
+
+	n := gpgpuExampleCount
+	values, err := gpgpu.NewArray[uint32](d, n)
+	if err != nil {
+		return err
+	}
+	defer values.Destroy()
+	total, err := gpgpu.NewArray[uint32](d, 1)
+	if err != nil {
+		return err
+	}
+	defer total.Destroy()
+
+	input := make([]uint32, n)
+	for i := range input {
+		input[i] = uint32(i)
+	}
+	if err := values.Write(input); err != nil {
+		return err
+	}
+
+	if err := gpgpu.BindArray(kernel, 0, values); err != nil {
+		return err
+	}
+	if err := gpgpu.BindArray(kernel, 1, total); err != nil {
+		return err
+	}
+	if err := gpgpu.SetConstants(kernel, ReduceConstants{Count: uint32(n)}); err != nil {
+		return err
+	}
+	dispatch, err := kernel.Dispatch(gpgpu.Groups(n, reduceGroupSize), 1, 1)
+	if err != nil {
+		return err
+	}
+
+	job, err := d.Submit(dispatch)
+	if err != nil {
+		return err
+	}
+	var want uint32
+	for _, v := range input {
+		want += v
+	}
+	if err := job.Wait(); err != nil {
+		return err
+	}
+
+	got := make([]uint32, 1)
+	if err := total.Read(got); err != nil {
+		return errors.Wrap(err, "can't read back total")
+	}
+	if got[0] != want {
+		return errors.Errorf("reduce summed to %d, want %d", got[0], want)
+	}
+	app.logger.Info("GPGPU example passed", logging.F("elements", n), logging.F("sum", got[0]))
+	return nil
+}
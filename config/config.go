@@ -0,0 +1,47 @@
+// Package config reads settings files written in TOML or JSON into a
+// struct. TOML is read into the same shape JSON would be and decoded
+// through encoding/json, so the struct only needs json tags and both
+// formats name things the same way. Only the TOML the settings need is
+// understood, see Parse.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Load decodes the file at path into v, which has to be a pointer, going
+// by its extension: .toml or .json. Keys v doesn't have are an error, so
+// typos don't go unnoticed.
+func Load(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "can't read config '%s'", path)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".toml":
+		table, err := Parse(data)
+		if err != nil {
+			return errors.Wrapf(err, "can't parse '%s'", path)
+		}
+		if data, err = json.Marshal(table); err != nil {
+			return errors.Wrapf(err, "can't convert '%s'", path)
+		}
+	default:
+		return errors.Errorf("config '%s' isn't .toml or .json", path)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errors.Wrapf(err, "can't decode '%s'", path)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Parse reads TOML into nested tables. It understands comments, [table]
+// headers, dotted and quoted keys, and single line values: basic and
+// literal strings, integers, floats, booleans and arrays of them. Inline
+// tables, arrays of tables, multi-line strings and dates aren't.
+func Parse(data []byte) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	current := root
+	// defined are the tables given a header, which can't be repeated.
+	defined := map[string]bool{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		if text[0] == '[' {
+			if strings.HasPrefix(text, "[[") {
+				return nil, errors.Errorf("line %d: arrays of tables aren't supported", line)
+			}
+			end := strings.IndexByte(text, ']')
+			if end < 0 || !isComment(text[end+1:]) {
+				return nil, errors.Errorf("line %d: bad table header", line)
+			}
+			keys, rest, err := parseKey(text[1:end])
+			if err != nil || strings.TrimSpace(rest) != "" {
+				return nil, errors.Errorf("line %d: bad table name", line)
+			}
+			name := strings.Join(keys, ".")
+			if defined[name] {
+				return nil, errors.Errorf("line %d: table '%s' is defined twice", line, name)
+			}
+			defined[name] = true
+			if current, err = table(root, keys); err != nil {
+				return nil, errors.Wrapf(err, "line %d", line)
+			}
+			continue
+		}
+
+		keys, rest, err := parseKey(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "=") {
+			return nil, errors.Errorf("line %d: expected = after key", line)
+		}
+		value, rest, err := parseValue(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		if !isComment(rest) {
+			return nil, errors.Errorf("line %d: unexpected '%s' after value", line, strings.TrimSpace(rest))
+		}
+
+		parent, err := table(current, keys[:len(keys)-1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		key := keys[len(keys)-1]
+		if _, ok := parent[key]; ok {
+			return nil, errors.Errorf("line %d: key '%s' is defined twice", line, strings.Join(keys, "."))
+		}
+		parent[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't read TOML")
+	}
+	return root, nil
+}
+
+// isComment reports whether s is only whitespace and maybe a comment.
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// table finds the table at keys under t, creating any that are missing.
+func table(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		v, ok := t[key]
+		if !ok {
+			child := map[string]interface{}{}
+			t[key] = child
+			t = child
+			continue
+		}
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("key '%s' isn't a table", key)
+		}
+		t = child
+	}
+	return t, nil
+}
+
+// parseKey reads a possibly dotted key from the start of s, returning its
+// parts and what follows it.
+func parseKey(s string) ([]string, string, error) {
+	var keys []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		var key string
+		switch {
+		case strings.HasPrefix(s, `"`), strings.HasPrefix(s, "'"):
+			quoted, rest, err := parseString(s)
+			if err != nil {
+				return nil, "", err
+			}
+			key, s = quoted, rest
+		default:
+			end := 0
+			for end < len(s) && isBareKeyChar(s[end]) {
+				end++
+			}
+			if end == 0 {
+				return nil, "", errors.New("expected a key")
+			}
+			key, s = s[:end], s[end:]
+		}
+		keys = append(keys, key)
+
+		s = strings.TrimLeft(s, " \t")
+		if !strings.HasPrefix(s, ".") {
+			return keys, s, nil
+		}
+		s = s[1:]
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseValue reads a value from the start of s, returning it and what
+// follows it.
+func parseValue(s string) (interface{}, string, error) {
+	switch {
+	case s == "":
+		return nil, "", errors.New("missing value")
+	case s[0] == '"' || s[0] == '\'':
+		return parseString(s)
+	case s[0] == '[':
+		return parseArray(s)
+	case s[0] == '{':
+		return nil, "", errors.New("inline tables aren't supported")
+	}
+
+	end := strings.IndexAny(s, " \t,]#")
+	if end < 0 {
+		end = len(s)
+	}
+	word, rest := s[:end], s[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return nil, "", errors.Errorf("'%s' can't be represented", word)
+	}
+
+	number := strings.ReplaceAll(word, "_", "")
+	if i, err := strconv.ParseInt(number, 0, 64); err == nil && !isLeadingZero(number) {
+		return i, rest, nil
+	}
+	if strings.ContainsAny(number, ".eE") && !strings.ContainsAny(number, "xob") {
+		if f, err := strconv.ParseFloat(number, 64); err == nil {
+			return f, rest, nil
+		}
+	}
+	return nil, "", errors.Errorf("bad value '%s'", word)
+}
+
+// isLeadingZero reports whether a decimal integer has a leading zero, which
+// TOML doesn't allow so it isn't mistaken for octal.
+func isLeadingZero(number string) bool {
+	number = strings.TrimLeft(number, "+-")
+	return len(number) > 1 && number[0] == '0' && number[1] >= '0' && number[1] <= '9'
+}
+
+// parseString reads a basic "string" or literal 'string' from the start
+// of s, returning it and what follows it.
+func parseString(s string) (string, string, error) {
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			break
+		}
+		switch s[i] {
+		case '"', '\\':
+			b.WriteByte(s[i])
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case 'u', 'U':
+			size := 4
+			if s[i] == 'U' {
+				size = 8
+			}
+			if i+size >= len(s) {
+				return "", "", errors.New("short unicode escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", "", errors.Errorf("bad unicode escape '%s'", s[i-1:i+1+size])
+			}
+			b.WriteRune(rune(r))
+			i += size
+		default:
+			return "", "", errors.Errorf("bad escape '\\%c'", s[i])
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
+
+// parseArray reads a single line array from the start of s, returning it
+// and what follows it.
+func parseArray(s string) ([]interface{}, string, error) {
+	values := []interface{}{}
+	s = strings.TrimLeft(s[1:], " \t")
+	for {
+		if strings.HasPrefix(s, "]") {
+			return values, s[1:], nil
+		}
+		value, rest, err := parseValue(s)
+		if err != nil {
+			return nil, "", err
+		}
+		values = append(values, value)
+
+		s = strings.TrimLeft(rest, " \t")
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = strings.TrimLeft(s[1:], " \t")
+		case strings.HasPrefix(s, "]"):
+		default:
+			return nil, "", errors.New("unterminated array")
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+		want map[string]interface{}
+	}{
+		{
+			name: "values",
+			toml: `
+# A comment
+title = "Learn \"Vulkan\"\t\u00e9"
+path = 'C:\shaders'
+width = 1_280
+offset = -3
+hex = 0xff
+scale = 1.5
+tiny = 1e-3
+vsync = true
+debug = false
+`,
+			want: map[string]interface{}{
+				"title":  "Learn \"Vulkan\"\t\u00e9",
+				"path":   `C:\shaders`,
+				"width":  int64(1280),
+				"offset": int64(-3),
+				"hex":    int64(255),
+				"scale":  1.5,
+				"tiny":   0.001,
+				"vsync":  true,
+				"debug":  false,
+			},
+		},
+		{
+			name: "tables",
+			toml: `
+scene = "particles"
+
+[window]
+width = 800 # trailing comment
+"full screen" = "1920x1080"
+
+[validation.messages]
+ignored = [1, 2, 3]
+`,
+			want: map[string]interface{}{
+				"scene": "particles",
+				"window": map[string]interface{}{
+					"width":       int64(800),
+					"full screen": "1920x1080",
+				},
+				"validation": map[string]interface{}{
+					"messages": map[string]interface{}{
+						"ignored": []interface{}{int64(1), int64(2), int64(3)},
+					},
+				},
+			},
+		},
+		{
+			name: "dotted keys",
+			toml: `
+window.width = 800
+window.height = 600
+`,
+			want: map[string]interface{}{
+				"window": map[string]interface{}{
+					"width":  int64(800),
+					"height": int64(600),
+				},
+			},
+		},
+		{
+			name: "arrays",
+			toml: `
+empty = []
+names = [ "a", 'b', ]
+nested = [[1, 2], ["x"]]
+`,
+			want: map[string]interface{}{
+				"empty":  []interface{}{},
+				"names":  []interface{}{"a", "b"},
+				"nested": []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"x"}},
+			},
+		},
+		{
+			name: "hash in a string",
+			toml: `color = "#ff0000" # red`,
+			want: map[string]interface{}{"color": "#ff0000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.toml))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+	}{
+		{"missing equals", "width 800"},
+		{"missing value", "width ="},
+		{"bad value", "width = eight"},
+		{"leading zero", "width = 0800"},
+		{"unterminated string", `title = "Learn`},
+		{"bad escape", `title = "\q"`},
+		{"unterminated array", "sizes = [1, 2"},
+		{"trailing junk", `title = "a" "b"`},
+		{"duplicate key", "width = 1\nwidth = 2"},
+		{"duplicate table", "[window]\n[window]"},
+		{"key is not a table", "window = 1\n[window]"},
+		{"inline table", "window = { width = 800 }"},
+		{"array of tables", "[[windows]]"},
+		{"bad header", "[window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.toml)); err == nil {
+				t.Error("Parse succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	type window struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	}
+	type settings struct {
+		Scene  string  `json:"scene"`
+		Scale  float64 `json:"scale"`
+		Window window  `json:"window"`
+	}
+	want := settings{Scene: "particles", Scale: 2, Window: window{Width: 800, Height: 600}}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"settings.toml": "scene = \"particles\"\nscale = 2.0\n[window]\nwidth = 800\nheight = 600\n",
+		"settings.json": `{"scene": "particles", "scale": 2, "window": {"width": 800, "height": 600}}`,
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var got settings
+		if err := Load(path, &got); err != nil {
+			t.Fatalf("Load %s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("Load %s = %+v, want %+v", name, got, want)
+		}
+	}
+
+	for name, contents := range map[string]string{
+		"unknown.toml": "fullscreen = true\n",
+		"wrong.toml":   "scene = 3\n",
+		"settings.ini": "scene = particles\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var got settings
+		if err := Load(path, &got); err == nil {
+			t.Errorf("Load %s succeeded, want an error", name)
+		}
+	}
+}
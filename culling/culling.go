@@ -0,0 +1,153 @@
+// Package culling decides which objects can be seen before they're drawn,
+// by testing their axis aligned bounding boxes against the planes of the
+// camera's view frustum and remembering which of them occlusion queries
+// found hidden behind others.
+package culling
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// AABB is an axis aligned bounding box, empty while Min is above Max.
+type AABB struct {
+	Min vmath.Vec3
+	Max vmath.Vec3
+}
+
+// Empty is the box holding nothing, which Extend grows from.
+func Empty() AABB {
+	inf := float32(math.Inf(1))
+	return AABB{Min: vmath.Vec3{inf, inf, inf}, Max: vmath.Vec3{-inf, -inf, -inf}}
+}
+
+// IsEmpty is whether b holds nothing.
+func (b AABB) IsEmpty() bool {
+	return b.Min[0] > b.Max[0] || b.Min[1] > b.Max[1] || b.Min[2] > b.Max[2]
+}
+
+// Extend is b grown to take in p.
+func (b AABB) Extend(p vmath.Vec3) AABB {
+	for i := range p {
+		b.Min[i] = float32(math.Min(float64(b.Min[i]), float64(p[i])))
+		b.Max[i] = float32(math.Max(float64(b.Max[i]), float64(p[i])))
+	}
+	return b
+}
+
+// Union is the box taking in both b and o.
+func (b AABB) Union(o AABB) AABB {
+	if o.IsEmpty() {
+		return b
+	}
+	return b.Extend(o.Min).Extend(o.Max)
+}
+
+// Grow is b pushed out d on every side.
+func (b AABB) Grow(d float32) AABB {
+	if b.IsEmpty() {
+		return b
+	}
+	return AABB{Min: b.Min.Sub(vmath.Vec3{d, d, d}), Max: b.Max.Add(vmath.Vec3{d, d, d})}
+}
+
+// Contains is whether p is inside b or on its faces.
+func (b AABB) Contains(p vmath.Vec3) bool {
+	for i := range p {
+		if p[i] < b.Min[i] || p[i] > b.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Transform is the box around b once m has moved it. It's found from m's
+// columns rather than its eight corners, after Arvo's Graphics Gems
+// method, and is as tight as an axis aligned box around the moved one can
+// be.
+func (b AABB) Transform(m vmath.Mat4) AABB {
+	if b.IsEmpty() {
+		return b
+	}
+	out := AABB{
+		Min: vmath.Vec3{m[12], m[13], m[14]},
+		Max: vmath.Vec3{m[12], m[13], m[14]},
+	}
+	for c := 0; c < 3; c++ {
+		for r := 0; r < 3; r++ {
+			lo, hi := m[c*4+r]*b.Min[c], m[c*4+r]*b.Max[c]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			out.Min[r] += lo
+			out.Max[r] += hi
+		}
+	}
+	return out
+}
+
+// Plane is the points p where Normal·p + Distance is zero, the inside
+// being where it's positive.
+type Plane struct {
+	Normal   vmath.Vec3
+	Distance float32
+}
+
+// Frustum is the six planes bounding what a camera sees, facing in.
+type Frustum [6]Plane
+
+// NewFrustum extracts the frustum's planes from a view projection matrix
+// with Vulkan's 0 to 1 depth, after Gribb and Hartmann. Anything in front
+// of every plane ends up inside clip space.
+func NewFrustum(viewProj vmath.Mat4) Frustum {
+	row := func(r int) vmath.Vec4 {
+		return vmath.Vec4{viewProj.At(r, 0), viewProj.At(r, 1), viewProj.At(r, 2), viewProj.At(r, 3)}
+	}
+	x, y, z, w := row(0), row(1), row(2), row(3)
+	planes := [6]vmath.Vec4{
+		add(w, x, 1), add(w, x, -1),
+		add(w, y, 1), add(w, y, -1),
+		z, add(w, z, -1),
+	}
+	var f Frustum
+	for i, p := range planes {
+		n := p.Vec3()
+		l := n.Len()
+		if l == 0 {
+			// A degenerate plane culls nothing
+			f[i] = Plane{Distance: 1}
+			continue
+		}
+		f[i] = Plane{Normal: n.Mul(1 / l), Distance: p[3] / l}
+	}
+	return f
+}
+
+// Intersects is whether any of b might be inside f. Boxes near the
+// frustum's corners can be outside it and still be kept, never the other
+// way around.
+func (f *Frustum) Intersects(b AABB) bool {
+	if b.IsEmpty() {
+		return false
+	}
+	for _, p := range f {
+		// The corner furthest along the plane's normal is the last out
+		var corner vmath.Vec3
+		for i := range corner {
+			corner[i] = b.Min[i]
+			if p.Normal[i] >= 0 {
+				corner[i] = b.Max[i]
+			}
+		}
+		if p.Normal.Dot(corner)+p.Distance < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add is a plus b scaled by s.
+func add(a, b vmath.Vec4, s float32) vmath.Vec4 {
+	return vmath.Vec4{a[0] + b[0]*s, a[1] + b[1]*s, a[2] + b[2]*s, a[3] + b[3]*s}
+}
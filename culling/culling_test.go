@@ -0,0 +1,121 @@
+package culling
+
+import (
+	"math"
+	"testing"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+func nearVec3(a, b vmath.Vec3) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+// box is the cube of half size r around centre.
+func box(centre vmath.Vec3, r float32) AABB {
+	return AABB{Min: centre.Sub(vmath.Vec3{r, r, r}), Max: centre.Add(vmath.Vec3{r, r, r})}
+}
+
+func TestExtendAndUnion(t *testing.T) {
+	b := Empty()
+	if !b.IsEmpty() {
+		t.Fatal("Empty isn't empty")
+	}
+	b = b.Extend(vmath.Vec3{1, -2, 3}).Extend(vmath.Vec3{-1, 2, 0})
+	want := AABB{Min: vmath.Vec3{-1, -2, 0}, Max: vmath.Vec3{1, 2, 3}}
+	if b != want {
+		t.Errorf("extended box = %v, want %v", b, want)
+	}
+	if got := b.Union(Empty()); got != b {
+		t.Errorf("union with an empty box = %v, want %v", got, b)
+	}
+	if got := Empty().Union(b); got != b {
+		t.Errorf("empty box's union = %v, want %v", got, b)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	b := AABB{Min: vmath.Vec3{0, 0, 0}, Max: vmath.Vec3{2, 1, 1}}
+	// A quarter turn around Z swings X onto Y before moving up Z
+	m := vmath.Translate(vmath.Vec3{0, 0, 5}).Mul(vmath.Rotate(vmath.Radians(90), vmath.Vec3{0, 0, 1}))
+	got := b.Transform(m)
+	want := AABB{Min: vmath.Vec3{-1, 0, 5}, Max: vmath.Vec3{0, 2, 6}}
+	if !nearVec3(got.Min, want.Min) || !nearVec3(got.Max, want.Max) {
+		t.Errorf("turned box = %v, want %v", got, want)
+	}
+	if got := Empty().Transform(m); !got.IsEmpty() {
+		t.Errorf("turned empty box = %v, want empty", got)
+	}
+}
+
+func TestFrustumIntersects(t *testing.T) {
+	// Looking along +X from the origin with a quarter turn field of view
+	view := vmath.LookAt(vmath.Vec3{}, vmath.Vec3{1, 0, 0}, vmath.Vec3{0, 0, 1})
+	proj := vmath.Perspective(vmath.Radians(90), 1, 0.1, 100)
+	f := NewFrustum(proj.Mul(view))
+
+	tests := []struct {
+		name string
+		box  AABB
+		want bool
+	}{
+		{"ahead", box(vmath.Vec3{10, 0, 0}, 1), true},
+		{"behind", box(vmath.Vec3{-10, 0, 0}, 1), false},
+		{"past the far plane", box(vmath.Vec3{110, 0, 0}, 1), false},
+		{"left of view", box(vmath.Vec3{10, 15, 0}, 1), false},
+		{"right of view", box(vmath.Vec3{10, -15, 0}, 1), false},
+		{"above view", box(vmath.Vec3{10, 0, 15}, 1), false},
+		{"below view", box(vmath.Vec3{10, 0, -15}, 1), false},
+		{"straddling the left plane", box(vmath.Vec3{10, 10.5, 0}, 1), true},
+		{"around the camera", box(vmath.Vec3{}, 1), true},
+		{"empty", Empty(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Intersects(tt.box); got != tt.want {
+				t.Errorf("Intersects(%v) = %v, want %v", tt.box, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrowAndContains(t *testing.T) {
+	b := box(vmath.Vec3{}, 1).Grow(0.5)
+	if !b.Contains(vmath.Vec3{1.5, -1.5, 0}) {
+		t.Errorf("%v doesn't contain its corner", b)
+	}
+	if b.Contains(vmath.Vec3{0, 0, 1.6}) {
+		t.Errorf("%v contains a point above it", b)
+	}
+	if got := Empty().Grow(1); !got.IsEmpty() {
+		t.Errorf("grown empty box = %v, want empty", got)
+	}
+}
+
+func TestOcclusion(t *testing.T) {
+	var o Occlusion[string]
+	if o.Hidden("a") {
+		t.Error("zero Occlusion hides objects")
+	}
+	o.Update([]string{"a", "b"}, []bool{false, true})
+	if !o.Hidden("a") || o.Hidden("b") {
+		t.Errorf("after a hidden and b seen, Hidden(a) = %v, Hidden(b) = %v", o.Hidden("a"), o.Hidden("b"))
+	}
+	// c wasn't queried, like an object that's only just come into view
+	if o.Hidden("c") {
+		t.Error("an object without results is hidden")
+	}
+	o.Update([]string{"b"}, []bool{false})
+	if o.Hidden("a") || !o.Hidden("b") {
+		t.Errorf("after a round without a, Hidden(a) = %v, Hidden(b) = %v", o.Hidden("a"), o.Hidden("b"))
+	}
+	o.Update(nil, nil)
+	if o.Hidden("b") {
+		t.Error("b still hidden after a round without results")
+	}
+}
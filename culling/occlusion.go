@@ -0,0 +1,32 @@
+package culling
+
+// Occlusion remembers which objects the last occlusion queries found
+// hidden, keyed by something that stays the same for an object from frame
+// to frame. Anything it has no result for is taken to be visible, so an
+// object that has just come into view is drawn rather than popping in a
+// frame late. The zero Occlusion has every object visible.
+type Occlusion[K comparable] struct {
+	hidden map[K]bool
+}
+
+// Update replaces what's known with the results of a round of queries,
+// whether any of each of keys' box could be seen. Objects that weren't
+// queried are forgotten.
+func (o *Occlusion[K]) Update(keys []K, passed []bool) {
+	if o.hidden == nil {
+		o.hidden = make(map[K]bool)
+	}
+	for k := range o.hidden {
+		delete(o.hidden, k)
+	}
+	for i, k := range keys {
+		if i < len(passed) && !passed[i] {
+			o.hidden[k] = true
+		}
+	}
+}
+
+// Hidden is whether k was hidden when it was last queried.
+func (o *Occlusion[K]) Hidden(k K) bool {
+	return o.hidden[k]
+}
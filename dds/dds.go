@@ -0,0 +1,221 @@
+// Package dds reads DirectDraw Surface files of block compressed textures,
+// BC1 to BC7, with their mip chains.
+//
+// See https://learn.microsoft.com/en-us/windows/win32/direct3ddds/dx-graphics-dds-pguide.
+package dds
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// magic starts every DDS file.
+var magic = []byte("DDS ")
+
+// Header flags and capabilities.
+const (
+	flagMipMapCount = 0x20000
+	pixelFourCC     = 0x4
+	caps2Cubemap    = 0x200
+	caps2Volume     = 0x200000
+	dx10Cube        = 0x4
+)
+
+// VkFormats of the block compressed formats.
+const (
+	FormatBC1RGBAUnorm = 133
+	FormatBC1RGBASRGB  = 134
+	FormatBC2Unorm     = 135
+	FormatBC2SRGB      = 136
+	FormatBC3Unorm     = 137
+	FormatBC3SRGB      = 138
+	FormatBC4Unorm     = 139
+	FormatBC4Snorm     = 140
+	FormatBC5Unorm     = 141
+	FormatBC5Snorm     = 142
+	FormatBC6HUfloat   = 143
+	FormatBC6HSfloat   = 144
+	FormatBC7Unorm     = 145
+	FormatBC7SRGB      = 146
+)
+
+// fourCCFormats are the formats of the legacy header's four character codes.
+var fourCCFormats = map[string]uint32{
+	"DXT1": FormatBC1RGBAUnorm,
+	"DXT2": FormatBC2Unorm,
+	"DXT3": FormatBC2Unorm,
+	"DXT4": FormatBC3Unorm,
+	"DXT5": FormatBC3Unorm,
+	"ATI1": FormatBC4Unorm,
+	"BC4U": FormatBC4Unorm,
+	"BC4S": FormatBC4Snorm,
+	"ATI2": FormatBC5Unorm,
+	"BC5U": FormatBC5Unorm,
+	"BC5S": FormatBC5Snorm,
+}
+
+// dxgiFormats are the formats of the DX10 header's DXGI_FORMATs, typeless
+// ones read as UNORM.
+var dxgiFormats = map[uint32]uint32{
+	70: FormatBC1RGBAUnorm, 71: FormatBC1RGBAUnorm, 72: FormatBC1RGBASRGB,
+	73: FormatBC2Unorm, 74: FormatBC2Unorm, 75: FormatBC2SRGB,
+	76: FormatBC3Unorm, 77: FormatBC3Unorm, 78: FormatBC3SRGB,
+	79: FormatBC4Unorm, 80: FormatBC4Unorm, 81: FormatBC4Snorm,
+	82: FormatBC5Unorm, 83: FormatBC5Unorm, 84: FormatBC5Snorm,
+	94: FormatBC6HUfloat, 95: FormatBC6HUfloat, 96: FormatBC6HSfloat,
+	97: FormatBC7Unorm, 98: FormatBC7Unorm, 99: FormatBC7SRGB,
+}
+
+// Texture is a DDS file's 2D image.
+type Texture struct {
+	// Format is the VkFormat of Levels.
+	Format uint32
+	Width  uint32
+	Height uint32
+	// Levels are the mip chain's blocks, the full size image first.
+	Levels [][]byte
+}
+
+// header is what follows the magic.
+type header struct {
+	Size              uint32
+	Flags             uint32
+	Height            uint32
+	Width             uint32
+	PitchOrLinearSize uint32
+	Depth             uint32
+	MipMapCount       uint32
+	Reserved1         [11]uint32
+	PixelFormat       struct {
+		Size        uint32
+		Flags       uint32
+		FourCC      [4]byte
+		RGBBitCount uint32
+		RBitMask    uint32
+		GBitMask    uint32
+		BBitMask    uint32
+		ABitMask    uint32
+	}
+	Caps      uint32
+	Caps2     uint32
+	Caps3     uint32
+	Caps4     uint32
+	Reserved2 uint32
+}
+
+// dx10Header follows header when its four character code is DX10.
+type dx10Header struct {
+	DXGIFormat        uint32
+	ResourceDimension uint32
+	MiscFlag          uint32
+	ArraySize         uint32
+	MiscFlags2        uint32
+}
+
+// IsDDS is whether data starts like a DDS file.
+func IsDDS(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Decode reads a DDS file's block compressed 2D image. Uncompressed
+// formats, arrays, cube maps and volumes aren't supported.
+func Decode(data []byte) (*Texture, error) {
+	if !IsDDS(data) {
+		return nil, errors.New("not a DDS file")
+	}
+	r := bytes.NewReader(data[len(magic):])
+	var h header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, errors.Wrap(err, "can't read header")
+	}
+	switch {
+	case h.Width == 0 || h.Height == 0:
+		return nil, errors.Errorf("%dx%d isn't a 2D image", h.Width, h.Height)
+	case h.Caps2&caps2Cubemap != 0:
+		return nil, errors.New("cube maps aren't supported")
+	case h.Caps2&caps2Volume != 0:
+		return nil, errors.New("volume textures aren't supported")
+	case h.PixelFormat.Flags&pixelFourCC == 0:
+		return nil, errors.New("uncompressed formats aren't supported")
+	}
+
+	t := &Texture{Width: h.Width, Height: h.Height}
+	fourCC := string(h.PixelFormat.FourCC[:])
+	if fourCC == "DX10" {
+		var dx10 dx10Header
+		if err := binary.Read(r, binary.LittleEndian, &dx10); err != nil {
+			return nil, errors.Wrap(err, "can't read DX10 header")
+		}
+		if dx10.MiscFlag&dx10Cube != 0 {
+			return nil, errors.New("cube maps aren't supported")
+		}
+		if dx10.ArraySize > 1 {
+			return nil, errors.New("texture arrays aren't supported")
+		}
+		format, ok := dxgiFormats[dx10.DXGIFormat]
+		if !ok {
+			return nil, errors.Errorf("DXGI format %d isn't block compressed", dx10.DXGIFormat)
+		}
+		t.Format = format
+	} else {
+		format, ok := fourCCFormats[fourCC]
+		if !ok {
+			return nil, errors.Errorf("format %q isn't block compressed", fourCC)
+		}
+		t.Format = format
+	}
+
+	levels := uint32(1)
+	if h.Flags&flagMipMapCount != 0 && h.MipMapCount > 1 {
+		levels = h.MipMapCount
+	}
+	if chain := fullChain(t.Width, t.Height); levels > chain {
+		return nil, errors.Errorf("%d mip levels, a %dx%d image has at most %d", levels, t.Width, t.Height, chain)
+	}
+	offset := len(data) - r.Len()
+	width, height := t.Width, t.Height
+	for i := uint32(0); i < levels; i++ {
+		size := LevelSize(t.Format, width, height)
+		if size > len(data)-offset {
+			return nil, errors.Errorf("level %d's %d bytes are past the end of the file", i, size)
+		}
+		t.Levels = append(t.Levels, data[offset:offset+size])
+		offset += size
+		if width > 1 {
+			width /= 2
+		}
+		if height > 1 {
+			height /= 2
+		}
+	}
+	return t, nil
+}
+
+// fullChain is how many levels a width by height image's mip chain has,
+// halving down to 1x1.
+func fullChain(width, height uint32) uint32 {
+	size := width
+	if height > size {
+		size = height
+	}
+	levels := uint32(1)
+	for size > 1 {
+		size >>= 1
+		levels++
+	}
+	return levels
+}
+
+// LevelSize is how many bytes a level of width by height texels of one of
+// the block compressed formats takes, a block per 4x4 texels or part of
+// them.
+func LevelSize(format, width, height uint32) int {
+	blockSize := 16
+	switch format {
+	case FormatBC1RGBAUnorm, FormatBC1RGBASRGB, FormatBC4Unorm, FormatBC4Snorm:
+		blockSize = 8
+	}
+	return int((width+3)/4) * int((height+3)/4) * blockSize
+}
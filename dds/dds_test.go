@@ -0,0 +1,131 @@
+package dds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// file builds a DDS file of a width by height texture with levels mip
+// levels of fourCC, followed by dx10 when fourCC is DX10.
+func file(t *testing.T, fourCC string, dx10 *dx10Header, width, height, levels uint32, format uint32) []byte {
+	t.Helper()
+	var h header
+	h.Size = 124
+	h.Flags = flagMipMapCount
+	h.Width, h.Height, h.MipMapCount = width, height, levels
+	h.PixelFormat.Size = 32
+	h.PixelFormat.Flags = pixelFourCC
+	copy(h.PixelFormat.FourCC[:], fourCC)
+
+	var buf bytes.Buffer
+	buf.Write(magic)
+	if err := binary.Write(&buf, binary.LittleEndian, h); err != nil {
+		t.Fatal(err)
+	}
+	if dx10 != nil {
+		if err := binary.Write(&buf, binary.LittleEndian, dx10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := uint32(0); i < levels; i++ {
+		buf.Write(bytes.Repeat([]byte{byte(i + 1)}, LevelSize(format, width, height)))
+		width, height = max(width/2, 1), max(height/2, 1)
+	}
+	return buf.Bytes()
+}
+
+func max(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func TestLevelSize(t *testing.T) {
+	tests := []struct {
+		format        uint32
+		width, height uint32
+		want          int
+	}{
+		{FormatBC1RGBAUnorm, 8, 8, 4 * 8},
+		{FormatBC1RGBAUnorm, 1, 1, 8},
+		{FormatBC7Unorm, 8, 8, 4 * 16},
+		// A 5 texel wide level is two blocks across
+		{FormatBC3Unorm, 5, 2, 2 * 16},
+		{FormatBC4Unorm, 4, 4, 8},
+	}
+	for _, tt := range tests {
+		if got := LevelSize(tt.format, tt.width, tt.height); got != tt.want {
+			t.Errorf("LevelSize(%d, %d, %d) = %d, want %d", tt.format, tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		fourCC string
+		dx10   *dx10Header
+		format uint32
+	}{
+		{"DXT1", "DXT1", nil, FormatBC1RGBAUnorm},
+		{"DXT5", "DXT5", nil, FormatBC3Unorm},
+		{"ATI2", "ATI2", nil, FormatBC5Unorm},
+		{"BC7 sRGB", "DX10", &dx10Header{DXGIFormat: 99, ResourceDimension: 3, ArraySize: 1}, FormatBC7SRGB},
+		{"BC6H", "DX10", &dx10Header{DXGIFormat: 95, ResourceDimension: 3, ArraySize: 1}, FormatBC6HUfloat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := file(t, tt.fourCC, tt.dx10, 16, 8, 5, tt.format)
+			if !IsDDS(data) {
+				t.Fatal("IsDDS is false")
+			}
+			tex, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tex.Format != tt.format || tex.Width != 16 || tex.Height != 8 {
+				t.Errorf("format %d %dx%d, want %d 16x8", tex.Format, tex.Width, tex.Height, tt.format)
+			}
+			if len(tex.Levels) != 5 {
+				t.Fatalf("%d levels, want 5", len(tex.Levels))
+			}
+			width, height := uint32(16), uint32(8)
+			for i, l := range tex.Levels {
+				if want := LevelSize(tt.format, width, height); len(l) != want || l[0] != byte(i+1) {
+					t.Errorf("level %d is %d bytes of %d, want %d of %d", i, len(l), l[0], want, i+1)
+				}
+				width, height = max(width/2, 1), max(height/2, 1)
+			}
+		})
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	truncated := file(t, "DXT1", nil, 8, 8, 4, FormatBC1RGBAUnorm)
+	uncompressed := file(t, "DXT1", nil, 4, 4, 1, FormatBC1RGBAUnorm)
+	// The pixel format's flags follow its size, 80 bytes in
+	binary.LittleEndian.PutUint32(uncompressed[len(magic)+76:], 0x40)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not DDS", []byte("\xabKTX 20\xbb\r\n\x1a\n")},
+		{"uncompressed", uncompressed},
+		{"unknown four character code", file(t, "RGBG", nil, 4, 4, 1, FormatBC1RGBAUnorm)},
+		{"uncompressed DXGI format", file(t, "DX10", &dx10Header{DXGIFormat: 28, ArraySize: 1}, 4, 4, 1, FormatBC1RGBAUnorm)},
+		{"array", file(t, "DX10", &dx10Header{DXGIFormat: 98, ArraySize: 6}, 4, 4, 1, FormatBC7Unorm)},
+		{"cube map", file(t, "DX10", &dx10Header{DXGIFormat: 98, MiscFlag: dx10Cube, ArraySize: 1}, 4, 4, 1, FormatBC7Unorm)},
+		{"truncated", truncated[:len(truncated)-1]},
+		// An 8x8 chain is 8x8, 4x4, 2x2 and 1x1
+		{"more levels than the chain", file(t, "DXT1", nil, 8, 8, 5, FormatBC1RGBAUnorm)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); err == nil {
+				t.Error("Decode didn't fail")
+			}
+		})
+	}
+}
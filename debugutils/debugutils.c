@@ -0,0 +1,51 @@
+#include <stddef.h>
+
+#include "debugutils.h"
+#include "_cgo_export.h"
+
+typedef void (*PFN_vkVoidFunction)(void);
+typedef PFN_vkVoidFunction (*PFN_vkGetInstanceProcAddr)(VkInstance instance, const char* pName);
+typedef VkResult (*PFN_vkCreateDebugUtilsMessengerEXT)(VkInstance instance, const VkDebugUtilsMessengerCreateInfoEXT* pCreateInfo, const void* pAllocator, VkDebugUtilsMessengerEXT* pMessenger);
+typedef void (*PFN_vkDestroyDebugUtilsMessengerEXT)(VkInstance instance, VkDebugUtilsMessengerEXT messenger, const void* pAllocator);
+typedef VkResult (*PFN_vkSetDebugUtilsObjectNameEXT)(VkDevice device, const VkDebugUtilsObjectNameInfoEXT* pNameInfo);
+
+static VkBool32 messengerCallback(uint32_t messageSeverity, uint32_t messageTypes, const VkDebugUtilsMessengerCallbackDataEXT* pCallbackData, void* pUserData) {
+	return goMessengerCallback(messageSeverity, messageTypes, (VkDebugUtilsMessengerCallbackDataEXT*)pCallbackData, (uintptr_t)pUserData);
+}
+
+VkResult createMessenger(void* getInstanceProcAddr, VkInstance instance, uint32_t severities, uint32_t types, uintptr_t userData, VkDebugUtilsMessengerEXT* pMessenger) {
+	PFN_vkCreateDebugUtilsMessengerEXT create = (PFN_vkCreateDebugUtilsMessengerEXT)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(instance, "vkCreateDebugUtilsMessengerEXT");
+	if (create == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+
+	VkDebugUtilsMessengerCreateInfoEXT createInfo = {
+		.sType = LV_STRUCTURE_TYPE_DEBUG_UTILS_MESSENGER_CREATE_INFO_EXT,
+		.messageSeverity = severities,
+		.messageType = types,
+		.pfnUserCallback = messengerCallback,
+		.pUserData = (void*)userData,
+	};
+	return create(instance, &createInfo, NULL, pMessenger);
+}
+
+void destroyMessenger(void* getInstanceProcAddr, VkInstance instance, VkDebugUtilsMessengerEXT messenger) {
+	PFN_vkDestroyDebugUtilsMessengerEXT destroy = (PFN_vkDestroyDebugUtilsMessengerEXT)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(instance, "vkDestroyDebugUtilsMessengerEXT");
+	if (destroy != NULL) {
+		destroy(instance, messenger, NULL);
+	}
+}
+
+void* loadSetObjectName(void* getInstanceProcAddr, VkInstance instance) {
+	return (void*)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(instance, "vkSetDebugUtilsObjectNameEXT");
+}
+
+VkResult setObjectName(void* setObjectName, VkDevice device, int32_t objectType, uint64_t objectHandle, const char* name) {
+	VkDebugUtilsObjectNameInfoEXT nameInfo = {
+		.sType = LV_STRUCTURE_TYPE_DEBUG_UTILS_OBJECT_NAME_INFO_EXT,
+		.objectType = objectType,
+		.objectHandle = objectHandle,
+		.pObjectName = name,
+	};
+	return ((PFN_vkSetDebugUtilsObjectNameEXT)setObjectName)(device, &nameInfo);
+}
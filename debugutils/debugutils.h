@@ -0,0 +1,69 @@
+// The subset of VK_EXT_debug_utils the package needs, declared here so it
+// builds without the Vulkan headers. Layouts follow vulkan_core.h.
+#ifndef LEARNVULKAN_DEBUGUTILS_H
+#define LEARNVULKAN_DEBUGUTILS_H
+
+#include <stdint.h>
+
+typedef struct VkInstance_T* VkInstance;
+typedef struct VkDevice_T* VkDevice;
+typedef uint64_t VkDebugUtilsMessengerEXT;
+typedef uint32_t VkBool32;
+typedef int32_t VkResult;
+
+#define LV_STRUCTURE_TYPE_DEBUG_UTILS_OBJECT_NAME_INFO_EXT 1000128000
+#define LV_STRUCTURE_TYPE_DEBUG_UTILS_MESSENGER_CREATE_INFO_EXT 1000128004
+#define LV_ERROR_EXTENSION_NOT_PRESENT -7
+
+typedef struct VkDebugUtilsObjectNameInfoEXT {
+	int32_t sType;
+	const void* pNext;
+	int32_t objectType;
+	uint64_t objectHandle;
+	const char* pObjectName;
+} VkDebugUtilsObjectNameInfoEXT;
+
+typedef struct VkDebugUtilsLabelEXT {
+	int32_t sType;
+	const void* pNext;
+	const char* pLabelName;
+	float color[4];
+} VkDebugUtilsLabelEXT;
+
+typedef struct VkDebugUtilsMessengerCallbackDataEXT {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	const char* pMessageIdName;
+	int32_t messageIdNumber;
+	const char* pMessage;
+	uint32_t queueLabelCount;
+	const VkDebugUtilsLabelEXT* pQueueLabels;
+	uint32_t cmdBufLabelCount;
+	const VkDebugUtilsLabelEXT* pCmdBufLabels;
+	uint32_t objectCount;
+	const VkDebugUtilsObjectNameInfoEXT* pObjects;
+} VkDebugUtilsMessengerCallbackDataEXT;
+
+typedef VkBool32 (*PFN_vkDebugUtilsMessengerCallbackEXT)(
+	uint32_t messageSeverity,
+	uint32_t messageTypes,
+	const VkDebugUtilsMessengerCallbackDataEXT* pCallbackData,
+	void* pUserData);
+
+typedef struct VkDebugUtilsMessengerCreateInfoEXT {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	uint32_t messageSeverity;
+	uint32_t messageType;
+	PFN_vkDebugUtilsMessengerCallbackEXT pfnUserCallback;
+	void* pUserData;
+} VkDebugUtilsMessengerCreateInfoEXT;
+
+VkResult createMessenger(void* getInstanceProcAddr, VkInstance instance, uint32_t severities, uint32_t types, uintptr_t userData, VkDebugUtilsMessengerEXT* pMessenger);
+void destroyMessenger(void* getInstanceProcAddr, VkInstance instance, VkDebugUtilsMessengerEXT messenger);
+void* loadSetObjectName(void* getInstanceProcAddr, VkInstance instance);
+VkResult setObjectName(void* setObjectName, VkDevice device, int32_t objectType, uint64_t objectHandle, const char* name);
+
+#endif
@@ -0,0 +1,181 @@
+// Package debugutils implements VK_EXT_debug_utils, which vulkan-go doesn't
+// bind. Entry points are loaded through vkGetInstanceProcAddr so the only C
+// dependency is the small set of declarations in debugutils.h.
+package debugutils
+
+/*
+#include "debugutils.h"
+*/
+import "C"
+
+import (
+	"runtime/cgo"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Severity is a VkDebugUtilsMessageSeverityFlagBitsEXT, higher is more severe.
+type Severity uint32
+
+const (
+	SeverityVerbose Severity = 0x1
+	SeverityInfo    Severity = 0x10
+	SeverityWarning Severity = 0x100
+	SeverityError   Severity = 0x1000
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityVerbose:
+		return "VERBOSE"
+	case SeverityInfo:
+		return "INFO"
+	case SeverityWarning:
+		return "WARN"
+	case SeverityError:
+		return "ERROR"
+	}
+	return "UNKNOWN"
+}
+
+// MessageType is a mask of VkDebugUtilsMessageTypeFlagBitsEXT.
+type MessageType uint32
+
+const (
+	TypeGeneral     MessageType = 0x1
+	TypeValidation  MessageType = 0x2
+	TypePerformance MessageType = 0x4
+
+	AllTypes = TypeGeneral | TypeValidation | TypePerformance
+)
+
+// Object is a Vulkan object a message refers to.
+type Object struct {
+	Type   vk.ObjectType
+	Handle uint64
+	Name   string
+}
+
+// Message is a single message from the validation layers or driver.
+type Message struct {
+	Severity Severity
+	Types    MessageType
+	// ID identifies the kind of message, it's stable across runs so it can
+	// be used to single out specific validation messages.
+	ID      int32
+	IDName  string
+	Text    string
+	Objects []Object
+}
+
+// Callback receives messages, it can be called from any thread.
+type Callback func(Message)
+
+// Config selects which messages are delivered and where.
+type Config struct {
+	// MinSeverity drops messages less severe than it, zero means everything.
+	MinSeverity Severity
+	// Types limits delivery to these message types, zero means all of them.
+	Types MessageType
+	// Callback receives every delivered message without an IDCallbacks entry.
+	Callback Callback
+	// IDCallbacks handle messages with specific IDs instead of Callback.
+	IDCallbacks map[int32]Callback
+}
+
+// Messenger is a VkDebugUtilsMessengerEXT delivering messages to a Config.
+type Messenger struct {
+	getInstanceProcAddr unsafe.Pointer
+	instance            vk.Instance
+	handle              C.VkDebugUtilsMessengerEXT
+	config              cgo.Handle
+}
+
+// New creates a messenger on an instance created with
+// VK_EXT_debug_utils enabled. getInstanceProcAddr is the loader's
+// vkGetInstanceProcAddr, as returned by glfw.GetVulkanGetInstanceProcAddress.
+func New(getInstanceProcAddr unsafe.Pointer, instance vk.Instance, cfg Config) (*Messenger, error) {
+	if getInstanceProcAddr == nil {
+		return nil, errors.New("vkGetInstanceProcAddr is nil")
+	}
+	if cfg.Types == 0 {
+		cfg.Types = AllTypes
+	}
+
+	var severities Severity
+	for _, s := range []Severity{SeverityVerbose, SeverityInfo, SeverityWarning, SeverityError} {
+		if s >= cfg.MinSeverity {
+			severities |= s
+		}
+	}
+
+	m := &Messenger{
+		getInstanceProcAddr: getInstanceProcAddr,
+		instance:            instance,
+		config:              cgo.NewHandle(&cfg),
+	}
+	result := C.createMessenger(
+		getInstanceProcAddr,
+		C.VkInstance(unsafe.Pointer(instance)),
+		C.uint32_t(severities),
+		C.uint32_t(cfg.Types),
+		C.uintptr_t(m.config),
+		&m.handle,
+	)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		m.config.Delete()
+		return nil, errors.Wrap(err, "can't create debug utils messenger")
+	}
+	return m, nil
+}
+
+// Destroy stops delivering messages, it has to happen before the instance is
+// destroyed.
+func (m *Messenger) Destroy() {
+	if m.handle == 0 {
+		return
+	}
+	C.destroyMessenger(m.getInstanceProcAddr, C.VkInstance(unsafe.Pointer(m.instance)), m.handle)
+	m.handle = 0
+	m.config.Delete()
+}
+
+//export goMessengerCallback
+func goMessengerCallback(severity, types C.uint32_t, data *C.VkDebugUtilsMessengerCallbackDataEXT, userData C.uintptr_t) C.VkBool32 {
+	cfg := cgo.Handle(userData).Value().(*Config)
+
+	msg := Message{
+		Severity: Severity(severity),
+		Types:    MessageType(types),
+		ID:       int32(data.messageIdNumber),
+		IDName:   goString(data.pMessageIdName),
+		Text:     goString(data.pMessage),
+	}
+	if data.objectCount > 0 {
+		for _, o := range unsafe.Slice(data.pObjects, data.objectCount) {
+			msg.Objects = append(msg.Objects, Object{
+				Type:   vk.ObjectType(o.objectType),
+				Handle: uint64(o.objectHandle),
+				Name:   goString(o.pObjectName),
+			})
+		}
+	}
+
+	if cb, ok := cfg.IDCallbacks[msg.ID]; ok {
+		cb(msg)
+	} else if cfg.Callback != nil {
+		cfg.Callback(msg)
+	}
+
+	// Returning true would abort the call that triggered the message
+	return C.VkBool32(0)
+}
+
+func goString(s *C.char) string {
+	if s == nil {
+		return ""
+	}
+	return C.GoString(s)
+}
@@ -0,0 +1,121 @@
+package debugutils
+
+/*
+#include <stdlib.h>
+
+#include "debugutils.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Namer attaches names to a device's objects so validation messages and
+// captures in tools like RenderDoc show them instead of raw handles.
+type Namer struct {
+	device  vk.Device
+	setName unsafe.Pointer
+}
+
+// NewNamer loads vkSetDebugUtilsObjectNameEXT for device, the instance must
+// have VK_EXT_debug_utils enabled.
+func NewNamer(getInstanceProcAddr unsafe.Pointer, instance vk.Instance, device vk.Device) (*Namer, error) {
+	if getInstanceProcAddr == nil {
+		return nil, errors.New("vkGetInstanceProcAddr is nil")
+	}
+
+	setName := C.loadSetObjectName(getInstanceProcAddr, C.VkInstance(unsafe.Pointer(instance)))
+	if setName == nil {
+		return nil, errors.New("vkSetDebugUtilsObjectNameEXT isn't available")
+	}
+	return &Namer{
+		device:  device,
+		setName: setName,
+	}, nil
+}
+
+// Name names a Vulkan handle, its object type is inferred from its Go type.
+// A nil Namer does nothing so callers don't need to check whether debug
+// utils are enabled.
+func (n *Namer) Name(handle interface{}, name string) error {
+	if n == nil {
+		return nil
+	}
+
+	objectType, pointer, err := objectOf(handle)
+	if err != nil {
+		return err
+	}
+	if pointer == nil {
+		return errors.Errorf("can't name null %T '%s'", handle, name)
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	result := C.setObjectName(
+		n.setName,
+		C.VkDevice(unsafe.Pointer(n.device)),
+		C.int32_t(objectType),
+		C.uint64_t(uintptr(pointer)),
+		cName,
+	)
+	return errors.Wrapf(vk.Error(vk.Result(result)), "can't name %T '%s'", handle, name)
+}
+
+// objectOf maps a handle to its object type and raw value.
+func objectOf(handle interface{}) (vk.ObjectType, unsafe.Pointer, error) {
+	switch h := handle.(type) {
+	case vk.Instance:
+		return vk.ObjectTypeInstance, unsafe.Pointer(h), nil
+	case vk.PhysicalDevice:
+		return vk.ObjectTypePhysicalDevice, unsafe.Pointer(h), nil
+	case vk.Device:
+		return vk.ObjectTypeDevice, unsafe.Pointer(h), nil
+	case vk.Queue:
+		return vk.ObjectTypeQueue, unsafe.Pointer(h), nil
+	case vk.Semaphore:
+		return vk.ObjectTypeSemaphore, unsafe.Pointer(h), nil
+	case vk.CommandBuffer:
+		return vk.ObjectTypeCommandBuffer, unsafe.Pointer(h), nil
+	case vk.Fence:
+		return vk.ObjectTypeFence, unsafe.Pointer(h), nil
+	case vk.DeviceMemory:
+		return vk.ObjectTypeDeviceMemory, unsafe.Pointer(h), nil
+	case vk.Buffer:
+		return vk.ObjectTypeBuffer, unsafe.Pointer(h), nil
+	case vk.Image:
+		return vk.ObjectTypeImage, unsafe.Pointer(h), nil
+	case vk.ImageView:
+		return vk.ObjectTypeImageView, unsafe.Pointer(h), nil
+	case vk.ShaderModule:
+		return vk.ObjectTypeShaderModule, unsafe.Pointer(h), nil
+	case vk.PipelineLayout:
+		return vk.ObjectTypePipelineLayout, unsafe.Pointer(h), nil
+	case vk.RenderPass:
+		return vk.ObjectTypeRenderPass, unsafe.Pointer(h), nil
+	case vk.Pipeline:
+		return vk.ObjectTypePipeline, unsafe.Pointer(h), nil
+	case vk.DescriptorSetLayout:
+		return vk.ObjectTypeDescriptorSetLayout, unsafe.Pointer(h), nil
+	case vk.Sampler:
+		return vk.ObjectTypeSampler, unsafe.Pointer(h), nil
+	case vk.DescriptorPool:
+		return vk.ObjectTypeDescriptorPool, unsafe.Pointer(h), nil
+	case vk.DescriptorSet:
+		return vk.ObjectTypeDescriptorSet, unsafe.Pointer(h), nil
+	case vk.Framebuffer:
+		return vk.ObjectTypeFramebuffer, unsafe.Pointer(h), nil
+	case vk.CommandPool:
+		return vk.ObjectTypeCommandPool, unsafe.Pointer(h), nil
+	case vk.Surface:
+		return vk.ObjectTypeSurface, unsafe.Pointer(h), nil
+	case vk.Swapchain:
+		return vk.ObjectTypeSwapchain, unsafe.Pointer(h), nil
+	}
+	return vk.ObjectTypeUnknown, nil, errors.Errorf("%T isn't a nameable Vulkan handle", handle)
+}
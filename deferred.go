@@ -0,0 +1,362 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/renderpass"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// gbufferFormats are the G-buffer's attachments in gbuffer.frag's output
+// order: base color and occlusion, normal and metallic, world position and
+// roughness, and emissive and shadowing.
+var gbufferFormats = []vk.Format{
+	vk.FormatR8g8b8a8Srgb,
+	vk.FormatR16g16b16a16Sfloat,
+	vk.FormatR16g16b16a16Sfloat,
+	vk.FormatR8g8b8a8Srgb,
+}
+
+// lightingSubpass is the deferred render pass's second subpass, shading
+// the G-buffer into the target. The skybox is drawn there too.
+const lightingSubpass = 1
+
+// lightingVertices is the fullscreen triangle lighting.vert draws.
+const lightingVertices = 3
+
+// LightingConstants is pushed once per lighting pass, matching the
+// push_constant block in lighting.frag.
+type LightingConstants struct {
+	LightDirection vmath.Vec4
+	CameraPosition vmath.Vec4
+}
+
+var lightingConstants = pipeline.NewPushConstants[LightingConstants](vk.ShaderStageFlags(vk.ShaderStageFragmentBit), 0)
+
+// fragmentShader is the name and embedded SPIR-V of the fragment shader the
+// graphics pipeline uses, writing the G-buffer when deferred and reading
+// materials from the texture table when bindless.
+func (app *HelloTriangleApplication) fragmentShader() (string, []byte) {
+	switch {
+	case app.Deferred && app.bindless:
+		return "gbufferbindless.frag", shaders.GBufferBindless()
+	case app.Deferred:
+		return "gbuffer.frag", shaders.GBuffer()
+	case app.bindless:
+		return "bindless.frag", shaders.BindlessFrag()
+	}
+	return "shader.frag", shaders.Frag()
+}
+
+// colorOutputs is how many color attachments the graphics pipeline writes.
+func (app *HelloTriangleApplication) colorOutputs() int {
+	if app.Deferred {
+		return len(gbufferFormats)
+	}
+	return 1
+}
+
+// createDeferred creates the layouts every window's lighting pipeline
+// shares when Deferred is set.
+func (app *HelloTriangleApplication) createDeferred() error {
+	if !app.Deferred {
+		return nil
+	}
+
+	vert, frag, err := app.reflectLightingShaders()
+	if err != nil {
+		return err
+	}
+	bindings, err := pipeline.MergeBindings(vert, frag)
+	if err != nil {
+		return err
+	}
+	layouts, err := pipeline.NewSetLayouts(app.device, bindings)
+	if err != nil {
+		return err
+	}
+	if len(layouts) != 1 {
+		for _, l := range layouts {
+			vk.DestroyDescriptorSetLayout(app.device, l, nil)
+		}
+		return errors.Errorf("lighting shaders use %d descriptor sets, expected 1", len(layouts))
+	}
+	app.lightingSetLayout = layouts[0]
+	app.lightingBindings = bindings
+
+	layout, err := pipeline.NewLayout(app.device, layouts, []vk.PushConstantRange{lightingConstants.Range()})
+	if err != nil {
+		return err
+	}
+	app.lightingPipelineLayout = layout
+	app.name(layout, "lighting pipeline layout")
+	return nil
+}
+
+// reflectLightingShaders reflects the lighting pass's shaders, including
+// any hot reloaded ones.
+func (app *HelloTriangleApplication) reflectLightingShaders() (vert, frag *spirv.Module, err error) {
+	vert, err = spirv.Reflect(app.shaderCode("lighting.vert", shaders.LightingVert()))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't reflect lighting vertex shader")
+	}
+	frag, err = spirv.Reflect(app.shaderCode("lighting.frag", shaders.LightingFrag()))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't reflect lighting fragment shader")
+	}
+	return vert, frag, nil
+}
+
+// createDeferredRenderPass builds the render pass for the deferred path.
+// The first subpass draws the scene into the G-buffer and the second reads
+// it back as input attachments, pixel by pixel, to light the target. The
+// G-buffer never leaves the pass so tilers can keep it on chip.
+func (app *HelloTriangleApplication) createDeferredRenderPass() error {
+	format, finalLayout := app.sceneTarget()
+	b := renderpass.NewBuilder()
+	color := b.Attachment(renderpass.ColorAttachment(format, vk.SampleCount1Bit, finalLayout))
+	gbuffer := make([]uint32, len(gbufferFormats))
+	for i, format := range gbufferFormats {
+		desc := renderpass.ColorAttachment(format, vk.SampleCount1Bit, vk.ImageLayoutColorAttachmentOptimal)
+		desc.StoreOp = vk.AttachmentStoreOpDontCare
+		gbuffer[i] = b.Attachment(desc)
+	}
+	depth := b.Attachment(renderpass.DepthAttachment(app.depthFormat, vk.SampleCount1Bit))
+
+	b.Subpass(renderpass.Subpass{
+		Colors: gbuffer,
+		Depth:  renderpass.Ref(depth),
+	})
+	b.Subpass(renderpass.Subpass{
+		Colors: []uint32{color},
+		Inputs: gbuffer,
+		Depth:  renderpass.Ref(depth),
+	})
+
+	b.Dependency(renderpass.ExternalColorDepthDependency())
+	// The target is first written by the lighting subpass
+	target := renderpass.ExternalColorDependency()
+	target.DstSubpass = lightingSubpass
+	b.Dependency(target)
+	b.Dependency(renderpass.InputAttachmentDependency(0, lightingSubpass))
+
+	renderPass, err := b.Build(app.device)
+	if err != nil {
+		return errors.Wrap(err, "can't build deferred render pass")
+	}
+	app.renderPass = renderPass
+	return nil
+}
+
+// createGBuffer creates the G-buffer's attachments at the target's size.
+// They only live for the render pass.
+func (app *HelloTriangleApplication) createGBuffer() error {
+	if !app.Deferred {
+		return nil
+	}
+
+	extent := app.target.Extent
+	app.gbuffer = make([]*gpu.Image, 0, len(gbufferFormats))
+	for i, format := range gbufferFormats {
+		img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+			Width:   extent.Width,
+			Height:  extent.Height,
+			Samples: vk.SampleCount1Bit,
+			Format:  format,
+			Tiling:  vk.ImageTilingOptimal,
+			Usage: vk.ImageUsageFlags(vk.ImageUsageTransientAttachmentBit | vk.ImageUsageColorAttachmentBit |
+				vk.ImageUsageInputAttachmentBit),
+			Memory: memory.GPUOnly,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "can't create G-buffer attachment %d", i)
+		}
+		app.name(img.Handle, "G-buffer %d", i)
+		app.gbuffer = append(app.gbuffer, img)
+	}
+	return nil
+}
+
+func (app *HelloTriangleApplication) destroyGBuffer() {
+	for _, img := range app.gbuffer {
+		img.Destroy()
+	}
+	app.gbuffer = nil
+}
+
+// createLightingSet allocates the current window's lighting descriptor
+// sets, one per frame in flight for its lights, and points them at the
+// G-buffer.
+func (app *HelloTriangleApplication) createLightingSet() error {
+	if !app.Deferred {
+		return nil
+	}
+
+	app.lightingSets = make([]vk.DescriptorSet, app.framesInFlight())
+	for i := range app.lightingSets {
+		set, err := app.descriptorAllocator.Allocate(app.lightingSetLayout)
+		if err != nil {
+			return errors.Wrapf(err, "can't allocate lighting set for frame %d", i)
+		}
+		app.lightingSets[i] = set
+	}
+	app.updateLightingSet()
+	return nil
+}
+
+// updateLightingSet points the lighting sets at the current G-buffer, which
+// is recreated along with the swapchain, and their frame's lights.
+func (app *HelloTriangleApplication) updateLightingSet() {
+	for frame, set := range app.lightingSets {
+		writes := make([]vk.WriteDescriptorSet, 0, len(app.gbuffer)+1)
+		for i, img := range app.gbuffer {
+			writes = append(writes, vk.WriteDescriptorSet{
+				SType:           vk.StructureTypeWriteDescriptorSet,
+				DstSet:          set,
+				DstBinding:      uint32(i),
+				DescriptorType:  vk.DescriptorTypeInputAttachment,
+				DescriptorCount: 1,
+				PImageInfo: []vk.DescriptorImageInfo{{
+					ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+					ImageView:   img.View,
+				}},
+			})
+		}
+		writes = append(writes, app.lightsWrite(frame, set, lightingLightsBinding))
+		vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+	}
+}
+
+// createLightingPipeline creates the fullscreen pipeline shading the
+// G-buffer in the lighting subpass.
+func (app *HelloTriangleApplication) createLightingPipeline() error {
+	if !app.Deferred {
+		return nil
+	}
+
+	vertShaderModule, err := app.createShaderModule(app.shaderCode("lighting.vert", shaders.LightingVert()))
+	if err != nil {
+		return errors.Wrap(err, "can't create lighting vertex shader")
+	}
+	defer vk.DestroyShaderModule(app.device, vertShaderModule, nil)
+
+	fragShaderModule, err := app.createShaderModule(app.shaderCode("lighting.frag", shaders.LightingFrag()))
+	if err != nil {
+		return errors.Wrap(err, "can't create lighting fragment shader")
+	}
+	defer vk.DestroyShaderModule(app.device, fragShaderModule, nil)
+
+	extent := app.target.Extent
+	pipelineInfos := []vk.GraphicsPipelineCreateInfo{{
+		SType:      vk.StructureTypeGraphicsPipelineCreateInfo,
+		StageCount: 2,
+		PStages: []vk.PipelineShaderStageCreateInfo{
+			{
+				SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+				Stage:  vk.ShaderStageVertexBit,
+				Module: vertShaderModule,
+				PName:  "main\x00",
+			},
+			{
+				SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+				Stage:  vk.ShaderStageFragmentBit,
+				Module: fragShaderModule,
+				PName:  "main\x00",
+			},
+		},
+		// The triangle's corners are built into the vertex shader
+		PVertexInputState: &vk.PipelineVertexInputStateCreateInfo{
+			SType: vk.StructureTypePipelineVertexInputStateCreateInfo,
+		},
+		PInputAssemblyState: &vk.PipelineInputAssemblyStateCreateInfo{
+			SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+			Topology: vk.PrimitiveTopologyTriangleList,
+		},
+		PViewportState: &vk.PipelineViewportStateCreateInfo{
+			SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+			ViewportCount: 1,
+			PViewports: []vk.Viewport{{
+				Width:    float32(extent.Width),
+				Height:   float32(extent.Height),
+				MinDepth: 0,
+				MaxDepth: 1,
+			}},
+			ScissorCount: 1,
+			PScissors:    []vk.Rect2D{{Extent: extent}},
+		},
+		PRasterizationState: &vk.PipelineRasterizationStateCreateInfo{
+			SType:       vk.StructureTypePipelineRasterizationStateCreateInfo,
+			PolygonMode: vk.PolygonModeFill,
+			LineWidth:   1,
+			CullMode:    vk.CullModeFlags(vk.CullModeNone),
+			FrontFace:   vk.FrontFaceCounterClockwise,
+		},
+		PMultisampleState: &vk.PipelineMultisampleStateCreateInfo{
+			SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+			RasterizationSamples: vk.SampleCount1Bit,
+			MinSampleShading:     1,
+		},
+		// Every pixel is shaded, the depth buffer is only kept for the skybox
+		PDepthStencilState: &vk.PipelineDepthStencilStateCreateInfo{
+			SType: vk.StructureTypePipelineDepthStencilStateCreateInfo,
+		},
+		PColorBlendState: &vk.PipelineColorBlendStateCreateInfo{
+			SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+			AttachmentCount: 1,
+			PAttachments: []vk.PipelineColorBlendAttachmentState{{
+				ColorWriteMask: vk.ColorComponentFlags(
+					vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit,
+				),
+			}},
+		},
+		Layout:            app.lightingPipelineLayout,
+		RenderPass:        app.renderPass,
+		Subpass:           lightingSubpass,
+		BasePipelineIndex: -1,
+	}}
+
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, 1, pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create lighting pipeline")
+	}
+	app.track("pipeline", pipelines[0])
+	app.lightingPipeline = pipelines[0]
+	app.name(app.lightingPipeline, "lighting pipeline")
+	return nil
+}
+
+// recordLighting moves on to the lighting subpass and shades the G-buffer
+// with a fullscreen triangle, lit by frame's lights.
+func (app *HelloTriangleApplication) recordLighting(cb vk.CommandBuffer, frame int) {
+	vk.CmdNextSubpass(cb, vk.SubpassContentsInline)
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.lightingPipeline)
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, app.lightingPipelineLayout, 0,
+		1, []vk.DescriptorSet{app.lightingSets[frame]}, 0, nil)
+	lightingConstants.Push(cb, app.lightingPipelineLayout, LightingConstants{
+		LightDirection: app.lightDirection().Vec4(0),
+		CameraPosition: app.camera.Position.Vec4(1),
+	})
+	vk.CmdDraw(cb, lightingVertices, 1, 0, 0)
+	app.countDraws(1)
+}
+
+func (app *HelloTriangleApplication) destroyLightingPipeline() {
+	if app.lightingPipeline != vk.NullPipeline {
+		app.destroyPipeline(app.lightingPipeline)
+		app.lightingPipeline = vk.NullPipeline
+	}
+}
+
+func (app *HelloTriangleApplication) destroyDeferred() {
+	if app.lightingPipelineLayout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(app.device, app.lightingPipelineLayout, nil)
+	}
+	if app.lightingSetLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(app.device, app.lightingSetLayout, nil)
+	}
+}
@@ -0,0 +1,117 @@
+// Package deletion defers destroying GPU resources until the submissions
+// that might still be using them have finished, instead of waiting for the
+// whole device to go idle whenever something is recreated at runtime.
+//
+// Submissions are numbered in the order they're made. A resource that's
+// replaced is deferred after the latest submission, since any of the work
+// submitted so far may use it, and destroyed once that submission and
+// every earlier one is known to have finished, which is what waiting on
+// their fences tells.
+package deletion
+
+// Submissions numbers GPU submissions and works out how far they've
+// finished from which of them have been waited on. It isn't safe for
+// concurrent use.
+type Submissions struct {
+	last    uint64
+	pending map[uint64]bool
+}
+
+// Next numbers a new submission, pending until Done is called with its
+// number.
+func (s *Submissions) Next() uint64 {
+	if s.pending == nil {
+		s.pending = map[uint64]bool{}
+	}
+	s.last++
+	s.pending[s.last] = true
+	return s.last
+}
+
+// Done records that the submission numbered serial has finished, usually
+// because its fence has been waited on. Unknown numbers are ignored.
+func (s *Submissions) Done(serial uint64) {
+	delete(s.pending, serial)
+}
+
+// AllDone records that every submission has finished, for after waiting
+// for the device to go idle.
+func (s *Submissions) AllDone() {
+	for serial := range s.pending {
+		delete(s.pending, serial)
+	}
+}
+
+// Last is the number of the latest submission, zero before the first.
+func (s *Submissions) Last() uint64 {
+	return s.last
+}
+
+// Completed is the number of the latest submission that has finished along
+// with every one before it.
+func (s *Submissions) Completed() uint64 {
+	completed := s.last
+	for serial := range s.pending {
+		if serial <= completed {
+			completed = serial - 1
+		}
+	}
+	return completed
+}
+
+// Queue holds destroy functions until the submissions they wait for have
+// finished. It isn't safe for concurrent use.
+type Queue struct {
+	pending []entry
+}
+
+type entry struct {
+	after   uint64
+	destroy func()
+}
+
+// Defer calls destroy once every submission up to after has finished.
+func (q *Queue) Defer(after uint64, destroy func()) {
+	q.pending = append(q.pending, entry{after: after, destroy: destroy})
+}
+
+// Flush calls, in the order they were deferred, the destroy functions
+// waiting for no later submission than completed and returns how many it
+// called.
+func (q *Queue) Flush(completed uint64) int {
+	kept := q.pending[:0]
+	var flushed []entry
+	for _, e := range q.pending {
+		if e.after <= completed {
+			flushed = append(flushed, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	// Cleared so the kept slice doesn't hold on to flushed closures
+	for i := len(kept); i < len(q.pending); i++ {
+		q.pending[i] = entry{}
+	}
+	q.pending = kept
+
+	for _, e := range flushed {
+		e.destroy()
+	}
+	return len(flushed)
+}
+
+// FlushAll calls every destroy function regardless of submissions, for
+// once the device is idle or about to be destroyed.
+func (q *Queue) FlushAll() int {
+	pending := q.pending
+	q.pending = nil
+	for _, e := range pending {
+		e.destroy()
+	}
+	return len(pending)
+}
+
+// Len is how many destroy functions are waiting.
+func (q *Queue) Len() int {
+	return len(q.pending)
+}
@@ -0,0 +1,103 @@
+package deletion
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubmissionsCompleted(t *testing.T) {
+	var s Submissions
+	if got := s.Completed(); got != 0 {
+		t.Fatalf("Completed before any submission = %d, want 0", got)
+	}
+
+	first, second, third := s.Next(), s.Next(), s.Next()
+	steps := []struct {
+		name string
+		done func()
+		want uint64
+	}{
+		{"none done", func() {}, 0},
+		// Fences of different windows' frames are waited on out of order
+		{"later done first", func() { s.Done(second) }, 0},
+		{"earliest done", func() { s.Done(first) }, second},
+		{"unknown ignored", func() { s.Done(42) }, second},
+		{"all done", func() { s.Done(third) }, third},
+	}
+	for _, step := range steps {
+		step.done()
+		if got := s.Completed(); got != step.want {
+			t.Errorf("%s: Completed = %d, want %d", step.name, got, step.want)
+		}
+	}
+
+	fourth := s.Next()
+	s.Next()
+	s.AllDone()
+	if got := s.Completed(); got != s.Last() || s.Last() != fourth+1 {
+		t.Errorf("Completed after AllDone = %d, Last = %d, want %d", got, s.Last(), fourth+1)
+	}
+}
+
+func TestQueueFlush(t *testing.T) {
+	var q Queue
+	var destroyed []string
+	destroy := func(name string) func() {
+		return func() { destroyed = append(destroyed, name) }
+	}
+	q.Defer(2, destroy("pipeline"))
+	q.Defer(1, destroy("buffer"))
+	q.Defer(3, destroy("image"))
+	q.Defer(1, destroy("view"))
+
+	tests := []struct {
+		completed uint64
+		want      []string
+		left      int
+	}{
+		{0, nil, 4},
+		{1, []string{"buffer", "view"}, 2},
+		{1, nil, 2},
+		{3, []string{"pipeline", "image"}, 0},
+	}
+	for _, tt := range tests {
+		destroyed = nil
+		if n := q.Flush(tt.completed); n != len(tt.want) {
+			t.Errorf("Flush(%d) = %d, want %d", tt.completed, n, len(tt.want))
+		}
+		if !reflect.DeepEqual(destroyed, tt.want) {
+			t.Errorf("Flush(%d) destroyed %v, want %v", tt.completed, destroyed, tt.want)
+		}
+		if q.Len() != tt.left {
+			t.Errorf("after Flush(%d) Len = %d, want %d", tt.completed, q.Len(), tt.left)
+		}
+	}
+}
+
+func TestQueueFlushAll(t *testing.T) {
+	var q Queue
+	var destroyed []int
+	for i := 0; i < 3; i++ {
+		i := i
+		q.Defer(uint64(10-i), func() { destroyed = append(destroyed, i) })
+	}
+	if n := q.FlushAll(); n != 3 || q.Len() != 0 {
+		t.Errorf("FlushAll = %d with %d left, want 3 with none", n, q.Len())
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(destroyed, want) {
+		t.Errorf("FlushAll destroyed %v, want %v", destroyed, want)
+	}
+}
+
+func TestQueueDeferDuringFlush(t *testing.T) {
+	var q Queue
+	ran := false
+	// Destroying one thing can defer another, which waits for the next flush
+	q.Defer(1, func() { q.Defer(1, func() { ran = true }) })
+	if n := q.Flush(1); n != 1 || ran {
+		t.Fatalf("Flush = %d, nested ran = %v, want 1 and false", n, ran)
+	}
+	if n := q.Flush(1); n != 1 || !ran {
+		t.Errorf("second Flush = %d, nested ran = %v, want 1 and true", n, ran)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// deferDestroy calls destroy once everything submitted so far has
+// finished, for resources replaced while frames using them may still be in
+// flight. It's how buffers, images and their views are retired too, by
+// passing their Destroy.
+func (app *HelloTriangleApplication) deferDestroy(destroy func()) {
+	app.deletions.Defer(app.submissions.Last(), destroy)
+}
+
+// destroyPipeline destroys p once the frames that might use it finish.
+func (app *HelloTriangleApplication) destroyPipeline(p vk.Pipeline) {
+	if p == vk.NullPipeline {
+		return
+	}
+	device := app.device
+	app.deferDestroy(func() {
+		app.release(p)
+		vk.DestroyPipeline(device, p, nil)
+	})
+}
+
+// destroyPipelineLayout destroys l once the frames that might use it
+// finish.
+func (app *HelloTriangleApplication) destroyPipelineLayout(l vk.PipelineLayout) {
+	if l == vk.NullPipelineLayout {
+		return
+	}
+	device := app.device
+	app.deferDestroy(func() {
+		app.release(l)
+		vk.DestroyPipelineLayout(device, l, nil)
+	})
+}
+
+// submitted records a submission that signals fence when it finishes.
+func (app *HelloTriangleApplication) submitted(fence vk.Fence) {
+	if app.fenceSubmissions == nil {
+		app.fenceSubmissions = map[vk.Fence]uint64{}
+	}
+	app.fenceSubmissions[fence] = app.submissions.Next()
+}
+
+// waited records that fence has been waited on, so its submission has
+// finished, and destroys what no longer has anything in flight using it.
+func (app *HelloTriangleApplication) waited(fence vk.Fence) {
+	if serial, ok := app.fenceSubmissions[fence]; ok {
+		app.submissions.Done(serial)
+		delete(app.fenceSubmissions, fence)
+	}
+	app.deletions.Flush(app.submissions.Completed())
+}
+
+// waitIdle waits for the device to go idle, after which every submission
+// has finished and everything deferred is destroyed.
+func (app *HelloTriangleApplication) waitIdle() error {
+	if err := vk.Error(vk.DeviceWaitIdle(app.device)); err != nil {
+		return errors.Wrap(err, "can't wait for device idle")
+	}
+	app.submissions.AllDone()
+	app.fenceSubmissions = nil
+	app.deletions.FlushAll()
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// depthFormats are the depth formats tried in order of preference, every
+// device supports at least one of them.
+var depthFormats = []vk.Format{
+	vk.FormatD32Sfloat,
+	vk.FormatD32SfloatS8Uint,
+	vk.FormatD24UnormS8Uint,
+}
+
+// chooseDepthFormat picks the first of depthFormats the device can use as
+// an optimally tiled depth attachment.
+func (app *HelloTriangleApplication) chooseDepthFormat() error {
+	for _, format := range depthFormats {
+		var properties vk.FormatProperties
+		vk.GetPhysicalDeviceFormatProperties(app.physicalDevice, format, &properties)
+		properties.Deref()
+		if properties.OptimalTilingFeatures&vk.FormatFeatureFlags(vk.FormatFeatureDepthStencilAttachmentBit) != 0 {
+			app.depthFormat = format
+			return nil
+		}
+	}
+	return errors.New("no supported depth format")
+}
+
+// createDepthResources creates the depth buffer, with as many samples as
+// the color target. It only lives for the render pass.
+func (app *HelloTriangleApplication) createDepthResources() error {
+	extent := app.target.Extent
+	img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:   extent.Width,
+		Height:  extent.Height,
+		Samples: app.msaaSamples,
+		Format:  app.depthFormat,
+		Tiling:  vk.ImageTilingOptimal,
+		Usage:   vk.ImageUsageFlags(vk.ImageUsageTransientAttachmentBit | vk.ImageUsageDepthStencilAttachmentBit),
+		Aspect:  vk.ImageAspectFlags(vk.ImageAspectDepthBit),
+		Memory:  memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create depth image")
+	}
+	app.depthImage = img
+	return nil
+}
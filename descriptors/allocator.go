@@ -0,0 +1,193 @@
+// Package descriptors allocates descriptor sets from pools it creates as
+// they're needed, so nothing has to know up front how many sets of which
+// types a chapter's shaders end up using.
+package descriptors
+
+import (
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DefaultSetsPerPool is how many sets the first pool holds when
+// NewAllocator isn't told. Every pool after it holds twice as many as the
+// last, up to maxSetsPerPool.
+const DefaultSetsPerPool = 16
+
+const maxSetsPerPool = 4096
+
+// Ratio is how many descriptors of a type a pool has room for per set.
+type Ratio struct {
+	Type   vk.DescriptorType
+	PerSet float32
+}
+
+// Ratios sizes pools for sets of bindings, each set getting room for every
+// descriptor bindings declare. Bindings spread over several sets are
+// counted as one set, which errs on the generous side. Sets with update
+// after bind bindings are left out, they need a pool of their own from
+// NewUpdateAfterBindPool.
+func Ratios(bindings []pipeline.StageBinding) []Ratio {
+	bindless := map[uint32]bool{}
+	for _, b := range bindings {
+		if b.Flags&pipeline.BindingUpdateAfterBind != 0 {
+			bindless[b.Set] = true
+		}
+	}
+
+	var ratios []Ratio
+	index := map[vk.DescriptorType]int{}
+	for _, b := range bindings {
+		if bindless[b.Set] {
+			continue
+		}
+		i, ok := index[b.Type]
+		if !ok {
+			i = len(ratios)
+			index[b.Type] = i
+			ratios = append(ratios, Ratio{Type: b.Type})
+		}
+		ratios[i].PerSet += float32(b.Count)
+	}
+	return ratios
+}
+
+// Allocator hands out descriptor sets, creating another pool whenever the
+// current one runs out. Reset gives every set back at once and keeps the
+// pools for reuse, which suits sets that only live for a frame. It isn't
+// safe to use from multiple goroutines.
+type Allocator struct {
+	device      vk.Device
+	ratios      []Ratio
+	setsPerPool uint32
+
+	current vk.DescriptorPool
+	// used are the pools sets have come from since the last Reset, current
+	// included, and free the ones ready to be used again.
+	used []vk.DescriptorPool
+	free []vk.DescriptorPool
+}
+
+// NewAllocator creates an allocator whose pools are sized by ratios,
+// starting at setsPerPool sets, zero using DefaultSetsPerPool.
+func NewAllocator(device vk.Device, ratios []Ratio, setsPerPool uint32) *Allocator {
+	if setsPerPool == 0 {
+		setsPerPool = DefaultSetsPerPool
+	}
+	return &Allocator{
+		device:      device,
+		ratios:      ratios,
+		setsPerPool: setsPerPool,
+	}
+}
+
+// Allocate allocates a set with layout.
+func (a *Allocator) Allocate(layout vk.DescriptorSetLayout) (vk.DescriptorSet, error) {
+	if a.current == vk.NullDescriptorPool {
+		if err := a.next(); err != nil {
+			return vk.NullDescriptorSet, err
+		}
+	}
+
+	set, result := a.allocate(layout)
+	if result == vk.ErrorOutOfPoolMemory || result == vk.ErrorFragmentedPool {
+		// The pool is full, move on to another one and try again there
+		if err := a.next(); err != nil {
+			return vk.NullDescriptorSet, err
+		}
+		set, result = a.allocate(layout)
+	}
+	if err := vk.Error(result); err != nil {
+		return vk.NullDescriptorSet, errors.Wrap(err, "can't allocate descriptor set")
+	}
+	return set, nil
+}
+
+// Reset frees every set allocated since the last Reset, none of them can
+// still be in use by the GPU.
+func (a *Allocator) Reset() error {
+	for _, pool := range a.used {
+		if err := vk.Error(vk.ResetDescriptorPool(a.device, pool, 0)); err != nil {
+			return errors.Wrap(err, "can't reset descriptor pool")
+		}
+	}
+	a.free = append(a.free, a.used...)
+	a.used = a.used[:0]
+	a.current = vk.NullDescriptorPool
+	return nil
+}
+
+// Destroy destroys every pool along with the sets allocated from them.
+func (a *Allocator) Destroy() {
+	for _, pools := range [][]vk.DescriptorPool{a.used, a.free} {
+		for _, pool := range pools {
+			vk.DestroyDescriptorPool(a.device, pool, nil)
+		}
+	}
+	a.used, a.free = nil, nil
+	a.current = vk.NullDescriptorPool
+}
+
+func (a *Allocator) allocate(layout vk.DescriptorSetLayout) (vk.DescriptorSet, vk.Result) {
+	allocInfo := &vk.DescriptorSetAllocateInfo{
+		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     a.current,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vk.DescriptorSetLayout{layout},
+	}
+	var set vk.DescriptorSet
+	result := vk.AllocateDescriptorSets(a.device, allocInfo, &set)
+	return set, result
+}
+
+// next makes a free pool current, creating one if there aren't any.
+func (a *Allocator) next() error {
+	if n := len(a.free); n > 0 {
+		a.current = a.free[n-1]
+		a.free = a.free[:n-1]
+	} else {
+		pool, err := a.create()
+		if err != nil {
+			return err
+		}
+		a.current = pool
+	}
+	a.used = append(a.used, a.current)
+	return nil
+}
+
+func (a *Allocator) create() (vk.DescriptorPool, error) {
+	sets := a.setsPerPool
+	if a.setsPerPool < maxSetsPerPool {
+		a.setsPerPool *= 2
+	}
+
+	return newPool(a.device, a.ratios, sets, 0)
+}
+
+func newPool(device vk.Device, ratios []Ratio, sets uint32, flags vk.DescriptorPoolCreateFlags) (vk.DescriptorPool, error) {
+	poolSizes := make([]vk.DescriptorPoolSize, 0, len(ratios))
+	for _, r := range ratios {
+		count := uint32(r.PerSet * float32(sets))
+		if count == 0 {
+			count = 1
+		}
+		poolSizes = append(poolSizes, vk.DescriptorPoolSize{
+			Type:            r.Type,
+			DescriptorCount: count,
+		})
+	}
+	poolInfo := &vk.DescriptorPoolCreateInfo{
+		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
+		Flags:         flags,
+		MaxSets:       sets,
+		PoolSizeCount: uint32(len(poolSizes)),
+		PPoolSizes:    poolSizes,
+	}
+
+	var pool vk.DescriptorPool
+	if err := vk.Error(vk.CreateDescriptorPool(device, poolInfo, nil, &pool)); err != nil {
+		return vk.NullDescriptorPool, errors.Wrapf(err, "can't create descriptor pool for %d sets", sets)
+	}
+	return pool, nil
+}
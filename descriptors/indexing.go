@@ -0,0 +1,105 @@
+package descriptors
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// IndexingExtensions are the device extensions bindless sets need on a
+// Vulkan 1.1 instance, VK_EXT_descriptor_indexing and what it depends on.
+var IndexingExtensions = []string{
+	"VK_EXT_descriptor_indexing",
+	"VK_KHR_maintenance3",
+}
+
+// structureTypeIndexingFeatures is
+// VkPhysicalDeviceDescriptorIndexingFeatures' type, the bindings predate
+// the extension.
+const structureTypeIndexingFeatures vk.StructureType = 1000161001
+
+// IndexingFeatures is laid out like
+// VkPhysicalDeviceDescriptorIndexingFeatures, to put on
+// vk.DeviceCreateInfo's PNext. It has to be kept alive until the device is
+// created.
+type IndexingFeatures struct {
+	sType                                              vk.StructureType
+	pNext                                              unsafe.Pointer
+	shaderInputAttachmentArrayDynamicIndexing          vk.Bool32
+	shaderUniformTexelBufferArrayDynamicIndexing       vk.Bool32
+	shaderStorageTexelBufferArrayDynamicIndexing       vk.Bool32
+	shaderUniformBufferArrayNonUniformIndexing         vk.Bool32
+	shaderSampledImageArrayNonUniformIndexing          vk.Bool32
+	shaderStorageBufferArrayNonUniformIndexing         vk.Bool32
+	shaderStorageImageArrayNonUniformIndexing          vk.Bool32
+	shaderInputAttachmentArrayNonUniformIndexing       vk.Bool32
+	shaderUniformTexelBufferArrayNonUniformIndexing    vk.Bool32
+	shaderStorageTexelBufferArrayNonUniformIndexing    vk.Bool32
+	descriptorBindingUniformBufferUpdateAfterBind      vk.Bool32
+	descriptorBindingSampledImageUpdateAfterBind       vk.Bool32
+	descriptorBindingStorageImageUpdateAfterBind       vk.Bool32
+	descriptorBindingStorageBufferUpdateAfterBind      vk.Bool32
+	descriptorBindingUniformTexelBufferUpdateAfterBind vk.Bool32
+	descriptorBindingStorageTexelBufferUpdateAfterBind vk.Bool32
+	descriptorBindingUpdateUnusedWhilePending          vk.Bool32
+	descriptorBindingPartiallyBound                    vk.Bool32
+	descriptorBindingVariableDescriptorCount           vk.Bool32
+	runtimeDescriptorArray                             vk.Bool32
+}
+
+// NewIndexingFeatures enables what pipeline.MakeBindless's tables of
+// sampled images need, chained in front of next.
+func NewIndexingFeatures(next unsafe.Pointer) *IndexingFeatures {
+	return &IndexingFeatures{
+		sType: structureTypeIndexingFeatures,
+		pNext: next,
+		descriptorBindingSampledImageUpdateAfterBind: vk.True,
+		descriptorBindingUpdateUnusedWhilePending:    vk.True,
+		descriptorBindingPartiallyBound:              vk.True,
+		runtimeDescriptorArray:                       vk.True,
+	}
+}
+
+// Pointer is the struct to chain.
+func (f *IndexingFeatures) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(f)
+}
+
+// IndexingSupported reports whether physicalDevice has what
+// NewIndexingFeatures enables, along with dynamically indexing arrays of
+// sampled images. Its extensions have to have been checked for
+// IndexingExtensions first.
+func IndexingSupported(physicalDevice vk.PhysicalDevice) bool {
+	f := &IndexingFeatures{sType: structureTypeIndexingFeatures}
+	features := vk.PhysicalDeviceFeatures2{
+		SType: vk.StructureTypePhysicalDeviceFeatures2,
+		PNext: f.Pointer(),
+	}
+	vk.GetPhysicalDeviceFeatures2(physicalDevice, &features)
+	runtime.KeepAlive(f)
+	features.Deref()
+	features.Features.Deref()
+	return features.Features.ShaderSampledImageArrayDynamicIndexing.B() &&
+		f.descriptorBindingSampledImageUpdateAfterBind.B() &&
+		f.descriptorBindingUpdateUnusedWhilePending.B() &&
+		f.descriptorBindingPartiallyBound.B() &&
+		f.runtimeDescriptorArray.B()
+}
+
+// NewUpdateAfterBindPool creates a pool for sets of set's bindings, which
+// Allocator's pools can't hold when they were made bindless.
+func NewUpdateAfterBindPool(device vk.Device, bindings []pipeline.StageBinding, set, sets uint32) (vk.DescriptorPool, error) {
+	var ratios []Ratio
+	for _, b := range bindings {
+		if b.Set == set {
+			ratios = append(ratios, Ratio{Type: b.Type, PerSet: float32(b.Count)})
+		}
+	}
+	if len(ratios) == 0 {
+		return vk.NullDescriptorPool, errors.Errorf("no bindings in set %d", set)
+	}
+	return newPool(device, ratios, sets, pipeline.PoolUpdateAfterBind)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// QueueInfo is a candidate device's queue families, passed to a DeviceScorer.
+type QueueInfo struct {
+	Families []vk.QueueFamilyProperties
+	// QueueFamilies are the indices into Families the application would use.
+	QueueFamilies
+}
+
+// DeviceScorer ranks a physical device that meets the application's
+// requirements, the highest score is picked and a negative one rejects the
+// device. properties and its Limits are already dereferenced.
+type DeviceScorer func(properties vk.PhysicalDeviceProperties, features vk.PhysicalDeviceFeatures, queues QueueInfo) int
+
+// DefaultDeviceScorer prefers discrete GPUs, then larger maximum texture sizes.
+func DefaultDeviceScorer(properties vk.PhysicalDeviceProperties, features vk.PhysicalDeviceFeatures, queues QueueInfo) int {
+	var score int
+
+	// Discrete GPUs have a significant performance advantage
+	if properties.DeviceType == vk.PhysicalDeviceTypeDiscreteGpu {
+		score += 1000
+	}
+
+	// Maximum possible size of textures affects graphics quality
+	score += int(properties.Limits.MaxImageDimension2D)
+
+	return score
+}
+
+// queueFamilyProperties returns the device's queue families, dereferenced.
+func queueFamilyProperties(device vk.PhysicalDevice) []vk.QueueFamilyProperties {
+	var count uint32
+	vk.GetPhysicalDeviceQueueFamilyProperties(device, &count, nil)
+	families := make([]vk.QueueFamilyProperties, count)
+	vk.GetPhysicalDeviceQueueFamilyProperties(device, &count, families)
+	for i := range families {
+		families[i].Deref()
+	}
+	return families
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sort"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// materialDraw is one of an object's mesh groups, drawn with its
+// material's descriptor set and pipeline variant.
+type materialDraw struct {
+	// object indexes the draw list and the uniform buffer's objects.
+	object   int
+	group    int
+	material int
+	variant  PipelineVariant
+}
+
+// sortDraws expands the current window's draw list into a draw per object
+// and mesh group, sorted by pipeline variant and then material so that
+// each is bound as few times as possible. Within a material objects keep
+// the draw list's order.
+func (app *HelloTriangleApplication) sortDraws() {
+	draws := app.materialDraws[:0]
+	for i := range app.drawList.Draws {
+		for g, group := range app.mesh.Groups {
+			draws = append(draws, materialDraw{
+				object:   i,
+				group:    g,
+				material: group.Material,
+				variant:  app.materials[group.Material].Variant(),
+			})
+		}
+	}
+	sort.SliceStable(draws, func(i, j int) bool {
+		if draws[i].variant != draws[j].variant {
+			return draws[i].variant < draws[j].variant
+		}
+		return draws[i].material < draws[j].material
+	})
+	app.materialDraws = draws
+}
+
+// graphicsPipeline is the current window's graphics pipeline for variant in
+// the current polygon mode.
+func (app *HelloTriangleApplication) graphicsPipeline(variant PipelineVariant) vk.Pipeline {
+	return app.graphicsPipelines[int(variant)*len(app.polygonModes())+app.polygonMode]
+}
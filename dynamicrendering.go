@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/rendering"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// wantsDynamicRendering is whether the scene would be drawn with dynamic
+// rendering on a device that has it. Deferred's lighting reads the G-buffer
+// as input attachments of an earlier subpass, which dynamic rendering
+// doesn't have.
+func (app *HelloTriangleApplication) wantsDynamicRendering() bool {
+	return !app.RenderPasses && !app.Deferred
+}
+
+// instanceAPIVersion is the Vulkan version to create the instance for, 1.3
+// when the loader has it so devices can draw with core dynamic rendering,
+// otherwise 1.1.
+func (app *HelloTriangleApplication) instanceAPIVersion() uint32 {
+	if rendering.LoaderVersion(app.getInstanceProcAddr) >= rendering.APIVersion13 {
+		return rendering.APIVersion13
+	}
+	return vk.ApiVersion11
+}
+
+// coreRenderingSupported is whether physicalDevice has Vulkan 1.3's dynamic
+// rendering, which takes both it and the instance being 1.3. Older devices
+// fall back to VK_KHR_dynamic_rendering.
+func (app *HelloTriangleApplication) coreRenderingSupported(physicalDevice vk.PhysicalDevice) bool {
+	if app.apiVersion < rendering.APIVersion13 {
+		return false
+	}
+	if app.vulkan().PhysicalDeviceProperties(physicalDevice).ApiVersion < rendering.APIVersion13 {
+		return false
+	}
+	return rendering.CoreSupported(physicalDevice)
+}
+
+// loadDynamicRendering loads the dynamic rendering entry points when the
+// device was created with them, core ones on a Vulkan 1.3 device.
+func (app *HelloTriangleApplication) loadDynamicRendering() error {
+	if !app.dynamicRendering {
+		reason := "no Vulkan 1.3 or " + rendering.Extension
+		switch {
+		case app.RenderPasses:
+			reason = "render passes requested"
+		case app.Deferred:
+			reason = "deferred shading uses subpasses"
+		}
+		app.logger.Info("Drawing the scene with render passes", logging.F("reason", reason))
+		return nil
+	}
+
+	r, err := rendering.Load(app.getInstanceProcAddr, app.instance, app.device, app.coreRendering)
+	if err != nil {
+		return err
+	}
+	app.dynamicRenderer = r
+	from := rendering.Extension
+	if app.coreRendering {
+		from = "Vulkan 1.3"
+	}
+	app.logger.Info("Drawing the scene with dynamic rendering", logging.F("from", from))
+	return nil
+}
+
+// createSceneRendering describes the current window's scene attachments to
+// its pipelines and secondary command buffers, what createRenderPass and
+// createFramebuffers otherwise create objects for. Only the formats and
+// sample count matter, so nothing has to be recreated when the swapchain
+// is resized.
+func (app *HelloTriangleApplication) createSceneRendering() {
+	format, _ := app.sceneTarget()
+	colors := []vk.Format{format}
+	app.sceneRendering = rendering.NewPipelineInfo(colors, app.depthFormat)
+	app.sceneInheritance = rendering.NewInheritanceInfo(colors, app.depthFormat, app.msaaSamples)
+}
+
+// cmdBeginSceneRendering begins drawing the scene into the target image at
+// imageIndex, or the scene image with bloom, cleared to clearValues in
+// createRenderPass's attachment order. Without a render pass the layout
+// transitions its attachments and dependency made are recorded here.
+func (app *HelloTriangleApplication) cmdBeginSceneRendering(cb vk.CommandBuffer, imageIndex uint32, clearValues []vk.ClearValue, secondaries bool) {
+	if !app.bloomEnabled() {
+		// Waits on the acquire semaphore's stage like the render pass's
+		// external dependency, the previous contents are discarded
+		cmdTargetBarrier(cb, app.target.Images[imageIndex],
+			vk.ImageLayoutUndefined, vk.ImageLayoutColorAttachmentOptimal,
+			0, vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+			vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+			vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit))
+	}
+	// Always barriered, the previous frame's depth tests have to finish
+	// before this one's clear
+	app.depthImage.CmdBarrierTo(cb, vk.ImageLayoutDepthStencilAttachmentOptimal)
+
+	view := app.sceneView(app.imageViews[imageIndex])
+	color := rendering.Attachment{
+		View:    view,
+		Layout:  vk.ImageLayoutColorAttachmentOptimal,
+		LoadOp:  vk.AttachmentLoadOpClear,
+		StoreOp: vk.AttachmentStoreOpStore,
+		Clear:   clearValues[0],
+	}
+	if app.multisampled() {
+		app.colorImage.CmdBarrierTo(cb, vk.ImageLayoutColorAttachmentOptimal)
+		color.View = app.colorImage.View
+		color.StoreOp = vk.AttachmentStoreOpDontCare
+		color.ResolveView = view
+		color.ResolveLayout = vk.ImageLayoutColorAttachmentOptimal
+	}
+	depth := rendering.Attachment{
+		View:    app.depthImage.View,
+		Layout:  vk.ImageLayoutDepthStencilAttachmentOptimal,
+		LoadOp:  vk.AttachmentLoadOpClear,
+		StoreOp: vk.AttachmentStoreOpDontCare,
+		Clear:   clearValues[len(clearValues)-1],
+	}
+	app.dynamicRenderer.CmdBeginRendering(cb, app.target.Extent, []rendering.Attachment{color}, &depth, secondaries)
+}
+
+// cmdEndSceneRendering ends the scene's rendering and moves the target
+// image to its final layout, which the render pass did. With bloom the
+// scene image is left as a color attachment for the post-process chain.
+func (app *HelloTriangleApplication) cmdEndSceneRendering(cb vk.CommandBuffer, imageIndex uint32) {
+	app.dynamicRenderer.CmdEndRendering(cb)
+	if app.bloomEnabled() {
+		return
+	}
+	// The overlays' render passes load the target and the headless copy
+	// reads it, both wait on the stages here
+	cmdTargetBarrier(cb, app.target.Images[imageIndex],
+		vk.ImageLayoutColorAttachmentOptimal, app.target.FinalLayout,
+		vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+		vk.AccessFlags(vk.AccessColorAttachmentReadBit|vk.AccessColorAttachmentWriteBit|vk.AccessTransferReadBit),
+		vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit|vk.PipelineStageTransferBit))
+}
@@ -0,0 +1,193 @@
+// Package ecs is a minimal entity component system for building demo scenes
+// out of data rather than code in the frame loop. Entities are ids,
+// components are plain structs stored per type, and systems run over them
+// in the order they were added every Tick. SceneSync turns the entities
+// into a scene graph for drawing.
+package ecs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// Entity identifies a thing in the world, zero is never one.
+type Entity uint32
+
+// Transform places an entity, relative to its Parent if it has one.
+type Transform struct {
+	scene.Transform
+	// Parent is the entity this one moves with, zero is none. A parent
+	// without a Transform, or that's been destroyed, counts as none.
+	Parent Entity
+}
+
+// At is a Transform at translation, unrotated and unscaled.
+func At(translation vmath.Vec3) Transform {
+	t := Transform{Transform: scene.Identity()}
+	t.Translation = translation
+	return t
+}
+
+// MeshRenderer draws one of the renderer's meshes at its entity's
+// Transform.
+type MeshRenderer = scene.Mesh
+
+// Light lights the scene from its entity's Transform.
+type Light = scene.Light
+
+// Camera views the scene from its entity's Transform.
+type Camera = scene.Camera
+
+// Script is behaviour run every Tick by the Scripts system.
+type Script struct {
+	Update func(w *World, e Entity, dt float32)
+}
+
+// System updates the world every Tick, dt seconds after the last one.
+type System interface {
+	Update(w *World, dt float32)
+}
+
+// SystemFunc is a function as a System.
+type SystemFunc func(w *World, dt float32)
+
+// Update calls f.
+func (f SystemFunc) Update(w *World, dt float32) {
+	f(w, dt)
+}
+
+// World holds entities, their components and the systems run over them.
+// It isn't safe for concurrent use.
+type World struct {
+	last       Entity
+	alive      map[Entity]bool
+	transforms map[Entity]*Transform
+	meshes     map[Entity]*MeshRenderer
+	lights     map[Entity]*Light
+	cameras    map[Entity]*Camera
+	scripts    map[Entity]*Script
+	systems    []System
+}
+
+// New returns an empty world without systems.
+func New() *World {
+	return &World{
+		alive:      map[Entity]bool{},
+		transforms: map[Entity]*Transform{},
+		meshes:     map[Entity]*MeshRenderer{},
+		lights:     map[Entity]*Light{},
+		cameras:    map[Entity]*Camera{},
+		scripts:    map[Entity]*Script{},
+	}
+}
+
+// Spawn creates an entity with components, see Set.
+func (w *World) Spawn(components ...interface{}) Entity {
+	w.last++
+	e := w.last
+	w.alive[e] = true
+	for _, c := range components {
+		w.Set(e, c)
+	}
+	return e
+}
+
+// Set gives e a copy of component, a Transform, MeshRenderer, Light,
+// Camera or Script, replacing any it had of that type. It panics on any
+// other type, which is a mistake in the scene rather than something to
+// handle.
+func (w *World) Set(e Entity, component interface{}) {
+	switch c := component.(type) {
+	case Transform:
+		w.transforms[e] = &c
+	case MeshRenderer:
+		w.meshes[e] = &c
+	case Light:
+		w.lights[e] = &c
+	case Camera:
+		w.cameras[e] = &c
+	case Script:
+		w.scripts[e] = &c
+	default:
+		panic(fmt.Sprintf("ecs: %T isn't a component", component))
+	}
+}
+
+// Destroy removes e and its components.
+func (w *World) Destroy(e Entity) {
+	delete(w.alive, e)
+	delete(w.transforms, e)
+	delete(w.meshes, e)
+	delete(w.lights, e)
+	delete(w.cameras, e)
+	delete(w.scripts, e)
+}
+
+// Alive reports whether e has been spawned and not destroyed.
+func (w *World) Alive(e Entity) bool {
+	return w.alive[e]
+}
+
+// Entities are the live entities, oldest first.
+func (w *World) Entities() []Entity {
+	entities := make([]Entity, 0, len(w.alive))
+	for e := range w.alive {
+		entities = append(entities, e)
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i] < entities[j] })
+	return entities
+}
+
+// Transform is e's Transform, nil if it has none. Changing it changes the
+// entity.
+func (w *World) Transform(e Entity) *Transform {
+	return w.transforms[e]
+}
+
+// MeshRenderer is e's MeshRenderer, nil if it has none.
+func (w *World) MeshRenderer(e Entity) *MeshRenderer {
+	return w.meshes[e]
+}
+
+// Light is e's Light, nil if it has none.
+func (w *World) Light(e Entity) *Light {
+	return w.lights[e]
+}
+
+// Camera is e's Camera, nil if it has none.
+func (w *World) Camera(e Entity) *Camera {
+	return w.cameras[e]
+}
+
+// Script is e's Script, nil if it has none.
+func (w *World) Script(e Entity) *Script {
+	return w.scripts[e]
+}
+
+// AddSystem runs s every Tick, after the systems added before it.
+func (w *World) AddSystem(s System) {
+	w.systems = append(w.systems, s)
+}
+
+// Tick runs every system, dt seconds after the last Tick.
+func (w *World) Tick(dt float32) {
+	for _, s := range w.systems {
+		s.Update(w, dt)
+	}
+}
+
+// Scripts is the system running every entity's Script, oldest entity
+// first. Scripts can spawn and destroy entities, those spawned run from the
+// next Tick.
+func Scripts() System {
+	return SystemFunc(func(w *World, dt float32) {
+		for _, e := range w.Entities() {
+			if s := w.scripts[e]; s != nil && s.Update != nil && w.alive[e] {
+				s.Update(w, e, dt)
+			}
+		}
+	})
+}
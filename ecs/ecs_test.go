@@ -0,0 +1,149 @@
+package ecs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+func TestSpawnAndDestroy(t *testing.T) {
+	w := New()
+	a := w.Spawn(At(vmath.Vec3{1, 2, 3}), MeshRenderer{Index: 2})
+	b := w.Spawn(Light{Intensity: 4})
+	if a == 0 || a == b {
+		t.Fatalf("entities %d and %d, want distinct non-zero ids", a, b)
+	}
+	if tr := w.Transform(a); tr == nil || tr.Translation != (vmath.Vec3{1, 2, 3}) || tr.Scale != (vmath.Vec3{1, 1, 1}) {
+		t.Errorf("Transform(a) = %v", tr)
+	}
+	if m := w.MeshRenderer(a); m == nil || m.Index != 2 {
+		t.Errorf("MeshRenderer(a) = %v", m)
+	}
+	if w.Light(a) != nil || w.Light(b) == nil || w.Light(b).Intensity != 4 {
+		t.Errorf("Light(a) = %v, Light(b) = %v", w.Light(a), w.Light(b))
+	}
+
+	w.Transform(a).Translation[0] = 5
+	if got := w.Transform(a).Translation[0]; got != 5 {
+		t.Errorf("changing the Transform didn't stick, x = %v", got)
+	}
+
+	w.Destroy(a)
+	if w.Alive(a) || w.Transform(a) != nil || w.MeshRenderer(a) != nil {
+		t.Errorf("a still has components after Destroy")
+	}
+	if got := w.Entities(); !reflect.DeepEqual(got, []Entity{b}) {
+		t.Errorf("Entities = %v, want [%d]", got, b)
+	}
+}
+
+func TestSetPanicsOnUnknownComponents(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Set with a string didn't panic")
+		}
+	}()
+	New().Spawn("not a component")
+}
+
+func TestTick(t *testing.T) {
+	w := New()
+	var order []string
+	var seen []Entity
+	var total float32
+	script := Script{Update: func(w *World, e Entity, dt float32) {
+		seen = append(seen, e)
+		total += dt
+		// Spawned entities only run from the next Tick
+		if len(seen) == 1 {
+			w.Spawn(Script{Update: func(*World, Entity, float32) { order = append(order, "spawned") }})
+		}
+	}}
+	a, b := w.Spawn(script), w.Spawn(script)
+	w.AddSystem(SystemFunc(func(*World, float32) { order = append(order, "first") }))
+	w.AddSystem(Scripts())
+	w.AddSystem(SystemFunc(func(*World, float32) { order = append(order, "last") }))
+
+	w.Tick(0.5)
+	if want := []string{"first", "last"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("systems ran %v, want %v", order, want)
+	}
+	if want := []Entity{a, b}; !reflect.DeepEqual(seen, want) || total != 1 {
+		t.Errorf("scripts ran for %v with %v seconds in all, want %v with 1", seen, total, want)
+	}
+
+	order = nil
+	w.Tick(0.5)
+	if want := []string{"first", "spawned", "last"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("second tick ran %v, want %v", order, want)
+	}
+}
+
+func TestSceneSync(t *testing.T) {
+	w := New()
+	root := scene.New("root")
+	sync := NewSceneSync(root)
+	w.AddSystem(sync)
+
+	// The child is spawned before its parent
+	child := w.Spawn(At(vmath.Vec3{0, 1, 0}), MeshRenderer{Index: 1})
+	parent := w.Spawn(At(vmath.Vec3{2, 0, 0}), Camera{FovY: 1})
+	w.Transform(child).Parent = parent
+	w.Spawn(MeshRenderer{})
+	w.Tick(0)
+
+	if n := len(root.Children()); n != 1 || root.Children()[0] != sync.Node(parent) {
+		t.Fatalf("root has %d children, want just the parent", n)
+	}
+	if c := sync.Node(child); c == nil || c.Parent() != sync.Node(parent) {
+		t.Fatalf("child isn't under its parent")
+	}
+
+	var l scene.DrawList
+	l.Collect(root)
+	if len(l.Draws) != 1 || l.Draws[0].Mesh.Index != 1 {
+		t.Fatalf("Draws = %v, want the child's mesh", l.Draws)
+	}
+	if got := l.Draws[0].World; got[12] != 2 || got[13] != 1 {
+		t.Errorf("child's world translation = %v, want 2, 1, 0", got[12:15])
+	}
+	if len(l.Cameras) != 1 {
+		t.Errorf("Cameras = %v, want the parent's", l.Cameras)
+	}
+
+	// Changing a component shows up after the next Tick
+	w.MeshRenderer(child).Index = 3
+	w.Transform(child).Translation = vmath.Vec3{0, 0, 4}
+	w.Tick(0)
+	l.Collect(root)
+	if len(l.Draws) != 1 || l.Draws[0].Mesh.Index != 3 || l.Draws[0].World[14] != 4 {
+		t.Errorf("Draws after changing the child = %v", l.Draws)
+	}
+
+	// Destroying the parent leaves the child at the root
+	w.Destroy(parent)
+	w.Tick(0)
+	if sync.Node(parent) != nil {
+		t.Errorf("destroyed entity still has a node")
+	}
+	if c := sync.Node(child); c.Parent() != root || len(root.Children()) != 1 {
+		t.Errorf("child wasn't moved to the root")
+	}
+}
+
+func TestSceneSyncCycle(t *testing.T) {
+	w := New()
+	root := scene.New("root")
+	sync := NewSceneSync(root)
+	w.AddSystem(sync)
+	a := w.Spawn(At(vmath.Vec3{}))
+	b := w.Spawn(At(vmath.Vec3{}))
+	w.Transform(a).Parent = b
+	w.Transform(b).Parent = a
+	w.Tick(0)
+	if sync.Node(a).Parent() != sync.Node(b) || sync.Node(b).Parent() != root {
+		t.Errorf("a cycle wasn't broken at the root")
+	}
+}
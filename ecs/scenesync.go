@@ -0,0 +1,77 @@
+package ecs
+
+import (
+	"fmt"
+
+	"github.com/delaneyj/learnvulkan/scene"
+)
+
+// SceneSync is the system keeping a scene graph in step with the world,
+// with a node for every entity that has a Transform. Its mesh, light and
+// camera are the entity's components themselves, so changes to them show
+// without waiting for a Tick.
+type SceneSync struct {
+	root  *scene.Node
+	nodes map[Entity]*scene.Node
+}
+
+// NewSceneSync keeps the world's entities under root, which it should have
+// to itself.
+func NewSceneSync(root *scene.Node) *SceneSync {
+	return &SceneSync{root: root, nodes: map[Entity]*scene.Node{}}
+}
+
+// Node is e's node, nil until the first Update after it got a Transform.
+func (s *SceneSync) Node(e Entity) *scene.Node {
+	return s.nodes[e]
+}
+
+// Update adds, moves and removes nodes to match the world.
+func (s *SceneSync) Update(w *World, dt float32) {
+	for e, n := range s.nodes {
+		if w.transforms[e] == nil {
+			if p := n.Parent(); p != nil {
+				p.Remove(n)
+			}
+			delete(s.nodes, e)
+		}
+	}
+
+	// Nodes are made first so parents spawned after their children exist
+	entities := w.Entities()
+	for _, e := range entities {
+		if w.transforms[e] != nil && s.nodes[e] == nil {
+			s.nodes[e] = scene.New(fmt.Sprintf("entity %d", e))
+		}
+	}
+	for _, e := range entities {
+		t := w.transforms[e]
+		if t == nil {
+			continue
+		}
+		n := s.nodes[e]
+		n.Local = t.Transform
+		n.Mesh = w.meshes[e]
+		n.Light = w.lights[e]
+		n.Camera = w.cameras[e]
+
+		parent := s.root
+		// A parent under its own child would make a cycle
+		if p := s.nodes[t.Parent]; p != nil && !within(p, n) {
+			parent = p
+		}
+		if n.Parent() != parent {
+			parent.Add(n)
+		}
+	}
+}
+
+// within reports whether node is n or somewhere under it.
+func within(node, n *scene.Node) bool {
+	for a := node; a != nil; a = a.Parent() {
+		if a == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/interop"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// exportFormat is what the primary window's frames are exported in,
+// GL_SRGB8_ALPHA8 to OpenGL, which has no BGRA memory object formats. The
+// blit into it swizzles.
+const exportFormat = vk.FormatR8g8b8a8Srgb
+
+// ExportConfig shares the primary window's frames with another API, like
+// an OpenGL application, through external memory.
+type ExportConfig struct {
+	// Width and Height are the shared image's size, zero is the primary
+	// window's at startup. Frames are scaled to fit.
+	Width, Height uint32
+	// Handoff receives the shared image's and semaphores' handles once,
+	// after they're created, and owns them from then on.
+	Handoff func(ExportedImage) error
+}
+
+// ExportedImage is what an importer needs to read the primary window's
+// frames. Every frame is copied in after waiting on Released, except the
+// first, then Ready is signaled, so the importer has to wait on Ready,
+// read the image and signal Released in turn.
+type ExportedImage struct {
+	// Memory is the image's dedicated memory, Size bytes of it, what
+	// glImportMemoryFdEXT or glImportMemoryWin32HandleEXT take.
+	Memory        interop.Handle
+	Size          uint64
+	Width, Height uint32
+	Format        vk.Format
+	// Layout is the layout frames are left in, GL_LAYOUT_SHADER_READ_ONLY_EXT
+	// on the OpenGL side.
+	Layout   vk.ImageLayout
+	Ready    interop.Handle
+	Released interop.Handle
+}
+
+// wantsExport is whether the device should have interop.Extensions.
+func (app *HelloTriangleApplication) wantsExport() bool {
+	return app.Export != nil && !app.Headless
+}
+
+// loadInterop loads the entry points exporting memory and semaphores
+// when frames are exported or particles produced outside, logging why not
+// when they were asked for.
+func (app *HelloTriangleApplication) loadInterop() error {
+	if app.Export != nil && !app.exporting {
+		reason := "no device support"
+		if app.Headless {
+			reason = "headless rendering draws a single frame"
+		}
+		app.logger.Info("Not exporting frames", logging.F("reason", reason))
+	}
+	app.reportExternalParticles()
+	if !app.exporting && !app.externalParticles {
+		return nil
+	}
+
+	d, err := interop.Load(app.getInstanceProcAddr, app.instance, app.device)
+	if err != nil {
+		return err
+	}
+	app.exporter = d
+	return nil
+}
+
+// createExport creates the shared image and semaphores and hands their
+// handles over.
+func (app *HelloTriangleApplication) createExport() error {
+	if !app.exporting {
+		return nil
+	}
+
+	width, height := app.Export.Width, app.Export.Height
+	if width == 0 || height == 0 {
+		width, height = app.target.Extent.Width, app.target.Extent.Height
+	}
+	img, err := app.exporter.NewImage(app.allocator, interop.ImageInfo{
+		Width:  width,
+		Height: height,
+		Format: exportFormat,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
+	})
+	if err != nil {
+		return err
+	}
+	app.exportImage = img
+	app.name(img.Handle, "exported image")
+
+	if app.exportReady, err = app.exporter.NewSemaphore(); err != nil {
+		return errors.Wrap(err, "can't create ready semaphore")
+	}
+	if app.exportReleased, err = app.exporter.NewSemaphore(); err != nil {
+		return errors.Wrap(err, "can't create released semaphore")
+	}
+
+	exported := ExportedImage{
+		Size:   uint64(img.Allocation.Size),
+		Width:  width,
+		Height: height,
+		Format: exportFormat,
+		Layout: vk.ImageLayoutShaderReadOnlyOptimal,
+	}
+	if exported.Memory, err = app.exporter.ExportMemory(img.Allocation); err != nil {
+		return err
+	}
+	if exported.Ready, err = app.exporter.ExportSemaphore(app.exportReady); err != nil {
+		return err
+	}
+	if exported.Released, err = app.exporter.ExportSemaphore(app.exportReleased); err != nil {
+		return err
+	}
+	if app.Export.Handoff != nil {
+		if err := app.Export.Handoff(exported); err != nil {
+			return errors.Wrap(err, "can't hand off exported image")
+		}
+	}
+	app.logger.Info("Exporting frames",
+		logging.F("width", width),
+		logging.F("height", height),
+		logging.F("bytes", exported.Size),
+	)
+	return nil
+}
+
+// recordExport copies the primary window's finished frame into the shared
+// image and leaves it ready to be sampled.
+func (app *HelloTriangleApplication) recordExport(cb vk.CommandBuffer, imageIndex uint32) {
+	if app.exportImage == nil || app.appWindow != app.windows[0] {
+		return
+	}
+	scope := app.profiler.Begin(cb, "export")
+	defer scope.End(cb)
+
+	img := app.exportImage
+	target := app.target.Images[imageIndex]
+	cmdTargetBarrier(cb, target, app.target.FinalLayout, vk.ImageLayoutTransferSrcOptimal,
+		vk.AccessFlags(vk.AccessColorAttachmentWriteBit), vk.AccessFlags(vk.AccessTransferReadBit),
+		vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit))
+	// The importer's reads are ordered by the Released semaphore, whatever
+	// was there is overwritten
+	cmdTargetBarrier(cb, img.Handle, vk.ImageLayoutUndefined, vk.ImageLayoutTransferDstOptimal,
+		0, vk.AccessFlags(vk.AccessTransferWriteBit),
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit))
+
+	src := vk.Offset3D{X: int32(app.target.Extent.Width), Y: int32(app.target.Extent.Height), Z: 1}
+	dst := vk.Offset3D{X: int32(img.Width), Y: int32(img.Height), Z: 1}
+	filter := vk.FilterNearest
+	if src != dst {
+		filter = vk.FilterLinear
+	}
+	vk.CmdBlitImage(cb, target, vk.ImageLayoutTransferSrcOptimal, img.Handle, vk.ImageLayoutTransferDstOptimal,
+		1, []vk.ImageBlit{{
+			SrcSubresource: vk.ImageSubresourceLayers{
+				AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+				LayerCount: 1,
+			},
+			SrcOffsets: [2]vk.Offset3D{{}, src},
+			DstSubresource: vk.ImageSubresourceLayers{
+				AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+				LayerCount: 1,
+			},
+			DstOffsets: [2]vk.Offset3D{{}, dst},
+		}}, filter)
+
+	cmdTargetBarrier(cb, img.Handle, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutShaderReadOnlyOptimal,
+		vk.AccessFlags(vk.AccessTransferWriteBit), 0,
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit))
+	img.Layout = vk.ImageLayoutShaderReadOnlyOptimal
+	cmdTargetBarrier(cb, target, vk.ImageLayoutTransferSrcOptimal, app.target.FinalLayout,
+		vk.AccessFlags(vk.AccessTransferReadBit), 0,
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit))
+	app.exportRecorded = true
+}
+
+// exportSemaphores are what the frame's submit waits on and signals for
+// the copy recordExport recorded, null when it didn't record one. Every
+// frame but the first waits for the importer to release the previous one.
+func (app *HelloTriangleApplication) exportSemaphores() (wait, signal vk.Semaphore) {
+	if !app.exportRecorded {
+		return vk.NullSemaphore, vk.NullSemaphore
+	}
+	app.exportRecorded = false
+	if app.exportPending {
+		wait = app.exportReleased
+	}
+	app.exportPending = true
+	return wait, app.exportReady
+}
+
+func (app *HelloTriangleApplication) destroyExport() {
+	if app.exportReady != vk.NullSemaphore {
+		vk.DestroySemaphore(app.device, app.exportReady, nil)
+		app.exportReady = vk.NullSemaphore
+	}
+	if app.exportReleased != vk.NullSemaphore {
+		vk.DestroySemaphore(app.device, app.exportReleased, nil)
+		app.exportReleased = vk.NullSemaphore
+	}
+	if app.exportImage != nil {
+		app.exportImage.Destroy()
+		app.exportImage = nil
+	}
+}
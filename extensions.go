@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/interop"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/meshshader"
+	"github.com/delaneyj/learnvulkan/raytracing"
+	"github.com/delaneyj/learnvulkan/rendering"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// availableDeviceExtensions returns the names of every extension device
+// supports.
+func availableDeviceExtensions(api Vulkan, device vk.PhysicalDevice) (map[string]bool, error) {
+	extensions, err := api.DeviceExtensions(device)
+	if err != nil {
+		return nil, err
+	}
+	return extensionNames(extensions), nil
+}
+
+// requiredDeviceExtensions are the application's own required extensions
+// followed by the caller's. Headless rendering doesn't present so it doesn't
+// need the application's.
+func (app *HelloTriangleApplication) requiredDeviceExtensions() []string {
+	var required []string
+	if !app.Headless {
+		required = append(required, deviceExtensionNames...)
+	}
+	required = append(required, app.xrDeviceExtensions...)
+	return append(required, app.RequiredDeviceExtensions...)
+}
+
+// optionalDeviceExtensions are the application's own optional extensions
+// followed by the caller's.
+func (app *HelloTriangleApplication) optionalDeviceExtensions() []string {
+	optional := append([]string(nil), optionalDeviceExtensionNames...)
+	if app.RayTracing {
+		optional = append(optional, raytracing.Extensions...)
+	}
+	if app.MeshShaders {
+		optional = append(optional, meshshader.Extensions...)
+	}
+	if app.wantsBindless() {
+		optional = append(optional, descriptors.IndexingExtensions...)
+	}
+	if app.wantsDynamicRendering() {
+		optional = append(optional, rendering.Extensions...)
+	}
+	if app.wantsExport() || app.wantsExternalParticles() {
+		optional = append(optional, interop.Extensions...)
+	}
+	if app.wantsExternalParticles() {
+		optional = append(optional, interop.TimelineExtensions...)
+	}
+	return append(optional, app.OptionalDeviceExtensions...)
+}
+
+// missingExtensions returns the comma separated names in wanted that aren't
+// available, empty when they all are.
+func missingExtensions(wanted []string, available map[string]bool) string {
+	var missing []string
+	for _, name := range wanted {
+		if !available[name] {
+			missing = append(missing, name)
+		}
+	}
+	return strings.Join(missing, ",")
+}
+
+// selectDeviceExtensions decides which extensions the logical device is
+// created with, every required one plus the optional ones available.
+func (app *HelloTriangleApplication) selectDeviceExtensions(available map[string]bool) {
+	app.deviceExtensions = map[string]bool{}
+	for _, name := range app.requiredDeviceExtensions() {
+		app.deviceExtensions[name] = true
+	}
+	for _, name := range app.optionalDeviceExtensions() {
+		app.deviceExtensions[name] = available[name]
+	}
+	if missing := missingExtensions(app.optionalDeviceExtensions(), available); missing != "" {
+		app.logger.Info("Optional device extensions unavailable", logging.F("extensions", missing))
+	}
+}
+
+// hasDeviceExtension reports whether name was enabled on the logical device,
+// for gating features that depend on optional extensions.
+func (app *HelloTriangleApplication) hasDeviceExtension(name string) bool {
+	return app.deviceExtensions[name]
+}
+
+// enabledDeviceExtensions lists the extensions to enable on the device.
+func (app *HelloTriangleApplication) enabledDeviceExtensions() []string {
+	var enabled []string
+	for _, name := range append(app.requiredDeviceExtensions(), app.optionalDeviceExtensions()...) {
+		if app.deviceExtensions[name] && !contains(enabled, name) {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
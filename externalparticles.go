@@ -0,0 +1,141 @@
+package main
+
+import (
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/interop"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// ExternalParticlesConfig has another API, like a CUDA kernel, produce the
+// particles every frame in place of particles.comp.
+type ExternalParticlesConfig struct {
+	// Handoff receives the particle buffer's and timeline semaphore's
+	// handles once, after they're created, and owns them from then on.
+	Handoff func(ExternalParticles) error
+}
+
+// ExternalParticles is what a producer needs to write the particles. CUDA
+// imports Memory with cudaImportExternalMemory and maps it with
+// cudaExternalMemoryGetMappedBuffer, and Timeline with
+// cudaImportExternalSemaphore.
+type ExternalParticles struct {
+	// Memory is the buffer's dedicated memory, Size bytes of it, holding
+	// Count Particles from offset 0.
+	Memory interop.Handle
+	Size   uint64
+	Count  int
+	// Timeline is a timeline semaphore starting at 0. Frame n's particles
+	// are drawn once it reaches 2n+1, then it's signaled to 2n+2, so the
+	// producer waits for 2n, writes frame n and signals 2n+1.
+	Timeline interop.Handle
+}
+
+// wantsExternalParticles is whether the device should have interop's
+// extensions and timeline semaphores for ExternalParticles.
+func (app *HelloTriangleApplication) wantsExternalParticles() bool {
+	return app.ExternalParticles != nil && app.particlesEnabled() && !app.Headless
+}
+
+// externalParticlesSupported reports whether physicalDevice, with
+// available extensions, can share the particles.
+func externalParticlesSupported(physicalDevice vk.PhysicalDevice, available map[string]bool) bool {
+	return missingExtensions(interop.Extensions, available) == "" &&
+		missingExtensions(interop.TimelineExtensions, available) == "" &&
+		interop.TimelineSupported(physicalDevice)
+}
+
+// reportExternalParticles logs why particles asked to be produced outside
+// aren't.
+func (app *HelloTriangleApplication) reportExternalParticles() {
+	if app.ExternalParticles == nil || app.externalParticles {
+		return
+	}
+	reason := "no device support for exporting memory and timeline semaphores"
+	switch {
+	case !app.particlesEnabled():
+		reason = "there are no particles"
+	case app.Headless:
+		reason = "headless rendering draws a single frame"
+	}
+	app.logger.Info("Simulating particles in particles.comp", logging.F("reason", reason))
+}
+
+// createExternalParticles creates the buffer the particles are produced
+// into and the timeline semaphore the producer and the draws take turns
+// on, then hands their handles over. The buffer's contents are undefined
+// until the producer first signals.
+func (app *HelloTriangleApplication) createExternalParticles() error {
+	if !app.externalParticles {
+		return nil
+	}
+
+	size := vk.DeviceSize(app.Particles) * vk.DeviceSize(unsafe.Sizeof(Particle{}))
+	b, err := app.exporter.NewBuffer(app.allocator, size, vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit|vk.BufferUsageStorageBufferBit))
+	if err != nil {
+		return err
+	}
+	app.particleSource = b
+	app.name(b.Handle, "external particles")
+
+	if app.particleTimeline, err = app.exporter.NewTimelineSemaphore(0); err != nil {
+		return errors.Wrap(err, "can't create particle timeline")
+	}
+	app.name(app.particleTimeline, "particle timeline")
+
+	shared := ExternalParticles{
+		Size:  uint64(b.Allocation.Size),
+		Count: app.Particles,
+	}
+	if shared.Memory, err = app.exporter.ExportMemory(b.Allocation); err != nil {
+		return err
+	}
+	if shared.Timeline, err = app.exporter.ExportSemaphore(app.particleTimeline); err != nil {
+		return err
+	}
+	if app.ExternalParticles.Handoff != nil {
+		if err := app.ExternalParticles.Handoff(shared); err != nil {
+			return errors.Wrap(err, "can't hand off particle buffer")
+		}
+	}
+	app.logger.Info("Drawing externally produced particles", logging.F("particles", app.Particles), logging.F("bytes", shared.Size))
+	return nil
+}
+
+// particleVertexBuffer is what the current window draws particles from,
+// null when it doesn't draw them. External particles are only drawn by
+// the primary window, whose submit the timeline is waited and signaled in.
+func (app *HelloTriangleApplication) particleVertexBuffer() vk.Buffer {
+	if app.particleSource == nil {
+		return app.particleBuffers[app.particleCurrent].Handle
+	}
+	if app.appWindow != app.windows[0] {
+		return vk.NullBuffer
+	}
+	return app.particleSource.Handle
+}
+
+// particleTimelineValues are the values the primary window's submit waits
+// for and signals on the particle timeline, zero when it isn't drawing
+// external particles. Each call is a frame.
+func (app *HelloTriangleApplication) particleTimelineValues() (wait, signal uint64) {
+	if app.particleSource == nil || app.particlePipeline == vk.NullPipeline || app.appWindow != app.windows[0] {
+		return 0, 0
+	}
+	n := app.particleFrame
+	app.particleFrame++
+	return 2*n + 1, 2*n + 2
+}
+
+func (app *HelloTriangleApplication) destroyExternalParticles() {
+	if app.particleTimeline != vk.NullSemaphore {
+		vk.DestroySemaphore(app.device, app.particleTimeline, nil)
+		app.particleTimeline = vk.NullSemaphore
+	}
+	if app.particleSource != nil {
+		app.particleSource.Destroy()
+		app.particleSource = nil
+	}
+}
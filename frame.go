@@ -0,0 +1,428 @@
+package main
+
+import (
+	"math"
+	"runtime"
+	"time"
+
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/interop"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+func (app *HelloTriangleApplication) framesInFlight() int {
+	if app.MaxFramesInFlight <= 0 {
+		return defaultMaxFramesInFlight
+	}
+	return app.MaxFramesInFlight
+}
+
+func (app *HelloTriangleApplication) createSyncObjects() error {
+	frames := app.framesInFlight()
+	app.imageAvailableSemaphores = make([]vk.Semaphore, 0, frames)
+	app.renderFinishedSemaphores = make([]vk.Semaphore, 0, frames)
+	app.inFlightFences = make([]vk.Fence, 0, frames)
+	app.imagesInFlight = make([]vk.Fence, len(app.target.Images))
+
+	semaphoreInfo := &vk.SemaphoreCreateInfo{
+		SType: vk.StructureTypeSemaphoreCreateInfo,
+	}
+	// Fences start signaled so the first wait on each frame doesn't block forever
+	fenceInfo := &vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+		Flags: vk.FenceCreateFlags(vk.FenceCreateSignaledBit),
+	}
+
+	for i := 0; i < frames; i++ {
+		var imageAvailable vk.Semaphore
+		if err := vk.Error(vk.CreateSemaphore(app.device, semaphoreInfo, nil, &imageAvailable)); err != nil {
+			return errors.Wrapf(err, "can't create image available semaphore for frame %d", i)
+		}
+		app.track("semaphore", imageAvailable)
+		app.imageAvailableSemaphores = append(app.imageAvailableSemaphores, imageAvailable)
+
+		var renderFinished vk.Semaphore
+		if err := vk.Error(vk.CreateSemaphore(app.device, semaphoreInfo, nil, &renderFinished)); err != nil {
+			return errors.Wrapf(err, "can't create render finished semaphore for frame %d", i)
+		}
+		app.track("semaphore", renderFinished)
+		app.renderFinishedSemaphores = append(app.renderFinishedSemaphores, renderFinished)
+
+		var inFlight vk.Fence
+		if err := vk.Error(vk.CreateFence(app.device, fenceInfo, nil, &inFlight)); err != nil {
+			return errors.Wrapf(err, "can't create in flight fence for frame %d", i)
+		}
+		app.track("fence", inFlight)
+		app.inFlightFences = append(app.inFlightFences, inFlight)
+	}
+
+	return nil
+}
+
+func (app *HelloTriangleApplication) destroySyncObjects() {
+	for _, s := range app.renderFinishedSemaphores {
+		app.release(s)
+		vk.DestroySemaphore(app.device, s, nil)
+	}
+	app.renderFinishedSemaphores = nil
+
+	for _, s := range app.imageAvailableSemaphores {
+		app.release(s)
+		vk.DestroySemaphore(app.device, s, nil)
+	}
+	app.imageAvailableSemaphores = nil
+
+	for _, f := range app.inFlightFences {
+		app.release(f)
+		vk.DestroyFence(app.device, f, nil)
+	}
+	app.inFlightFences = nil
+	app.imagesInFlight = nil
+}
+
+func (app *HelloTriangleApplication) drawFrame() error {
+	frame := app.currentFrame
+	inFlight := app.inFlightFences[frame]
+
+	if err := vk.Error(vk.WaitForFences(app.device, 1, []vk.Fence{inFlight}, vk.True, math.MaxUint64)); err != nil {
+		return errors.Wrapf(err, "can't wait for frame %d", frame)
+	}
+	app.waited(inFlight)
+
+	// The frame's previous transient descriptor sets are done with
+	if err := app.transientDescriptors[frame].Reset(); err != nil {
+		return errors.Wrapf(err, "can't reset transient descriptors for frame %d", frame)
+	}
+
+	if app.recorder != nil {
+		if err := app.recorder.collect(frame); err != nil {
+			return errors.Wrap(err, "can't collect recorded frame")
+		}
+	}
+
+	var imageIndex uint32
+	switch result := vk.AcquireNextImage(app.device, app.swapchain.Handle, math.MaxUint64, app.imageAvailableSemaphores[frame], vk.NullFence, &imageIndex); result {
+	case vk.ErrorOutOfDate:
+		return errors.Wrap(app.recreateSwapchain(), "can't recreate out of date swapchain")
+	case vk.Success, vk.Suboptimal:
+		// A suboptimal swapchain can still be presented to, it's recreated after present
+	default:
+		return errors.Wrap(vk.Error(result), "can't acquire swapchain image")
+	}
+
+	// An earlier frame may still be rendering into this image when there are
+	// fewer swapchain images than frames in flight or they come back out of order
+	if imageFence := app.imagesInFlight[imageIndex]; imageFence != vk.NullFence {
+		if err := vk.Error(vk.WaitForFences(app.device, 1, []vk.Fence{imageFence}, vk.True, math.MaxUint64)); err != nil {
+			return errors.Wrapf(err, "can't wait for swapchain image %d", imageIndex)
+		}
+		app.waited(imageFence)
+	}
+	app.imagesInFlight[imageIndex] = inFlight
+
+	// Everything from here to presenting is the CPU's own work
+	cpuStart := time.Now()
+
+	capture := false
+	if app.recorder != nil {
+		var err error
+		if capture, err = app.recorder.prepare(app, frame, app.frameCount); err != nil {
+			return errors.Wrap(err, "can't prepare frame recording")
+		}
+	}
+
+	if err := app.updateUniformBuffer(frame); err != nil {
+		return errors.Wrapf(err, "can't update uniform buffer for frame %d", frame)
+	}
+
+	if err := app.buildUI(frame); err != nil {
+		return errors.Wrap(err, "can't build UI")
+	}
+
+	if err := app.buildSprites(frame); err != nil {
+		return errors.Wrap(err, "can't build sprites")
+	}
+
+	if err := app.buildOverlay(frame); err != nil {
+		return errors.Wrap(err, "can't build overlay")
+	}
+
+	app.resetDraws()
+	secondaries, err := app.recordSecondaries(frame, imageIndex)
+	if err != nil {
+		return errors.Wrap(err, "can't record secondary command buffers")
+	}
+
+	stepped, err := app.submitParticleStep(frame)
+	if err != nil {
+		return errors.Wrap(err, "can't step particles")
+	}
+
+	cb := app.commandBuffers[frame]
+	if err := commands.Record(cb, func(cb vk.CommandBuffer) {
+		for _, r := range app.profiler.BeginFrame(cb, frame) {
+			app.frameStats.RecordGPU(r.Name, r.Duration)
+		}
+		if s, ok := app.pipelineStats.BeginFrame(cb, frame); ok {
+			app.recordPipelineStatistics(s)
+		}
+		app.recordShadows(cb, frame)
+		app.recordParticleStep(cb)
+		app.recordCommandBuffer(cb, frame, imageIndex, secondaries)
+		app.recordPostProcess(cb, imageIndex)
+		app.recordRayTracing(cb, frame, imageIndex)
+		app.recordStereo(cb, frame, imageIndex)
+		app.recordSprites(cb, frame, imageIndex)
+		app.recordOverlay(cb, frame, imageIndex)
+		app.recordUI(cb, frame, imageIndex)
+		app.recordExport(cb, imageIndex)
+		if capture {
+			scope := app.profiler.Begin(cb, "capture")
+			app.recorder.cmdCopy(cb, frame, app.target.Images[imageIndex], app.target.FinalLayout)
+			scope.End(cb)
+		}
+	}); err != nil {
+		return errors.Wrap(err, "can't record command buffer")
+	}
+	app.frameStats.RecordCount(drawCallsCount, app.drawCalls())
+
+	waitSemaphores := []vk.Semaphore{app.imageAvailableSemaphores[frame]}
+	waitStages := []vk.PipelineStageFlags{vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit)}
+	signalSemaphores := []vk.Semaphore{app.renderFinishedSemaphores[frame]}
+	// Particles stepped on the compute queue are only read as vertices
+	if stepped != vk.NullSemaphore {
+		waitSemaphores = append(waitSemaphores, stepped)
+		waitStages = append(waitStages, vk.PipelineStageFlags(vk.PipelineStageVertexInputBit))
+	}
+	if released := app.particleReleaseSemaphore(); released != vk.NullSemaphore {
+		signalSemaphores = append(signalSemaphores, released)
+	}
+	// The importer has to be done with the last exported frame before it's
+	// overwritten
+	if wait, signal := app.exportSemaphores(); signal != vk.NullSemaphore {
+		if wait != vk.NullSemaphore {
+			waitSemaphores = append(waitSemaphores, wait)
+			waitStages = append(waitStages, vk.PipelineStageFlags(vk.PipelineStageTransferBit))
+		}
+		signalSemaphores = append(signalSemaphores, signal)
+	}
+	// External particles are drawn once they're produced and handed back
+	// after, the timeline's values go alongside the binary semaphores'
+	var timeline *interop.TimelineSubmit
+	if wait, signal := app.particleTimelineValues(); wait != 0 {
+		waitSemaphores = append(waitSemaphores, app.particleTimeline)
+		waitStages = append(waitStages, vk.PipelineStageFlags(vk.PipelineStageVertexInputBit))
+		signalSemaphores = append(signalSemaphores, app.particleTimeline)
+		waitValues := make([]uint64, len(waitSemaphores))
+		waitValues[len(waitValues)-1] = wait
+		signalValues := make([]uint64, len(signalSemaphores))
+		signalValues[len(signalValues)-1] = signal
+		timeline = interop.NewTimelineSubmit(nil, waitValues, signalValues)
+	}
+	submitInfo := []vk.SubmitInfo{{
+		SType:                vk.StructureTypeSubmitInfo,
+		WaitSemaphoreCount:   uint32(len(waitSemaphores)),
+		PWaitSemaphores:      waitSemaphores,
+		PWaitDstStageMask:    waitStages,
+		CommandBufferCount:   1,
+		PCommandBuffers:      []vk.CommandBuffer{cb},
+		SignalSemaphoreCount: uint32(len(signalSemaphores)),
+		PSignalSemaphores:    signalSemaphores,
+	}}
+	if timeline != nil {
+		submitInfo[0].PNext = timeline.Pointer()
+	}
+
+	if err := vk.Error(vk.ResetFences(app.device, 1, []vk.Fence{inFlight})); err != nil {
+		return errors.Wrapf(err, "can't reset fence for frame %d", frame)
+	}
+	err := vk.Error(vk.QueueSubmit(app.graphicsQueue, 1, submitInfo, inFlight))
+	runtime.KeepAlive(timeline)
+	if err != nil {
+		return errors.Wrap(err, "can't submit draw command buffer")
+	}
+	app.submitted(inFlight)
+
+	// The image has to be captured before presenting hands it back
+	if app.screenshotRequested {
+		app.screenshotRequested = false
+		if err := app.captureScreenshot(imageIndex); err != nil {
+			app.logger.Warn("Can't capture screenshot", logging.F("err", err))
+		}
+	}
+
+	presentInfo := &vk.PresentInfo{
+		SType:              vk.StructureTypePresentInfo,
+		WaitSemaphoreCount: 1,
+		PWaitSemaphores:    []vk.Semaphore{app.renderFinishedSemaphores[frame]},
+		SwapchainCount:     1,
+		PSwapchains:        []vk.Swapchain{app.swapchain.Handle},
+		PImageIndices:      []uint32{imageIndex},
+	}
+	result := vk.QueuePresent(app.presentQueue, presentInfo)
+	presented := time.Now()
+	app.frameStats.Record(presented.Sub(cpuStart), presented)
+	app.currentFrame = (app.currentFrame + 1) % len(app.inFlightFences)
+	app.frameCount++
+
+	switch {
+	case result == vk.ErrorOutOfDate || result == vk.Suboptimal || app.framebufferResized:
+		app.framebufferResized = false
+		if err := app.recreateSwapchain(); err != nil {
+			return errors.Wrap(err, "can't recreate swapchain")
+		}
+	case result != vk.Success:
+		return errors.Wrap(vk.Error(result), "can't present swapchain image")
+	}
+
+	return nil
+}
+
+// recordDraws binds the pipeline and draws count of the mesh's indices from
+// first for every object. Secondary buffers don't inherit any state so every
+// worker calls it for its share.
+func (app *HelloTriangleApplication) recordDraws(cb vk.CommandBuffer, frame int, first, count uint32) {
+	if app.meshShaded {
+		app.recordMeshlets(cb, frame, first, count)
+		return
+	}
+	drawConstants.Push(cb, app.pipelineLayout, app.currentDrawConstants())
+	app.drawObjects(cb, frame, first, count, true, true)
+}
+
+// currentDrawConstants are the current window's DrawConstants.
+func (app *HelloTriangleApplication) currentDrawConstants() DrawConstants {
+	return DrawConstants{
+		Tint:           app.tint,
+		LightDirection: app.lightDirection().Vec4(0),
+		CameraPosition: app.camera.Position.Vec4(1),
+	}
+}
+
+// drawObjects draws count of the mesh's indices from first for every object
+// in the window's draw list, a material at a time in sortDraws' order. The
+// descriptor set is rebound at each object's dynamic offset. With
+// bindPipelines each material's graphics pipeline variant is bound too,
+// otherwise everything is drawn with the bound pipeline, and tinted by its
+// level of detail when lodColors. With cull objects outside the camera's
+// frustum are skipped.
+func (app *HelloTriangleApplication) drawObjects(cb vk.CommandBuffer, frame int, first, count uint32, bindPipelines, cull bool) {
+	app.bindMaterialTable(cb, app.pipelineLayout)
+	uniforms := app.uniformBuffers[frame]
+	end := first + count
+	object, material, variant, tint := -1, -1, PipelineVariant(-1), -1
+	for _, d := range app.materialDraws {
+		if cull && !app.visible[d.object] {
+			continue
+		}
+		g := app.mesh.Groups[d.group]
+		from, to := g.First, g.First+g.Count
+		level := app.objectLOD(d.object)
+		if level > 0 {
+			// A coarser level is drawn whole by whichever slice has the
+			// start of its group
+			if g.First < first || g.First >= end {
+				continue
+			}
+			lodGroup := app.mesh.LODs[level-1][d.group]
+			from, to = lodGroup.First, lodGroup.First+lodGroup.Count
+		} else {
+			// Workers draw slices of the indices that may split groups
+			if from < first {
+				from = first
+			}
+			if to > end {
+				to = end
+			}
+		}
+		if from >= to {
+			continue
+		}
+		if bindPipelines && d.variant != variant {
+			vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.graphicsPipeline(d.variant))
+			variant = d.variant
+		}
+		if bindPipelines && app.lodColors && level != tint {
+			drawConstants.Push(cb, app.pipelineLayout, app.lodDrawConstants(level))
+			tint = level
+		}
+		if d.object != object {
+			vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, app.pipelineLayout, 0,
+				1, []vk.DescriptorSet{app.descriptorSets[frame]},
+				1, []uint32{uniforms.Offset(d.object)})
+			object = d.object
+		}
+		if d.material != material {
+			app.bindMaterial(cb, app.pipelineLayout, d.material)
+			material = d.material
+		}
+		app.mesh.DrawRange(cb, from, to-from)
+		app.countDraws(1)
+	}
+}
+
+// recordCommandBuffer records the render pass drawing frame into the
+// swapchain image, or its dynamic rendering equivalent. The draws are either recorded inline or, when secondaries
+// isn't empty, already recorded into them by the workers.
+func (app *HelloTriangleApplication) recordCommandBuffer(cb vk.CommandBuffer, frame int, imageIndex uint32, secondaries []vk.CommandBuffer) {
+	// One per attachment in createRenderPass's order, the resolve target's
+	// is ignored
+	clearValues := []vk.ClearValue{vk.NewClearValue([]float32{0, 0, 0, 1})}
+	switch {
+	case app.Deferred:
+		for range app.gbuffer {
+			clearValues = append(clearValues, vk.NewClearValue([]float32{0, 0, 0, 1}))
+		}
+	case app.multisampled():
+		clearValues = append(clearValues, vk.ClearValue{})
+	}
+	clearValues = append(clearValues, vk.NewClearDepthStencil(1, 0))
+
+	app.occlusionQueries.Reset(cb, frame)
+	app.beginScene(cb)
+	scope := app.profiler.Begin(cb, "render pass")
+	app.pipelineStats.Begin(cb)
+	if app.dynamicRendering {
+		app.cmdBeginSceneRendering(cb, imageIndex, clearValues, len(secondaries) > 0)
+	} else {
+		contents := vk.SubpassContentsInline
+		if len(secondaries) > 0 {
+			contents = vk.SubpassContentsSecondaryCommandBuffers
+		}
+		vk.CmdBeginRenderPass(cb, &vk.RenderPassBeginInfo{
+			SType:       vk.StructureTypeRenderPassBeginInfo,
+			RenderPass:  app.renderPass,
+			Framebuffer: app.framebuffers[imageIndex],
+			RenderArea: vk.Rect2D{
+				Offset: vk.Offset2D{X: 0, Y: 0},
+				Extent: app.target.Extent,
+			},
+			ClearValueCount: uint32(len(clearValues)),
+			PClearValues:    clearValues,
+		}, contents)
+	}
+	if len(secondaries) > 0 {
+		vk.CmdExecuteCommands(cb, uint32(len(secondaries)), secondaries)
+	} else {
+		app.recordOcclusion(cb, frame)
+		app.recordDraws(cb, frame, 0, app.mesh.IndexCount)
+		if !app.Deferred {
+			app.recordSkybox(cb)
+			app.recordParticles(cb)
+		}
+	}
+	if app.Deferred {
+		app.recordLighting(cb, frame)
+		app.recordSkybox(cb)
+		app.recordParticles(cb)
+	}
+	if app.dynamicRendering {
+		app.cmdEndSceneRendering(cb, imageIndex)
+	} else {
+		vk.CmdEndRenderPass(cb)
+	}
+	app.pipelineStats.End(cb)
+	scope.End(cb)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/profiler"
+	"github.com/delaneyj/learnvulkan/stats"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// reportFrameStats logs every window's frame timing and passes it to
+// OnFrameStats once every StatsInterval.
+func (app *HelloTriangleApplication) reportFrameStats(now time.Time) {
+	if app.StatsInterval <= 0 {
+		return
+	}
+	if app.lastStatsReport.IsZero() {
+		app.lastStatsReport = now
+		return
+	}
+	if now.Sub(app.lastStatsReport) < app.StatsInterval {
+		return
+	}
+	app.lastStatsReport = now
+
+	for _, w := range app.windows {
+		s := w.frameStats.Summary()
+		fields := []logging.Field{
+			logging.F("title", w.config.Title),
+			logging.F("frames", s.Frames),
+			logging.F("fps", int(s.FPS+0.5)),
+			logging.F("cpu", s.CPU),
+			logging.F("present", s.Present),
+		}
+		scopes := make([]string, 0, len(s.GPU))
+		for scope := range s.GPU {
+			scopes = append(scopes, scope)
+		}
+		sort.Strings(scopes)
+		for _, scope := range scopes {
+			fields = append(fields, logging.F("gpu "+scope, s.GPU[scope]))
+		}
+		fields = append(fields, logging.F("draws", s.Counts[drawCallsCount]),
+			logging.F("drawn objects", s.Counts[drawnObjectsCount]),
+			logging.F("culled objects", s.Counts[culledObjectsCount]))
+		if w.occlusionQueries != nil {
+			fields = append(fields, logging.F("occluded objects", s.Counts[occludedObjectsCount]))
+		}
+		if len(app.mesh.LODs) > 0 {
+			for level := 0; level <= len(app.mesh.LODs); level++ {
+				name := lodObjectsCount(level)
+				fields = append(fields, logging.F(name, s.Counts[name]))
+			}
+		}
+		for _, name := range pipelineStatisticNames {
+			if n, ok := s.Counts[name]; ok {
+				fields = append(fields, logging.F(name, n))
+			}
+		}
+		app.logger.Info("Frame stats", fields...)
+		if app.OnFrameStats != nil {
+			app.OnFrameStats(w.config.Title, s)
+		}
+	}
+}
+
+// FrameStats is the primary window's recent frame timing.
+func (app *HelloTriangleApplication) FrameStats() stats.Summary {
+	return app.windows[0].frameStats.Summary()
+}
+
+// createProfiler creates the current window's GPU profiler when ProfileGPU
+// is set, its scopes' times are added to the window's frame stats. Devices
+// that can't write timestamps on the graphics queue go without.
+func (app *HelloTriangleApplication) createProfiler() error {
+	if !app.ProfileGPU || app.Headless {
+		return nil
+	}
+	p, err := profiler.New(app.device, app.physicalDevice, uint32(app.queueFamilies.Graphics), app.framesInFlight(), 0)
+	if errors.Cause(err) == profiler.ErrUnsupported {
+		app.logger.Info("GPU profiling unavailable", logging.F("err", err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	app.profiler = p
+	return nil
+}
+
+// drawCallsCount is the frame stats counter of each frame's draw calls.
+const drawCallsCount = "draw calls"
+
+// resetDraws starts counting the current window's draw calls for a new
+// frame.
+func (app *HelloTriangleApplication) resetDraws() {
+	atomic.StoreUint64(&app.draws, 0)
+}
+
+// countDraws adds n draw calls to the current window's frame.
+func (app *HelloTriangleApplication) countDraws(n int) {
+	atomic.AddUint64(&app.draws, uint64(n))
+}
+
+// drawCalls is how many draw calls the current window's frame recorded.
+func (app *HelloTriangleApplication) drawCalls() uint64 {
+	return atomic.LoadUint64(&app.draws)
+}
+
+// pipelineStatisticNames are the frame stats counters pipeline statistics
+// are recorded as, in the order they're logged.
+var pipelineStatisticNames = []string{
+	"vertex invocations",
+	"clipping invocations",
+	"clipping primitives",
+	"fragment invocations",
+}
+
+// enabledDeviceFeatures are the required features plus the optional ones
+// asked for that the physical device has.
+func (app *HelloTriangleApplication) enabledDeviceFeatures() vk.PhysicalDeviceFeatures {
+	features := requiredDeviceFeatures()
+	var available vk.PhysicalDeviceFeatures
+	vk.GetPhysicalDeviceFeatures(app.physicalDevice, &available)
+	available.Deref()
+
+	// The bindless texture table is indexed by a pushed material index
+	if app.bindless {
+		features.ShaderSampledImageArrayDynamicIndexing = vk.True
+	}
+
+	// Textures compressed offline need their format family's feature
+	features.TextureCompressionBC = available.TextureCompressionBC
+	features.TextureCompressionASTC_LDR = available.TextureCompressionASTC_LDR
+	features.TextureCompressionETC2 = available.TextureCompressionETC2
+
+	// Wireframe and point rendering need fillModeNonSolid
+	if available.FillModeNonSolid.B() {
+		features.FillModeNonSolid = vk.True
+		app.fillModeNonSolid = true
+	}
+
+	if !app.PipelineStatistics {
+		return features
+	}
+	if available.PipelineStatisticsQuery.B() {
+		features.PipelineStatisticsQuery = vk.True
+		app.pipelineStatistics = true
+	} else {
+		app.logger.Info("Pipeline statistics unavailable", logging.F("reason", "no pipelineStatisticsQuery feature"))
+	}
+	return features
+}
+
+// createPipelineStats creates the current window's pipeline statistics
+// query when the feature was enabled.
+func (app *HelloTriangleApplication) createPipelineStats() error {
+	if !app.pipelineStatistics || app.Headless {
+		return nil
+	}
+	// Executing secondary command buffers with a query active needs the
+	// inheritedQueries feature
+	if app.RecordThreads > 1 {
+		app.logger.Info("Pipeline statistics unavailable", logging.F("reason", "recording on multiple threads"))
+		return nil
+	}
+	q, err := profiler.NewPipelineStats(app.device, app.framesInFlight())
+	if err != nil {
+		return err
+	}
+	app.pipelineStats = q
+	return nil
+}
+
+func (app *HelloTriangleApplication) recordPipelineStatistics(s profiler.Statistics) {
+	counts := []uint64{s.VertexInvocations, s.ClippingInvocations, s.ClippingPrimitives, s.FragmentInvocations}
+	for i, name := range pipelineStatisticNames {
+		app.frameStats.RecordCount(name, counts[i])
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/culling"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+const (
+	defaultFreezeFrustumKey = glfw.KeyF9
+	// culledObjectsCount and drawnObjectsCount are the frame stats counters
+	// of the objects frustum culling skips and keeps each frame.
+	culledObjectsCount = "culled objects"
+	drawnObjectsCount  = "drawn objects"
+)
+
+func (app *HelloTriangleApplication) freezeFrustumKey() glfw.Key {
+	if app.FreezeFrustumKey == 0 {
+		return defaultFreezeFrustumKey
+	}
+	return app.FreezeFrustumKey
+}
+
+// meshBounds is the box around vertices.
+func meshBounds(vertices []Vertex) culling.AABB {
+	b := culling.Empty()
+	for _, v := range vertices {
+		b = b.Extend(vmath.Vec3(v.Pos))
+	}
+	return b
+}
+
+// instancesBounds is the box around every instance of a mesh bound by b.
+func instancesBounds(instances []Instance, b culling.AABB) culling.AABB {
+	bound := culling.Empty()
+	for _, in := range instances {
+		bound = bound.Union(b.Transform(in.Model))
+	}
+	return bound
+}
+
+// cullDraws works out which of the draw list's objects are in the frustum
+// of viewProj, or of the one frozen by freezeFrustumKey, and weren't found
+// hidden by frame's occlusion queries, and counts them. A skinned mesh's
+// pose can take it anywhere outside its bounds, so it's never culled. It
+// picks every object's level of detail too, culled ones included since the
+// shadow map still draws them.
+func (app *HelloTriangleApplication) cullDraws(frame int, viewProj vmath.Mat4) {
+	frustum := culling.NewFrustum(viewProj)
+	switch {
+	case !app.freezeFrustum:
+		app.frozenFrustum = nil
+	case app.frozenFrustum == nil:
+		app.frozenFrustum = &frustum
+	default:
+		frustum = *app.frozenFrustum
+	}
+
+	app.readOcclusion(frame)
+
+	draws := app.drawList.Draws
+	if cap(app.visible) < len(draws) {
+		app.visible = make([]bool, len(draws))
+	}
+	app.visible = app.visible[:len(draws)]
+	if cap(app.lods) < len(draws) {
+		app.lods = make([]int, len(draws))
+	}
+	app.lods = app.lods[:len(draws)]
+	lodObjects := make([]uint64, len(app.mesh.LODs)+1)
+	var drawn, occluded int
+	for i, d := range draws {
+		box := app.mesh.Bounds.Transform(d.World)
+		app.lods[i] = app.selectLOD(box)
+		if app.skinned() {
+			app.visible[i] = true
+			lodObjects[app.lods[i]]++
+			drawn++
+			continue
+		}
+		if !frustum.Intersects(box) {
+			app.visible[i] = false
+			continue
+		}
+		app.queryOcclusion(frame, d.Node, box)
+		app.visible[i] = !app.occluded.Hidden(d.Node)
+		if app.visible[i] {
+			lodObjects[app.lods[i]]++
+			drawn++
+		} else {
+			occluded++
+		}
+	}
+	app.frameStats.RecordCount(culledObjectsCount, uint64(len(draws)-drawn-occluded))
+	app.frameStats.RecordCount(occludedObjectsCount, uint64(occluded))
+	app.frameStats.RecordCount(drawnObjectsCount, uint64(drawn))
+	for level, n := range lodObjects {
+		app.frameStats.RecordCount(lodObjectsCount(level), n)
+	}
+}
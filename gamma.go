@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/swapchain"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const defaultGammaKey = glfw.KeyG
+
+// srgbFormats are the sRGB formats of the UNORM ones textures and
+// swapchains come in. Sampling an sRGB format decodes it to linear, and
+// rendering to one encodes linear colors, so shaders only ever see linear
+// colors.
+var srgbFormats = map[vk.Format]vk.Format{
+	vk.FormatR8g8b8a8Unorm:          vk.FormatR8g8b8a8Srgb,
+	vk.FormatB8g8r8a8Unorm:          vk.FormatB8g8r8a8Srgb,
+	vk.FormatBc1RgbUnormBlock:       vk.FormatBc1RgbSrgbBlock,
+	vk.FormatBc1RgbaUnormBlock:      vk.FormatBc1RgbaSrgbBlock,
+	vk.FormatBc2UnormBlock:          vk.FormatBc2SrgbBlock,
+	vk.FormatBc3UnormBlock:          vk.FormatBc3SrgbBlock,
+	vk.FormatBc7UnormBlock:          vk.FormatBc7SrgbBlock,
+	vk.FormatEtc2R8g8b8UnormBlock:   vk.FormatEtc2R8g8b8SrgbBlock,
+	vk.FormatEtc2R8g8b8a1UnormBlock: vk.FormatEtc2R8g8b8a1SrgbBlock,
+	vk.FormatEtc2R8g8b8a8UnormBlock: vk.FormatEtc2R8g8b8a8SrgbBlock,
+	vk.FormatAstc4x4UnormBlock:      vk.FormatAstc4x4SrgbBlock,
+	vk.FormatAstc5x4UnormBlock:      vk.FormatAstc5x4SrgbBlock,
+	vk.FormatAstc5x5UnormBlock:      vk.FormatAstc5x5SrgbBlock,
+	vk.FormatAstc6x5UnormBlock:      vk.FormatAstc6x5SrgbBlock,
+	vk.FormatAstc6x6UnormBlock:      vk.FormatAstc6x6SrgbBlock,
+	vk.FormatAstc8x5UnormBlock:      vk.FormatAstc8x5SrgbBlock,
+	vk.FormatAstc8x6UnormBlock:      vk.FormatAstc8x6SrgbBlock,
+	vk.FormatAstc8x8UnormBlock:      vk.FormatAstc8x8SrgbBlock,
+	vk.FormatAstc10x5UnormBlock:     vk.FormatAstc10x5SrgbBlock,
+	vk.FormatAstc10x6UnormBlock:     vk.FormatAstc10x6SrgbBlock,
+	vk.FormatAstc10x8UnormBlock:     vk.FormatAstc10x8SrgbBlock,
+	vk.FormatAstc10x10UnormBlock:    vk.FormatAstc10x10SrgbBlock,
+	vk.FormatAstc12x10UnormBlock:    vk.FormatAstc12x10SrgbBlock,
+	vk.FormatAstc12x12UnormBlock:    vk.FormatAstc12x12SrgbBlock,
+}
+
+// isSRGB is whether format is one of srgbFormats' sRGB formats.
+func isSRGB(format vk.Format) bool {
+	for _, f := range srgbFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// textureFormat is format in the color space a texture is sampled in, sRGB
+// for colors and UNORM for data like normals and roughness, whatever its
+// file says. Formats without both are left as they are.
+func textureFormat(format vk.Format, srgb bool) vk.Format {
+	if srgb {
+		if f, ok := srgbFormats[format]; ok {
+			return f
+		}
+		return format
+	}
+	for unorm, f := range srgbFormats {
+		if f == format {
+			return unorm
+		}
+	}
+	return format
+}
+
+func (app *HelloTriangleApplication) gammaKey() glfw.Key {
+	if app.GammaKey == 0 {
+		return defaultGammaKey
+	}
+	return app.GammaKey
+}
+
+// swapchainFormats are the current window's preferred swapchain formats.
+// They're sRGB so presenting encodes the shaders' linear colors, unless
+// wrongGamma asks for UNORM ones, which present them as they are. That's
+// what forgetting the encoding looks like: too dark, with harsh falloff
+// from the lights.
+func (app *HelloTriangleApplication) swapchainFormats() []vk.Format {
+	if app.wrongGamma {
+		return []vk.Format{vk.FormatB8g8r8a8Unorm, vk.FormatR8g8b8a8Unorm}
+	}
+	return []vk.Format{vk.FormatB8g8r8a8Srgb, vk.FormatR8g8b8a8Srgb}
+}
+
+// checkSwapchainFormat warns when the current window's swapchain format
+// doesn't match what swapchainFormats asked for, which the surface decides.
+func (app *HelloTriangleApplication) checkSwapchainFormat() {
+	if isSRGB(app.swapchain.Format) == !app.wrongGamma {
+		return
+	}
+	reason := "the surface has no sRGB format, colors will be too dark"
+	if app.wrongGamma {
+		reason = "the surface has no UNORM format to show wrong gamma with"
+	}
+	app.logger.Warn("Unexpected swapchain format",
+		logging.F("format", swapchain.FormatName(app.swapchain.Format)),
+		logging.F("reason", reason),
+	)
+}
+
+// toggleGamma switches the current window between presenting correctly and
+// wrongGamma, rebuilding its swapchain.
+func (app *HelloTriangleApplication) toggleGamma() error {
+	if app.swapchain == nil {
+		return nil
+	}
+	app.wrongGamma = !app.wrongGamma
+	if err := app.recreateSwapchain(); err != nil {
+		return errors.Wrap(err, "can't recreate swapchain")
+	}
+	app.logger.Info("Switched gamma",
+		logging.F("wrong", app.wrongGamma),
+		logging.F("format", swapchain.FormatName(app.swapchain.Format)),
+	)
+	return nil
+}
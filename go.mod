@@ -1,14 +1,23 @@
 module github.com/delaneyj/learnvulkan
 
+go 1.18
+
 require (
 	github.com/davecgh/go-spew v1.1.1
-	github.com/go-gl/glfw v0.0.0-20190217072633-93b30450e032 // indirect
-	github.com/google/pprof v0.0.0-20190309163659-77426154d546 // indirect
-	github.com/ianlancetaylor/demangle v0.0.0-20181102032728-5e5cf60278f6 // indirect
+	github.com/fsnotify/fsnotify v1.5.1
+	github.com/inkyblackness/imgui-go/v4 v4.7.0
 	github.com/pkg/errors v0.8.1
 	github.com/vulkan-go/glfw v0.0.0-20180930191036-cac57eedc4a5
 	github.com/vulkan-go/vulkan v0.0.0-20181015060211-df48e8cc1538
 	github.com/xlab/closer v0.0.0-20161113214103-89cd22812c4f
+)
+
+require (
+	github.com/go-gl/glfw v0.0.0-20190217072633-93b30450e032 // indirect
+	github.com/google/pprof v0.0.0-20190309163659-77426154d546 // indirect
+	github.com/ianlancetaylor/demangle v0.0.0-20181102032728-5e5cf60278f6 // indirect
 	golang.org/x/arch v0.0.0-20190312162104-788fe5ffcd8c // indirect
 	golang.org/x/crypto v0.0.0-20190325154230-a5d413f7728c // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	rsc.io/pdf v0.1.1 // indirect
 )
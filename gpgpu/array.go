@@ -0,0 +1,69 @@
+package gpgpu
+
+import (
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Array is a storage buffer of Len values of T the host can write and read,
+// for data going in and out of kernels. T must be laid out like the
+// shader's array elements, std430 rules. Intermediate data kernels pass
+// between themselves is better off in a device local buffer bound with
+// BindBuffer.
+type Array[T any] struct {
+	Buffer *gpu.Buffer
+	Len    int
+}
+
+// NewArray creates an array of n zero values on d.
+func NewArray[T any](d *Device, n int) (*Array[T], error) {
+	var zero T
+	size := vk.DeviceSize(n) * vk.DeviceSize(unsafe.Sizeof(zero))
+	usage := vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit | vk.BufferUsageTransferSrcBit | vk.BufferUsageTransferDstBit)
+	// Host cached memory is much faster to read back
+	b, err := gpu.NewBuffer(d.ctx, size, usage, memory.GPUToCPU)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create array buffer")
+	}
+	a := &Array[T]{Buffer: b, Len: n}
+	if err := a.Write(make([]T, n)); err != nil {
+		a.Destroy()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Write copies values to the start of the array. No job using it can be
+// running.
+func (a *Array[T]) Write(values []T) error {
+	if len(values) > a.Len {
+		return errors.Errorf("%d values don't fit in an array of %d", len(values), a.Len)
+	}
+	return a.Buffer.Upload(bytesOf(values))
+}
+
+// Read copies the start of the array into values. Jobs writing it have to
+// have finished.
+func (a *Array[T]) Read(values []T) error {
+	if len(values) > a.Len {
+		return errors.Errorf("can't read %d values from an array of %d", len(values), a.Len)
+	}
+	return a.Buffer.Download(bytesOf(values))
+}
+
+// Destroy destroys the array's buffer.
+func (a *Array[T]) Destroy() {
+	a.Buffer.Destroy()
+}
+
+// bytesOf is the memory of values as bytes.
+func bytesOf[T any](values []T) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&values[0])), len(values)*int(unsafe.Sizeof(values[0])))
+}
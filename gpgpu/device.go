@@ -0,0 +1,202 @@
+// Package gpgpu runs compute shaders without the Vulkan around them. A
+// Kernel is made from a shader's SPIR-V, its bindings are given buffers and
+// images, and Dispatches of it are run on a compute queue, either waiting
+// for them or carrying on while they run.
+package gpgpu
+
+import (
+	"math"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Device is a compute capable queue kernels run on. It isn't safe to use
+// from multiple goroutines.
+type Device struct {
+	ctx gpu.Context
+}
+
+// NewDevice runs kernels on queue, which is from queue family family of
+// device. Memory comes from allocator.
+func NewDevice(device vk.Device, allocator *memory.Allocator, queue vk.Queue, family uint32) (*Device, error) {
+	pool, err := commands.NewPool(device, family)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create compute command pool")
+	}
+	return &Device{ctx: gpu.Context{
+		Device:    device,
+		Allocator: allocator,
+		Commands:  pool,
+		Queue:     queue,
+	}}, nil
+}
+
+// Context is for creating buffers and images to bind to kernels, their
+// uploads and transitions run on the device's queue.
+func (d *Device) Context() gpu.Context {
+	return d.ctx
+}
+
+// Dispatch is a kernel run over a grid of workgroups with the bindings and
+// constants it had when the Dispatch was made.
+type Dispatch struct {
+	kernel    *Kernel
+	set       vk.DescriptorSet
+	images    []*gpu.Image
+	constants []byte
+	groups    [3]uint32
+}
+
+// Groups is how many workgroups of size invocations cover n of them.
+func Groups(n, size int) uint32 {
+	return uint32((n + size - 1) / size)
+}
+
+// Run runs dispatches one after the other and waits for them to finish.
+func (d *Device) Run(dispatches ...Dispatch) error {
+	job, err := d.Submit(dispatches...)
+	if err != nil {
+		return err
+	}
+	return job.Wait()
+}
+
+// Submit starts running dispatches one after the other and returns without
+// waiting for them. Each dispatch sees everything the ones before it wrote,
+// and once the Job is done the host sees everything they all wrote.
+func (d *Device) Submit(dispatches ...Dispatch) (*Job, error) {
+	cbs, err := d.ctx.Commands.Allocate(1)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't allocate compute command buffer")
+	}
+	job := &Job{device: d, cb: cbs[0]}
+
+	if err := commands.Record(job.cb, func(cb vk.CommandBuffer) {
+		for i, dispatch := range dispatches {
+			if i > 0 {
+				cmdMemoryBarrier(cb,
+					vk.PipelineStageComputeShaderBit, vk.AccessShaderWriteBit,
+					vk.PipelineStageComputeShaderBit, vk.AccessShaderReadBit|vk.AccessShaderWriteBit)
+			}
+			dispatch.record(cb)
+		}
+		cmdMemoryBarrier(cb,
+			vk.PipelineStageComputeShaderBit, vk.AccessShaderWriteBit,
+			vk.PipelineStageHostBit, vk.AccessHostReadBit)
+	}); err != nil {
+		job.release()
+		return nil, errors.Wrap(err, "can't record compute command buffer")
+	}
+
+	fenceInfo := &vk.FenceCreateInfo{SType: vk.StructureTypeFenceCreateInfo}
+	if err := vk.Error(vk.CreateFence(d.ctx.Device, fenceInfo, nil, &job.fence)); err != nil {
+		job.release()
+		return nil, errors.Wrap(err, "can't create compute fence")
+	}
+
+	submitInfo := []vk.SubmitInfo{{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    []vk.CommandBuffer{job.cb},
+	}}
+	if err := vk.Error(vk.QueueSubmit(d.ctx.Queue, 1, submitInfo, job.fence)); err != nil {
+		job.release()
+		return nil, errors.Wrap(err, "can't submit compute command buffer")
+	}
+	return job, nil
+}
+
+// record records binding the dispatch's kernel and running it. Storage
+// images have to be in the general layout while it runs.
+func (dispatch Dispatch) record(cb vk.CommandBuffer) {
+	k := dispatch.kernel
+	for _, img := range dispatch.images {
+		img.CmdTransitionTo(cb, vk.ImageLayoutGeneral)
+	}
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointCompute, k.pipeline)
+	if dispatch.set != vk.NullDescriptorSet {
+		vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointCompute, k.layout, 0, 1, []vk.DescriptorSet{dispatch.set}, 0, nil)
+	}
+	if len(dispatch.constants) > 0 {
+		vk.CmdPushConstants(cb, k.layout, vk.ShaderStageFlags(vk.ShaderStageComputeBit), 0, uint32(len(dispatch.constants)), unsafe.Pointer(&dispatch.constants[0]))
+	}
+	vk.CmdDispatch(cb, dispatch.groups[0], dispatch.groups[1], dispatch.groups[2])
+}
+
+// Job is dispatches submitted together.
+type Job struct {
+	device *Device
+	cb     vk.CommandBuffer
+	fence  vk.Fence
+	done   bool
+}
+
+// Done reports whether the job has finished, without waiting for it.
+func (j *Job) Done() (bool, error) {
+	if j.done {
+		return true, nil
+	}
+	switch result := vk.GetFenceStatus(j.device.ctx.Device, j.fence); result {
+	case vk.Success:
+		j.release()
+		return true, nil
+	case vk.NotReady:
+		return false, nil
+	default:
+		return false, errors.Wrap(vk.Error(result), "can't get compute fence status")
+	}
+}
+
+// Wait waits for the job to finish.
+func (j *Job) Wait() error {
+	if j.done {
+		return nil
+	}
+	if err := vk.Error(vk.WaitForFences(j.device.ctx.Device, 1, []vk.Fence{j.fence}, vk.True, math.MaxUint64)); err != nil {
+		return errors.Wrap(err, "can't wait for compute fence")
+	}
+	j.release()
+	return nil
+}
+
+// release frees the job's command buffer and fence once it's finished or
+// never got submitted.
+func (j *Job) release() {
+	j.done = true
+	if j.fence != vk.NullFence {
+		vk.DestroyFence(j.device.ctx.Device, j.fence, nil)
+		j.fence = vk.NullFence
+	}
+	j.device.ctx.Commands.Free([]vk.CommandBuffer{j.cb})
+}
+
+// Destroy destroys the device's command pool. Every job has to have
+// finished.
+func (d *Device) Destroy() {
+	if d.ctx.Commands != nil {
+		d.ctx.Commands.Destroy()
+		d.ctx.Commands = nil
+	}
+}
+
+// cmdMemoryBarrier records a barrier making src's writes to any memory
+// visible to dst's accesses.
+func cmdMemoryBarrier(cb vk.CommandBuffer, srcStage vk.PipelineStageFlagBits, srcAccess vk.AccessFlagBits, dstStage vk.PipelineStageFlagBits, dstAccess vk.AccessFlagBits) {
+	vk.CmdPipelineBarrier(cb,
+		vk.PipelineStageFlags(srcStage),
+		vk.PipelineStageFlags(dstStage),
+		0,
+		1, []vk.MemoryBarrier{{
+			SType:         vk.StructureTypeMemoryBarrier,
+			SrcAccessMask: vk.AccessFlags(srcAccess),
+			DstAccessMask: vk.AccessFlags(dstAccess),
+		}},
+		0, nil,
+		0, nil,
+	)
+}
@@ -0,0 +1,259 @@
+package gpgpu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// resource is what a binding is bound to.
+type resource struct {
+	buffer *gpu.Buffer
+	image  *gpu.Image
+}
+
+// Kernel is a compute shader ready to dispatch. Its bindings, all in
+// descriptor set 0, and push constants are found by reflecting its SPIR-V.
+type Kernel struct {
+	device *Device
+
+	bindings    map[uint32]spirv.Binding
+	setLayout   vk.DescriptorSetLayout
+	layout      vk.PipelineLayout
+	pipeline    vk.Pipeline
+	descriptors *descriptors.Allocator
+	// sets are written once for every combination of resources the kernel
+	// is dispatched with, keyed by the resources' handles.
+	sets map[string]vk.DescriptorSet
+
+	bound         map[uint32]resource
+	constants     []byte
+	constantsSize uint32
+}
+
+// NewKernel creates a kernel on d from a compute shader's SPIR-V.
+func (d *Device) NewKernel(code []byte) (*Kernel, error) {
+	module, err := spirv.Reflect(code)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't reflect kernel")
+	}
+	if module.Stage != vk.ShaderStageComputeBit {
+		return nil, errors.New("kernel isn't a compute shader")
+	}
+
+	k := &Kernel{
+		device:        d,
+		bindings:      map[uint32]spirv.Binding{},
+		sets:          map[string]vk.DescriptorSet{},
+		bound:         map[uint32]resource{},
+		constantsSize: module.PushConstantSize,
+	}
+	for _, b := range module.Bindings {
+		if b.Set != 0 {
+			return nil, errors.Errorf("kernel binding %d is in set %d, only set 0 is supported", b.Binding, b.Set)
+		}
+		k.bindings[b.Binding] = b
+	}
+
+	bindings, err := pipeline.MergeBindings(module)
+	if err != nil {
+		return nil, err
+	}
+	layouts, err := pipeline.NewSetLayouts(d.ctx.Device, bindings)
+	if err != nil {
+		return nil, err
+	}
+	if len(layouts) > 0 {
+		k.setLayout = layouts[0]
+	}
+	if k.layout, err = pipeline.NewLayout(d.ctx.Device, layouts, pipeline.PushConstantRanges(module)); err != nil {
+		k.Destroy()
+		return nil, err
+	}
+	if k.pipeline, err = pipeline.NewCompute(d.ctx.Device, k.layout, code); err != nil {
+		k.Destroy()
+		return nil, errors.Wrap(err, "can't create kernel pipeline")
+	}
+	if len(bindings) > 0 {
+		k.descriptors = descriptors.NewAllocator(d.ctx.Device, descriptors.Ratios(bindings), 0)
+	}
+	return k, nil
+}
+
+// BindBuffer binds b to a storage or uniform buffer binding.
+func (k *Kernel) BindBuffer(binding uint32, b *gpu.Buffer) error {
+	if err := k.check(binding, vk.DescriptorTypeStorageBuffer, vk.DescriptorTypeUniformBuffer); err != nil {
+		return err
+	}
+	k.bound[binding] = resource{buffer: b}
+	return nil
+}
+
+// BindArray binds a to a storage buffer binding.
+func BindArray[T any](k *Kernel, binding uint32, a *Array[T]) error {
+	if err := k.check(binding, vk.DescriptorTypeStorageBuffer); err != nil {
+		return err
+	}
+	k.bound[binding] = resource{buffer: a.Buffer}
+	return nil
+}
+
+// BindImage binds img to a storage image binding. It's moved to the general
+// layout when it's dispatched and left there.
+func (k *Kernel) BindImage(binding uint32, img *gpu.Image) error {
+	if err := k.check(binding, vk.DescriptorTypeStorageImage); err != nil {
+		return err
+	}
+	k.bound[binding] = resource{image: img}
+	return nil
+}
+
+// check returns an error if the kernel has no binding of one of types at
+// binding.
+func (k *Kernel) check(binding uint32, types ...vk.DescriptorType) error {
+	b, ok := k.bindings[binding]
+	if !ok {
+		return errors.Errorf("kernel has no binding %d", binding)
+	}
+	for _, t := range types {
+		if b.Type == t {
+			return nil
+		}
+	}
+	return errors.Errorf("kernel binding %d is a %s descriptor", binding, descriptorTypeName(b.Type))
+}
+
+// SetConstants sets the push constants of the kernel's later dispatches to
+// value, which must be laid out like its push_constant block.
+func SetConstants[T any](k *Kernel, value T) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, value); err != nil {
+		return errors.Wrapf(err, "can't encode %T as push constants", value)
+	}
+	if uint32(buf.Len()) > k.constantsSize {
+		return errors.Errorf("%d bytes of constants don't fit the kernel's %d byte block", buf.Len(), k.constantsSize)
+	}
+	k.constants = buf.Bytes()
+	return nil
+}
+
+// Dispatch runs the kernel over x by y by z workgroups with what's bound to
+// it now, when it's passed to Device.Run or Device.Submit. Every binding
+// has to be bound.
+func (k *Kernel) Dispatch(x, y, z uint32) (Dispatch, error) {
+	dispatch := Dispatch{
+		kernel:    k,
+		constants: append([]byte(nil), k.constants...),
+		groups:    [3]uint32{x, y, z},
+	}
+	if len(k.bindings) == 0 {
+		return dispatch, nil
+	}
+
+	key := make([]string, 0, len(k.bindings))
+	for binding := range k.bindings {
+		r, ok := k.bound[binding]
+		if !ok {
+			return Dispatch{}, errors.Errorf("kernel binding %d isn't bound", binding)
+		}
+		if r.image != nil {
+			dispatch.images = append(dispatch.images, r.image)
+			key = append(key, fmt.Sprintf("%d:%v", binding, r.image.Handle))
+		} else {
+			key = append(key, fmt.Sprintf("%d:%v", binding, r.buffer.Handle))
+		}
+	}
+	// Map order is random, the key mustn't be
+	sort.Strings(key)
+
+	var err error
+	if dispatch.set, err = k.set(strings.Join(key, ",")); err != nil {
+		return Dispatch{}, err
+	}
+	return dispatch, nil
+}
+
+// set is the descriptor set for what's bound now, written the first time
+// it's needed.
+func (k *Kernel) set(key string) (vk.DescriptorSet, error) {
+	if set, ok := k.sets[key]; ok {
+		return set, nil
+	}
+	set, err := k.descriptors.Allocate(k.setLayout)
+	if err != nil {
+		return vk.NullDescriptorSet, errors.Wrap(err, "can't allocate kernel descriptor set")
+	}
+
+	writes := make([]vk.WriteDescriptorSet, 0, len(k.bindings))
+	for binding, b := range k.bindings {
+		r := k.bound[binding]
+		write := vk.WriteDescriptorSet{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      binding,
+			DescriptorType:  b.Type,
+			DescriptorCount: 1,
+		}
+		if r.image != nil {
+			write.PImageInfo = []vk.DescriptorImageInfo{{
+				ImageLayout: vk.ImageLayoutGeneral,
+				ImageView:   r.image.View,
+			}}
+		} else {
+			write.PBufferInfo = []vk.DescriptorBufferInfo{{
+				Buffer: r.buffer.Handle,
+				Offset: 0,
+				Range:  r.buffer.Size,
+			}}
+		}
+		writes = append(writes, write)
+	}
+	vk.UpdateDescriptorSets(k.device.ctx.Device, uint32(len(writes)), writes, 0, nil)
+	k.sets[key] = set
+	return set, nil
+}
+
+// Destroy destroys the kernel. No job dispatching it can still be running.
+func (k *Kernel) Destroy() {
+	device := k.device.ctx.Device
+	if k.descriptors != nil {
+		k.descriptors.Destroy()
+		k.descriptors = nil
+	}
+	k.sets = nil
+	if k.pipeline != vk.NullPipeline {
+		vk.DestroyPipeline(device, k.pipeline, nil)
+		k.pipeline = vk.NullPipeline
+	}
+	if k.layout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(device, k.layout, nil)
+		k.layout = vk.NullPipelineLayout
+	}
+	if k.setLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(device, k.setLayout, nil)
+		k.setLayout = vk.NullDescriptorSetLayout
+	}
+}
+
+func descriptorTypeName(t vk.DescriptorType) string {
+	switch t {
+	case vk.DescriptorTypeStorageBuffer:
+		return "storage buffer"
+	case vk.DescriptorTypeUniformBuffer:
+		return "uniform buffer"
+	case vk.DescriptorTypeStorageImage:
+		return "storage image"
+	case vk.DescriptorTypeCombinedImageSampler:
+		return "combined image sampler"
+	}
+	return fmt.Sprintf("type %d", t)
+}
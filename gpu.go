@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// gpuEnv selects the GPU like the --gpu flag, the flag wins when both are set.
+const gpuEnv = "LEARNVULKAN_GPU"
+
+func physicalDeviceName(device vk.PhysicalDevice) string {
+	var properties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(device, &properties)
+	properties.Deref()
+	return vk.ToString(properties.DeviceName[:])
+}
+
+// listGPUs prints a description of every physical device to w. It only
+// creates a bare instance, no window, so it works where rendering wouldn't.
+func listGPUs(w io.Writer) error {
+	if err := glfw.Init(); err != nil {
+		return errors.Wrap(err, "can't init GLFW")
+	}
+	defer glfw.Terminate()
+
+	procAddr := glfw.GetVulkanGetInstanceProcAddress()
+	if procAddr == nil {
+		return errors.New("GLFW instanceProcAddress is nil")
+	}
+	vk.SetGetInstanceProcAddr(procAddr)
+	if err := vk.Init(); err != nil {
+		return errors.Wrap(err, "can't vk.init()")
+	}
+
+	var instance vk.Instance
+	createInfo := &vk.InstanceCreateInfo{
+		SType: vk.StructureTypeInstanceCreateInfo,
+		PApplicationInfo: &vk.ApplicationInfo{
+			SType:              vk.StructureTypeApplicationInfo,
+			PApplicationName:   defaultTitle,
+			ApplicationVersion: vk.MakeVersion(1, 0, 0),
+			PEngineName:        "Ingot",
+			EngineVersion:      vk.MakeVersion(1, 0, 0),
+			ApiVersion:         vk.ApiVersion11,
+		},
+	}
+	if err := enablePortabilityEnumeration(loaderVulkan{}, createInfo); err != nil {
+		return errors.Wrap(err, "can't check for portability enumeration")
+	}
+	if err := vk.Error(vk.CreateInstance(createInfo, nil, &instance)); err != nil {
+		return errors.Wrap(err, "can't create instance")
+	}
+	defer vk.DestroyInstance(instance, nil)
+
+	var deviceCount uint32
+	if err := vk.Error(vk.EnumeratePhysicalDevices(instance, &deviceCount, nil)); err != nil {
+		return errors.Wrap(err, "can't get physical device count")
+	}
+	devices := make([]vk.PhysicalDevice, deviceCount)
+	if err := vk.Error(vk.EnumeratePhysicalDevices(instance, &deviceCount, devices)); err != nil {
+		return errors.Wrap(err, "can't get physical devices")
+	}
+
+	if len(devices) == 0 {
+		fmt.Fprintln(w, "No Vulkan devices found")
+		return nil
+	}
+	for i, d := range devices {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		describeGPU(w, i, d)
+	}
+	return nil
+}
+
+func describeGPU(w io.Writer, index int, device vk.PhysicalDevice) {
+	var properties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(device, &properties)
+	properties.Deref()
+
+	fmt.Fprintf(w, "GPU %d: %s\n", index, vk.ToString(properties.DeviceName[:]))
+	fmt.Fprintf(w, "  Type:           %s\n", deviceTypeString(properties.DeviceType))
+	fmt.Fprintf(w, "  Vendor/device:  %#04x/%#04x\n", properties.VendorID, properties.DeviceID)
+	fmt.Fprintf(w, "  API version:    %s\n", versionString(properties.ApiVersion))
+	fmt.Fprintf(w, "  Driver version: %s\n", driverVersionString(properties.VendorID, properties.DriverVersion))
+
+	var memory vk.PhysicalDeviceMemoryProperties
+	vk.GetPhysicalDeviceMemoryProperties(device, &memory)
+	memory.Deref()
+	fmt.Fprintln(w, "  Memory heaps:")
+	for i := uint32(0); i < memory.MemoryHeapCount; i++ {
+		heap := memory.MemoryHeaps[i]
+		heap.Deref()
+		location := "host"
+		if heap.Flags&vk.MemoryHeapFlags(vk.MemoryHeapDeviceLocalBit) != 0 {
+			location = "device local"
+		}
+		fmt.Fprintf(w, "    %d: %d MiB, %s\n", i, heap.Size>>20, location)
+	}
+
+	fmt.Fprintln(w, "  Queue families:")
+	for i, family := range queueFamilyProperties(device) {
+		fmt.Fprintf(w, "    %d: %d queues, %s\n", i, family.QueueCount, queueFlagsString(family.QueueFlags))
+	}
+}
+
+func deviceTypeString(t vk.PhysicalDeviceType) string {
+	switch t {
+	case vk.PhysicalDeviceTypeIntegratedGpu:
+		return "integrated GPU"
+	case vk.PhysicalDeviceTypeDiscreteGpu:
+		return "discrete GPU"
+	case vk.PhysicalDeviceTypeVirtualGpu:
+		return "virtual GPU"
+	case vk.PhysicalDeviceTypeCpu:
+		return "CPU"
+	}
+	return "other"
+}
+
+// versionString decodes a version made with VK_MAKE_VERSION.
+func versionString(v uint32) string {
+	return fmt.Sprintf("%d.%d.%d", v>>22, (v>>12)&0x3ff, v&0xfff)
+}
+
+// driverVersionString decodes a driver version, which is vendor specific.
+// NVIDIA packs it 10.8.8.6, everyone else mostly follows VK_MAKE_VERSION.
+func driverVersionString(vendorID, v uint32) string {
+	const nvidia = 0x10de
+	if vendorID == nvidia {
+		return fmt.Sprintf("%d.%d.%d.%d", v>>22, (v>>14)&0xff, (v>>6)&0xff, v&0x3f)
+	}
+	return versionString(v)
+}
+
+func queueFlagsString(flags vk.QueueFlags) string {
+	names := []struct {
+		bit  vk.QueueFlagBits
+		name string
+	}{
+		{vk.QueueGraphicsBit, "graphics"},
+		{vk.QueueComputeBit, "compute"},
+		{vk.QueueTransferBit, "transfer"},
+		{vk.QueueSparseBindingBit, "sparse binding"},
+	}
+
+	var supported []string
+	for _, n := range names {
+		if flags&vk.QueueFlags(n.bit) != 0 {
+			supported = append(supported, n.name)
+		}
+	}
+	if len(supported) == 0 {
+		return "no operations"
+	}
+	return strings.Join(supported, ", ")
+}
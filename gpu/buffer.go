@@ -0,0 +1,324 @@
+// Package gpu wraps buffers and images so creating, binding memory to,
+// filling and destroying them is a single call each.
+package gpu
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/leaks"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Context is what creating and filling resources needs. Commands and Queue
+// run the copies out of staging buffers. With an Uploader uploads are staged
+// through it instead, and aren't done until it's flushed.
+type Context struct {
+	Device    vk.Device
+	Allocator *memory.Allocator
+	Commands  *commands.Pool
+	Queue     vk.Queue
+	Uploader  *Uploader
+	// SharedFamilies shares buffers between these queue families
+	// concurrently when there's more than one, so work on any of them can
+	// use the buffers without transferring ownership.
+	SharedFamilies []uint32
+	// ExtraUsage is added to the usage of every buffer created, for
+	// buffers something else reads too, like acceleration structure builds.
+	ExtraUsage vk.BufferUsageFlags
+	// Leaks tracks the buffers, images and views created until they're
+	// destroyed, nil tracks nothing.
+	Leaks *leaks.Registry
+}
+
+// Buffer is a vk.Buffer together with the memory bound to it. Host visible
+// buffers stay mapped for as long as they live.
+type Buffer struct {
+	device    vk.Device
+	allocator *memory.Allocator
+	leaks     *leaks.Registry
+
+	Handle     vk.Buffer
+	Allocation *memory.Allocation
+	Size       vk.DeviceSize
+	// Concurrent is whether the buffer is shared between queue families.
+	Concurrent bool
+}
+
+// NewBuffer creates a buffer with memory for memUsage bound to it.
+func NewBuffer(ctx Context, size vk.DeviceSize, usage vk.BufferUsageFlags, memUsage memory.Usage) (*Buffer, error) {
+	bufferInfo := &vk.BufferCreateInfo{
+		SType:       vk.StructureTypeBufferCreateInfo,
+		Size:        size,
+		Usage:       usage | ctx.ExtraUsage,
+		SharingMode: vk.SharingModeExclusive,
+	}
+	if len(ctx.SharedFamilies) > 1 {
+		bufferInfo.SharingMode = vk.SharingModeConcurrent
+		bufferInfo.QueueFamilyIndexCount = uint32(len(ctx.SharedFamilies))
+		bufferInfo.PQueueFamilyIndices = ctx.SharedFamilies
+	}
+
+	b := &Buffer{
+		device:     ctx.Device,
+		allocator:  ctx.Allocator,
+		leaks:      ctx.Leaks,
+		Size:       size,
+		Concurrent: bufferInfo.SharingMode == vk.SharingModeConcurrent,
+	}
+	if err := vk.Error(vk.CreateBuffer(ctx.Device, bufferInfo, nil, &b.Handle)); err != nil {
+		return nil, errors.Wrap(err, "can't create buffer")
+	}
+	ctx.Leaks.Track("buffer", b.Handle)
+
+	alloc, err := ctx.Allocator.AllocateBuffer(b.Handle, memUsage)
+	if err != nil {
+		b.Destroy()
+		return nil, errors.Wrap(err, "can't allocate buffer memory")
+	}
+	b.Allocation = alloc
+	return b, nil
+}
+
+// NewDeviceLocalBuffer uploads data into a new GPU only buffer through a
+// staging buffer, usage gets TRANSFER_DST added for the copy.
+func NewDeviceLocalBuffer(ctx Context, data []byte, usage vk.BufferUsageFlags) (*Buffer, error) {
+	size := vk.DeviceSize(len(data))
+
+	if ctx.Uploader != nil {
+		b, err := NewBuffer(ctx, size, usage|vk.BufferUsageFlags(vk.BufferUsageTransferDstBit), memory.GPUOnly)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't create device local buffer")
+		}
+		if err := ctx.Uploader.Buffer(b, 0, data); err != nil {
+			b.Destroy()
+			return nil, errors.Wrap(err, "can't stage device local buffer")
+		}
+		return b, nil
+	}
+
+	staging, err := NewBuffer(ctx, size, vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit), memory.CPUToGPU)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create staging buffer")
+	}
+	defer staging.Destroy()
+
+	if err := staging.Upload(data); err != nil {
+		return nil, errors.Wrap(err, "can't fill staging buffer")
+	}
+
+	b, err := NewBuffer(ctx, size, usage|vk.BufferUsageFlags(vk.BufferUsageTransferDstBit), memory.GPUOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create device local buffer")
+	}
+
+	if err := CopyBuffer(ctx, staging, b, size); err != nil {
+		b.Destroy()
+		return nil, errors.Wrap(err, "can't copy staging buffer")
+	}
+	return b, nil
+}
+
+// CopyBuffer copies the first size bytes of src into dst and waits for it.
+func CopyBuffer(ctx Context, src, dst *Buffer, size vk.DeviceSize) error {
+	return ctx.Commands.OneTimeSubmit(ctx.Queue, func(cb vk.CommandBuffer) {
+		vk.CmdCopyBuffer(cb, src.Handle, dst.Handle, 1, []vk.BufferCopy{{
+			SrcOffset: 0,
+			DstOffset: 0,
+			Size:      size,
+		}})
+	})
+}
+
+// NewVertexBuffer uploads vertices into a GPU only vertex buffer. T has to
+// be a fixed size type laid out like the vertex shader's inputs.
+func NewVertexBuffer[T any](ctx Context, vertices []T) (*Buffer, error) {
+	data, err := encode(vertices)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeviceLocalBuffer(ctx, data, vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit))
+}
+
+// NewStorageBuffer uploads values into a GPU only storage buffer. T has to
+// be a fixed size type laid out like the shader's std430 struct.
+func NewStorageBuffer[T any](ctx Context, values []T) (*Buffer, error) {
+	data, err := encode(values)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeviceLocalBuffer(ctx, data, vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit))
+}
+
+// NewIndexBuffer uploads indices into a GPU only index buffer, returning the
+// index type to bind it with.
+func NewIndexBuffer[T uint16 | uint32](ctx Context, indices []T) (*Buffer, vk.IndexType, error) {
+	indexType := vk.IndexTypeUint32
+	var zero T
+	if binary.Size(zero) == 2 {
+		indexType = vk.IndexTypeUint16
+	}
+
+	data, err := encode(indices)
+	if err != nil {
+		return nil, indexType, err
+	}
+	b, err := NewDeviceLocalBuffer(ctx, data, vk.BufferUsageFlags(vk.BufferUsageIndexBufferBit))
+	return b, indexType, err
+}
+
+// UniformBuffer is a host visible uniform buffer holding a single T.
+type UniformBuffer[T any] struct {
+	*Buffer
+}
+
+// NewUniformBuffer creates a uniform buffer sized for T, which has to be a
+// fixed size type laid out like the shader's std140 block.
+func NewUniformBuffer[T any](ctx Context) (*UniformBuffer[T], error) {
+	var zero T
+	size := binary.Size(zero)
+	if size <= 0 {
+		return nil, errors.Errorf("%T isn't a fixed size type", zero)
+	}
+
+	b, err := NewBuffer(ctx, vk.DeviceSize(size), vk.BufferUsageFlags(vk.BufferUsageUniformBufferBit), memory.CPUToGPU)
+	if err != nil {
+		return nil, err
+	}
+	return &UniformBuffer[T]{Buffer: b}, nil
+}
+
+// Write replaces the buffer's contents with value.
+func (u *UniformBuffer[T]) Write(value T) error {
+	var buf bytes.Buffer
+	// Writing to a bytes.Buffer can't fail and T was checked to be fixed size
+	_ = binary.Write(&buf, binary.LittleEndian, value)
+	return u.Upload(buf.Bytes())
+}
+
+// DynamicUniformBuffer is a host visible uniform buffer holding Count Ts,
+// one per object, for a UNIFORM_BUFFER_DYNAMIC descriptor. The descriptor
+// covers a single T and each object's is picked with its Offset at bind
+// time, so every object shares one descriptor set.
+type DynamicUniformBuffer[T any] struct {
+	*Buffer
+	// Stride is the distance between objects, the size of T rounded up to
+	// the device's minUniformBufferOffsetAlignment.
+	Stride vk.DeviceSize
+	// Range is the size of a single T, what the descriptor covers.
+	Range vk.DeviceSize
+	Count int
+}
+
+// NewDynamicUniformBuffer creates a uniform buffer for count Ts, each
+// starting at a multiple of alignment, the device's
+// minUniformBufferOffsetAlignment. T has to be laid out like the shader's
+// std140 block.
+func NewDynamicUniformBuffer[T any](ctx Context, count int, alignment vk.DeviceSize) (*DynamicUniformBuffer[T], error) {
+	var zero T
+	size := binary.Size(zero)
+	if size <= 0 {
+		return nil, errors.Errorf("%T isn't a fixed size type", zero)
+	}
+	if count < 1 {
+		return nil, errors.Errorf("a dynamic uniform buffer needs at least 1 object, not %d", count)
+	}
+	if alignment == 0 {
+		alignment = 1
+	}
+
+	stride := (vk.DeviceSize(size) + alignment - 1) / alignment * alignment
+	b, err := NewBuffer(ctx, stride*vk.DeviceSize(count), vk.BufferUsageFlags(vk.BufferUsageUniformBufferBit), memory.CPUToGPU)
+	if err != nil {
+		return nil, err
+	}
+	return &DynamicUniformBuffer[T]{
+		Buffer: b,
+		Stride: stride,
+		Range:  vk.DeviceSize(size),
+		Count:  count,
+	}, nil
+}
+
+// Write replaces object i's value.
+func (u *DynamicUniformBuffer[T]) Write(i int, value T) error {
+	if i < 0 || i >= u.Count {
+		return errors.Errorf("object %d out of range of %d", i, u.Count)
+	}
+	mapped := u.Mapped()
+	if mapped == nil {
+		return errors.New("buffer memory isn't host visible")
+	}
+	var buf bytes.Buffer
+	// Writing to a bytes.Buffer can't fail and T was checked to be fixed size
+	_ = binary.Write(&buf, binary.LittleEndian, value)
+	copy(mapped[u.Offset(i):], buf.Bytes())
+	return nil
+}
+
+// Offset is the dynamic offset to bind object i with.
+func (u *DynamicUniformBuffer[T]) Offset(i int) uint32 {
+	return uint32(vk.DeviceSize(i) * u.Stride)
+}
+
+// Mapped is the buffer's memory as the host sees it, nil when it isn't
+// host visible.
+func (b *Buffer) Mapped() []byte {
+	return b.Allocation.Mapped()
+}
+
+// Upload copies data to the start of a host visible buffer.
+func (b *Buffer) Upload(data []byte) error {
+	if vk.DeviceSize(len(data)) > b.Size {
+		return errors.Errorf("%d bytes don't fit in a %d byte buffer", len(data), b.Size)
+	}
+	mapped := b.Mapped()
+	if mapped == nil {
+		return errors.New("buffer memory isn't host visible")
+	}
+	copy(mapped, data)
+	return nil
+}
+
+// Download copies the start of a host visible buffer into data.
+func (b *Buffer) Download(data []byte) error {
+	if vk.DeviceSize(len(data)) > b.Size {
+		return errors.Errorf("can't read %d bytes from a %d byte buffer", len(data), b.Size)
+	}
+	mapped := b.Mapped()
+	if mapped == nil {
+		return errors.New("buffer memory isn't host visible")
+	}
+	copy(data, mapped)
+	return nil
+}
+
+// Destroy releases the buffer and its memory.
+func (b *Buffer) Destroy() {
+	if b.Handle != vk.NullBuffer {
+		b.leaks.Release(b.Handle)
+		vk.DestroyBuffer(b.device, b.Handle, nil)
+		b.Handle = vk.NullBuffer
+	}
+	if b.Allocation != nil {
+		b.allocator.Free(b.Allocation)
+		b.Allocation = nil
+	}
+}
+
+// encode lays values out exactly as the GPU reads them.
+func encode[T any](values []T) ([]byte, error) {
+	if len(values) == 0 {
+		return nil, errors.New("no data to upload")
+	}
+	if binary.Size(values) < 0 {
+		return nil, errors.Errorf("%T isn't a fixed size type", values[0])
+	}
+	var buf bytes.Buffer
+	// Writing to a bytes.Buffer can't fail and T was checked to be fixed size
+	_ = binary.Write(&buf, binary.LittleEndian, values)
+	return buf.Bytes(), nil
+}
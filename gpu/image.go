@@ -0,0 +1,371 @@
+package gpu
+
+import (
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// ImageInfo describes a 2D image or cube map for NewImage.
+type ImageInfo struct {
+	Width  uint32
+	Height uint32
+	// MipLevels is how many levels the image and its view have, zero is 1.
+	MipLevels uint32
+	// Cube makes the image six square layers, one per face in +X, -X, +Y,
+	// -Y, +Z, -Z order, viewed as a cube map.
+	Cube bool
+	// Layers makes a 2D array of that many layers, like multiview's
+	// attachments. Zero is 1, it's ignored for cube maps.
+	Layers uint32
+	// Samples is the sample count, zero is 1.
+	Samples vk.SampleCountFlagBits
+	Format  vk.Format
+	Tiling  vk.ImageTiling
+	Usage   vk.ImageUsageFlags
+	// Aspect is what the view covers, zero is color.
+	Aspect vk.ImageAspectFlags
+	Memory memory.Usage
+}
+
+// Image is a 2D or cube vk.Image together with its memory, a view over all
+// of its mip levels and layers and the layout they're in.
+type Image struct {
+	ctx Context
+
+	Handle     vk.Image
+	Allocation *memory.Allocation
+	View       vk.ImageView
+	Format     vk.Format
+	Width      uint32
+	Height     uint32
+	MipLevels  uint32
+	// Layers is 6 for cube maps, ImageInfo.Layers otherwise. Copies and barriers cover
+	// every layer.
+	Layers uint32
+	Aspect vk.ImageAspectFlags
+	// Layout is the layout of every mip level after the commands recorded
+	// through the image's methods. Anything else that changes it, like a
+	// render pass's final layout, has to update it.
+	Layout vk.ImageLayout
+}
+
+// NewImage creates an image with memory for info.Memory bound to it and a
+// view over it. It starts out in UNDEFINED layout.
+func NewImage(ctx Context, info ImageInfo) (*Image, error) {
+	if info.MipLevels == 0 {
+		info.MipLevels = 1
+	}
+	if info.Samples == 0 {
+		info.Samples = vk.SampleCount1Bit
+	}
+	if info.Aspect == 0 {
+		info.Aspect = vk.ImageAspectFlags(vk.ImageAspectColorBit)
+	}
+	layers, viewType, flags := uint32(1), vk.ImageViewType2d, vk.ImageCreateFlags(0)
+	if info.Layers > 1 {
+		layers, viewType = info.Layers, vk.ImageViewType2dArray
+	}
+	if info.Cube {
+		if info.Width != info.Height {
+			return nil, errors.Errorf("cube map faces have to be square, not %dx%d", info.Width, info.Height)
+		}
+		layers, viewType, flags = 6, vk.ImageViewTypeCube, vk.ImageCreateFlags(vk.ImageCreateCubeCompatibleBit)
+	}
+
+	imageInfo := &vk.ImageCreateInfo{
+		SType:     vk.StructureTypeImageCreateInfo,
+		Flags:     flags,
+		ImageType: vk.ImageType2d,
+		Extent: vk.Extent3D{
+			Width:  info.Width,
+			Height: info.Height,
+			Depth:  1,
+		},
+		MipLevels:     info.MipLevels,
+		ArrayLayers:   layers,
+		Format:        info.Format,
+		Tiling:        info.Tiling,
+		InitialLayout: vk.ImageLayoutUndefined,
+		Usage:         info.Usage,
+		Samples:       info.Samples,
+		SharingMode:   vk.SharingModeExclusive,
+	}
+
+	img := &Image{
+		ctx:       ctx,
+		Format:    info.Format,
+		Width:     info.Width,
+		Height:    info.Height,
+		MipLevels: info.MipLevels,
+		Layers:    layers,
+		Aspect:    info.Aspect,
+		Layout:    vk.ImageLayoutUndefined,
+	}
+	if err := vk.Error(vk.CreateImage(ctx.Device, imageInfo, nil, &img.Handle)); err != nil {
+		return nil, errors.Wrap(err, "can't create image")
+	}
+	ctx.Leaks.Track("image", img.Handle)
+
+	alloc, err := ctx.Allocator.AllocateImage(img.Handle, info.Tiling == vk.ImageTilingOptimal, info.Memory)
+	if err != nil {
+		img.Destroy()
+		return nil, errors.Wrap(err, "can't allocate image memory")
+	}
+	img.Allocation = alloc
+
+	viewInfo := &vk.ImageViewCreateInfo{
+		SType:    vk.StructureTypeImageViewCreateInfo,
+		Image:    img.Handle,
+		ViewType: viewType,
+		Format:   info.Format,
+		Components: vk.ComponentMapping{
+			R: vk.ComponentSwizzleIdentity,
+			G: vk.ComponentSwizzleIdentity,
+			B: vk.ComponentSwizzleIdentity,
+			A: vk.ComponentSwizzleIdentity,
+		},
+		SubresourceRange: img.subresourceRange(0, img.MipLevels),
+	}
+	if err := vk.Error(vk.CreateImageView(ctx.Device, viewInfo, nil, &img.View)); err != nil {
+		img.Destroy()
+		return nil, errors.Wrap(err, "can't create image view")
+	}
+	ctx.Leaks.Track("image view", img.View)
+
+	return img, nil
+}
+
+// TransitionTo moves every mip level into layout and waits for it.
+func (img *Image) TransitionTo(layout vk.ImageLayout) error {
+	return img.ctx.Commands.OneTimeSubmit(img.ctx.Queue, func(cb vk.CommandBuffer) {
+		img.CmdTransitionTo(cb, layout)
+	})
+}
+
+// CmdTransitionTo records a barrier moving every mip level from its current
+// layout into layout, nothing is recorded if it's already there.
+func (img *Image) CmdTransitionTo(cb vk.CommandBuffer, layout vk.ImageLayout) {
+	if img.Layout == layout {
+		return
+	}
+	img.cmdBarrier(cb, 0, img.MipLevels, img.Layout, layout)
+	img.Layout = layout
+}
+
+// CmdBarrierTo is CmdTransitionTo but records the barrier even if the image
+// is already in layout, for writes that have to wait on earlier accesses in
+// the same layout.
+func (img *Image) CmdBarrierTo(cb vk.CommandBuffer, layout vk.ImageLayout) {
+	img.cmdBarrier(cb, 0, img.MipLevels, img.Layout, layout)
+	img.Layout = layout
+}
+
+// CopyFromBuffer copies tightly packed pixels from src into mip level 0 and
+// waits for it, leaving the image in TRANSFER_DST_OPTIMAL. Layers follow
+// each other in src.
+func (img *Image) CopyFromBuffer(src *Buffer) error {
+	return img.ctx.Commands.OneTimeSubmit(img.ctx.Queue, func(cb vk.CommandBuffer) {
+		img.CmdCopyFromBuffer(cb, src)
+	})
+}
+
+// CmdCopyFromBuffer records a copy of tightly packed pixels from src into
+// mip level 0, transitioning to TRANSFER_DST_OPTIMAL first.
+func (img *Image) CmdCopyFromBuffer(cb vk.CommandBuffer, src *Buffer) {
+	img.cmdCopyFrom(cb, src.Handle, 0)
+}
+
+func (img *Image) cmdCopyFrom(cb vk.CommandBuffer, src vk.Buffer, offset vk.DeviceSize) {
+	img.cmdCopyLevelsFrom(cb, src, offset, []vk.DeviceSize{0})
+}
+
+// cmdCopyLevelsFrom records copying mip level i from levels[i] past offset
+// in src for each of levels, transitioning to TRANSFER_DST_OPTIMAL first.
+func (img *Image) cmdCopyLevelsFrom(cb vk.CommandBuffer, src vk.Buffer, offset vk.DeviceSize, levels []vk.DeviceSize) {
+	img.CmdTransitionTo(cb, vk.ImageLayoutTransferDstOptimal)
+	regions := make([]vk.BufferImageCopy, len(levels))
+	for i, levelOffset := range levels {
+		width, height := img.Width>>i, img.Height>>i
+		if width == 0 {
+			width = 1
+		}
+		if height == 0 {
+			height = 1
+		}
+		regions[i] = vk.BufferImageCopy{
+			BufferOffset:      offset + levelOffset,
+			BufferRowLength:   0,
+			BufferImageHeight: 0,
+			ImageSubresource:  img.subresourceLayers(uint32(i)),
+			ImageOffset:       vk.Offset3D{X: 0, Y: 0, Z: 0},
+			ImageExtent: vk.Extent3D{
+				Width:  width,
+				Height: height,
+				Depth:  1,
+			},
+		}
+	}
+	vk.CmdCopyBufferToImage(cb, src, img.Handle, vk.ImageLayoutTransferDstOptimal, uint32(len(regions)), regions)
+}
+
+// GenerateMipmaps fills mip levels 1 and up from level 0 and waits for it,
+// leaving every level in SHADER_READ_ONLY_OPTIMAL.
+func (img *Image) GenerateMipmaps() error {
+	return img.ctx.Commands.OneTimeSubmit(img.ctx.Queue, func(cb vk.CommandBuffer) {
+		img.CmdGenerateMipmaps(cb)
+	})
+}
+
+// CmdGenerateMipmaps records repeatedly blitting each mip level into the
+// next at half size. The format has to support linear blits, which isn't
+// guaranteed, so check its OptimalTilingFeatures first.
+func (img *Image) CmdGenerateMipmaps(cb vk.CommandBuffer) {
+	img.CmdTransitionTo(cb, vk.ImageLayoutTransferDstOptimal)
+
+	mipWidth, mipHeight := int32(img.Width), int32(img.Height)
+	for i := uint32(1); i < img.MipLevels; i++ {
+		// The previous level was just written, it's the source of this blit
+		img.cmdBarrier(cb, i-1, 1, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutTransferSrcOptimal)
+
+		nextWidth, nextHeight := mipWidth, mipHeight
+		if nextWidth > 1 {
+			nextWidth /= 2
+		}
+		if nextHeight > 1 {
+			nextHeight /= 2
+		}
+
+		vk.CmdBlitImage(cb,
+			img.Handle, vk.ImageLayoutTransferSrcOptimal,
+			img.Handle, vk.ImageLayoutTransferDstOptimal,
+			1, []vk.ImageBlit{{
+				SrcOffsets:     [2]vk.Offset3D{{X: 0, Y: 0, Z: 0}, {X: mipWidth, Y: mipHeight, Z: 1}},
+				SrcSubresource: img.subresourceLayers(i - 1),
+				DstOffsets:     [2]vk.Offset3D{{X: 0, Y: 0, Z: 0}, {X: nextWidth, Y: nextHeight, Z: 1}},
+				DstSubresource: img.subresourceLayers(i),
+			}},
+			vk.FilterLinear,
+		)
+
+		// The previous level is finished with
+		img.cmdBarrier(cb, i-1, 1, vk.ImageLayoutTransferSrcOptimal, vk.ImageLayoutShaderReadOnlyOptimal)
+
+		mipWidth, mipHeight = nextWidth, nextHeight
+	}
+
+	// The last level is only ever blitted into
+	img.cmdBarrier(cb, img.MipLevels-1, 1, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutShaderReadOnlyOptimal)
+	img.Layout = vk.ImageLayoutShaderReadOnlyOptimal
+}
+
+// Destroy releases the image's view, handle and memory.
+func (img *Image) Destroy() {
+	if img.View != vk.NullImageView {
+		img.ctx.Leaks.Release(img.View)
+		vk.DestroyImageView(img.ctx.Device, img.View, nil)
+		img.View = vk.NullImageView
+	}
+	if img.Handle != vk.NullImage {
+		img.ctx.Leaks.Release(img.Handle)
+		vk.DestroyImage(img.ctx.Device, img.Handle, nil)
+		img.Handle = vk.NullImage
+	}
+	if img.Allocation != nil {
+		img.ctx.Allocator.Free(img.Allocation)
+		img.Allocation = nil
+	}
+}
+
+// cmdBarrier records a layout transition of levels mip levels from
+// baseLevel, waiting on whatever last used oldLayout and blocking whatever
+// uses newLayout next.
+func (img *Image) cmdBarrier(cb vk.CommandBuffer, baseLevel, levels uint32, oldLayout, newLayout vk.ImageLayout) {
+	srcAccess, srcStage := layoutAccess(oldLayout)
+	dstAccess, dstStage := layoutAccess(newLayout)
+	vk.CmdPipelineBarrier(cb, srcStage, dstStage, 0,
+		0, nil,
+		0, nil,
+		1, []vk.ImageMemoryBarrier{{
+			SType:               vk.StructureTypeImageMemoryBarrier,
+			SrcAccessMask:       srcAccess,
+			DstAccessMask:       dstAccess,
+			OldLayout:           oldLayout,
+			NewLayout:           newLayout,
+			SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+			DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+			Image:               img.Handle,
+			SubresourceRange:    img.subresourceRange(baseLevel, levels),
+		}},
+	)
+}
+
+// cmdTransferOwnership hands every mip level from the queue family src to
+// dst, releasing it in release and acquiring it in acquire, which have to be
+// submitted in that order. The layout stays as it is.
+func (img *Image) cmdTransferOwnership(release, acquire vk.CommandBuffer, src, dst uint32) {
+	access, stage := layoutAccess(img.Layout)
+	barrier := vk.ImageMemoryBarrier{
+		SType:               vk.StructureTypeImageMemoryBarrier,
+		OldLayout:           img.Layout,
+		NewLayout:           img.Layout,
+		SrcQueueFamilyIndex: src,
+		DstQueueFamilyIndex: dst,
+		Image:               img.Handle,
+		SubresourceRange:    img.subresourceRange(0, img.MipLevels),
+	}
+
+	released := barrier
+	released.SrcAccessMask = access
+	vk.CmdPipelineBarrier(release, stage, vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit), 0,
+		0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{released})
+
+	acquired := barrier
+	acquired.DstAccessMask = access
+	vk.CmdPipelineBarrier(acquire, vk.PipelineStageFlags(vk.PipelineStageTopOfPipeBit), stage, 0,
+		0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{acquired})
+}
+
+func (img *Image) subresourceRange(baseLevel, levels uint32) vk.ImageSubresourceRange {
+	return vk.ImageSubresourceRange{
+		AspectMask:     img.Aspect,
+		BaseMipLevel:   baseLevel,
+		LevelCount:     levels,
+		BaseArrayLayer: 0,
+		LayerCount:     img.Layers,
+	}
+}
+
+func (img *Image) subresourceLayers(level uint32) vk.ImageSubresourceLayers {
+	return vk.ImageSubresourceLayers{
+		AspectMask:     img.Aspect,
+		MipLevel:       level,
+		BaseArrayLayer: 0,
+		LayerCount:     img.Layers,
+	}
+}
+
+// layoutAccess is how an image in layout is accessed and the stages that do
+// it. Layouts without a single obvious use wait on everything.
+func layoutAccess(layout vk.ImageLayout) (vk.AccessFlags, vk.PipelineStageFlags) {
+	switch layout {
+	case vk.ImageLayoutUndefined:
+		return 0, vk.PipelineStageFlags(vk.PipelineStageTopOfPipeBit)
+	case vk.ImageLayoutTransferDstOptimal:
+		return vk.AccessFlags(vk.AccessTransferWriteBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit)
+	case vk.ImageLayoutTransferSrcOptimal:
+		return vk.AccessFlags(vk.AccessTransferReadBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit)
+	case vk.ImageLayoutShaderReadOnlyOptimal:
+		return vk.AccessFlags(vk.AccessShaderReadBit), vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit | vk.PipelineStageComputeShaderBit)
+	case vk.ImageLayoutColorAttachmentOptimal:
+		return vk.AccessFlags(vk.AccessColorAttachmentReadBit | vk.AccessColorAttachmentWriteBit),
+			vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit)
+	case vk.ImageLayoutDepthStencilAttachmentOptimal:
+		return vk.AccessFlags(vk.AccessDepthStencilAttachmentReadBit | vk.AccessDepthStencilAttachmentWriteBit),
+			vk.PipelineStageFlags(vk.PipelineStageEarlyFragmentTestsBit | vk.PipelineStageLateFragmentTestsBit)
+	case vk.ImageLayoutPresentSrc:
+		return 0, vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit)
+	}
+	return vk.AccessFlags(vk.AccessMemoryReadBit | vk.AccessMemoryWriteBit),
+		vk.PipelineStageFlags(vk.PipelineStageAllCommandsBit)
+}
@@ -0,0 +1,436 @@
+package gpu
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DefaultStagingSize is how big each of an Uploader's staging buffers is.
+const DefaultStagingSize = 16 << 20
+
+// stagingAlignment keeps every upload's offset usable as the source of an
+// image copy, which has to be a multiple of 4 and of the texel size.
+const stagingAlignment = 16
+
+// TransferQueue is a queue on a transfer only family, usually a DMA engine,
+// for an Uploader to copy on so uploads don't hold up the graphics queue.
+// Commands has to be a pool on the same family.
+type TransferQueue struct {
+	Queue    vk.Queue
+	Commands *commands.Pool
+}
+
+// stagingSlot is one staging buffer of the ring with the command buffers
+// that copy out of it and the fence that says when it's free again.
+type stagingSlot struct {
+	buffer *Buffer
+	// cb holds the copies. With a transfer queue it runs there and acquire
+	// runs on Context's queue afterwards, taking ownership of what was
+	// copied before anything recorded with Record.
+	cb      vk.CommandBuffer
+	acquire vk.CommandBuffer
+	copied  vk.Semaphore
+	fence   vk.Fence
+	used    vk.DeviceSize
+	// submission is the value Flush returned for the slot's last submit,
+	// zero if it's never been submitted.
+	submission uint64
+	recording  bool
+	// oversized are staging buffers for uploads too big for the ring, they
+	// live until the slot is next reused.
+	oversized []*Buffer
+}
+
+// Uploader copies data into GPU only buffers and images through a ring of
+// reusable staging buffers, instead of creating and waiting on a staging
+// buffer per resource. Uploads are recorded into a command buffer per
+// staging buffer and only submitted by Flush, or once the staging buffer
+// fills up. It isn't safe to use from multiple goroutines.
+type Uploader struct {
+	ctx      Context
+	transfer *TransferQueue
+	slots    []*stagingSlot
+	current  int
+	// submitted is the value of the last Flush.
+	submitted uint64
+}
+
+// NewUploader creates an uploader with count staging buffers of size bytes,
+// zero using DefaultStagingSize. More buffers let more uploads be in flight
+// before one has to be waited on. Copies go through transfer when it isn't
+// nil, with ownership of what they fill handed over to Context's queue
+// family.
+func NewUploader(ctx Context, transfer *TransferQueue, count int, size vk.DeviceSize) (*Uploader, error) {
+	if count < 1 {
+		return nil, errors.Errorf("an uploader needs at least 1 staging buffer, not %d", count)
+	}
+	if size == 0 {
+		size = DefaultStagingSize
+	}
+
+	u := &Uploader{ctx: ctx, transfer: transfer}
+	copyPool := ctx.Commands
+	if transfer != nil {
+		copyPool = transfer.Commands
+	}
+	buffers, err := copyPool.Allocate(count)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't allocate upload command buffers")
+	}
+	for _, cb := range buffers {
+		u.slots = append(u.slots, &stagingSlot{cb: cb})
+	}
+
+	if transfer != nil {
+		acquires, err := ctx.Commands.Allocate(count)
+		if err != nil {
+			u.Destroy()
+			return nil, errors.Wrap(err, "can't allocate upload acquire command buffers")
+		}
+		for i, cb := range acquires {
+			u.slots[i].acquire = cb
+		}
+	}
+
+	for i, slot := range u.slots {
+		slot.buffer, err = NewBuffer(ctx, size, vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit), memory.CPUToGPU)
+		if err != nil {
+			u.Destroy()
+			return nil, errors.Wrapf(err, "can't create staging buffer %d", i)
+		}
+
+		fenceInfo := &vk.FenceCreateInfo{SType: vk.StructureTypeFenceCreateInfo}
+		if err := vk.Error(vk.CreateFence(ctx.Device, fenceInfo, nil, &slot.fence)); err != nil {
+			u.Destroy()
+			return nil, errors.Wrapf(err, "can't create staging fence %d", i)
+		}
+
+		if transfer != nil {
+			semaphoreInfo := &vk.SemaphoreCreateInfo{SType: vk.StructureTypeSemaphoreCreateInfo}
+			if err := vk.Error(vk.CreateSemaphore(ctx.Device, semaphoreInfo, nil, &slot.copied)); err != nil {
+				u.Destroy()
+				return nil, errors.Wrapf(err, "can't create staging semaphore %d", i)
+			}
+		}
+	}
+	return u, nil
+}
+
+// Buffer records copying data into dst at offset.
+func (u *Uploader) Buffer(dst *Buffer, offset vk.DeviceSize, data []byte) error {
+	if offset+vk.DeviceSize(len(data)) > dst.Size {
+		return errors.Errorf("%d bytes at %d don't fit in a %d byte buffer", len(data), offset, dst.Size)
+	}
+	src, srcOffset, err := u.stage(data)
+	if err != nil {
+		return err
+	}
+	slot := u.slot()
+	size := vk.DeviceSize(len(data))
+	vk.CmdCopyBuffer(slot.cb, src, dst.Handle, 1, []vk.BufferCopy{{
+		SrcOffset: srcOffset,
+		DstOffset: offset,
+		Size:      size,
+	}})
+
+	if u.transfer != nil {
+		barrier := vk.BufferMemoryBarrier{
+			SType:               vk.StructureTypeBufferMemoryBarrier,
+			SrcQueueFamilyIndex: u.transfer.Commands.QueueFamilyIndex,
+			DstQueueFamilyIndex: u.ctx.Commands.QueueFamilyIndex,
+			Buffer:              dst.Handle,
+			Offset:              offset,
+			Size:                size,
+		}
+		// Shared buffers have no owner to hand over, the semaphore between
+		// the queues is all it takes
+		if dst.Concurrent {
+			barrier.SrcQueueFamilyIndex = vk.QueueFamilyIgnored
+			barrier.DstQueueFamilyIndex = vk.QueueFamilyIgnored
+		}
+		release, acquire := barrier, barrier
+		release.SrcAccessMask = vk.AccessFlags(vk.AccessTransferWriteBit)
+		acquire.DstAccessMask = vk.AccessFlags(vk.AccessMemoryReadBit)
+		vk.CmdPipelineBarrier(slot.cb,
+			vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit), 0,
+			0, nil, 1, []vk.BufferMemoryBarrier{release}, 0, nil)
+		vk.CmdPipelineBarrier(slot.acquire,
+			vk.PipelineStageFlags(vk.PipelineStageTopOfPipeBit), vk.PipelineStageFlags(vk.PipelineStageAllCommandsBit), 0,
+			0, nil, 1, []vk.BufferMemoryBarrier{acquire}, 0, nil)
+	}
+	return nil
+}
+
+// Image records copying tightly packed pixels into mip level 0 of dst,
+// leaving it in TRANSFER_DST_OPTIMAL. With a transfer queue dst must not be
+// in a layout only the graphics queue's stages use.
+func (u *Uploader) Image(dst *Image, pixels []byte) error {
+	src, srcOffset, err := u.stage(pixels)
+	if err != nil {
+		return err
+	}
+	slot := u.slot()
+	dst.cmdCopyFrom(slot.cb, src, srcOffset)
+
+	if u.transfer != nil {
+		dst.cmdTransferOwnership(slot.cb, slot.acquire, u.transfer.Commands.QueueFamilyIndex, u.ctx.Commands.QueueFamilyIndex)
+	}
+	return nil
+}
+
+// ImageLevels records copying each of levels into the mip level of dst at
+// its index, leaving it in TRANSFER_DST_OPTIMAL like Image. It's for mip
+// chains made offline, like block compressed ones the GPU can't blit.
+func (u *Uploader) ImageLevels(dst *Image, levels [][]byte) error {
+	var data []byte
+	offsets := make([]vk.DeviceSize, len(levels))
+	for i, level := range levels {
+		// Every level's copy starts on a texel block too
+		for len(data)%stagingAlignment != 0 {
+			data = append(data, 0)
+		}
+		offsets[i] = vk.DeviceSize(len(data))
+		data = append(data, level...)
+	}
+	src, srcOffset, err := u.stage(data)
+	if err != nil {
+		return err
+	}
+	slot := u.slot()
+	dst.cmdCopyLevelsFrom(slot.cb, src, srcOffset, offsets)
+
+	if u.transfer != nil {
+		dst.cmdTransferOwnership(slot.cb, slot.acquire, u.transfer.Commands.QueueFamilyIndex, u.ctx.Commands.QueueFamilyIndex)
+	}
+	return nil
+}
+
+// Record adds whatever fn issues to the upload commands, it runs on
+// Context's queue after the uploads recorded so far. It's for work that
+// depends on them like generating mipmaps.
+func (u *Uploader) Record(fn func(cb vk.CommandBuffer)) error {
+	if err := u.begin(); err != nil {
+		return err
+	}
+	slot := u.slot()
+	if u.transfer != nil {
+		fn(slot.acquire)
+	} else {
+		fn(slot.cb)
+	}
+	return nil
+}
+
+// Flush submits the uploads recorded so far, returning a value to pass to
+// Wait. Waiting on it also waits for every earlier upload.
+func (u *Uploader) Flush() (uint64, error) {
+	slot := u.slot()
+	if !slot.recording {
+		return u.submitted, nil
+	}
+	slot.recording = false
+
+	if err := vk.Error(vk.EndCommandBuffer(slot.cb)); err != nil {
+		return 0, errors.Wrap(err, "can't end recording upload command buffer")
+	}
+
+	if u.transfer == nil {
+		submitInfo := []vk.SubmitInfo{{
+			SType:              vk.StructureTypeSubmitInfo,
+			CommandBufferCount: 1,
+			PCommandBuffers:    []vk.CommandBuffer{slot.cb},
+		}}
+		if err := vk.Error(vk.QueueSubmit(u.ctx.Queue, 1, submitInfo, slot.fence)); err != nil {
+			return 0, errors.Wrap(err, "can't submit uploads")
+		}
+	} else {
+		if err := vk.Error(vk.EndCommandBuffer(slot.acquire)); err != nil {
+			return 0, errors.Wrap(err, "can't end recording upload acquire command buffer")
+		}
+
+		copyInfo := []vk.SubmitInfo{{
+			SType:                vk.StructureTypeSubmitInfo,
+			CommandBufferCount:   1,
+			PCommandBuffers:      []vk.CommandBuffer{slot.cb},
+			SignalSemaphoreCount: 1,
+			PSignalSemaphores:    []vk.Semaphore{slot.copied},
+		}}
+		if err := vk.Error(vk.QueueSubmit(u.transfer.Queue, 1, copyInfo, vk.NullFence)); err != nil {
+			return 0, errors.Wrap(err, "can't submit uploads to transfer queue")
+		}
+
+		acquireInfo := []vk.SubmitInfo{{
+			SType:              vk.StructureTypeSubmitInfo,
+			WaitSemaphoreCount: 1,
+			PWaitSemaphores:    []vk.Semaphore{slot.copied},
+			PWaitDstStageMask:  []vk.PipelineStageFlags{vk.PipelineStageFlags(vk.PipelineStageAllCommandsBit)},
+			CommandBufferCount: 1,
+			PCommandBuffers:    []vk.CommandBuffer{slot.acquire},
+		}}
+		if err := vk.Error(vk.QueueSubmit(u.ctx.Queue, 1, acquireInfo, slot.fence)); err != nil {
+			return 0, errors.Wrap(err, "can't submit upload acquires")
+		}
+	}
+
+	u.submitted++
+	slot.submission = u.submitted
+	u.current = (u.current + 1) % len(u.slots)
+	return u.submitted, nil
+}
+
+// Wait blocks until the uploads submitted by the Flush that returned value
+// have finished.
+func (u *Uploader) Wait(value uint64) error {
+	// A fence covers every submission before its own, so waiting on the
+	// newest slot submitted no later than value is enough. Slots that have
+	// moved past value were already waited on before being reused.
+	var newest *stagingSlot
+	for _, slot := range u.slots {
+		if slot.submission == 0 || slot.submission > value {
+			continue
+		}
+		if newest == nil || slot.submission > newest.submission {
+			newest = slot
+		}
+	}
+	if newest == nil {
+		return nil
+	}
+	return newest.wait(u.ctx.Device)
+}
+
+// Destroy waits for any uploads in flight and releases the staging buffers.
+func (u *Uploader) Destroy() {
+	var buffers, acquires []vk.CommandBuffer
+	for _, slot := range u.slots {
+		if slot.submission != 0 {
+			_ = slot.wait(u.ctx.Device)
+		}
+		slot.releaseOversized()
+		if slot.buffer != nil {
+			slot.buffer.Destroy()
+		}
+		if slot.fence != vk.NullFence {
+			vk.DestroyFence(u.ctx.Device, slot.fence, nil)
+		}
+		if slot.copied != vk.NullSemaphore {
+			vk.DestroySemaphore(u.ctx.Device, slot.copied, nil)
+		}
+		buffers = append(buffers, slot.cb)
+		if slot.acquire != nil {
+			acquires = append(acquires, slot.acquire)
+		}
+	}
+
+	if u.transfer != nil {
+		u.transfer.Commands.Free(buffers)
+	} else {
+		u.ctx.Commands.Free(buffers)
+	}
+	u.ctx.Commands.Free(acquires)
+	u.slots = nil
+}
+
+func (u *Uploader) slot() *stagingSlot {
+	return u.slots[u.current]
+}
+
+// begin starts recording into the current slot if it isn't already, first
+// waiting for its previous uploads to finish.
+func (u *Uploader) begin() error {
+	slot := u.slot()
+	if slot.recording {
+		return nil
+	}
+
+	if slot.submission != 0 {
+		if err := slot.wait(u.ctx.Device); err != nil {
+			return err
+		}
+		if err := vk.Error(vk.ResetFences(u.ctx.Device, 1, []vk.Fence{slot.fence})); err != nil {
+			return errors.Wrap(err, "can't reset staging fence")
+		}
+		slot.submission = 0
+	}
+	slot.releaseOversized()
+	slot.used = 0
+
+	if err := beginOneTime(slot.cb); err != nil {
+		return errors.Wrap(err, "can't begin recording upload command buffer")
+	}
+	if u.transfer != nil {
+		if err := beginOneTime(slot.acquire); err != nil {
+			return errors.Wrap(err, "can't begin recording upload acquire command buffer")
+		}
+	}
+	slot.recording = true
+	return nil
+}
+
+// stage copies data into staging memory, returning where it went. A full
+// staging buffer is flushed and the next one in the ring used.
+func (u *Uploader) stage(data []byte) (vk.Buffer, vk.DeviceSize, error) {
+	if len(data) == 0 {
+		return vk.NullBuffer, 0, errors.New("no data to upload")
+	}
+	size := vk.DeviceSize(len(data))
+
+	if err := u.begin(); err != nil {
+		return vk.NullBuffer, 0, err
+	}
+	slot := u.slot()
+
+	if size > slot.buffer.Size {
+		b, err := NewBuffer(u.ctx, size, vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit), memory.CPUToGPU)
+		if err != nil {
+			return vk.NullBuffer, 0, errors.Wrap(err, "can't create oversized staging buffer")
+		}
+		slot.oversized = append(slot.oversized, b)
+		if err := b.Upload(data); err != nil {
+			return vk.NullBuffer, 0, err
+		}
+		return b.Handle, 0, nil
+	}
+
+	offset := (slot.used + stagingAlignment - 1) / stagingAlignment * stagingAlignment
+	if offset+size > slot.buffer.Size {
+		if _, err := u.Flush(); err != nil {
+			return vk.NullBuffer, 0, err
+		}
+		if err := u.begin(); err != nil {
+			return vk.NullBuffer, 0, err
+		}
+		slot, offset = u.slot(), 0
+	}
+
+	copy(slot.buffer.Mapped()[offset:], data)
+	slot.used = offset + size
+	return slot.buffer.Handle, offset, nil
+}
+
+func (s *stagingSlot) wait(device vk.Device) error {
+	err := vk.Error(vk.WaitForFences(device, 1, []vk.Fence{s.fence}, vk.True, math.MaxUint64))
+	return errors.Wrap(err, "can't wait for uploads")
+}
+
+func (s *stagingSlot) releaseOversized() {
+	for _, b := range s.oversized {
+		b.Destroy()
+	}
+	s.oversized = nil
+}
+
+func beginOneTime(cb vk.CommandBuffer) error {
+	if err := vk.Error(vk.ResetCommandBuffer(cb, 0)); err != nil {
+		return err
+	}
+	beginInfo := &vk.CommandBufferBeginInfo{
+		SType: vk.StructureTypeCommandBufferBeginInfo,
+		Flags: vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit),
+	}
+	return vk.Error(vk.BeginCommandBuffer(cb, beginInfo))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/ui"
+	"github.com/inkyblackness/imgui-go/v4"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// createUI gives the primary window an ImGui renderer when the UI or HUD
+// option is set. ImGui has a single current context so other windows go
+// without.
+func (app *HelloTriangleApplication) createUI() error {
+	if !app.UI && !app.HUD || app.window == nil || app.appWindow != app.windows[0] {
+		return nil
+	}
+
+	if app.uiPlatform == nil {
+		app.uiPlatform = ui.NewPlatform(app.window)
+	}
+	renderer, err := ui.NewRenderer(app.gpuContext(), shaders.UIVert(), shaders.UIFrag(), app.framesInFlight())
+	if err != nil {
+		return errors.Wrap(err, "can't create UI renderer")
+	}
+	app.uiRenderer = renderer
+	return app.createUITarget()
+}
+
+// createUITarget points the UI renderer at the current swapchain images.
+func (app *HelloTriangleApplication) createUITarget() error {
+	if app.uiRenderer == nil {
+		return nil
+	}
+	return errors.Wrap(
+		app.uiRenderer.CreateTarget(app.target.Format, app.target.FinalLayout, app.imageViews, app.target.Extent),
+		"can't create UI render target",
+	)
+}
+
+// buildUI lays out this frame's ImGui windows and uploads them for frame.
+func (app *HelloTriangleApplication) buildUI(frame int) error {
+	if app.uiRenderer == nil {
+		return nil
+	}
+
+	app.uiPlatform.NewFrame()
+	switch {
+	case !app.UI:
+	case app.OnUI != nil:
+		app.OnUI()
+	default:
+		app.sceneUI()
+		app.lightsUI()
+		app.animationUI()
+	}
+	if app.hudVisible {
+		app.hudUI()
+	}
+	imgui.Render()
+
+	return errors.Wrap(app.uiRenderer.Upload(frame, imgui.RenderedDrawData()), "can't upload UI")
+}
+
+// sceneUI is the UI shown when there's no OnUI.
+func (app *HelloTriangleApplication) sceneUI() {
+	imgui.Begin("Scene")
+	imgui.ColorEdit4("Tint", (*[4]float32)(&app.tint))
+	imgui.SliderFloat("Shadow bias", &app.shadowBias.Constant, 0, 10)
+	imgui.SliderFloat("Shadow slope bias", &app.shadowBias.Slope, 0, 10)
+	if app.bloomEnabled() {
+		imgui.SliderFloat("Bloom threshold", &app.bloom.Threshold, 0, 10)
+		imgui.SliderFloat("Bloom intensity", &app.bloom.Intensity, 0, 2)
+	}
+	imgui.End()
+}
+
+// recordUI draws the UI built for frame over the swapchain image.
+func (app *HelloTriangleApplication) recordUI(cb vk.CommandBuffer, frame int, imageIndex uint32) {
+	if app.uiRenderer == nil {
+		return
+	}
+	scope := app.profiler.Begin(cb, "ui")
+	width, height := app.window.GetSize()
+	displaySize := imgui.Vec2{X: float32(width), Y: float32(height)}
+	app.countDraws(app.uiRenderer.Record(cb, frame, imageIndex, imgui.RenderedDrawData(), displaySize))
+	scope.End(cb)
+}
+
+// uiWantsMouse reports whether win's mouse input belongs to the UI.
+func (app *HelloTriangleApplication) uiWantsMouse(win *appWindow) bool {
+	return win.uiRenderer != nil && app.uiPlatform.WantsMouse()
+}
+
+// uiWantsKeyboard reports whether win's keys belong to the UI.
+func (app *HelloTriangleApplication) uiWantsKeyboard(win *appWindow) bool {
+	return win.uiRenderer != nil && app.uiPlatform.WantsKeyboard()
+}
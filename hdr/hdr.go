@@ -0,0 +1,166 @@
+// Package hdr decodes Radiance .hdr images, the usual format for
+// equirectangular environment maps, into linear floating point pixels.
+package hdr
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Image is linear RGB pixels, three floats each, row by row from the top.
+type Image struct {
+	Width  int
+	Height int
+	Pix    []float32
+}
+
+// Load decodes the .hdr file at path.
+func Load(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open '%s'", path)
+	}
+	defer f.Close()
+
+	img, err := Decode(f)
+	return img, errors.Wrapf(err, "can't decode '%s'", path)
+}
+
+// Decode reads an RGBE encoded image with flat or run length encoded
+// scanlines. Only the usual top to bottom, left to right orientation is
+// supported.
+func Decode(r io.Reader) (*Image, error) {
+	br := bufio.NewReader(r)
+	width, height, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := &Image{
+		Width:  width,
+		Height: height,
+		Pix:    make([]float32, width*height*3),
+	}
+	scanline := make([]byte, width*4)
+	for y := 0; y < height; y++ {
+		if err := readScanline(br, scanline); err != nil {
+			return nil, errors.Wrapf(err, "can't read scanline %d", y)
+		}
+		row := img.Pix[y*width*3 : (y+1)*width*3]
+		for x := 0; x < width; x++ {
+			rgbe := scanline[x*4 : x*4+4]
+			if rgbe[3] == 0 {
+				continue
+			}
+			// The shared exponent is biased by 128 and the mantissas are 8 bits
+			scale := float32(math.Ldexp(1, int(rgbe[3])-136))
+			row[x*3] = float32(rgbe[0]) * scale
+			row[x*3+1] = float32(rgbe[1]) * scale
+			row[x*3+2] = float32(rgbe[2]) * scale
+		}
+	}
+	return img, nil
+}
+
+// readHeader checks the format and reads the resolution line.
+func readHeader(br *bufio.Reader) (width, height int, err error) {
+	magic, err := br.ReadString('\n')
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "can't read header")
+	}
+	if !strings.HasPrefix(magic, "#?") {
+		return 0, 0, errors.New("not a Radiance HDR file")
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "can't read header")
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if format := strings.TrimPrefix(line, "FORMAT="); format != line && format != "32-bit_rle_rgbe" {
+			return 0, 0, errors.Errorf("unsupported format '%s'", format)
+		}
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "can't read resolution")
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != "-Y" || fields[2] != "+X" {
+		return 0, 0, errors.Errorf("unsupported resolution line '%s'", strings.TrimSpace(line))
+	}
+	if height, err = strconv.Atoi(fields[1]); err != nil || height <= 0 {
+		return 0, 0, errors.Errorf("bad height '%s'", fields[1])
+	}
+	if width, err = strconv.Atoi(fields[3]); err != nil || width <= 0 {
+		return 0, 0, errors.Errorf("bad width '%s'", fields[3])
+	}
+	return width, height, nil
+}
+
+// readScanline reads one scanline of RGBE pixels into dst. Run length
+// encoded scanlines start with 2, 2 and the width, then hold each of the
+// four channels in turn as runs and literal spans.
+func readScanline(br *bufio.Reader, dst []byte) error {
+	width := len(dst) / 4
+	start, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || start[0] != 2 || start[1] != 2 || start[2]&0x80 != 0 {
+		_, err := io.ReadFull(br, dst)
+		return err
+	}
+	if int(start[2])<<8|int(start[3]) != width {
+		return errors.New("scanline width doesn't match the image")
+	}
+	br.Discard(4)
+
+	for channel := 0; channel < 4; channel++ {
+		for x := 0; x < width; {
+			count, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			n := int(count)
+			if n > 128 {
+				n -= 128
+				if x+n > width {
+					return errors.New("run overflows the scanline")
+				}
+				value, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; n > 0; n-- {
+					dst[x*4+channel] = value
+					x++
+				}
+				continue
+			}
+			if n == 0 || x+n > width {
+				return errors.New("bad span length")
+			}
+			for ; n > 0; n-- {
+				value, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				dst[x*4+channel] = value
+				x++
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	defaultHeadlessOutput = "headless.png"
+
+	// headlessFormat matches image.RGBA's byte order so rendered pixels can
+	// be copied out without conversion.
+	headlessFormat = vk.FormatR8g8b8a8Srgb
+)
+
+// renderTarget is what frames are rendered into, the swapchain's images or
+// when headless a single offscreen image.
+type renderTarget struct {
+	Images []vk.Image
+	Format vk.Format
+	Extent vk.Extent2D
+	// FinalLayout is the layout the render pass leaves images in.
+	FinalLayout vk.ImageLayout
+}
+
+// targetUsage is what the target's images are used for besides being
+// rendered into: copied from for screenshots and recording, and blitted
+// into by ray tracing and stereo.
+func (app *HelloTriangleApplication) targetUsage() vk.ImageUsageFlags {
+	usage := vk.ImageUsageFlags(vk.ImageUsageTransferSrcBit)
+	if app.rayTracing || app.stereo {
+		usage |= vk.ImageUsageFlags(vk.ImageUsageTransferDstBit)
+	}
+	return usage
+}
+
+// createOffscreenTarget stands in for createSwapchain when headless.
+func (app *HelloTriangleApplication) createOffscreenTarget() error {
+	img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:  uint32(app.config.Width),
+		Height: uint32(app.config.Height),
+		Format: headlessFormat,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit) | app.targetUsage(),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create offscreen image")
+	}
+	app.offscreenImage = img
+	app.name(img.Handle, "offscreen image")
+
+	app.target = renderTarget{
+		Images:      []vk.Image{img.Handle},
+		Format:      img.Format,
+		Extent:      vk.Extent2D{Width: img.Width, Height: img.Height},
+		FinalLayout: vk.ImageLayoutTransferSrcOptimal,
+	}
+	return nil
+}
+
+// renderHeadless draws HeadlessFrames frames into the offscreen image, one
+// after the other, and writes the last one to HeadlessOutput as a PNG.
+func (app *HelloTriangleApplication) renderHeadless() error {
+	app.startTime = time.Now()
+
+	frames := app.HeadlessFrames
+	if frames < 1 {
+		frames = 1
+	}
+	lastFrame := app.startTime
+	for i := 0; i < frames; i++ {
+		now := time.Now()
+		dt := float32(now.Sub(lastFrame).Seconds())
+		app.world.Tick(dt)
+		app.animate(dt)
+		lastFrame = now
+		if err := app.renderHeadlessFrame(); err != nil {
+			return errors.Wrapf(err, "can't render frame %d", i)
+		}
+	}
+
+	pixels, err := app.readImage(app.offscreenImage.Handle, app.target.Extent, app.target.FinalLayout)
+	if err != nil {
+		return errors.Wrap(err, "can't read back offscreen image")
+	}
+
+	path := app.HeadlessOutput
+	if path == "" {
+		path = defaultHeadlessOutput
+	}
+	if err := writePNG(path, pixels); err != nil {
+		return err
+	}
+	app.logger.Info("Wrote headless frame", logging.F("path", path), logging.F("frames", frames))
+	return nil
+}
+
+// renderHeadlessFrame draws a frame into the offscreen image and waits for
+// it to finish.
+func (app *HelloTriangleApplication) renderHeadlessFrame() error {
+	const frame, imageIndex = 0, 0
+	inFlight := app.inFlightFences[frame]
+
+	if err := app.updateUniformBuffer(frame); err != nil {
+		return errors.Wrap(err, "can't update uniform buffer")
+	}
+
+	cb := app.commandBuffers[frame]
+	if err := commands.Record(cb, func(cb vk.CommandBuffer) {
+		app.recordCommandBuffer(cb, frame, imageIndex, nil)
+		app.recordRayTracing(cb, frame, imageIndex)
+	}); err != nil {
+		return errors.Wrap(err, "can't record command buffer")
+	}
+
+	submitInfo := []vk.SubmitInfo{{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    []vk.CommandBuffer{cb},
+	}}
+	if err := vk.Error(vk.ResetFences(app.device, 1, []vk.Fence{inFlight})); err != nil {
+		return errors.Wrap(err, "can't reset frame fence")
+	}
+	if err := vk.Error(vk.QueueSubmit(app.graphicsQueue, 1, submitInfo, inFlight)); err != nil {
+		return errors.Wrap(err, "can't submit draw command buffer")
+	}
+	app.submitted(inFlight)
+	if err := vk.Error(vk.WaitForFences(app.device, 1, []vk.Fence{inFlight}, vk.True, math.MaxUint64)); err != nil {
+		return errors.Wrap(err, "can't wait for frame")
+	}
+	app.waited(inFlight)
+	return nil
+}
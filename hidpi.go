@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+// ContentScale is the ratio between a monitor's DPI and the platform's
+// default, 1.5 on a display scaled to 150%.
+type ContentScale struct {
+	X, Y float32
+}
+
+// trackContentScale keeps the current window's contentScale up to date as
+// it moves between monitors. The framebuffer normally changes size along with the scale but
+// the swapchain is rebuilt regardless in case the platform doesn't say so.
+func (app *HelloTriangleApplication) trackContentScale() {
+	win := app.appWindow
+	x, y := win.window.GetContentScale()
+	win.contentScale = ContentScale{X: x, Y: y}
+	app.logger.Debug("Content scale", logging.F("x", x), logging.F("y", y))
+
+	win.window.SetContentScaleCallback(func(w *glfw.Window, x, y float32) {
+		win.contentScale = ContentScale{X: x, Y: y}
+		win.framebufferResized = true
+		app.logger.Info("Content scale changed", logging.F("x", x), logging.F("y", y))
+		if app.OnContentScale != nil {
+			app.OnContentScale(win.contentScale)
+		}
+	})
+}
+
+// cursorPosition is the cursor in framebuffer pixels, the space the viewport
+// is in. GLFW reports it in screen coordinates which only match pixels when
+// the display isn't scaled.
+func (app *HelloTriangleApplication) cursorPosition() (x, y float64) {
+	x, y = app.window.GetCursorPos()
+	windowWidth, windowHeight := app.window.GetSize()
+	framebufferWidth, framebufferHeight := app.window.GetFramebufferSize()
+	if windowWidth > 0 && windowHeight > 0 {
+		x *= float64(framebufferWidth) / float64(windowWidth)
+		y *= float64(framebufferHeight) / float64(windowHeight)
+	}
+	return x, y
+}
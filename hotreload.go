@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// startShaderReload watches ShaderReloadDir for GLSL edits. It's a
+// development convenience so a missing directory only disables it.
+func (app *HelloTriangleApplication) startShaderReload() {
+	if app.ShaderReloadDir == "" {
+		return
+	}
+
+	w, err := shaders.Watch(app.ShaderReloadDir)
+	if err != nil {
+		app.logger.Warn("Shader hot reload disabled", logging.F("err", err))
+		return
+	}
+	app.shaderWatcher = w
+	app.logger.Info("Watching for shader changes", logging.F("dir", app.ShaderReloadDir))
+}
+
+func (app *HelloTriangleApplication) stopShaderReload() {
+	if app.shaderWatcher != nil {
+		app.shaderWatcher.Close()
+		app.shaderWatcher = nil
+	}
+}
+
+// shaderCode prefers SPIR-V recompiled by hot reload over the embedded build.
+func (app *HelloTriangleApplication) shaderCode(name string, embedded []byte) []byte {
+	if code, ok := app.reloadedShaders[name]; ok {
+		return code
+	}
+	return embedded
+}
+
+// reloadChangedShaders recompiles any shader sources that changed and
+// rebuilds the graphics pipeline with them. Compile and pipeline errors are
+// logged and the previous shaders kept, so a typo doesn't end the session.
+func (app *HelloTriangleApplication) reloadChangedShaders() error {
+	if app.shaderWatcher == nil {
+		return nil
+	}
+
+	// A save can be several writes, each source is compiled once
+	changed := map[string]bool{}
+	for pending := true; pending; {
+		select {
+		case path := <-app.shaderWatcher.Changes():
+			changed[path] = true
+		default:
+			pending = false
+		}
+	}
+
+	compiled := map[string][]byte{}
+	for path := range changed {
+		code, err := shaders.Compile(path)
+		if err != nil {
+			app.logger.Warn("Keeping previous shader", logging.F("err", err))
+			continue
+		}
+		compiled[filepath.Base(path)] = code
+	}
+	if len(compiled) == 0 {
+		return nil
+	}
+
+	previous := app.reloadedShaders
+	reloaded := make(map[string][]byte, len(previous)+len(compiled))
+	for name, code := range previous {
+		reloaded[name] = code
+	}
+	for name, code := range compiled {
+		reloaded[name] = code
+	}
+
+	app.reloadedShaders = reloaded
+	if err := app.rebuildGraphicsPipelines(); err != nil {
+		app.logger.Warn("Keeping previous shaders, can't rebuild pipeline", logging.F("err", err))
+
+		app.reloadedShaders = previous
+		if err := app.rebuildGraphicsPipelines(); err != nil {
+			return errors.Wrap(err, "can't restore graphics pipeline")
+		}
+		return nil
+	}
+
+	for name := range compiled {
+		app.logger.Info("Reloaded shader", logging.F("name", name))
+	}
+	return nil
+}
+
+// rebuildGraphicsPipelines recreates every window's pipeline from the
+// current shaders. The old pipelines are destroyed once the frames in
+// flight that use them finish, so nothing waits for the device to go idle.
+func (app *HelloTriangleApplication) rebuildGraphicsPipelines() error {
+	return app.forEachWindow(func() error {
+		app.destroyGraphicsPipeline()
+		return app.createGraphicsPipeline()
+	})
+}
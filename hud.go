@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/swapchain"
+	"github.com/inkyblackness/imgui-go/v4"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+const (
+	defaultHUDKey = glfw.KeyF3
+	// hudMargin is the gap between the HUD and the window's corner.
+	hudMargin = 10
+)
+
+func (app *HelloTriangleApplication) hudKey() glfw.Key {
+	if app.HUDKey == 0 {
+		return defaultHUDKey
+	}
+	return app.HUDKey
+}
+
+// hudUI shows what the frame is running on and how fast in the top left
+// corner, out of the way of the mouse.
+func (app *HelloTriangleApplication) hudUI() {
+	imgui.SetNextWindowPosV(imgui.Vec2{X: hudMargin, Y: hudMargin}, imgui.ConditionAlways, imgui.Vec2{})
+	imgui.SetNextWindowBgAlpha(0.35)
+	flags := imgui.WindowFlagsNoDecoration | imgui.WindowFlagsAlwaysAutoResize | imgui.WindowFlagsNoSavedSettings |
+		imgui.WindowFlagsNoFocusOnAppearing | imgui.WindowFlagsNoNav | imgui.WindowFlagsNoMove | imgui.WindowFlagsNoInputs
+	defer imgui.End()
+	if !imgui.BeginV("HUD", nil, flags) {
+		return
+	}
+
+	if app.gpuName == "" {
+		app.gpuName = physicalDeviceName(app.physicalDevice)
+	}
+	imgui.Text(app.gpuName)
+
+	summary := app.frameStats.Summary()
+	imgui.Text(fmt.Sprintf("%.1f FPS, %v mean, %v p99", summary.FPS, summary.Present.Mean, summary.Present.P99))
+	intervals := app.frameStats.Intervals()
+	ms := make([]float32, len(intervals))
+	for i, d := range intervals {
+		ms[i] = float32(d.Seconds() * 1000)
+	}
+	// MaxFloat32 has ImGui scale the graph to the slowest frame
+	imgui.PlotLinesV("##frame times", ms, 0, "frame ms", 0, math.MaxFloat32, imgui.Vec2{X: 240, Y: 40})
+
+	imgui.Separator()
+	imgui.Text(fmt.Sprintf("%dx%d %s, %d images", app.target.Extent.Width, app.target.Extent.Height,
+		swapchain.FormatName(app.target.Format), len(app.target.Images)))
+	if app.swapchain != nil {
+		imgui.Text("present mode " + swapchain.PresentModeName(app.swapchain.PresentMode))
+	}
+	imgui.Text("polygon mode " + polygonModeNames[app.polygonModes()[app.polygonMode]])
+	if app.wrongGamma {
+		imgui.Text("wrong gamma")
+	}
+	if app.Deferred {
+		imgui.Text("deferred rendering")
+	} else {
+		imgui.Text("forward rendering")
+	}
+	culled, occluded, drawn := summary.Counts[culledObjectsCount], summary.Counts[occludedObjectsCount], summary.Counts[drawnObjectsCount]
+	frozen := ""
+	if app.freezeFrustum {
+		frozen = ", frustum frozen"
+	}
+	imgui.Text(fmt.Sprintf("%d of %d objects drawn%s", drawn, culled+occluded+drawn, frozen))
+	if app.occlusionQueries != nil {
+		imgui.Text(fmt.Sprintf("%d occluded", occluded))
+	}
+	if len(app.mesh.LODs) > 0 {
+		levels := make([]string, len(app.mesh.LODs)+1)
+		for level := range levels {
+			levels[level] = fmt.Sprint(summary.Counts[lodObjectsCount(level)])
+		}
+		colors := ""
+		if app.lodColors {
+			colors = ", LOD colors"
+		}
+		imgui.Text(fmt.Sprintf("objects per LOD %s%s", strings.Join(levels, "/"), colors))
+	}
+
+	imgui.Separator()
+	stats := app.allocator.Stats()
+	imgui.Text(fmt.Sprintf("%d allocations in %d blocks, %d dedicated", stats.Allocations, stats.Blocks, stats.Dedicated))
+	imgui.Text(fmt.Sprintf("%d of %d MiB used", stats.Used>>20, stats.Reserved>>20))
+	if heaps, ok := app.memoryBudget(); ok {
+		for _, h := range heaps {
+			imgui.Text(fmt.Sprintf("heap %d: %d of %d MiB budget", h.Heap, h.Usage>>20, h.Budget>>20))
+		}
+	}
+}
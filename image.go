@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// mipLevelsFor is the length of a full mip chain down to 1x1.
+func mipLevelsFor(width, height uint32) uint32 {
+	size := width
+	if height > size {
+		size = height
+	}
+	levels := uint32(1)
+	for size > 1 {
+		size >>= 1
+		levels++
+	}
+	return levels
+}
+
+// generateMipmaps records filling mip levels 1 and up of img from level 0
+// into the uploader, after level 0's upload. They all end up
+// SHADER_READ_ONLY_OPTIMAL.
+func (app *HelloTriangleApplication) generateMipmaps(img *gpu.Image) error {
+	// Linear blits aren't guaranteed for every format, formats that can't
+	// need their mip chain generated offline instead
+	var formatProperties vk.FormatProperties
+	vk.GetPhysicalDeviceFormatProperties(app.physicalDevice, img.Format, &formatProperties)
+	formatProperties.Deref()
+	linearBlit := vk.FormatFeatureFlags(vk.FormatFeatureSampledImageFilterLinearBit)
+	if formatProperties.OptimalTilingFeatures&linearBlit == 0 {
+		return errors.Errorf("image format %d doesn't support linear blitting", img.Format)
+	}
+
+	return app.uploader.Record(img.CmdGenerateMipmaps)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+)
+
+// instanceLocation is the first of instanced.vert's per instance inputs.
+const instanceLocation = 5
+
+// Instance is the per instance data in the instance buffer, its fields must
+// follow instanced.vert's per instance inputs in location order.
+type Instance struct {
+	Model vmath.Mat4
+}
+
+func (app *HelloTriangleApplication) instanced() bool {
+	return app.Instances > 0
+}
+
+// vertexShader is the name and embedded SPIR-V of the vertex shader the
+// pipeline uses.
+func (app *HelloTriangleApplication) vertexShader() (string, []byte) {
+	if app.instanced() {
+		return "instanced.vert", shaders.Instanced()
+	}
+	if app.skinned() {
+		return "skinned.vert", shaders.Skinned()
+	}
+	return "shader.vert", shaders.Vert()
+}
+
+// createInstances uploads a transform per instance when instancing, the
+// mesh is then drawn once per instance by every draw.
+func (app *HelloTriangleApplication) createInstances() error {
+	if !app.instanced() {
+		return nil
+	}
+
+	transforms := instanceTransforms(app.Instances)
+	instances, err := gpu.NewVertexBuffer(app.gpuContext(), transforms)
+	if err != nil {
+		return errors.Wrap(err, "can't upload instances")
+	}
+	app.name(instances.Handle, "mesh instances")
+	app.mesh.Instances = instances
+	app.mesh.InstanceCount = uint32(app.Instances)
+	app.mesh.Radius = instancesRadius(transforms, app.mesh.Radius)
+	app.mesh.Bounds = instancesBounds(transforms, app.mesh.Bounds)
+	app.logger.Info("Drawing instanced", logging.F("instances", app.Instances))
+	return nil
+}
+
+// instancesRadius bounds the instances of a mesh with radius, each
+// transform is uniformly scaled.
+func instancesRadius(instances []Instance, radius float32) float32 {
+	var bound float32
+	for _, in := range instances {
+		m := in.Model
+		centre := vmath.Vec3{m[12], m[13], m[14]}
+		scale := vmath.Vec3{m[0], m[1], m[2]}.Len()
+		if r := centre.Len() + scale*radius; r > bound {
+			bound = r
+		}
+	}
+	return bound
+}
+
+// instanceTransforms fills a cube around the origin with count shrunken
+// copies of the mesh, each turned a little further than the last so the
+// grid doesn't look like a single texture.
+func instanceTransforms(count int) []Instance {
+	side := int(math.Ceil(math.Cbrt(float64(count))))
+	spacing := 2 / float32(side)
+	centre := float32(side-1) / 2
+	scale := vmath.Scale(vmath.Vec3{spacing * 0.8, spacing * 0.8, spacing * 0.8})
+
+	instances := make([]Instance, count)
+	for i := range instances {
+		x, y, z := i%side, i/side%side, i/(side*side)
+		position := vmath.Vec3{
+			(float32(x) - centre) * spacing,
+			(float32(y) - centre) * spacing,
+			(float32(z) - centre) * spacing,
+		}
+		turn := vmath.Rotate(float32(i)*vmath.Radians(7), vmath.Vec3{0, 1, 0})
+		instances[i] = Instance{Model: vmath.Translate(position).Mul(turn).Mul(scale)}
+	}
+	return instances
+}
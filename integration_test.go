@@ -0,0 +1,76 @@
+//go:build integration
+
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/delaneyj/learnvulkan/debugutils"
+	"github.com/delaneyj/learnvulkan/logging"
+)
+
+// integrationFrames is how many frames the integration test renders, enough
+// for every frame in flight's resources to be used more than once.
+const integrationFrames = 10
+
+// TestHeadlessValidation renders frames offscreen with the validation layers
+// and fails on any error they report or any object left alive at exit. It's
+// meant for a software Vulkan implementation on CI, picked with
+// $VK_DRIVER_FILES and $LEARNVULKAN_GPU, and needs the shaders to have been
+// generated.
+func TestHeadlessValidation(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		messages []debugutils.Message
+	)
+	output := filepath.Join(t.TempDir(), "frame.png")
+	app := HelloTriangleApplication{
+		Config:         AppConfig{Width: 320, Height: 240},
+		Logger:         logging.Discard(),
+		GPU:            os.Getenv(gpuEnv),
+		Headless:       true,
+		HeadlessOutput: output,
+		HeadlessFrames: integrationFrames,
+		FailOnLeaks:    true,
+		Validation: ValidationConfig{
+			Policy:      ValidationRequire,
+			MinSeverity: debugutils.SeverityWarning,
+			Callback: func(msg debugutils.Message) {
+				mu.Lock()
+				defer mu.Unlock()
+				messages = append(messages, msg)
+			},
+		},
+	}
+
+	err := app.Run()
+	mu.Lock()
+	for _, msg := range messages {
+		if msg.Severity >= debugutils.SeverityError {
+			t.Errorf("validation %s %s (%d): %s", msg.Severity, msg.IDName, msg.ID, msg.Text)
+		} else {
+			t.Logf("validation %s %s (%d): %s", msg.Severity, msg.IDName, msg.ID, msg.Text)
+		}
+	}
+	mu.Unlock()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatalf("no frame written: %v", err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("can't decode frame: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 320 || size.Y != 240 {
+		t.Errorf("frame is %v, want 320x240", size)
+	}
+}
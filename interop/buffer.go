@@ -0,0 +1,70 @@
+package interop
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Structure types the bindings predate.
+const structureTypeExternalMemoryBufferCreateInfo vk.StructureType = 1000072000
+
+// Buffer is a buffer with a dedicated allocation of exportable memory, for
+// another API like CUDA to write into and the renderer to read, or the
+// other way around.
+type Buffer struct {
+	allocator *memory.Allocator
+	device    vk.Device
+
+	Handle     vk.Buffer
+	Allocation *memory.Allocation
+	// Size is what the buffer was created with, the importer maps
+	// Allocation.Size bytes of memory.
+	Size vk.DeviceSize
+}
+
+// NewBuffer creates a buffer of size bytes whose memory can be exported
+// with ExportMemory.
+func (d *Device) NewBuffer(allocator *memory.Allocator, size vk.DeviceSize, usage vk.BufferUsageFlags) (*Buffer, error) {
+	external := &externalInfo{sType: structureTypeExternalMemoryBufferCreateInfo, handleTypes: handleType}
+	b := &Buffer{allocator: allocator, device: d.device, Size: size}
+	err := vk.Error(vk.CreateBuffer(d.device, &vk.BufferCreateInfo{
+		SType:       vk.StructureTypeBufferCreateInfo,
+		PNext:       unsafe.Pointer(external),
+		Size:        size,
+		Usage:       usage,
+		SharingMode: vk.SharingModeExclusive,
+	}, nil, &b.Handle))
+	runtime.KeepAlive(external)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create exportable buffer")
+	}
+
+	dedicated := &dedicatedInfo{sType: structureTypeMemoryDedicatedAllocateInfo, buffer: b.Handle}
+	export := &externalInfo{sType: structureTypeExportMemoryAllocateInfo, pNext: unsafe.Pointer(dedicated), handleTypes: handleType}
+	alloc, err := allocator.AllocateBufferDedicated(b.Handle, memory.GPUOnly, unsafe.Pointer(export))
+	runtime.KeepAlive(dedicated)
+	runtime.KeepAlive(export)
+	if err != nil {
+		b.Destroy()
+		return nil, errors.Wrap(err, "can't allocate exportable buffer memory")
+	}
+	b.Allocation = alloc
+	return b, nil
+}
+
+// Destroy destroys the buffer and frees its memory, after any importer is
+// done with them.
+func (b *Buffer) Destroy() {
+	if b.Handle != vk.NullBuffer {
+		vk.DestroyBuffer(b.device, b.Handle, nil)
+		b.Handle = vk.NullBuffer
+	}
+	if b.Allocation != nil {
+		b.allocator.Free(b.Allocation)
+		b.Allocation = nil
+	}
+}
@@ -0,0 +1,62 @@
+#include <stddef.h>
+
+#include "interop.h"
+
+typedef void (*PFN_vkVoidFunction)(void);
+typedef PFN_vkVoidFunction (*PFN_vkGetInstanceProcAddr)(VkInstance instance, const char* pName);
+typedef PFN_vkVoidFunction (*PFN_vkGetDeviceProcAddr)(VkDevice device, const char* pName);
+typedef VkResult (*PFN_vkGetFdKHR)(VkDevice device, const LVGetHandleInfo* pGetFdInfo, int* pFd);
+typedef VkResult (*PFN_vkGetWin32HandleKHR)(VkDevice device, const LVGetHandleInfo* pGetWin32HandleInfo, void** pHandle);
+
+VkResult loadInteropFunctions(void* getInstanceProcAddr, VkInstance instance, VkDevice device, int win32, LVFunctions* fn) {
+	PFN_vkGetDeviceProcAddr getDeviceProcAddr = (PFN_vkGetDeviceProcAddr)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(instance, "vkGetDeviceProcAddr");
+	if (getDeviceProcAddr == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+
+	fn->win32 = win32;
+	if (win32) {
+		fn->getMemoryHandle = (void*)getDeviceProcAddr(device, "vkGetMemoryWin32HandleKHR");
+		fn->getSemaphoreHandle = (void*)getDeviceProcAddr(device, "vkGetSemaphoreWin32HandleKHR");
+	} else {
+		fn->getMemoryHandle = (void*)getDeviceProcAddr(device, "vkGetMemoryFdKHR");
+		fn->getSemaphoreHandle = (void*)getDeviceProcAddr(device, "vkGetSemaphoreFdKHR");
+	}
+	if (fn->getMemoryHandle == NULL || fn->getSemaphoreHandle == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+	return 0;
+}
+
+// getHandle calls get with info, returning the fd or HANDLE it exports
+// widened to 64 bits.
+static VkResult getHandle(const LVFunctions* fn, void* get, VkDevice device, const LVGetHandleInfo* info, uint64_t* handle) {
+	if (fn->win32) {
+		void* h = NULL;
+		VkResult result = ((PFN_vkGetWin32HandleKHR)get)(device, info, &h);
+		*handle = (uint64_t)(uintptr_t)h;
+		return result;
+	}
+	int fd = -1;
+	VkResult result = ((PFN_vkGetFdKHR)get)(device, info, &fd);
+	*handle = (uint64_t)(int64_t)fd;
+	return result;
+}
+
+VkResult exportMemory(const LVFunctions* fn, VkDevice device, VkDeviceMemory memory, uint32_t handleType, uint64_t* handle) {
+	LVGetHandleInfo info = {
+		.sType = fn->win32 ? LV_STRUCTURE_TYPE_MEMORY_GET_WIN32_HANDLE_INFO_KHR : LV_STRUCTURE_TYPE_MEMORY_GET_FD_INFO_KHR,
+		.object = memory,
+		.handleType = handleType,
+	};
+	return getHandle(fn, fn->getMemoryHandle, device, &info, handle);
+}
+
+VkResult exportSemaphore(const LVFunctions* fn, VkDevice device, VkSemaphore semaphore, uint32_t handleType, uint64_t* handle) {
+	LVGetHandleInfo info = {
+		.sType = fn->win32 ? LV_STRUCTURE_TYPE_SEMAPHORE_GET_WIN32_HANDLE_INFO_KHR : LV_STRUCTURE_TYPE_SEMAPHORE_GET_FD_INFO_KHR,
+		.object = semaphore,
+		.handleType = handleType,
+	};
+	return getHandle(fn, fn->getSemaphoreHandle, device, &info, handle);
+}
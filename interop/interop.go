@@ -0,0 +1,201 @@
+// Package interop exports images, buffers and semaphores to other APIs, like
+// an OpenGL application displaying what Vulkan rendered or a CUDA kernel
+// producing what it draws, with VK_KHR_external_memory and
+// VK_KHR_external_semaphore. Handles are file
+// descriptors, or Win32 handles on Windows. Like rendering, entry points
+// are loaded through vkGetDeviceProcAddr so the only C dependency is
+// interop.h.
+package interop
+
+/*
+#include "interop.h"
+*/
+import "C"
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Structure types the bindings predate.
+const (
+	structureTypeExternalMemoryImageCreateInfo vk.StructureType = 1000072001
+	structureTypeExportMemoryAllocateInfo      vk.StructureType = 1000072002
+	structureTypeExportSemaphoreCreateInfo     vk.StructureType = 1000077000
+	structureTypeMemoryDedicatedAllocateInfo   vk.StructureType = 1000127001
+)
+
+// Handle is an exported file descriptor or Win32 handle. Whoever it's
+// handed to owns it, importing it into OpenGL transfers that ownership to
+// the driver.
+type Handle uintptr
+
+// Device is a logical device's export entry points.
+type Device struct {
+	device vk.Device
+	fn     C.LVFunctions
+}
+
+// Load loads device's entry points, it has to have been created with
+// Extensions.
+func Load(getInstanceProcAddr unsafe.Pointer, instance vk.Instance, device vk.Device) (*Device, error) {
+	if getInstanceProcAddr == nil {
+		return nil, errors.New("vkGetInstanceProcAddr is nil")
+	}
+	d := &Device{device: device}
+	result := C.loadInteropFunctions(getInstanceProcAddr, C.VkInstance(unsafe.Pointer(instance)), C.VkDevice(unsafe.Pointer(device)), win32, &d.fn)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return nil, errors.Wrap(err, "can't load external memory functions")
+	}
+	return d, nil
+}
+
+// externalInfo is laid out like VkExternalMemoryImageCreateInfo,
+// VkExportMemoryAllocateInfo and VkExportSemaphoreCreateInfo.
+type externalInfo struct {
+	sType       vk.StructureType
+	pNext       unsafe.Pointer
+	handleTypes uint32
+}
+
+// dedicatedInfo is laid out like VkMemoryDedicatedAllocateInfo.
+type dedicatedInfo struct {
+	sType  vk.StructureType
+	pNext  unsafe.Pointer
+	image  vk.Image
+	buffer vk.Buffer
+}
+
+// ImageInfo describes an image to export.
+type ImageInfo struct {
+	Width  uint32
+	Height uint32
+	Format vk.Format
+	Usage  vk.ImageUsageFlags
+}
+
+// Image is an optimally tiled 2D image with a dedicated allocation of
+// exportable memory. The importer needs the memory's Size as well as its
+// handle.
+type Image struct {
+	allocator *memory.Allocator
+	device    vk.Device
+
+	Handle     vk.Image
+	Allocation *memory.Allocation
+	Format     vk.Format
+	Width      uint32
+	Height     uint32
+	// Layout is the layout the image was left in by the last commands
+	// recorded on it, the importer has to be told it.
+	Layout vk.ImageLayout
+}
+
+// NewImage creates an image whose memory can be exported with
+// ExportMemory. Dedicated allocations are what OpenGL expects to import.
+func (d *Device) NewImage(allocator *memory.Allocator, info ImageInfo) (*Image, error) {
+	external := &externalInfo{sType: structureTypeExternalMemoryImageCreateInfo, handleTypes: handleType}
+	imageInfo := &vk.ImageCreateInfo{
+		SType:     vk.StructureTypeImageCreateInfo,
+		PNext:     unsafe.Pointer(external),
+		ImageType: vk.ImageType2d,
+		Extent: vk.Extent3D{
+			Width:  info.Width,
+			Height: info.Height,
+			Depth:  1,
+		},
+		MipLevels:     1,
+		ArrayLayers:   1,
+		Format:        info.Format,
+		Tiling:        vk.ImageTilingOptimal,
+		InitialLayout: vk.ImageLayoutUndefined,
+		Usage:         info.Usage,
+		Samples:       vk.SampleCount1Bit,
+		SharingMode:   vk.SharingModeExclusive,
+	}
+	img := &Image{
+		allocator: allocator,
+		device:    d.device,
+		Format:    info.Format,
+		Width:     info.Width,
+		Height:    info.Height,
+		Layout:    vk.ImageLayoutUndefined,
+	}
+	err := vk.Error(vk.CreateImage(d.device, imageInfo, nil, &img.Handle))
+	runtime.KeepAlive(external)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create exportable image")
+	}
+
+	dedicated := &dedicatedInfo{sType: structureTypeMemoryDedicatedAllocateInfo, image: img.Handle}
+	export := &externalInfo{sType: structureTypeExportMemoryAllocateInfo, pNext: unsafe.Pointer(dedicated), handleTypes: handleType}
+	alloc, err := allocator.AllocateImageDedicated(img.Handle, memory.GPUOnly, unsafe.Pointer(export))
+	runtime.KeepAlive(dedicated)
+	runtime.KeepAlive(export)
+	if err != nil {
+		img.Destroy()
+		return nil, errors.Wrap(err, "can't allocate exportable image memory")
+	}
+	img.Allocation = alloc
+	return img, nil
+}
+
+// Destroy destroys the image and frees its memory, after any importer is
+// done with them.
+func (img *Image) Destroy() {
+	if img.Handle != vk.NullImage {
+		vk.DestroyImage(img.device, img.Handle, nil)
+		img.Handle = vk.NullImage
+	}
+	if img.Allocation != nil {
+		img.allocator.Free(img.Allocation)
+		img.Allocation = nil
+	}
+}
+
+// ExportMemory exports an Image's or Buffer's memory. Every call returns a
+// new handle.
+func (d *Device) ExportMemory(alloc *memory.Allocation) (Handle, error) {
+	var handle C.uint64_t
+	result := C.exportMemory(&d.fn, C.VkDevice(unsafe.Pointer(d.device)),
+		C.VkDeviceMemory(unsafe.Pointer(alloc.Memory)), handleType, &handle)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return 0, errors.Wrap(err, "can't export memory")
+	}
+	return Handle(handle), nil
+}
+
+// NewSemaphore creates a binary semaphore that can be exported with
+// ExportSemaphore.
+func (d *Device) NewSemaphore() (vk.Semaphore, error) {
+	return d.newSemaphore(nil)
+}
+
+func (d *Device) newSemaphore(next unsafe.Pointer) (vk.Semaphore, error) {
+	export := &externalInfo{sType: structureTypeExportSemaphoreCreateInfo, pNext: next, handleTypes: handleType}
+	var s vk.Semaphore
+	err := vk.Error(vk.CreateSemaphore(d.device, &vk.SemaphoreCreateInfo{
+		SType: vk.StructureTypeSemaphoreCreateInfo,
+		PNext: unsafe.Pointer(export),
+	}, nil, &s))
+	runtime.KeepAlive(export)
+	if err != nil {
+		return vk.NullSemaphore, errors.Wrap(err, "can't create exportable semaphore")
+	}
+	return s, nil
+}
+
+// ExportSemaphore exports s, which has to have been created by
+// NewSemaphore or NewTimelineSemaphore. Every call returns a new handle.
+func (d *Device) ExportSemaphore(s vk.Semaphore) (Handle, error) {
+	var handle C.uint64_t
+	result := C.exportSemaphore(&d.fn, C.VkDevice(unsafe.Pointer(d.device)), C.VkSemaphore(unsafe.Pointer(s)), handleType, &handle)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return 0, errors.Wrap(err, "can't export semaphore")
+	}
+	return Handle(handle), nil
+}
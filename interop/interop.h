@@ -0,0 +1,45 @@
+// The subset of VK_KHR_external_memory_fd, VK_KHR_external_semaphore_fd and
+// their Win32 equivalents the package needs, declared here so it builds
+// without the Vulkan headers. Layouts follow vulkan_core.h and
+// vulkan_win32.h.
+#ifndef LEARNVULKAN_INTEROP_H
+#define LEARNVULKAN_INTEROP_H
+
+#include <stdint.h>
+
+typedef struct VkInstance_T* VkInstance;
+typedef struct VkDevice_T* VkDevice;
+typedef struct VkDeviceMemory_T* VkDeviceMemory;
+typedef struct VkSemaphore_T* VkSemaphore;
+typedef int32_t VkResult;
+
+#define LV_STRUCTURE_TYPE_MEMORY_GET_WIN32_HANDLE_INFO_KHR 1000073003
+#define LV_STRUCTURE_TYPE_MEMORY_GET_FD_INFO_KHR 1000074002
+#define LV_STRUCTURE_TYPE_SEMAPHORE_GET_WIN32_HANDLE_INFO_KHR 1000078003
+#define LV_STRUCTURE_TYPE_SEMAPHORE_GET_FD_INFO_KHR 1000079001
+#define LV_ERROR_EXTENSION_NOT_PRESENT -7
+
+// LVGetHandleInfo is laid out like each of VkMemoryGetFdInfoKHR,
+// VkMemoryGetWin32HandleInfoKHR, VkSemaphoreGetFdInfoKHR and
+// VkSemaphoreGetWin32HandleInfoKHR.
+typedef struct LVGetHandleInfo {
+	int32_t sType;
+	const void* pNext;
+	void* object;
+	uint32_t handleType;
+} LVGetHandleInfo;
+
+// LVFunctions are the device's extension entry points, the fd or the Win32
+// ones depending on win32.
+typedef struct LVFunctions {
+	int win32;
+	void* getMemoryHandle;
+	void* getSemaphoreHandle;
+} LVFunctions;
+
+VkResult loadInteropFunctions(void* getInstanceProcAddr, VkInstance instance, VkDevice device, int win32, LVFunctions* fn);
+
+VkResult exportMemory(const LVFunctions* fn, VkDevice device, VkDeviceMemory memory, uint32_t handleType, uint64_t* handle);
+VkResult exportSemaphore(const LVFunctions* fn, VkDevice device, VkSemaphore semaphore, uint32_t handleType, uint64_t* handle);
+
+#endif
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package interop
+
+// Extensions are the device extensions exporting needs on a Vulkan 1.1
+// device, where external memory and semaphores themselves are core.
+var Extensions = []string{
+	"VK_KHR_external_memory_fd",
+	"VK_KHR_external_semaphore_fd",
+}
+
+// handleType is VK_EXTERNAL_MEMORY_HANDLE_TYPE_OPAQUE_FD_BIT, which is also
+// VK_EXTERNAL_SEMAPHORE_HANDLE_TYPE_OPAQUE_FD_BIT. OpenGL imports them with
+// GL_EXT_memory_object_fd and GL_EXT_semaphore_fd.
+const handleType = 0x00000001
+
+const win32 = 0
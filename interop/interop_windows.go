@@ -0,0 +1,15 @@
+package interop
+
+// Extensions are the device extensions exporting needs on a Vulkan 1.1
+// device, where external memory and semaphores themselves are core.
+var Extensions = []string{
+	"VK_KHR_external_memory_win32",
+	"VK_KHR_external_semaphore_win32",
+}
+
+// handleType is VK_EXTERNAL_MEMORY_HANDLE_TYPE_OPAQUE_WIN32_BIT, which is
+// also VK_EXTERNAL_SEMAPHORE_HANDLE_TYPE_OPAQUE_WIN32_BIT. OpenGL imports
+// them with GL_EXT_memory_object_win32 and GL_EXT_semaphore_win32.
+const handleType = 0x00000002
+
+const win32 = 1
@@ -0,0 +1,119 @@
+package interop
+
+import (
+	"runtime"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// TimelineExtensions are the device extensions timeline semaphores need on
+// a Vulkan 1.1 device.
+var TimelineExtensions = []string{"VK_KHR_timeline_semaphore"}
+
+// Structure types the bindings predate.
+const (
+	structureTypeTimelineSemaphoreFeatures   vk.StructureType = 1000207000
+	structureTypeSemaphoreTypeCreateInfo     vk.StructureType = 1000207002
+	structureTypeTimelineSemaphoreSubmitInfo vk.StructureType = 1000207003
+	semaphoreTypeTimeline                                     = 1
+)
+
+// TimelineFeatures is laid out like
+// VkPhysicalDeviceTimelineSemaphoreFeatures, to put on
+// vk.DeviceCreateInfo's PNext. It has to be kept alive until the device is
+// created.
+type TimelineFeatures struct {
+	sType             vk.StructureType
+	pNext             unsafe.Pointer
+	timelineSemaphore vk.Bool32
+}
+
+// NewTimelineFeatures enables timeline semaphores, chained in front of
+// next.
+func NewTimelineFeatures(next unsafe.Pointer) *TimelineFeatures {
+	return &TimelineFeatures{
+		sType:             structureTypeTimelineSemaphoreFeatures,
+		pNext:             next,
+		timelineSemaphore: vk.True,
+	}
+}
+
+// Pointer is the struct to chain.
+func (f *TimelineFeatures) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(f)
+}
+
+// TimelineSupported reports whether physicalDevice has timeline
+// semaphores. Its extensions have to have been checked for
+// TimelineExtensions first.
+func TimelineSupported(physicalDevice vk.PhysicalDevice) bool {
+	f := &TimelineFeatures{sType: structureTypeTimelineSemaphoreFeatures}
+	features := vk.PhysicalDeviceFeatures2{
+		SType: vk.StructureTypePhysicalDeviceFeatures2,
+		PNext: f.Pointer(),
+	}
+	vk.GetPhysicalDeviceFeatures2(physicalDevice, &features)
+	runtime.KeepAlive(f)
+	return f.timelineSemaphore.B()
+}
+
+// semaphoreTypeInfo is laid out like VkSemaphoreTypeCreateInfo.
+type semaphoreTypeInfo struct {
+	sType         vk.StructureType
+	pNext         unsafe.Pointer
+	semaphoreType int32
+	initialValue  uint64
+}
+
+// NewTimelineSemaphore creates a timeline semaphore starting at initial
+// that can be exported with ExportSemaphore. CUDA imports it as
+// cudaExternalSemaphoreHandleTypeTimelineSemaphoreFd, or ...Win32.
+func (d *Device) NewTimelineSemaphore(initial uint64) (vk.Semaphore, error) {
+	info := &semaphoreTypeInfo{
+		sType:         structureTypeSemaphoreTypeCreateInfo,
+		semaphoreType: semaphoreTypeTimeline,
+		initialValue:  initial,
+	}
+	s, err := d.newSemaphore(unsafe.Pointer(info))
+	runtime.KeepAlive(info)
+	return s, err
+}
+
+// TimelineSubmit is laid out like VkTimelineSemaphoreSubmitInfo, to put on
+// vk.SubmitInfo's PNext. It has to be kept alive until the submit.
+type TimelineSubmit struct {
+	sType                     vk.StructureType
+	pNext                     unsafe.Pointer
+	waitSemaphoreValueCount   uint32
+	pWaitSemaphoreValues      *uint64
+	signalSemaphoreValueCount uint32
+	pSignalSemaphoreValues    *uint64
+
+	values []uint64
+}
+
+// NewTimelineSubmit gives the values a submit waits for and signals, one
+// per wait and signal semaphore in order. Binary semaphores' values are
+// ignored.
+func NewTimelineSubmit(next unsafe.Pointer, waits, signals []uint64) *TimelineSubmit {
+	t := &TimelineSubmit{
+		sType:                     structureTypeTimelineSemaphoreSubmitInfo,
+		pNext:                     next,
+		waitSemaphoreValueCount:   uint32(len(waits)),
+		signalSemaphoreValueCount: uint32(len(signals)),
+		values:                    append(append([]uint64(nil), waits...), signals...),
+	}
+	if len(waits) > 0 {
+		t.pWaitSemaphoreValues = &t.values[0]
+	}
+	if len(signals) > 0 {
+		t.pSignalSemaphoreValues = &t.values[len(waits)]
+	}
+	return t
+}
+
+// Pointer is the struct to chain.
+func (t *TimelineSubmit) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(t)
+}
@@ -0,0 +1,80 @@
+package ktx
+
+// block is a format's texel block, a single texel for uncompressed formats.
+type block struct {
+	width, height uint32
+	size          uint32
+}
+
+// blocks are the blocks of the VkFormats textures come in, by ranges of
+// formats that share one.
+var blocks = []struct {
+	first, last uint32
+	block
+}{
+	// R8 to B8G8R8A8, UNORM to sRGB
+	{9, 15, block{1, 1, 1}},
+	{16, 22, block{1, 1, 2}},
+	{23, 36, block{1, 1, 3}},
+	{37, 57, block{1, 1, 4}},
+	// A2R10G10B10 and A2B10G10R10
+	{58, 69, block{1, 1, 4}},
+	// R16 to R16G16B16A16
+	{70, 76, block{1, 1, 2}},
+	{77, 83, block{1, 1, 4}},
+	{84, 90, block{1, 1, 6}},
+	{91, 97, block{1, 1, 8}},
+	// R32 to R32G32B32A32
+	{98, 100, block{1, 1, 4}},
+	{101, 103, block{1, 1, 8}},
+	{104, 106, block{1, 1, 12}},
+	{107, 109, block{1, 1, 16}},
+	// B10G11R11 and E5B9G9R9
+	{122, 123, block{1, 1, 4}},
+	// BC1 to BC7
+	{131, 134, block{4, 4, 8}},
+	{135, 138, block{4, 4, 16}},
+	{139, 140, block{4, 4, 8}},
+	{141, 146, block{4, 4, 16}},
+	// ETC2 and EAC
+	{147, 150, block{4, 4, 8}},
+	{151, 152, block{4, 4, 16}},
+	{153, 154, block{4, 4, 8}},
+	{155, 156, block{4, 4, 16}},
+	// ASTC, UNORM and sRGB of each size
+	{157, 158, block{4, 4, 16}},
+	{159, 160, block{5, 4, 16}},
+	{161, 162, block{5, 5, 16}},
+	{163, 164, block{6, 5, 16}},
+	{165, 166, block{6, 6, 16}},
+	{167, 168, block{8, 5, 16}},
+	{169, 170, block{8, 6, 16}},
+	{171, 172, block{8, 8, 16}},
+	{173, 174, block{10, 5, 16}},
+	{175, 176, block{10, 6, 16}},
+	{177, 178, block{10, 8, 16}},
+	{179, 180, block{10, 10, 16}},
+	{181, 182, block{12, 10, 16}},
+	{183, 184, block{12, 12, 16}},
+}
+
+// uastcBlock is a UASTC block, 128 bits per 4x4 texels like ASTC's.
+var uastcBlock = block{4, 4, 16}
+
+// formatBlock is format's block, false when it isn't one of blocks'.
+func formatBlock(format uint32) (block, bool) {
+	for _, b := range blocks {
+		if format >= b.first && format <= b.last {
+			return b.block, true
+		}
+	}
+	return block{}, false
+}
+
+// levelSize is how many bytes a level of width by height texels of b takes,
+// a block per b.width by b.height texels or part of them.
+func (b block) levelSize(width, height uint32) uint64 {
+	across := (uint64(width) + uint64(b.width) - 1) / uint64(b.width)
+	down := (uint64(height) + uint64(b.height) - 1) / uint64(b.height)
+	return across * down * uint64(b.size)
+}
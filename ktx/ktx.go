@@ -0,0 +1,258 @@
+// Package ktx reads KTX2 texture containers, a 2D image's mip chain in a
+// Vulkan format, optionally supercompressed or encoded with Basis
+// Universal.
+//
+// See https://registry.khronos.org/KTX/specs/2.0/ktxspec.v2.html.
+package ktx
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// identifier starts every KTX2 file.
+var identifier = []byte{0xab, 'K', 'T', 'X', ' ', '2', '0', 0xbb, '\r', '\n', 0x1a, '\n'}
+
+// Supercompression schemes from the header.
+const (
+	supercompressionNone    = 0
+	supercompressionBasisLZ = 1
+	supercompressionZstd    = 2
+	supercompressionZLIB    = 3
+)
+
+// Data format descriptor color models and transfer functions, from the
+// Khronos Data Format Specification.
+const (
+	modelETC1S    = 163
+	modelUASTC    = 166
+	transferSRGB  = 2
+	dfdHeaderSize = 4 + 8
+)
+
+// Codec is how a texture's levels are encoded on top of its format.
+type Codec int
+
+const (
+	// None is a texture whose levels are its Format's data.
+	None Codec = iota
+	// ETC1S is Basis Universal's ETC1S, BasisLZ supercompressed.
+	ETC1S
+	// UASTC is Basis Universal's UASTC.
+	UASTC
+)
+
+func (c Codec) String() string {
+	switch c {
+	case ETC1S:
+		return "ETC1S"
+	case UASTC:
+		return "UASTC"
+	default:
+		return "none"
+	}
+}
+
+// Texture is a KTX2 file's 2D image.
+type Texture struct {
+	// Format is the VkFormat of Levels, zero when they're Basis Universal
+	// and need transcoding into one.
+	Format uint32
+	Width  uint32
+	Height uint32
+	// Levels are the mip chain's data, the full size image first. Each is
+	// uncompressed unless Codec says otherwise.
+	Levels [][]byte
+	Codec  Codec
+	// SRGB is whether the data format descriptor says the colors are sRGB
+	// encoded. For a Format it's also in the format's name.
+	SRGB bool
+}
+
+// header is the fixed size start of a KTX2 file after its identifier.
+type header struct {
+	Format                 uint32
+	TypeSize               uint32
+	Width                  uint32
+	Height                 uint32
+	Depth                  uint32
+	Layers                 uint32
+	Faces                  uint32
+	Levels                 uint32
+	SupercompressionScheme uint32
+	DFDOffset              uint32
+	DFDLength              uint32
+	KVDOffset              uint32
+	KVDLength              uint32
+	SGDOffset              uint64
+	SGDLength              uint64
+}
+
+// level is an entry of the level index.
+type level struct {
+	Offset             uint64
+	Length             uint64
+	UncompressedLength uint64
+}
+
+// IsKTX2 is whether data starts like a KTX2 file.
+func IsKTX2(data []byte) bool {
+	return bytes.HasPrefix(data, identifier)
+}
+
+// Decode reads a KTX2 file's 2D image. Arrays, cube maps and 3D textures
+// aren't supported, nor is Zstandard supercompression. Levels must be the
+// size their format and dimensions make them, so a header can't make it
+// allocate more than that.
+func Decode(data []byte) (*Texture, error) {
+	if !IsKTX2(data) {
+		return nil, errors.New("not a KTX2 file")
+	}
+	r := bytes.NewReader(data[len(identifier):])
+	var h header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, errors.Wrap(err, "can't read header")
+	}
+	switch {
+	case h.Width == 0 || h.Height == 0:
+		return nil, errors.Errorf("%dx%d isn't a 2D image", h.Width, h.Height)
+	case h.Depth > 1:
+		return nil, errors.New("3D textures aren't supported")
+	case h.Layers > 1:
+		return nil, errors.New("texture arrays aren't supported")
+	case h.Faces > 1:
+		return nil, errors.New("cube maps aren't supported")
+	}
+	levelCount := h.Levels
+	if levelCount == 0 {
+		// Zero asks for the mip chain to be generated, of which there's the
+		// full size level
+		levelCount = 1
+	}
+	if chain := fullChain(h.Width, h.Height); levelCount > chain {
+		return nil, errors.Errorf("%d mip levels, a %dx%d image has at most %d", levelCount, h.Width, h.Height, chain)
+	}
+	if uint64(levelCount)*uint64(binary.Size(level{})) > uint64(r.Len()) {
+		return nil, errors.Errorf("level index of %d levels is past the end of the file", levelCount)
+	}
+	levels := make([]level, levelCount)
+	if err := binary.Read(r, binary.LittleEndian, levels); err != nil {
+		return nil, errors.Wrap(err, "can't read level index")
+	}
+
+	t := &Texture{Format: h.Format, Width: h.Width, Height: h.Height}
+	if err := t.readDFD(data, h); err != nil {
+		return nil, err
+	}
+	switch h.SupercompressionScheme {
+	case supercompressionNone, supercompressionZLIB:
+	case supercompressionBasisLZ:
+		t.Codec = ETC1S
+	case supercompressionZstd:
+		return nil, errors.New("Zstandard supercompression isn't supported")
+	default:
+		return nil, errors.Errorf("unknown supercompression scheme %d", h.SupercompressionScheme)
+	}
+	// ETC1S levels vary in size, everything else takes a block per block of
+	// texels
+	var blk block
+	switch t.Codec {
+	case None:
+		if t.Format == 0 {
+			return nil, errors.New("no format and not Basis Universal")
+		}
+		var ok bool
+		if blk, ok = formatBlock(t.Format); !ok {
+			return nil, errors.Errorf("format %d isn't supported", t.Format)
+		}
+	case UASTC:
+		blk = uastcBlock
+	}
+
+	t.Levels = make([][]byte, len(levels))
+	width, height := t.Width, t.Height
+	for i, l := range levels {
+		if l.Offset > uint64(len(data)) || l.Length > uint64(len(data))-l.Offset {
+			return nil, errors.Errorf("level %d's %d bytes at %d are past the end of the file", i, l.Length, l.Offset)
+		}
+		b := data[l.Offset : l.Offset+l.Length]
+		if t.Codec != ETC1S {
+			size := blk.levelSize(width, height)
+			if h.SupercompressionScheme == supercompressionZLIB {
+				if l.UncompressedLength != size {
+					return nil, errors.Errorf("level %d inflates to %d bytes, a %dx%d level is %d", i, l.UncompressedLength, width, height, size)
+				}
+				var err error
+				if b, err = inflate(b, size); err != nil {
+					return nil, errors.Wrapf(err, "can't inflate level %d", i)
+				}
+			} else if l.Length != size {
+				return nil, errors.Errorf("level %d is %d bytes, a %dx%d level is %d", i, l.Length, width, height, size)
+			}
+		}
+		t.Levels[i] = b
+		if width > 1 {
+			width /= 2
+		}
+		if height > 1 {
+			height /= 2
+		}
+	}
+	return t, nil
+}
+
+// fullChain is how many levels a width by height image's mip chain has,
+// halving down to 1x1.
+func fullChain(width, height uint32) uint32 {
+	size := width
+	if height > size {
+		size = height
+	}
+	levels := uint32(1)
+	for size > 1 {
+		size >>= 1
+		levels++
+	}
+	return levels
+}
+
+// readDFD takes the codec and color space from the basic block of the data
+// format descriptor.
+func (t *Texture) readDFD(data []byte, h header) error {
+	if h.DFDLength < dfdHeaderSize+4 {
+		return errors.New("no data format descriptor")
+	}
+	if uint64(h.DFDOffset)+uint64(h.DFDLength) > uint64(len(data)) {
+		return errors.New("data format descriptor is past the end of the file")
+	}
+	// The total size, the block's vendor and type, and its version and size
+	// come before its color model, primaries, transfer function and flags
+	block := data[h.DFDOffset+dfdHeaderSize : h.DFDOffset+h.DFDLength]
+	switch block[0] {
+	case modelUASTC:
+		t.Codec = UASTC
+	case modelETC1S:
+		t.Codec = ETC1S
+	}
+	t.SRGB = block[2] == transferSRGB
+	return nil
+}
+
+// inflate decompresses a ZLIB supercompressed level of size bytes, the size
+// its format says the level is, not what the file says it inflates to.
+func inflate(b []byte, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out := make([]byte, size)
+	if _, err := io.ReadFull(zr, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,184 @@
+package ktx
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+)
+
+// vkFormatBC7SRGB is VK_FORMAT_BC7_SRGB_BLOCK.
+const vkFormatBC7SRGB = 146
+
+// file builds a KTX2 file of h's header with levels after its level index
+// and a data format descriptor of model and transfer. levels are written
+// through compress, the level index recording their sizes before.
+func file(t *testing.T, h header, model, transfer byte, levels [][]byte, compress func([]byte) []byte) []byte {
+	t.Helper()
+	h.Levels = uint32(len(levels))
+	indexSize := len(identifier) + binary.Size(h) + len(levels)*binary.Size(level{})
+	dfd := make([]byte, dfdHeaderSize+24)
+	binary.LittleEndian.PutUint32(dfd, uint32(len(dfd)))
+	dfd[dfdHeaderSize] = model
+	dfd[dfdHeaderSize+2] = transfer
+	h.DFDOffset, h.DFDLength = uint32(indexSize), uint32(len(dfd))
+
+	offset := uint64(indexSize + len(dfd))
+	index := make([]level, len(levels))
+	var payload []byte
+	for i, l := range levels {
+		b := l
+		if compress != nil {
+			b = compress(l)
+		}
+		index[i] = level{Offset: offset, Length: uint64(len(b)), UncompressedLength: uint64(len(l))}
+		offset += uint64(len(b))
+		payload = append(payload, b...)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(identifier)
+	for _, v := range []interface{}{h, index} {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.Write(dfd)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// bc7Levels are the levels of a 8x8 BC7 texture, a 16 byte block per 4x4
+// texels.
+var bc7Levels = [][]byte{
+	bytes.Repeat([]byte{1}, 4*16),
+	bytes.Repeat([]byte{2}, 16),
+	bytes.Repeat([]byte{3}, 16),
+	bytes.Repeat([]byte{4}, 16),
+}
+
+func TestDecode(t *testing.T) {
+	data := file(t, header{Format: vkFormatBC7SRGB, TypeSize: 1, Width: 8, Height: 8, Faces: 1}, 128, transferSRGB, bc7Levels, nil)
+	if !IsKTX2(data) {
+		t.Fatal("IsKTX2 is false")
+	}
+	tex, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tex.Format != vkFormatBC7SRGB || tex.Width != 8 || tex.Height != 8 || tex.Codec != None || !tex.SRGB {
+		t.Errorf("texture = %+v", tex)
+	}
+	if len(tex.Levels) != len(bc7Levels) {
+		t.Fatalf("%d levels, want %d", len(tex.Levels), len(bc7Levels))
+	}
+	for i := range bc7Levels {
+		if !bytes.Equal(tex.Levels[i], bc7Levels[i]) {
+			t.Errorf("level %d = %v, want %v", i, tex.Levels[i], bc7Levels[i])
+		}
+	}
+}
+
+func TestDecodeZLIB(t *testing.T) {
+	deflate := func(b []byte) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	data := file(t, header{Format: vkFormatBC7SRGB, Width: 8, Height: 8, Faces: 1, SupercompressionScheme: supercompressionZLIB}, 128, transferSRGB, bc7Levels, deflate)
+	tex, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range bc7Levels {
+		if !bytes.Equal(tex.Levels[i], bc7Levels[i]) {
+			t.Errorf("level %d = %v, want %v", i, tex.Levels[i], bc7Levels[i])
+		}
+	}
+}
+
+func TestDecodeBasisUniversal(t *testing.T) {
+	tests := []struct {
+		name   string
+		h      header
+		model  byte
+		want   Codec
+		linear bool
+	}{
+		{"ETC1S", header{Width: 4, Height: 4, Faces: 1, SupercompressionScheme: supercompressionBasisLZ}, modelETC1S, ETC1S, false},
+		{"UASTC", header{Width: 4, Height: 4, Faces: 1}, modelUASTC, UASTC, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer := byte(transferSRGB)
+			if tt.linear {
+				transfer = 1
+			}
+			tex, err := Decode(file(t, tt.h, tt.model, transfer, [][]byte{make([]byte, 16)}, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tex.Codec != tt.want || tex.SRGB == tt.linear {
+				t.Errorf("codec %v, sRGB %v, want %v, %v", tex.Codec, tex.SRGB, tt.want, !tt.linear)
+			}
+		})
+	}
+}
+
+// patch overwrites the uint32 or uint64 at offset in a copy of data.
+func patch(data []byte, offset int, v interface{}) []byte {
+	data = append([]byte(nil), data...)
+	switch v := v.(type) {
+	case uint32:
+		binary.LittleEndian.PutUint32(data[offset:], v)
+	case uint64:
+		binary.LittleEndian.PutUint64(data[offset:], v)
+	}
+	return data
+}
+
+func TestDecodeRejects(t *testing.T) {
+	level := [][]byte{make([]byte, 16)}
+	truncated := file(t, header{Format: vkFormatBC7SRGB, Width: 4, Height: 4, Faces: 1}, 128, transferSRGB, level, nil)
+	deflated := file(t, header{Format: vkFormatBC7SRGB, Width: 4, Height: 4, Faces: 1, SupercompressionScheme: supercompressionZLIB}, 128, transferSRGB, level, func(b []byte) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	})
+	// The header's level count is its eighth field, and the first level's
+	// uncompressed length is the index's third
+	levelsAt := len(identifier) + 7*4
+	// A 2^31 texel wide chain is 32 levels, whose index is 768 bytes
+	wide := file(t, header{Format: vkFormatBC7SRGB, Width: 1 << 31, Height: 1, Faces: 1}, 128, transferSRGB, level, nil)
+	uncompressedAt := len(identifier) + binary.Size(header{}) + 2*8
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not KTX2", []byte("\x89PNG\r\n\x1a\n")},
+		{"cube map", file(t, header{Format: vkFormatBC7SRGB, Width: 4, Height: 4, Faces: 6}, 128, transferSRGB, level, nil)},
+		{"array", file(t, header{Format: vkFormatBC7SRGB, Width: 4, Height: 4, Faces: 1, Layers: 2}, 128, transferSRGB, level, nil)},
+		{"Zstandard", file(t, header{Format: vkFormatBC7SRGB, Width: 4, Height: 4, Faces: 1, SupercompressionScheme: supercompressionZstd}, 128, transferSRGB, level, nil)},
+		{"no format", file(t, header{Width: 4, Height: 4, Faces: 1}, 128, transferSRGB, level, nil)},
+		{"unknown format", file(t, header{Format: 1000, Width: 4, Height: 4, Faces: 1}, 128, transferSRGB, level, nil)},
+		{"truncated", truncated[:len(truncated)-1]},
+		{"truncated header", truncated[:len(identifier)+20]},
+		{"truncated level index", truncated[:len(identifier)+binary.Size(header{})+8]},
+		// A 4x4 chain is 4x4, 2x2 and 1x1
+		{"more levels than the chain", patch(truncated, levelsAt, uint32(4))},
+		{"more levels than the file indexes", patch(wide, levelsAt, uint32(32))},
+		{"level smaller than its format", file(t, header{Format: vkFormatBC7SRGB, Width: 8, Height: 8, Faces: 1}, 128, transferSRGB, level, nil)},
+		{"oversized uncompressed length", patch(deflated, uncompressedAt, uint64(1)<<40)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); err == nil {
+				t.Error("Decode didn't fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/delaneyj/learnvulkan/logging"
+)
+
+// track records that handle has been created as a kind of object, so it's
+// reported if it's still alive at exit. Buffers and images are tracked by
+// the gpu package through gpuContext.
+func (app *HelloTriangleApplication) track(kind string, handle interface{}) {
+	app.leaks.Track(kind, handle)
+}
+
+// release records that handle has been destroyed, handles that were never
+// tracked are ignored.
+func (app *HelloTriangleApplication) release(handle interface{}) {
+	app.leaks.Release(handle)
+}
+
+// reportLeaks logs every object that's still alive once everything should
+// have been destroyed, with where it was created in debug builds.
+func (app *HelloTriangleApplication) reportLeaks() {
+	for _, o := range app.leaks.Live() {
+		fields := []logging.Field{
+			logging.F("kind", o.Kind),
+			logging.F("handle", fmt.Sprintf("%v", o.Handle)),
+		}
+		if o.Stack != "" {
+			fields = append(fields, logging.F("created", o.Stack))
+		}
+		app.logger.Warn("Vulkan object wasn't destroyed", fields...)
+	}
+}
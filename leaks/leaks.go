@@ -0,0 +1,100 @@
+// Package leaks keeps a registry of the Vulkan objects that have been
+// created and not yet destroyed, so teardown can report whatever was
+// forgotten instead of leaving it to the validation layers, which only say
+// that something of a type is left. Built with the debug tag, each object
+// also remembers the stack it was created from.
+package leaks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Object is a live Vulkan object.
+type Object struct {
+	// Kind is what the object is, like "buffer" or "pipeline".
+	Kind string
+	// Handle is the object's Vulkan handle.
+	Handle interface{}
+	// Stack is where the object was created, empty unless built with the
+	// debug tag.
+	Stack string
+
+	serial uint64
+}
+
+// Registry is the set of live objects, keyed by handle. A nil Registry
+// tracks nothing, so tracking can be left off without checks around every
+// call. It's safe for concurrent use.
+type Registry struct {
+	mu     sync.Mutex
+	serial uint64
+	live   map[interface{}]Object
+}
+
+// New returns an empty Registry.
+func New() *Registry {
+	return &Registry{live: map[interface{}]Object{}}
+}
+
+// Track records that handle has been created as a kind of object.
+func (r *Registry) Track(kind string, handle interface{}) {
+	if r == nil {
+		return
+	}
+	stack := callers()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.serial++
+	r.live[handle] = Object{Kind: kind, Handle: handle, Stack: stack, serial: r.serial}
+}
+
+// Release records that handle has been destroyed. Handles that were never
+// tracked are ignored, so every destroy can release whether or not its
+// object was created somewhere that tracks.
+func (r *Registry) Release(handle interface{}) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.live, handle)
+}
+
+// Live returns the objects that haven't been released, oldest first.
+func (r *Registry) Live() []Object {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	objects := make([]Object, 0, len(r.live))
+	for _, o := range r.live {
+		objects = append(objects, o)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].serial < objects[j].serial })
+	return objects
+}
+
+// Err is an error counting the live objects of each kind, nil when there
+// aren't any.
+func (r *Registry) Err() error {
+	objects := r.Live()
+	if len(objects) == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for _, o := range objects {
+		counts[o.Kind]++
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind, n := range counts {
+		kinds = append(kinds, fmt.Sprintf("%d %s", n, kind))
+	}
+	sort.Strings(kinds)
+	return errors.Errorf("%d Vulkan objects weren't destroyed: %s", len(objects), strings.Join(kinds, ", "))
+}
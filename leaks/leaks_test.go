@@ -0,0 +1,61 @@
+package leaks
+
+import "testing"
+
+// handle stands in for a non-dispatchable Vulkan handle.
+type handle uint64
+
+func TestRegistryLive(t *testing.T) {
+	r := New()
+	r.Track("buffer", handle(1))
+	r.Track("pipeline", handle(2))
+	r.Track("buffer", handle(3))
+	r.Release(handle(1))
+	r.Release(handle(42))
+
+	live := r.Live()
+	if len(live) != 2 {
+		t.Fatalf("Live = %v, want 2 objects", live)
+	}
+	if live[0].Handle != handle(2) || live[0].Kind != "pipeline" {
+		t.Errorf("Live[0] = %v, want the pipeline", live[0])
+	}
+	if live[1].Handle != handle(3) || live[1].Kind != "buffer" {
+		t.Errorf("Live[1] = %v, want the second buffer", live[1])
+	}
+
+	want := "2 Vulkan objects weren't destroyed: 1 buffer, 1 pipeline"
+	if err := r.Err(); err == nil || err.Error() != want {
+		t.Errorf("Err = %v, want %q", err, want)
+	}
+
+	r.Release(handle(2))
+	r.Release(handle(3))
+	if err := r.Err(); err != nil {
+		t.Errorf("Err after releasing everything = %v", err)
+	}
+}
+
+func TestRegistryHandleTypes(t *testing.T) {
+	// Handles of different types with the same value are different objects
+	type other uint64
+	r := New()
+	r.Track("buffer", handle(1))
+	r.Track("image", other(1))
+	r.Release(handle(1))
+	if live := r.Live(); len(live) != 1 || live[0].Kind != "image" {
+		t.Errorf("Live = %v, want just the image", live)
+	}
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	r.Track("buffer", handle(1))
+	r.Release(handle(1))
+	if live := r.Live(); live != nil {
+		t.Errorf("Live = %v, want nil", live)
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("Err = %v, want nil", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !debug
+
+package leaks
+
+// callers is nothing without the debug tag, capturing a stack for every
+// object is too slow to leave on.
+func callers() string {
+	return ""
+}
@@ -0,0 +1,27 @@
+//go:build debug
+
+package leaks
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// callers is the stack of whatever called Track, a function and its line
+// for each frame.
+func callers() string {
+	pcs := make([]uintptr, 32)
+	// Skipping runtime.Callers, callers and Track
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
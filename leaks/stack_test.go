@@ -0,0 +1,20 @@
+//go:build debug
+
+package leaks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrackStack(t *testing.T) {
+	r := New()
+	r.Track("buffer", handle(1))
+	live := r.Live()
+	if len(live) != 1 {
+		t.Fatalf("Live = %v, want 1 object", live)
+	}
+	if !strings.HasPrefix(live[0].Stack, "github.com/delaneyj/learnvulkan/leaks.TestTrackStack\n") {
+		t.Errorf("Stack = %q, want it to start at the test", live[0].Stack)
+	}
+}
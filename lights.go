@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/delaneyj/learnvulkan/ecs"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/lights"
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/inkyblackness/imgui-go/v4"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// lightsBinding is the binding of the Lights block in set 0, declared
+	// by the forward fragment shaders.
+	lightsBinding = 3
+	// lightingLightsBinding is its binding in the lighting set, after the
+	// G-buffer's input attachments.
+	lightingLightsBinding = 4
+)
+
+// lightKindNames name the kinds of light in the lights window.
+var lightKindNames = map[scene.LightKind]string{
+	scene.PointLight:       "point",
+	scene.SpotLight:        "spot",
+	scene.DirectionalLight: "directional",
+}
+
+// createLightBuffers creates a Lights block per frame in flight.
+func (app *HelloTriangleApplication) createLightBuffers() error {
+	frames := app.framesInFlight()
+	app.lightBuffers = make([]*gpu.UniformBuffer[lights.Block], 0, frames)
+	for i := 0; i < frames; i++ {
+		b, err := gpu.NewUniformBuffer[lights.Block](app.gpuContext())
+		if err != nil {
+			return errors.Wrapf(err, "can't create light buffer for frame %d", i)
+		}
+		app.name(b.Handle, "lights %d", i)
+		app.lightBuffers = append(app.lightBuffers, b)
+	}
+	return nil
+}
+
+// lightsWrite points binding of set at frame's Lights block.
+func (app *HelloTriangleApplication) lightsWrite(frame int, set vk.DescriptorSet, binding uint32) vk.WriteDescriptorSet {
+	return vk.WriteDescriptorSet{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          set,
+		DstBinding:      binding,
+		DescriptorType:  vk.DescriptorTypeUniformBuffer,
+		DescriptorCount: 1,
+		PBufferInfo: []vk.DescriptorBufferInfo{{
+			Buffer: app.lightBuffers[frame].Handle,
+			Offset: 0,
+			Range:  app.lightBuffers[frame].Size,
+		}},
+	}
+}
+
+// frameLightsWrites points the frame sets at their Lights block when the
+// forward shaders declare it, the G-buffer shaders don't light anything.
+func (app *HelloTriangleApplication) frameLightsWrites(frame int, set vk.DescriptorSet) []vk.WriteDescriptorSet {
+	for _, b := range app.shaderBindings {
+		if b.Set == 0 && b.Binding == lightsBinding {
+			return []vk.WriteDescriptorSet{app.lightsWrite(frame, set, lightsBinding)}
+		}
+	}
+	return nil
+}
+
+// updateLights uploads the draw list's lights for frame.
+func (app *HelloTriangleApplication) updateLights(frame int) error {
+	return errors.Wrap(app.lightBuffers[frame].Write(lights.Pack(app.drawList.Lights)), "can't write lights")
+}
+
+func (app *HelloTriangleApplication) destroyLightBuffers() {
+	for _, b := range app.lightBuffers {
+		b.Destroy()
+	}
+	app.lightBuffers = nil
+}
+
+// addLight spawns a white light of kind above the objects, pointing down.
+func (app *HelloTriangleApplication) addLight(kind scene.LightKind) {
+	t := ecs.At(vmath.Vec3{0, 0, 2})
+	app.world.Spawn(t, ecs.Light{
+		Kind:      kind,
+		Color:     vmath.Vec3{1, 1, 1},
+		Intensity: 5,
+		Range:     10,
+		InnerCone: vmath.Radians(20),
+		OuterCone: vmath.Radians(30),
+	})
+}
+
+// lightsUI is the window for adding, moving and removing the scene's
+// dynamic lights, each an entity with a Light and a Transform.
+func (app *HelloTriangleApplication) lightsUI() {
+	imgui.Begin("Lights")
+	for _, kind := range []scene.LightKind{scene.PointLight, scene.SpotLight, scene.DirectionalLight} {
+		if kind != scene.PointLight {
+			imgui.SameLine()
+		}
+		if imgui.Button("Add " + lightKindNames[kind]) {
+			app.addLight(kind)
+		}
+	}
+
+	var count int
+	for _, e := range app.world.Entities() {
+		l, t := app.world.Light(e), app.world.Transform(e)
+		if l == nil || t == nil {
+			continue
+		}
+		count++
+		imgui.PushID(fmt.Sprint(e))
+		if imgui.CollapsingHeader(fmt.Sprintf("%s light %d###light", lightKindNames[l.Kind], e)) {
+			if l.Kind != scene.DirectionalLight {
+				imgui.DragFloat3("Position", (*[3]float32)(&t.Translation))
+			}
+			if l.Kind != scene.PointLight {
+				direction := lights.Direction(t.Rotation)
+				if imgui.SliderFloat3("Direction", (*[3]float32)(&direction), -1, 1) {
+					t.Rotation = lights.Aim(direction)
+				}
+			}
+			imgui.ColorEdit3("Color", (*[3]float32)(&l.Color))
+			imgui.SliderFloat("Intensity", &l.Intensity, 0, 50)
+			if l.Kind != scene.DirectionalLight {
+				imgui.SliderFloat("Range", &l.Range, 0, 50)
+			}
+			if l.Kind == scene.SpotLight {
+				inner, outer := vmath.Degrees(l.InnerCone), vmath.Degrees(l.OuterCone)
+				if imgui.SliderFloat("Inner cone", &inner, 0, 90) {
+					l.InnerCone = vmath.Radians(inner)
+				}
+				if imgui.SliderFloat("Outer cone", &outer, 0, 90) {
+					l.OuterCone = vmath.Radians(outer)
+				}
+			}
+			if imgui.Button("Remove") {
+				app.world.Destroy(e)
+			}
+		}
+		imgui.PopID()
+	}
+	if count > lights.MaxLights {
+		imgui.Text(fmt.Sprintf("Only the first %d lights are lit", lights.MaxLights))
+	}
+	imgui.End()
+}
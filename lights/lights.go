@@ -0,0 +1,85 @@
+// Package lights packs the scene's lights into the uniform block the
+// fragment shaders loop over, shaders/lights.glsl. Each light is placed by
+// its node's world transform, so lights move with whatever they're
+// attached to.
+package lights
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// MaxLights is how many lights the block has room for, MAX_LIGHTS in
+// lights.glsl. A light is 64 bytes so the block stays well inside the 16KB
+// every device allows a uniform buffer.
+const MaxLights = 64
+
+// Light matches the std140 Light struct in lights.glsl.
+type Light struct {
+	// Position is where the light is in world space, W its
+	// scene.LightKind.
+	Position vmath.Vec4
+	// Direction is the way a spot or directional light shines, W its
+	// range with zero unlimited.
+	Direction vmath.Vec4
+	// Color is the light's color scaled by its intensity.
+	Color vmath.Vec4
+	// Cone is the cosines of a spot light's inner and outer half angles.
+	Cone vmath.Vec4
+}
+
+// Block matches the std140 Lights block in lights.glsl, the first Count of
+// Lights are lit.
+type Block struct {
+	Count  uint32
+	_      [3]uint32
+	Lights [MaxLights]Light
+}
+
+// Pack lays out placed lights for the GPU, keeping the first MaxLights.
+func Pack(placed []scene.PlacedLight) Block {
+	var b Block
+	for _, p := range placed {
+		if b.Count == MaxLights {
+			break
+		}
+		l := p.Light
+		position := p.World.MulVec4(vmath.Vec4{0, 0, 0, 1}).Vec3()
+		direction := p.World.MulVec4(vmath.Vec4{0, 0, -1, 0}).Vec3().Normalize()
+		b.Lights[b.Count] = Light{
+			Position:  position.Vec4(float32(l.Kind)),
+			Direction: direction.Vec4(l.Range),
+			Color:     l.Color.Mul(l.Intensity).Vec4(0),
+			Cone:      vmath.Vec4{cos(l.InnerCone), cos(l.OuterCone), 0, 0},
+		}
+		b.Count++
+	}
+	return b
+}
+
+// Direction is the way a light with rotation shines, its -Z.
+func Direction(rotation vmath.Vec4) vmath.Vec3 {
+	return vmath.Quat(rotation).MulVec4(vmath.Vec4{0, 0, -1, 0}).Vec3()
+}
+
+// Aim is the rotation making a light shine along direction, the shortest
+// turn from -Z. A zero direction is no rotation.
+func Aim(direction vmath.Vec3) vmath.Vec4 {
+	d := direction.Normalize()
+	forward := vmath.Vec3{0, 0, -1}
+	dot := forward.Dot(d)
+	switch {
+	case d == (vmath.Vec3{}) || dot > 1-1e-6:
+		return vmath.Vec4{0, 0, 0, 1}
+	case dot < -1+1e-6:
+		// Straight back, any axis across -Z turns it around
+		return vmath.AxisAngle(math.Pi, vmath.Vec3{1, 0, 0})
+	}
+	return vmath.AxisAngle(float32(math.Acos(float64(dot))), forward.Cross(d))
+}
+
+func cos(angle float32) float32 {
+	return float32(math.Cos(float64(angle)))
+}
@@ -0,0 +1,97 @@
+package lights
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+func nearVec3(a, b vmath.Vec3) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBlockLayout(t *testing.T) {
+	// std140 puts the array of 16 byte aligned structs after the count's
+	// padding, each light 4 vec4s
+	if got, want := binary.Size(Block{}), 16+MaxLights*64; got != want {
+		t.Errorf("Block is %d bytes, want %d", got, want)
+	}
+}
+
+func TestPack(t *testing.T) {
+	spot := scene.New("spot")
+	spot.Local.Translation = vmath.Vec3{1, 2, 3}
+	spot.Local.Rotation = vmath.AxisAngle(vmath.Radians(90), vmath.Vec3{1, 0, 0})
+	spot.Update()
+
+	b := Pack([]scene.PlacedLight{{
+		Node: spot,
+		Light: scene.Light{
+			Kind:      scene.SpotLight,
+			Color:     vmath.Vec3{1, 0.5, 0},
+			Intensity: 4,
+			Range:     10,
+			InnerCone: vmath.Radians(20),
+			OuterCone: vmath.Radians(30),
+		},
+		World: spot.World(),
+	}})
+
+	if b.Count != 1 {
+		t.Fatalf("Count = %d, want 1", b.Count)
+	}
+	l := b.Lights[0]
+	if l.Position != (vmath.Vec4{1, 2, 3, float32(scene.SpotLight)}) {
+		t.Errorf("Position = %v", l.Position)
+	}
+	// Turning -Z a quarter turn around X points it along Y
+	if !nearVec3(l.Direction.Vec3(), vmath.Vec3{0, 1, 0}) || l.Direction[3] != 10 {
+		t.Errorf("Direction = %v, want 0 1 0 range 10", l.Direction)
+	}
+	if l.Color != (vmath.Vec4{4, 2, 0, 0}) {
+		t.Errorf("Color = %v, want the color times the intensity", l.Color)
+	}
+	if l.Cone[0] <= l.Cone[1] {
+		t.Errorf("Cone = %v, the inner cosine should be the larger", l.Cone)
+	}
+}
+
+func TestPackKeepsMaxLights(t *testing.T) {
+	placed := make([]scene.PlacedLight, MaxLights+5)
+	for i := range placed {
+		placed[i].World = vmath.Translate(vmath.Vec3{float32(i), 0, 0})
+	}
+	b := Pack(placed)
+	if b.Count != MaxLights {
+		t.Fatalf("Count = %d, want %d", b.Count, MaxLights)
+	}
+	if x := b.Lights[MaxLights-1].Position[0]; x != MaxLights-1 {
+		t.Errorf("last light is at x = %v, want the first MaxLights kept", x)
+	}
+}
+
+func TestAim(t *testing.T) {
+	for _, direction := range []vmath.Vec3{
+		{0, 0, -1},
+		{0, 0, 1},
+		{1, 0, 0},
+		{0, -1, -1},
+		{-0.4, -0.6, -1},
+	} {
+		want := direction.Normalize()
+		if got := Direction(Aim(direction)); !nearVec3(got, want) {
+			t.Errorf("Direction(Aim(%v)) = %v, want %v", direction, got, want)
+		}
+	}
+	if got := Aim(vmath.Vec3{}); got != (vmath.Vec4{0, 0, 0, 1}) {
+		t.Errorf("Aim(0) = %v, want no rotation", got)
+	}
+}
@@ -0,0 +1,3 @@
+// Package loader finds vkGetInstanceProcAddr in the system's Vulkan loader,
+// for when there's no GLFW to hand it over.
+package loader
@@ -0,0 +1,49 @@
+//go:build !windows
+
+package loader
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+func libraryNames() []string {
+	if runtime.GOOS == "darwin" {
+		return []string{"libvulkan.1.dylib", "libvulkan.dylib", "libMoltenVK.dylib"}
+	}
+	return []string{"libvulkan.so.1", "libvulkan.so"}
+}
+
+// GetInstanceProcAddr loads the Vulkan loader and returns its
+// vkGetInstanceProcAddr, ready for vk.SetGetInstanceProcAddr. The library
+// stays loaded for the life of the process.
+func GetInstanceProcAddr() (unsafe.Pointer, error) {
+	names := libraryNames()
+	for _, name := range names {
+		cName := C.CString(name)
+		lib := C.dlopen(cName, C.RTLD_NOW|C.RTLD_LOCAL)
+		C.free(unsafe.Pointer(cName))
+		if lib == nil {
+			continue
+		}
+
+		cSymbol := C.CString("vkGetInstanceProcAddr")
+		proc := C.dlsym(lib, cSymbol)
+		C.free(unsafe.Pointer(cSymbol))
+		if proc == nil {
+			C.dlclose(lib)
+			return nil, errors.Errorf("'%s' has no vkGetInstanceProcAddr", name)
+		}
+		return proc, nil
+	}
+	return nil, errors.Errorf("can't load a Vulkan loader, tried %v", names)
+}
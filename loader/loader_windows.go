@@ -0,0 +1,27 @@
+package loader
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// GetInstanceProcAddr loads the Vulkan loader and returns its
+// vkGetInstanceProcAddr, ready for vk.SetGetInstanceProcAddr. The library
+// stays loaded for the life of the process.
+func GetInstanceProcAddr() (unsafe.Pointer, error) {
+	dll, err := syscall.LoadDLL("vulkan-1.dll")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load vulkan-1.dll")
+	}
+	proc, err := dll.FindProc("vkGetInstanceProcAddr")
+	if err != nil {
+		dll.Release()
+		return nil, errors.Wrap(err, "vulkan-1.dll has no vkGetInstanceProcAddr")
+	}
+	// The address is of code in a DLL that's never unloaded, not Go memory,
+	// so it's safe to hold as a pointer
+	addr := proc.Addr()
+	return *(*unsafe.Pointer)(unsafe.Pointer(&addr)), nil
+}
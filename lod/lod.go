@@ -0,0 +1,128 @@
+// Package lod builds coarser levels of detail of a mesh by vertex
+// clustering and picks which level to draw an object at from how much of
+// the screen it covers.
+//
+// Clustering snaps every vertex in a cell of a grid over the mesh to the
+// one nearest the cell's average, then drops the triangles that collapse.
+// The levels only need new indices into the mesh's existing vertices, so
+// they share its vertex buffer.
+package lod
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// Cluster maps each of positions to the vertex standing in for its cell of
+// a grid cells wide along the mesh's longest side.
+func Cluster(positions [][3]float32, cells int) []uint32 {
+	remap := make([]uint32, len(positions))
+	if len(positions) == 0 || cells < 1 {
+		for i := range remap {
+			remap[i] = uint32(i)
+		}
+		return remap
+	}
+
+	lo, hi := positions[0], positions[0]
+	for _, p := range positions {
+		for i := range p {
+			lo[i] = float32(math.Min(float64(lo[i]), float64(p[i])))
+			hi[i] = float32(math.Max(float64(hi[i]), float64(p[i])))
+		}
+	}
+	var size float32
+	for i := range lo {
+		if d := hi[i] - lo[i]; d > size {
+			size = d
+		}
+	}
+	cell := size / float32(cells)
+	if cell == 0 {
+		cell = 1
+	}
+
+	type key [3]int
+	keyOf := func(p [3]float32) key {
+		var k key
+		for i := range p {
+			k[i] = int((p[i] - lo[i]) / cell)
+			if k[i] >= cells {
+				k[i] = cells - 1
+			}
+		}
+		return k
+	}
+	members := make(map[key][]int)
+	for i, p := range positions {
+		k := keyOf(p)
+		members[k] = append(members[k], i)
+	}
+	for _, vertices := range members {
+		var mean vmath.Vec3
+		for _, v := range vertices {
+			mean = mean.Add(vmath.Vec3(positions[v]))
+		}
+		mean = mean.Mul(1 / float32(len(vertices)))
+		best, bestDist := vertices[0], float32(math.Inf(1))
+		for _, v := range vertices {
+			d := vmath.Vec3(positions[v]).Sub(mean)
+			if dist := d.Dot(d); dist < bestDist {
+				best, bestDist = v, dist
+			}
+		}
+		for _, v := range vertices {
+			remap[v] = uint32(best)
+		}
+	}
+	return remap
+}
+
+// Remap is the triangles of indices with their vertices replaced by remap,
+// leaving out those that collapse to a line or point and repeats of the
+// same triangle facing the same way.
+func Remap(indices []uint32, remap []uint32) []uint32 {
+	out := make([]uint32, 0, len(indices))
+	seen := make(map[[3]uint32]bool)
+	for t := 0; t+2 < len(indices); t += 3 {
+		a, b, c := remap[indices[t]], remap[indices[t+1]], remap[indices[t+2]]
+		if a == b || b == c || c == a {
+			continue
+		}
+		// Rotated to start at the smallest index, keeping the winding
+		tri := [3]uint32{a, b, c}
+		for tri[0] > tri[1] || tri[0] > tri[2] {
+			tri = [3]uint32{tri[1], tri[2], tri[0]}
+		}
+		if seen[tri] {
+			continue
+		}
+		seen[tri] = true
+		out = append(out, a, b, c)
+	}
+	return out
+}
+
+// Coverage is how much of the screen's height a sphere of radius at centre
+// covers, seen from eye with a vertical field of view of fovY radians. It's
+// 1 or more when the sphere fills it, or when eye is inside the sphere.
+func Coverage(centre vmath.Vec3, radius float32, eye vmath.Vec3, fovY float32) float32 {
+	distance := centre.Sub(eye).Len()
+	if distance <= radius {
+		return float32(math.Inf(1))
+	}
+	return radius / (distance * float32(math.Tan(float64(fovY)/2)))
+}
+
+// Select is the level of levels to draw something covering coverage of the
+// screen at. Level 0 is drawn down to screenSize, each level after for
+// half as much as the last.
+func Select(coverage float32, levels int, screenSize float32) int {
+	level := 0
+	for level < levels-1 && coverage < screenSize {
+		level++
+		screenSize /= 2
+	}
+	return level
+}
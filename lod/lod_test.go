@@ -0,0 +1,109 @@
+package lod
+
+import (
+	"math"
+	"testing"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// grid is an n by n grid of quads in the XY plane, two triangles each.
+func grid(n int) ([][3]float32, []uint32) {
+	var positions [][3]float32
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			positions = append(positions, [3]float32{float32(x), float32(y), 0})
+		}
+	}
+	var indices []uint32
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			i := uint32(y*(n+1) + x)
+			indices = append(indices, i, i+1, i+uint32(n)+2, i, i+uint32(n)+2, i+uint32(n)+1)
+		}
+	}
+	return positions, indices
+}
+
+func TestClusterSimplifies(t *testing.T) {
+	positions, indices := grid(8)
+	remap := Cluster(positions, 4)
+	simplified := Remap(indices, remap)
+	if len(simplified) == 0 || len(simplified) >= len(indices) {
+		t.Fatalf("simplified to %d indices from %d, want fewer but some", len(simplified), len(indices))
+	}
+	// Every vertex stands in for itself or one that stands in for itself
+	for i, r := range remap {
+		if remap[r] != r {
+			t.Errorf("vertex %d maps to %d which maps to %d", i, r, remap[r])
+		}
+	}
+	// The simplified triangles still face +Z
+	for i := 0; i < len(simplified); i += 3 {
+		a, b, c := vmath.Vec3(positions[simplified[i]]), vmath.Vec3(positions[simplified[i+1]]), vmath.Vec3(positions[simplified[i+2]])
+		if n := b.Sub(a).Cross(c.Sub(a)); n[2] <= 0 {
+			t.Errorf("triangle %d faces %v", i/3, n)
+		}
+	}
+}
+
+func TestClusterKeepsFineMeshes(t *testing.T) {
+	positions, indices := grid(2)
+	// A cell per vertex and more leaves everything where it is
+	if got := Remap(indices, Cluster(positions, 64)); len(got) != len(indices) {
+		t.Errorf("fine grid kept %d of %d indices", len(got), len(indices))
+	}
+}
+
+func TestRemapDropsCollapsedAndRepeatedTriangles(t *testing.T) {
+	remap := []uint32{0, 1, 2, 2}
+	indices := []uint32{
+		0, 1, 2,
+		0, 1, 3, // the same as the first once 3 is 2
+		1, 2, 3, // collapses to a line
+		2, 0, 1, // the first rotated
+		0, 2, 1, // the first facing the other way
+	}
+	got := Remap(indices, remap)
+	want := []uint32{0, 1, 2, 0, 2, 1}
+	if len(got) != len(want) {
+		t.Fatalf("Remap = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Remap = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	fovY := vmath.Radians(90)
+	// tan(45°) is 1, a unit sphere 4 away covers a quarter
+	if got := Coverage(vmath.Vec3{4, 0, 0}, 1, vmath.Vec3{}, fovY); math.Abs(float64(got-0.25)) > 1e-5 {
+		t.Errorf("coverage = %v, want 0.25", got)
+	}
+	if got := Coverage(vmath.Vec3{}, 1, vmath.Vec3{0.5, 0, 0}, fovY); got < 1 {
+		t.Errorf("coverage from inside = %v, want at least 1", got)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		coverage float32
+		levels   int
+		want     int
+	}{
+		{1, 4, 0},
+		{0.5, 4, 0},
+		{0.4, 4, 1},
+		{0.2, 4, 2},
+		{0.1, 4, 3},
+		{0.001, 4, 3},
+		{0.001, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := Select(tt.coverage, tt.levels, 0.5); got != tt.want {
+			t.Errorf("Select(%v, %d) = %d, want %d", tt.coverage, tt.levels, got, tt.want)
+		}
+	}
+}
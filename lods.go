@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/culling"
+	"github.com/delaneyj/learnvulkan/lod"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/models"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+const (
+	defaultLODColorsKey = glfw.KeyF10
+	// lodScreenSize is how much of the screen's height an object covers
+	// when it stops being drawn at LOD 0, see lod.Select.
+	lodScreenSize = 0.5
+	// lodMinCells is the coarsest grid a generated LOD is clustered on.
+	lodMinCells = 2
+)
+
+// lodTints tint each LOD when LODColorsKey is on, the last for any after.
+var lodTints = []vmath.Vec4{
+	{1, 1, 1, 1},
+	{0.3, 1, 0.3, 1},
+	{0.3, 0.5, 1, 1},
+	{1, 1, 0.3, 1},
+	{1, 0.3, 0.3, 1},
+}
+
+func (app *HelloTriangleApplication) lodColorsKey() glfw.Key {
+	if app.LODColorsKey == 0 {
+		return defaultLODColorsKey
+	}
+	return app.LODColorsKey
+}
+
+// lodObjectsCount is the frame stats counter of the objects drawn at level
+// each frame.
+func lodObjectsCount(level int) string {
+	return fmt.Sprintf("LOD %d objects", level)
+}
+
+// createLODs appends the coarser levels of the mesh of vertices and indices
+// partitioned by groups, loaded from LODModels or else generated LODs
+// times. It returns the vertices and indices with theirs after, and each
+// level's groups in the same order as groups.
+func (app *HelloTriangleApplication) createLODs(vertices []Vertex, indices []uint32, groups []MeshGroup) ([]Vertex, []uint32, [][]MeshGroup, error) {
+	if len(app.LODModels) > 0 {
+		// The skin only has the model's own vertices
+		if !app.skinned() {
+			return app.loadLODs(vertices, indices, groups)
+		}
+		app.logger.Info("Ignoring LOD models", logging.F("reason", "the model is skinned"))
+	}
+	if app.LODs <= 0 {
+		return vertices, indices, nil, nil
+	}
+	indices, lods := generateLODs(vertices, indices, groups, app.LODs)
+	app.logger.Info("Generated LODs", logging.F("triangles", lodTriangles(groups, lods)))
+	return vertices, indices, lods, nil
+}
+
+// loadLODs appends the levels in LODModels, whose vertices are appended
+// too. Each needs a group for each of groups, drawn with its material.
+func (app *HelloTriangleApplication) loadLODs(vertices []Vertex, indices []uint32, groups []MeshGroup) ([]Vertex, []uint32, [][]MeshGroup, error) {
+	var lods [][]MeshGroup
+	for _, path := range app.LODModels {
+		lodVertices, lodIndices, lodGroups, err := loadLODModel(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(lodGroups) != len(groups) {
+			return nil, nil, nil, errors.Errorf("'%s' has %d material groups, the model has %d", path, len(lodGroups), len(groups))
+		}
+		base := uint32(len(vertices))
+		vertices = append(vertices, lodVertices...)
+		level := make([]MeshGroup, len(groups))
+		for i, g := range lodGroups {
+			level[i] = MeshGroup{First: uint32(len(indices)), Count: g.Count, Material: groups[i].Material}
+			for _, index := range lodIndices[g.First : g.First+g.Count] {
+				indices = append(indices, base+index)
+			}
+		}
+		lods = append(lods, level)
+	}
+	app.logger.Info("Loaded LODs",
+		logging.F("paths", app.LODModels),
+		logging.F("triangles", lodTriangles(groups, lods)),
+	)
+	return vertices, indices, lods, nil
+}
+
+// loadLODModel reads an authored LOD the way createMeshes reads the model,
+// leaving out its materials.
+func loadLODModel(path string) ([]Vertex, []uint32, []MeshGroup, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gltf", ".glb":
+		model, err := models.LoadGLTF(path)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "can't load LOD '%s'", path)
+		}
+		groups := make([]MeshGroup, len(model.Groups))
+		for i, g := range model.Groups {
+			groups[i] = MeshGroup{First: g.IndexOffset, Count: g.IndexCount}
+		}
+		vertices := modelVertices(model.Vertices)
+		yUpToZUp(vertices)
+		return vertices, model.Indices, groups, nil
+	default:
+		model, err := models.LoadOBJ(path)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "can't load LOD '%s'", path)
+		}
+		models.GenerateNormals(model.Vertices, model.Indices)
+		models.GenerateTangents(model.Vertices, model.Indices)
+		return modelVertices(model.Vertices), model.Indices, []MeshGroup{{Count: uint32(len(model.Indices))}}, nil
+	}
+}
+
+// generateLODs appends up to levels levels of indices simplified by
+// lod.Cluster, each on a grid half as wide as the last. It stops early once
+// a level doesn't lose any triangles.
+func generateLODs(vertices []Vertex, indices []uint32, groups []MeshGroup, levels int) ([]uint32, [][]MeshGroup) {
+	positions := make([][3]float32, len(vertices))
+	for i, v := range vertices {
+		positions[i] = v.Pos
+	}
+	// A surface on a grid n cells wide crosses around 6n² of them, so this
+	// is about a vertex per cell before halving it for the first level
+	cells := int(math.Sqrt(float64(len(vertices)) / 6))
+	count := len(indices)
+	var lods [][]MeshGroup
+	for len(lods) < levels {
+		cells /= 2
+		if cells < lodMinCells {
+			break
+		}
+		remap := lod.Cluster(positions, cells)
+		first := len(indices)
+		level := make([]MeshGroup, len(groups))
+		for i, g := range groups {
+			simplified := lod.Remap(indices[g.First:g.First+g.Count], remap)
+			level[i] = MeshGroup{First: uint32(len(indices)), Count: uint32(len(simplified)), Material: g.Material}
+			indices = append(indices, simplified...)
+		}
+		n := len(indices) - first
+		if n == 0 || n >= count {
+			indices = indices[:first]
+			break
+		}
+		count = n
+		lods = append(lods, level)
+	}
+	return indices, lods
+}
+
+// lodTriangles is the triangle count of the mesh at each level, for
+// logging.
+func lodTriangles(groups []MeshGroup, lods [][]MeshGroup) []uint32 {
+	counts := make([]uint32, 0, len(lods)+1)
+	for _, level := range append([][]MeshGroup{groups}, lods...) {
+		var n uint32
+		for _, g := range level {
+			n += g.Count / 3
+		}
+		counts = append(counts, n)
+	}
+	return counts
+}
+
+// selectLOD is the level an object with the world space box is drawn at
+// from the current window's camera.
+func (app *HelloTriangleApplication) selectLOD(box culling.AABB) int {
+	if len(app.mesh.LODs) == 0 || box.IsEmpty() {
+		return 0
+	}
+	centre := box.Min.Add(box.Max).Mul(0.5)
+	radius := box.Max.Sub(box.Min).Len() / 2
+	coverage := lod.Coverage(centre, radius, app.camera.Position, app.camera.FovY)
+	return lod.Select(coverage, len(app.mesh.LODs)+1, lodScreenSize)
+}
+
+// objectLOD is the level the draw list's object i is drawn at this frame.
+func (app *HelloTriangleApplication) objectLOD(i int) int {
+	if i >= len(app.lods) {
+		return 0
+	}
+	return app.lods[i]
+}
+
+// lodDrawConstants are the current window's DrawConstants tinted for level.
+func (app *HelloTriangleApplication) lodDrawConstants(level int) DrawConstants {
+	c := app.currentDrawConstants()
+	if level >= len(lodTints) {
+		level = len(lodTints) - 1
+	}
+	c.Tint = lodTints[level]
+	return c
+}
@@ -0,0 +1,120 @@
+// Package logging is the small structured logging interface the application
+// reports through, so its output can be routed into any logging pipeline.
+//
+// Adapting another logger only takes the four level methods, for example with
+// zerolog:
+//
+//	type zerologLogger struct{ l zerolog.Logger }
+//
+//	func (z zerologLogger) Info(msg string, fields ...logging.Field) {
+//		e := z.l.Info()
+//		for _, f := range fields {
+//			e = e.Interface(f.Key, f.Value)
+//		}
+//		e.Msg(msg)
+//	}
+//
+// with Debug, Warn and Error following the same pattern. Slog adapts a
+// log/slog logger on Go 1.21 and later.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// Field is a key/value pair attached to a log message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F makes a Field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger receives messages at four levels, it can be called from any thread.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+// Level is the severity of a message.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "UNKNOWN"
+}
+
+// Std is a Logger writing "LEVEL message key=value ..." lines to a
+// standard library logger.
+type Std struct {
+	// Logger is where lines are written, nil means the log package's
+	// standard logger.
+	Logger *log.Logger
+	// MinLevel drops messages less severe than it.
+	MinLevel Level
+}
+
+// Default returns a Std logger writing every level through the log package.
+func Default() Logger {
+	return &Std{}
+}
+
+// Discard returns a Logger that drops everything.
+func Discard() Logger {
+	return &Std{Logger: log.New(io.Discard, "", 0), MinLevel: LevelError + 1}
+}
+
+func (s *Std) Debug(msg string, fields ...Field) { s.output(LevelDebug, msg, fields) }
+func (s *Std) Info(msg string, fields ...Field)  { s.output(LevelInfo, msg, fields) }
+func (s *Std) Warn(msg string, fields ...Field)  { s.output(LevelWarn, msg, fields) }
+func (s *Std) Error(msg string, fields ...Field) { s.output(LevelError, msg, fields) }
+
+func (s *Std) output(level Level, msg string, fields []Field) {
+	if level < s.MinLevel {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=", f.Key)
+		if s, ok := f.Value.(string); ok && strings.ContainsAny(s, " \t\n\"=") {
+			fmt.Fprintf(&b, "%q", s)
+		} else {
+			fmt.Fprint(&b, f.Value)
+		}
+	}
+
+	l := s.Logger
+	if l == nil {
+		l = log.Default()
+	}
+	// Skip output and the level method so Lshortfile points at the caller
+	l.Output(3, b.String())
+}
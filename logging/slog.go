@@ -0,0 +1,33 @@
+//go:build go1.21
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Slog adapts a log/slog logger, nil meaning slog.Default().
+func Slog(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Debug(msg string, fields ...Field) { s.log(slog.LevelDebug, msg, fields) }
+func (s slogLogger) Info(msg string, fields ...Field)  { s.log(slog.LevelInfo, msg, fields) }
+func (s slogLogger) Warn(msg string, fields ...Field)  { s.log(slog.LevelWarn, msg, fields) }
+func (s slogLogger) Error(msg string, fields ...Field) { s.log(slog.LevelError, msg, fields) }
+
+func (s slogLogger) log(level slog.Level, msg string, fields []Field) {
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	s.l.LogAttrs(context.Background(), level, msg, attrs...)
+}
@@ -1,27 +1,62 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
+	"time"
 	"unsafe"
 
+	"github.com/delaneyj/learnvulkan/animation"
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/debugutils"
+	"github.com/delaneyj/learnvulkan/deletion"
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/ecs"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/interop"
+	"github.com/delaneyj/learnvulkan/leaks"
+	"github.com/delaneyj/learnvulkan/loader"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/meshshader"
+	"github.com/delaneyj/learnvulkan/models"
+	"github.com/delaneyj/learnvulkan/openxr"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/portability"
+	"github.com/delaneyj/learnvulkan/raytracing"
+	"github.com/delaneyj/learnvulkan/rendering"
+	"github.com/delaneyj/learnvulkan/renderpass"
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/sprite"
+	"github.com/delaneyj/learnvulkan/stats"
+	"github.com/delaneyj/learnvulkan/swapchain"
+	"github.com/delaneyj/learnvulkan/ui"
+	"github.com/delaneyj/learnvulkan/vmath"
 	"github.com/pkg/errors"
 	"github.com/vulkan-go/glfw/v3.3/glfw"
 	vk "github.com/vulkan-go/vulkan"
 )
 
 const (
-	width                  = 1280
-	height                 = 720
-	title                  = "Learn Vulkan"
-	enableValidationLayers = true
+	defaultMaxFramesInFlight = 2
 )
 
 var (
-	validationLayerNames = []string{
-		"VK_LAYER_LUNARG_standard_validation",
+	deviceExtensionNames = []string{
+		vk.KhrSwapchainExtensionName,
+	}
+	optionalDeviceExtensionNames = []string{
+		memory.BudgetExtension,
+		// Portability devices have to have it enabled
+		portability.SubsetExtension,
 	}
 )
 
@@ -32,173 +67,1244 @@ func init() {
 }
 
 func main() {
+	flag.Usage = usage
+	width := flag.Int("width", defaultWidth, "window width in screen coordinates")
+	height := flag.Int("height", defaultHeight, "window height in screen coordinates")
+	title := flag.String("title", defaultTitle, "window title")
+	var validation ValidationPolicy
+	flag.Var(&validation, "validation", "validation layers, "+validationPolicyNames()+": prefer runs without them when they aren't installed")
+	msaa := flag.Int("msaa", defaultMSAASamples, "multisample count of the color target, 1, 2, 4 or 8")
+	scene := flag.String("scene", defaultScene, "demo scene to run, one of "+sceneNames()+", the flags it turns on can be given too")
+	gpu := flag.String("gpu", os.Getenv(gpuEnv), "index or name substring of the GPU to use, overrides $"+gpuEnv)
+	listGPUsOnly := flag.Bool("list-gpus", false, "print the available GPUs and exit")
+	headless := flag.Bool("headless", false, "render offscreen without a window and save the last frame as a PNG")
+	computeExample := flag.Bool("compute-example", false, "run a compute shader over a million floats, check the results read back from the GPU and exit")
+	headlessOutput := flag.String("headless-output", defaultHeadlessOutput, "where --headless writes its frame")
+	headlessFrames := flag.Int("headless-frames", 1, "how many frames --headless renders before writing the last one")
+	recordDir := flag.String("record", "", "write frames and their timing to this directory for encoding into a video")
+	recordEvery := flag.Int("record-every", 1, "record every Nth frame")
+	recordFormat := flag.String("record-format", RecordPNG, "recorded frame format, "+RecordPNG+" or "+RecordRaw)
+	presentMode := flag.String("present-mode", "", "fifo, mailbox, immediate or fifo-relaxed, defaults to mailbox when available")
+	monitor := flag.String("monitor", "", "index or name substring of the monitor to go fullscreen on, defaults to the primary monitor")
+	fullscreen := flag.String("fullscreen", "", "start fullscreen in this WIDTHxHEIGHT[@REFRESH] video mode")
+	cameraController := flag.String("camera", CameraOrbit, "camera controller, "+CameraOrbit+" (drag to rotate, scroll to zoom) or "+CameraFPS+" (WASD and right drag to look)")
+	windowCount := flag.Int("windows", 1, "number of windows to open, they all render the scene from the same device")
+	statsInterval := flag.Duration("stats", 0, "log frame timing this often, e.g. 5s")
+	pipelineStats := flag.Bool("pipeline-stats", false, "count vertex and fragment shader invocations and clipped primitives per frame, reported by --stats")
+	instances := flag.Int("instances", 0, "draw the mesh this many times in a single instanced draw, each with its own transform")
+	objects := flag.Int("objects", 1, "draw this many copies of the mesh in a grid, each with its own slice of a dynamic uniform buffer")
+	recordThreads := flag.Int("threads", 1, "record each frame's draws on this many goroutines into secondary command buffers")
+	particles := flag.Int("particles", 0, "simulate this many particles in a compute shader, drawn as additive quads")
+	asyncCompute := flag.Bool("async-compute", false, "step particles on a dedicated compute queue while the previous frame renders, F6 switches it")
+	rayTracing := flag.Bool("ray-tracing", false, "prefer a GPU with ray tracing and draw a ray traced triangle and its shadow instead of the scene, F7 switches it")
+	meshShaders := flag.Bool("mesh-shaders", false, "draw the mesh as meshlets culled in a task shader when the GPU has mesh shaders, F8 switches back to the vertex pipeline")
+	occlusionCulling := flag.Bool("occlusion-culling", false, "skip objects that last frame's occlusion queries found hidden behind a depth pre-pass")
+	lods := flag.Int("lods", 0, "generate this many coarser levels of detail of the model, drawn as objects get smaller on screen, F10 colors them")
+	lodModels := flag.String("lod-models", "", "comma separated models to use as the model's coarser levels of detail instead of generating them")
+	renderPasses := flag.Bool("render-passes", false, "draw the scene with render pass and framebuffer objects even when the GPU has dynamic rendering")
+	stereo := flag.Bool("stereo", false, "draw the scene once per eye with multiview into a layered image, shown side by side in the primary window")
+	openXR := flag.Bool("openxr", false, "draw the stereo views to a headset through the OpenXR runtime, head tracked, mirrored in the primary window")
+	materialSets := flag.Bool("material-sets", false, "bind a descriptor set per material even when the GPU has descriptor indexing for a bindless texture table")
+	bloom := flag.Bool("bloom", false, "draw the scene in HDR, bloom what's brighter than 1 and tonemap it into the window")
+	deferred := flag.Bool("deferred", false, "light the scene in a fullscreen pass over a G-buffer instead of as it's drawn, without MSAA")
+	model := flag.String("model", "", "draw a Wavefront .obj or glTF .gltf/.glb model instead of the built in quad")
+	skybox := flag.String("skybox", "", "draw a sky from a directory of px, nx, py, ny, pz and nz images or an equirectangular .hdr")
+	hud := flag.Bool("hud", false, "show a debug overlay of frame times, the GPU, swapchain and memory use, F3 toggles it")
+	sprites := flag.Bool("sprites", false, "draw a ring of 2D sprites cut from the texture over the primary window with the sprite batch")
+	overlay := flag.Bool("overlay", false, "print frame stats and the latest validation messages over each window")
+	showUI := flag.Bool("ui", false, "draw a Dear ImGui window over the primary window for tweaking the scene")
+	profileGPU := flag.Bool("profile-gpu", false, "time the render pass on the GPU with timestamp queries, reported by --stats")
+	bench := flag.Int("bench", 0, "draw this many frames as fast as possible without vsync, then print their timing as JSON and exit")
+	failOnLeaks := flag.Bool("fail-on-leaks", false, "exit with an error when Vulkan objects are left alive at exit, build with -tags debug to log where they were created")
+	budgetWarning := flag.Float64("memory-budget-warning", defaultMemoryBudgetWarning, "warn when a memory heap's usage passes this fraction of its budget")
+	settingsPath := flag.String("config", defaultSettingsPath, "read settings from this .toml or .json file, flags override them")
+	flag.Parse()
+
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Printf("Starting %s", title)
-	defer log.Printf("Closing %s", title)
+	logger := logging.Default()
+
+	if *listGPUsOnly {
+		if err := listGPUs(os.Stdout); err != nil {
+			logger.Error("Can't list GPUs", logging.F("err", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	settingsGiven := false
+	flag.Visit(func(f *flag.Flag) { settingsGiven = settingsGiven || f.Name == "config" })
+	settings, err := loadSettings(*settingsPath, settingsGiven)
+	if err != nil {
+		logger.Error("Can't load settings", logging.F("err", err))
+		os.Exit(2)
+	}
+	if err := settings.applyFlags(flag.CommandLine); err != nil {
+		logger.Error("Bad settings", logging.F("path", *settingsPath), logging.F("err", err))
+		os.Exit(2)
+	}
+
+	config := AppConfig{
+		Width:   *width,
+		Height:  *height,
+		Title:   *title,
+		Monitor: *monitor,
+	}.withDefaults()
+	logger.Info("Starting", logging.F("title", config.Title), logging.F("scene", *scene))
+	defer logger.Info("Closing", logging.F("title", config.Title))
+
+	var fullscreenConfig FullscreenConfig
+	windowMode := Windowed
+	if *fullscreen != "" {
+		cfg, err := ParseFullscreenConfig(*fullscreen)
+		if err != nil {
+			logger.Error("Bad --fullscreen", logging.F("err", err))
+			os.Exit(2)
+		}
+		fullscreenConfig = cfg
+		windowMode = Fullscreen
+	}
 
-	app := HelloTriangleApplication{}
+	var extraWindows []AppConfig
+	for i := 2; i <= *windowCount; i++ {
+		extraWindows = append(extraWindows, AppConfig{
+			Title:   fmt.Sprintf("%s (%d)", config.Title, i),
+			Monitor: *monitor,
+		})
+	}
+
+	app := HelloTriangleApplication{
+		Config:              config,
+		Windows:             extraWindows,
+		Camera:              *cameraController,
+		Logger:              logger,
+		GPU:                 *gpu,
+		Headless:            *headless,
+		HeadlessOutput:      *headlessOutput,
+		HeadlessFrames:      *headlessFrames,
+		ComputeExample:      *computeExample,
+		RecordDir:           *recordDir,
+		RecordEvery:         *recordEvery,
+		RecordFormat:        *recordFormat,
+		PresentMode:         *presentMode,
+		WindowMode:          windowMode,
+		Fullscreen:          fullscreenConfig,
+		MaxFramesInFlight:   defaultMaxFramesInFlight,
+		MSAASamples:         *msaa,
+		MemoryBudgetWarning: *budgetWarning,
+		StatsInterval:       *statsInterval,
+		ProfileGPU:          *profileGPU,
+		Bench:               *bench,
+		FailOnLeaks:         *failOnLeaks,
+		PipelineStatistics:  *pipelineStats,
+		RecordThreads:       *recordThreads,
+		Objects:             *objects,
+		Instances:           *instances,
+		UI:                  *showUI,
+		HUD:                 *hud,
+		Overlay:             *overlay,
+		Sprites:             *sprites,
+		ModelPath:           *model,
+		Skybox:              *skybox,
+		Deferred:            *deferred,
+		Particles:           *particles,
+		AsyncCompute:        *asyncCompute,
+		RayTracing:          *rayTracing,
+		MeshShaders:         *meshShaders,
+		OcclusionCulling:    *occlusionCulling,
+		LODs:                *lods,
+		RenderPasses:        *renderPasses,
+		MaterialSets:        *materialSets,
+		Stereo:              *stereo,
+		OpenXR:              *openXR,
+		ShaderReloadDir:     "shaders",
+		Validation: ValidationConfig{
+			Policy:      validation,
+			MinSeverity: debugutils.SeverityWarning,
+		},
+	}
+	if *bloom {
+		app.Bloom = &defaultBloomConfig
+	}
+	if *lodModels != "" {
+		app.LODModels = strings.Split(*lodModels, ",")
+	}
 	if err := app.Run(); err != nil {
-		log.Fatal(errors.Wrapf(err, "can't run %s", title))
+		logger.Error("Can't run", logging.F("title", config.Title), logging.F("err", err))
+		os.Exit(1)
 	}
 
-	log.Printf("Ran %s successfully", title)
+	logger.Info("Ran successfully", logging.F("title", config.Title))
 }
 
 type HelloTriangleApplication struct {
-	window         *glfw.Window
-	instance       vk.Instance
-	debug          vk.DebugReportCallback
-	physicalDevice vk.PhysicalDevice
-	device         vk.Device
+	// Config is the window's size, title, decoration and placement.
+	Config AppConfig
+	// Windows opens more windows after the first, each with its own surface
+	// and swapchain but sharing the device. Closing one of them leaves the
+	// rest running, closing the first ends the application.
+	Windows []AppConfig
+	// NativeWindow draws into a window the embedder opened instead of
+	// opening one with GLFW. Only Config's title is used and Windows are
+	// ignored.
+	NativeWindow *NativeWindowConfig
+	// MaxFramesInFlight is how many frames the CPU may record ahead of the
+	// GPU, it falls back to defaultMaxFramesInFlight when not positive.
+	MaxFramesInFlight int
+	// TextureLOD overrides the texture sampler's level of detail range and
+	// bias, nil samples the whole mip chain unbiased.
+	TextureLOD *LODConfig
+	// MSAASamples is the multisample count of the color target, one of 1, 2, 4
+	// or 8, falling back to defaultMSAASamples when not positive. Picking more
+	// than the device supports is an error.
+	MSAASamples int
+	// ModelPath is a Wavefront .obj or glTF .gltf or .glb file to draw
+	// instead of the built in quad when set. glTF materials are drawn with
+	// their PBR textures, everything else with the default material.
+	ModelPath string
+	// Skybox is drawn behind the scene, either a directory of six square
+	// px, nx, py, ny, pz and nz images or an equirectangular .hdr panorama
+	// that's projected onto a cube map by a compute shader. Empty draws no
+	// sky.
+	Skybox string
+	// Deferred draws the scene into a G-buffer of albedo, normals and
+	// material data that a fullscreen pass then lights, instead of lighting
+	// fragments as they're drawn. Both shade the same so they can be
+	// compared. It's fixed at startup and turns MSAA off.
+	Deferred bool
+	// ShaderDir is where the compiled SPIR-V is read from when built with
+	// the shaderdisk tag instead of embedding it, empty looks next to the
+	// executable and then in ./shaders.
+	ShaderDir string
+	// ShaderReloadDir is a directory of GLSL sources that are recompiled and
+	// swapped into the pipeline when they change, disabled when empty.
+	ShaderReloadDir string
+	// Validation filters validation layer messages and decides which of them
+	// stop the application.
+	Validation ValidationConfig
+	// Logger receives everything the application reports, nil logs through
+	// the standard library's log package.
+	Logger logging.Logger
+	// GPU forces a physical device by enumeration index or by a substring of
+	// its name instead of picking the best scoring one.
+	GPU string
+	// DeviceScorer ranks the suitable physical devices, nil uses
+	// DefaultDeviceScorer.
+	DeviceScorer DeviceScorer
+	// Vulkan creates the instance and picks the physical device, nil goes
+	// through the loader. Tests give it a fake.
+	Vulkan Vulkan
+	// RequiredDeviceExtensions are needed on top of VK_KHR_swapchain when
+	// there's a window, devices without them are skipped.
+	RequiredDeviceExtensions []string
+	// OptionalDeviceExtensions are enabled when the chosen device has them.
+	OptionalDeviceExtensions []string
+	// Headless renders into an offscreen image and writes the last frame
+	// to HeadlessOutput instead of opening a window, for machines without a
+	// display. GLFW isn't touched.
+	Headless       bool
+	HeadlessOutput string
+	// HeadlessFrames is how many frames Headless renders, zero is one.
+	HeadlessFrames int
+	// ComputeExample runs saxpy.comp on the compute queue, then reduce.comp
+	// through the gpgpu package, and checks what they wrote instead of
+	// rendering, without a window.
+	ComputeExample bool
+	// ScreenshotKey saves the next frame as a PNG in ScreenshotDir, zero
+	// means F12.
+	ScreenshotKey glfw.Key
+	ScreenshotDir string
+	// RecordDir receives every RecordEvery'th frame as numbered RecordFormat
+	// files along with a metadata.json of their timing, disabled when empty.
+	RecordDir    string
+	RecordEvery  int
+	RecordFormat string
+	// PresentMode is fifo, mailbox, immediate or fifo-relaxed, empty prefers
+	// mailbox. FIFO is used when the surface doesn't support it.
+	// PresentModeKey cycles through the supported modes, zero means V.
+	PresentMode    string
+	PresentModeKey glfw.Key
+	// PolygonModeKey cycles each window between filled, wireframe and point
+	// rendering, zero means P. Devices without the fillModeNonSolid feature
+	// only fill.
+	PolygonModeKey glfw.Key
+	// GammaKey switches each window between an sRGB swapchain, which
+	// encodes the linear colors shaders write, and a UNORM one showing
+	// them unencoded, to see what wrong gamma looks like, zero means G.
+	GammaKey glfw.Key
+	// WindowMode is the window's initial mode, Alt+Enter cycles it.
+	WindowMode WindowMode
+	// Fullscreen picks the monitor's video mode in Fullscreen window mode.
+	Fullscreen FullscreenConfig
+	// Camera is the controller moving each window's camera, orbit or fps,
+	// empty meaning orbit.
+	Camera string
+	// OnContentScale is called when the window moves to a monitor with a
+	// different content scale, for resizing anything drawn at a fixed size.
+	OnContentScale func(ContentScale)
+	// MemoryBudgetWarning is the fraction of a memory heap's budget that
+	// once in use is warned about and passed to OnMemoryBudget, falling back
+	// to defaultMemoryBudgetWarning when not positive. Budgets are only
+	// known on devices with VK_EXT_memory_budget.
+	MemoryBudgetWarning float64
+	OnMemoryBudget      func(memory.HeapBudget)
+	// StatsInterval is how often each window's frame timing is logged and
+	// passed to OnFrameStats, along with the window's title. Zero disables
+	// it, FrameStats can still be polled.
+	StatsInterval time.Duration
+	OnFrameStats  func(window string, s stats.Summary)
+	// ProfileGPU times scopes of each frame's commands on the GPU, like the
+	// render pass, adding them to the frame stats.
+	ProfileGPU bool
+	// Bench draws Bench frames as fast as possible, with vsync off and the
+	// GPU profiled, then writes a BenchReport as JSON to BenchOutput, stdout
+	// when nil, and returns.
+	Bench       int
+	BenchOutput io.Writer
+	// FailOnLeaks makes Run return an error when Vulkan objects are left
+	// alive once everything has been torn down, rather than only logging
+	// them. Building with the debug tag logs where each was created.
+	FailOnLeaks bool
+	// PipelineStatistics counts each frame's vertex and fragment shader
+	// invocations and clipped primitives, adding them to the frame stats.
+	// It's ignored on devices without the pipelineStatisticsQuery feature.
+	PipelineStatistics bool
+	// RecordThreads splits each frame's draws between this many goroutines,
+	// each recording a secondary command buffer with its own command pool
+	// that the frame's primary buffer executes. One or less records inline.
+	RecordThreads int
+	// Objects is how many copies of the mesh are drawn in a grid. Each has
+	// its own model matrix in one dynamic uniform buffer, bound at its
+	// offset, so they all share a descriptor set. One or less draws one.
+	Objects int
+	// Instances draws the mesh this many times in one draw with
+	// instanced.vert, each instance's transform coming from a per instance
+	// vertex buffer. Zero draws the mesh once with shader.vert.
+	Instances int
+	// UI draws Dear ImGui windows over the primary window, built by OnUI
+	// every frame or, when it's nil, a window for tweaking the scene. Mouse
+	// and keyboard input ImGui takes doesn't reach the camera or hotkeys.
+	UI   bool
+	OnUI func()
+	// HUD overlays frame times, the GPU, the swapchain's format and present
+	// mode and memory use on the primary window through the UI. HUDKey hides
+	// and shows it, zero means F3.
+	HUD    bool
+	HUDKey glfw.Key
+	// Overlay prints each window's frame stats and the latest validation
+	// messages over it in the text module's SDF font, without the UI.
+	Overlay bool
+	// Sprites draws 2D sprites over the primary window with a sprite.Batch
+	// in the window's pixels. OnSpritesLoad creates the batch's textures
+	// once it exists, OnSprites draws each frame's sprites between Begin
+	// and End given the time since the start. Without OnSprites a ring of
+	// cells cut from the texture spins in the middle of the window.
+	Sprites       bool
+	OnSpritesLoad func(b *sprite.Batch) error
+	OnSprites     func(b *sprite.Batch, elapsed time.Duration)
+	// LightDirection is the way the directional light shining on the scene
+	// points, zero means down and across. The scene is drawn into a shadow
+	// map from it every frame, offset by ShadowBias, nil meaning
+	// defaultShadowBias. The scene UI tunes the bias.
+	LightDirection vmath.Vec3
+	ShadowBias     *ShadowBias
+	// Bloom draws the scene into an HDR image, blurs what's brighter than
+	// its threshold through a chain of smaller images and adds that back
+	// before tonemapping into the target. nil draws straight into the
+	// target.
+	Bloom *BloomConfig
+	// Particles is how many particles a compute shader simulates, drawn as
+	// a fountain of additive quads after the scene. Zero draws none.
+	Particles int
+	// AsyncCompute steps the particles on a dedicated compute queue,
+	// overlapping the previous frame's rendering, when there's a compute
+	// family without graphics and a single window. AsyncComputeKey switches
+	// it on and off to compare frame times, zero means F6.
+	AsyncCompute    bool
+	AsyncComputeKey glfw.Key
+	// RayTracing draws a triangle over a floor, ray traced with its shadow
+	// through VK_KHR_ray_tracing_pipeline, over the primary window instead
+	// of the rasterized scene. Devices that can ray trace are preferred over
+	// any that can't, without one the scene is rasterized as usual.
+	// RayTracingKey switches between the two, zero means F7.
+	RayTracing    bool
+	RayTracingKey glfw.Key
+	// MeshShaders draws the mesh through VK_EXT_mesh_shader, split into
+	// meshlets at load that a task shader culls against the view, when the
+	// device has mesh shaders and the mesh isn't instanced. MeshShaderKey
+	// switches between it and the vertex pipeline, zero means F8.
+	MeshShaders   bool
+	MeshShaderKey glfw.Key
+	// FreezeFrustumKey stops the window's objects being culled against its
+	// camera's frustum as it moves, keeping the one it had, so flying out
+	// of it shows what's culled. Pressing it again follows the camera
+	// again, zero means F9.
+	FreezeFrustumKey glfw.Key
+	// OcclusionCulling skips objects hidden behind others. What's drawn is
+	// drawn into the depth buffer first, then every object's bounding box
+	// is tested against it with an occlusion query, whose result decides
+	// whether it's drawn when the frame comes round again. It's ignored
+	// when recording on multiple threads.
+	OcclusionCulling bool
+	// LODs is how many coarser levels of detail are generated for the
+	// model by clustering its vertices, LODModels authored ones to use
+	// instead, coarsest last. Each object is drawn at a level picked by
+	// how much of the screen its bounding box covers. LODColorsKey tints
+	// objects by their level, zero means F10.
+	LODs         int
+	LODModels    []string
+	LODColorsKey glfw.Key
+	// RenderPasses draws the scene with render pass and framebuffer objects
+	// even when the device has dynamic rendering, which is otherwise used
+	// for it. Deferred always uses render passes for its subpasses.
+	RenderPasses bool
+	// MaterialSets binds a descriptor set per material even when the device
+	// has VK_EXT_descriptor_indexing, which otherwise binds every material's
+	// textures as one table that draws index with a pushed material index.
+	MaterialSets bool
+	// Stereo draws the scene over the primary window once per eye in a
+	// single pass with multiview, into a 2D array image that's shown side
+	// by side, the groundwork for VR and split screen. It needs the device's
+	// multiview feature and isn't drawn deferred or instanced.
+	// StereoSeparation is the distance between the eyes, zero means
+	// defaultStereoSeparation.
+	Stereo           bool
+	StereoSeparation float32
+	// OpenXR draws the stereo views to a headset when there's an OpenXR
+	// runtime, with the eyes where the headset is relative to the camera.
+	// The device is the one the headset is plugged into and the primary
+	// window mirrors the eyes. It implies Stereo.
+	OpenXR bool
+	// Export shares the primary window's frames with another API when the
+	// device can export memory and semaphores, see export.go.
+	Export *ExportConfig
+	// ExternalParticles has another API, like a CUDA kernel, produce the
+	// particles into a shared buffer every frame instead of simulating them,
+	// when the device can export memory and timeline semaphores. They're
+	// only drawn in the primary window. See externalparticles.go.
+	ExternalParticles *ExternalParticlesConfig
+
+	logger              logging.Logger
+	getInstanceProcAddr unsafe.Pointer
+	instance            vk.Instance
+	debugMessenger      *debugutils.Messenger
+	validationFailure   validationFailure
+	namer               *debugutils.Namer
+	physicalDevice      vk.PhysicalDevice
+	queueFamilies       QueueFamilies
+	device              vk.Device
+	graphicsQueue       vk.Queue
+	presentQueue        vk.Queue
+	computeQueue        vk.Queue
+	transferQueue       vk.Queue
+	deviceExtensions    map[string]bool
+	allocator           *memory.Allocator
+	lastBudgetCheck     time.Time
+	overBudget          map[int]bool
+	lastStatsReport     time.Time
+	msaaSamples         vk.SampleCountFlagBits
+	depthFormat         vk.Format
+	// apiVersion is the Vulkan version the instance was created for, see
+	// instanceAPIVersion.
+	apiVersion uint32
+	// pipelineStatistics is whether pipelineStatisticsQuery was enabled.
+	pipelineStatistics bool
+	// fillModeNonSolid is whether fillModeNonSolid was enabled, allowing
+	// the line and point pipeline variants.
+	fillModeNonSolid bool
+	// portability is what the device leaves out of Vulkan when it's a
+	// portability device like MoltenVK, nil otherwise.
+	portability *portability.Features
+	// validationLayers are the layers the instance was created with, empty
+	// without validation.
+	validationLayers []string
+	// deletions are resources waiting for the submissions that might use
+	// them to finish, numbered by submissions. fenceSubmissions is the
+	// number of the submission each frame fence is waiting on.
+	deletions        deletion.Queue
+	submissions      deletion.Submissions
+	fenceSubmissions map[vk.Fence]uint64
+	// leaks are the Vulkan objects created and not yet destroyed.
+	leaks *leaks.Registry
+	// world is the demo scene's entities, ticked every frame. sceneRoot
+	// is them as a scene graph, each window flattening it into its
+	// drawList every frame.
+	world     *ecs.World
+	sceneRoot *scene.Node
+
+	descriptorSetLayout vk.DescriptorSetLayout
+	shaderBindings      []pipeline.StageBinding
+	startTime           time.Time
+	// tint multiplies every fragment's color, the scene UI edits it.
+	tint vmath.Vec4
+	// shadowBias is ShadowBias or its default, the scene UI edits it.
+	shadowBias    ShadowBias
+	shadowSampler vk.Sampler
+
+	textureImage   *gpu.Image
+	textureSampler vk.Sampler
+
+	materialSetLayout vk.DescriptorSetLayout
+	// materials are indexed by MeshGroup.Material, 0 is the default one.
+	// Their textures, shared between them, are in materialTextures.
+	materials         []*Material
+	materialTextures  []*gpu.Image
+	whiteTexture      *gpu.Image
+	flatNormalTexture *gpu.Image
+
+	skyboxImage          *gpu.Image
+	skyboxSampler        vk.Sampler
+	skyboxSetLayout      vk.DescriptorSetLayout
+	skyboxPipelineLayout vk.PipelineLayout
+
+	lightingSetLayout      vk.DescriptorSetLayout
+	lightingBindings       []pipeline.StageBinding
+	lightingPipelineLayout vk.PipelineLayout
+
+	// bloom is Bloom's settings, the scene UI edits them.
+	bloom                   BloomConfig
+	bloomSampler            vk.Sampler
+	bloomSetLayout          vk.DescriptorSetLayout
+	bloomBindings           []pipeline.StageBinding
+	bloomPipelineLayout     vk.PipelineLayout
+	bloomPipeline           vk.Pipeline
+	compositeSetLayout      vk.DescriptorSetLayout
+	compositeBindings       []pipeline.StageBinding
+	compositePipelineLayout vk.PipelineLayout
+
+	// particleBuffers are what the particle simulation steps between,
+	// particleCurrent is the one last written and drawn.
+	particleBuffers        [2]*gpu.Buffer
+	particleCurrent        int
+	particleTime           time.Time
+	particleSetLayout      vk.DescriptorSetLayout
+	particleBindings       []pipeline.StageBinding
+	particleComputeLayout  vk.PipelineLayout
+	particleCompute        vk.Pipeline
+	particlePipelineLayout vk.PipelineLayout
+	// asyncCompute is whether particles are being stepped on the compute
+	// queue, the rest is what that takes, see createAsyncCompute.
+	asyncCompute           bool
+	asyncComputeToggled    bool
+	particleComputePool    *commands.Pool
+	particleComputeBuffers []vk.CommandBuffer
+	particleStepped        []vk.Semaphore
+	particleReleased       [2]vk.Semaphore
+	particleReleasePending [2]bool
+
+	// rayTracing is whether the device was created able to ray trace,
+	// rayTraced whether the primary window is drawn ray traced. The rest
+	// is the sample's scene and pipeline, see createRayTracing.
+	rayTracing            bool
+	rayTraced             bool
+	rayTracingToggled     bool
+	rayTracer             *raytracing.Device
+	rayTracingProps       raytracing.Properties
+	rayTracedVertices     *gpu.Buffer
+	rayTracedIndices      *gpu.Buffer
+	rayTracedSample       *raytracing.AccelerationStructure
+	rayTracedMesh         *raytracing.AccelerationStructure
+	tlas                  *raytracing.TopLevelStructure
+	rayTracingSetLayout   vk.DescriptorSetLayout
+	rayTracingLayout      vk.PipelineLayout
+	rayTracingPipeline    vk.Pipeline
+	rayTracingSBT         *raytracing.ShaderBindingTable
+	rayTracingDescriptors *descriptors.Allocator
+	rayTracingSet         vk.DescriptorSet
+	// meshShading is whether the device was created able to mesh shade,
+	// meshShaded whether the mesh is drawn with the meshlet pipeline. The
+	// buffers hold the mesh's meshlets, see createMeshlets.
+	meshShading       bool
+	meshShaded        bool
+	meshShaderToggled bool
+	meshShader        *meshshader.Device
+	meshlets          *gpu.Buffer
+	meshletVertices   *gpu.Buffer
+	meshletTriangles  *gpu.Buffer
+	meshletSetLayout  vk.DescriptorSetLayout
+	// dynamicRendering is whether the scene is drawn between
+	// vkCmdBeginRendering and vkCmdEndRendering instead of in renderPass,
+	// coreRendering whether they're Vulkan 1.3's rather than
+	// VK_KHR_dynamic_rendering's. See dynamicrendering.go.
+	dynamicRendering bool
+	coreRendering    bool
+	dynamicRenderer  *rendering.Device
+	// bindless is whether materials are read from a texture table instead
+	// of a set each, see bindless.go. bindlessTextures are the table's
+	// textures in order, bindlessMaterials every material indexing them.
+	bindless          bool
+	bindlessTextures  []*gpu.Image
+	bindlessMaterials *gpu.Buffer
+	// stereo is whether the primary window is drawn in stereo, see
+	// stereo.go.
+	stereo bool
+	// xrInstance and xrSession are set when drawing to a headset, see
+	// xr.go. xrFrame is the headset frame begun for this desktop frame,
+	// xrImages the swapchain images acquired for it and xrRendered whether
+	// they were drawn.
+	xrInstance           *openxr.Instance
+	xrInstanceExtensions []string
+	xrDeviceExtensions   []string
+	xrSession            *openxr.Session
+	xrSwapchains         [openxr.ViewCount]*openxr.Swapchain
+	xrFrame              *openxr.Frame
+	xrImages             [openxr.ViewCount]uint32
+	xrRendered           bool
+	// exporting is whether the device can export the primary window's
+	// frames, exporter its entry points. exportRecorded is whether this
+	// frame copied into exportImage, exportPending whether a copy has been
+	// handed to the importer that it has to release.
+	exporting      bool
+	exporter       *interop.Device
+	exportImage    *interop.Image
+	exportReady    vk.Semaphore
+	exportReleased vk.Semaphore
+	exportRecorded bool
+	exportPending  bool
+	// externalParticles is whether the particles are produced outside into
+	// particleSource, taking turns with the draws on particleTimeline.
+	// particleFrame counts the frames that drew them.
+	externalParticles bool
+	particleSource    *interop.Buffer
+	particleTimeline  vk.Semaphore
+	particleFrame     uint64
+
+	shaderWatcher   *shaders.Watcher
+	reloadedShaders map[string][]byte
+	commandPool     *commands.Pool
+	// transferCommandPool is for the uploader's copies on the dedicated
+	// transfer queue, nil without one.
+	transferCommandPool *commands.Pool
+	uploader            *gpu.Uploader
+	mesh                *Mesh
+	uiPlatform          *ui.Platform
+	hudVisible          bool
+	// gpuName is the physical device's name, looked up for the HUD.
+	gpuName string
+	// debugMessages are the latest validation messages, for the overlay.
+	debugMessages messageLog
+	// gltfModel is a glTF model loaded ahead of mesh, until mesh is
+	// created from it.
+	gltfModel *models.Model
+	// animator plays clips on the model's skeleton when it's skinned or
+	// morphed, see skinning.go. jointMatrices and morphWeights are its
+	// pose, each node's weights from its morphOffsets. skinVertices are
+	// the joints and weights of each of mesh's vertices, morphVertices
+	// where they find their morphDeltas.
+	animator      *animation.Player
+	clips         []*animation.Clip
+	jointMatrices []vmath.Mat4
+	morphWeights  []float32
+	morphOffsets  []int
+	skinVertices  *gpu.Buffer
+	morphVertices *gpu.Buffer
+	morphDeltas   *gpu.Buffer
+
+	// windows are the open windows, the primary one first. The current one
+	// is embedded so rendering code reads app.swapchain and friends for
+	// whichever window it's working on, see forEachWindow.
+	windows []*appWindow
+	*appWindow
 }
 
-func (app *HelloTriangleApplication) Run() error {
-	defer app.cleanup()
+func (app *HelloTriangleApplication) Run() (err error) {
+	app.windows = []*appWindow{{config: app.Config.withDefaults()}}
+	app.appWindow = app.windows[0]
+	app.tint = vmath.Vec4{1, 1, 1, 1}
+	app.shadowBias = defaultShadowBias
+	if app.ShadowBias != nil {
+		app.shadowBias = *app.ShadowBias
+	}
+	app.hudVisible = app.HUD
+	app.buildScene()
+	app.logger = app.Logger
+	if app.logger == nil {
+		app.logger = logging.Default()
+	}
+	app.prepareBench()
+	app.leaks = leaks.New()
+	defer func() {
+		app.cleanup()
+		if leaked := app.leaks.Err(); leaked != nil && app.FailOnLeaks && err == nil {
+			err = leaked
+		}
+	}()
+
+	if err := shaders.Load(app.ShaderDir); err != nil {
+		return errors.Wrap(err, "can't load shaders")
+	}
 
-	if err := app.initWindow(); err != nil {
-		return errors.Wrap(err, "can't init window")
+	// The compute example doesn't draw anything
+	if app.ComputeExample {
+		app.Headless = true
+	}
+	if !app.Headless {
+		if err := app.initWindow(); err != nil {
+			return errors.Wrap(err, "can't init window")
+		}
 	}
 	if err := app.initVulkan(); err != nil {
 		return errors.Wrap(err, "can't init vulkan")
 	}
+	if !app.Headless {
+		if err := app.openExtraWindows(); err != nil {
+			return errors.Wrap(err, "can't open extra windows")
+		}
+	}
+	if err := app.validationError(); err != nil {
+		return errors.Wrap(err, "validation failed during init")
+	}
+	app.logMemoryBudget()
+
+	if app.ComputeExample {
+		if err := app.runComputeExample(); err != nil {
+			return errors.Wrap(err, "can't run compute example")
+		}
+		if err := app.runGPGPUExample(); err != nil {
+			return errors.Wrap(err, "can't run GPGPU example")
+		}
+		if err := app.validationError(); err != nil {
+			return errors.Wrap(err, "validation failed")
+		}
+		return nil
+	}
+
+	if app.Headless {
+		if err := app.renderHeadless(); err != nil {
+			return errors.Wrap(err, "can't render headless")
+		}
+		if err := app.validationError(); err != nil {
+			return errors.Wrap(err, "validation failed")
+		}
+		return nil
+	}
 
 	if err := app.mainLoop(); err != nil {
 		return errors.Wrap(err, "can't init vulkan")
 	}
 
+	if app.Bench > 0 {
+		return app.writeBenchReport()
+	}
 	return nil
 }
 
 func (app *HelloTriangleApplication) initWindow() error {
+	if app.NativeWindow != nil {
+		return app.initNativeWindow()
+	}
 	if err := glfw.Init(); err != nil {
 		return errors.Wrap(err, "can't init GLFW")
 	}
 
-	glfw.WindowHint(glfw.ClientAPI, glfw.NoAPI)
-	glfw.WindowHint(glfw.Resizable, glfw.False)
+	if err := app.openWindow(); err != nil {
+		return err
+	}
+	if err := app.setWindowMode(app.WindowMode); err != nil {
+		return errors.Wrapf(err, "can't enter %s window mode", app.WindowMode)
+	}
+	return nil
+}
 
-	window, err := glfw.CreateWindow(width, height, title, nil, nil)
+// openWindow opens the current window's GLFW window.
+func (app *HelloTriangleApplication) openWindow() error {
+	if err := app.selectMonitor(); err != nil {
+		return errors.Wrap(err, "can't select monitor")
+	}
+
+	cfg := app.config
+	glfw.WindowHint(glfw.ClientAPI, glfw.NoAPI)
+	// The size is in screen coordinates, scaling it keeps the window the same
+	// physical size on HiDPI displays. macOS already does this for Retina.
+	glfw.WindowHint(glfw.ScaleToMonitor, glfw.True)
+	glfw.WindowHint(glfw.Resizable, glfwBool(!cfg.FixedSize))
+	glfw.WindowHint(glfw.Decorated, glfwBool(!cfg.Undecorated))
+	// Hidden until it's been moved into place so it doesn't flash up elsewhere
+	glfw.WindowHint(glfw.Visible, glfw.False)
+
+	window, err := glfw.CreateWindow(cfg.Width, cfg.Height, cfg.Title, nil, nil)
 	if err != nil {
 		return errors.Wrap(err, "can't create GLFW window")
 	}
 	app.window = window
+	if len(cfg.Icon) > 0 {
+		window.SetIcon(cfg.Icon)
+	}
+	app.placeWindow()
+	window.Show()
+
+	// Callbacks run from PollEvents when any window might be current
+	win := app.appWindow
+
+	// Drivers aren't guaranteed to report VK_ERROR_OUT_OF_DATE_KHR on resize
+	window.SetFramebufferSizeCallback(func(w *glfw.Window, width, height int) {
+		win.framebufferResized = true
+	})
+	app.trackContentScale()
+	window.SetKeyCallback(func(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+		if win.uiRenderer != nil {
+			app.uiPlatform.Key(key, action)
+		}
+		if action != glfw.Press || app.uiWantsKeyboard(win) {
+			return
+		}
+		switch {
+		case key == glfw.KeyEnter && mods&glfw.ModAlt != 0:
+			win.windowModeToggled = true
+		case key == app.screenshotKey():
+			win.screenshotRequested = true
+		case key == app.presentModeKey():
+			win.presentModeToggled = true
+		case key == app.polygonModeKey():
+			win.polygonModeToggled = true
+		case key == app.gammaKey():
+			win.gammaToggled = true
+		case key == app.hudKey():
+			app.hudVisible = !app.hudVisible
+		case key == app.asyncComputeKey():
+			app.asyncComputeToggled = true
+		case key == app.rayTracingKey():
+			app.rayTracingToggled = true
+		case key == app.meshShaderKey():
+			app.meshShaderToggled = true
+		case key == app.freezeFrustumKey():
+			win.freezeFrustum = !win.freezeFrustum
+		case key == app.lodColorsKey():
+			win.lodColors = !win.lodColors
+		}
+	})
+	window.SetCharCallback(func(w *glfw.Window, char rune) {
+		if win.uiRenderer != nil {
+			app.uiPlatform.Char(char)
+		}
+	})
 	return nil
 }
 
 func (app *HelloTriangleApplication) initVulkan() error {
-	procAddr := glfw.GetVulkanGetInstanceProcAddress()
-	if procAddr == nil {
-		return errors.New("GLFW instanceProcAddress is nil")
+	var procAddr unsafe.Pointer
+	if app.Headless || app.NativeWindow != nil {
+		p, err := loader.GetInstanceProcAddr()
+		if err != nil {
+			return errors.Wrap(err, "can't find vkGetInstanceProcAddr")
+		}
+		procAddr = p
+	} else {
+		procAddr = glfw.GetVulkanGetInstanceProcAddress()
+		if procAddr == nil {
+			return errors.New("GLFW instanceProcAddress is nil")
+		}
 	}
 	vk.SetGetInstanceProcAddr(procAddr)
+	app.getInstanceProcAddr = procAddr
 
 	if err := vk.Init(); err != nil {
 		return errors.Wrap(err, "can't vk.init()")
 	}
 
+	app.createXRInstance()
+
 	if err := app.createInstance(); err != nil {
 		return errors.Wrap(err, "can't create vk instance")
 	}
 
-	if err := app.setupDebugCallback(); err != nil {
-		return errors.Wrap(err, "can't create vk instance")
+	if err := app.setupDebugMessenger(); err != nil {
+		return errors.Wrap(err, "can't set up debug messenger")
 	}
 
-	graphicsQueueFamilyIndex, err := app.pickPhysicalDevice()
-	if err != nil {
+	if err := app.createSurface(); err != nil {
+		return errors.Wrap(err, "can't create window surface")
+	}
+
+	if err := app.pickPhysicalDevice(); err != nil {
 		return errors.Wrap(err, "can't pick physical device")
 	}
 
-	if err := app.createLogicalDevice(graphicsQueueFamilyIndex); err != nil {
+	if err := app.choosePresentModes(); err != nil {
+		return errors.Wrap(err, "can't choose present mode")
+	}
+
+	if err := app.chooseSampleCount(); err != nil {
+		return errors.Wrap(err, "can't choose MSAA sample count")
+	}
+
+	if err := app.chooseDepthFormat(); err != nil {
+		return errors.Wrap(err, "can't choose depth format")
+	}
+
+	if err := app.createLogicalDevice(); err != nil {
 		return errors.Wrap(err, "can't create logical device")
 	}
 
+	if err := app.createNamer(); err != nil {
+		return errors.Wrap(err, "can't set up object naming")
+	}
+
+	if err := app.createXRSession(); err != nil {
+		return errors.Wrap(err, "can't create OpenXR session")
+	}
+
+	if err := app.loadDynamicRendering(); err != nil {
+		return errors.Wrap(err, "can't load dynamic rendering")
+	}
+
+	if err := app.loadInterop(); err != nil {
+		return errors.Wrap(err, "can't load interop")
+	}
+	app.reportStereo()
+
+	app.allocator = memory.New(app.physicalDevice, app.device, 0)
+	if app.rayTracing {
+		app.allocator.EnableDeviceAddresses()
+	}
+
+	if err := app.loadModel(); err != nil {
+		return errors.Wrap(err, "can't load model")
+	}
+
+	if err := app.createDescriptorSetLayout(); err != nil {
+		return errors.Wrap(err, "can't create descriptor set layout")
+	}
+
+	if err := app.createCommandPool(); err != nil {
+		return errors.Wrap(err, "can't create command pool")
+	}
+
+	if err := app.createUploader(); err != nil {
+		return errors.Wrap(err, "can't create uploader")
+	}
+
+	if err := app.createTextureImage(); err != nil {
+		return errors.Wrap(err, "can't create texture image")
+	}
+
+	if err := app.createTextureSampler(); err != nil {
+		return errors.Wrap(err, "can't create texture sampler")
+	}
+
+	if err := app.createShadowSampler(); err != nil {
+		return errors.Wrap(err, "can't create shadow sampler")
+	}
+
+	if err := app.createDefaultMaterial(); err != nil {
+		return errors.Wrap(err, "can't create default material")
+	}
+
+	if err := app.createSkybox(); err != nil {
+		return errors.Wrap(err, "can't create skybox")
+	}
+
+	if err := app.createDeferred(); err != nil {
+		return errors.Wrap(err, "can't create deferred lighting")
+	}
+
+	if err := app.createBloom(); err != nil {
+		return errors.Wrap(err, "can't create bloom")
+	}
+
+	if err := app.createMeshes(); err != nil {
+		return errors.Wrap(err, "can't create meshes")
+	}
+
+	if err := app.createBindlessMaterials(); err != nil {
+		return errors.Wrap(err, "can't create bindless materials")
+	}
+
+	if err := app.createInstances(); err != nil {
+		return errors.Wrap(err, "can't create instances")
+	}
+
+	if err := app.createParticles(); err != nil {
+		return errors.Wrap(err, "can't create particles")
+	}
+
+	if err := app.createExternalParticles(); err != nil {
+		return errors.Wrap(err, "can't create external particles")
+	}
+
+	if err := app.createAsyncCompute(); err != nil {
+		return errors.Wrap(err, "can't create async compute")
+	}
+
+	if err := app.finishUploads(); err != nil {
+		return errors.Wrap(err, "can't upload texture and meshes")
+	}
+
+	if err := app.createRayTracing(); err != nil {
+		return errors.Wrap(err, "can't create ray tracing")
+	}
+
+	if err := app.createWindowResources(); err != nil {
+		return errors.Wrap(err, "can't create window resources")
+	}
+
+	if err := app.createExport(); err != nil {
+		return errors.Wrap(err, "can't create exported image")
+	}
+
 	return nil
 }
 
 func (app *HelloTriangleApplication) mainLoop() error {
 	w := app.window
-	// w.MakeContextCurrent()
-	for !w.ShouldClose() {
-		glfw.PollEvents()
-		// w.SwapBuffers()
+	app.startTime = time.Now()
+	app.startShaderReload()
+	defer app.stopShaderReload()
+
+	if err := app.startRecording(); err != nil {
+		return errors.Wrap(err, "can't start recording")
+	}
+
+	lastFrame := app.startTime
+	for !app.shouldClose() && !app.benchFinished() {
+		app.pollEvents()
+		now := time.Now()
+		dt := float32(now.Sub(lastFrame).Seconds())
+		lastFrame = now
 
-		if w.GetKey(glfw.KeyEscape) == glfw.Press {
+		if w != nil && w.GetKey(glfw.KeyEscape) == glfw.Press {
 			break
 		}
+
+		if err := app.reloadChangedShaders(); err != nil {
+			return errors.Wrap(err, "can't reload shaders")
+		}
+
+		if err := app.closeExtraWindows(); err != nil {
+			return errors.Wrap(err, "can't close windows")
+		}
+
+		app.checkMemoryBudget(now)
+
+		if app.asyncComputeToggled {
+			app.asyncComputeToggled = false
+			if err := app.toggleAsyncCompute(); err != nil {
+				return errors.Wrap(err, "can't switch async compute")
+			}
+		}
+
+		if app.rayTracingToggled {
+			app.rayTracingToggled = false
+			app.toggleRayTracing()
+		}
+
+		if app.meshShaderToggled {
+			app.meshShaderToggled = false
+			app.toggleMeshShading()
+		}
+
+		// Sleep until something happens rather than spinning with nothing to draw
+		if app.allMinimized() {
+			app.waitEvents()
+			lastFrame = time.Now()
+			continue
+		}
+
+		app.world.Tick(dt)
+		app.animate(dt)
+
+		// Waiting for the headset's frame paces the loop to its refresh
+		exit, err := app.beginXRFrame()
+		if err != nil {
+			return errors.Wrap(err, "can't begin OpenXR frame")
+		}
+		if exit {
+			break
+		}
+
+		err = app.forEachWindow(func() error {
+			if paused, err := app.pauseWhileMinimized(); paused || err != nil {
+				return err
+			}
+
+			if app.cameraController != nil && !app.uiWantsMouse(app.appWindow) && !app.uiWantsKeyboard(app.appWindow) {
+				app.cameraController.Update(app.camera, dt)
+			}
+
+			if app.windowModeToggled {
+				app.windowModeToggled = false
+				app.cycleWindowMode()
+			}
+
+			if app.polygonModeToggled {
+				app.polygonModeToggled = false
+				app.cyclePolygonMode()
+			}
+
+			if app.presentModeToggled {
+				app.presentModeToggled = false
+				if err := app.cyclePresentMode(); err != nil {
+					return errors.Wrap(err, "can't change present mode")
+				}
+			}
+
+			if app.gammaToggled {
+				app.gammaToggled = false
+				if err := app.toggleGamma(); err != nil {
+					return errors.Wrap(err, "can't change gamma")
+				}
+			}
+
+			return errors.Wrapf(app.drawFrame(), "can't draw frame for '%s'", app.config.Title)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := app.endXRFrame(); err != nil {
+			return errors.Wrap(err, "can't end OpenXR frame")
+		}
+
+		app.reportFrameStats(now)
+
+		if err := app.validationError(); err != nil {
+			return errors.Wrap(err, "validation failed")
+		}
 	}
-	return nil
+
+	// Let in flight work finish before cleanup starts destroying things
+	if err := app.waitIdle(); err != nil {
+		return err
+	}
+	return errors.Wrap(app.finishRecording(), "can't finish recording")
 }
 
 func (app *HelloTriangleApplication) cleanup() {
+	app.forEachWindow(func() error {
+		app.destroyWindow()
+		return nil
+	})
+
+	if app.uploader != nil {
+		app.uploader.Destroy()
+	}
+	if app.transferCommandPool != nil {
+		app.transferCommandPool.Destroy()
+	}
+	if app.commandPool != nil {
+		app.commandPool.Destroy()
+	}
+
+	if app.uiPlatform != nil {
+		app.uiPlatform.Destroy()
+	}
+
+	if app.descriptorSetLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(app.device, app.descriptorSetLayout, nil)
+	}
+	if app.materialSetLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(app.device, app.materialSetLayout, nil)
+	}
+	if app.meshletSetLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(app.device, app.meshletSetLayout, nil)
+	}
+
+	if app.textureSampler != vk.NullSampler {
+		app.release(app.textureSampler)
+		vk.DestroySampler(app.device, app.textureSampler, nil)
+	}
+	if app.textureImage != nil {
+		app.textureImage.Destroy()
+	}
+	app.destroyBindlessMaterials()
+	app.destroyMaterials()
+	if app.shadowSampler != vk.NullSampler {
+		app.release(app.shadowSampler)
+		vk.DestroySampler(app.device, app.shadowSampler, nil)
+	}
+	app.destroySkybox()
+	app.destroyDeferred()
+	app.destroyBloom()
+	app.destroyAsyncCompute()
+	app.destroyParticles()
+	app.destroyExternalParticles()
+	app.destroyRayTracing()
+	app.destroyMeshlets()
+	app.destroySkin()
+	app.destroyExport()
+
+	if app.mesh != nil {
+		app.mesh.Destroy()
+	}
+
+	// Nothing is in flight anymore, including what destroying the windows
+	// just deferred
+	app.deletions.FlushAll()
+
+	if app.allocator != nil {
+		stats := app.allocator.Stats()
+		if stats.Allocations > 0 {
+			app.logger.Warn("Memory still allocated at exit", logging.F("allocations", stats.Allocations), logging.F("bytes", stats.Used))
+		}
+		app.allocator.Destroy()
+	}
+
+	app.destroyXR()
+	app.reportLeaks()
+
 	if app.device != nil {
 		vk.DestroyDevice(app.device, nil)
 	}
 
-	if enableValidationLayers && app.debug != nil && app.debug != vk.NullDebugReportCallback {
-		vk.DestroyDebugReportCallback(app.instance, app.debug, nil)
+	if app.debugMessenger != nil {
+		app.debugMessenger.Destroy()
 	}
 
 	if app.instance != nil {
 		vk.DestroyInstance(app.instance, nil)
 	}
 
-	if app.window != nil {
-		app.window.Destroy()
+	if !app.Headless && app.NativeWindow == nil {
+		glfw.Terminate()
 	}
-
-	glfw.Terminate()
 }
 
 func (app *HelloTriangleApplication) createInstance() error {
-	if enableValidationLayers {
-		supported, err := app.checkValidationLayerSupport()
-		if err != nil {
-			return errors.Wrap(err, "can't check validation layers")
-		}
-		if !supported {
-			return errors.New("validation layers requested but not available")
-		}
+	if err := app.selectValidationLayers(); err != nil {
+		return errors.Wrap(err, "can't select validation layers")
 	}
 
 	appInfo := &vk.ApplicationInfo{
 		SType:              vk.StructureTypeApplicationInfo,
-		PApplicationName:   title,
+		PApplicationName:   app.config.Title,
 		ApplicationVersion: vk.MakeVersion(1, 0, 0),
 		PEngineName:        "Ingot",
 		EngineVersion:      vk.MakeVersion(1, 0, 0),
-		ApiVersion:         vk.ApiVersion11,
+		ApiVersion:         app.instanceAPIVersion(),
 	}
+	app.apiVersion = appInfo.ApiVersion
 
-	var availableInstanceExtensionsCount uint32
-	if err := vk.Error(vk.EnumerateInstanceExtensionProperties("", &availableInstanceExtensionsCount, nil)); err != nil {
-		return errors.Wrap(err, "can't enumerate instance extensions")
-	}
-	availableInstanceExtensions := make([]vk.ExtensionProperties, availableInstanceExtensionsCount)
-	if err := vk.Error(vk.EnumerateInstanceExtensionProperties("", &availableInstanceExtensionsCount, availableInstanceExtensions)); err != nil {
+	api := app.vulkan()
+	availableInstanceExtensions, err := api.InstanceExtensions()
+	if err != nil {
 		return errors.Wrap(err, "can't enumerate instance extensions")
 	}
 
-	log.Printf("Available extensions")
 	for _, ex := range availableInstanceExtensions {
-		ex.Deref()
-		log.Printf(" > " + vk.ToString(ex.ExtensionName[:]))
+		app.logger.Debug("Available instance extension",
+			logging.F("name", vk.ToString(ex.ExtensionName[:])),
+			logging.F("specVersion", ex.SpecVersion),
+		)
 	}
 
 	requiredExtensions := app.requiredExtensions()
-	log.Printf(
-		"Attempting to create instance with %s extensions enabled",
-		strings.Join(requiredExtensions, ","),
-	)
 	createInfo := &vk.InstanceCreateInfo{
 		SType:                   vk.StructureTypeInstanceCreateInfo,
 		PApplicationInfo:        appInfo,
 		EnabledExtensionCount:   uint32(len(requiredExtensions)),
 		PpEnabledExtensionNames: requiredExtensions,
+		EnabledLayerCount:       uint32(len(app.validationLayers)),
+		PpEnabledLayerNames:     safeStrings(app.validationLayers),
 	}
+	if err := enablePortabilityEnumeration(api, createInfo); err != nil {
+		return errors.Wrap(err, "can't check for portability enumeration")
+	}
+	app.logger.Info("Creating instance",
+		logging.F("extensions", strings.Join(createInfo.PpEnabledExtensionNames, ",")),
+		logging.F("layers", strings.Join(app.validationLayers, ",")),
+	)
 
-	var instance vk.Instance
-	if err := vk.Error(vk.CreateInstance(createInfo, nil, &instance)); err != nil {
+	instance, err := api.CreateInstance(createInfo)
+	if err != nil {
 		return errors.Wrap(err, "can't create instance")
 	}
 	app.instance = instance
@@ -206,218 +1312,679 @@ func (app *HelloTriangleApplication) createInstance() error {
 }
 
 func (app *HelloTriangleApplication) requiredExtensions() []string {
-	requiredExtensions := app.window.GetRequiredInstanceExtensions()
+	// Surface extensions are only needed to present to a window
+	var requiredExtensions []string
+	switch {
+	case app.window != nil:
+		requiredExtensions = app.window.GetRequiredInstanceExtensions()
+	case app.NativeWindow != nil && !app.Headless:
+		requiredExtensions = app.nativeInstanceExtensions()
+	}
 
-	if enableValidationLayers {
-		requiredExtensions = append(requiredExtensions, vk.ExtDebugReportExtensionName+"\x00")
+	if app.validationEnabled() {
+		requiredExtensions = append(requiredExtensions, vk.ExtDebugUtilsExtensionName+"\x00")
 	}
 
-	return requiredExtensions
+	return append(requiredExtensions, app.xrInstanceExtensions...)
 }
 
-func (app *HelloTriangleApplication) checkValidationLayerSupport() (bool, error) {
-	var layerCount uint32
-	if err := vk.Error(vk.EnumerateInstanceLayerProperties(&layerCount, nil)); err != nil {
-		return false, errors.Wrap(err, "can't get layer count")
+func (app *HelloTriangleApplication) createSurface() error {
+	if app.Headless {
+		return nil
 	}
-	availableLayers := make([]vk.LayerProperties, layerCount)
+	if app.NativeWindow != nil {
+		return app.createNativeSurface()
+	}
+
+	surfacePtr, err := app.window.CreateWindowSurface(app.instance, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't create GLFW window surface")
+	}
+	app.surface = vk.SurfaceFromPointer(surfacePtr)
+	return nil
+}
 
-	if err := vk.Error(vk.EnumerateInstanceLayerProperties(&layerCount, availableLayers)); err != nil {
-		return false, errors.Wrap(err, "can't get layers")
+// requiredDeviceFeatures are the features the application can't run without,
+// they're checked during device selection and enabled on the logical device.
+// No shader is a geometry shader, so geometryShader isn't one of them,
+// which MoltenVK doesn't have.
+func requiredDeviceFeatures() vk.PhysicalDeviceFeatures {
+	return vk.PhysicalDeviceFeatures{
+		SamplerAnisotropy: vk.True,
+	}
+}
+
+func (app *HelloTriangleApplication) pickPhysicalDevice() error {
+	api := app.vulkan()
+	devices, err := api.PhysicalDevices(app.instance)
+	if err != nil {
+		return err
 	}
 
-	log.Print("Available validation layers")
-	availableLayerNames := make([]string, len(availableLayers))
-	for i, layer := range availableLayers {
-		layer.Deref()
-		name := vk.ToString(layer.LayerName[:])
-		description := vk.ToString(layer.Description[:])
-		log.Printf(" > %s <%s>", name, description)
-		availableLayerNames[i] = name
+	if len(devices) == 0 {
+		return errors.New("no phyical device detected")
 	}
 
-	for _, vln := range validationLayerNames {
-		found := false
-		for _, aln := range availableLayerNames {
-			if vln == aln {
-				log.Printf("%s is a supported validation layer", aln)
-				found = true
-				break
+	names := make([]string, len(devices))
+	for i, d := range devices {
+		properties := api.PhysicalDeviceProperties(d)
+		names[i] = vk.ToString(properties.DeviceName[:])
+	}
+
+	requested := -1
+	if app.GPU != "" {
+		index, err := selectIndexOrName("GPU", app.GPU, names)
+		if err != nil {
+			return errors.Wrap(err, "can't find requested GPU")
+		}
+		requested = index
+	}
+	// A headset can only be drawn to by the device it's plugged into
+	if index, err := app.xrPhysicalDevice(devices); err != nil {
+		return errors.Wrap(err, "can't find OpenXR's GPU")
+	} else if index >= 0 {
+		requested = index
+	}
+
+	type deviceScore struct {
+		Device     vk.PhysicalDevice
+		Name       string
+		Score      int
+		Families   QueueFamilies
+		Extensions map[string]bool
+		RayTracing bool
+	}
+	candidates := make([]deviceScore, 0, len(devices))
+
+	scorer := app.DeviceScorer
+	if scorer == nil {
+		scorer = DefaultDeviceScorer
+	}
+
+	for i, d := range devices {
+		if requested >= 0 && i != requested {
+			continue
+		}
+
+		properties := api.PhysicalDeviceProperties(d)
+		features := api.PhysicalDeviceFeatures(d)
+		name := names[i]
+
+		if !features.SamplerAnisotropy.B() {
+			app.logger.Info("Skipping physical device", logging.F("device", name), logging.F("reason", "no sampler anisotropy support"))
+			continue
+		}
+
+		families, err := findQueueFamilies(api, d, app.surface)
+		if err != nil {
+			return errors.Wrapf(err, "can't find queue families for '%s'", name)
+		}
+		if !families.isComplete(!app.Headless) {
+			app.logger.Info("Skipping physical device", logging.F("device", name), logging.F("reason", "missing required queue families"))
+			continue
+		}
+
+		extensions, err := availableDeviceExtensions(api, d)
+		if err != nil {
+			return errors.Wrapf(err, "can't check extensions for '%s'", name)
+		}
+		if missing := missingExtensions(app.requiredDeviceExtensions(), extensions); missing != "" {
+			app.logger.Info("Skipping physical device",
+				logging.F("device", name),
+				logging.F("reason", "missing required extensions"),
+				logging.F("extensions", missing),
+			)
+			continue
+		}
+
+		if extensions[portability.SubsetExtension] {
+			if reason := unsuitablePortability(portability.Query(d)); reason != "" {
+				app.logger.Info("Skipping physical device", logging.F("device", name), logging.F("reason", reason))
+				continue
 			}
 		}
-		if !found {
-			return false, nil
+
+		if !app.Headless {
+			swapchainSupport, err := api.SwapchainSupport(d, app.surface)
+			if err != nil {
+				return errors.Wrapf(err, "can't query swapchain support for '%s'", name)
+			}
+			if !swapchainSupport.Adequate() {
+				app.logger.Info("Skipping physical device", logging.F("device", name), logging.F("reason", "inadequate swapchain support"))
+				continue
+			}
 		}
-	}
-	log.Print("All validation layers are supported")
 
-	return true, nil
-}
+		score := scorer(properties, features, QueueInfo{
+			Families:      api.QueueFamilyProperties(d),
+			QueueFamilies: families,
+		})
+		if score < 0 {
+			app.logger.Info("Skipping physical device", logging.F("device", name), logging.F("reason", "rejected by scorer"))
+			continue
+		}
 
-func (app *HelloTriangleApplication) setupDebugCallback() error {
-	if !enableValidationLayers {
-		return nil
+		rayTracing := app.RayTracing && missingExtensions(raytracing.Extensions, extensions) == "" && raytracing.Supported(d)
+		if rayTracing {
+			score += rayTracingScore
+			app.logger.Info("Physical device can ray trace", logging.F("device", name))
+		}
+
+		candidates = append(candidates, deviceScore{
+			Device:     d,
+			Name:       name,
+			Score:      score,
+			Families:   families,
+			Extensions: extensions,
+			RayTracing: rayTracing,
+		})
 	}
 
-	flags := vk.DebugReportFlags(vk.DebugUtilsMessageSeverityVerboseBit | vk.DebugUtilsMessageSeverityWarningBit | vk.DebugUtilsMessageSeverityErrorBit)
-	createInfo := &vk.DebugReportCallbackCreateInfo{
-		SType:       vk.StructureTypeDebugUtilsMessengerCreateInfo,
-		Flags:       flags,
-		PfnCallback: debugCallback,
+	if len(candidates) == 0 {
+		if requested >= 0 {
+			return errors.Errorf("requested GPU '%s' isn't suitable", names[requested])
+		}
+		return errors.New("failed to find suitable GPU")
 	}
 
-	var debugReportCallback vk.DebugReportCallback
-	if err := vk.Error(vk.CreateDebugReportCallback(app.instance, createInfo, nil, &debugReportCallback)); err != nil {
-		return errors.Wrap(err, "can't create debug report")
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		return a.Score > b.Score
+	})
+
+	chosen := candidates[0]
+	app.physicalDevice = chosen.Device
+	app.queueFamilies = chosen.Families
+	app.rayTracing = chosen.RayTracing
+	app.meshShading = app.MeshShaders && !app.instanced() &&
+		missingExtensions(meshshader.Extensions, chosen.Extensions) == "" && meshshader.Supported(chosen.Device)
+	app.bindless = app.wantsBindless() &&
+		missingExtensions(descriptors.IndexingExtensions, chosen.Extensions) == "" && descriptors.IndexingSupported(chosen.Device)
+	app.coreRendering = app.wantsDynamicRendering() && app.coreRenderingSupported(chosen.Device)
+	app.dynamicRendering = app.coreRendering || app.wantsDynamicRendering() &&
+		missingExtensions(rendering.Extensions, chosen.Extensions) == "" && rendering.Supported(chosen.Device)
+	app.stereo = app.wantsStereo() && renderpass.MultiviewSupported(chosen.Device)
+	app.exporting = app.wantsExport() && missingExtensions(interop.Extensions, chosen.Extensions) == ""
+	app.externalParticles = app.wantsExternalParticles() && externalParticlesSupported(chosen.Device, chosen.Extensions)
+	if chosen.Extensions[portability.SubsetExtension] {
+		app.portability = portability.Query(chosen.Device)
 	}
-	app.debug = debugReportCallback
+	app.selectDeviceExtensions(chosen.Extensions)
+	app.logger.Info("Selecting physical device", logging.F("device", chosen.Name), logging.F("score", chosen.Score))
+	app.reportPortability()
+
 	return nil
 }
 
-func debugCallback(flags vk.DebugReportFlags, objectType vk.DebugReportObjectType,
-	object uint64, location uint, messageCode int32, pLayerPrefix string,
-	pMessage string, pUserData unsafe.Pointer) vk.Bool32 {
+func (app *HelloTriangleApplication) createLogicalDevice() error {
+	uniqueFamilies := app.queueFamilies.unique()
+	queueCreateInfos := make([]vk.DeviceQueueCreateInfo, len(uniqueFamilies))
+	for i, family := range uniqueFamilies {
+		queueCreateInfos[i] = vk.DeviceQueueCreateInfo{
+			SType:            vk.StructureTypeDeviceQueueCreateInfo,
+			QueueFamilyIndex: family,
+			QueueCount:       1,
+			PQueuePriorities: []float32{1},
+		}
+	}
+
+	deviceFeatures := []vk.PhysicalDeviceFeatures{app.enabledDeviceFeatures()}
+	extensions := app.enabledDeviceExtensions()
+	app.logger.Info("Creating logical device", logging.F("extensions", strings.Join(extensions, ",")))
 
+	deviceCreateInfo := &vk.DeviceCreateInfo{
+		SType:                   vk.StructureTypeDeviceCreateInfo,
+		PQueueCreateInfos:       queueCreateInfos,
+		QueueCreateInfoCount:    uint32(len(queueCreateInfos)),
+		PEnabledFeatures:        deviceFeatures,
+		EnabledExtensionCount:   uint32(len(extensions)),
+		PpEnabledExtensionNames: safeStrings(extensions),
+	}
+
+	// Device layers are ignored by current loaders, older ones need them
+	if app.validationEnabled() {
+		deviceCreateInfo.EnabledLayerCount = uint32(len(app.validationLayers))
+		deviceCreateInfo.PpEnabledLayerNames = safeStrings(app.validationLayers)
+	}
+
+	var indexingFeatures *descriptors.IndexingFeatures
+	if app.bindless {
+		indexingFeatures = descriptors.NewIndexingFeatures(nil)
+		deviceCreateInfo.PNext = indexingFeatures.Pointer()
+	}
+	var multiviewFeatures *renderpass.MultiviewFeatures
+	if app.stereo {
+		multiviewFeatures = renderpass.NewMultiviewFeatures(deviceCreateInfo.PNext)
+		deviceCreateInfo.PNext = multiviewFeatures.Pointer()
+	}
+	var renderingFeatures *rendering.Features
+	var coreRenderingFeatures *rendering.CoreFeatures
 	switch {
-	case flags&vk.DebugReportFlags(vk.DebugReportInformationBit) != 0:
-		log.Printf("[INFO %d] %s on layer %s", messageCode, pMessage, pLayerPrefix)
-	case flags&vk.DebugReportFlags(vk.DebugReportErrorBit) != 0:
-		log.Printf("[ERROR %d] %s on layer %s", messageCode, pMessage, pLayerPrefix)
-	case flags&vk.DebugReportFlags(vk.DebugReportWarningBit) != 0:
-		log.Printf("[WARN %d] %s on layer %s", messageCode, pMessage, pLayerPrefix)
-	default:
-		log.Printf("[WARN] unknown debug message <%d> %d (layer %s) %s", flags, messageCode, pLayerPrefix, pMessage)
+	case app.coreRendering:
+		coreRenderingFeatures = rendering.NewCoreFeatures(deviceCreateInfo.PNext)
+		deviceCreateInfo.PNext = coreRenderingFeatures.Pointer()
+	case app.dynamicRendering:
+		renderingFeatures = rendering.NewFeatures(deviceCreateInfo.PNext)
+		deviceCreateInfo.PNext = renderingFeatures.Pointer()
+	}
+	var meshShaderFeatures *meshshader.Features
+	if app.meshShading {
+		meshShaderFeatures = meshshader.NewFeatures(deviceCreateInfo.PNext)
+		deviceCreateInfo.PNext = meshShaderFeatures.Pointer()
+	}
+	var timelineFeatures *interop.TimelineFeatures
+	if app.externalParticles {
+		timelineFeatures = interop.NewTimelineFeatures(deviceCreateInfo.PNext)
+		deviceCreateInfo.PNext = timelineFeatures.Pointer()
+	}
+	var rayTracingFeatures *raytracing.Features
+	if app.rayTracing {
+		rayTracingFeatures = raytracing.NewFeatures(deviceCreateInfo.PNext)
+		deviceCreateInfo.PNext = rayTracingFeatures.Pointer()
+	}
+	var portabilityFeatures *portability.Features
+	if app.portability != nil {
+		portabilityFeatures = app.portability.Enable(deviceCreateInfo.PNext)
+		deviceCreateInfo.PNext = portabilityFeatures.Pointer()
+	}
+
+	var device vk.Device
+	err := vk.Error(vk.CreateDevice(app.physicalDevice, deviceCreateInfo, nil, &device))
+	runtime.KeepAlive(indexingFeatures)
+	runtime.KeepAlive(multiviewFeatures)
+	runtime.KeepAlive(renderingFeatures)
+	runtime.KeepAlive(coreRenderingFeatures)
+	runtime.KeepAlive(meshShaderFeatures)
+	runtime.KeepAlive(timelineFeatures)
+	runtime.KeepAlive(rayTracingFeatures)
+	runtime.KeepAlive(portabilityFeatures)
+	if err != nil {
+		return errors.Wrap(err, "can't create logical device")
 	}
-	return vk.Bool32(vk.False)
+	app.device = device
+
+	return app.createQueues()
 }
 
-func (app *HelloTriangleApplication) pickPhysicalDevice() (uint32, error) {
-	var physicalDevice vk.PhysicalDevice
+func (app *HelloTriangleApplication) createSwapchain() error {
+	if app.Headless {
+		return app.createOffscreenTarget()
+	}
 
-	var deviceCount uint32
-	if err := vk.Error(vk.EnumeratePhysicalDevices(app.instance, &deviceCount, nil)); err != nil {
-		return 0, errors.Wrap(err, "can't get physical device count")
+	framebufferWidth, framebufferHeight := app.framebufferSize()
+
+	sc, err := swapchain.New(swapchain.Config{
+		PhysicalDevice:     app.physicalDevice,
+		Device:             app.device,
+		Surface:            app.surface,
+		FramebufferWidth:   framebufferWidth,
+		FramebufferHeight:  framebufferHeight,
+		QueueFamilyIndices: app.queueFamilies.presentation(),
+		PresentModes:       app.presentModes,
+		Formats:            app.swapchainFormats(),
+		Usage:              app.targetUsage(),
+		Logger:             app.logger,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create swapchain")
+	}
+	app.swapchain = sc
+	app.target = renderTarget{
+		Images:      sc.Images,
+		Format:      sc.Format,
+		Extent:      sc.Extent,
+		FinalLayout: vk.ImageLayoutPresentSrc,
 	}
 
-	devices := make([]vk.PhysicalDevice, deviceCount)
-	if err := vk.Error(vk.EnumeratePhysicalDevices(app.instance, &deviceCount, devices)); err != nil {
-		return 0, errors.Wrap(err, "can't get physical device count")
+	app.name(sc.Handle, "swapchain")
+	for i, img := range sc.Images {
+		app.name(img, "swapchain image %d", i)
 	}
+	app.checkSwapchainFormat()
+	return nil
+}
 
-	if len(devices) == 0 {
-		return 0, errors.New("no phyical device detected")
+// cleanupSwapchain destroys everything that depends on the swapchain's size
+// or format so it can be rebuilt by recreateSwapchain.
+func (app *HelloTriangleApplication) cleanupSwapchain() {
+	if app.uiRenderer != nil {
+		app.uiRenderer.DestroyTarget()
+	}
+	if app.textRenderer != nil {
+		app.textRenderer.DestroyTarget()
+	}
+	if app.spriteBatch != nil {
+		app.spriteBatch.DestroyTarget()
 	}
 
-	type deviceScore struct {
-		Device vk.PhysicalDevice
-		Name   string
-		Score  uint32
+	for _, fb := range app.framebuffers {
+		app.release(fb)
+		vk.DestroyFramebuffer(app.device, fb, nil)
 	}
-	candidates := make([]deviceScore, len(devices))
+	app.framebuffers = nil
 
-	for i, d := range devices {
-		var score uint32
+	if app.colorImage != nil {
+		app.colorImage.Destroy()
+		app.colorImage = nil
+	}
+	if app.depthImage != nil {
+		app.depthImage.Destroy()
+		app.depthImage = nil
+	}
+	app.destroyGBuffer()
+	app.destroyPostProcess()
+	app.destroyRayTracingTarget()
+	app.destroyStereoTarget()
 
-		// Discrete GPUs have a significant performance advantage
-		var properties vk.PhysicalDeviceProperties
-		vk.GetPhysicalDeviceProperties(d, &properties)
-		properties.Deref()
-		if isDiscrete := properties.DeviceType == vk.PhysicalDeviceTypeDiscreteGpu; isDiscrete {
-			score += 1000
-		}
+	app.destroyGraphicsPipeline()
 
-		var features vk.PhysicalDeviceFeatures
-		vk.GetPhysicalDeviceFeatures(d, &features)
-		features.Deref()
+	if app.renderPass != vk.NullRenderPass {
+		vk.DestroyRenderPass(app.device, app.renderPass, nil)
+		app.renderPass = vk.NullRenderPass
+	}
+	if app.compositeRenderPass != vk.NullRenderPass {
+		vk.DestroyRenderPass(app.device, app.compositeRenderPass, nil)
+		app.compositeRenderPass = vk.NullRenderPass
+	}
 
-		// Maximum possible size of textures affects graphics quality
-		score += properties.Limits.MaxImageDimension2D
+	for _, iv := range app.imageViews {
+		app.release(iv)
+		vk.DestroyImageView(app.device, iv, nil)
+	}
+	app.imageViews = nil
 
-		// Application can't function without geometry shaders
-		if hasGeometryShader := features.GeometryShader.B(); hasGeometryShader {
-			score = 0
-		}
+	if app.swapchain != nil {
+		app.swapchain.Destroy()
+		app.swapchain = nil
+	}
+	if app.offscreenImage != nil {
+		app.offscreenImage.Destroy()
+		app.offscreenImage = nil
+	}
+	app.target = renderTarget{}
+}
 
-		candidates[i] = deviceScore{
-			Device: d,
-			Name:   vk.ToString(properties.DeviceName[:]),
-			Score:  score,
-		}
+func (app *HelloTriangleApplication) recreateSwapchain() error {
+	if err := app.waitIdle(); err != nil {
+		return err
 	}
 
-	sort.Slice(candidates, func(i, j int) bool {
-		a, b := candidates[i], candidates[j]
-		return a.Score > b.Score
-	})
+	app.cleanupSwapchain()
 
-	chosen := candidates[0]
-	physicalDevice = chosen.Device
+	if err := app.createSwapchain(); err != nil {
+		return errors.Wrap(err, "can't create swapchain")
+	}
 
-	if physicalDevice == nil {
-		return 0, errors.New("failed to find suitable GPU")
+	if err := app.createImageViews(); err != nil {
+		return errors.Wrap(err, "can't create image views")
 	}
 
-	//findQueueFamilyIndices
-	graphicsQueueFamilyIndex := -1
-	{
-		var propertyCount uint32
-		vk.GetPhysicalDeviceQueueFamilyProperties(physicalDevice, &propertyCount, nil)
-		families := make([]vk.QueueFamilyProperties, propertyCount)
-		vk.GetPhysicalDeviceQueueFamilyProperties(physicalDevice, &propertyCount, families)
+	if err := app.createRenderPass(); err != nil {
+		return errors.Wrap(err, "can't create render pass")
+	}
 
-		for i, qf := range families {
-			qf.Deref()
-			if qf.QueueCount > 0 && qf.QueueFlags&vk.QueueFlags(vk.QueueGraphicsBit) != 0 {
-				graphicsQueueFamilyIndex = i
-				break
-			}
-		}
+	if err := app.createCompositeRenderPass(); err != nil {
+		return errors.Wrap(err, "can't create composite render pass")
+	}
 
-		if graphicsQueueFamilyIndex < 0 {
-			return 0, errors.New("Physical does not have needed queue famalies avaiable.")
+	if err := app.createStereoRenderPass(); err != nil {
+		return errors.Wrap(err, "can't create stereo render pass")
+	}
+
+	if err := app.createGraphicsPipeline(); err != nil {
+		return errors.Wrap(err, "can't create graphics pipeline")
+	}
+
+	if err := app.createColorResources(); err != nil {
+		return errors.Wrap(err, "can't create color resources")
+	}
+
+	if err := app.createDepthResources(); err != nil {
+		return errors.Wrap(err, "can't create depth resources")
+	}
+
+	if err := app.createGBuffer(); err != nil {
+		return errors.Wrap(err, "can't create G-buffer")
+	}
+
+	if err := app.createPostProcess(); err != nil {
+		return errors.Wrap(err, "can't create post-process chain")
+	}
+
+	if err := app.createFramebuffers(); err != nil {
+		return errors.Wrap(err, "can't create framebuffers")
+	}
+	app.updateLightingSet()
+
+	if err := app.createUITarget(); err != nil {
+		return err
+	}
+	if err := app.createOverlayTarget(); err != nil {
+		return err
+	}
+	if err := app.createSpriteTarget(); err != nil {
+		return err
+	}
+	if err := app.createRayTracingTarget(); err != nil {
+		return err
+	}
+	if err := app.createStereoTarget(); err != nil {
+		return err
+	}
+
+	// The image count can change along with the swapchain
+	app.imagesInFlight = make([]vk.Fence, len(app.target.Images))
+	return nil
+}
+
+func (app *HelloTriangleApplication) createImageViews() error {
+	app.imageViews = make([]vk.ImageView, 0, len(app.target.Images))
+	for i, img := range app.target.Images {
+		iv, err := app.createImageView(img, app.target.Format, vk.ImageAspectFlags(vk.ImageAspectColorBit), 1)
+		if err != nil {
+			return errors.Wrapf(err, "can't create image view for target image %d", i)
 		}
+		app.imageViews = append(app.imageViews, iv)
 	}
+	return nil
+}
 
-	app.physicalDevice = chosen.Device
-	log.Printf("Selecting physical device '%s'", chosen.Name)
+// createImageView creates a 2D view over the mip levels of an image, it's
+// shared by the swapchain, depth and texture images.
+func (app *HelloTriangleApplication) createImageView(image vk.Image, format vk.Format, aspectFlags vk.ImageAspectFlags, mipLevels uint32) (vk.ImageView, error) {
+	createInfo := &vk.ImageViewCreateInfo{
+		SType:    vk.StructureTypeImageViewCreateInfo,
+		Image:    image,
+		ViewType: vk.ImageViewType2d,
+		Format:   format,
+		Components: vk.ComponentMapping{
+			R: vk.ComponentSwizzleIdentity,
+			G: vk.ComponentSwizzleIdentity,
+			B: vk.ComponentSwizzleIdentity,
+			A: vk.ComponentSwizzleIdentity,
+		},
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask:     aspectFlags,
+			BaseMipLevel:   0,
+			LevelCount:     mipLevels,
+			BaseArrayLayer: 0,
+			LayerCount:     1,
+		},
+	}
 
-	return uint32(graphicsQueueFamilyIndex), nil
+	var imageView vk.ImageView
+	if err := vk.Error(vk.CreateImageView(app.device, createInfo, nil, &imageView)); err != nil {
+		return vk.NullImageView, errors.Wrap(err, "can't create image view")
+	}
+	app.track("image view", imageView)
+	return imageView, nil
 }
 
-func (app *HelloTriangleApplication) createLogicalDevice(graphicsQueueFamilyIndex uint32) error {
-	queueCreateInfo := vk.DeviceQueueCreateInfo{
-		SType:            vk.StructureTypeDeviceQueueCreateInfo,
-		QueueFamilyIndex: graphicsQueueFamilyIndex,
-		QueueCount:       1,
-		PQueuePriorities: []float32{1},
+func (app *HelloTriangleApplication) createRenderPass() error {
+	if app.Deferred {
+		return app.createDeferredRenderPass()
+	}
+	if app.dynamicRendering {
+		app.createSceneRendering()
+		return nil
 	}
 
-	deviceFeatues := []vk.PhysicalDeviceFeatures{}
+	format, finalLayout := app.sceneTarget()
+	b := renderpass.NewBuilder()
+	if app.multisampled() {
+		// Samples only live for the pass, they're resolved into the target image
+		msaa := renderpass.ColorAttachment(format, app.msaaSamples, vk.ImageLayoutColorAttachmentOptimal)
+		msaa.StoreOp = vk.AttachmentStoreOpDontCare
+		color := b.Attachment(msaa)
+		resolve := b.Attachment(renderpass.ResolveAttachment(format, finalLayout))
+		depth := b.Attachment(renderpass.DepthAttachment(app.depthFormat, app.msaaSamples))
+		b.Subpass(renderpass.Subpass{
+			Colors:   []uint32{color},
+			Resolves: []uint32{resolve},
+			Depth:    renderpass.Ref(depth),
+		})
+	} else {
+		color := b.Attachment(renderpass.ColorAttachment(format, vk.SampleCount1Bit, finalLayout))
+		depth := b.Attachment(renderpass.DepthAttachment(app.depthFormat, vk.SampleCount1Bit))
+		b.Subpass(renderpass.Subpass{
+			Colors: []uint32{color},
+			Depth:  renderpass.Ref(depth),
+		})
+	}
+	b.Dependency(renderpass.ExternalColorDepthDependency())
 
-	deviceCreateInfo := &vk.DeviceCreateInfo{
-		SType:                 vk.StructureTypeDeviceCreateInfo,
-		PQueueCreateInfos:     []vk.DeviceQueueCreateInfo{queueCreateInfo},
-		QueueCreateInfoCount:  1,
-		PEnabledFeatures:      deviceFeatues,
-		EnabledExtensionCount: 0,
+	renderPass, err := b.Build(app.device)
+	if err != nil {
+		return errors.Wrap(err, "can't build render pass")
+	}
+	app.renderPass = renderPass
+	return nil
+}
+
+func (app *HelloTriangleApplication) createFramebuffers() error {
+	if app.dynamicRendering {
+		return app.createCompositeFramebuffers()
 	}
+	extent := app.target.Extent
+	app.framebuffers = make([]vk.Framebuffer, 0, len(app.imageViews))
+	for i, iv := range app.imageViews {
+		iv = app.sceneView(iv)
+		// Attachment order has to match createRenderPass
+		var attachments []vk.ImageView
+		switch {
+		case app.Deferred:
+			attachments = []vk.ImageView{iv}
+			for _, img := range app.gbuffer {
+				attachments = append(attachments, img.View)
+			}
+			attachments = append(attachments, app.depthImage.View)
+		case app.multisampled():
+			attachments = []vk.ImageView{app.colorImage.View, iv, app.depthImage.View}
+		default:
+			attachments = []vk.ImageView{iv, app.depthImage.View}
+		}
+
+		createInfo := &vk.FramebufferCreateInfo{
+			SType:           vk.StructureTypeFramebufferCreateInfo,
+			RenderPass:      app.renderPass,
+			AttachmentCount: uint32(len(attachments)),
+			PAttachments:    attachments,
+			Width:           extent.Width,
+			Height:          extent.Height,
+			Layers:          1,
+		}
 
-	if enableValidationLayers {
-		deviceCreateInfo.EnabledLayerCount = uint32(len(validationLayerNames))
-		deviceCreateInfo.PpEnabledLayerNames = validationLayerNames
+		var fb vk.Framebuffer
+		if err := vk.Error(vk.CreateFramebuffer(app.device, createInfo, nil, &fb)); err != nil {
+			return errors.Wrapf(err, "can't create framebuffer %d", i)
+		}
+		app.track("framebuffer", fb)
+		app.framebuffers = append(app.framebuffers, fb)
 	}
+	return app.createCompositeFramebuffers()
+}
 
-	var device vk.Device
-	if err := vk.Error(vk.CreateDevice(app.physicalDevice, deviceCreateInfo, nil, &device)); err != nil {
-		return errors.Wrap(err, "can't create logical device")
+func (app *HelloTriangleApplication) createCommandPool() error {
+	pool, err := commands.NewPool(app.device, uint32(app.queueFamilies.Graphics))
+	if err != nil {
+		return errors.Wrap(err, "can't create graphics command pool")
+	}
+	app.commandPool = pool
+	return nil
+}
+
+func (app *HelloTriangleApplication) createMeshes() error {
+	if app.ModelPath == "" {
+		mesh, err := app.createMesh(quadVertices, quadIndices)
+		if err != nil {
+			return errors.Wrap(err, "can't create quad")
+		}
+		app.mesh = mesh
+		return app.createMeshlets(quadVertices, quadIndices)
+	}
+
+	var vertices []Vertex
+	var indices []uint32
+	var groups []MeshGroup
+	switch strings.ToLower(filepath.Ext(app.ModelPath)) {
+	case ".gltf", ".glb":
+		var err error
+		if vertices, indices, groups, err = app.loadGLTF(app.gltfModel); err != nil {
+			return errors.Wrap(err, "can't load model")
+		}
+		if err := app.createSkin(app.gltfModel); err != nil {
+			return err
+		}
+		app.gltfModel = nil
+	default:
+		model, err := models.LoadOBJ(app.ModelPath)
+		if err != nil {
+			return errors.Wrap(err, "can't load model")
+		}
+		// OBJ materials aren't PBR, everything uses the default material
+		models.GenerateNormals(model.Vertices, model.Indices)
+		models.GenerateTangents(model.Vertices, model.Indices)
+		vertices, indices = modelVertices(model.Vertices), model.Indices
+	}
+	app.logger.Info("Loaded model",
+		logging.F("path", app.ModelPath),
+		logging.F("vertices", len(vertices)),
+		logging.F("indices", len(indices)),
+		logging.F("materials", len(app.materials)),
+	)
+	if groups == nil {
+		groups = []MeshGroup{{Count: uint32(len(indices))}}
 	}
-	app.device = device
 
-	var graphicsQueue vk.Queue
-	vk.GetDeviceQueue(app.device, graphicsQueueFamilyIndex, 0, &graphicsQueue)
-	if graphicsQueue == nil {
-		return errors.New("can't get graphics queue")
+	lodVertices, lodIndices, lods, err := app.createLODs(vertices, indices, groups)
+	if err != nil {
+		return err
+	}
+	mesh, err := app.createMesh(lodVertices, lodIndices)
+	if err != nil {
+		return errors.Wrapf(err, "can't create mesh for '%s'", app.ModelPath)
 	}
+	mesh.IndexCount = uint32(len(indices))
+	mesh.Groups = groups
+	mesh.LODs = lods
+	app.mesh = mesh
+	return app.createMeshlets(vertices, indices)
+}
 
+func (app *HelloTriangleApplication) createCommandBuffers() error {
+	buffers, err := app.commandPool.Allocate(app.framesInFlight())
+	if err != nil {
+		return errors.Wrap(err, "can't allocate command buffers")
+	}
+	app.commandBuffers = buffers
 	return nil
 }
+
+// safeStrings null terminates strings before they're handed to Vulkan.
+func safeStrings(list []string) []string {
+	safe := make([]string, len(list))
+	for i, s := range list {
+		safe[i] = s + "\x00"
+	}
+	return safe
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/models"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// materialSet is the descriptor set a Material is bound to, after the
+// per object set 0.
+const materialSet = 1
+
+// Bindings within materialSet, matching material.glsl.
+const (
+	materialFactorsBinding = iota
+	materialBaseColorBinding
+	materialMetallicRoughnessBinding
+	materialNormalBinding
+	materialOcclusionBinding
+	materialEmissiveBinding
+)
+
+// MaterialFactors matches the std140 MaterialFactors block in
+// material.glsl, each multiplies the matching texture.
+type MaterialFactors struct {
+	BaseColor vmath.Vec4
+	// Emissive is RGB, W is padding.
+	Emissive          vmath.Vec4
+	Metallic          float32
+	Roughness         float32
+	NormalScale       float32
+	OcclusionStrength float32
+}
+
+// Material is a metallic-roughness PBR material, the textures follow glTF's
+// conventions: base color and emissive are sRGB, metallic is in the
+// metallic-roughness texture's blue channel and roughness in its green,
+// occlusion is in red. Textures are shared between materials and owned by
+// the application.
+type Material struct {
+	Name              string
+	Factors           *gpu.UniformBuffer[MaterialFactors]
+	BaseColor         *gpu.Image
+	MetallicRoughness *gpu.Image
+	Normal            *gpu.Image
+	Occlusion         *gpu.Image
+	Emissive          *gpu.Image
+	// Values are what Factors holds, for the bindless materials buffer.
+	Values MaterialFactors
+	// DoubleSided draws the back faces too, with VariantDoubleSided.
+	DoubleSided bool
+}
+
+// PipelineVariant is which graphics pipeline a material is drawn with, for
+// what about it is fixed in the pipeline rather than in its descriptor set.
+type PipelineVariant int
+
+const (
+	// VariantCulled culls back faces.
+	VariantCulled PipelineVariant = iota
+	// VariantDoubleSided draws both sides of every triangle.
+	VariantDoubleSided
+	pipelineVariants
+)
+
+var pipelineVariantNames = map[PipelineVariant]string{
+	VariantCulled:      "culled",
+	VariantDoubleSided: "double sided",
+}
+
+// cullMode is the rasterizer's cull mode for v.
+func (v PipelineVariant) cullMode() vk.CullModeFlags {
+	if v == VariantDoubleSided {
+		return vk.CullModeFlags(vk.CullModeNone)
+	}
+	return vk.CullModeFlags(vk.CullModeBackBit)
+}
+
+// Variant is the pipeline variant m is drawn with.
+func (m *Material) Variant() PipelineVariant {
+	if m.DoubleSided {
+		return VariantDoubleSided
+	}
+	return VariantCulled
+}
+
+// Destroy releases the material's factors, its textures are left alone.
+func (m *Material) Destroy() {
+	m.Factors.Destroy()
+}
+
+// createDefaultTextures creates the 1x1 textures materials fall back on,
+// white for colors and factors and a flat tangent space normal.
+func (app *HelloTriangleApplication) createDefaultTextures() error {
+	white, err := app.createSolidTexture(color.RGBA{255, 255, 255, 255}, "white texture")
+	if err != nil {
+		return err
+	}
+	app.whiteTexture = white
+
+	flat, err := app.createSolidTexture(color.RGBA{128, 128, 255, 255}, "flat normal texture")
+	if err != nil {
+		return err
+	}
+	app.flatNormalTexture = flat
+	return nil
+}
+
+func (app *HelloTriangleApplication) createSolidTexture(c color.RGBA, name string) (*gpu.Image, error) {
+	pixels := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	pixels.SetRGBA(0, 0, c)
+	img, err := app.createTexture(pixels, vk.FormatR8g8b8a8Unorm, name)
+	if err != nil {
+		return nil, err
+	}
+	app.materialTextures = append(app.materialTextures, img)
+	return img, nil
+}
+
+// createMaterial creates a material, nil textures fall back to the default
+// ones.
+func (app *HelloTriangleApplication) createMaterial(m Material, factors MaterialFactors) (int, error) {
+	b, err := gpu.NewUniformBuffer[MaterialFactors](app.gpuContext())
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't create factors for material '%s'", m.Name)
+	}
+	if err := b.Write(factors); err != nil {
+		b.Destroy()
+		return 0, errors.Wrapf(err, "can't write factors for material '%s'", m.Name)
+	}
+	app.name(b.Handle, "material '%s' factors", m.Name)
+	m.Factors = b
+	m.Values = factors
+
+	for _, t := range []**gpu.Image{&m.BaseColor, &m.MetallicRoughness, &m.Occlusion, &m.Emissive} {
+		if *t == nil {
+			*t = app.whiteTexture
+		}
+	}
+	if m.Normal == nil {
+		m.Normal = app.flatNormalTexture
+	}
+
+	app.materials = append(app.materials, &m)
+	return len(app.materials) - 1, nil
+}
+
+// createDefaultMaterial creates material 0, the built in texture on a
+// rough dielectric, used by the quad and OBJ models.
+func (app *HelloTriangleApplication) createDefaultMaterial() error {
+	if err := app.createDefaultTextures(); err != nil {
+		return errors.Wrap(err, "can't create default textures")
+	}
+	_, err := app.createMaterial(Material{
+		Name:      "default",
+		BaseColor: app.textureImage,
+	}, MaterialFactors{
+		BaseColor:         vmath.Vec4{1, 1, 1, 1},
+		Metallic:          0,
+		Roughness:         1,
+		NormalScale:       1,
+		OcclusionStrength: 1,
+	})
+	return err
+}
+
+// createGLTFMaterials creates a material for each of a glTF model's,
+// returning their indices by name. Images are uploaded once however many
+// materials use them.
+func (app *HelloTriangleApplication) createGLTFMaterials(materials map[string]*models.PBRMaterial) (map[string]int, error) {
+	textures := map[*models.Image]map[vk.Format]*gpu.Image{}
+	texture := func(img *models.Image, format vk.Format) (*gpu.Image, error) {
+		if img == nil {
+			return nil, nil
+		}
+		if t := textures[img][format]; t != nil {
+			return t, nil
+		}
+
+		name := "embedded texture"
+		if img.Path != "" {
+			name = "texture '" + img.Path + "'"
+		}
+		var t *gpu.Image
+		if compressedTexture(img) {
+			var err error
+			if t, err = app.loadCompressedTexture(img, format, name); err != nil {
+				return nil, err
+			}
+		} else {
+			var pixels *image.RGBA
+			var err error
+			if img.Path != "" {
+				pixels, err = loadRGBA(img.Path)
+			} else {
+				pixels, err = decodeRGBA(bytes.NewReader(img.Data))
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "can't load %s", name)
+			}
+			if t, err = app.createTexture(pixels, format, name); err != nil {
+				return nil, err
+			}
+		}
+		app.materialTextures = append(app.materialTextures, t)
+		if textures[img] == nil {
+			textures[img] = map[vk.Format]*gpu.Image{}
+		}
+		textures[img][format] = t
+		return t, nil
+	}
+
+	indices := make(map[string]int, len(materials))
+	for key, pbr := range materials {
+		name := pbr.Name
+		if name == "" {
+			name = key
+		}
+		m := Material{Name: name, DoubleSided: pbr.DoubleSided}
+
+		var err error
+		for _, t := range []struct {
+			dst    **gpu.Image
+			src    *models.Image
+			format vk.Format
+		}{
+			{&m.BaseColor, pbr.BaseColorTexture, vk.FormatR8g8b8a8Srgb},
+			{&m.MetallicRoughness, pbr.MetallicRoughnessTexture, vk.FormatR8g8b8a8Unorm},
+			{&m.Normal, pbr.NormalTexture, vk.FormatR8g8b8a8Unorm},
+			{&m.Occlusion, pbr.OcclusionTexture, vk.FormatR8g8b8a8Unorm},
+			{&m.Emissive, pbr.EmissiveTexture, vk.FormatR8g8b8a8Srgb},
+		} {
+			if *t.dst, err = texture(t.src, t.format); err != nil {
+				return nil, errors.Wrapf(err, "can't create material '%s'", name)
+			}
+		}
+
+		e := pbr.EmissiveFactor
+		index, err := app.createMaterial(m, MaterialFactors{
+			BaseColor:         pbr.BaseColorFactor,
+			Emissive:          vmath.Vec4{e[0], e[1], e[2], 0},
+			Metallic:          pbr.MetallicFactor,
+			Roughness:         pbr.RoughnessFactor,
+			NormalScale:       pbr.NormalScale,
+			OcclusionStrength: pbr.OcclusionStrength,
+		})
+		if err != nil {
+			return nil, err
+		}
+		indices[key] = index
+	}
+	return indices, nil
+}
+
+// createMaterialSets allocates the current window's set for every material
+// from its long lived descriptor allocator, or its bindless material table.
+// The factors never change after loading so one set per material serves
+// every frame in flight.
+func (app *HelloTriangleApplication) createMaterialSets() error {
+	if app.bindless {
+		return app.createBindlessSet()
+	}
+	app.materialSets = make([]vk.DescriptorSet, len(app.materials))
+	for i, m := range app.materials {
+		set, err := app.descriptorAllocator.Allocate(app.materialSetLayout)
+		if err != nil {
+			return errors.Wrapf(err, "can't allocate descriptor set for material '%s'", m.Name)
+		}
+		app.materialSets[i] = set
+
+		writes := []vk.WriteDescriptorSet{{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      materialFactorsBinding,
+			DescriptorType:  vk.DescriptorTypeUniformBuffer,
+			DescriptorCount: 1,
+			PBufferInfo: []vk.DescriptorBufferInfo{{
+				Buffer: m.Factors.Handle,
+				Offset: 0,
+				Range:  m.Factors.Size,
+			}},
+		}}
+		for binding, img := range map[uint32]*gpu.Image{
+			materialBaseColorBinding:         m.BaseColor,
+			materialMetallicRoughnessBinding: m.MetallicRoughness,
+			materialNormalBinding:            m.Normal,
+			materialOcclusionBinding:         m.Occlusion,
+			materialEmissiveBinding:          m.Emissive,
+		} {
+			writes = append(writes, vk.WriteDescriptorSet{
+				SType:           vk.StructureTypeWriteDescriptorSet,
+				DstSet:          set,
+				DstBinding:      binding,
+				DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+				DescriptorCount: 1,
+				PImageInfo: []vk.DescriptorImageInfo{{
+					ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+					ImageView:   img.View,
+					Sampler:     app.textureSampler,
+				}},
+			})
+		}
+		vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+	}
+	return nil
+}
+
+func (app *HelloTriangleApplication) destroyMaterials() {
+	for _, m := range app.materials {
+		m.Destroy()
+	}
+	app.materials = nil
+	for _, t := range app.materialTextures {
+		t.Destroy()
+	}
+	app.materialTextures = nil
+}
+
+// loadGLTF converts a glTF model into the application's vertex layout,
+// creating its materials and a mesh group per primitive.
+func (app *HelloTriangleApplication) loadGLTF(model *models.Model) ([]Vertex, []uint32, []MeshGroup, error) {
+	materials, err := app.createGLTFMaterials(model.PBRMaterials)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	groups := make([]MeshGroup, len(model.Groups))
+	for i, g := range model.Groups {
+		groups[i] = MeshGroup{
+			First:    g.IndexOffset,
+			Count:    g.IndexCount,
+			Material: materials[g.Material],
+		}
+	}
+
+	vertices := modelVertices(model.Vertices)
+	yUpToZUp(vertices)
+	return vertices, model.Indices, groups, nil
+}
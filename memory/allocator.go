@@ -0,0 +1,438 @@
+// Package memory sub-allocates buffers and images from large blocks of
+// device memory. Devices cap the number of live vkAllocateMemory calls at
+// maxMemoryAllocationCount, as low as 4096, which a scene with a few
+// thousand textures and meshes would hit allocating each one separately.
+package memory
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DefaultBlockSize is how much memory a block allocates when the heap is
+// big enough.
+const DefaultBlockSize = 64 << 20
+
+// Usage says how a resource's memory is accessed, it picks the memory type.
+type Usage int
+
+const (
+	// GPUOnly memory is device local and not mapped, for render targets,
+	// textures and meshes uploaded through a staging buffer.
+	GPUOnly Usage = iota
+	// CPUToGPU memory is mapped and written by the host every frame, like
+	// uniform and staging buffers. Device local memory is preferred where
+	// the host can see it.
+	CPUToGPU
+	// GPUToCPU memory is mapped and read back by the host, like screenshots.
+	// Host cached memory is preferred as it's much faster to read.
+	GPUToCPU
+)
+
+func (u Usage) String() string {
+	switch u {
+	case GPUOnly:
+		return "gpu-only"
+	case CPUToGPU:
+		return "cpu-to-gpu"
+	case GPUToCPU:
+		return "gpu-to-cpu"
+	}
+	return "unknown"
+}
+
+// properties are the memory properties a usage needs and would like.
+func (u Usage) properties() (required, preferred vk.MemoryPropertyFlags) {
+	switch u {
+	case CPUToGPU:
+		return vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit | vk.MemoryPropertyHostCoherentBit),
+			vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit)
+	case GPUToCPU:
+		return vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit | vk.MemoryPropertyHostCoherentBit),
+			vk.MemoryPropertyFlags(vk.MemoryPropertyHostCachedBit)
+	}
+	return vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit), 0
+}
+
+// poolKey separates blocks by memory type and by whether they hold linear
+// resources, buffers and linear images, or optimally tiled images. Keeping
+// them apart means bufferImageGranularity never has to be considered.
+type poolKey struct {
+	memoryType uint32
+	optimal    bool
+}
+
+// Allocator hands out Allocations from blocks of device memory. It's safe
+// to use from multiple goroutines.
+type Allocator struct {
+	device     vk.Device
+	properties vk.PhysicalDeviceMemoryProperties
+	blockSize  vk.DeviceSize
+	// deviceAddress allocates every block so buffers bound to it can have
+	// their addresses taken.
+	deviceAddress bool
+
+	mu        sync.Mutex
+	pools     map[poolKey][]*block
+	dedicated map[*block]bool
+}
+
+// New creates an allocator for device. blockSize is how much memory each
+// block allocates, zero uses DefaultBlockSize. Blocks are smaller on heaps
+// that couldn't fit eight of them.
+func New(physicalDevice vk.PhysicalDevice, device vk.Device, blockSize vk.DeviceSize) *Allocator {
+	if blockSize == 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	var properties vk.PhysicalDeviceMemoryProperties
+	vk.GetPhysicalDeviceMemoryProperties(physicalDevice, &properties)
+	properties.Deref()
+	for i := uint32(0); i < properties.MemoryTypeCount; i++ {
+		properties.MemoryTypes[i].Deref()
+	}
+	for i := uint32(0); i < properties.MemoryHeapCount; i++ {
+		properties.MemoryHeaps[i].Deref()
+	}
+
+	return &Allocator{
+		device:     device,
+		properties: properties,
+		blockSize:  blockSize,
+		pools:      map[poolKey][]*block{},
+		dedicated:  map[*block]bool{},
+	}
+}
+
+// structureTypeMemoryAllocateFlagsInfo is
+// VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_FLAGS_INFO.
+const structureTypeMemoryAllocateFlagsInfo vk.StructureType = 1000060000
+
+// memoryAllocateDeviceAddressBit is VK_MEMORY_ALLOCATE_DEVICE_ADDRESS_BIT,
+// the bindings predate buffer device addresses.
+const memoryAllocateDeviceAddressBit = 0x2
+
+// memoryAllocateFlagsInfo is laid out like VkMemoryAllocateFlagsInfo.
+type memoryAllocateFlagsInfo struct {
+	sType      vk.StructureType
+	pNext      unsafe.Pointer
+	flags      uint32
+	deviceMask uint32
+}
+
+// EnableDeviceAddresses allocates every later block so the addresses of
+// buffers bound to it can be taken, the device needs the
+// bufferDeviceAddress feature. It has to be called before anything's
+// allocated.
+func (a *Allocator) EnableDeviceAddresses() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deviceAddress = true
+}
+
+// Allocation is a range of a block's memory bound to a buffer or an image.
+type Allocation struct {
+	Memory vk.DeviceMemory
+	Offset vk.DeviceSize
+	Size   vk.DeviceSize
+	Usage  Usage
+
+	key    poolKey
+	block  *block
+	mapped unsafe.Pointer
+}
+
+// Mapped is the allocation's memory as the host sees it, nil for GPUOnly
+// allocations. It stays mapped until the allocation is freed. Host memory
+// is always coherent so writes don't have to be flushed.
+func (a *Allocation) Mapped() []byte {
+	if a.mapped == nil {
+		return nil
+	}
+	return unsafe.Slice((*byte)(a.mapped), a.Size)
+}
+
+// AllocateBuffer allocates memory for buffer and binds it.
+func (a *Allocator) AllocateBuffer(buffer vk.Buffer, usage Usage) (*Allocation, error) {
+	var requirements vk.MemoryRequirements
+	vk.GetBufferMemoryRequirements(a.device, buffer, &requirements)
+	requirements.Deref()
+
+	alloc, err := a.Allocate(requirements, usage, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := vk.Error(vk.BindBufferMemory(a.device, buffer, alloc.Memory, alloc.Offset)); err != nil {
+		a.Free(alloc)
+		return nil, errors.Wrap(err, "can't bind buffer memory")
+	}
+	return alloc, nil
+}
+
+// AllocateImage allocates memory for image and binds it. optimal is whether
+// the image was created with VK_IMAGE_TILING_OPTIMAL.
+func (a *Allocator) AllocateImage(image vk.Image, optimal bool, usage Usage) (*Allocation, error) {
+	var requirements vk.MemoryRequirements
+	vk.GetImageMemoryRequirements(a.device, image, &requirements)
+	requirements.Deref()
+
+	alloc, err := a.Allocate(requirements, usage, optimal)
+	if err != nil {
+		return nil, err
+	}
+	if err := vk.Error(vk.BindImageMemory(a.device, image, alloc.Memory, alloc.Offset)); err != nil {
+		a.Free(alloc)
+		return nil, errors.Wrap(err, "can't bind image memory")
+	}
+	return alloc, nil
+}
+
+// Allocate finds memory meeting requirements, optimal being whether it's
+// for an optimally tiled image. Anything over half a block gets a dedicated
+// allocation of its own.
+func (a *Allocator) Allocate(requirements vk.MemoryRequirements, usage Usage, optimal bool) (*Allocation, error) {
+	memoryType, err := a.findMemoryType(requirements.MemoryTypeBits, usage)
+	if err != nil {
+		return nil, err
+	}
+	key := poolKey{memoryType: memoryType, optimal: optimal}
+	blockSize := a.blockSizeFor(memoryType)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if requirements.Size > blockSize/2 {
+		b, err := a.newBlock(memoryType, requirements.Size, nil)
+		if err != nil {
+			return nil, err
+		}
+		a.dedicated[b] = true
+		b.allocate(requirements.Size, 1)
+		return b.allocation(key, usage, 0, requirements.Size), nil
+	}
+
+	for _, b := range a.pools[key] {
+		if offset, ok := b.allocate(requirements.Size, requirements.Alignment); ok {
+			return b.allocation(key, usage, offset, requirements.Size), nil
+		}
+	}
+
+	b, err := a.newBlock(memoryType, blockSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	a.pools[key] = append(a.pools[key], b)
+	offset, _ := b.allocate(requirements.Size, requirements.Alignment)
+	return b.allocation(key, usage, offset, requirements.Size), nil
+}
+
+// AllocateImageDedicated allocates image a block of its own and binds it,
+// with next chained onto the block's VkMemoryAllocateInfo. Memory shared
+// with another API has to be allocated like this, next being what exports
+// or imports it.
+func (a *Allocator) AllocateImageDedicated(image vk.Image, usage Usage, next unsafe.Pointer) (*Allocation, error) {
+	var requirements vk.MemoryRequirements
+	vk.GetImageMemoryRequirements(a.device, image, &requirements)
+	requirements.Deref()
+
+	alloc, err := a.allocateDedicated(requirements, usage, true, next)
+	if err != nil {
+		return nil, err
+	}
+	if err := vk.Error(vk.BindImageMemory(a.device, image, alloc.Memory, alloc.Offset)); err != nil {
+		a.Free(alloc)
+		return nil, errors.Wrap(err, "can't bind image memory")
+	}
+	return alloc, nil
+}
+
+// AllocateBufferDedicated is AllocateImageDedicated for buffers.
+func (a *Allocator) AllocateBufferDedicated(buffer vk.Buffer, usage Usage, next unsafe.Pointer) (*Allocation, error) {
+	var requirements vk.MemoryRequirements
+	vk.GetBufferMemoryRequirements(a.device, buffer, &requirements)
+	requirements.Deref()
+
+	alloc, err := a.allocateDedicated(requirements, usage, false, next)
+	if err != nil {
+		return nil, err
+	}
+	if err := vk.Error(vk.BindBufferMemory(a.device, buffer, alloc.Memory, alloc.Offset)); err != nil {
+		a.Free(alloc)
+		return nil, errors.Wrap(err, "can't bind buffer memory")
+	}
+	return alloc, nil
+}
+
+func (a *Allocator) allocateDedicated(requirements vk.MemoryRequirements, usage Usage, optimal bool, next unsafe.Pointer) (*Allocation, error) {
+	memoryType, err := a.findMemoryType(requirements.MemoryTypeBits, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, err := a.newBlock(memoryType, requirements.Size, next)
+	if err != nil {
+		return nil, err
+	}
+	a.dedicated[b] = true
+	b.allocate(requirements.Size, 1)
+	return b.allocation(poolKey{memoryType: memoryType, optimal: optimal}, usage, 0, requirements.Size), nil
+}
+
+// Free returns an allocation's memory, the resource bound to it has to have
+// been destroyed. Blocks are released once they're empty.
+func (a *Allocator) Free(alloc *Allocation) {
+	if alloc == nil || alloc.block == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	b := alloc.block
+	alloc.block = nil
+	alloc.mapped = nil
+	b.release(alloc.Offset, alloc.Size)
+	if b.allocations > 0 {
+		return
+	}
+
+	if a.dedicated[b] {
+		delete(a.dedicated, b)
+	} else {
+		pool := a.pools[alloc.key]
+		for i, pb := range pool {
+			if pb == b {
+				a.pools[alloc.key] = append(pool[:i], pool[i+1:]...)
+				break
+			}
+		}
+	}
+	b.destroy(a.device)
+}
+
+// Destroy frees every block, anything still allocated from them is invalid.
+func (a *Allocator) Destroy() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, pool := range a.pools {
+		for _, b := range pool {
+			b.destroy(a.device)
+		}
+		delete(a.pools, key)
+	}
+	for b := range a.dedicated {
+		b.destroy(a.device)
+		delete(a.dedicated, b)
+	}
+}
+
+// Stats is a summary of the allocator's memory.
+type Stats struct {
+	// Blocks is how many device memory allocations the allocator holds,
+	// Dedicated of them for single large resources.
+	Blocks    int
+	Dedicated int
+	// Allocations is how many resources have memory.
+	Allocations int
+	// Reserved is the device memory allocated, Used the part of it handed out.
+	Reserved vk.DeviceSize
+	Used     vk.DeviceSize
+}
+
+func (a *Allocator) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := Stats{Dedicated: len(a.dedicated)}
+	add := func(b *block) {
+		s.Blocks++
+		s.Allocations += b.allocations
+		s.Reserved += b.size
+		s.Used += b.used
+	}
+	for _, pool := range a.pools {
+		for _, b := range pool {
+			add(b)
+		}
+	}
+	for b := range a.dedicated {
+		add(b)
+	}
+	return s
+}
+
+// findMemoryType picks the first allowed memory type with the properties
+// usage needs, preferring ones with the properties it would like.
+func (a *Allocator) findMemoryType(typeBits uint32, usage Usage) (uint32, error) {
+	required, preferred := usage.properties()
+	found := false
+	var best uint32
+	for i := uint32(0); i < a.properties.MemoryTypeCount; i++ {
+		flags := a.properties.MemoryTypes[i].PropertyFlags
+		if typeBits&(1<<i) == 0 || flags&required != required {
+			continue
+		}
+		if flags&preferred == preferred {
+			return i, nil
+		}
+		if !found {
+			found = true
+			best = i
+		}
+	}
+	if !found {
+		return 0, errors.Errorf("no %s memory type with properties %b in %b", usage, required, typeBits)
+	}
+	return best, nil
+}
+
+func (a *Allocator) blockSizeFor(memoryType uint32) vk.DeviceSize {
+	heap := a.properties.MemoryHeaps[a.properties.MemoryTypes[memoryType].HeapIndex]
+	if size := heap.Size / 8; size < a.blockSize {
+		return size
+	}
+	return a.blockSize
+}
+
+// newBlock allocates size bytes of memoryType, with next, when it isn't
+// nil, chained onto the VkMemoryAllocateInfo.
+func (a *Allocator) newBlock(memoryType uint32, size vk.DeviceSize, next unsafe.Pointer) (*block, error) {
+	allocInfo := &vk.MemoryAllocateInfo{
+		SType:           vk.StructureTypeMemoryAllocateInfo,
+		PNext:           next,
+		AllocationSize:  size,
+		MemoryTypeIndex: memoryType,
+	}
+	flags := &memoryAllocateFlagsInfo{
+		sType: structureTypeMemoryAllocateFlagsInfo,
+		pNext: next,
+		flags: memoryAllocateDeviceAddressBit,
+	}
+	if a.deviceAddress {
+		allocInfo.PNext = unsafe.Pointer(flags)
+	}
+	var memory vk.DeviceMemory
+	err := vk.Error(vk.AllocateMemory(a.device, allocInfo, nil, &memory))
+	runtime.KeepAlive(flags)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't allocate %d byte block", size)
+	}
+
+	b := newBlock(memory, size)
+
+	// A memory object can only be mapped once, so host visible blocks are
+	// mapped for as long as they live and allocations share the mapping
+	hostVisible := vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit)
+	if a.properties.MemoryTypes[memoryType].PropertyFlags&hostVisible != 0 {
+		if err := vk.Error(vk.MapMemory(a.device, memory, 0, vk.DeviceSize(vk.WholeSize), 0, &b.mapped)); err != nil {
+			vk.FreeMemory(a.device, memory, nil)
+			return nil, errors.Wrap(err, "can't map block")
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"sort"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// region is a free range of a block.
+type region struct {
+	offset vk.DeviceSize
+	size   vk.DeviceSize
+}
+
+// block is one device memory allocation carved up first fit. Its free list
+// is kept sorted by offset with neighbours merged.
+type block struct {
+	memory      vk.DeviceMemory
+	size        vk.DeviceSize
+	used        vk.DeviceSize
+	allocations int
+	free        []region
+	mapped      unsafe.Pointer
+}
+
+func newBlock(memory vk.DeviceMemory, size vk.DeviceSize) *block {
+	return &block{
+		memory: memory,
+		size:   size,
+		free:   []region{{offset: 0, size: size}},
+	}
+}
+
+// allocate takes size bytes at an offset aligned to alignment, reporting
+// false when no free region is big enough. Padding before the offset stays
+// free.
+func (b *block) allocate(size, alignment vk.DeviceSize) (vk.DeviceSize, bool) {
+	if alignment == 0 {
+		alignment = 1
+	}
+	for i, r := range b.free {
+		offset := (r.offset + alignment - 1) / alignment * alignment
+		padding := offset - r.offset
+		if padding+size > r.size {
+			continue
+		}
+
+		var split []region
+		if padding > 0 {
+			split = append(split, region{offset: r.offset, size: padding})
+		}
+		if rest := r.size - padding - size; rest > 0 {
+			split = append(split, region{offset: offset + size, size: rest})
+		}
+		b.free = append(b.free[:i], append(split, b.free[i+1:]...)...)
+
+		b.used += size
+		b.allocations++
+		return offset, true
+	}
+	return 0, false
+}
+
+// release returns a range to the free list, merging it with its neighbours.
+func (b *block) release(offset, size vk.DeviceSize) {
+	b.used -= size
+	b.allocations--
+
+	i := sort.Search(len(b.free), func(i int) bool { return b.free[i].offset > offset })
+	b.free = append(b.free, region{})
+	copy(b.free[i+1:], b.free[i:])
+	b.free[i] = region{offset: offset, size: size}
+
+	if i+1 < len(b.free) && b.free[i].offset+b.free[i].size == b.free[i+1].offset {
+		b.free[i].size += b.free[i+1].size
+		b.free = append(b.free[:i+1], b.free[i+2:]...)
+	}
+	if i > 0 && b.free[i-1].offset+b.free[i-1].size == b.free[i].offset {
+		b.free[i-1].size += b.free[i].size
+		b.free = append(b.free[:i], b.free[i+1:]...)
+	}
+}
+
+func (b *block) allocation(key poolKey, usage Usage, offset, size vk.DeviceSize) *Allocation {
+	alloc := &Allocation{
+		Memory: b.memory,
+		Offset: offset,
+		Size:   size,
+		Usage:  usage,
+		key:    key,
+		block:  b,
+	}
+	if b.mapped != nil {
+		alloc.mapped = unsafe.Add(b.mapped, offset)
+	}
+	return alloc
+}
+
+func (b *block) destroy(device vk.Device) {
+	if b.mapped != nil {
+		vk.UnmapMemory(device, b.memory)
+		b.mapped = nil
+	}
+	vk.FreeMemory(device, b.memory, nil)
+	b.memory = vk.NullDeviceMemory
+}
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// op is an allocate, or a release when release is set, of size bytes.
+type op struct {
+	release   bool
+	offset    vk.DeviceSize
+	size      vk.DeviceSize
+	alignment vk.DeviceSize
+	// want is the offset an allocate should return, ok whether it fits.
+	want vk.DeviceSize
+	ok   bool
+}
+
+func TestBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		size vk.DeviceSize
+		ops  []op
+		free []region
+		used vk.DeviceSize
+	}{
+		{
+			name: "allocations pack from the start",
+			size: 1024,
+			ops: []op{
+				{size: 256, alignment: 1, want: 0, ok: true},
+				{size: 256, alignment: 1, want: 256, ok: true},
+			},
+			free: []region{{offset: 512, size: 512}},
+			used: 512,
+		},
+		{
+			name: "whole block",
+			size: 1024,
+			ops: []op{
+				{size: 1024, alignment: 256, want: 0, ok: true},
+			},
+			free: []region{},
+			used: 1024,
+		},
+		{
+			name: "too big",
+			size: 1024,
+			ops: []op{
+				{size: 1025, alignment: 1, ok: false},
+			},
+			free: []region{{offset: 0, size: 1024}},
+		},
+		{
+			name: "alignment padding stays free",
+			size: 1024,
+			ops: []op{
+				{size: 100, alignment: 1, want: 0, ok: true},
+				{size: 100, alignment: 256, want: 256, ok: true},
+			},
+			free: []region{{offset: 100, size: 156}, {offset: 356, size: 668}},
+			used: 200,
+		},
+		{
+			name: "padding is used by a later allocation that fits",
+			size: 1024,
+			ops: []op{
+				{size: 100, alignment: 1, want: 0, ok: true},
+				{size: 100, alignment: 256, want: 256, ok: true},
+				{size: 156, alignment: 4, want: 100, ok: true},
+			},
+			free: []region{{offset: 356, size: 668}},
+			used: 356,
+		},
+		{
+			name: "alignment padding can make it not fit",
+			size: 1024,
+			ops: []op{
+				{size: 1, alignment: 1, want: 0, ok: true},
+				{size: 1023, alignment: 2, ok: false},
+			},
+			free: []region{{offset: 1, size: 1023}},
+			used: 1,
+		},
+		{
+			name: "zero alignment means unaligned",
+			size: 1024,
+			ops: []op{
+				{size: 3, alignment: 1, want: 0, ok: true},
+				{size: 5, alignment: 0, want: 3, ok: true},
+			},
+			free: []region{{offset: 8, size: 1016}},
+			used: 8,
+		},
+		{
+			name: "release with no free neighbours",
+			size: 768,
+			ops: []op{
+				{size: 256, alignment: 1, want: 0, ok: true},
+				{size: 256, alignment: 1, want: 256, ok: true},
+				{size: 256, alignment: 1, want: 512, ok: true},
+				{release: true, offset: 256, size: 256},
+			},
+			free: []region{{offset: 256, size: 256}},
+			used: 512,
+		},
+		{
+			name: "release merges with the next region",
+			size: 1024,
+			ops: []op{
+				{size: 256, alignment: 1, want: 0, ok: true},
+				{size: 256, alignment: 1, want: 256, ok: true},
+				{release: true, offset: 256, size: 256},
+			},
+			free: []region{{offset: 256, size: 768}},
+			used: 256,
+		},
+		{
+			name: "release merges with the previous region",
+			size: 768,
+			ops: []op{
+				{size: 256, alignment: 1, want: 0, ok: true},
+				{size: 256, alignment: 1, want: 256, ok: true},
+				{size: 256, alignment: 1, want: 512, ok: true},
+				{release: true, offset: 0, size: 256},
+				{release: true, offset: 256, size: 256},
+			},
+			free: []region{{offset: 0, size: 512}},
+			used: 256,
+		},
+		{
+			name: "release merges both neighbours",
+			size: 768,
+			ops: []op{
+				{size: 256, alignment: 1, want: 0, ok: true},
+				{size: 256, alignment: 1, want: 256, ok: true},
+				{size: 256, alignment: 1, want: 512, ok: true},
+				{release: true, offset: 0, size: 256},
+				{release: true, offset: 512, size: 256},
+				{release: true, offset: 256, size: 256},
+			},
+			free: []region{{offset: 0, size: 768}},
+			used: 0,
+		},
+		{
+			name: "released range is reused first fit",
+			size: 1024,
+			ops: []op{
+				{size: 256, alignment: 1, want: 0, ok: true},
+				{size: 256, alignment: 1, want: 256, ok: true},
+				{release: true, offset: 0, size: 256},
+				{size: 128, alignment: 1, want: 0, ok: true},
+			},
+			free: []region{{offset: 128, size: 128}, {offset: 512, size: 512}},
+			used: 384,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBlock(vk.NullDeviceMemory, tt.size)
+			for i, o := range tt.ops {
+				if o.release {
+					b.release(o.offset, o.size)
+					continue
+				}
+				offset, ok := b.allocate(o.size, o.alignment)
+				if ok != o.ok || ok && offset != o.want {
+					t.Fatalf("op %d: allocate(%d, %d) = %d, %v, want %d, %v", i, o.size, o.alignment, offset, ok, o.want, o.ok)
+				}
+			}
+			if !reflect.DeepEqual(b.free, tt.free) {
+				t.Errorf("free = %v, want %v", b.free, tt.free)
+			}
+			if b.used != tt.used {
+				t.Errorf("used = %d, want %d", b.used, tt.used)
+			}
+		})
+	}
+}
+
+// TestBlockFreeListCoversBlock allocates and releases in an interleaved
+// order and checks the free list ends up as the whole block again.
+func TestBlockFreeListCoversBlock(t *testing.T) {
+	b := newBlock(vk.NullDeviceMemory, 4096)
+	type allocation struct{ offset, size vk.DeviceSize }
+	var allocations []allocation
+	for i, size := range []vk.DeviceSize{100, 256, 3, 512, 64, 1000} {
+		alignment := vk.DeviceSize(1) << uint(i)
+		offset, ok := b.allocate(size, alignment)
+		if !ok {
+			t.Fatalf("allocate(%d, %d) failed", size, alignment)
+		}
+		if offset%alignment != 0 {
+			t.Fatalf("allocate(%d, %d) = %d, not aligned", size, alignment, offset)
+		}
+		allocations = append(allocations, allocation{offset, size})
+	}
+	for _, i := range []int{3, 0, 5, 1, 4, 2} {
+		b.release(allocations[i].offset, allocations[i].size)
+	}
+
+	want := []region{{offset: 0, size: 4096}}
+	if !reflect.DeepEqual(b.free, want) {
+		t.Errorf("free = %v, want %v", b.free, want)
+	}
+	if b.used != 0 || b.allocations != 0 {
+		t.Errorf("used = %d with %d allocations, want none", b.used, b.allocations)
+	}
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"runtime"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// BudgetExtension is the device extension Budget needs.
+const BudgetExtension = "VK_EXT_memory_budget"
+
+// structureTypeMemoryBudgetProperties is
+// VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_BUDGET_PROPERTIES_EXT, the
+// bindings predate the extension.
+const structureTypeMemoryBudgetProperties vk.StructureType = 1000237000
+
+// memoryBudgetProperties is laid out like
+// VkPhysicalDeviceMemoryBudgetPropertiesEXT so it can be chained onto
+// vk.PhysicalDeviceMemoryProperties2 and filled in by the driver.
+type memoryBudgetProperties struct {
+	sType      vk.StructureType
+	pNext      unsafe.Pointer
+	heapBudget [vk.MaxMemoryHeaps]vk.DeviceSize
+	heapUsage  [vk.MaxMemoryHeaps]vk.DeviceSize
+}
+
+// HeapBudget is how much of a memory heap the process is using and how much
+// it can use before allocations start failing or being paged out.
+type HeapBudget struct {
+	Heap        int
+	DeviceLocal bool
+	Size        vk.DeviceSize
+	Usage       vk.DeviceSize
+	Budget      vk.DeviceSize
+}
+
+// Fraction is how much of the budget is in use.
+func (h HeapBudget) Fraction() float64 {
+	if h.Budget == 0 {
+		return 0
+	}
+	return float64(h.Usage) / float64(h.Budget)
+}
+
+// Budget reports every memory heap's usage and budget, the device has to
+// have been created with BudgetExtension. Both change as other processes
+// allocate so they're only good for the moment they're queried.
+func Budget(physicalDevice vk.PhysicalDevice) []HeapBudget {
+	budget := &memoryBudgetProperties{sType: structureTypeMemoryBudgetProperties}
+	properties := vk.PhysicalDeviceMemoryProperties2{
+		SType: vk.StructureTypePhysicalDeviceMemoryProperties2,
+		PNext: unsafe.Pointer(budget),
+	}
+	vk.GetPhysicalDeviceMemoryProperties2(physicalDevice, &properties)
+	runtime.KeepAlive(budget)
+	properties.Deref()
+	properties.MemoryProperties.Deref()
+
+	heaps := make([]HeapBudget, properties.MemoryProperties.MemoryHeapCount)
+	for i := range heaps {
+		heap := properties.MemoryProperties.MemoryHeaps[i]
+		heap.Deref()
+		heaps[i] = HeapBudget{
+			Heap:        i,
+			DeviceLocal: heap.Flags&vk.MemoryHeapFlags(vk.MemoryHeapDeviceLocalBit) != 0,
+			Size:        heap.Size,
+			Usage:       budget.heapUsage[i],
+			Budget:      budget.heapBudget[i],
+		}
+	}
+	return heaps
+}
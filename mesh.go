@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/culling"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/raytracing"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Mesh is vertex data and the indices that assemble it into triangles, both
+// living in device local buffers.
+type Mesh struct {
+	Vertices   *gpu.Buffer
+	Indices    *gpu.Buffer
+	IndexCount uint32
+	IndexType  vk.IndexType
+	// Instances holds InstanceCount Instances to draw the mesh with, bound
+	// at binding 1. Without it the mesh is drawn once.
+	Instances     *gpu.Buffer
+	InstanceCount uint32
+	// Radius bounds the mesh, and its instances, around the origin.
+	Radius float32
+	// Bounds is the box around the mesh and its instances, in the space
+	// objects place it from.
+	Bounds culling.AABB
+	// Groups partition the first IndexCount indices by material.
+	Groups []MeshGroup
+	// LODs are the mesh's coarser levels of detail, each with a group for
+	// each of Groups drawn with its material, from indices after
+	// IndexCount. Mesh shading and ray tracing only use Groups.
+	LODs [][]MeshGroup
+}
+
+// MeshGroup is Count indices from First drawn with app.materials[Material].
+// When mesh shading they're also MeshletCount meshlets from FirstMeshlet.
+type MeshGroup struct {
+	First        uint32
+	Count        uint32
+	Material     int
+	FirstMeshlet uint32
+	MeshletCount uint32
+}
+
+func (app *HelloTriangleApplication) createMesh(vertices []Vertex, indices []uint32) (*Mesh, error) {
+	if len(indices) == 0 {
+		return nil, errors.New("mesh has no indices")
+	}
+
+	ctx := app.meshContext()
+	vertexBuffer, err := gpu.NewVertexBuffer(ctx, vertices)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't upload vertices")
+	}
+
+	indexBuffer, indexType, err := createIndexBuffer(ctx, indices, len(vertices))
+	if err != nil {
+		vertexBuffer.Destroy()
+		return nil, errors.Wrap(err, "can't upload indices")
+	}
+
+	var radius float32
+	for _, v := range vertices {
+		if r := vmath.Vec3(v.Pos).Len(); r > radius {
+			radius = r
+		}
+	}
+
+	app.name(vertexBuffer.Handle, "mesh vertices")
+	app.name(indexBuffer.Handle, "mesh indices")
+
+	return &Mesh{
+		Vertices:   vertexBuffer,
+		Indices:    indexBuffer,
+		IndexCount: uint32(len(indices)),
+		IndexType:  indexType,
+		Radius:     radius,
+		Bounds:     meshBounds(vertices),
+		Groups:     []MeshGroup{{First: 0, Count: uint32(len(indices))}},
+	}, nil
+}
+
+// Draw binds the mesh's buffers and issues an indexed draw.
+func (m *Mesh) Draw(cb vk.CommandBuffer) {
+	m.DrawRange(cb, 0, m.IndexCount)
+}
+
+// DrawRange binds the mesh's buffers and draws count indices from first,
+// for every instance in a single draw.
+func (m *Mesh) DrawRange(cb vk.CommandBuffer, first, count uint32) {
+	if count == 0 {
+		return
+	}
+	instances := uint32(1)
+	if m.Instances != nil {
+		vk.CmdBindVertexBuffers(cb, 0, 2, []vk.Buffer{m.Vertices.Handle, m.Instances.Handle}, []vk.DeviceSize{0, 0})
+		instances = m.InstanceCount
+	} else {
+		vk.CmdBindVertexBuffers(cb, 0, 1, []vk.Buffer{m.Vertices.Handle}, []vk.DeviceSize{0})
+	}
+	vk.CmdBindIndexBuffer(cb, m.Indices.Handle, 0, m.IndexType)
+	vk.CmdDrawIndexed(cb, count, instances, first, 0, 0)
+}
+
+// Destroy releases the mesh's buffers.
+func (m *Mesh) Destroy() {
+	m.Vertices.Destroy()
+	m.Indices.Destroy()
+	if m.Instances != nil {
+		m.Instances.Destroy()
+	}
+}
+
+// meshContext creates mesh buffers that, when the device can ray trace,
+// acceleration structures can be built from and hit shaders can read, and
+// mesh shaders can read when mesh shading.
+func (app *HelloTriangleApplication) meshContext() gpu.Context {
+	ctx := app.gpuContext()
+	if app.rayTracing {
+		ctx.ExtraUsage = vk.BufferUsageFlags(raytracing.BufferUsageAccelerationStructureBuildInputReadOnlyBit|raytracing.BufferUsageShaderDeviceAddressBit) |
+			vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit)
+	}
+	if app.meshShading {
+		ctx.ExtraUsage |= vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit)
+	}
+	return ctx
+}
+
+// createIndexBuffer packs indices as 16 bit when every vertex is
+// addressable with them, halving the index buffer for small meshes.
+func createIndexBuffer(ctx gpu.Context, indices []uint32, vertexCount int) (*gpu.Buffer, vk.IndexType, error) {
+	if vertexCount <= 1<<16 {
+		// Padded to a whole number of uints, raytrace.rchit reads them
+		// two at a time
+		small := make([]uint16, len(indices)+len(indices)%2)
+		for i, index := range indices {
+			small[i] = uint16(index)
+		}
+		return gpu.NewIndexBuffer(ctx, small)
+	}
+	return gpu.NewIndexBuffer(ctx, indices)
+}
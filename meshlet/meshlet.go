@@ -0,0 +1,140 @@
+// Package meshlet splits indexed triangle meshes into meshlets, clusters of
+// a few dozen triangles over at most a few dozen vertices that a mesh
+// shader workgroup draws each, along with a bounding sphere per meshlet a
+// task shader can cull it by.
+package meshlet
+
+import "math"
+
+// Limits meshlets are built to by default, the ones NVIDIA recommends for
+// VK_EXT_mesh_shader. 124 triangles leaves room for the packed indices of a
+// meshlet to fit 128 byte cache lines.
+const (
+	MaxVertices  = 64
+	MaxTriangles = 124
+)
+
+// Meshlet is laid out to match the std430 Meshlet struct in meshlet.task
+// and meshlet.mesh.
+type Meshlet struct {
+	// VertexOffset is where the meshlet's VertexCount vertices start in
+	// Meshlets.Vertices.
+	VertexOffset uint32
+	VertexCount  uint32
+	// TriangleOffset is where the meshlet's TriangleCount triangles start in
+	// Meshlets.Triangles.
+	TriangleOffset uint32
+	TriangleCount  uint32
+	// Center and Radius bound the meshlet's vertices.
+	Center [3]float32
+	Radius float32
+}
+
+// Meshlets are a mesh's meshlets and the two arrays they index.
+type Meshlets struct {
+	Meshlets []Meshlet
+	// Vertices are indices into the mesh's vertices.
+	Vertices []uint32
+	// Triangles are three 8 bit indices into a meshlet's run of Vertices
+	// packed into the low 24 bits of each uint32, first in the lowest byte.
+	Triangles []uint32
+}
+
+// Append adds other's meshlets after ms's, offsetting them past ms's
+// vertices and triangles.
+func (ms *Meshlets) Append(other Meshlets) {
+	vertices, triangles := uint32(len(ms.Vertices)), uint32(len(ms.Triangles))
+	for _, m := range other.Meshlets {
+		m.VertexOffset += vertices
+		m.TriangleOffset += triangles
+		ms.Meshlets = append(ms.Meshlets, m)
+	}
+	ms.Vertices = append(ms.Vertices, other.Vertices...)
+	ms.Triangles = append(ms.Triangles, other.Triangles...)
+}
+
+// Build splits the triangles indices assembles into meshlets of at most
+// maxVertices vertices and maxTriangles triangles, taking triangles in
+// order so meshlets stay as local as the indices are. positions are the
+// mesh's vertex positions, indexed by indices. maxVertices can't be more
+// than 256.
+func Build(positions [][3]float32, indices []uint32, maxVertices, maxTriangles int) Meshlets {
+	var ms Meshlets
+	// local maps a mesh vertex to its index in the current meshlet
+	local := map[uint32]uint32{}
+	current := Meshlet{}
+
+	flush := func() {
+		if current.TriangleCount == 0 {
+			return
+		}
+		current.Center, current.Radius = bounds(positions, ms.Vertices[current.VertexOffset:])
+		ms.Meshlets = append(ms.Meshlets, current)
+		current = Meshlet{
+			VertexOffset:   uint32(len(ms.Vertices)),
+			TriangleOffset: uint32(len(ms.Triangles)),
+		}
+		for k := range local {
+			delete(local, k)
+		}
+	}
+
+	for t := 0; t+2 < len(indices); t += 3 {
+		tri := indices[t : t+3]
+		added := 0
+		for i, v := range tri {
+			if _, ok := local[v]; ok {
+				continue
+			}
+			// Corners of a degenerate triangle count once
+			if (i > 0 && tri[0] == v) || (i > 1 && tri[1] == v) {
+				continue
+			}
+			added++
+		}
+		if int(current.VertexCount)+added > maxVertices || int(current.TriangleCount) >= maxTriangles {
+			flush()
+		}
+
+		var packed uint32
+		for i, v := range tri {
+			index, ok := local[v]
+			if !ok {
+				index = current.VertexCount
+				local[v] = index
+				ms.Vertices = append(ms.Vertices, v)
+				current.VertexCount++
+			}
+			packed |= index << (8 * i)
+		}
+		ms.Triangles = append(ms.Triangles, packed)
+		current.TriangleCount++
+	}
+	flush()
+	return ms
+}
+
+// bounds is a sphere around the vertices, centred on their bounding box
+// which is close enough to the smallest for culling.
+func bounds(positions [][3]float32, vertices []uint32) ([3]float32, float32) {
+	lo := [3]float32{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+	hi := [3]float32{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+	for _, v := range vertices {
+		p := positions[v]
+		for i := range p {
+			lo[i] = float32(math.Min(float64(lo[i]), float64(p[i])))
+			hi[i] = float32(math.Max(float64(hi[i]), float64(p[i])))
+		}
+	}
+	center := [3]float32{(lo[0] + hi[0]) / 2, (lo[1] + hi[1]) / 2, (lo[2] + hi[2]) / 2}
+
+	var radius float32
+	for _, v := range vertices {
+		p := positions[v]
+		dx, dy, dz := p[0]-center[0], p[1]-center[1], p[2]-center[2]
+		if r := float32(math.Sqrt(float64(dx*dx + dy*dy + dz*dz))); r > radius {
+			radius = r
+		}
+	}
+	return center, radius
+}
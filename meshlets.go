@@ -0,0 +1,298 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/meshlet"
+	"github.com/delaneyj/learnvulkan/meshshader"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	defaultMeshShaderKey = glfw.KeyF8
+	// meshletSet is the descriptor set meshlet.task and meshlet.mesh read
+	// the mesh's meshlets and vertices from, after the material set.
+	meshletSet = 2
+	// meshletGroupSize is how many meshlets a meshlet.task workgroup culls.
+	meshletGroupSize = 32
+)
+
+// MeshletConstants is pushed once per mesh group, matching the
+// push_constant block in meshlet.task which follows DrawConstants and
+// MaterialConstants.
+type MeshletConstants struct {
+	First uint32
+	Count uint32
+}
+
+var meshletConstants = pipeline.NewPushConstants[MeshletConstants](
+	vk.ShaderStageFlags(meshshader.ShaderStageTaskBit), materialConstants.Offset+materialConstants.Size())
+
+func (app *HelloTriangleApplication) meshShaderKey() glfw.Key {
+	if app.MeshShaderKey == 0 {
+		return defaultMeshShaderKey
+	}
+	return app.MeshShaderKey
+}
+
+// createMeshlets splits each of the mesh's groups into meshlets and uploads
+// them with the buffers meshlet.mesh indexes through, when the device can
+// mesh shade. vertices and indices are what the mesh was created from.
+func (app *HelloTriangleApplication) createMeshlets(vertices []Vertex, indices []uint32) error {
+	if !app.meshShading {
+		if app.MeshShaders {
+			app.logger.Info("Drawing with the vertex pipeline", logging.F("reason", app.meshShadingUnavailable()))
+		}
+		return nil
+	}
+
+	ms, err := meshshader.Load(app.getInstanceProcAddr, app.instance, app.device)
+	if err != nil {
+		return err
+	}
+	app.meshShader = ms
+
+	positions := make([][3]float32, len(vertices))
+	for i, v := range vertices {
+		positions[i] = v.Pos
+	}
+	var all meshlet.Meshlets
+	for i := range app.mesh.Groups {
+		g := &app.mesh.Groups[i]
+		group := meshlet.Build(positions, indices[g.First:g.First+g.Count], meshlet.MaxVertices, meshlet.MaxTriangles)
+		g.FirstMeshlet = uint32(len(all.Meshlets))
+		g.MeshletCount = uint32(len(group.Meshlets))
+		all.Append(group)
+	}
+
+	ctx := app.gpuContext()
+	if app.meshlets, err = gpu.NewStorageBuffer(ctx, all.Meshlets); err != nil {
+		return errors.Wrap(err, "can't upload meshlets")
+	}
+	if app.meshletVertices, err = gpu.NewStorageBuffer(ctx, all.Vertices); err != nil {
+		return errors.Wrap(err, "can't upload meshlet vertices")
+	}
+	if app.meshletTriangles, err = gpu.NewStorageBuffer(ctx, all.Triangles); err != nil {
+		return errors.Wrap(err, "can't upload meshlet triangles")
+	}
+	app.name(app.meshlets.Handle, "meshlets")
+	app.name(app.meshletVertices.Handle, "meshlet vertices")
+	app.name(app.meshletTriangles.Handle, "meshlet triangles")
+
+	app.meshShaded = app.MeshShaders
+	app.logger.Info("Mesh shading available",
+		logging.F("meshlets", len(all.Meshlets)),
+		logging.F("triangles", len(all.Triangles)),
+		logging.F("enabled", app.meshShaded))
+	return nil
+}
+
+// meshShadingUnavailable is why MeshShaders can't be honoured.
+func (app *HelloTriangleApplication) meshShadingUnavailable() string {
+	if app.instanced() {
+		return "mesh shaders don't draw instances"
+	}
+	return "no device supports mesh shaders"
+}
+
+// reflectMeshletShaders reflects meshlet.task and meshlet.mesh when mesh
+// shading, nil otherwise. They share set 0 with the vertex shader and add
+// meshletSet.
+func (app *HelloTriangleApplication) reflectMeshletShaders() ([]*spirv.Module, error) {
+	if !app.meshShading {
+		return nil, nil
+	}
+	task, err := spirv.Reflect(app.shaderCode("meshlet.task", shaders.MeshletTask()))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't reflect task shader")
+	}
+	mesh, err := spirv.Reflect(app.shaderCode("meshlet.mesh", shaders.MeshletMesh()))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't reflect mesh shader")
+	}
+	if size := meshletConstants.Offset + meshletConstants.Size(); task.PushConstantSize != size {
+		return nil, errors.Errorf("task shader push constants end at %d bytes but MeshletConstants ends at %d", task.PushConstantSize, size)
+	}
+	return []*spirv.Module{task, mesh}, nil
+}
+
+// createMeshletPipeline creates the current window's meshlet pipeline, a
+// variant per polygon mode like the graphics pipeline, whose fragment shader
+// and state it shares with the task and mesh shaders in place of the vertex
+// input.
+func (app *HelloTriangleApplication) createMeshletPipeline(fragShaderModule vk.ShaderModule, info vk.GraphicsPipelineCreateInfo) error {
+	if !app.meshShading {
+		return nil
+	}
+
+	taskShaderModule, err := app.createShaderModule(app.shaderCode("meshlet.task", shaders.MeshletTask()))
+	if err != nil {
+		return errors.Wrap(err, "can't create task shader")
+	}
+	defer vk.DestroyShaderModule(app.device, taskShaderModule, nil)
+
+	meshShaderModule, err := app.createShaderModule(app.shaderCode("meshlet.mesh", shaders.MeshletMesh()))
+	if err != nil {
+		return errors.Wrap(err, "can't create mesh shader")
+	}
+	defer vk.DestroyShaderModule(app.device, meshShaderModule, nil)
+
+	shaderStages := []vk.PipelineShaderStageCreateInfo{
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  meshshader.ShaderStageTaskBit,
+			Module: taskShaderModule,
+			PName:  "main\x00",
+		},
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  meshshader.ShaderStageMeshBit,
+			Module: meshShaderModule,
+			PName:  "main\x00",
+		},
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageFragmentBit,
+			Module: fragShaderModule,
+			PName:  "main\x00",
+		},
+	}
+
+	layout, err := pipeline.NewLayout(
+		app.device,
+		[]vk.DescriptorSetLayout{app.descriptorSetLayout, app.materialSetLayout, app.meshletSetLayout},
+		[]vk.PushConstantRange{app.fragmentConstants(), meshletConstants.Range()},
+	)
+	if err != nil {
+		return err
+	}
+	app.meshletLayout = layout
+
+	modes := app.polygonModes()
+	pipelineInfos := make([]vk.GraphicsPipelineCreateInfo, len(modes))
+	for i, mode := range modes {
+		rasterization := *info.PRasterizationState
+		rasterization.PolygonMode = mode
+		pipelineInfos[i] = info
+		pipelineInfos[i].StageCount = uint32(len(shaderStages))
+		pipelineInfos[i].PStages = shaderStages
+		pipelineInfos[i].PVertexInputState = nil
+		pipelineInfos[i].PInputAssemblyState = nil
+		pipelineInfos[i].PRasterizationState = &rasterization
+		pipelineInfos[i].Layout = layout
+	}
+
+	pipelines := make([]vk.Pipeline, len(pipelineInfos))
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, uint32(len(pipelineInfos)), pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create meshlet pipelines")
+	}
+	for _, p := range pipelines {
+		app.track("pipeline", p)
+	}
+	app.meshletPipelines = pipelines
+
+	app.name(layout, "meshlet pipeline layout")
+	for i, p := range pipelines {
+		app.name(p, "meshlet pipeline (%s)", polygonModeNames[modes[i]])
+	}
+	return nil
+}
+
+// createMeshletSet points the current window's meshlet set at the meshlets
+// and the mesh's vertices.
+func (app *HelloTriangleApplication) createMeshletSet() error {
+	if !app.meshShading {
+		return nil
+	}
+
+	set, err := app.descriptorAllocator.Allocate(app.meshletSetLayout)
+	if err != nil {
+		return err
+	}
+	app.meshletSet = set
+
+	buffers := []*gpu.Buffer{app.meshlets, app.meshletVertices, app.meshletTriangles, app.mesh.Vertices}
+	writes := make([]vk.WriteDescriptorSet, len(buffers))
+	for i, b := range buffers {
+		writes[i] = vk.WriteDescriptorSet{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      uint32(i),
+			DescriptorType:  vk.DescriptorTypeStorageBuffer,
+			DescriptorCount: 1,
+			PBufferInfo: []vk.DescriptorBufferInfo{{
+				Buffer: b.Handle,
+				Offset: 0,
+				Range:  b.Size,
+			}},
+		}
+	}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+	return nil
+}
+
+// recordMeshlets draws the mesh's groups from first up to first+count for
+// every object in the camera's frustum with the meshlet pipeline, a task
+// shader workgroup per meshletGroupSize meshlets. Groups are drawn whole, by whichever call
+// their first index falls in.
+func (app *HelloTriangleApplication) recordMeshlets(cb vk.CommandBuffer, frame int, first, count uint32) {
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.meshletPipelines[app.polygonMode])
+	drawConstants.Push(cb, app.meshletLayout, app.currentDrawConstants())
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, app.meshletLayout, meshletSet,
+		1, []vk.DescriptorSet{app.meshletSet}, 0, nil)
+	app.bindMaterialTable(cb, app.meshletLayout)
+
+	uniforms := app.uniformBuffers[frame]
+	for i := range app.drawList.Draws {
+		if !app.visible[i] {
+			continue
+		}
+		vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, app.meshletLayout, 0,
+			1, []vk.DescriptorSet{app.descriptorSets[frame]},
+			1, []uint32{uniforms.Offset(i)})
+		for _, g := range app.mesh.Groups {
+			if g.First < first || g.First >= first+count || g.MeshletCount == 0 {
+				continue
+			}
+			app.bindMaterial(cb, app.meshletLayout, g.Material)
+			meshletConstants.Push(cb, app.meshletLayout, MeshletConstants{First: g.FirstMeshlet, Count: g.MeshletCount})
+			app.meshShader.CmdDrawMeshTasks(cb, (g.MeshletCount+meshletGroupSize-1)/meshletGroupSize, 1, 1)
+			app.countDraws(1)
+		}
+	}
+}
+
+// toggleMeshShading switches between drawing the mesh with the meshlet and
+// the vertex pipelines.
+func (app *HelloTriangleApplication) toggleMeshShading() {
+	if app.meshShader == nil {
+		app.logger.Info("Can't switch mesh shading", logging.F("reason", app.meshShadingUnavailable()))
+		return
+	}
+	app.meshShaded = !app.meshShaded
+	app.logger.Info("Switched mesh shading", logging.F("enabled", app.meshShaded))
+}
+
+func (app *HelloTriangleApplication) destroyMeshletPipeline() {
+	for _, p := range app.meshletPipelines {
+		app.destroyPipeline(p)
+	}
+	app.meshletPipelines = nil
+	if app.meshletLayout != vk.NullPipelineLayout {
+		app.destroyPipelineLayout(app.meshletLayout)
+		app.meshletLayout = vk.NullPipelineLayout
+	}
+}
+
+func (app *HelloTriangleApplication) destroyMeshlets() {
+	for _, b := range []*gpu.Buffer{app.meshlets, app.meshletVertices, app.meshletTriangles} {
+		if b != nil {
+			b.Destroy()
+		}
+	}
+}
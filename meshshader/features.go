@@ -0,0 +1,64 @@
+package meshshader
+
+import (
+	"runtime"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Extension is VK_EXT_mesh_shader's name.
+const Extension = "VK_EXT_mesh_shader"
+
+// Extensions are every device extension mesh shaders need, the rest for
+// the SPIR-V version task and mesh shaders are compiled to.
+var Extensions = []string{
+	Extension,
+	"VK_KHR_spirv_1_4",
+	"VK_KHR_shader_float_controls",
+}
+
+// structureTypeFeatures is VkPhysicalDeviceMeshShaderFeaturesEXT's type,
+// the bindings predate the extension.
+const structureTypeFeatures vk.StructureType = 1000328000
+
+// Features is laid out like VkPhysicalDeviceMeshShaderFeaturesEXT, to put
+// on vk.DeviceCreateInfo's PNext. It has to be kept alive until the device
+// is created.
+type Features struct {
+	sType                                  vk.StructureType
+	pNext                                  unsafe.Pointer
+	taskShader                             vk.Bool32
+	meshShader                             vk.Bool32
+	multiviewMeshShader                    vk.Bool32
+	primitiveFragmentShadingRateMeshShader vk.Bool32
+	meshShaderQueries                      vk.Bool32
+}
+
+// NewFeatures enables task and mesh shaders, chained in front of next.
+func NewFeatures(next unsafe.Pointer) *Features {
+	return &Features{
+		sType:      structureTypeFeatures,
+		pNext:      next,
+		taskShader: vk.True,
+		meshShader: vk.True,
+	}
+}
+
+// Pointer is the struct to chain.
+func (f *Features) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(f)
+}
+
+// Supported reports whether physicalDevice has task and mesh shaders. Its
+// extensions have to have been checked for Extensions first.
+func Supported(physicalDevice vk.PhysicalDevice) bool {
+	f := &Features{sType: structureTypeFeatures}
+	features := vk.PhysicalDeviceFeatures2{
+		SType: vk.StructureTypePhysicalDeviceFeatures2,
+		PNext: f.Pointer(),
+	}
+	vk.GetPhysicalDeviceFeatures2(physicalDevice, &features)
+	runtime.KeepAlive(f)
+	return f.taskShader.B() && f.meshShader.B()
+}
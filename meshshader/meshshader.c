@@ -0,0 +1,25 @@
+#include <stddef.h>
+
+#include "meshshader.h"
+
+typedef void (*PFN_vkVoidFunction)(void);
+typedef PFN_vkVoidFunction (*PFN_vkGetInstanceProcAddr)(VkInstance instance, const char* pName);
+typedef PFN_vkVoidFunction (*PFN_vkGetDeviceProcAddr)(VkDevice device, const char* pName);
+typedef void (*PFN_vkCmdDrawMeshTasksEXT)(VkCommandBuffer commandBuffer, uint32_t groupCountX, uint32_t groupCountY, uint32_t groupCountZ);
+
+VkResult loadMeshShaderFunctions(void* getInstanceProcAddr, VkInstance instance, VkDevice device, LVFunctions* fn) {
+	PFN_vkGetDeviceProcAddr getDeviceProcAddr = (PFN_vkGetDeviceProcAddr)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(instance, "vkGetDeviceProcAddr");
+	if (getDeviceProcAddr == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+
+	fn->cmdDrawMeshTasks = (void*)getDeviceProcAddr(device, "vkCmdDrawMeshTasksEXT");
+	if (fn->cmdDrawMeshTasks == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+	return 0;
+}
+
+void cmdDrawMeshTasks(const LVFunctions* fn, VkCommandBuffer cb, uint32_t x, uint32_t y, uint32_t z) {
+	((PFN_vkCmdDrawMeshTasksEXT)fn->cmdDrawMeshTasks)(cb, x, y, z);
+}
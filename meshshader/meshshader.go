@@ -0,0 +1,48 @@
+// Package meshshader implements the parts of VK_EXT_mesh_shader the
+// renderer uses, which vulkan-go doesn't bind. Like raytracing, entry
+// points are loaded through vkGetDeviceProcAddr so the only C dependency is
+// meshshader.h.
+package meshshader
+
+/*
+#include "meshshader.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Flags the bindings predate.
+const (
+	ShaderStageTaskBit vk.ShaderStageFlagBits = 0x00000040
+	ShaderStageMeshBit vk.ShaderStageFlagBits = 0x00000080
+)
+
+// Device is a logical device's mesh shader entry points.
+type Device struct {
+	fn C.LVFunctions
+}
+
+// Load loads device's entry points, it has to have been created with
+// Extensions and the Features enabled.
+func Load(getInstanceProcAddr unsafe.Pointer, instance vk.Instance, device vk.Device) (*Device, error) {
+	if getInstanceProcAddr == nil {
+		return nil, errors.New("vkGetInstanceProcAddr is nil")
+	}
+	d := &Device{}
+	result := C.loadMeshShaderFunctions(getInstanceProcAddr, C.VkInstance(unsafe.Pointer(instance)), C.VkDevice(unsafe.Pointer(device)), &d.fn)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return nil, errors.Wrap(err, "can't load mesh shader functions")
+	}
+	return d, nil
+}
+
+// CmdDrawMeshTasks launches x by y by z task shader workgroups, or mesh
+// shader workgroups when the pipeline has no task shader.
+func (d *Device) CmdDrawMeshTasks(cb vk.CommandBuffer, x, y, z uint32) {
+	C.cmdDrawMeshTasks(&d.fn, C.VkCommandBuffer(unsafe.Pointer(cb)), C.uint32_t(x), C.uint32_t(y), C.uint32_t(z))
+}
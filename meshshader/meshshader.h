@@ -0,0 +1,24 @@
+// The subset of VK_EXT_mesh_shader the package needs, declared here so it
+// builds without the Vulkan headers. Layouts follow vulkan_core.h.
+#ifndef LEARNVULKAN_MESHSHADER_H
+#define LEARNVULKAN_MESHSHADER_H
+
+#include <stdint.h>
+
+typedef struct VkInstance_T* VkInstance;
+typedef struct VkDevice_T* VkDevice;
+typedef struct VkCommandBuffer_T* VkCommandBuffer;
+typedef int32_t VkResult;
+
+#define LV_ERROR_EXTENSION_NOT_PRESENT -7
+
+// LVFunctions are the device's extension entry points.
+typedef struct LVFunctions {
+	void* cmdDrawMeshTasks;
+} LVFunctions;
+
+VkResult loadMeshShaderFunctions(void* getInstanceProcAddr, VkInstance instance, VkDevice device, LVFunctions* fn);
+
+void cmdDrawMeshTasks(const LVFunctions* fn, VkCommandBuffer cb, uint32_t x, uint32_t y, uint32_t z);
+
+#endif
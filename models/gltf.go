@@ -0,0 +1,1138 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/animation"
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+)
+
+// PBRMaterial is a glTF metallic-roughness material. Textures are nil when
+// the material doesn't have them, the factors alone apply then.
+type PBRMaterial struct {
+	Name            string
+	BaseColorFactor [4]float32
+	MetallicFactor  float32
+	RoughnessFactor float32
+	EmissiveFactor  [3]float32
+	// NormalScale scales the normal texture's X and Y, OcclusionStrength
+	// blends from no occlusion to the occlusion texture's.
+	NormalScale       float32
+	OcclusionStrength float32
+	// DoubleSided draws the back faces too, rather than culling them.
+	DoubleSided bool
+
+	BaseColorTexture         *Image
+	MetallicRoughnessTexture *Image
+	NormalTexture            *Image
+	OcclusionTexture         *Image
+	EmissiveTexture          *Image
+}
+
+// DefaultPBRMaterial is the material glTF primitives without one use.
+func DefaultPBRMaterial() *PBRMaterial {
+	return &PBRMaterial{
+		BaseColorFactor:   [4]float32{1, 1, 1, 1},
+		MetallicFactor:    1,
+		RoughnessFactor:   1,
+		NormalScale:       1,
+		OcclusionStrength: 1,
+	}
+}
+
+// Morph is a run of a model's vertices that blend between morph targets.
+type Morph struct {
+	// Node is the glTF node whose Weights in Model.Skeleton blend the
+	// targets.
+	Node        int
+	FirstVertex uint32
+	VertexCount uint32
+	Targets     []MorphTarget
+}
+
+// MorphTarget is how far a morph target moves each of a Morph's vertices at
+// a weight of one.
+type MorphTarget struct {
+	Positions [][3]float32
+	// Normals and Tangents are nil when the target doesn't change them.
+	Normals  [][3]float32
+	Tangents [][3]float32
+}
+
+// Image is a material's texture image, either a file at Path or PNG or
+// JPEG Data embedded in the model. Materials sharing an image share the
+// pointer.
+type Image struct {
+	Path string
+	Data []byte
+}
+
+// glb container constants, all little endian.
+const (
+	glbMagic     = 0x46546c67 // "glTF"
+	glbVersion   = 2
+	glbChunkJSON = 0x4e4f534a // "JSON"
+	glbChunkBIN  = 0x004e4942 // "BIN\x00"
+)
+
+// glTF accessor component types.
+const (
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+)
+
+// gltfTriangles is the only primitive mode loaded.
+const gltfTriangles = 4
+
+var gltfComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT4":   16,
+}
+
+var gltfPaths = map[string]animation.Path{
+	"translation": animation.Translation,
+	"rotation":    animation.Rotation,
+	"scale":       animation.Scale,
+	"weights":     animation.Weights,
+}
+
+var gltfInterpolations = map[string]animation.Interpolation{
+	"":            animation.Linear,
+	"LINEAR":      animation.Linear,
+	"STEP":        animation.Step,
+	"CUBICSPLINE": animation.CubicSpline,
+}
+
+type gltfDocument struct {
+	Scene  *int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []struct {
+		Name        string      `json:"name"`
+		Mesh        *int        `json:"mesh"`
+		Skin        *int        `json:"skin"`
+		Children    []int       `json:"children"`
+		Matrix      *vmath.Mat4 `json:"matrix"`
+		Translation *vmath.Vec3 `json:"translation"`
+		Rotation    *vmath.Vec4 `json:"rotation"`
+		Scale       *vmath.Vec3 `json:"scale"`
+		Weights     []float32   `json:"weights"`
+	} `json:"nodes"`
+	Meshes []struct {
+		Name       string `json:"name"`
+		Primitives []struct {
+			Attributes map[string]int   `json:"attributes"`
+			Indices    *int             `json:"indices"`
+			Material   *int             `json:"material"`
+			Mode       *int             `json:"mode"`
+			Targets    []map[string]int `json:"targets"`
+		} `json:"primitives"`
+		Weights []float32 `json:"weights"`
+	} `json:"meshes"`
+	Accessors []struct {
+		BufferView    *int            `json:"bufferView"`
+		ByteOffset    int             `json:"byteOffset"`
+		ComponentType int             `json:"componentType"`
+		Normalized    bool            `json:"normalized"`
+		Count         int             `json:"count"`
+		Type          string          `json:"type"`
+		Sparse        json.RawMessage `json:"sparse"`
+	} `json:"accessors"`
+	BufferViews []struct {
+		Buffer     int `json:"buffer"`
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+		ByteStride int `json:"byteStride"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		URI        string `json:"uri"`
+		ByteLength int    `json:"byteLength"`
+	} `json:"buffers"`
+	Materials []struct {
+		Name                 string `json:"name"`
+		PBRMetallicRoughness *struct {
+			BaseColorFactor          *[4]float32      `json:"baseColorFactor"`
+			BaseColorTexture         *gltfTextureInfo `json:"baseColorTexture"`
+			MetallicFactor           *float32         `json:"metallicFactor"`
+			RoughnessFactor          *float32         `json:"roughnessFactor"`
+			MetallicRoughnessTexture *gltfTextureInfo `json:"metallicRoughnessTexture"`
+		} `json:"pbrMetallicRoughness"`
+		NormalTexture    *gltfTextureInfo `json:"normalTexture"`
+		OcclusionTexture *gltfTextureInfo `json:"occlusionTexture"`
+		EmissiveTexture  *gltfTextureInfo `json:"emissiveTexture"`
+		EmissiveFactor   [3]float32       `json:"emissiveFactor"`
+		DoubleSided      bool             `json:"doubleSided"`
+	} `json:"materials"`
+	Textures []struct {
+		Source *int `json:"source"`
+	} `json:"textures"`
+	Images []struct {
+		URI        string `json:"uri"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	Skins []struct {
+		InverseBindMatrices *int  `json:"inverseBindMatrices"`
+		Joints              []int `json:"joints"`
+	} `json:"skins"`
+	Animations []struct {
+		Name     string `json:"name"`
+		Channels []struct {
+			Sampler int `json:"sampler"`
+			Target  struct {
+				Node *int   `json:"node"`
+				Path string `json:"path"`
+			} `json:"target"`
+		} `json:"channels"`
+		Samplers []struct {
+			Input         int    `json:"input"`
+			Output        int    `json:"output"`
+			Interpolation string `json:"interpolation"`
+		} `json:"samplers"`
+	} `json:"animations"`
+}
+
+// gltfTextureInfo is a material's reference to a texture, Scale and
+// Strength only apply to normal and occlusion textures.
+type gltfTextureInfo struct {
+	Index    int      `json:"index"`
+	TexCoord int      `json:"texCoord"`
+	Scale    *float32 `json:"scale"`
+	Strength *float32 `json:"strength"`
+}
+
+type gltfLoader struct {
+	doc     gltfDocument
+	dir     string
+	buffers [][]byte
+	images  []*Image
+	model   *Model
+	// skinJoints is where each skin's joints start in the skeleton's.
+	skinJoints []int
+}
+
+// LoadGLTF reads a glTF 2.0 .gltf file, with its buffers and images in
+// separate files or data URIs, or a binary .glb. The default scene's mesh
+// nodes are flattened into the model with their transforms applied, in
+// glTF's Y up coordinates. Groups are named after the primitive's
+// material, which Model.PBRMaterials holds. Skinned meshes are left in
+// their bind pose for the joints of Model.Skeleton to move, morph targets
+// are in Model.Morphs, and Model.Clips animate both.
+func LoadGLTF(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read model '%s'", path)
+	}
+
+	l := &gltfLoader{dir: filepath.Dir(path)}
+	var bin []byte
+	if strings.EqualFold(filepath.Ext(path), ".glb") {
+		if data, bin, err = splitGLB(data); err != nil {
+			return nil, errors.Wrapf(err, "can't read binary glTF '%s'", path)
+		}
+	}
+	if err := json.Unmarshal(data, &l.doc); err != nil {
+		return nil, errors.Wrapf(err, "can't parse glTF '%s'", path)
+	}
+
+	if err := l.load(bin); err != nil {
+		return nil, errors.Wrapf(err, "can't load glTF '%s'", path)
+	}
+	return l.model, nil
+}
+
+// splitGLB returns the JSON and binary chunks of a .glb file.
+func splitGLB(data []byte) (doc, bin []byte, err error) {
+	r := bytes.NewReader(data)
+	var header struct {
+		Magic, Version, Length uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, nil, errors.Wrap(err, "can't read header")
+	}
+	if header.Magic != glbMagic || header.Version != glbVersion {
+		return nil, nil, errors.New("not a version 2 binary glTF")
+	}
+
+	for {
+		var chunk struct {
+			Length, Type uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, errors.Wrap(err, "can't read chunk header")
+		}
+		body := make([]byte, chunk.Length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, nil, errors.Wrap(err, "can't read chunk")
+		}
+		switch chunk.Type {
+		case glbChunkJSON:
+			doc = body
+		case glbChunkBIN:
+			bin = body
+		}
+	}
+	if doc == nil {
+		return nil, nil, errors.New("no JSON chunk")
+	}
+	return doc, bin, nil
+}
+
+func (l *gltfLoader) load(bin []byte) error {
+	l.buffers = make([][]byte, len(l.doc.Buffers))
+	for i, b := range l.doc.Buffers {
+		var data []byte
+		var err error
+		if b.URI == "" {
+			// The first buffer of a .glb without a uri is its binary chunk
+			if i != 0 || bin == nil {
+				return errors.Errorf("buffer %d has no data", i)
+			}
+			data = bin
+		} else if data, err = l.readURI(b.URI); err != nil {
+			return errors.Wrapf(err, "can't read buffer %d", i)
+		}
+		if len(data) < b.ByteLength {
+			return errors.Errorf("buffer %d is %d bytes, expected %d", i, len(data), b.ByteLength)
+		}
+		l.buffers[i] = data
+	}
+
+	l.images = make([]*Image, len(l.doc.Images))
+	for i, img := range l.doc.Images {
+		switch {
+		case img.BufferView != nil:
+			data, _, err := l.bufferView(*img.BufferView)
+			if err != nil {
+				return errors.Wrapf(err, "can't read image %d", i)
+			}
+			l.images[i] = &Image{Data: data}
+		case strings.HasPrefix(img.URI, "data:"):
+			data, err := l.readURI(img.URI)
+			if err != nil {
+				return errors.Wrapf(err, "can't read image %d", i)
+			}
+			l.images[i] = &Image{Data: data}
+		default:
+			l.images[i] = &Image{Path: filepath.Join(l.dir, filepath.FromSlash(img.URI))}
+		}
+	}
+
+	l.model = &Model{PBRMaterials: map[string]*PBRMaterial{}}
+	if err := l.loadMaterials(); err != nil {
+		return err
+	}
+	if err := l.loadSkeleton(); err != nil {
+		return err
+	}
+
+	roots, err := l.sceneRoots()
+	if err != nil {
+		return err
+	}
+	for _, node := range roots {
+		if err := l.loadNode(node, vmath.Ident4(), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readURI reads a base64 data URI or a file relative to the glTF file.
+func (l *gltfLoader) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		comma := strings.IndexByte(uri, ',')
+		if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+			return nil, errors.New("only base64 data URIs are supported")
+		}
+		return base64.StdEncoding.DecodeString(uri[comma+1:])
+	}
+	return os.ReadFile(filepath.Join(l.dir, filepath.FromSlash(uri)))
+}
+
+// sceneRoots are the default scene's root nodes, or every node that isn't
+// a child when there are no scenes.
+func (l *gltfLoader) sceneRoots() ([]int, error) {
+	if len(l.doc.Scenes) > 0 {
+		scene := 0
+		if l.doc.Scene != nil {
+			scene = *l.doc.Scene
+		}
+		if scene < 0 || scene >= len(l.doc.Scenes) {
+			return nil, errors.Errorf("scene %d out of range", scene)
+		}
+		return l.doc.Scenes[scene].Nodes, nil
+	}
+
+	child := make([]bool, len(l.doc.Nodes))
+	for _, n := range l.doc.Nodes {
+		for _, c := range n.Children {
+			if c >= 0 && c < len(child) {
+				child[c] = true
+			}
+		}
+	}
+	var roots []int
+	for i, isChild := range child {
+		if !isChild {
+			roots = append(roots, i)
+		}
+	}
+	return roots, nil
+}
+
+func (l *gltfLoader) loadMaterials() error {
+	def := DefaultPBRMaterial()
+	def.Name = "default"
+	l.model.PBRMaterials[""] = def
+	for i, m := range l.doc.Materials {
+		material := DefaultPBRMaterial()
+		material.Name = m.Name
+		material.EmissiveFactor = m.EmissiveFactor
+		material.DoubleSided = m.DoubleSided
+
+		var err error
+		texture := func(info *gltfTextureInfo) *Image {
+			if info == nil || err != nil {
+				return nil
+			}
+			var img *Image
+			img, err = l.texture(info)
+			return img
+		}
+		if pbr := m.PBRMetallicRoughness; pbr != nil {
+			if pbr.BaseColorFactor != nil {
+				material.BaseColorFactor = *pbr.BaseColorFactor
+			}
+			if pbr.MetallicFactor != nil {
+				material.MetallicFactor = *pbr.MetallicFactor
+			}
+			if pbr.RoughnessFactor != nil {
+				material.RoughnessFactor = *pbr.RoughnessFactor
+			}
+			material.BaseColorTexture = texture(pbr.BaseColorTexture)
+			material.MetallicRoughnessTexture = texture(pbr.MetallicRoughnessTexture)
+		}
+		material.NormalTexture = texture(m.NormalTexture)
+		if m.NormalTexture != nil && m.NormalTexture.Scale != nil {
+			material.NormalScale = *m.NormalTexture.Scale
+		}
+		material.OcclusionTexture = texture(m.OcclusionTexture)
+		if m.OcclusionTexture != nil && m.OcclusionTexture.Strength != nil {
+			material.OcclusionStrength = *m.OcclusionTexture.Strength
+		}
+		material.EmissiveTexture = texture(m.EmissiveTexture)
+		if err != nil {
+			return errors.Wrapf(err, "bad material %d", i)
+		}
+
+		l.model.PBRMaterials[gltfMaterialName(i)] = material
+	}
+	return nil
+}
+
+// gltfMaterialName keys material i in Model.PBRMaterials, glTF's own names
+// are optional and needn't be unique.
+func gltfMaterialName(i int) string {
+	return fmt.Sprintf("material %d", i)
+}
+
+func (l *gltfLoader) texture(info *gltfTextureInfo) (*Image, error) {
+	if info.TexCoord != 0 {
+		return nil, errors.Errorf("texture coordinate set %d isn't supported", info.TexCoord)
+	}
+	if info.Index < 0 || info.Index >= len(l.doc.Textures) {
+		return nil, errors.Errorf("texture %d out of range", info.Index)
+	}
+	source := l.doc.Textures[info.Index].Source
+	if source == nil {
+		return nil, errors.Errorf("texture %d has no image", info.Index)
+	}
+	if *source < 0 || *source >= len(l.images) {
+		return nil, errors.Errorf("image %d out of range", *source)
+	}
+	return l.images[*source], nil
+}
+
+// loadNode adds node's mesh, if it has one, transformed by its world
+// matrix and then does the same for its children. depth guards against
+// cycles.
+func (l *gltfLoader) loadNode(index int, parent vmath.Mat4, depth int) error {
+	if index < 0 || index >= len(l.doc.Nodes) {
+		return errors.Errorf("node %d out of range", index)
+	}
+	if depth > len(l.doc.Nodes) {
+		return errors.New("node hierarchy has a cycle")
+	}
+	node := l.doc.Nodes[index]
+
+	world := parent.Mul(l.nodeTransform(index).Matrix())
+
+	if node.Mesh != nil {
+		skin := -1
+		if node.Skin != nil {
+			skin = *node.Skin
+		}
+		if err := l.loadMesh(*node.Mesh, index, world, skin); err != nil {
+			return errors.Wrapf(err, "can't load node %d", index)
+		}
+	}
+	for _, child := range node.Children {
+		if err := l.loadNode(child, world, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMesh adds mesh index drawn by node placed by world, or when skin
+// isn't -1 in its bind pose with its vertices weighted to the skin's
+// joints.
+func (l *gltfLoader) loadMesh(index, node int, world vmath.Mat4, skin int) error {
+	if index < 0 || index >= len(l.doc.Meshes) {
+		return errors.Errorf("mesh %d out of range", index)
+	}
+	if skin >= len(l.skinJoints) {
+		return errors.Errorf("skin %d out of range", skin)
+	}
+	mesh := l.doc.Meshes[index]
+	// Skinned meshes are placed by their joints alone
+	if skin >= 0 {
+		world = vmath.Ident4()
+	}
+	// Normals need the inverse transpose to stay perpendicular under
+	// non-uniform scale
+	normalMatrix := world.Inverse().Transpose()
+
+	for p, prim := range mesh.Primitives {
+		if prim.Mode != nil && *prim.Mode != gltfTriangles {
+			return errors.Errorf("mesh %d primitive %d has mode %d, only triangles are supported", index, p, *prim.Mode)
+		}
+		positionAccessor, ok := prim.Attributes["POSITION"]
+		if !ok {
+			return errors.Errorf("mesh %d primitive %d has no positions", index, p)
+		}
+		positions, err := l.floats(positionAccessor, 3)
+		if err != nil {
+			return errors.Wrapf(err, "bad positions in mesh %d primitive %d", index, p)
+		}
+		count := len(positions) / 3
+
+		attribute := func(name string, components int) ([]float32, error) {
+			accessor, ok := prim.Attributes[name]
+			if !ok {
+				return nil, nil
+			}
+			values, err := l.floats(accessor, components)
+			if err != nil {
+				return nil, errors.Wrapf(err, "bad %s in mesh %d primitive %d", name, index, p)
+			}
+			if len(values) != count*components {
+				return nil, errors.Errorf("mesh %d primitive %d has %d %s for %d positions", index, p, len(values)/components, name, count)
+			}
+			return values, nil
+		}
+		normals, err := attribute("NORMAL", 3)
+		if err != nil {
+			return err
+		}
+		tangents, err := attribute("TANGENT", 4)
+		if err != nil {
+			return err
+		}
+		texCoords, err := attribute("TEXCOORD_0", 2)
+		if err != nil {
+			return err
+		}
+		colors, colorComponents, err := l.colors(prim.Attributes, count)
+		if err != nil {
+			return errors.Wrapf(err, "bad colors in mesh %d primitive %d", index, p)
+		}
+		targets, err := l.morphTargets(prim.Targets, count, world, normalMatrix)
+		if err != nil {
+			return errors.Wrapf(err, "bad morph targets in mesh %d primitive %d", index, p)
+		}
+		if targets != nil && len(targets) != len(l.model.Skeleton.Nodes[node].Weights) {
+			return errors.Errorf("mesh %d primitive %d has %d morph targets, expected %d", index, p, len(targets), len(l.model.Skeleton.Nodes[node].Weights))
+		}
+		var joints []uint32
+		var weights []float32
+		if skin >= 0 {
+			if joints, weights, err = l.skinWeights(prim.Attributes, count, skin); err != nil {
+				return errors.Wrapf(err, "bad skin weights in mesh %d primitive %d", index, p)
+			}
+		}
+
+		base := uint32(len(l.model.Vertices))
+		vertices := make([]Vertex, count)
+		for i := range vertices {
+			v := &vertices[i]
+			pos := world.MulVec4(vmath.Vec4{positions[i*3], positions[i*3+1], positions[i*3+2], 1})
+			v.Position = [3]float32{pos[0], pos[1], pos[2]}
+			v.Color = [3]float32{1, 1, 1}
+			if normals != nil {
+				n := normalMatrix.MulVec4(vmath.Vec4{normals[i*3], normals[i*3+1], normals[i*3+2], 0}).Vec3().Normalize()
+				v.Normal = n
+			}
+			if tangents != nil {
+				t := world.MulVec4(vmath.Vec4{tangents[i*4], tangents[i*4+1], tangents[i*4+2], 0}).Vec3().Normalize()
+				v.Tangent = [4]float32{t[0], t[1], t[2], tangents[i*4+3]}
+			}
+			if texCoords != nil {
+				v.TexCoord = [2]float32{texCoords[i*2], texCoords[i*2+1]}
+			}
+			if colors != nil {
+				copy(v.Color[:], colors[i*colorComponents:i*colorComponents+3])
+			}
+			if joints != nil {
+				copy(v.Joints[:], joints[i*4:i*4+4])
+				copy(v.Weights[:], weights[i*4:i*4+4])
+			}
+		}
+
+		var indices []uint32
+		if prim.Indices != nil {
+			if indices, err = l.indices(*prim.Indices, count); err != nil {
+				return errors.Wrapf(err, "bad indices in mesh %d primitive %d", index, p)
+			}
+		} else {
+			indices = make([]uint32, count)
+			for i := range indices {
+				indices[i] = uint32(i)
+			}
+		}
+		if len(indices)%3 != 0 {
+			return errors.Errorf("mesh %d primitive %d has %d indices, not whole triangles", index, p, len(indices))
+		}
+
+		if normals == nil {
+			GenerateNormals(vertices, indices)
+		}
+		if tangents == nil {
+			GenerateTangents(vertices, indices)
+		}
+
+		material := ""
+		if prim.Material != nil {
+			if *prim.Material < 0 || *prim.Material >= len(l.doc.Materials) {
+				return errors.Errorf("mesh %d primitive %d material %d out of range", index, p, *prim.Material)
+			}
+			material = gltfMaterialName(*prim.Material)
+		}
+		l.model.Groups = append(l.model.Groups, Group{
+			Name:        mesh.Name,
+			Material:    material,
+			IndexOffset: uint32(len(l.model.Indices)),
+			IndexCount:  uint32(len(indices)),
+		})
+		if targets != nil {
+			l.model.Morphs = append(l.model.Morphs, Morph{
+				Node:        node,
+				FirstVertex: base,
+				VertexCount: uint32(count),
+				Targets:     targets,
+			})
+		}
+		l.model.Vertices = append(l.model.Vertices, vertices...)
+		for _, i := range indices {
+			l.model.Indices = append(l.model.Indices, base+i)
+		}
+	}
+	return nil
+}
+
+// nodeTransform is node index's transform, decomposing its matrix if it
+// has one.
+func (l *gltfLoader) nodeTransform(index int) scene.Transform {
+	node := l.doc.Nodes[index]
+	if node.Matrix != nil {
+		return decompose(*node.Matrix)
+	}
+	t := scene.Identity()
+	if node.Translation != nil {
+		t.Translation = *node.Translation
+	}
+	if node.Rotation != nil {
+		t.Rotation = *node.Rotation
+	}
+	if node.Scale != nil {
+		t.Scale = *node.Scale
+	}
+	return t
+}
+
+// decompose splits an affine matrix without shear into a transform.
+func decompose(m vmath.Mat4) scene.Transform {
+	t := scene.Identity()
+	t.Translation = vmath.Vec3{m[12], m[13], m[14]}
+	var axes [3]vmath.Vec3
+	for c := range axes {
+		axes[c] = vmath.Vec3{m[c*4], m[c*4+1], m[c*4+2]}
+		t.Scale[c] = axes[c].Len()
+		if t.Scale[c] != 0 {
+			axes[c] = axes[c].Mul(1 / t.Scale[c])
+		}
+	}
+	// A mirroring matrix flips one axis' scale to leave a rotation
+	if axes[0].Cross(axes[1]).Dot(axes[2]) < 0 {
+		t.Scale[0], axes[0] = -t.Scale[0], axes[0].Mul(-1)
+	}
+
+	// The quaternion from the rotation matrix's largest diagonal term,
+	// which keeps the division well away from zero
+	r := func(row, col int) float32 { return axes[col][row] }
+	var q vmath.Vec4
+	switch trace := r(0, 0) + r(1, 1) + r(2, 2); {
+	case trace > 0:
+		s := float32(math.Sqrt(float64(trace+1))) * 2
+		q = vmath.Vec4{(r(2, 1) - r(1, 2)) / s, (r(0, 2) - r(2, 0)) / s, (r(1, 0) - r(0, 1)) / s, s / 4}
+	case r(0, 0) > r(1, 1) && r(0, 0) > r(2, 2):
+		s := float32(math.Sqrt(float64(1+r(0, 0)-r(1, 1)-r(2, 2)))) * 2
+		q = vmath.Vec4{s / 4, (r(0, 1) + r(1, 0)) / s, (r(0, 2) + r(2, 0)) / s, (r(2, 1) - r(1, 2)) / s}
+	case r(1, 1) > r(2, 2):
+		s := float32(math.Sqrt(float64(1+r(1, 1)-r(0, 0)-r(2, 2)))) * 2
+		q = vmath.Vec4{(r(0, 1) + r(1, 0)) / s, s / 4, (r(1, 2) + r(2, 1)) / s, (r(0, 2) - r(2, 0)) / s}
+	default:
+		s := float32(math.Sqrt(float64(1+r(2, 2)-r(0, 0)-r(1, 1)))) * 2
+		q = vmath.Vec4{(r(0, 2) + r(2, 0)) / s, (r(1, 2) + r(2, 1)) / s, s / 4, (r(1, 0) - r(0, 1)) / s}
+	}
+	t.Rotation = q
+	return t
+}
+
+// loadSkeleton makes every node a skeleton node and every skin's joints
+// skeleton joints, one skin's after another, then loads the animations.
+// Models without skins, morph targets or animations have no skeleton.
+func (l *gltfLoader) loadSkeleton() error {
+	if len(l.doc.Skins) == 0 && len(l.doc.Animations) == 0 && !l.hasMorphTargets() {
+		return nil
+	}
+	nodes := make([]animation.Node, len(l.doc.Nodes))
+	for i := range nodes {
+		weights, err := l.morphWeights(i)
+		if err != nil {
+			return errors.Wrapf(err, "bad morph target weights in node %d", i)
+		}
+		nodes[i] = animation.Node{Name: l.doc.Nodes[i].Name, Parent: -1, Rest: l.nodeTransform(i), Weights: weights}
+	}
+	for i, node := range l.doc.Nodes {
+		for _, child := range node.Children {
+			if child < 0 || child >= len(nodes) {
+				return errors.Errorf("node %d's child %d out of range", i, child)
+			}
+			if nodes[child].Parent != -1 {
+				return errors.Errorf("node %d has two parents", child)
+			}
+			nodes[child].Parent = i
+		}
+	}
+
+	var joints []animation.Joint
+	for i, skin := range l.doc.Skins {
+		l.skinJoints = append(l.skinJoints, len(joints))
+		inverseBinds := make([]float32, len(skin.Joints)*16)
+		if skin.InverseBindMatrices != nil {
+			values, err := l.floats(*skin.InverseBindMatrices, 16)
+			if err != nil {
+				return errors.Wrapf(err, "bad inverse bind matrices in skin %d", i)
+			}
+			if len(values) != len(inverseBinds) {
+				return errors.Errorf("skin %d has %d inverse bind matrices for %d joints", i, len(values)/16, len(skin.Joints))
+			}
+			copy(inverseBinds, values)
+		}
+		for j, node := range skin.Joints {
+			joint := animation.Joint{Node: node, InverseBind: vmath.Ident4()}
+			if skin.InverseBindMatrices != nil {
+				copy(joint.InverseBind[:], inverseBinds[j*16:])
+			}
+			joints = append(joints, joint)
+		}
+	}
+
+	skeleton, err := animation.NewSkeleton(nodes, joints)
+	if err != nil {
+		return errors.Wrap(err, "bad skeleton")
+	}
+	l.model.Skeleton = skeleton
+	return l.loadAnimations()
+}
+
+// loadAnimations makes each animation a clip of the skeleton, skipping
+// the channels of paths that aren't loaded.
+func (l *gltfLoader) loadAnimations() error {
+	for i, a := range l.doc.Animations {
+		clip := &animation.Clip{Name: a.Name}
+		if clip.Name == "" {
+			clip.Name = fmt.Sprintf("animation %d", i)
+		}
+		for c, ch := range a.Channels {
+			path, ok := gltfPaths[ch.Target.Path]
+			if !ok || ch.Target.Node == nil {
+				continue
+			}
+			if *ch.Target.Node < 0 || *ch.Target.Node >= len(l.doc.Nodes) {
+				return errors.Errorf("animation %d channel %d node %d out of range", i, c, *ch.Target.Node)
+			}
+			if ch.Sampler < 0 || ch.Sampler >= len(a.Samplers) {
+				return errors.Errorf("animation %d channel %d sampler %d out of range", i, c, ch.Sampler)
+			}
+			sampler := a.Samplers[ch.Sampler]
+			interpolation, ok := gltfInterpolations[sampler.Interpolation]
+			if !ok {
+				return errors.Errorf("animation %d sampler %d has unknown interpolation %s", i, ch.Sampler, sampler.Interpolation)
+			}
+
+			channel := animation.Channel{Node: *ch.Target.Node, Path: path, Interpolation: interpolation}
+			times, err := l.floats(sampler.Input, 1)
+			if err != nil {
+				return errors.Wrapf(err, "bad times in animation %d sampler %d", i, ch.Sampler)
+			}
+			// components is the floats a keyframe's value is, accessor's
+			// the floats an element of the output is. Weights are
+			// scalars, however many targets there are.
+			components, accessor := 3, 3
+			switch path {
+			case animation.Rotation:
+				components, accessor = 4, 4
+			case animation.Weights:
+				components, accessor = len(l.model.Skeleton.Nodes[channel.Node].Weights), 1
+				if components == 0 {
+					return errors.Errorf("animation %d channel %d animates the weights of node %d without morph targets", i, c, channel.Node)
+				}
+			}
+			values, err := l.floats(sampler.Output, accessor)
+			if err != nil {
+				return errors.Wrapf(err, "bad values in animation %d sampler %d", i, ch.Sampler)
+			}
+			perKey := components
+			if interpolation == animation.CubicSpline {
+				perKey *= 3
+			}
+			if len(values) != len(times)*perKey {
+				return errors.Errorf("animation %d sampler %d has %d values for %d times", i, ch.Sampler, len(values)/perKey, len(times))
+			}
+			channel.Times, channel.Values = times, values
+			if len(times) > 0 && times[len(times)-1] > clip.Duration {
+				clip.Duration = times[len(times)-1]
+			}
+			clip.Channels = append(clip.Channels, channel)
+		}
+		l.model.Clips = append(l.model.Clips, clip)
+	}
+	return nil
+}
+
+// hasMorphTargets is whether any mesh has morph targets.
+func (l *gltfLoader) hasMorphTargets() bool {
+	for _, m := range l.doc.Meshes {
+		for _, p := range m.Primitives {
+			if len(p.Targets) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// morphWeights are node's default morph target weights, its own or else its
+// mesh's or else zeros, nil when its mesh has no morph targets.
+func (l *gltfLoader) morphWeights(node int) ([]float32, error) {
+	n := l.doc.Nodes[node]
+	if n.Mesh == nil || *n.Mesh < 0 || *n.Mesh >= len(l.doc.Meshes) {
+		return nil, nil
+	}
+	mesh := l.doc.Meshes[*n.Mesh]
+	if len(mesh.Primitives) == 0 || len(mesh.Primitives[0].Targets) == 0 {
+		return nil, nil
+	}
+	targets := len(mesh.Primitives[0].Targets)
+	weights := make([]float32, targets)
+	switch {
+	case n.Weights != nil:
+		if len(n.Weights) != targets {
+			return nil, errors.Errorf("%d weights for %d targets", len(n.Weights), targets)
+		}
+		copy(weights, n.Weights)
+	case mesh.Weights != nil:
+		if len(mesh.Weights) != targets {
+			return nil, errors.Errorf("mesh has %d weights for %d targets", len(mesh.Weights), targets)
+		}
+		copy(weights, mesh.Weights)
+	}
+	return weights, nil
+}
+
+// morphTargets reads a primitive's morph targets, moving their deltas like
+// world moves its vertices and normals. It's nil without any.
+func (l *gltfLoader) morphTargets(targets []map[string]int, count int, world, normalMatrix vmath.Mat4) ([]MorphTarget, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	read := func(t int, name string, m vmath.Mat4) ([][3]float32, error) {
+		accessor, ok := targets[t][name]
+		if !ok {
+			return nil, nil
+		}
+		values, err := l.floats(accessor, 3)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad %s in target %d", name, t)
+		}
+		if len(values) != count*3 {
+			return nil, errors.Errorf("target %d has %d %s for %d positions", t, len(values)/3, name, count)
+		}
+		deltas := make([][3]float32, count)
+		for i := range deltas {
+			// Deltas are directions, they move but don't translate
+			deltas[i] = m.MulVec4(vmath.Vec4{values[i*3], values[i*3+1], values[i*3+2], 0}).Vec3()
+		}
+		return deltas, nil
+	}
+
+	morphs := make([]MorphTarget, len(targets))
+	for t := range targets {
+		var err error
+		m := &morphs[t]
+		if m.Positions, err = read(t, "POSITION", world); err != nil {
+			return nil, err
+		}
+		if m.Positions == nil {
+			m.Positions = make([][3]float32, count)
+		}
+		if m.Normals, err = read(t, "NORMAL", normalMatrix); err != nil {
+			return nil, err
+		}
+		if m.Tangents, err = read(t, "TANGENT", world); err != nil {
+			return nil, err
+		}
+	}
+	return morphs, nil
+}
+
+// skinWeights reads JOINTS_0 and WEIGHTS_0, turning the joints into
+// indices into the skeleton's joints and normalizing the weights.
+func (l *gltfLoader) skinWeights(attributes map[string]int, count, skin int) ([]uint32, []float32, error) {
+	jointsAccessor, hasJoints := attributes["JOINTS_0"]
+	weightsAccessor, hasWeights := attributes["WEIGHTS_0"]
+	if !hasJoints || !hasWeights {
+		return nil, nil, nil
+	}
+	joints, err := l.uints(jointsAccessor, 4)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "bad joints")
+	}
+	weights, err := l.floats(weightsAccessor, 4)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "bad weights")
+	}
+	if len(joints) != count*4 || len(weights) != count*4 {
+		return nil, nil, errors.Errorf("%d joints and %d weights for %d positions", len(joints)/4, len(weights)/4, count)
+	}
+
+	skinCount := len(l.doc.Skins[skin].Joints)
+	for i := 0; i < count; i++ {
+		var total float32
+		for j := i * 4; j < i*4+4; j++ {
+			if weights[j] == 0 {
+				// Unweighted joints can be anything, even out of range
+				joints[j] = 0
+			} else if joints[j] >= uint32(skinCount) {
+				return nil, nil, errors.Errorf("joint %d out of range for %d joints", joints[j], skinCount)
+			}
+			joints[j] += uint32(l.skinJoints[skin])
+			total += weights[j]
+		}
+		if total > 0 {
+			for j := i * 4; j < i*4+4; j++ {
+				weights[j] /= total
+			}
+		}
+	}
+	return joints, weights, nil
+}
+
+// colors reads COLOR_0, which is RGB or RGBA, returning how many
+// components each color has.
+func (l *gltfLoader) colors(attributes map[string]int, count int) ([]float32, int, error) {
+	accessor, ok := attributes["COLOR_0"]
+	if !ok {
+		return nil, 0, nil
+	}
+	if accessor < 0 || accessor >= len(l.doc.Accessors) {
+		return nil, 0, errors.Errorf("accessor %d out of range", accessor)
+	}
+	components := gltfComponents[l.doc.Accessors[accessor].Type]
+	if components != 3 && components != 4 {
+		return nil, 0, errors.Errorf("colors are %s, expected VEC3 or VEC4", l.doc.Accessors[accessor].Type)
+	}
+	values, err := l.floats(accessor, components)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(values) != count*components {
+		return nil, 0, errors.Errorf("%d colors for %d positions", len(values)/components, count)
+	}
+	return values, components, nil
+}
+
+// bufferView returns the bytes a buffer view covers and its stride, zero
+// when tightly packed.
+func (l *gltfLoader) bufferView(index int) ([]byte, int, error) {
+	if index < 0 || index >= len(l.doc.BufferViews) {
+		return nil, 0, errors.Errorf("buffer view %d out of range", index)
+	}
+	view := l.doc.BufferViews[index]
+	if view.Buffer < 0 || view.Buffer >= len(l.buffers) {
+		return nil, 0, errors.Errorf("buffer %d out of range", view.Buffer)
+	}
+	buffer := l.buffers[view.Buffer]
+	end := view.ByteOffset + view.ByteLength
+	if view.ByteOffset < 0 || end > len(buffer) {
+		return nil, 0, errors.Errorf("buffer view %d overruns buffer %d", index, view.Buffer)
+	}
+	return buffer[view.ByteOffset:end], view.ByteStride, nil
+}
+
+// elements returns each of an accessor's elements as raw bytes along with
+// its component type.
+func (l *gltfLoader) elements(index, components int) ([][]byte, int, error) {
+	if index < 0 || index >= len(l.doc.Accessors) {
+		return nil, 0, errors.Errorf("accessor %d out of range", index)
+	}
+	a := l.doc.Accessors[index]
+	if len(a.Sparse) > 0 {
+		return nil, 0, errors.Errorf("sparse accessor %d isn't supported", index)
+	}
+	if gltfComponents[a.Type] != components {
+		return nil, 0, errors.Errorf("accessor %d is %s, expected %d components", index, a.Type, components)
+	}
+	if a.BufferView == nil {
+		return nil, 0, errors.Errorf("accessor %d has no buffer view", index)
+	}
+
+	size := componentSize(a.ComponentType)
+	if size == 0 {
+		return nil, 0, errors.Errorf("accessor %d has unknown component type %d", index, a.ComponentType)
+	}
+	view, stride, err := l.bufferView(*a.BufferView)
+	if err != nil {
+		return nil, 0, err
+	}
+	elementSize := size * components
+	if stride == 0 {
+		stride = elementSize
+	}
+
+	elements := make([][]byte, a.Count)
+	for i := range elements {
+		start := a.ByteOffset + i*stride
+		if start+elementSize > len(view) {
+			return nil, 0, errors.Errorf("accessor %d overruns its buffer view", index)
+		}
+		elements[i] = view[start : start+elementSize]
+	}
+	return elements, a.ComponentType, nil
+}
+
+func componentSize(componentType int) int {
+	switch componentType {
+	case gltfByte, gltfUnsignedByte:
+		return 1
+	case gltfShort, gltfUnsignedShort:
+		return 2
+	case gltfUnsignedInt, gltfFloat:
+		return 4
+	}
+	return 0
+}
+
+// floats reads an accessor of float or normalized integer components.
+func (l *gltfLoader) floats(index, components int) ([]float32, error) {
+	elements, componentType, err := l.elements(index, components)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float32, 0, len(elements)*components)
+	for _, e := range elements {
+		for c := 0; c < components; c++ {
+			var v float32
+			switch componentType {
+			case gltfFloat:
+				v = math.Float32frombits(binary.LittleEndian.Uint32(e[c*4:]))
+			case gltfUnsignedByte:
+				v = float32(e[c]) / math.MaxUint8
+			case gltfUnsignedShort:
+				v = float32(binary.LittleEndian.Uint16(e[c*2:])) / math.MaxUint16
+			case gltfByte:
+				v = float32(math.Max(float64(int8(e[c]))/math.MaxInt8, -1))
+			case gltfShort:
+				v = float32(math.Max(float64(int16(binary.LittleEndian.Uint16(e[c*2:])))/math.MaxInt16, -1))
+			default:
+				return nil, errors.Errorf("accessor %d component type %d isn't a float", index, componentType)
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// indices reads an accessor of unsigned integer indices, checking they're
+// below vertexCount.
+func (l *gltfLoader) indices(index, vertexCount int) ([]uint32, error) {
+	indices, err := l.uints(index, 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range indices {
+		if i >= uint32(vertexCount) {
+			return nil, errors.Errorf("index %d out of range for %d vertices", i, vertexCount)
+		}
+	}
+	return indices, nil
+}
+
+// uints reads an accessor of unsigned integer components.
+func (l *gltfLoader) uints(index, components int) ([]uint32, error) {
+	elements, componentType, err := l.elements(index, components)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]uint32, 0, len(elements)*components)
+	for _, e := range elements {
+		for c := 0; c < components; c++ {
+			switch componentType {
+			case gltfUnsignedByte:
+				values = append(values, uint32(e[c]))
+			case gltfUnsignedShort:
+				values = append(values, uint32(binary.LittleEndian.Uint16(e[c*2:])))
+			case gltfUnsignedInt:
+				values = append(values, binary.LittleEndian.Uint32(e[c*4:]))
+			default:
+				return nil, errors.Errorf("accessor %d component type %d isn't an unsigned integer", index, componentType)
+			}
+		}
+	}
+	return values, nil
+}
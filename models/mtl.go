@@ -0,0 +1,141 @@
+package models
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Material is the subset of a Wavefront .mtl material the renderer uses.
+// Texture maps are paths as written in the file.
+type Material struct {
+	Name      string
+	Ambient   [3]float32
+	Diffuse   [3]float32
+	Specular  [3]float32
+	Emissive  [3]float32
+	Shininess float32
+	Dissolve  float32
+
+	AmbientMap  string
+	DiffuseMap  string
+	SpecularMap string
+	NormalMap   string
+}
+
+// LoadMTL reads a Wavefront .mtl file.
+func LoadMTL(path string) (map[string]*Material, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open material library '%s'", path)
+	}
+	defer f.Close()
+
+	materials, err := ParseMTL(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse material library '%s'", path)
+	}
+	return materials, nil
+}
+
+// ParseMTL reads Wavefront .mtl data from r, keyed by material name.
+func ParseMTL(r io.Reader) (map[string]*Material, error) {
+	materials := map[string]*Material{}
+	var current *Material
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		keyword, args := fields[0], fields[1:]
+
+		if keyword == "newmtl" {
+			if len(args) != 1 {
+				return nil, errors.Errorf("line %d: newmtl needs a material name", line)
+			}
+			current = &Material{
+				Name:     args[0],
+				Dissolve: 1,
+			}
+			materials[current.Name] = current
+			continue
+		}
+		if current == nil {
+			return nil, errors.Errorf("line %d: '%s' before any newmtl", line, keyword)
+		}
+
+		if err := parseMaterialLine(current, keyword, args); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't read mtl")
+	}
+
+	return materials, nil
+}
+
+func parseMaterialLine(m *Material, keyword string, args []string) error {
+	color := func(dst *[3]float32) error {
+		values, err := parseFloats(args, 3, 3)
+		if err != nil {
+			return errors.Wrapf(err, "bad %s color", keyword)
+		}
+		copy(dst[:], values)
+		return nil
+	}
+	scalar := func(dst *float32) error {
+		values, err := parseFloats(args, 1, 1)
+		if err != nil {
+			return errors.Wrapf(err, "bad %s value", keyword)
+		}
+		*dst = values[0]
+		return nil
+	}
+	texture := func(dst *string) error {
+		if len(args) == 0 {
+			return errors.Errorf("%s needs a texture path", keyword)
+		}
+		// Map options come first, the path is always last
+		*dst = args[len(args)-1]
+		return nil
+	}
+
+	switch keyword {
+	case "Ka":
+		return color(&m.Ambient)
+	case "Kd":
+		return color(&m.Diffuse)
+	case "Ks":
+		return color(&m.Specular)
+	case "Ke":
+		return color(&m.Emissive)
+	case "Ns":
+		return scalar(&m.Shininess)
+	case "d":
+		return scalar(&m.Dissolve)
+	case "Tr":
+		if err := scalar(&m.Dissolve); err != nil {
+			return err
+		}
+		m.Dissolve = 1 - m.Dissolve
+	case "map_Ka":
+		return texture(&m.AmbientMap)
+	case "map_Kd":
+		return texture(&m.DiffuseMap)
+	case "map_Ks":
+		return texture(&m.SpecularMap)
+	case "map_Bump", "map_bump", "bump", "norm":
+		return texture(&m.NormalMap)
+	}
+	return nil
+}
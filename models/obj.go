@@ -0,0 +1,297 @@
+// Package models loads model files into flat vertex and index slices ready
+// to be uploaded to vertex and index buffers.
+package models
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/animation"
+	"github.com/pkg/errors"
+)
+
+// Vertex is an interleaved vertex as read from a model file.
+type Vertex struct {
+	Position [3]float32
+	Normal   [3]float32
+	TexCoord [2]float32
+	Color    [3]float32
+	// Tangent is the direction of increasing U, W is the sign of the
+	// bitangent, +1 or -1.
+	Tangent [4]float32
+	// Joints are the skin joints moving a glTF skinned vertex, indices
+	// into Model.Skeleton.Joints, by Weights, which sum to one. The weights
+	// are zero when the vertex isn't skinned.
+	Joints  [4]uint32
+	Weights [4]float32
+}
+
+// Group is a run of indices drawn with the same material.
+type Group struct {
+	Name        string
+	Material    string
+	IndexOffset uint32
+	IndexCount  uint32
+}
+
+// Model is deduplicated vertices, triangle list indices into them and the
+// material groups that partition the indices. OBJ models fill Materials,
+// glTF ones PBRMaterials and, when they have skins, morph targets or
+// animations, Skeleton, Morphs and Clips.
+type Model struct {
+	Vertices     []Vertex
+	Indices      []uint32
+	Groups       []Group
+	Materials    map[string]*Material
+	PBRMaterials map[string]*PBRMaterial
+	Skeleton     *animation.Skeleton
+	Morphs       []Morph
+	Clips        []*animation.Clip
+}
+
+// LoadOBJ reads a Wavefront .obj file along with any .mtl libraries it
+// references, which are resolved relative to the .obj file.
+func LoadOBJ(path string) (*Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open model '%s'", path)
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	m, err := ParseOBJ(f, func(name string) (map[string]*Material, error) {
+		return LoadMTL(filepath.Join(dir, name))
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse model '%s'", path)
+	}
+	return m, nil
+}
+
+// MaterialLoader resolves an mtllib statement to the materials it defines.
+type MaterialLoader func(name string) (map[string]*Material, error)
+
+// objIndex identifies a unique combination of position, texture coordinate
+// and normal, 0 meaning the face didn't reference one.
+type objIndex struct {
+	v, vt, vn int
+}
+
+type objParser struct {
+	loadMaterials MaterialLoader
+
+	positions [][3]float32
+	colors    [][3]float32
+	texCoords [][2]float32
+	normals   [][3]float32
+
+	model  *Model
+	unique map[objIndex]uint32
+	group  Group
+}
+
+// ParseOBJ reads Wavefront .obj data from r. Polygons are fan triangulated
+// and identical position/texcoord/normal combinations share a vertex.
+// loadMaterials may be nil in which case mtllib statements are ignored.
+func ParseOBJ(r io.Reader, loadMaterials MaterialLoader) (*Model, error) {
+	p := &objParser{
+		loadMaterials: loadMaterials,
+		model: &Model{
+			Materials: map[string]*Material{},
+		},
+		unique: map[objIndex]uint32{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if err := p.parseLine(scanner.Text()); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't read obj")
+	}
+	p.endGroup()
+
+	return p.model, nil
+}
+
+func (p *objParser) parseLine(line string) error {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	keyword, args := fields[0], fields[1:]
+
+	switch keyword {
+	case "v":
+		values, err := parseFloats(args, 3, 6)
+		if err != nil {
+			return errors.Wrap(err, "bad vertex position")
+		}
+		p.positions = append(p.positions, [3]float32{values[0], values[1], values[2]})
+		// Vertex colors are a common extension, default to white without them
+		color := [3]float32{1, 1, 1}
+		if len(values) == 6 {
+			color = [3]float32{values[3], values[4], values[5]}
+		}
+		p.colors = append(p.colors, color)
+	case "vt":
+		values, err := parseFloats(args, 1, 3)
+		if err != nil {
+			return errors.Wrap(err, "bad texture coordinate")
+		}
+		var v float32
+		if len(values) > 1 {
+			v = values[1]
+		}
+		// OBJ puts the origin at the bottom left, Vulkan samples from the top left
+		p.texCoords = append(p.texCoords, [2]float32{values[0], 1 - v})
+	case "vn":
+		values, err := parseFloats(args, 3, 3)
+		if err != nil {
+			return errors.Wrap(err, "bad vertex normal")
+		}
+		p.normals = append(p.normals, [3]float32{values[0], values[1], values[2]})
+	case "f":
+		return errors.Wrap(p.parseFace(args), "bad face")
+	case "usemtl":
+		if len(args) != 1 {
+			return errors.New("usemtl needs a material name")
+		}
+		p.endGroup()
+		p.group.Material = args[0]
+	case "o", "g":
+		p.endGroup()
+		p.group.Name = strings.Join(args, " ")
+	case "mtllib":
+		if p.loadMaterials == nil {
+			return nil
+		}
+		for _, name := range args {
+			materials, err := p.loadMaterials(name)
+			if err != nil {
+				return errors.Wrapf(err, "can't load material library '%s'", name)
+			}
+			for k, v := range materials {
+				p.model.Materials[k] = v
+			}
+		}
+	default:
+		// Smoothing groups, curves and the like don't affect triangle meshes
+	}
+	return nil
+}
+
+func (p *objParser) parseFace(args []string) error {
+	if len(args) < 3 {
+		return errors.Errorf("face has %d vertices, needs at least 3", len(args))
+	}
+
+	indices := make([]uint32, len(args))
+	for i, arg := range args {
+		key, err := p.parseFaceVertex(arg)
+		if err != nil {
+			return err
+		}
+		indices[i] = p.vertex(key)
+	}
+
+	for i := 1; i+1 < len(indices); i++ {
+		p.model.Indices = append(p.model.Indices, indices[0], indices[i], indices[i+1])
+	}
+	return nil
+}
+
+// parseFaceVertex parses v, v/vt, v//vn or v/vt/vn, resolving negative
+// indices relative to the end of the lists read so far.
+func (p *objParser) parseFaceVertex(s string) (objIndex, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) > 3 {
+		return objIndex{}, errors.Errorf("bad face vertex '%s'", s)
+	}
+
+	var key objIndex
+	targets := []*int{&key.v, &key.vt, &key.vn}
+	counts := []int{len(p.positions), len(p.texCoords), len(p.normals)}
+	for i, part := range parts {
+		if part == "" {
+			if i == 0 {
+				return objIndex{}, errors.Errorf("face vertex '%s' has no position", s)
+			}
+			continue
+		}
+
+		index, err := strconv.Atoi(part)
+		if err != nil {
+			return objIndex{}, errors.Wrapf(err, "bad index in face vertex '%s'", s)
+		}
+		if index < 0 {
+			index += counts[i] + 1
+		}
+		if index < 1 || index > counts[i] {
+			return objIndex{}, errors.Errorf("index %s in face vertex '%s' is out of range", part, s)
+		}
+		*targets[i] = index
+	}
+	return key, nil
+}
+
+// vertex returns the index of the vertex for key, adding it if it's new.
+func (p *objParser) vertex(key objIndex) uint32 {
+	if index, ok := p.unique[key]; ok {
+		return index
+	}
+
+	v := Vertex{
+		Position: p.positions[key.v-1],
+		Color:    p.colors[key.v-1],
+	}
+	if key.vt > 0 {
+		v.TexCoord = p.texCoords[key.vt-1]
+	}
+	if key.vn > 0 {
+		v.Normal = p.normals[key.vn-1]
+	}
+
+	index := uint32(len(p.model.Vertices))
+	p.model.Vertices = append(p.model.Vertices, v)
+	p.unique[key] = index
+	return index
+}
+
+// endGroup closes the current group if it has any faces, the next one
+// inherits its name and material until they're changed.
+func (p *objParser) endGroup() {
+	end := uint32(len(p.model.Indices))
+	if count := end - p.group.IndexOffset; count > 0 {
+		p.group.IndexCount = count
+		p.model.Groups = append(p.model.Groups, p.group)
+	}
+	p.group.IndexOffset = end
+	p.group.IndexCount = 0
+}
+
+// parseFloats parses between minCount and maxCount float arguments.
+func parseFloats(args []string, minCount, maxCount int) ([]float32, error) {
+	if len(args) < minCount || len(args) > maxCount {
+		return nil, errors.Errorf("got %d values, expected %d to %d", len(args), minCount, maxCount)
+	}
+
+	values := make([]float32, len(args))
+	for i, arg := range args {
+		f, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad number '%s'", arg)
+		}
+		values[i] = float32(f)
+	}
+	return values, nil
+}
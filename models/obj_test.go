@@ -0,0 +1,166 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOBJ(t *testing.T) {
+	tests := []struct {
+		name      string
+		obj       string
+		positions [][3]float32
+		indices   []uint32
+		groups    []Group
+	}{
+		{
+			name: "triangle",
+			obj: `v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3`,
+			positions: [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			indices:   []uint32{0, 1, 2},
+			groups:    []Group{{IndexCount: 3}},
+		},
+		{
+			name: "quad shares the diagonal's vertices",
+			obj: `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+f 1 2 3
+f 1 3 4`,
+			positions: [][3]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+			indices:   []uint32{0, 1, 2, 0, 2, 3},
+			groups:    []Group{{IndexCount: 6}},
+		},
+		{
+			name: "polygon is fan triangulated",
+			obj: `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+f 1 2 3 4`,
+			positions: [][3]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+			indices:   []uint32{0, 1, 2, 0, 2, 3},
+			groups:    []Group{{IndexCount: 6}},
+		},
+		{
+			name: "negative indices count back from the last read",
+			obj: `v 9 9 9
+v 0 0 0
+v 1 0 0
+v 0 1 0
+f -3 -2 -1`,
+			positions: [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			indices:   []uint32{0, 1, 2},
+			groups:    []Group{{IndexCount: 3}},
+		},
+		{
+			name: "negative and positive indices dedup together",
+			obj: `v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3
+f -3 -1 -2`,
+			positions: [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			indices:   []uint32{0, 1, 2, 0, 2, 1},
+			groups:    []Group{{IndexCount: 6}},
+		},
+		{
+			name: "different texture coordinates split a position",
+			obj: `v 0 0 0
+v 1 0 0
+v 0 1 0
+vt 0 0
+vt 1 1
+f 1/1 2/1 3/1
+f 1/2 3/1 2/1`,
+			positions: [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 0}},
+			indices:   []uint32{0, 1, 2, 3, 2, 1},
+			groups:    []Group{{IndexCount: 6}},
+		},
+		{
+			name: "materials split groups",
+			obj: `v 0 0 0
+v 1 0 0
+v 0 1 0
+g body
+usemtl red
+f 1 2 3
+usemtl blue
+f 3 2 1`,
+			positions: [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			indices:   []uint32{0, 1, 2, 2, 1, 0},
+			groups: []Group{
+				{Name: "body", Material: "red", IndexCount: 3},
+				{Name: "body", Material: "blue", IndexOffset: 3, IndexCount: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseOBJ(strings.NewReader(tt.obj), nil)
+			if err != nil {
+				t.Fatalf("ParseOBJ: %v", err)
+			}
+			positions := make([][3]float32, len(m.Vertices))
+			for i, v := range m.Vertices {
+				positions[i] = v.Position
+			}
+			if !reflect.DeepEqual(positions, tt.positions) {
+				t.Errorf("positions = %v, want %v", positions, tt.positions)
+			}
+			if !reflect.DeepEqual(m.Indices, tt.indices) {
+				t.Errorf("indices = %v, want %v", m.Indices, tt.indices)
+			}
+			if !reflect.DeepEqual(m.Groups, tt.groups) {
+				t.Errorf("groups = %+v, want %+v", m.Groups, tt.groups)
+			}
+		})
+	}
+}
+
+func TestParseOBJTexCoordsAndNormals(t *testing.T) {
+	m, err := ParseOBJ(strings.NewReader(`v 0 0 0
+v 1 0 0
+v 0 1 0
+vt 0.25 0.75
+vn 0 0 1
+f 1/1/1 2//1 3/-1/-1`), nil)
+	if err != nil {
+		t.Fatalf("ParseOBJ: %v", err)
+	}
+	want := []Vertex{
+		{Position: [3]float32{0, 0, 0}, TexCoord: [2]float32{0.25, 0.25}, Normal: [3]float32{0, 0, 1}, Color: [3]float32{1, 1, 1}},
+		{Position: [3]float32{1, 0, 0}, Normal: [3]float32{0, 0, 1}, Color: [3]float32{1, 1, 1}},
+		{Position: [3]float32{0, 1, 0}, TexCoord: [2]float32{0.25, 0.25}, Normal: [3]float32{0, 0, 1}, Color: [3]float32{1, 1, 1}},
+	}
+	if !reflect.DeepEqual(m.Vertices, want) {
+		t.Errorf("vertices = %+v, want %+v", m.Vertices, want)
+	}
+}
+
+func TestParseOBJErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  string
+	}{
+		{"index past the end", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4"},
+		{"negative index before the start", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf -4 1 2"},
+		{"zero index", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 0 1 2"},
+		{"missing position", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf /1 2 3"},
+		{"too few vertices", "v 0 0 0\nv 1 0 0\nf 1 2"},
+		{"bad number", "v 0 zero 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseOBJ(strings.NewReader(tt.obj), nil); err == nil {
+				t.Error("ParseOBJ succeeded, want an error")
+			}
+		})
+	}
+}
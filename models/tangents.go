@@ -0,0 +1,79 @@
+package models
+
+import "github.com/delaneyj/learnvulkan/vmath"
+
+// GenerateNormals fills in the normals of vertices that don't have one by
+// summing the area weighted face normals of the triangles using them.
+func GenerateNormals(vertices []Vertex, indices []uint32) {
+	missing := make([]bool, len(vertices))
+	for i, v := range vertices {
+		missing[i] = v.Normal == [3]float32{}
+	}
+
+	sums := make([]vmath.Vec3, len(vertices))
+	for t := 0; t+2 < len(indices); t += 3 {
+		i0, i1, i2 := indices[t], indices[t+1], indices[t+2]
+		p0 := vmath.Vec3(vertices[i0].Position)
+		p1 := vmath.Vec3(vertices[i1].Position)
+		p2 := vmath.Vec3(vertices[i2].Position)
+		// Unnormalized so larger triangles count for more
+		n := p1.Sub(p0).Cross(p2.Sub(p0))
+		for _, i := range []uint32{i0, i1, i2} {
+			sums[i] = sums[i].Add(n)
+		}
+	}
+
+	for i := range vertices {
+		if missing[i] {
+			vertices[i].Normal = sums[i].Normalize()
+		}
+	}
+}
+
+// GenerateTangents computes per vertex tangents from texture coordinates,
+// orthogonalized against the normals. Vertices whose triangles have no UV
+// variation get an arbitrary tangent perpendicular to the normal.
+func GenerateTangents(vertices []Vertex, indices []uint32) {
+	tangents := make([]vmath.Vec3, len(vertices))
+	bitangents := make([]vmath.Vec3, len(vertices))
+	for t := 0; t+2 < len(indices); t += 3 {
+		i0, i1, i2 := indices[t], indices[t+1], indices[t+2]
+		v0, v1, v2 := vertices[i0], vertices[i1], vertices[i2]
+
+		e1 := vmath.Vec3(v1.Position).Sub(v0.Position)
+		e2 := vmath.Vec3(v2.Position).Sub(v0.Position)
+		du1, dv1 := v1.TexCoord[0]-v0.TexCoord[0], v1.TexCoord[1]-v0.TexCoord[1]
+		du2, dv2 := v2.TexCoord[0]-v0.TexCoord[0], v2.TexCoord[1]-v0.TexCoord[1]
+		det := du1*dv2 - du2*dv1
+		if det == 0 {
+			continue
+		}
+		r := 1 / det
+		tangent := e1.Mul(dv2 * r).Sub(e2.Mul(dv1 * r))
+		bitangent := e2.Mul(du1 * r).Sub(e1.Mul(du2 * r))
+		for _, i := range []uint32{i0, i1, i2} {
+			tangents[i] = tangents[i].Add(tangent)
+			bitangents[i] = bitangents[i].Add(bitangent)
+		}
+	}
+
+	for i := range vertices {
+		n := vmath.Vec3(vertices[i].Normal)
+		// Gram-Schmidt, then fall back to any perpendicular if nothing is left
+		t := tangents[i].Sub(n.Mul(n.Dot(tangents[i])))
+		if t.Len() < 1e-6 {
+			axis := vmath.Vec3{1, 0, 0}
+			if n[0] > 0.9 || n[0] < -0.9 {
+				axis = vmath.Vec3{0, 1, 0}
+			}
+			t = axis.Sub(n.Mul(n.Dot(axis)))
+		}
+		t = t.Normalize()
+
+		w := float32(1)
+		if n.Cross(t).Dot(bitangents[i]) < 0 {
+			w = -1
+		}
+		vertices[i].Tangent = [4]float32{t[0], t[1], t[2], w}
+	}
+}
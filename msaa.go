@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// defaultMSAASamples is always usable, Vulkan requires 1x and 4x support for
+// color attachments.
+const defaultMSAASamples = 4
+
+// sampleCountBits maps a sample count to its flag bit, only the counts the
+// application exposes are listed.
+var sampleCountBits = map[int]vk.SampleCountFlagBits{
+	1: vk.SampleCount1Bit,
+	2: vk.SampleCount2Bit,
+	4: vk.SampleCount4Bit,
+	8: vk.SampleCount8Bit,
+}
+
+// maxUsableSampleCount is the highest exposed sample count the device
+// supports for both color and depth framebuffer attachments.
+func maxUsableSampleCount(limits vk.PhysicalDeviceLimits) int {
+	counts := vk.SampleCountFlags(limits.FramebufferColorSampleCounts & limits.FramebufferDepthSampleCounts)
+	for _, samples := range []int{8, 4, 2} {
+		if counts&vk.SampleCountFlags(sampleCountBits[samples]) != 0 {
+			return samples
+		}
+	}
+	return 1
+}
+
+// chooseSampleCount validates MSAASamples against the picked device.
+func (app *HelloTriangleApplication) chooseSampleCount() error {
+	samples := app.MSAASamples
+	if samples <= 0 {
+		samples = defaultMSAASamples
+	}
+
+	bit, ok := sampleCountBits[samples]
+	if !ok {
+		return errors.Errorf("unsupported MSAA sample count %d, must be 1, 2, 4 or 8", samples)
+	}
+
+	var properties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(app.physicalDevice, &properties)
+	properties.Deref()
+	properties.Limits.Deref()
+
+	if maxSamples := maxUsableSampleCount(properties.Limits); samples > maxSamples {
+		return errors.Errorf("%dx MSAA requested but the device supports up to %dx", samples, maxSamples)
+	}
+
+	// The lighting subpass reads the G-buffer a sample per pixel
+	if app.Deferred && bit != vk.SampleCount1Bit {
+		app.logger.Info("Deferred rendering doesn't multisample", logging.F("samples", samples))
+		bit = vk.SampleCount1Bit
+	}
+
+	app.msaaSamples = bit
+	return nil
+}
+
+func (app *HelloTriangleApplication) multisampled() bool {
+	return app.msaaSamples != vk.SampleCount1Bit
+}
+
+// createColorResources creates the multisampled color target that's resolved
+// into the swapchain image, it's not needed without MSAA.
+func (app *HelloTriangleApplication) createColorResources() error {
+	if !app.multisampled() {
+		return nil
+	}
+
+	extent := app.target.Extent
+	img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:   extent.Width,
+		Height:  extent.Height,
+		Samples: app.msaaSamples,
+		Format:  app.target.Format,
+		Tiling:  vk.ImageTilingOptimal,
+		Usage:   vk.ImageUsageFlags(vk.ImageUsageTransientAttachmentBit | vk.ImageUsageColorAttachmentBit),
+		Memory:  memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create color image")
+	}
+	app.colorImage = img
+	return nil
+}
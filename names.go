@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/delaneyj/learnvulkan/debugutils"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+)
+
+// createNamer enables object naming along with the validation layers and
+// names the objects that already exist.
+func (app *HelloTriangleApplication) createNamer() error {
+	if !app.validationEnabled() {
+		return nil
+	}
+
+	namer, err := debugutils.NewNamer(app.getInstanceProcAddr, app.instance, app.device)
+	if err != nil {
+		return errors.Wrap(err, "can't create object namer")
+	}
+	app.namer = namer
+
+	app.name(app.instance, "%s instance", app.config.Title)
+	app.name(app.physicalDevice, "physical device")
+	app.name(app.device, "device")
+	app.name(app.graphicsQueue, "graphics queue")
+	if app.presentQueue != nil && app.presentQueue != app.graphicsQueue {
+		app.name(app.presentQueue, "present queue")
+	}
+	if app.queueFamilies.DedicatedCompute() {
+		app.name(app.computeQueue, "compute queue")
+	}
+	if app.queueFamilies.DedicatedTransfer() {
+		app.name(app.transferQueue, "transfer queue")
+	}
+	return nil
+}
+
+// name labels a Vulkan object for validation messages and debuggers, it's a
+// no-op without validation layers. Failing to name something isn't worth
+// stopping for so it's only logged.
+func (app *HelloTriangleApplication) name(handle interface{}, format string, args ...interface{}) {
+	if err := app.namer.Name(handle, fmt.Sprintf(format, args...)); err != nil {
+		app.logger.Warn("Can't name object", logging.F("err", err))
+	}
+}
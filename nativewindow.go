@@ -0,0 +1,110 @@
+package main
+
+import (
+	"time"
+
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/surface"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+// nativeWaitInterval is how long the main loop sleeps while a native window
+// is minimized, there's no GLFW to wait on its events.
+const nativeWaitInterval = 50 * time.Millisecond
+
+// NativeWindowConfig draws into a window the embedder opened, like an
+// existing application's window or a compositor's surface, instead of
+// opening one with GLFW. The embedder owns the window and its events, so
+// the key bindings and camera controls, which come from GLFW, do nothing.
+type NativeWindowConfig struct {
+	// Window is the platform window the surface is created for.
+	Window surface.Window
+	// FramebufferSize is the window's size in pixels, zero while it's
+	// minimized.
+	FramebufferSize func() (width, height int)
+	// ShouldClose reports whether to stop drawing and return from Run.
+	ShouldClose func() bool
+	// PollEvents is called once a frame to handle the window's events, nil
+	// when the embedder handles them elsewhere.
+	PollEvents func()
+}
+
+// initNativeWindow checks the native window can be drawn into in place of
+// opening a GLFW window.
+func (app *HelloTriangleApplication) initNativeWindow() error {
+	cfg := app.NativeWindow
+	switch {
+	case cfg.Window == nil:
+		return errors.New("native window has no Window")
+	case cfg.FramebufferSize == nil:
+		return errors.New("native window has no FramebufferSize")
+	case cfg.ShouldClose == nil:
+		return errors.New("native window has no ShouldClose")
+	}
+	if len(app.Windows) > 0 {
+		app.logger.Warn("Not opening extra windows",
+			logging.F("windows", len(app.Windows)),
+			logging.F("reason", "drawing into a native window"),
+		)
+	}
+	app.logger.Info("Drawing into a native window", logging.F("extensions", cfg.Window.Extensions()))
+	return nil
+}
+
+// nativeInstanceExtensions are the instance extensions the native window's
+// surface needs.
+func (app *HelloTriangleApplication) nativeInstanceExtensions() []string {
+	var extensions []string
+	for _, name := range app.NativeWindow.Window.Extensions() {
+		extensions = append(extensions, name+"\x00")
+	}
+	return extensions
+}
+
+// createNativeSurface creates the surface for the native window.
+func (app *HelloTriangleApplication) createNativeSurface() error {
+	s, err := surface.Create(app.getInstanceProcAddr, app.instance, app.NativeWindow.Window)
+	if err != nil {
+		return errors.Wrap(err, "can't create native window surface")
+	}
+	app.surface = s
+	return nil
+}
+
+// framebufferSize is the current window's size in pixels.
+func (app *HelloTriangleApplication) framebufferSize() (width, height int) {
+	if app.window == nil {
+		return app.NativeWindow.FramebufferSize()
+	}
+	return app.window.GetFramebufferSize()
+}
+
+// shouldClose reports whether the primary window has been asked to close.
+func (app *HelloTriangleApplication) shouldClose() bool {
+	if app.window == nil {
+		return app.NativeWindow.ShouldClose()
+	}
+	return app.window.ShouldClose()
+}
+
+// pollEvents handles the windows' pending events.
+func (app *HelloTriangleApplication) pollEvents() {
+	if app.NativeWindow == nil {
+		glfw.PollEvents()
+		return
+	}
+	if app.NativeWindow.PollEvents != nil {
+		app.NativeWindow.PollEvents()
+	}
+}
+
+// waitEvents blocks until there might be something to draw.
+func (app *HelloTriangleApplication) waitEvents() {
+	if app.NativeWindow == nil {
+		glfw.WaitEvents()
+		return
+	}
+	time.Sleep(nativeWaitInterval)
+	app.pollEvents()
+}
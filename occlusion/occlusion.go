@@ -0,0 +1,113 @@
+// Package occlusion asks the GPU whether draws had any samples pass the
+// depth test with occlusion queries, so objects hidden behind others can be
+// skipped.
+package occlusion
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Queries are a number of occlusion queries for each frame in flight. Like
+// profiler.PipelineStats a frame's results are read back once its fence has
+// been waited on, so they're a frame in flight late and never stall. A nil
+// Queries records nothing.
+type Queries struct {
+	device   vk.Device
+	pool     vk.QueryPool
+	capacity int
+	// issued is how many of each frame's queries were recorded since it was
+	// last reset.
+	issued  []int
+	current int
+}
+
+// New creates capacity queries for each of frames frames in flight.
+func New(device vk.Device, frames, capacity int) (*Queries, error) {
+	poolInfo := &vk.QueryPoolCreateInfo{
+		SType:      vk.StructureTypeQueryPoolCreateInfo,
+		QueryType:  vk.QueryTypeOcclusion,
+		QueryCount: uint32(frames * capacity),
+	}
+	q := &Queries{
+		device:   device,
+		capacity: capacity,
+		issued:   make([]int, frames),
+	}
+	if err := vk.Error(vk.CreateQueryPool(device, poolInfo, nil, &q.pool)); err != nil {
+		return nil, errors.Wrap(err, "can't create occlusion query pool")
+	}
+	return q, nil
+}
+
+// Capacity is how many queries a frame has.
+func (q *Queries) Capacity() int {
+	if q == nil {
+		return 0
+	}
+	return q.capacity
+}
+
+// Results are whether any samples passed for each query frame recorded the
+// last time round, false when there aren't any or they aren't ready.
+func (q *Queries) Results(frame int) ([]bool, bool) {
+	if q == nil || q.issued[frame] == 0 {
+		return nil, false
+	}
+	samples := make([]uint64, q.issued[frame])
+	result := vk.GetQueryPoolResults(q.device, q.pool,
+		uint32(frame*q.capacity), uint32(len(samples)),
+		uint(len(samples))*uint(unsafe.Sizeof(samples[0])), unsafe.Pointer(&samples[0]), vk.DeviceSize(unsafe.Sizeof(samples[0])),
+		vk.QueryResultFlags(vk.QueryResult64Bit),
+	)
+	if result != vk.Success {
+		return nil, false
+	}
+	passed := make([]bool, len(samples))
+	for i, n := range samples {
+		passed[i] = n > 0
+	}
+	return passed, true
+}
+
+// Reset readies frame's queries to be recorded again, it has to be called
+// outside a render pass before Begin.
+func (q *Queries) Reset(cb vk.CommandBuffer, frame int) {
+	if q == nil {
+		return
+	}
+	q.current = frame
+	q.issued[frame] = 0
+	vk.CmdResetQueryPool(cb, q.pool, uint32(frame*q.capacity), uint32(q.capacity))
+}
+
+// Begin starts query i of the current frame, whatever's drawn until End
+// counts towards it. i goes up from 0 without gaps.
+func (q *Queries) Begin(cb vk.CommandBuffer, i int) {
+	if q == nil {
+		return
+	}
+	vk.CmdBeginQuery(cb, q.pool, uint32(q.current*q.capacity+i), 0)
+}
+
+// End stops query i.
+func (q *Queries) End(cb vk.CommandBuffer, i int) {
+	if q == nil {
+		return
+	}
+	vk.CmdEndQuery(cb, q.pool, uint32(q.current*q.capacity+i))
+	if i >= q.issued[q.current] {
+		q.issued[q.current] = i + 1
+	}
+}
+
+// Destroy releases the query pool.
+func (q *Queries) Destroy() {
+	if q == nil || q.pool == vk.NullQueryPool {
+		return
+	}
+	vk.DestroyQueryPool(q.device, q.pool, nil)
+	q.pool = vk.NullQueryPool
+}
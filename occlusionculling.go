@@ -0,0 +1,231 @@
+package main
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/culling"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/occlusion"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// occlusionBoxVertices is the 12 triangles of the box occlusion.vert
+	// draws.
+	occlusionBoxVertices = 36
+	// occludedObjectsCount is the frame stats counter of the objects in the
+	// frustum that occlusion culling skips each frame.
+	occludedObjectsCount = "occluded objects"
+)
+
+// OcclusionConstants is pushed once per occlusion query, matching the
+// push_constant block in occlusion.vert.
+type OcclusionConstants struct {
+	ViewProj vmath.Mat4
+	Min      vmath.Vec4
+	Max      vmath.Vec4
+}
+
+var occlusionConstants = pipeline.NewPushConstants[OcclusionConstants](vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0)
+
+// occlusionCulling is whether windows test their objects with occlusion
+// queries. Executing secondary command buffers inside a query needs the
+// inheritedQueries feature, so it's only done when recording inline.
+func (app *HelloTriangleApplication) occlusionCulling() bool {
+	return app.OcclusionCulling && app.RecordThreads <= 1
+}
+
+// createOcclusionQueries creates the current window's occlusion queries, one
+// per object for each frame in flight, when occlusion culling.
+func (app *HelloTriangleApplication) createOcclusionQueries() error {
+	if !app.OcclusionCulling {
+		return nil
+	}
+	if !app.occlusionCulling() {
+		app.logger.Info("Occlusion culling unavailable", logging.F("reason", "recording on multiple threads"))
+		return nil
+	}
+	q, err := occlusion.New(app.device, app.framesInFlight(), app.objectCount())
+	if err != nil {
+		return err
+	}
+	app.occlusionQueries = q
+	app.occlusionNodes = make([][]*scene.Node, app.framesInFlight())
+	return nil
+}
+
+// occlusionActive is whether the current window's frame is occlusion
+// culled. The meshlet pipeline's depth isn't guaranteed to match the depth
+// pre-pass, and lines and points don't cover what the pre-pass fills, so
+// only the vertex pipeline's filled triangles are.
+func (app *HelloTriangleApplication) occlusionActive() bool {
+	return app.occlusionQueries != nil && !app.meshShaded &&
+		app.polygonModes()[app.polygonMode] == vk.PolygonModeFill
+}
+
+// readOcclusion takes in the occlusion queries frame recorded last time
+// round. Without results every object is drawn.
+func (app *HelloTriangleApplication) readOcclusion(frame int) {
+	if app.occlusionQueries == nil {
+		return
+	}
+	if passed, ok := app.occlusionQueries.Results(frame); ok {
+		app.occluded.Update(app.occlusionNodes[frame], passed)
+	} else {
+		app.occluded.Update(nil, nil)
+	}
+	app.occlusionBoxes = app.occlusionBoxes[:0]
+	app.occlusionNodes[frame] = app.occlusionNodes[frame][:0]
+}
+
+// queryOcclusion adds an object's world space box to those frame tests for
+// occlusion, unless the camera is so close the near plane could cut into
+// it, where the box might be clipped away while the object can be seen.
+func (app *HelloTriangleApplication) queryOcclusion(frame int, node *scene.Node, box culling.AABB) {
+	if !app.occlusionActive() || len(app.occlusionBoxes) == app.occlusionQueries.Capacity() {
+		return
+	}
+	if box.Grow(app.nearPlaneReach()).Contains(app.camera.Position) {
+		return
+	}
+	app.occlusionBoxes = append(app.occlusionBoxes, box)
+	app.occlusionNodes[frame] = append(app.occlusionNodes[frame], node)
+}
+
+// nearPlaneReach is how far the corners of the current window's near plane
+// are from its camera.
+func (app *HelloTriangleApplication) nearPlaneReach() float32 {
+	extent := app.target.Extent
+	aspect := float64(extent.Width) / float64(extent.Height)
+	t := math.Tan(float64(app.camera.FovY) / 2)
+	return app.camera.Near * float32(math.Sqrt(1+t*t*(1+aspect*aspect)))
+}
+
+// createOcclusionPipelines creates the current window's depth pre-pass
+// pipeline from the graphics pipeline's culled, filled variant, info,
+// without its fragment shader or color writes, and the pipeline drawing
+// boxes for occlusion queries, which tests depth without writing anything.
+func (app *HelloTriangleApplication) createOcclusionPipelines(info vk.GraphicsPipelineCreateInfo) error {
+	if !app.occlusionCulling() {
+		return nil
+	}
+
+	vertShaderModule, err := app.createShaderModule(app.shaderCode("occlusion.vert", shaders.Occlusion()))
+	if err != nil {
+		return errors.Wrap(err, "can't create occlusion vertex shader")
+	}
+	defer vk.DestroyShaderModule(app.device, vertShaderModule, nil)
+
+	layout, err := pipeline.NewLayout(app.device, nil, []vk.PushConstantRange{occlusionConstants.Range()})
+	if err != nil {
+		return err
+	}
+	app.occlusionLayout = layout
+
+	colorBlending := *info.PColorBlendState
+	colorBlending.PAttachments = make([]vk.PipelineColorBlendAttachmentState, colorBlending.AttachmentCount)
+
+	prepass := info
+	prepass.StageCount = 1
+	prepass.PStages = info.PStages[:1]
+	prepass.PColorBlendState = &colorBlending
+	prepass.PDepthStencilState = &vk.PipelineDepthStencilStateCreateInfo{
+		SType:            vk.StructureTypePipelineDepthStencilStateCreateInfo,
+		DepthTestEnable:  vk.True,
+		DepthWriteEnable: vk.True,
+		DepthCompareOp:   vk.CompareOpLess,
+	}
+
+	// Which way a box's triangles face doesn't matter, any sample passing
+	// counts
+	rasterization := *info.PRasterizationState
+	rasterization.CullMode = vk.CullModeFlags(vk.CullModeNone)
+	boxes := info
+	boxes.StageCount = 1
+	boxes.PStages = []vk.PipelineShaderStageCreateInfo{{
+		SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+		Stage:  vk.ShaderStageVertexBit,
+		Module: vertShaderModule,
+		PName:  "main\x00",
+	}}
+	boxes.PVertexInputState = &vk.PipelineVertexInputStateCreateInfo{
+		SType: vk.StructureTypePipelineVertexInputStateCreateInfo,
+	}
+	boxes.PRasterizationState = &rasterization
+	boxes.PColorBlendState = &colorBlending
+	boxes.PDepthStencilState = &vk.PipelineDepthStencilStateCreateInfo{
+		SType:            vk.StructureTypePipelineDepthStencilStateCreateInfo,
+		DepthTestEnable:  vk.True,
+		DepthWriteEnable: vk.False,
+		DepthCompareOp:   vk.CompareOpLessOrEqual,
+	}
+	boxes.Layout = app.occlusionLayout
+
+	pipelines := make([]vk.Pipeline, 2)
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, 2, []vk.GraphicsPipelineCreateInfo{prepass, boxes}, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create occlusion pipelines")
+	}
+	for _, p := range pipelines {
+		app.track("pipeline", p)
+	}
+	app.depthPrepassPipeline, app.occlusionPipeline = pipelines[0], pipelines[1]
+	app.name(app.occlusionLayout, "occlusion pipeline layout")
+	app.name(app.depthPrepassPipeline, "depth pre-pass pipeline")
+	app.name(app.occlusionPipeline, "occlusion pipeline")
+	return nil
+}
+
+// recordOcclusion draws the objects that will be drawn into the depth
+// buffer, then each of this frame's boxes against it inside its occlusion
+// query. Their results decide which objects are drawn when the frame comes
+// round again. It has to be recorded in the scene's render pass before the
+// draws.
+func (app *HelloTriangleApplication) recordOcclusion(cb vk.CommandBuffer, frame int) {
+	if !app.occlusionActive() || len(app.occlusionBoxes) == 0 {
+		return
+	}
+	scope := app.profiler.Begin(cb, "occlusion")
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.depthPrepassPipeline)
+	app.drawObjects(cb, frame, 0, app.mesh.IndexCount, false, true)
+
+	extent := app.target.Extent
+	viewProj := app.camera.Projection(float32(extent.Width) / float32(extent.Height)).Mul(app.camera.View())
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.occlusionPipeline)
+	for i, box := range app.occlusionBoxes {
+		occlusionConstants.Push(cb, app.occlusionLayout, OcclusionConstants{
+			ViewProj: viewProj,
+			Min:      box.Min.Vec4(1),
+			Max:      box.Max.Vec4(1),
+		})
+		app.occlusionQueries.Begin(cb, i)
+		vk.CmdDraw(cb, occlusionBoxVertices, 1, 0, 0)
+		app.occlusionQueries.End(cb, i)
+	}
+	app.countDraws(len(app.occlusionBoxes))
+	scope.End(cb)
+}
+
+func (app *HelloTriangleApplication) destroyOcclusionPipelines() {
+	for _, p := range []*vk.Pipeline{&app.depthPrepassPipeline, &app.occlusionPipeline} {
+		if *p != vk.NullPipeline {
+			app.destroyPipeline(*p)
+			*p = vk.NullPipeline
+		}
+	}
+	if app.occlusionLayout != vk.NullPipelineLayout {
+		app.destroyPipelineLayout(app.occlusionLayout)
+		app.occlusionLayout = vk.NullPipelineLayout
+	}
+}
+
+func (app *HelloTriangleApplication) destroyOcclusionQueries() {
+	app.occlusionQueries.Destroy()
+	app.occlusionQueries = nil
+	app.occlusionNodes = nil
+	app.occluded.Update(nil, nil)
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package openxr
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+var libraryNames = []string{"libopenxr_loader.so.1", "libopenxr_loader.so"}
+
+// getInstanceProcAddr loads the OpenXR loader and returns its
+// xrGetInstanceProcAddr. The library stays loaded for the life of the
+// process.
+func getInstanceProcAddr() (unsafe.Pointer, error) {
+	for _, name := range libraryNames {
+		cName := C.CString(name)
+		lib := C.dlopen(cName, C.RTLD_NOW|C.RTLD_LOCAL)
+		C.free(unsafe.Pointer(cName))
+		if lib == nil {
+			continue
+		}
+
+		cSymbol := C.CString("xrGetInstanceProcAddr")
+		proc := C.dlsym(lib, cSymbol)
+		C.free(unsafe.Pointer(cSymbol))
+		if proc == nil {
+			C.dlclose(lib)
+			return nil, errors.Errorf("'%s' has no xrGetInstanceProcAddr", name)
+		}
+		return proc, nil
+	}
+	return nil, errors.Errorf("can't load an OpenXR loader, tried %v", libraryNames)
+}
@@ -0,0 +1,26 @@
+package openxr
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// getInstanceProcAddr loads the OpenXR loader and returns its
+// xrGetInstanceProcAddr. The library stays loaded for the life of the
+// process.
+func getInstanceProcAddr() (unsafe.Pointer, error) {
+	dll, err := syscall.LoadDLL("openxr_loader.dll")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load openxr_loader.dll")
+	}
+	proc, err := dll.FindProc("xrGetInstanceProcAddr")
+	if err != nil {
+		dll.Release()
+		return nil, errors.Wrap(err, "openxr_loader.dll has no xrGetInstanceProcAddr")
+	}
+	// The address is of code in a DLL that's never unloaded, not Go memory
+	addr := proc.Addr()
+	return *(*unsafe.Pointer)(unsafe.Pointer(&addr)), nil
+}
@@ -0,0 +1,327 @@
+#include <stddef.h>
+#include <string.h>
+
+#include "openxr.h"
+
+typedef void (*PFN_xrVoidFunction)(void);
+typedef XrResult (*PFN_xrGetInstanceProcAddr)(XrInstance instance, const char* name, PFN_xrVoidFunction* function);
+typedef XrResult (*PFN_xrCreateInstance)(const XrInstanceCreateInfo* createInfo, XrInstance* instance);
+typedef XrResult (*PFN_xrDestroyInstance)(XrInstance instance);
+typedef XrResult (*PFN_xrGetSystem)(XrInstance instance, const XrSystemGetInfo* getInfo, XrSystemId* systemId);
+typedef XrResult (*PFN_xrPollEvent)(XrInstance instance, XrEventDataBuffer* eventData);
+typedef XrResult (*PFN_xrCreateSession)(XrInstance instance, const XrSessionCreateInfo* createInfo, XrSession* session);
+typedef XrResult (*PFN_xrDestroySession)(XrSession session);
+typedef XrResult (*PFN_xrBeginSession)(XrSession session, const void* beginInfo);
+typedef XrResult (*PFN_xrEndSession)(XrSession session);
+typedef XrResult (*PFN_xrCreateReferenceSpace)(XrSession session, const XrReferenceSpaceCreateInfo* createInfo, XrSpace* space);
+typedef XrResult (*PFN_xrDestroySpace)(XrSpace space);
+typedef XrResult (*PFN_xrEnumerateViewConfigurationViews)(XrInstance instance, XrSystemId systemId, int32_t viewConfigurationType, uint32_t capacity, uint32_t* count, XrViewConfigurationView* views);
+typedef XrResult (*PFN_xrEnumerateSwapchainFormats)(XrSession session, uint32_t capacity, uint32_t* count, int64_t* formats);
+typedef XrResult (*PFN_xrCreateSwapchain)(XrSession session, const XrSwapchainCreateInfo* createInfo, XrSwapchain* swapchain);
+typedef XrResult (*PFN_xrDestroySwapchain)(XrSwapchain swapchain);
+typedef XrResult (*PFN_xrEnumerateSwapchainImages)(XrSwapchain swapchain, uint32_t capacity, uint32_t* count, void* images);
+typedef XrResult (*PFN_xrAcquireSwapchainImage)(XrSwapchain swapchain, const void* acquireInfo, uint32_t* index);
+typedef XrResult (*PFN_xrWaitSwapchainImage)(XrSwapchain swapchain, const void* waitInfo);
+typedef XrResult (*PFN_xrReleaseSwapchainImage)(XrSwapchain swapchain, const void* releaseInfo);
+typedef XrResult (*PFN_xrWaitFrame)(XrSession session, const void* waitInfo, XrFrameState* frameState);
+typedef XrResult (*PFN_xrBeginFrame)(XrSession session, const void* beginInfo);
+typedef XrResult (*PFN_xrEndFrame)(XrSession session, const void* endInfo);
+typedef XrResult (*PFN_xrLocateViews)(XrSession session, const void* locateInfo, void* viewState, uint32_t capacity, uint32_t* count, XrView* views);
+typedef XrResult (*PFN_xrGetVulkanExtensionsKHR)(XrInstance instance, XrSystemId systemId, uint32_t capacity, uint32_t* count, char* buffer);
+typedef XrResult (*PFN_xrGetVulkanGraphicsDeviceKHR)(XrInstance instance, XrSystemId systemId, VkInstance vkInstance, VkPhysicalDevice* vkPhysicalDevice);
+typedef XrResult (*PFN_xrGetVulkanGraphicsRequirementsKHR)(XrInstance instance, XrSystemId systemId, XrGraphicsRequirementsVulkanKHR* requirements);
+
+// The structures that are only ever filled in here.
+typedef struct {
+	XrStructureType type;
+	const void* next;
+} XrBaseInfo;
+
+typedef struct {
+	XrStructureType type;
+	const void* next;
+	int32_t primaryViewConfigurationType;
+} XrSessionBeginInfo;
+
+typedef struct {
+	XrStructureType type;
+	const void* next;
+	XrDuration timeout;
+} XrSwapchainImageWaitInfo;
+
+typedef struct {
+	XrStructureType type;
+	const void* next;
+	int32_t viewConfigurationType;
+	XrTime displayTime;
+	XrSpace space;
+} XrViewLocateInfo;
+
+typedef struct {
+	XrStructureType type;
+	void* next;
+	XrFlags64 viewStateFlags;
+} XrViewState;
+
+typedef struct {
+	XrSwapchain swapchain;
+	int32_t x, y;
+	int32_t width, height;
+	uint32_t imageArrayIndex;
+} XrSwapchainSubImage;
+
+typedef struct {
+	XrStructureType type;
+	const void* next;
+	XrPosef pose;
+	XrFovf fov;
+	XrSwapchainSubImage subImage;
+} XrCompositionLayerProjectionView;
+
+typedef struct {
+	XrStructureType type;
+	const void* next;
+	XrFlags64 layerFlags;
+	XrSpace space;
+	uint32_t viewCount;
+	const XrCompositionLayerProjectionView* views;
+} XrCompositionLayerProjection;
+
+typedef struct {
+	XrStructureType type;
+	const void* next;
+	XrTime displayTime;
+	int32_t environmentBlendMode;
+	uint32_t layerCount;
+	const XrCompositionLayerProjection* const* layers;
+} XrFrameEndInfo;
+
+XrResult createXRInstance(void* getInstanceProcAddr, const char* applicationName, const char* extension, XrInstance* instance) {
+	PFN_xrCreateInstance create = NULL;
+	XrResult result = ((PFN_xrGetInstanceProcAddr)getInstanceProcAddr)(NULL, "xrCreateInstance", (PFN_xrVoidFunction*)&create);
+	if (result != LVXR_SUCCESS) {
+		return result;
+	}
+
+	XrInstanceCreateInfo info = {0};
+	info.type = LVXR_TYPE_INSTANCE_CREATE_INFO;
+	strncpy(info.applicationInfo.applicationName, applicationName, sizeof(info.applicationInfo.applicationName) - 1);
+	strncpy(info.applicationInfo.engineName, "Ingot", sizeof(info.applicationInfo.engineName) - 1);
+	info.applicationInfo.applicationVersion = 1;
+	info.applicationInfo.engineVersion = 1;
+	info.applicationInfo.apiVersion = LVXR_API_VERSION_1_0;
+	info.enabledExtensionCount = 1;
+	info.enabledExtensionNames = &extension;
+	return create(&info, instance);
+}
+
+XrResult loadXRFunctions(void* getInstanceProcAddr, XrInstance instance, LVFunctions* fn) {
+	PFN_xrGetInstanceProcAddr get = (PFN_xrGetInstanceProcAddr)getInstanceProcAddr;
+	struct {
+		const char* name;
+		void** function;
+	} all[] = {
+		{"xrDestroyInstance", &fn->destroyInstance},
+		{"xrGetSystem", &fn->getSystem},
+		{"xrPollEvent", &fn->pollEvent},
+		{"xrCreateSession", &fn->createSession},
+		{"xrDestroySession", &fn->destroySession},
+		{"xrBeginSession", &fn->beginSession},
+		{"xrEndSession", &fn->endSession},
+		{"xrCreateReferenceSpace", &fn->createReferenceSpace},
+		{"xrDestroySpace", &fn->destroySpace},
+		{"xrEnumerateViewConfigurationViews", &fn->enumerateViewConfigurationViews},
+		{"xrEnumerateSwapchainFormats", &fn->enumerateSwapchainFormats},
+		{"xrCreateSwapchain", &fn->createSwapchain},
+		{"xrDestroySwapchain", &fn->destroySwapchain},
+		{"xrEnumerateSwapchainImages", &fn->enumerateSwapchainImages},
+		{"xrAcquireSwapchainImage", &fn->acquireSwapchainImage},
+		{"xrWaitSwapchainImage", &fn->waitSwapchainImage},
+		{"xrReleaseSwapchainImage", &fn->releaseSwapchainImage},
+		{"xrWaitFrame", &fn->waitFrame},
+		{"xrBeginFrame", &fn->beginFrame},
+		{"xrEndFrame", &fn->endFrame},
+		{"xrLocateViews", &fn->locateViews},
+		{"xrGetVulkanInstanceExtensionsKHR", &fn->getVulkanInstanceExtensions},
+		{"xrGetVulkanDeviceExtensionsKHR", &fn->getVulkanDeviceExtensions},
+		{"xrGetVulkanGraphicsDeviceKHR", &fn->getVulkanGraphicsDevice},
+		{"xrGetVulkanGraphicsRequirementsKHR", &fn->getVulkanGraphicsRequirements},
+	};
+	for (size_t i = 0; i < sizeof(all) / sizeof(all[0]); i++) {
+		XrResult result = get(instance, all[i].name, (PFN_xrVoidFunction*)all[i].function);
+		if (result != LVXR_SUCCESS) {
+			return result;
+		}
+		if (*all[i].function == NULL) {
+			return LVXR_ERROR_FUNCTION_UNSUPPORTED;
+		}
+	}
+	return LVXR_SUCCESS;
+}
+
+void destroyXRInstance(const LVFunctions* fn, XrInstance instance) {
+	((PFN_xrDestroyInstance)fn->destroyInstance)(instance);
+}
+
+XrResult getHMDSystem(const LVFunctions* fn, XrInstance instance, XrSystemId* system) {
+	XrSystemGetInfo info = {LVXR_TYPE_SYSTEM_GET_INFO, NULL, LVXR_FORM_FACTOR_HEAD_MOUNTED_DISPLAY};
+	return ((PFN_xrGetSystem)fn->getSystem)(instance, &info, system);
+}
+
+XrResult pollXREvent(const LVFunctions* fn, XrInstance instance, XrEventDataBuffer* event) {
+	event->type = LVXR_TYPE_EVENT_DATA_BUFFER;
+	event->next = NULL;
+	return ((PFN_xrPollEvent)fn->pollEvent)(instance, event);
+}
+
+XrResult getVulkanExtensions(const LVFunctions* fn, XrInstance instance, XrSystemId system, int device, uint32_t capacity, uint32_t* count, char* buffer) {
+	void* get = device ? fn->getVulkanDeviceExtensions : fn->getVulkanInstanceExtensions;
+	return ((PFN_xrGetVulkanExtensionsKHR)get)(instance, system, capacity, count, buffer);
+}
+
+XrResult getVulkanGraphicsDevice(const LVFunctions* fn, XrInstance instance, XrSystemId system, VkInstance vkInstance, VkPhysicalDevice* physicalDevice) {
+	return ((PFN_xrGetVulkanGraphicsDeviceKHR)fn->getVulkanGraphicsDevice)(instance, system, vkInstance, physicalDevice);
+}
+
+XrResult getVulkanGraphicsRequirements(const LVFunctions* fn, XrInstance instance, XrSystemId system, XrVersion* min, XrVersion* max) {
+	XrGraphicsRequirementsVulkanKHR requirements = {LVXR_TYPE_GRAPHICS_REQUIREMENTS_VULKAN_KHR, NULL, 0, 0};
+	XrResult result = ((PFN_xrGetVulkanGraphicsRequirementsKHR)fn->getVulkanGraphicsRequirements)(instance, system, &requirements);
+	*min = requirements.minApiVersionSupported;
+	*max = requirements.maxApiVersionSupported;
+	return result;
+}
+
+XrResult createXRSession(const LVFunctions* fn, XrInstance instance, XrSystemId system, VkInstance vkInstance, VkPhysicalDevice physicalDevice, VkDevice device, uint32_t queueFamilyIndex, uint32_t queueIndex, XrSession* session) {
+	XrGraphicsBindingVulkanKHR binding = {
+		LVXR_TYPE_GRAPHICS_BINDING_VULKAN_KHR, NULL,
+		vkInstance, physicalDevice, device, queueFamilyIndex, queueIndex,
+	};
+	XrSessionCreateInfo info = {LVXR_TYPE_SESSION_CREATE_INFO, &binding, 0, system};
+	return ((PFN_xrCreateSession)fn->createSession)(instance, &info, session);
+}
+
+void destroyXRSession(const LVFunctions* fn, XrSession session) {
+	((PFN_xrDestroySession)fn->destroySession)(session);
+}
+
+XrResult beginStereoSession(const LVFunctions* fn, XrSession session) {
+	XrSessionBeginInfo info = {LVXR_TYPE_SESSION_BEGIN_INFO, NULL, LVXR_VIEW_CONFIGURATION_TYPE_PRIMARY_STEREO};
+	return ((PFN_xrBeginSession)fn->beginSession)(session, &info);
+}
+
+XrResult endXRSession(const LVFunctions* fn, XrSession session) {
+	return ((PFN_xrEndSession)fn->endSession)(session);
+}
+
+XrResult createLocalSpace(const LVFunctions* fn, XrSession session, XrSpace* space) {
+	XrReferenceSpaceCreateInfo info = {0};
+	info.type = LVXR_TYPE_REFERENCE_SPACE_CREATE_INFO;
+	info.referenceSpaceType = LVXR_REFERENCE_SPACE_TYPE_LOCAL;
+	info.poseInReferenceSpace.orientation.w = 1;
+	return ((PFN_xrCreateReferenceSpace)fn->createReferenceSpace)(session, &info, space);
+}
+
+void destroyXRSpace(const LVFunctions* fn, XrSpace space) {
+	((PFN_xrDestroySpace)fn->destroySpace)(space);
+}
+
+XrResult enumerateStereoViews(const LVFunctions* fn, XrInstance instance, XrSystemId system, uint32_t capacity, uint32_t* count, XrViewConfigurationView* views) {
+	for (uint32_t i = 0; i < capacity; i++) {
+		views[i].type = LVXR_TYPE_VIEW_CONFIGURATION_VIEW;
+		views[i].next = NULL;
+	}
+	return ((PFN_xrEnumerateViewConfigurationViews)fn->enumerateViewConfigurationViews)(instance, system, LVXR_VIEW_CONFIGURATION_TYPE_PRIMARY_STEREO, capacity, count, views);
+}
+
+XrResult enumerateSwapchainFormats(const LVFunctions* fn, XrSession session, uint32_t capacity, uint32_t* count, int64_t* formats) {
+	return ((PFN_xrEnumerateSwapchainFormats)fn->enumerateSwapchainFormats)(session, capacity, count, formats);
+}
+
+XrResult createXRSwapchain(const LVFunctions* fn, XrSession session, int64_t format, uint32_t width, uint32_t height, XrSwapchain* swapchain) {
+	XrSwapchainCreateInfo info = {0};
+	info.type = LVXR_TYPE_SWAPCHAIN_CREATE_INFO;
+	info.usageFlags = LVXR_SWAPCHAIN_USAGE_COLOR_ATTACHMENT_BIT | LVXR_SWAPCHAIN_USAGE_TRANSFER_DST_BIT;
+	info.format = format;
+	info.sampleCount = 1;
+	info.width = width;
+	info.height = height;
+	info.faceCount = 1;
+	info.arraySize = 1;
+	info.mipCount = 1;
+	return ((PFN_xrCreateSwapchain)fn->createSwapchain)(session, &info, swapchain);
+}
+
+void destroyXRSwapchain(const LVFunctions* fn, XrSwapchain swapchain) {
+	((PFN_xrDestroySwapchain)fn->destroySwapchain)(swapchain);
+}
+
+XrResult enumerateSwapchainImages(const LVFunctions* fn, XrSwapchain swapchain, uint32_t capacity, uint32_t* count, XrSwapchainImageVulkanKHR* images) {
+	for (uint32_t i = 0; i < capacity; i++) {
+		images[i].type = LVXR_TYPE_SWAPCHAIN_IMAGE_VULKAN_KHR;
+		images[i].next = NULL;
+	}
+	return ((PFN_xrEnumerateSwapchainImages)fn->enumerateSwapchainImages)(swapchain, capacity, count, images);
+}
+
+XrResult acquireSwapchainImage(const LVFunctions* fn, XrSwapchain swapchain, uint32_t* index) {
+	XrBaseInfo acquire = {LVXR_TYPE_SWAPCHAIN_IMAGE_ACQUIRE_INFO, NULL};
+	XrResult result = ((PFN_xrAcquireSwapchainImage)fn->acquireSwapchainImage)(swapchain, &acquire, index);
+	if (result != LVXR_SUCCESS) {
+		return result;
+	}
+	XrSwapchainImageWaitInfo wait = {LVXR_TYPE_SWAPCHAIN_IMAGE_WAIT_INFO, NULL, LVXR_INFINITE_DURATION};
+	return ((PFN_xrWaitSwapchainImage)fn->waitSwapchainImage)(swapchain, &wait);
+}
+
+XrResult releaseSwapchainImage(const LVFunctions* fn, XrSwapchain swapchain) {
+	XrBaseInfo release = {LVXR_TYPE_SWAPCHAIN_IMAGE_RELEASE_INFO, NULL};
+	return ((PFN_xrReleaseSwapchainImage)fn->releaseSwapchainImage)(swapchain, &release);
+}
+
+XrResult waitXRFrame(const LVFunctions* fn, XrSession session, XrFrameState* state) {
+	XrBaseInfo wait = {LVXR_TYPE_FRAME_WAIT_INFO, NULL};
+	state->type = LVXR_TYPE_FRAME_STATE;
+	state->next = NULL;
+	return ((PFN_xrWaitFrame)fn->waitFrame)(session, &wait, state);
+}
+
+XrResult beginXRFrame(const LVFunctions* fn, XrSession session) {
+	XrBaseInfo begin = {LVXR_TYPE_FRAME_BEGIN_INFO, NULL};
+	return ((PFN_xrBeginFrame)fn->beginFrame)(session, &begin);
+}
+
+XrResult locateStereoViews(const LVFunctions* fn, XrSession session, XrTime displayTime, XrSpace space, XrView* views, XrFlags64* flags) {
+	XrViewLocateInfo info = {LVXR_TYPE_VIEW_LOCATE_INFO, NULL, LVXR_VIEW_CONFIGURATION_TYPE_PRIMARY_STEREO, displayTime, space};
+	XrViewState state = {LVXR_TYPE_VIEW_STATE, NULL, 0};
+	for (int i = 0; i < 2; i++) {
+		views[i].type = LVXR_TYPE_VIEW;
+		views[i].next = NULL;
+	}
+	uint32_t count = 0;
+	XrResult result = ((PFN_xrLocateViews)fn->locateViews)(session, &info, &state, 2, &count, views);
+	*flags = state.viewStateFlags;
+	return result;
+}
+
+XrResult endStereoFrame(const LVFunctions* fn, XrSession session, XrTime displayTime, XrSpace space, const XrView* views, const XrSwapchain* swapchains, int32_t width, int32_t height) {
+	XrCompositionLayerProjectionView projectionViews[2];
+	XrCompositionLayerProjection layer = {LVXR_TYPE_COMPOSITION_LAYER_PROJECTION, NULL, 0, space, 2, projectionViews};
+	const XrCompositionLayerProjection* layers[] = {&layer};
+	XrFrameEndInfo info = {LVXR_TYPE_FRAME_END_INFO, NULL, displayTime, LVXR_ENVIRONMENT_BLEND_MODE_OPAQUE, 0, layers};
+
+	// Without swapchains nothing was rendered and the frame is ended empty
+	if (swapchains != NULL) {
+		for (int i = 0; i < 2; i++) {
+			XrCompositionLayerProjectionView view = {0};
+			view.type = LVXR_TYPE_COMPOSITION_LAYER_PROJECTION_VIEW;
+			view.pose = views[i].pose;
+			view.fov = views[i].fov;
+			view.subImage.swapchain = swapchains[i];
+			view.subImage.width = width;
+			view.subImage.height = height;
+			projectionViews[i] = view;
+		}
+		info.layerCount = 1;
+	}
+	return ((PFN_xrEndFrame)fn->endFrame)(session, &info);
+}
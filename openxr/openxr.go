@@ -0,0 +1,420 @@
+// Package openxr implements the parts of OpenXR and XR_KHR_vulkan_enable
+// the renderer uses to draw to a headset. The OpenXR loader is opened at
+// run time and everything goes through xrGetInstanceProcAddr, so building
+// doesn't need the OpenXR SDK and running doesn't need a runtime unless a
+// session is asked for.
+package openxr
+
+/*
+#include <stdlib.h>
+#include "openxr.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Extension is the OpenXR extension the instance is created with.
+const Extension = "XR_KHR_vulkan_enable"
+
+// ViewCount is the number of views of the primary stereo configuration.
+const ViewCount = 2
+
+// XrSessionState values handled by PollEvents.
+const (
+	sessionReady       = 2
+	sessionStopping    = 6
+	sessionLossPending = 7
+	sessionExiting     = 8
+)
+
+// Result is an XrResult that isn't XR_SUCCESS.
+type Result int32
+
+func (r Result) Error() string {
+	return fmt.Sprintf("XrResult %d", int32(r))
+}
+
+// check returns nil for XR_SUCCESS and qualified successes like
+// XR_EVENT_UNAVAILABLE, the Result for failures.
+func check(result C.XrResult) error {
+	if result < 0 {
+		return Result(result)
+	}
+	return nil
+}
+
+// Instance is an OpenXR instance and the head mounted display it found.
+type Instance struct {
+	handle C.XrInstance
+	system C.XrSystemId
+	fn     C.LVFunctions
+}
+
+// NewInstance loads the OpenXR loader and creates an instance with
+// Extension, then gets the head mounted display. Either failing means
+// there's no runtime or no headset to draw to.
+func NewInstance(appName string) (*Instance, error) {
+	getInstanceProcAddr, err := getInstanceProcAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	cName := C.CString(appName)
+	defer C.free(unsafe.Pointer(cName))
+	cExtension := C.CString(Extension)
+	defer C.free(unsafe.Pointer(cExtension))
+
+	i := &Instance{}
+	if err := check(C.createXRInstance(getInstanceProcAddr, cName, cExtension, &i.handle)); err != nil {
+		return nil, errors.Wrap(err, "can't create OpenXR instance")
+	}
+	if err := check(C.loadXRFunctions(getInstanceProcAddr, i.handle, &i.fn)); err != nil {
+		i.handle = nil
+		return nil, errors.Wrap(err, "can't load OpenXR functions")
+	}
+	if err := check(C.getHMDSystem(&i.fn, i.handle, &i.system)); err != nil {
+		i.Destroy()
+		return nil, errors.Wrap(err, "can't find a head mounted display")
+	}
+	return i, nil
+}
+
+// VulkanInstanceExtensions are the instance extensions the runtime needs
+// the VkInstance created with.
+func (i *Instance) VulkanInstanceExtensions() ([]string, error) {
+	return i.vulkanExtensions(0)
+}
+
+// VulkanDeviceExtensions are the device extensions the runtime needs the
+// VkDevice created with.
+func (i *Instance) VulkanDeviceExtensions() ([]string, error) {
+	return i.vulkanExtensions(1)
+}
+
+func (i *Instance) vulkanExtensions(device C.int) ([]string, error) {
+	var count C.uint32_t
+	if err := check(C.getVulkanExtensions(&i.fn, i.handle, i.system, device, 0, &count, nil)); err != nil {
+		return nil, errors.Wrap(err, "can't get OpenXR's Vulkan extensions")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, count)
+	if err := check(C.getVulkanExtensions(&i.fn, i.handle, i.system, device, count, &count,
+		(*C.char)(unsafe.Pointer(&buf[0])))); err != nil {
+		return nil, errors.Wrap(err, "can't get OpenXR's Vulkan extensions")
+	}
+	// A space separated, null terminated list
+	return strings.Fields(strings.TrimRight(string(buf[:count]), "\x00")), nil
+}
+
+// PhysicalDevice is the device of vkInstance the headset is plugged into,
+// the one the session has to be created on.
+func (i *Instance) PhysicalDevice(vkInstance vk.Instance) (vk.PhysicalDevice, error) {
+	var min, max C.XrVersion
+	if err := check(C.getVulkanGraphicsRequirements(&i.fn, i.handle, i.system, &min, &max)); err != nil {
+		return nil, errors.Wrap(err, "can't get OpenXR's Vulkan requirements")
+	}
+	// XrVersion is major.minor.patch in 16.16.32 bits
+	if major, minor := uint64(min)>>48, (uint64(min)>>32)&0xffff; major > 1 || (major == 1 && minor > 1) {
+		return nil, errors.Errorf("OpenXR runtime needs Vulkan %d.%d", major, minor)
+	}
+
+	var physicalDevice C.VkPhysicalDevice
+	if err := check(C.getVulkanGraphicsDevice(&i.fn, i.handle, i.system,
+		C.VkInstance(unsafe.Pointer(vkInstance)), &physicalDevice)); err != nil {
+		return nil, errors.Wrap(err, "can't get OpenXR's Vulkan device")
+	}
+	return vk.PhysicalDevice(unsafe.Pointer(physicalDevice)), nil
+}
+
+// GraphicsBinding is the Vulkan device and queue a session renders with.
+type GraphicsBinding struct {
+	Instance       vk.Instance
+	PhysicalDevice vk.PhysicalDevice
+	Device         vk.Device
+	QueueFamily    uint32
+	QueueIndex     uint32
+}
+
+// Destroy destroys the instance, after its sessions.
+func (i *Instance) Destroy() {
+	if i.handle != nil {
+		C.destroyXRInstance(&i.fn, i.handle)
+		i.handle = nil
+	}
+}
+
+// Session is a session on the head mounted display's primary stereo view
+// configuration, with a local reference space.
+type Session struct {
+	instance *Instance
+	handle   C.XrSession
+	space    C.XrSpace
+	running  bool
+	// Width and Height are the recommended size of each eye's image.
+	Width, Height uint32
+}
+
+// NewSession creates a session rendering with binding's device, which has
+// to be on PhysicalDevice and have VulkanDeviceExtensions enabled.
+func (i *Instance) NewSession(binding GraphicsBinding) (*Session, error) {
+	var views [ViewCount]C.XrViewConfigurationView
+	var count C.uint32_t
+	if err := check(C.enumerateStereoViews(&i.fn, i.handle, i.system, ViewCount, &count, &views[0])); err != nil {
+		return nil, errors.Wrap(err, "can't get OpenXR's stereo views")
+	}
+	if count != ViewCount {
+		return nil, errors.Errorf("OpenXR has %d stereo views", count)
+	}
+
+	s := &Session{
+		instance: i,
+		Width:    uint32(views[0].recommendedImageRectWidth),
+		Height:   uint32(views[0].recommendedImageRectHeight),
+	}
+	if err := check(C.createXRSession(&i.fn, i.handle, i.system,
+		C.VkInstance(unsafe.Pointer(binding.Instance)), C.VkPhysicalDevice(unsafe.Pointer(binding.PhysicalDevice)),
+		C.VkDevice(unsafe.Pointer(binding.Device)), C.uint32_t(binding.QueueFamily), C.uint32_t(binding.QueueIndex),
+		&s.handle)); err != nil {
+		return nil, errors.Wrap(err, "can't create OpenXR session")
+	}
+	if err := check(C.createLocalSpace(&i.fn, s.handle, &s.space)); err != nil {
+		s.Destroy()
+		return nil, errors.Wrap(err, "can't create OpenXR reference space")
+	}
+	return s, nil
+}
+
+// Formats are the swapchain formats the runtime supports, in its order of
+// preference.
+func (s *Session) Formats() ([]vk.Format, error) {
+	fn := &s.instance.fn
+	var count C.uint32_t
+	if err := check(C.enumerateSwapchainFormats(fn, s.handle, 0, &count, nil)); err != nil {
+		return nil, errors.Wrap(err, "can't get OpenXR swapchain formats")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	cFormats := make([]C.int64_t, count)
+	if err := check(C.enumerateSwapchainFormats(fn, s.handle, count, &count, &cFormats[0])); err != nil {
+		return nil, errors.Wrap(err, "can't get OpenXR swapchain formats")
+	}
+	formats := make([]vk.Format, count)
+	for i := range formats {
+		formats[i] = vk.Format(cFormats[i])
+	}
+	return formats, nil
+}
+
+// Running reports whether the session has begun, when frames have to be
+// waited for, begun and ended.
+func (s *Session) Running() bool {
+	return s.running
+}
+
+// PollEvents handles the events that arrived since it was last called,
+// beginning and ending the session as the runtime says. exit is true once
+// the session is over and the application should quit.
+func (s *Session) PollEvents() (exit bool, err error) {
+	fn := &s.instance.fn
+	for {
+		var event C.XrEventDataBuffer
+		result := C.pollXREvent(fn, s.instance.handle, &event)
+		if err := check(result); err != nil {
+			return false, errors.Wrap(err, "can't poll OpenXR events")
+		}
+		if result != C.LVXR_SUCCESS {
+			return exit, nil
+		}
+
+		switch event._type {
+		case C.LVXR_TYPE_EVENT_DATA_INSTANCE_LOSS_PENDING:
+			exit = true
+		case C.LVXR_TYPE_EVENT_DATA_SESSION_STATE_CHANGED:
+			changed := (*C.XrEventDataSessionStateChanged)(unsafe.Pointer(&event))
+			switch changed.state {
+			case sessionReady:
+				if err := check(C.beginStereoSession(fn, s.handle)); err != nil {
+					return false, errors.Wrap(err, "can't begin OpenXR session")
+				}
+				s.running = true
+			case sessionStopping:
+				s.running = false
+				if err := check(C.endXRSession(fn, s.handle)); err != nil {
+					return false, errors.Wrap(err, "can't end OpenXR session")
+				}
+			case sessionExiting, sessionLossPending:
+				exit = true
+			}
+		}
+	}
+}
+
+// View is where an eye is and what it sees, in the local reference space.
+type View struct {
+	// Orientation is a quaternion, x, y, z, w.
+	Orientation [4]float32
+	Position    [3]float32
+	// Fov are the angles in radians of the sides of the eye's frustum,
+	// left and down negative.
+	Fov struct{ Left, Right, Up, Down float32 }
+}
+
+// Frame is a frame begun by BeginFrame.
+type Frame struct {
+	DisplayTime int64
+	// ShouldRender is false when the runtime won't show the frame, it
+	// still has to be ended.
+	ShouldRender bool
+	Views        [ViewCount]View
+	views        [ViewCount]C.XrView
+}
+
+// BeginFrame waits for the runtime to be ready for the next frame, which
+// paces the caller to the headset's refresh, then begins it and locates
+// the eyes at its predicted display time.
+func (s *Session) BeginFrame() (*Frame, error) {
+	fn := &s.instance.fn
+	var state C.XrFrameState
+	if err := check(C.waitXRFrame(fn, s.handle, &state)); err != nil {
+		return nil, errors.Wrap(err, "can't wait for OpenXR frame")
+	}
+	if err := check(C.beginXRFrame(fn, s.handle)); err != nil {
+		return nil, errors.Wrap(err, "can't begin OpenXR frame")
+	}
+
+	f := &Frame{
+		DisplayTime:  int64(state.predictedDisplayTime),
+		ShouldRender: state.shouldRender != 0,
+	}
+	if !f.ShouldRender {
+		return f, nil
+	}
+	var flags C.XrFlags64
+	if err := check(C.locateStereoViews(fn, s.handle, state.predictedDisplayTime, s.space, &f.views[0], &flags)); err != nil {
+		return nil, errors.Wrap(err, "can't locate OpenXR views")
+	}
+	// Without tracking there's nothing to render from
+	if flags&C.LVXR_VIEW_STATE_ORIENTATION_VALID_BIT == 0 {
+		f.ShouldRender = false
+		return f, nil
+	}
+	for i, v := range f.views {
+		f.Views[i].Orientation = [4]float32{float32(v.pose.orientation.x), float32(v.pose.orientation.y),
+			float32(v.pose.orientation.z), float32(v.pose.orientation.w)}
+		f.Views[i].Position = [3]float32{float32(v.pose.position.x), float32(v.pose.position.y), float32(v.pose.position.z)}
+		f.Views[i].Fov.Left = float32(v.fov.angleLeft)
+		f.Views[i].Fov.Right = float32(v.fov.angleRight)
+		f.Views[i].Fov.Up = float32(v.fov.angleUp)
+		f.Views[i].Fov.Down = float32(v.fov.angleDown)
+	}
+	return f, nil
+}
+
+// EndFrame submits frame with an eye drawn to each of swapchains' released
+// images, or with nothing when swapchains is nil.
+func (s *Session) EndFrame(frame *Frame, swapchains []*Swapchain) error {
+	var handles [ViewCount]C.XrSwapchain
+	var cSwapchains *C.XrSwapchain
+	var width, height uint32
+	if frame.ShouldRender && len(swapchains) == ViewCount {
+		for i, sc := range swapchains {
+			handles[i] = sc.handle
+		}
+		cSwapchains = &handles[0]
+		width, height = swapchains[0].Width, swapchains[0].Height
+	}
+	if err := check(C.endStereoFrame(&s.instance.fn, s.handle, C.XrTime(frame.DisplayTime), s.space,
+		&frame.views[0], cSwapchains, C.int32_t(width), C.int32_t(height))); err != nil {
+		return errors.Wrap(err, "can't end OpenXR frame")
+	}
+	return nil
+}
+
+// Destroy destroys the session, after its swapchains.
+func (s *Session) Destroy() {
+	fn := &s.instance.fn
+	if s.space != nil {
+		C.destroyXRSpace(fn, s.space)
+		s.space = nil
+	}
+	if s.handle != nil {
+		C.destroyXRSession(fn, s.handle)
+		s.handle = nil
+	}
+}
+
+// Swapchain is a set of images the runtime hands out one at a time to draw
+// an eye into.
+type Swapchain struct {
+	session *Session
+	handle  C.XrSwapchain
+	Images  []vk.Image
+	Width   uint32
+	Height  uint32
+}
+
+// NewSwapchain creates a swapchain of the recommended size, its images can
+// be rendered to and blitted to.
+func (s *Session) NewSwapchain(format vk.Format) (*Swapchain, error) {
+	fn := &s.instance.fn
+	sc := &Swapchain{session: s, Width: s.Width, Height: s.Height}
+	if err := check(C.createXRSwapchain(fn, s.handle, C.int64_t(format), C.uint32_t(s.Width), C.uint32_t(s.Height),
+		&sc.handle)); err != nil {
+		return nil, errors.Wrap(err, "can't create OpenXR swapchain")
+	}
+
+	var count C.uint32_t
+	if err := check(C.enumerateSwapchainImages(fn, sc.handle, 0, &count, nil)); err != nil {
+		sc.Destroy()
+		return nil, errors.Wrap(err, "can't get OpenXR swapchain images")
+	}
+	images := make([]C.XrSwapchainImageVulkanKHR, count)
+	if count > 0 {
+		if err := check(C.enumerateSwapchainImages(fn, sc.handle, count, &count, &images[0])); err != nil {
+			sc.Destroy()
+			return nil, errors.Wrap(err, "can't get OpenXR swapchain images")
+		}
+	}
+	sc.Images = make([]vk.Image, count)
+	for i := range sc.Images {
+		sc.Images[i] = vk.Image(unsafe.Pointer(images[i].image))
+	}
+	return sc, nil
+}
+
+// Acquire returns the index of the image to draw into next, waiting until
+// the runtime is done reading it.
+func (sc *Swapchain) Acquire() (uint32, error) {
+	var index C.uint32_t
+	if err := check(C.acquireSwapchainImage(&sc.session.instance.fn, sc.handle, &index)); err != nil {
+		return 0, errors.Wrap(err, "can't acquire OpenXR swapchain image")
+	}
+	return uint32(index), nil
+}
+
+// Release hands the acquired image back to the runtime, the work drawing
+// it has to have been submitted.
+func (sc *Swapchain) Release() error {
+	if err := check(C.releaseSwapchainImage(&sc.session.instance.fn, sc.handle)); err != nil {
+		return errors.Wrap(err, "can't release OpenXR swapchain image")
+	}
+	return nil
+}
+
+// Destroy destroys the swapchain.
+func (sc *Swapchain) Destroy() {
+	if sc.handle != nil {
+		C.destroyXRSwapchain(&sc.session.instance.fn, sc.handle)
+		sc.handle = nil
+	}
+}
@@ -0,0 +1,261 @@
+// The subset of OpenXR 1.0 and XR_KHR_vulkan_enable the package needs,
+// declared here so it builds without the OpenXR SDK. Layouts follow
+// openxr.h and openxr_platform.h.
+#ifndef LEARNVULKAN_OPENXR_H
+#define LEARNVULKAN_OPENXR_H
+
+#include <stdint.h>
+
+typedef struct VkInstance_T* VkInstance;
+typedef struct VkPhysicalDevice_T* VkPhysicalDevice;
+typedef struct VkDevice_T* VkDevice;
+typedef struct VkImage_T* VkImage;
+
+typedef struct XrInstance_T* XrInstance;
+typedef struct XrSession_T* XrSession;
+typedef struct XrSpace_T* XrSpace;
+typedef struct XrSwapchain_T* XrSwapchain;
+typedef uint64_t XrVersion;
+typedef uint64_t XrFlags64;
+typedef uint64_t XrSystemId;
+typedef int64_t XrTime;
+typedef int64_t XrDuration;
+typedef uint32_t XrBool32;
+typedef int32_t XrResult;
+typedef int32_t XrStructureType;
+
+#define LVXR_TYPE_INSTANCE_CREATE_INFO 3
+#define LVXR_TYPE_SYSTEM_GET_INFO 4
+#define LVXR_TYPE_VIEW_LOCATE_INFO 6
+#define LVXR_TYPE_VIEW 7
+#define LVXR_TYPE_SESSION_CREATE_INFO 8
+#define LVXR_TYPE_SWAPCHAIN_CREATE_INFO 9
+#define LVXR_TYPE_SESSION_BEGIN_INFO 10
+#define LVXR_TYPE_VIEW_STATE 11
+#define LVXR_TYPE_FRAME_END_INFO 12
+#define LVXR_TYPE_EVENT_DATA_BUFFER 16
+#define LVXR_TYPE_EVENT_DATA_INSTANCE_LOSS_PENDING 17
+#define LVXR_TYPE_EVENT_DATA_SESSION_STATE_CHANGED 18
+#define LVXR_TYPE_FRAME_WAIT_INFO 33
+#define LVXR_TYPE_COMPOSITION_LAYER_PROJECTION 35
+#define LVXR_TYPE_REFERENCE_SPACE_CREATE_INFO 37
+#define LVXR_TYPE_VIEW_CONFIGURATION_VIEW 41
+#define LVXR_TYPE_FRAME_STATE 44
+#define LVXR_TYPE_FRAME_BEGIN_INFO 46
+#define LVXR_TYPE_COMPOSITION_LAYER_PROJECTION_VIEW 48
+#define LVXR_TYPE_SWAPCHAIN_IMAGE_ACQUIRE_INFO 55
+#define LVXR_TYPE_SWAPCHAIN_IMAGE_WAIT_INFO 56
+#define LVXR_TYPE_SWAPCHAIN_IMAGE_RELEASE_INFO 57
+#define LVXR_TYPE_GRAPHICS_BINDING_VULKAN_KHR 1000025000
+#define LVXR_TYPE_SWAPCHAIN_IMAGE_VULKAN_KHR 1000025001
+#define LVXR_TYPE_GRAPHICS_REQUIREMENTS_VULKAN_KHR 1000025002
+
+#define LVXR_SUCCESS 0
+#define LVXR_EVENT_UNAVAILABLE 4
+#define LVXR_ERROR_FUNCTION_UNSUPPORTED -7
+#define LVXR_FORM_FACTOR_HEAD_MOUNTED_DISPLAY 1
+#define LVXR_VIEW_CONFIGURATION_TYPE_PRIMARY_STEREO 2
+#define LVXR_REFERENCE_SPACE_TYPE_LOCAL 2
+#define LVXR_ENVIRONMENT_BLEND_MODE_OPAQUE 1
+#define LVXR_SWAPCHAIN_USAGE_COLOR_ATTACHMENT_BIT 0x00000001
+#define LVXR_SWAPCHAIN_USAGE_TRANSFER_DST_BIT 0x00000010
+#define LVXR_VIEW_STATE_ORIENTATION_VALID_BIT 0x00000001
+#define LVXR_INFINITE_DURATION 0x7fffffffffffffffLL
+#define LVXR_API_VERSION_1_0 ((XrVersion)1 << 48)
+
+typedef struct XrQuaternionf {
+	float x, y, z, w;
+} XrQuaternionf;
+
+typedef struct XrVector3f {
+	float x, y, z;
+} XrVector3f;
+
+typedef struct XrPosef {
+	XrQuaternionf orientation;
+	XrVector3f position;
+} XrPosef;
+
+typedef struct XrFovf {
+	float angleLeft;
+	float angleRight;
+	float angleUp;
+	float angleDown;
+} XrFovf;
+
+typedef struct XrApplicationInfo {
+	char applicationName[128];
+	uint32_t applicationVersion;
+	char engineName[128];
+	uint32_t engineVersion;
+	XrVersion apiVersion;
+} XrApplicationInfo;
+
+typedef struct XrInstanceCreateInfo {
+	XrStructureType type;
+	const void* next;
+	XrFlags64 createFlags;
+	XrApplicationInfo applicationInfo;
+	uint32_t enabledApiLayerCount;
+	const char* const* enabledApiLayerNames;
+	uint32_t enabledExtensionCount;
+	const char* const* enabledExtensionNames;
+} XrInstanceCreateInfo;
+
+typedef struct XrSystemGetInfo {
+	XrStructureType type;
+	const void* next;
+	int32_t formFactor;
+} XrSystemGetInfo;
+
+typedef struct XrGraphicsRequirementsVulkanKHR {
+	XrStructureType type;
+	void* next;
+	XrVersion minApiVersionSupported;
+	XrVersion maxApiVersionSupported;
+} XrGraphicsRequirementsVulkanKHR;
+
+typedef struct XrGraphicsBindingVulkanKHR {
+	XrStructureType type;
+	const void* next;
+	VkInstance instance;
+	VkPhysicalDevice physicalDevice;
+	VkDevice device;
+	uint32_t queueFamilyIndex;
+	uint32_t queueIndex;
+} XrGraphicsBindingVulkanKHR;
+
+typedef struct XrSessionCreateInfo {
+	XrStructureType type;
+	const void* next;
+	XrFlags64 createFlags;
+	XrSystemId systemId;
+} XrSessionCreateInfo;
+
+typedef struct XrReferenceSpaceCreateInfo {
+	XrStructureType type;
+	const void* next;
+	int32_t referenceSpaceType;
+	XrPosef poseInReferenceSpace;
+} XrReferenceSpaceCreateInfo;
+
+typedef struct XrViewConfigurationView {
+	XrStructureType type;
+	void* next;
+	uint32_t recommendedImageRectWidth;
+	uint32_t maxImageRectWidth;
+	uint32_t recommendedImageRectHeight;
+	uint32_t maxImageRectHeight;
+	uint32_t recommendedSwapchainSampleCount;
+	uint32_t maxSwapchainSampleCount;
+} XrViewConfigurationView;
+
+typedef struct XrSwapchainCreateInfo {
+	XrStructureType type;
+	const void* next;
+	XrFlags64 createFlags;
+	XrFlags64 usageFlags;
+	int64_t format;
+	uint32_t sampleCount;
+	uint32_t width;
+	uint32_t height;
+	uint32_t faceCount;
+	uint32_t arraySize;
+	uint32_t mipCount;
+} XrSwapchainCreateInfo;
+
+typedef struct XrSwapchainImageVulkanKHR {
+	XrStructureType type;
+	void* next;
+	VkImage image;
+} XrSwapchainImageVulkanKHR;
+
+typedef struct XrEventDataBuffer {
+	XrStructureType type;
+	const void* next;
+	uint8_t varying[4000];
+} XrEventDataBuffer;
+
+typedef struct XrEventDataSessionStateChanged {
+	XrStructureType type;
+	const void* next;
+	XrSession session;
+	int32_t state;
+	XrTime time;
+} XrEventDataSessionStateChanged;
+
+typedef struct XrFrameState {
+	XrStructureType type;
+	void* next;
+	XrTime predictedDisplayTime;
+	XrDuration predictedDisplayPeriod;
+	XrBool32 shouldRender;
+} XrFrameState;
+
+typedef struct XrView {
+	XrStructureType type;
+	void* next;
+	XrPosef pose;
+	XrFovf fov;
+} XrView;
+
+// Function pointers loaded for an instance by loadXRFunctions.
+typedef struct LVFunctions {
+	void* destroyInstance;
+	void* getSystem;
+	void* pollEvent;
+	void* createSession;
+	void* destroySession;
+	void* beginSession;
+	void* endSession;
+	void* createReferenceSpace;
+	void* destroySpace;
+	void* enumerateViewConfigurationViews;
+	void* enumerateSwapchainFormats;
+	void* createSwapchain;
+	void* destroySwapchain;
+	void* enumerateSwapchainImages;
+	void* acquireSwapchainImage;
+	void* waitSwapchainImage;
+	void* releaseSwapchainImage;
+	void* waitFrame;
+	void* beginFrame;
+	void* endFrame;
+	void* locateViews;
+	void* getVulkanInstanceExtensions;
+	void* getVulkanDeviceExtensions;
+	void* getVulkanGraphicsDevice;
+	void* getVulkanGraphicsRequirements;
+} LVFunctions;
+
+XrResult createXRInstance(void* getInstanceProcAddr, const char* applicationName, const char* extension, XrInstance* instance);
+XrResult loadXRFunctions(void* getInstanceProcAddr, XrInstance instance, LVFunctions* fn);
+
+void destroyXRInstance(const LVFunctions* fn, XrInstance instance);
+XrResult getHMDSystem(const LVFunctions* fn, XrInstance instance, XrSystemId* system);
+XrResult pollXREvent(const LVFunctions* fn, XrInstance instance, XrEventDataBuffer* event);
+XrResult getVulkanExtensions(const LVFunctions* fn, XrInstance instance, XrSystemId system, int device, uint32_t capacity, uint32_t* count, char* buffer);
+XrResult getVulkanGraphicsDevice(const LVFunctions* fn, XrInstance instance, XrSystemId system, VkInstance vkInstance, VkPhysicalDevice* physicalDevice);
+XrResult getVulkanGraphicsRequirements(const LVFunctions* fn, XrInstance instance, XrSystemId system, XrVersion* min, XrVersion* max);
+
+XrResult createXRSession(const LVFunctions* fn, XrInstance instance, XrSystemId system, VkInstance vkInstance, VkPhysicalDevice physicalDevice, VkDevice device, uint32_t queueFamilyIndex, uint32_t queueIndex, XrSession* session);
+void destroyXRSession(const LVFunctions* fn, XrSession session);
+XrResult beginStereoSession(const LVFunctions* fn, XrSession session);
+XrResult endXRSession(const LVFunctions* fn, XrSession session);
+XrResult createLocalSpace(const LVFunctions* fn, XrSession session, XrSpace* space);
+void destroyXRSpace(const LVFunctions* fn, XrSpace space);
+XrResult enumerateStereoViews(const LVFunctions* fn, XrInstance instance, XrSystemId system, uint32_t capacity, uint32_t* count, XrViewConfigurationView* views);
+
+XrResult enumerateSwapchainFormats(const LVFunctions* fn, XrSession session, uint32_t capacity, uint32_t* count, int64_t* formats);
+XrResult createXRSwapchain(const LVFunctions* fn, XrSession session, int64_t format, uint32_t width, uint32_t height, XrSwapchain* swapchain);
+void destroyXRSwapchain(const LVFunctions* fn, XrSwapchain swapchain);
+XrResult enumerateSwapchainImages(const LVFunctions* fn, XrSwapchain swapchain, uint32_t capacity, uint32_t* count, XrSwapchainImageVulkanKHR* images);
+XrResult acquireSwapchainImage(const LVFunctions* fn, XrSwapchain swapchain, uint32_t* index);
+XrResult releaseSwapchainImage(const LVFunctions* fn, XrSwapchain swapchain);
+
+XrResult waitXRFrame(const LVFunctions* fn, XrSession session, XrFrameState* state);
+XrResult beginXRFrame(const LVFunctions* fn, XrSession session);
+XrResult locateStereoViews(const LVFunctions* fn, XrSession session, XrTime displayTime, XrSpace space, XrView* views, XrFlags64* flags);
+XrResult endStereoFrame(const LVFunctions* fn, XrSession session, XrTime displayTime, XrSpace space, const XrView* views, const XrSwapchain* swapchains, int32_t width, int32_t height);
+
+#endif
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/delaneyj/learnvulkan/debugutils"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/text"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// overlayTextSize is the height of the overlay's text in pixels.
+	overlayTextSize = 16
+	// overlayMargin is the gap between the overlay and the window's edges.
+	overlayMargin = 8
+	// overlayMessages is how many of the latest debug messages are shown.
+	overlayMessages = 5
+	// overlayMessageLength is where long debug messages are cut off.
+	overlayMessageLength = 120
+)
+
+var (
+	overlayColor        = [4]float32{1, 1, 1, 1}
+	overlayWarningColor = [4]float32{1, 0.8, 0.2, 1}
+	overlayErrorColor   = [4]float32{1, 0.3, 0.3, 1}
+)
+
+// messageLog keeps the latest debug messages for the overlay, they're added
+// from whichever thread the validation layers call back on.
+type messageLog struct {
+	mu       sync.Mutex
+	messages []debugutils.Message
+}
+
+func (l *messageLog) add(msg debugutils.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.messages) == overlayMessages {
+		copy(l.messages, l.messages[1:])
+		l.messages = l.messages[:overlayMessages-1]
+	}
+	l.messages = append(l.messages, msg)
+}
+
+// latest is a copy of the kept messages, oldest first.
+func (l *messageLog) latest() []debugutils.Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]debugutils.Message(nil), l.messages...)
+}
+
+// createOverlay gives the current window a text renderer when the Overlay
+// option is set.
+func (app *HelloTriangleApplication) createOverlay() error {
+	if !app.Overlay || app.window == nil {
+		return nil
+	}
+
+	renderer, err := text.NewRenderer(app.gpuContext(), shaders.TextVert(), shaders.TextFrag(), app.framesInFlight())
+	if err != nil {
+		return errors.Wrap(err, "can't create text renderer")
+	}
+	app.textRenderer = renderer
+	return app.createOverlayTarget()
+}
+
+// createOverlayTarget points the text renderer at the current swapchain
+// images.
+func (app *HelloTriangleApplication) createOverlayTarget() error {
+	if app.textRenderer == nil {
+		return nil
+	}
+	return errors.Wrap(
+		app.textRenderer.CreateTarget(app.target.Format, app.target.FinalLayout, app.imageViews, app.target.Extent),
+		"can't create overlay render target",
+	)
+}
+
+// buildOverlay prints the window's frame stats and the latest debug
+// messages and uploads them for frame.
+func (app *HelloTriangleApplication) buildOverlay(frame int) error {
+	if app.textRenderer == nil {
+		return nil
+	}
+
+	y := app.textRenderer.Print(overlayMargin, overlayMargin, overlayTextSize, overlayColor, app.frameStats.Summary().String())
+	for _, msg := range app.debugMessages.latest() {
+		color := overlayColor
+		switch {
+		case msg.Severity >= debugutils.SeverityError:
+			color = overlayErrorColor
+		case msg.Severity >= debugutils.SeverityWarning:
+			color = overlayWarningColor
+		}
+		line := fmt.Sprintf("%s %s: %s", msg.Severity, msg.IDName, msg.Text)
+		if len(line) > overlayMessageLength {
+			line = line[:overlayMessageLength] + "..."
+		}
+		y = app.textRenderer.Print(overlayMargin, y, overlayTextSize, color, line)
+	}
+
+	return errors.Wrap(app.textRenderer.Upload(frame), "can't upload overlay")
+}
+
+// recordOverlay draws the overlay built for frame over the swapchain image.
+func (app *HelloTriangleApplication) recordOverlay(cb vk.CommandBuffer, frame int, imageIndex uint32) {
+	if app.textRenderer == nil {
+		return
+	}
+	scope := app.profiler.Begin(cb, "overlay")
+	app.countDraws(app.textRenderer.Record(cb, frame, imageIndex))
+	scope.End(cb)
+}
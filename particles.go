@@ -0,0 +1,435 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// particleGroupSize is particles.comp's local size in x.
+	particleGroupSize = 256
+	// particleVertices is the quad particle.vert draws per particle.
+	particleVertices = 6
+	// particleSize is half the width of a particle's quad when it's born.
+	particleSize = 0.02
+	// maxParticleStep caps the time step so a long stall doesn't fling
+	// everything off at once.
+	maxParticleStep = 0.1
+)
+
+var (
+	particleEmitter = vmath.Vec3{0, 0, 0.1}
+	// particleSpeed is how fast particles leave the emitter on average.
+	particleSpeed   = float32(2.5)
+	particleGravity = vmath.Vec3{0, 0, -4}
+	// particleLifetimes is the range of ages particles die at.
+	particleLifetimes = [2]float32{1, 2.5}
+)
+
+// Particle matches the Particle struct in particles.comp, and particle.vert's
+// per instance inputs in location order.
+type Particle struct {
+	// Position is XYZ, W is the particle's age in seconds, negative until
+	// it's born.
+	Position vmath.Vec4
+	// Velocity is XYZ, W is the age the particle dies at and is reborn.
+	Velocity vmath.Vec4
+}
+
+// ParticleConstants is pushed once per simulation step, matching the
+// push_constant block in particles.comp.
+type ParticleConstants struct {
+	Gravity vmath.Vec4
+	// Emitter is XYZ, W is the speed particles leave it at.
+	Emitter   vmath.Vec4
+	DeltaTime float32
+	Time      float32
+	Count     uint32
+}
+
+var particleConstants = pipeline.NewPushConstants[ParticleConstants](vk.ShaderStageFlags(vk.ShaderStageComputeBit), 0)
+
+// ParticleDrawConstants is pushed once per particle draw, matching the
+// push_constant block in particle.vert.
+type ParticleDrawConstants struct {
+	ViewProj vmath.Mat4
+	Right    vmath.Vec4
+	// Up is XYZ, W is particleSize.
+	Up vmath.Vec4
+}
+
+var particleDrawConstants = pipeline.NewPushConstants[ParticleDrawConstants](vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0)
+
+func (app *HelloTriangleApplication) particlesEnabled() bool {
+	return app.Particles > 0
+}
+
+// createParticles uploads the starting particles into both of the buffers
+// the simulation ping-pongs between and creates the compute pipeline
+// stepping it and the layouts every window's particle pipeline shares.
+// Particles are staggered so they don't all leave the emitter at once.
+func (app *HelloTriangleApplication) createParticles() error {
+	if !app.particlesEnabled() {
+		return nil
+	}
+
+	random := rand.New(rand.NewSource(1))
+	particles := make([]Particle, app.Particles)
+	for i := range particles {
+		lifetime := particleLifetimes[0] + random.Float32()*(particleLifetimes[1]-particleLifetimes[0])
+		e := particleEmitter
+		particles[i] = Particle{
+			Position: vmath.Vec4{e[0], e[1], e[2], -random.Float32() * lifetime},
+			// Given a velocity when they're born
+			Velocity: vmath.Vec4{0, 0, 0, lifetime},
+		}
+	}
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&particles[0])), len(particles)*int(unsafe.Sizeof(Particle{})))
+	usage := vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit | vk.BufferUsageVertexBufferBit)
+	ctx := app.gpuContext()
+	ctx.SharedFamilies = app.particleFamilies()
+	for i := range app.particleBuffers {
+		b, err := gpu.NewDeviceLocalBuffer(ctx, data, usage)
+		if err != nil {
+			return errors.Wrapf(err, "can't upload particle buffer %d", i)
+		}
+		app.name(b.Handle, "particles %d", i)
+		app.particleBuffers[i] = b
+	}
+
+	code := app.shaderCode("particles.comp", shaders.Particles())
+	comp, err := spirv.Reflect(code)
+	if err != nil {
+		return errors.Wrap(err, "can't reflect particle shader")
+	}
+	if app.particleSetLayout, app.particleBindings, err = app.singleSetLayout("particle shader", comp); err != nil {
+		return err
+	}
+	layout, err := pipeline.NewLayout(app.device, []vk.DescriptorSetLayout{app.particleSetLayout}, []vk.PushConstantRange{particleConstants.Range()})
+	if err != nil {
+		return err
+	}
+	app.particleComputeLayout = layout
+	app.name(layout, "particle compute pipeline layout")
+
+	compute, err := pipeline.NewCompute(app.device, layout, code)
+	if err != nil {
+		return errors.Wrap(err, "can't create particle pipeline")
+	}
+	app.particleCompute = compute
+	app.track("pipeline", compute)
+	app.name(compute, "particle compute pipeline")
+
+	layout, err = pipeline.NewLayout(app.device, nil, []vk.PushConstantRange{particleDrawConstants.Range()})
+	if err != nil {
+		return err
+	}
+	app.particlePipelineLayout = layout
+	app.name(layout, "particle pipeline layout")
+
+	app.logger.Info("Simulating particles", logging.F("particles", app.Particles))
+	return nil
+}
+
+// createParticleSets allocates the current window's particle sets, one
+// per direction the simulation steps between the buffers. Only the primary
+// window steps it but every window has them so it doesn't matter which
+// one that is.
+func (app *HelloTriangleApplication) createParticleSets() error {
+	if !app.particlesEnabled() {
+		return nil
+	}
+
+	for i := range app.particleSets {
+		set, err := app.descriptorAllocator.Allocate(app.particleSetLayout)
+		if err != nil {
+			return errors.Wrapf(err, "can't allocate particle descriptor set %d", i)
+		}
+		app.particleSets[i] = set
+
+		src, dst := app.particleBuffers[i], app.particleBuffers[1-i]
+		writes := make([]vk.WriteDescriptorSet, 0, 2)
+		for binding, b := range []*gpu.Buffer{src, dst} {
+			writes = append(writes, vk.WriteDescriptorSet{
+				SType:           vk.StructureTypeWriteDescriptorSet,
+				DstSet:          set,
+				DstBinding:      uint32(binding),
+				DescriptorType:  vk.DescriptorTypeStorageBuffer,
+				DescriptorCount: 1,
+				PBufferInfo: []vk.DescriptorBufferInfo{{
+					Buffer: b.Handle,
+					Offset: 0,
+					Range:  b.Size,
+				}},
+			})
+		}
+		vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+	}
+	return nil
+}
+
+// createParticlePipeline creates the current window's pipeline drawing the
+// particles after the scene and sky. They're blended additively so they
+// can be drawn in any order, testing depth but not writing it.
+func (app *HelloTriangleApplication) createParticlePipeline() error {
+	if !app.particlesEnabled() {
+		return nil
+	}
+
+	vertShaderModule, err := app.createShaderModule(app.shaderCode("particle.vert", shaders.ParticleVert()))
+	if err != nil {
+		return errors.Wrap(err, "can't create particle vertex shader")
+	}
+	defer vk.DestroyShaderModule(app.device, vertShaderModule, nil)
+
+	fragShaderModule, err := app.createShaderModule(app.shaderCode("particle.frag", shaders.ParticleFrag()))
+	if err != nil {
+		return errors.Wrap(err, "can't create particle fragment shader")
+	}
+	defer vk.DestroyShaderModule(app.device, fragShaderModule, nil)
+
+	subpass := uint32(0)
+	if app.Deferred {
+		subpass = lightingSubpass
+	}
+
+	extent := app.target.Extent
+	pipelineInfos := []vk.GraphicsPipelineCreateInfo{{
+		SType:      vk.StructureTypeGraphicsPipelineCreateInfo,
+		PNext:      app.sceneRendering.Pointer(),
+		StageCount: 2,
+		PStages: []vk.PipelineShaderStageCreateInfo{
+			{
+				SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+				Stage:  vk.ShaderStageVertexBit,
+				Module: vertShaderModule,
+				PName:  "main\x00",
+			},
+			{
+				SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+				Stage:  vk.ShaderStageFragmentBit,
+				Module: fragShaderModule,
+				PName:  "main\x00",
+			},
+		},
+		// The particle buffer is read per instance, the quad's corners are
+		// built into the vertex shader
+		PVertexInputState: &vk.PipelineVertexInputStateCreateInfo{
+			SType:                         vk.StructureTypePipelineVertexInputStateCreateInfo,
+			VertexBindingDescriptionCount: 1,
+			PVertexBindingDescriptions: []vk.VertexInputBindingDescription{{
+				Binding:   0,
+				Stride:    uint32(unsafe.Sizeof(Particle{})),
+				InputRate: vk.VertexInputRateInstance,
+			}},
+			VertexAttributeDescriptionCount: 2,
+			PVertexAttributeDescriptions: []vk.VertexInputAttributeDescription{
+				{
+					Location: 0,
+					Binding:  0,
+					Format:   vk.FormatR32g32b32a32Sfloat,
+					Offset:   uint32(unsafe.Offsetof(Particle{}.Position)),
+				},
+				{
+					Location: 1,
+					Binding:  0,
+					Format:   vk.FormatR32g32b32a32Sfloat,
+					Offset:   uint32(unsafe.Offsetof(Particle{}.Velocity)),
+				},
+			},
+		},
+		PInputAssemblyState: &vk.PipelineInputAssemblyStateCreateInfo{
+			SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+			Topology: vk.PrimitiveTopologyTriangleList,
+		},
+		PViewportState: &vk.PipelineViewportStateCreateInfo{
+			SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+			ViewportCount: 1,
+			PViewports: []vk.Viewport{{
+				Width:    float32(extent.Width),
+				Height:   float32(extent.Height),
+				MinDepth: 0,
+				MaxDepth: 1,
+			}},
+			ScissorCount: 1,
+			PScissors:    []vk.Rect2D{{Extent: extent}},
+		},
+		PRasterizationState: &vk.PipelineRasterizationStateCreateInfo{
+			SType:       vk.StructureTypePipelineRasterizationStateCreateInfo,
+			PolygonMode: vk.PolygonModeFill,
+			LineWidth:   1,
+			CullMode:    vk.CullModeFlags(vk.CullModeNone),
+			FrontFace:   vk.FrontFaceCounterClockwise,
+		},
+		PMultisampleState: &vk.PipelineMultisampleStateCreateInfo{
+			SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+			RasterizationSamples: app.msaaSamples,
+			MinSampleShading:     1,
+		},
+		PDepthStencilState: &vk.PipelineDepthStencilStateCreateInfo{
+			SType:            vk.StructureTypePipelineDepthStencilStateCreateInfo,
+			DepthTestEnable:  vk.True,
+			DepthWriteEnable: vk.False,
+			DepthCompareOp:   vk.CompareOpLess,
+		},
+		PColorBlendState: &vk.PipelineColorBlendStateCreateInfo{
+			SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+			AttachmentCount: 1,
+			PAttachments: []vk.PipelineColorBlendAttachmentState{{
+				BlendEnable:         vk.True,
+				SrcColorBlendFactor: vk.BlendFactorOne,
+				DstColorBlendFactor: vk.BlendFactorOne,
+				ColorBlendOp:        vk.BlendOpAdd,
+				SrcAlphaBlendFactor: vk.BlendFactorZero,
+				DstAlphaBlendFactor: vk.BlendFactorOne,
+				AlphaBlendOp:        vk.BlendOpAdd,
+				ColorWriteMask: vk.ColorComponentFlags(
+					vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit,
+				),
+			}},
+		},
+		Layout:            app.particlePipelineLayout,
+		RenderPass:        app.renderPass,
+		Subpass:           subpass,
+		BasePipelineIndex: -1,
+	}}
+
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, 1, pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create particle pipeline")
+	}
+	app.track("pipeline", pipelines[0])
+	app.particlePipeline = pipelines[0]
+	app.name(app.particlePipeline, "particle pipeline")
+	return nil
+}
+
+func (app *HelloTriangleApplication) destroyParticlePipeline() {
+	if app.particlePipeline != vk.NullPipeline {
+		app.destroyPipeline(app.particlePipeline)
+		app.particlePipeline = vk.NullPipeline
+	}
+}
+
+// recordParticleStep steps the simulation from the current particle buffer
+// into the other one, which becomes current, when the current window is the
+// primary one. Every window then draws whatever's current. The barriers
+// order the step after earlier draws and steps using the buffers, and the
+// draws and next step after it. Everything is on the graphics queue so
+// that's all the synchronisation it takes. With async compute on the step
+// has already been submitted to the compute queue instead.
+func (app *HelloTriangleApplication) recordParticleStep(cb vk.CommandBuffer) {
+	if !app.particlesEnabled() || app.asyncCompute || app.particleSource != nil || app.appWindow != app.windows[0] {
+		return
+	}
+	scope := app.profiler.Begin(cb, "particles")
+	defer scope.End(cb)
+
+	// The previous frame's draws may still be reading what's overwritten,
+	// an execution dependency is enough for that
+	vk.CmdPipelineBarrier(cb,
+		vk.PipelineStageFlags(vk.PipelineStageVertexInputBit),
+		vk.PipelineStageFlags(vk.PipelineStageComputeShaderBit),
+		0, 0, nil, 0, nil, 0, nil)
+
+	app.cmdParticleStep(cb)
+
+	vk.CmdPipelineBarrier(cb,
+		vk.PipelineStageFlags(vk.PipelineStageComputeShaderBit),
+		vk.PipelineStageFlags(vk.PipelineStageVertexInputBit|vk.PipelineStageComputeShaderBit),
+		0, 0, nil,
+		1, []vk.BufferMemoryBarrier{{
+			SType:               vk.StructureTypeBufferMemoryBarrier,
+			SrcAccessMask:       vk.AccessFlags(vk.AccessShaderWriteBit),
+			DstAccessMask:       vk.AccessFlags(vk.AccessVertexAttributeReadBit | vk.AccessShaderReadBit),
+			SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+			DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+			Buffer:              app.particleBuffers[app.particleCurrent].Handle,
+			Offset:              0,
+			Size:                vk.DeviceSize(vk.WholeSize),
+		}},
+		0, nil)
+}
+
+// cmdParticleStep dispatches the step from the current particle buffer into
+// the other one and makes that current, without any synchronisation.
+func (app *HelloTriangleApplication) cmdParticleStep(cb vk.CommandBuffer) {
+	now := time.Now()
+	var dt float32
+	if !app.particleTime.IsZero() {
+		dt = float32(now.Sub(app.particleTime).Seconds())
+		if dt > maxParticleStep {
+			dt = maxParticleStep
+		}
+	}
+	app.particleTime = now
+
+	src := app.particleCurrent
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointCompute, app.particleCompute)
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointCompute, app.particleComputeLayout, 0,
+		1, []vk.DescriptorSet{app.particleSets[src]}, 0, nil)
+	e := particleEmitter
+	g := particleGravity
+	particleConstants.Push(cb, app.particleComputeLayout, ParticleConstants{
+		Gravity:   vmath.Vec4{g[0], g[1], g[2], 0},
+		Emitter:   vmath.Vec4{e[0], e[1], e[2], particleSpeed},
+		DeltaTime: dt,
+		Time:      float32(now.Sub(app.startTime).Seconds()),
+		Count:     uint32(app.Particles),
+	})
+	vk.CmdDispatch(cb, (uint32(app.Particles)+particleGroupSize-1)/particleGroupSize, 1, 1)
+	app.particleCurrent = 1 - src
+}
+
+// recordParticles draws the current particles as camera facing quads.
+func (app *HelloTriangleApplication) recordParticles(cb vk.CommandBuffer) {
+	buffer := app.particleVertexBuffer()
+	if app.particlePipeline == vk.NullPipeline || buffer == vk.NullBuffer {
+		return
+	}
+
+	view := app.camera.View()
+	extent := app.target.Extent
+	proj := app.camera.Projection(float32(extent.Width) / float32(extent.Height))
+
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.particlePipeline)
+	vk.CmdBindVertexBuffers(cb, 0, 1, []vk.Buffer{buffer}, []vk.DeviceSize{0})
+	// The view's rows are the camera's axes in world space
+	particleDrawConstants.Push(cb, app.particlePipelineLayout, ParticleDrawConstants{
+		ViewProj: proj.Mul(view),
+		Right:    vmath.Vec4{view[0], view[4], view[8], 0},
+		Up:       vmath.Vec4{view[1], view[5], view[9], particleSize},
+	})
+	vk.CmdDraw(cb, particleVertices, uint32(app.Particles), 0, 0)
+	app.countDraws(1)
+}
+
+func (app *HelloTriangleApplication) destroyParticles() {
+	if app.particleCompute != vk.NullPipeline {
+		app.release(app.particleCompute)
+		vk.DestroyPipeline(app.device, app.particleCompute, nil)
+	}
+	for _, l := range []vk.PipelineLayout{app.particleComputeLayout, app.particlePipelineLayout} {
+		if l != vk.NullPipelineLayout {
+			vk.DestroyPipelineLayout(app.device, l, nil)
+		}
+	}
+	if app.particleSetLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(app.device, app.particleSetLayout, nil)
+	}
+	for _, b := range app.particleBuffers {
+		if b != nil {
+			b.Destroy()
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DrawConstants is pushed once per draw, matching the push_constant block in
+// shader.frag and gbuffer.frag.
+type DrawConstants struct {
+	Tint           vmath.Vec4
+	LightDirection vmath.Vec4
+	CameraPosition vmath.Vec4
+}
+
+var drawConstants = pipeline.NewPushConstants[DrawConstants](vk.ShaderStageFlags(vk.ShaderStageFragmentBit), 0)
+
+func (app *HelloTriangleApplication) createGraphicsPipeline() error {
+	vertShaderModule, err := app.createShaderModule(app.shaderCode(app.vertexShader()))
+	if err != nil {
+		return errors.Wrap(err, "can't create vertex shader")
+	}
+	defer vk.DestroyShaderModule(app.device, vertShaderModule, nil)
+
+	fragShaderModule, err := app.createShaderModule(app.shaderCode(app.fragmentShader()))
+	if err != nil {
+		return errors.Wrap(err, "can't create fragment shader")
+	}
+	defer vk.DestroyShaderModule(app.device, fragShaderModule, nil)
+
+	shaderStages := []vk.PipelineShaderStageCreateInfo{
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageVertexBit,
+			Module: vertShaderModule,
+			PName:  "main\x00",
+		},
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageFragmentBit,
+			Module: fragShaderModule,
+			PName:  "main\x00",
+		},
+	}
+
+	vert, frag, err := app.reflectShaders()
+	if err != nil {
+		return err
+	}
+	meshlets, err := app.reflectMeshletShaders()
+	if err != nil {
+		return err
+	}
+
+	stereo, err := app.reflectStereoShader()
+	if err != nil {
+		return err
+	}
+
+	// The descriptor set layout and sets were built for the shaders at startup
+	modules := append([]*spirv.Module{vert, frag}, meshlets...)
+	bindings, err := app.mergeShaderBindings(append(modules, stereo...)...)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(bindings, app.shaderBindings) {
+		return errors.New("shader descriptor bindings changed since startup, restart to apply them")
+	}
+
+	pushConstantRanges := pipeline.PushConstantRanges(vert, frag)
+	if len(pushConstantRanges) != 1 {
+		return errors.New("shaders don't declare the DrawConstants push constant block")
+	}
+	if r, want := pushConstantRanges[0], app.fragmentConstants(); r.StageFlags != want.StageFlags || r.Size != want.Size {
+		return errors.Errorf("shader push constants are %d bytes for stages %b but DrawConstants is %d bytes for %b",
+			r.Size, r.StageFlags, want.Size, want.StageFlags)
+	}
+
+	bindingDescriptions, attributeDescriptions, err := app.vertexInput(vert)
+	if err != nil {
+		return err
+	}
+
+	vertexInputInfo := &vk.PipelineVertexInputStateCreateInfo{
+		SType:                           vk.StructureTypePipelineVertexInputStateCreateInfo,
+		VertexBindingDescriptionCount:   uint32(len(bindingDescriptions)),
+		PVertexBindingDescriptions:      bindingDescriptions,
+		VertexAttributeDescriptionCount: uint32(len(attributeDescriptions)),
+		PVertexAttributeDescriptions:    attributeDescriptions,
+	}
+
+	inputAssembly := &vk.PipelineInputAssemblyStateCreateInfo{
+		SType:                  vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+		Topology:               vk.PrimitiveTopologyTriangleList,
+		PrimitiveRestartEnable: vk.False,
+	}
+
+	extent := app.target.Extent
+	viewportState := &vk.PipelineViewportStateCreateInfo{
+		SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+		ViewportCount: 1,
+		PViewports: []vk.Viewport{{
+			X:        0,
+			Y:        0,
+			Width:    float32(extent.Width),
+			Height:   float32(extent.Height),
+			MinDepth: 0,
+			MaxDepth: 1,
+		}},
+		ScissorCount: 1,
+		PScissors: []vk.Rect2D{{
+			Offset: vk.Offset2D{X: 0, Y: 0},
+			Extent: extent,
+		}},
+	}
+
+	multisampling := &vk.PipelineMultisampleStateCreateInfo{
+		SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+		SampleShadingEnable:  vk.False,
+		RasterizationSamples: app.msaaSamples,
+		MinSampleShading:     1,
+	}
+
+	depthStencil := &vk.PipelineDepthStencilStateCreateInfo{
+		SType:            vk.StructureTypePipelineDepthStencilStateCreateInfo,
+		DepthTestEnable:  vk.True,
+		DepthWriteEnable: vk.True,
+		DepthCompareOp:   vk.CompareOpLess,
+	}
+	// Objects are drawn again over their own depth from the pre-pass
+	if app.occlusionCulling() {
+		depthStencil.DepthCompareOp = vk.CompareOpLessOrEqual
+	}
+
+	blendAttachments := make([]vk.PipelineColorBlendAttachmentState, app.colorOutputs())
+	for i := range blendAttachments {
+		blendAttachments[i] = vk.PipelineColorBlendAttachmentState{
+			ColorWriteMask: vk.ColorComponentFlags(
+				vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit,
+			),
+			BlendEnable: vk.False,
+		}
+	}
+	colorBlending := &vk.PipelineColorBlendStateCreateInfo{
+		SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+		LogicOpEnable:   vk.False,
+		LogicOp:         vk.LogicOpCopy,
+		AttachmentCount: uint32(len(blendAttachments)),
+		PAttachments:    blendAttachments,
+	}
+
+	pipelineLayout, err := pipeline.NewLayout(
+		app.device,
+		[]vk.DescriptorSetLayout{app.descriptorSetLayout, app.materialSetLayout},
+		pushConstantRanges,
+	)
+	if err != nil {
+		return err
+	}
+	app.pipelineLayout = pipelineLayout
+
+	// One per material variant and polygon mode, only the rasterizer differs
+	modes := app.polygonModes()
+	pipelineInfos := make([]vk.GraphicsPipelineCreateInfo, 0, int(pipelineVariants)*len(modes))
+	for v := PipelineVariant(0); v < pipelineVariants; v++ {
+		for _, mode := range modes {
+			pipelineInfos = append(pipelineInfos, vk.GraphicsPipelineCreateInfo{
+				SType:               vk.StructureTypeGraphicsPipelineCreateInfo,
+				PNext:               app.sceneRendering.Pointer(),
+				StageCount:          uint32(len(shaderStages)),
+				PStages:             shaderStages,
+				PVertexInputState:   vertexInputInfo,
+				PInputAssemblyState: inputAssembly,
+				PViewportState:      viewportState,
+				PRasterizationState: &vk.PipelineRasterizationStateCreateInfo{
+					SType:                   vk.StructureTypePipelineRasterizationStateCreateInfo,
+					DepthClampEnable:        vk.False,
+					RasterizerDiscardEnable: vk.False,
+					PolygonMode:             mode,
+					LineWidth:               1,
+					CullMode:                v.cullMode(),
+					FrontFace:               vk.FrontFaceCounterClockwise,
+					DepthBiasEnable:         vk.False,
+				},
+				PMultisampleState:  multisampling,
+				PDepthStencilState: depthStencil,
+				PColorBlendState:   colorBlending,
+				Layout:             app.pipelineLayout,
+				RenderPass:         app.renderPass,
+				Subpass:            0,
+				BasePipelineIndex:  -1,
+			})
+		}
+	}
+
+	pipelines := make([]vk.Pipeline, len(pipelineInfos))
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, uint32(len(pipelineInfos)), pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create graphics pipelines")
+	}
+	for _, p := range pipelines {
+		app.track("pipeline", p)
+	}
+	app.graphicsPipelines = pipelines
+
+	app.name(app.pipelineLayout, "graphics pipeline layout")
+	for i, p := range app.graphicsPipelines {
+		variant, mode := PipelineVariant(i/len(modes)), modes[i%len(modes)]
+		app.name(p, "graphics pipeline (%s, %s)", pipelineVariantNames[variant], polygonModeNames[mode])
+	}
+
+	if err := app.createMeshletPipeline(fragShaderModule, pipelineInfos[0]); err != nil {
+		return err
+	}
+	if err := app.createStereoPipeline(fragShaderModule, pipelineInfos[0]); err != nil {
+		return err
+	}
+	if err := app.createOcclusionPipelines(pipelineInfos[0]); err != nil {
+		return err
+	}
+	if err := app.createShadowPipeline(bindingDescriptions, attributeDescriptions); err != nil {
+		return err
+	}
+	if err := app.createLightingPipeline(); err != nil {
+		return err
+	}
+	if err := app.createCompositePipeline(); err != nil {
+		return err
+	}
+	if err := app.createSkyboxPipeline(); err != nil {
+		return err
+	}
+	return app.createParticlePipeline()
+}
+
+// vertexInput describes the vertex buffer, and with instancing the instance
+// buffer, checking the shader's inputs match Vertex and Instance.
+func (app *HelloTriangleApplication) vertexInput(vert *spirv.Module) ([]vk.VertexInputBindingDescription, []vk.VertexInputAttributeDescription, error) {
+	firstInstanceLocation := uint32(math.MaxUint32)
+	if app.instanced() {
+		firstInstanceLocation = instanceLocation
+	}
+	bindings, attributes, err := pipeline.InstancedVertexInput(vert, firstInstanceLocation)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't reflect vertex input")
+	}
+
+	if size := uint32(unsafe.Sizeof(Vertex{})); bindings[0].Stride != size {
+		return nil, nil, errors.Errorf("vertex shader inputs take %d bytes but Vertex is %d", bindings[0].Stride, size)
+	}
+	if app.instanced() {
+		if len(bindings) != 2 {
+			return nil, nil, errors.Errorf("vertex shader has no per instance inputs from location %d", instanceLocation)
+		}
+		if size := uint32(unsafe.Sizeof(Instance{})); bindings[1].Stride != size {
+			return nil, nil, errors.Errorf("vertex shader per instance inputs take %d bytes but Instance is %d", bindings[1].Stride, size)
+		}
+	}
+	return bindings, attributes, nil
+}
+
+// reflectShaders reflects the vertex and fragment shaders the pipeline is
+// built from, including any hot reloaded ones.
+func (app *HelloTriangleApplication) reflectShaders() (vert, frag *spirv.Module, err error) {
+	vert, err = spirv.Reflect(app.shaderCode(app.vertexShader()))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't reflect vertex shader")
+	}
+	frag, err = spirv.Reflect(app.shaderCode(app.fragmentShader()))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't reflect fragment shader")
+	}
+	return vert, frag, nil
+}
+
+func (app *HelloTriangleApplication) destroyGraphicsPipeline() {
+	app.destroySkyboxPipeline()
+	app.destroyParticlePipeline()
+	app.destroyShadowPipeline()
+	app.destroyLightingPipeline()
+	app.destroyCompositePipeline()
+	app.destroyMeshletPipeline()
+	app.destroyStereoPipeline()
+	app.destroyOcclusionPipelines()
+	for _, p := range app.graphicsPipelines {
+		app.destroyPipeline(p)
+	}
+	app.graphicsPipelines = nil
+	if app.pipelineLayout != vk.NullPipelineLayout {
+		app.destroyPipelineLayout(app.pipelineLayout)
+		app.pipelineLayout = vk.NullPipelineLayout
+	}
+}
+
+func (app *HelloTriangleApplication) createShaderModule(code []byte) (vk.ShaderModule, error) {
+	return pipeline.NewShaderModule(app.device, code)
+}
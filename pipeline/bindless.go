@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// BindingFlags are VkDescriptorBindingFlagBits from VK_EXT_descriptor_indexing,
+// which the bindings predate.
+type BindingFlags uint32
+
+const (
+	// BindingUpdateAfterBind lets the binding be written while its set is
+	// bound, up until the command buffer is submitted.
+	BindingUpdateAfterBind BindingFlags = 0x00000001
+	// BindingUpdateUnusedWhilePending lets descriptors the GPU won't read be
+	// written while the set is in use.
+	BindingUpdateUnusedWhilePending BindingFlags = 0x00000002
+	// BindingPartiallyBound lets descriptors the GPU won't read be unwritten.
+	BindingPartiallyBound BindingFlags = 0x00000004
+)
+
+const (
+	structureTypeBindingFlagsCreateInfo vk.StructureType = 1000161000
+	// setLayoutUpdateAfterBindPool is what layouts with
+	// BindingUpdateAfterBind bindings are created with.
+	setLayoutUpdateAfterBindPool vk.DescriptorSetLayoutCreateFlags = 0x00000002
+)
+
+// PoolUpdateAfterBind is VK_DESCRIPTOR_POOL_CREATE_UPDATE_AFTER_BIND_BIT,
+// sets with BindingUpdateAfterBind bindings have to come from pools created
+// with it.
+const PoolUpdateAfterBind vk.DescriptorPoolCreateFlags = 0x00000002
+
+// bindingFlagsCreateInfo is laid out like
+// VkDescriptorSetLayoutBindingFlagsCreateInfo, one flags per binding.
+type bindingFlagsCreateInfo struct {
+	sType         vk.StructureType
+	pNext         unsafe.Pointer
+	bindingCount  uint32
+	pBindingFlags *BindingFlags
+}
+
+// MakeBindless turns the descriptor array at set and binding into a table
+// of count descriptors that can be updated while bound and left partly
+// unwritten, for shaders to index. It needs VK_EXT_descriptor_indexing.
+func MakeBindless(bindings []StageBinding, set, binding, count uint32) error {
+	for i := range bindings {
+		b := &bindings[i]
+		if b.Set != set || b.Binding.Binding != binding {
+			continue
+		}
+		if b.Count > 1 {
+			return errors.Errorf("set %d binding %d is a sized array", set, binding)
+		}
+		b.Count = count
+		b.Flags = BindingUpdateAfterBind | BindingUpdateUnusedWhilePending | BindingPartiallyBound
+		return nil
+	}
+	return errors.Errorf("no binding %d in set %d", binding, set)
+}
+
+// UpdateAfterBind is whether any of bindings has BindingUpdateAfterBind.
+func UpdateAfterBind(bindings []StageBinding) bool {
+	for _, b := range bindings {
+		if b.Flags&BindingUpdateAfterBind != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+// Package pipeline holds helpers shared by graphics and compute pipelines.
+package pipeline
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// NewLayout creates a pipeline layout from descriptor set layouts and push constant ranges.
+func NewLayout(device vk.Device, setLayouts []vk.DescriptorSetLayout, pushConstantRanges []vk.PushConstantRange) (vk.PipelineLayout, error) {
+	createInfo := &vk.PipelineLayoutCreateInfo{
+		SType:                  vk.StructureTypePipelineLayoutCreateInfo,
+		SetLayoutCount:         uint32(len(setLayouts)),
+		PSetLayouts:            setLayouts,
+		PushConstantRangeCount: uint32(len(pushConstantRanges)),
+		PPushConstantRanges:    pushConstantRanges,
+	}
+
+	var layout vk.PipelineLayout
+	if err := vk.Error(vk.CreatePipelineLayout(device, createInfo, nil, &layout)); err != nil {
+		return vk.NullPipelineLayout, errors.Wrap(err, "can't create pipeline layout")
+	}
+	return layout, nil
+}
+
+// NewShaderModule creates a shader module from SPIR-V code.
+func NewShaderModule(device vk.Device, code []byte) (vk.ShaderModule, error) {
+	if len(code) == 0 || len(code)%4 != 0 {
+		return vk.NullShaderModule, errors.Errorf("SPIR-V size %d isn't a multiple of 4", len(code))
+	}
+
+	words := make([]uint32, len(code)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(code[i*4:])
+	}
+
+	createInfo := &vk.ShaderModuleCreateInfo{
+		SType:    vk.StructureTypeShaderModuleCreateInfo,
+		CodeSize: uint(len(code)),
+		PCode:    words,
+	}
+
+	var shaderModule vk.ShaderModule
+	if err := vk.Error(vk.CreateShaderModule(device, createInfo, nil, &shaderModule)); err != nil {
+		return vk.NullShaderModule, errors.Wrap(err, "can't create shader module")
+	}
+	return shaderModule, nil
+}
+
+// NewCompute creates a compute pipeline running the main function of the
+// SPIR-V in code with layout.
+func NewCompute(device vk.Device, layout vk.PipelineLayout, code []byte) (vk.Pipeline, error) {
+	module, err := NewShaderModule(device, code)
+	if err != nil {
+		return vk.NullPipeline, err
+	}
+	defer vk.DestroyShaderModule(device, module, nil)
+
+	createInfos := []vk.ComputePipelineCreateInfo{{
+		SType: vk.StructureTypeComputePipelineCreateInfo,
+		Stage: vk.PipelineShaderStageCreateInfo{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageComputeBit,
+			Module: module,
+			PName:  "main\x00",
+		},
+		Layout:            layout,
+		BasePipelineIndex: -1,
+	}}
+
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateComputePipelines(device, vk.NullPipelineCache, 1, createInfos, nil, pipelines)); err != nil {
+		return vk.NullPipeline, errors.Wrap(err, "can't create compute pipeline")
+	}
+	return pipelines[0], nil
+}
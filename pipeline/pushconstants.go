@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// PushConstants is a typed push constant block of T, declared at Offset for Stages.
+// T must be a fixed size type laid out to match the shader's block.
+type PushConstants[T any] struct {
+	Stages vk.ShaderStageFlags
+	Offset uint32
+}
+
+// NewPushConstants declares a push constant block for T, panicking if T
+// isn't fixed size since that's a programming error.
+func NewPushConstants[T any](stages vk.ShaderStageFlags, offset uint32) PushConstants[T] {
+	var zero T
+	if binary.Size(zero) < 0 {
+		panic(fmt.Sprintf("push constant type %T isn't fixed size", zero))
+	}
+	return PushConstants[T]{
+		Stages: stages,
+		Offset: offset,
+	}
+}
+
+// Size is the number of bytes T occupies in the block.
+func (pc PushConstants[T]) Size() uint32 {
+	var zero T
+	return uint32(binary.Size(zero))
+}
+
+// Range is the vk.PushConstantRange to put in the pipeline layout.
+func (pc PushConstants[T]) Range() vk.PushConstantRange {
+	return vk.PushConstantRange{
+		StageFlags: pc.Stages,
+		Offset:     pc.Offset,
+		Size:       pc.Size(),
+	}
+}
+
+// Push records value into cb for pipelines using layout.
+func (pc PushConstants[T]) Push(cb vk.CommandBuffer, layout vk.PipelineLayout, value T) {
+	var buf bytes.Buffer
+	// Writing to a bytes.Buffer can't fail and T was checked to be fixed size
+	_ = binary.Write(&buf, binary.LittleEndian, value)
+	data := buf.Bytes()
+	vk.CmdPushConstants(cb, layout, pc.Stages, pc.Offset, uint32(len(data)), unsafe.Pointer(&data[0]))
+}
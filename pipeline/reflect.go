@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"math"
+	"runtime"
+	"sort"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// StageBinding is a descriptor binding together with every stage using it.
+type StageBinding struct {
+	spirv.Binding
+	Stages vk.ShaderStageFlags
+	// Flags are set by MakeBindless, zero otherwise.
+	Flags BindingFlags
+}
+
+// MergeBindings combines the descriptor bindings of every stage of a
+// pipeline, stages sharing a binding must agree on its type and count.
+func MergeBindings(modules ...*spirv.Module) ([]StageBinding, error) {
+	type key struct{ set, binding uint32 }
+	merged := map[key]*StageBinding{}
+	var order []key
+
+	for _, m := range modules {
+		for _, b := range m.Bindings {
+			k := key{b.Set, b.Binding}
+			existing, ok := merged[k]
+			if !ok {
+				merged[k] = &StageBinding{Binding: b, Stages: vk.ShaderStageFlags(m.Stage)}
+				order = append(order, k)
+				continue
+			}
+			if existing.Type != b.Type || existing.Count != b.Count {
+				return nil, errors.Errorf("set %d binding %d is declared differently by different stages", b.Set, b.Binding)
+			}
+			existing.Stages |= vk.ShaderStageFlags(m.Stage)
+		}
+	}
+
+	bindings := make([]StageBinding, 0, len(order))
+	for _, k := range order {
+		bindings = append(bindings, *merged[k])
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		a, b := bindings[i], bindings[j]
+		if a.Set != b.Set {
+			return a.Set < b.Set
+		}
+		return a.Binding.Binding < b.Binding.Binding
+	})
+	return bindings, nil
+}
+
+// MakeDynamic turns the uniform buffer at set and binding into a dynamic
+// one. SPIR-V can't tell the two apart, it's up to how the buffer is bound.
+func MakeDynamic(bindings []StageBinding, set, binding uint32) error {
+	for i := range bindings {
+		b := &bindings[i]
+		if b.Set != set || b.Binding.Binding != binding {
+			continue
+		}
+		if b.Type != vk.DescriptorTypeUniformBuffer && b.Type != vk.DescriptorTypeUniformBufferDynamic {
+			return errors.Errorf("set %d binding %d isn't a uniform buffer", set, binding)
+		}
+		b.Type = vk.DescriptorTypeUniformBufferDynamic
+		return nil
+	}
+	return errors.Errorf("no binding %d in set %d", binding, set)
+}
+
+// NewSetLayouts creates a descriptor set layout for every set from 0 up to the
+// highest one used, sets without bindings get an empty layout.
+func NewSetLayouts(device vk.Device, bindings []StageBinding) ([]vk.DescriptorSetLayout, error) {
+	if len(bindings) == 0 {
+		return nil, nil
+	}
+
+	sets := make([][]vk.DescriptorSetLayoutBinding, bindings[len(bindings)-1].Set+1)
+	flags := make([][]BindingFlags, len(sets))
+	for _, b := range bindings {
+		sets[b.Set] = append(sets[b.Set], vk.DescriptorSetLayoutBinding{
+			Binding:         b.Binding.Binding,
+			DescriptorType:  b.Type,
+			DescriptorCount: b.Count,
+			StageFlags:      b.Stages,
+		})
+		flags[b.Set] = append(flags[b.Set], b.Flags)
+	}
+
+	layouts := make([]vk.DescriptorSetLayout, 0, len(sets))
+	for i, set := range sets {
+		layoutInfo := &vk.DescriptorSetLayoutCreateInfo{
+			SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+			BindingCount: uint32(len(set)),
+			PBindings:    set,
+		}
+		// Only sets MakeBindless touched need the extension's struct
+		var bindingFlags *bindingFlagsCreateInfo
+		for _, f := range flags[i] {
+			if f == 0 {
+				continue
+			}
+			bindingFlags = &bindingFlagsCreateInfo{
+				sType:         structureTypeBindingFlagsCreateInfo,
+				bindingCount:  uint32(len(flags[i])),
+				pBindingFlags: &flags[i][0],
+			}
+			layoutInfo.PNext = unsafe.Pointer(bindingFlags)
+			if f&BindingUpdateAfterBind != 0 {
+				layoutInfo.Flags |= setLayoutUpdateAfterBindPool
+			}
+		}
+
+		var layout vk.DescriptorSetLayout
+		err := vk.Error(vk.CreateDescriptorSetLayout(device, layoutInfo, nil, &layout))
+		runtime.KeepAlive(bindingFlags)
+		if err != nil {
+			for _, l := range layouts {
+				vk.DestroyDescriptorSetLayout(device, l, nil)
+			}
+			return nil, errors.Wrapf(err, "can't create descriptor set layout for set %d", i)
+		}
+		layouts = append(layouts, layout)
+	}
+	return layouts, nil
+}
+
+// PushConstantRanges covers the push constant blocks of every stage with a
+// single range starting at 0, so one struct can be pushed to all of them.
+func PushConstantRanges(modules ...*spirv.Module) []vk.PushConstantRange {
+	var size uint32
+	var stages vk.ShaderStageFlags
+	for _, m := range modules {
+		if m.PushConstantSize == 0 {
+			continue
+		}
+		if m.PushConstantSize > size {
+			size = m.PushConstantSize
+		}
+		stages |= vk.ShaderStageFlags(m.Stage)
+	}
+
+	if size == 0 {
+		return nil
+	}
+	return []vk.PushConstantRange{{
+		StageFlags: stages,
+		Offset:     0,
+		Size:       size,
+	}}
+}
+
+// VertexInput describes a single interleaved vertex buffer at binding 0 with
+// the vertex shader's inputs packed in location order.
+func VertexInput(vertex *spirv.Module) (vk.VertexInputBindingDescription, []vk.VertexInputAttributeDescription, error) {
+	bindings, attributes, err := InstancedVertexInput(vertex, math.MaxUint32)
+	if err != nil {
+		return vk.VertexInputBindingDescription{}, nil, err
+	}
+	return bindings[0], attributes, nil
+}
+
+// InstancedVertexInput is VertexInput split over two buffers, inputs from
+// firstInstanceLocation on come from an interleaved per instance buffer at
+// binding 1.
+func InstancedVertexInput(vertex *spirv.Module, firstInstanceLocation uint32) ([]vk.VertexInputBindingDescription, []vk.VertexInputAttributeDescription, error) {
+	if vertex.Stage != vk.ShaderStageVertexBit {
+		return nil, nil, errors.New("vertex input needs a vertex shader")
+	}
+
+	bindings := []vk.VertexInputBindingDescription{{
+		Binding:   0,
+		InputRate: vk.VertexInputRateVertex,
+	}}
+	attributes := make([]vk.VertexInputAttributeDescription, 0, len(vertex.Inputs))
+	for _, in := range vertex.Inputs {
+		if in.Location >= firstInstanceLocation && len(bindings) == 1 {
+			bindings = append(bindings, vk.VertexInputBindingDescription{
+				Binding:   1,
+				InputRate: vk.VertexInputRateInstance,
+			})
+		}
+		binding := &bindings[len(bindings)-1]
+		attributes = append(attributes, vk.VertexInputAttributeDescription{
+			Binding:  binding.Binding,
+			Location: in.Location,
+			Format:   in.Format,
+			Offset:   binding.Stride,
+		})
+		binding.Stride += in.Size
+	}
+	return bindings, attributes, nil
+}
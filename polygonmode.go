@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const defaultPolygonModeKey = glfw.KeyP
+
+var polygonModeNames = map[vk.PolygonMode]string{
+	vk.PolygonModeFill:  "fill",
+	vk.PolygonModeLine:  "line",
+	vk.PolygonModePoint: "point",
+}
+
+func (app *HelloTriangleApplication) polygonModeKey() glfw.Key {
+	if app.PolygonModeKey == 0 {
+		return defaultPolygonModeKey
+	}
+	return app.PolygonModeKey
+}
+
+// polygonModes are the modes there's a graphics pipeline variant for, in
+// the order they're cycled through. Anything but fill needs the
+// fillModeNonSolid feature, and point needs pointPolygons on portability
+// devices.
+func (app *HelloTriangleApplication) polygonModes() []vk.PolygonMode {
+	if !app.fillModeNonSolid {
+		return []vk.PolygonMode{vk.PolygonModeFill}
+	}
+	if app.portability != nil && !app.portability.PointPolygons() {
+		return []vk.PolygonMode{vk.PolygonModeFill, vk.PolygonModeLine}
+	}
+	return []vk.PolygonMode{vk.PolygonModeFill, vk.PolygonModeLine, vk.PolygonModePoint}
+}
+
+// cyclePolygonMode switches the current window to the next pipeline
+// variant. They're all built up front so nothing has to wait for the GPU.
+func (app *HelloTriangleApplication) cyclePolygonMode() {
+	modes := app.polygonModes()
+	if len(modes) == 1 {
+		app.logger.Info("Can't switch polygon mode", logging.F("reason", "no fillModeNonSolid feature"))
+		return
+	}
+	app.polygonMode = (app.polygonMode + 1) % len(modes)
+	app.logger.Info("Switched polygon mode", logging.F("polygonMode", polygonModeNames[modes[app.polygonMode]]))
+}
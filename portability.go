@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/portability"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// enablePortabilityEnumeration asks createInfo's instance to enumerate
+// portability devices, like MoltenVK on macOS, when the loader can. Older
+// loaders list them regardless and don't have the extension.
+func enablePortabilityEnumeration(api Vulkan, createInfo *vk.InstanceCreateInfo) error {
+	extensions, err := api.InstanceExtensions()
+	if err != nil {
+		return err
+	}
+	available := extensionNames(extensions)
+	if !available[portability.EnumerationExtension] {
+		return nil
+	}
+	createInfo.PpEnabledExtensionNames = append(createInfo.PpEnabledExtensionNames, portability.EnumerationExtension+"\x00")
+	createInfo.EnabledExtensionCount = uint32(len(createInfo.PpEnabledExtensionNames))
+	createInfo.Flags |= portability.EnumeratePortability
+	return nil
+}
+
+// unsuitablePortability is why a portability device can't run the
+// application, empty when it can. Everything else it's missing is worked
+// around.
+func unsuitablePortability(features *portability.Features) string {
+	// The shadow map's comparison sampler is written into descriptor sets
+	if !features.MutableComparisonSamplers() {
+		return "no mutableComparisonSamplers portability feature"
+	}
+	return ""
+}
+
+// reportPortability logs what the chosen device leaves out of Vulkan when
+// it's a portability device.
+func (app *HelloTriangleApplication) reportPortability() {
+	if app.portability == nil {
+		return
+	}
+	app.logger.Info("Physical device is a portability subset",
+		logging.F("missing", app.portability.Missing()),
+	)
+}
@@ -0,0 +1,131 @@
+// Package portability covers VK_KHR_portability_enumeration and
+// VK_KHR_portability_subset, which implementations layered on another API,
+// like MoltenVK on Metal, use to say which parts of Vulkan they can't
+// implement. The loader only enumerates them for instances created with
+// EnumeratePortability, and devices listing SubsetExtension have to have it
+// enabled.
+package portability
+
+import (
+	"runtime"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// EnumerationExtension is VK_KHR_portability_enumeration's name, an
+	// instance extension.
+	EnumerationExtension = "VK_KHR_portability_enumeration"
+	// SubsetExtension is VK_KHR_portability_subset's name, a device
+	// extension.
+	SubsetExtension = "VK_KHR_portability_subset"
+)
+
+// EnumeratePortability is VK_INSTANCE_CREATE_ENUMERATE_PORTABILITY_BIT_KHR,
+// for vk.InstanceCreateInfo's Flags.
+const EnumeratePortability vk.InstanceCreateFlags = 0x00000001
+
+// structureTypeFeatures is
+// VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_PORTABILITY_SUBSET_FEATURES_KHR, which
+// the bindings predate.
+const structureTypeFeatures vk.StructureType = 1000163000
+
+// Features is laid out like VkPhysicalDevicePortabilitySubsetFeaturesKHR,
+// what a portability device can do that the rest of Vulkan takes for
+// granted.
+type Features struct {
+	sType                                  vk.StructureType
+	pNext                                  unsafe.Pointer
+	constantAlphaColorBlendFactors         vk.Bool32
+	events                                 vk.Bool32
+	imageViewFormatReinterpretation        vk.Bool32
+	imageViewFormatSwizzle                 vk.Bool32
+	imageView2DOn3DImage                   vk.Bool32
+	multisampleArrayImage                  vk.Bool32
+	mutableComparisonSamplers              vk.Bool32
+	pointPolygons                          vk.Bool32
+	samplerMipLodBias                      vk.Bool32
+	separateStencilMaskRef                 vk.Bool32
+	shaderSampleRateInterpolationFunctions vk.Bool32
+	tessellationIsolines                   vk.Bool32
+	tessellationPointMode                  vk.Bool32
+	triangleFans                           vk.Bool32
+	vertexAttributeAccessBeyondStride      vk.Bool32
+}
+
+// Query returns what physicalDevice supports. It has to list
+// SubsetExtension.
+func Query(physicalDevice vk.PhysicalDevice) *Features {
+	f := &Features{sType: structureTypeFeatures}
+	features := vk.PhysicalDeviceFeatures2{
+		SType: vk.StructureTypePhysicalDeviceFeatures2,
+		PNext: f.Pointer(),
+	}
+	vk.GetPhysicalDeviceFeatures2(physicalDevice, &features)
+	runtime.KeepAlive(f)
+	f.pNext = nil
+	return f
+}
+
+// Enable is a copy of f, chained in front of next, to put on
+// vk.DeviceCreateInfo's PNext to enable everything f supports. It has to
+// be kept alive until the device is created.
+func (f *Features) Enable(next unsafe.Pointer) *Features {
+	enabled := *f
+	enabled.pNext = next
+	return &enabled
+}
+
+// Pointer is the struct to chain.
+func (f *Features) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(f)
+}
+
+// PointPolygons reports whether pipelines can rasterize with
+// VK_POLYGON_MODE_POINT.
+func (f *Features) PointPolygons() bool {
+	return f.pointPolygons.B()
+}
+
+// SamplerMipLodBias reports whether samplers can have a non-zero
+// mipLodBias.
+func (f *Features) SamplerMipLodBias() bool {
+	return f.samplerMipLodBias.B()
+}
+
+// MutableComparisonSamplers reports whether descriptors with comparison
+// samplers can be updated, rather than having to be immutable samplers.
+func (f *Features) MutableComparisonSamplers() bool {
+	return f.mutableComparisonSamplers.B()
+}
+
+// Missing names the features the device doesn't have, for logging.
+func (f *Features) Missing() []string {
+	var missing []string
+	for _, feature := range []struct {
+		name      string
+		supported vk.Bool32
+	}{
+		{"constantAlphaColorBlendFactors", f.constantAlphaColorBlendFactors},
+		{"events", f.events},
+		{"imageViewFormatReinterpretation", f.imageViewFormatReinterpretation},
+		{"imageViewFormatSwizzle", f.imageViewFormatSwizzle},
+		{"imageView2DOn3DImage", f.imageView2DOn3DImage},
+		{"multisampleArrayImage", f.multisampleArrayImage},
+		{"mutableComparisonSamplers", f.mutableComparisonSamplers},
+		{"pointPolygons", f.pointPolygons},
+		{"samplerMipLodBias", f.samplerMipLodBias},
+		{"separateStencilMaskRef", f.separateStencilMaskRef},
+		{"shaderSampleRateInterpolationFunctions", f.shaderSampleRateInterpolationFunctions},
+		{"tessellationIsolines", f.tessellationIsolines},
+		{"tessellationPointMode", f.tessellationPointMode},
+		{"triangleFans", f.triangleFans},
+		{"vertexAttributeAccessBeyondStride", f.vertexAttributeAccessBeyondStride},
+	} {
+		if !feature.supported.B() {
+			missing = append(missing, feature.name)
+		}
+	}
+	return missing
+}
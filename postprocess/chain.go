@@ -0,0 +1,221 @@
+// Package postprocess runs passes over a rendered scene in order, each
+// reading images written by the scene or earlier passes and writing its
+// own. A Chain allocates the intermediate images from a Pool, letting images
+// nothing reads any more be reused by later passes, and records the
+// barriers between passes so they don't have to know about each other.
+package postprocess
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Access is how a pass writes an output.
+type Access int
+
+const (
+	// Storage outputs are written as storage images in GENERAL layout.
+	Storage Access = iota
+	// ColorAttachment outputs are written by a render pass in
+	// COLOR_ATTACHMENT_OPTIMAL layout.
+	ColorAttachment
+)
+
+func (a Access) layout() vk.ImageLayout {
+	if a == ColorAttachment {
+		return vk.ImageLayoutColorAttachmentOptimal
+	}
+	return vk.ImageLayoutGeneral
+}
+
+func (a Access) usage() vk.ImageUsageFlags {
+	if a == ColorAttachment {
+		return vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit)
+	}
+	return vk.ImageUsageFlags(vk.ImageUsageStorageBit)
+}
+
+// Output is an image a pass writes.
+type Output struct {
+	Name   string
+	Format vk.Format
+	// Divisor shrinks the image from the chain's extent, zero is 1. Sizes
+	// are rounded down and at least 1.
+	Divisor uint32
+	Access  Access
+}
+
+// Images are a chain's images by name, external ones included.
+type Images map[string]*gpu.Image
+
+// Frame is what a pass records with.
+type Frame struct {
+	Images Images
+	// TargetIndex is the index of the target image the frame is drawn into,
+	// for passes writing to it through framebuffers of their own.
+	TargetIndex uint32
+}
+
+// Pass is a step of a Chain. Inputs are in SHADER_READ_ONLY_OPTIMAL layout
+// and outputs in their Access' layout when Record is called. A pass changing
+// their layouts itself has to keep gpu.Image.Layout up to date, and an
+// output left in SHADER_READ_ONLY_OPTIMAL has to have been moved there with
+// a barrier after its last write. What a pass writes outside of the chain,
+// like the swapchain image, is up to it.
+type Pass interface {
+	Name() string
+	Inputs() []string
+	Outputs() []Output
+	// Bind is called with the chain's images whenever they change, to
+	// point descriptor sets at them.
+	Bind(images Images)
+	Record(cb vk.CommandBuffer, frame Frame)
+}
+
+// Chain runs passes in order.
+type Chain struct {
+	pool   *Pool
+	passes []Pass
+	images Images
+	// owned are the images acquired from the pool, free the ones of them
+	// no pass still to come during Build reads.
+	owned []*gpu.Image
+	free  map[poolKey][]*gpu.Image
+}
+
+// NewChain creates a chain of passes allocating from pool. It has no
+// images until it's built.
+func NewChain(pool *Pool, passes ...Pass) *Chain {
+	return &Chain{
+		pool:   pool,
+		passes: passes,
+	}
+}
+
+// Build gives the chain's images back to the pool and allocates them again
+// for extent, then binds every pass. It has to wait until the GPU is done
+// with the old images. external are the images written outside of the
+// chain, like the scene, which have to be in SHADER_READ_ONLY_OPTIMAL or be
+// moved there with a barrier when their Layout says so. An output is reused
+// for later passes' outputs after the last pass reading it.
+func (c *Chain) Build(extent vk.Extent2D, external Images) error {
+	c.Release()
+	defer c.pool.Trim()
+
+	lastUse := map[string]int{}
+	for i, p := range c.passes {
+		for _, name := range p.Inputs() {
+			lastUse[name] = i
+		}
+	}
+
+	c.images = Images{}
+	for name, img := range external {
+		c.images[name] = img
+	}
+	c.free = map[poolKey][]*gpu.Image{}
+	for i, p := range c.passes {
+		for _, name := range p.Inputs() {
+			if c.images[name] == nil {
+				return errors.Errorf("pass '%s' reads '%s', which nothing before it writes", p.Name(), name)
+			}
+		}
+		for _, out := range p.Outputs() {
+			if c.images[out.Name] != nil {
+				return errors.Errorf("pass '%s' writes '%s', which is already written", p.Name(), out.Name)
+			}
+			divisor := out.Divisor
+			if divisor == 0 {
+				divisor = 1
+			}
+			img, err := c.acquire(out.Name, shrink(extent.Width, divisor), shrink(extent.Height, divisor), out.Format, out.Access.usage())
+			if err != nil {
+				return errors.Wrapf(err, "can't allocate pass '%s' output", p.Name())
+			}
+			c.images[out.Name] = img
+		}
+
+		// Only after every output is allocated, so none alias an input
+		for _, out := range p.Outputs() {
+			if _, read := lastUse[out.Name]; !read {
+				c.release(c.images[out.Name])
+			}
+		}
+		for _, name := range p.Inputs() {
+			if lastUse[name] == i && external[name] == nil {
+				c.release(c.images[name])
+			}
+		}
+	}
+
+	c.Bind()
+	return nil
+}
+
+func (c *Chain) acquire(name string, width, height uint32, format vk.Format, usage vk.ImageUsageFlags) (*gpu.Image, error) {
+	key := newPoolKey(width, height, format, usage)
+	if free := c.free[key]; len(free) > 0 {
+		img := free[len(free)-1]
+		c.free[key] = free[:len(free)-1]
+		return img, nil
+	}
+	img, err := c.pool.Acquire(name, width, height, format, usage)
+	if err != nil {
+		return nil, err
+	}
+	c.owned = append(c.owned, img)
+	return img, nil
+}
+
+func (c *Chain) release(img *gpu.Image) {
+	key := c.pool.keys[img]
+	c.free[key] = append(c.free[key], img)
+}
+
+func shrink(size, divisor uint32) uint32 {
+	if size/divisor == 0 {
+		return 1
+	}
+	return size / divisor
+}
+
+// Bind calls every pass' Bind with the chain's current images, for passes
+// whose descriptor sets are allocated after the chain is built.
+func (c *Chain) Bind() {
+	for _, p := range c.passes {
+		p.Bind(c.images)
+	}
+}
+
+// Image is the image called name, nil if there isn't one.
+func (c *Chain) Image(name string) *gpu.Image {
+	return c.images[name]
+}
+
+// Record records every pass, each after barriers making its inputs readable
+// and its outputs writable once earlier passes, and earlier frames, are
+// done with them.
+func (c *Chain) Record(cb vk.CommandBuffer, targetIndex uint32) {
+	frame := Frame{Images: c.images, TargetIndex: targetIndex}
+	for _, p := range c.passes {
+		for _, name := range p.Inputs() {
+			c.images[name].CmdTransitionTo(cb, vk.ImageLayoutShaderReadOnlyOptimal)
+		}
+		for _, out := range p.Outputs() {
+			c.images[out.Name].CmdBarrierTo(cb, out.Access.layout())
+		}
+		p.Record(cb, frame)
+	}
+}
+
+// Release gives the chain's images back to the pool, which has to outlive
+// it.
+func (c *Chain) Release() {
+	for _, img := range c.owned {
+		c.pool.Release(img)
+	}
+	c.owned = nil
+	c.free = nil
+	c.images = nil
+}
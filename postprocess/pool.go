@@ -0,0 +1,85 @@
+package postprocess
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type poolKey struct {
+	width, height uint32
+	format        vk.Format
+	usage         vk.ImageUsageFlags
+}
+
+// Pool hands out render targets, reusing released ones of the same size,
+// format and usage before creating more.
+type Pool struct {
+	ctx  gpu.Context
+	free map[poolKey][]*gpu.Image
+	keys map[*gpu.Image]poolKey
+	// Name, if set, is called with every image the pool creates and the
+	// name it's first acquired for.
+	Name func(img *gpu.Image, name string)
+}
+
+// NewPool creates an empty pool.
+func NewPool(ctx gpu.Context) *Pool {
+	return &Pool{
+		ctx:  ctx,
+		free: map[poolKey][]*gpu.Image{},
+		keys: map[*gpu.Image]poolKey{},
+	}
+}
+
+func newPoolKey(width, height uint32, format vk.Format, usage vk.ImageUsageFlags) poolKey {
+	return poolKey{width, height, format, usage | vk.ImageUsageFlags(vk.ImageUsageSampledBit)}
+}
+
+// Acquire returns a released image matching the arguments or creates one.
+// It's sampleable as well as having usage.
+func (p *Pool) Acquire(name string, width, height uint32, format vk.Format, usage vk.ImageUsageFlags) (*gpu.Image, error) {
+	key := newPoolKey(width, height, format, usage)
+	if free := p.free[key]; len(free) > 0 {
+		img := free[len(free)-1]
+		p.free[key] = free[:len(free)-1]
+		return img, nil
+	}
+
+	img, err := gpu.NewImage(p.ctx, gpu.ImageInfo{
+		Width:  width,
+		Height: height,
+		Format: format,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  key.usage,
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't create %dx%d render target for '%s'", width, height, name)
+	}
+	p.keys[img] = key
+	if p.Name != nil {
+		p.Name(img, name)
+	}
+	return img, nil
+}
+
+// Release returns img to the pool for a later Acquire. Its contents aren't
+// kept.
+func (p *Pool) Release(img *gpu.Image) {
+	key := p.keys[img]
+	p.free[key] = append(p.free[key], img)
+}
+
+// Trim destroys the released images, which after a resize are the wrong
+// size to be acquired again.
+func (p *Pool) Trim() {
+	for _, free := range p.free {
+		for _, img := range free {
+			delete(p.keys, img)
+			img.Destroy()
+		}
+	}
+	p.free = map[poolKey][]*gpu.Image{}
+}
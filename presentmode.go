@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/swapchain"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const defaultPresentModeKey = glfw.KeyV
+
+func (app *HelloTriangleApplication) presentModeKey() glfw.Key {
+	if app.PresentModeKey == 0 {
+		return defaultPresentModeKey
+	}
+	return app.PresentModeKey
+}
+
+// choosePresentModes turns the PresentMode option into the swapchain's
+// preference, FIFO backs it up when the surface doesn't support it.
+func (app *HelloTriangleApplication) choosePresentModes() error {
+	if app.PresentMode == "" {
+		app.presentModes = nil
+		return nil
+	}
+
+	pm, err := swapchain.ParsePresentMode(app.PresentMode)
+	if err != nil {
+		return err
+	}
+	app.presentModes = []vk.PresentMode{pm}
+	return nil
+}
+
+// cyclePresentMode switches to the next present mode the surface supports
+// and rebuilds the swapchain with it.
+func (app *HelloTriangleApplication) cyclePresentMode() error {
+	support, err := swapchain.QuerySupport(app.physicalDevice, app.surface)
+	if err != nil {
+		return errors.Wrap(err, "can't query present modes")
+	}
+	supported := map[vk.PresentMode]bool{}
+	for _, pm := range support.PresentModes {
+		supported[pm] = true
+	}
+
+	current := 0
+	for i, pm := range swapchain.PresentModes {
+		if pm == app.swapchain.PresentMode {
+			current = i
+		}
+	}
+	next := app.swapchain.PresentMode
+	for i := 1; i <= len(swapchain.PresentModes); i++ {
+		pm := swapchain.PresentModes[(current+i)%len(swapchain.PresentModes)]
+		if supported[pm] {
+			next = pm
+			break
+		}
+	}
+	if next == app.swapchain.PresentMode {
+		app.logger.Info("No other present mode is supported", logging.F("presentMode", swapchain.PresentModeName(next)))
+		return nil
+	}
+
+	app.presentModes = []vk.PresentMode{next}
+	if err := app.recreateSwapchain(); err != nil {
+		return errors.Wrap(err, "can't recreate swapchain")
+	}
+	app.logger.Info("Switched present mode", logging.F("presentMode", swapchain.PresentModeName(app.swapchain.PresentMode)))
+	return nil
+}
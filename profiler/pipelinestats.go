@@ -0,0 +1,122 @@
+package profiler
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// statisticFlags are the statistics queried, results come back in the
+// order of their bits.
+const statisticFlags = vk.QueryPipelineStatisticVertexShaderInvocationsBit |
+	vk.QueryPipelineStatisticClippingInvocationsBit |
+	vk.QueryPipelineStatisticClippingPrimitivesBit |
+	vk.QueryPipelineStatisticFragmentShaderInvocationsBit
+
+// Statistics count the work a frame's draws did.
+type Statistics struct {
+	// VertexInvocations is how many times the vertex shader ran, vertices
+	// shared between triangles may be counted once or more.
+	VertexInvocations uint64
+	// ClippingInvocations is how many primitives reached clipping and
+	// ClippingPrimitives how many came out of it, fewer when triangles are
+	// off screen and more when clipping splits them.
+	ClippingInvocations uint64
+	ClippingPrimitives  uint64
+	// FragmentInvocations is how many times the fragment shader ran,
+	// overdraw shows up as many more than there are pixels.
+	FragmentInvocations uint64
+}
+
+// PipelineStats counts the work of each frame's draws with a pipeline
+// statistics query. Like Profiler every frame in flight has its own query
+// that's read back once its fence has been waited on. The device needs the
+// pipelineStatisticsQuery feature. A nil PipelineStats records nothing.
+type PipelineStats struct {
+	device   vk.Device
+	pool     vk.QueryPool
+	recorded []bool
+	current  int
+}
+
+// NewPipelineStats creates a query per frame in flight.
+func NewPipelineStats(device vk.Device, frames int) (*PipelineStats, error) {
+	poolInfo := &vk.QueryPoolCreateInfo{
+		SType:              vk.StructureTypeQueryPoolCreateInfo,
+		QueryType:          vk.QueryTypePipelineStatistics,
+		QueryCount:         uint32(frames),
+		PipelineStatistics: vk.QueryPipelineStatisticFlags(statisticFlags),
+	}
+	q := &PipelineStats{
+		device:   device,
+		recorded: make([]bool, frames),
+	}
+	if err := vk.Error(vk.CreateQueryPool(device, poolInfo, nil, &q.pool)); err != nil {
+		return nil, errors.Wrap(err, "can't create pipeline statistics query pool")
+	}
+	return q, nil
+}
+
+// BeginFrame starts counting frame's command buffer, it has to be called
+// before Begin and outside a render pass. It returns the statistics from
+// the last time frame was recorded, false when there aren't any.
+func (q *PipelineStats) BeginFrame(cb vk.CommandBuffer, frame int) (Statistics, bool) {
+	if q == nil {
+		return Statistics{}, false
+	}
+	q.current = frame
+	stats, ok := q.read(frame)
+	vk.CmdResetQueryPool(cb, q.pool, uint32(frame), 1)
+	return stats, ok
+}
+
+// Begin starts counting, both Begin and End have to be either inside or
+// outside the same render pass.
+func (q *PipelineStats) Begin(cb vk.CommandBuffer) {
+	if q == nil {
+		return
+	}
+	vk.CmdBeginQuery(cb, q.pool, uint32(q.current), 0)
+}
+
+// End stops counting.
+func (q *PipelineStats) End(cb vk.CommandBuffer) {
+	if q == nil {
+		return
+	}
+	vk.CmdEndQuery(cb, q.pool, uint32(q.current))
+	q.recorded[q.current] = true
+}
+
+// Destroy releases the query pool.
+func (q *PipelineStats) Destroy() {
+	if q == nil || q.pool == vk.NullQueryPool {
+		return
+	}
+	vk.DestroyQueryPool(q.device, q.pool, nil)
+	q.pool = vk.NullQueryPool
+}
+
+func (q *PipelineStats) read(frame int) (Statistics, bool) {
+	if !q.recorded[frame] {
+		return Statistics{}, false
+	}
+	q.recorded[frame] = false
+
+	var counts [4]uint64
+	result := vk.GetQueryPoolResults(q.device, q.pool,
+		uint32(frame), 1,
+		uint(unsafe.Sizeof(counts)), unsafe.Pointer(&counts[0]), vk.DeviceSize(unsafe.Sizeof(counts)),
+		vk.QueryResultFlags(vk.QueryResult64Bit),
+	)
+	if result != vk.Success {
+		return Statistics{}, false
+	}
+	return Statistics{
+		VertexInvocations:   counts[0],
+		ClippingInvocations: counts[1],
+		ClippingPrimitives:  counts[2],
+		FragmentInvocations: counts[3],
+	}, true
+}
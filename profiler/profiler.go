@@ -0,0 +1,187 @@
+// Package profiler times scopes of command buffers on the GPU with
+// timestamp queries and counts the work they do with pipeline statistics
+// queries.
+package profiler
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DefaultMaxScopes is how many scopes a frame can time when New isn't told.
+const DefaultMaxScopes = 16
+
+// ErrUnsupported is returned by New when the queue family can't write
+// timestamps.
+var ErrUnsupported = errors.New("queue family doesn't support timestamps")
+
+// Profiler times named scopes of each frame's command buffer. Every frame in
+// flight has its own queries, so a frame's timings are read back when its
+// slot comes around again and its fence has already been waited on, which
+// never stalls. A nil Profiler records nothing.
+type Profiler struct {
+	device vk.Device
+	pool   vk.QueryPool
+	// period is nanoseconds per timestamp tick and mask the bits of a
+	// timestamp that are valid.
+	period    float64
+	mask      uint64
+	maxScopes int
+	frames    []frameScopes
+	current   int
+}
+
+// frameScopes are the scopes recorded into one frame in flight's queries.
+type frameScopes struct {
+	names []string
+	// recorded is set once the queries have been written and not yet read.
+	recorded bool
+}
+
+// Result is how long a scope took on the GPU.
+type Result struct {
+	Name     string
+	Duration time.Duration
+}
+
+// New creates a profiler for command buffers submitted to queueFamily with
+// frames frames in flight, each timing up to maxScopes scopes, zero using
+// DefaultMaxScopes.
+func New(device vk.Device, physicalDevice vk.PhysicalDevice, queueFamily uint32, frames, maxScopes int) (*Profiler, error) {
+	if maxScopes <= 0 {
+		maxScopes = DefaultMaxScopes
+	}
+
+	var count uint32
+	vk.GetPhysicalDeviceQueueFamilyProperties(physicalDevice, &count, nil)
+	families := make([]vk.QueueFamilyProperties, count)
+	vk.GetPhysicalDeviceQueueFamilyProperties(physicalDevice, &count, families)
+	if queueFamily >= count {
+		return nil, errors.Errorf("no queue family %d", queueFamily)
+	}
+	family := families[queueFamily]
+	family.Deref()
+	if family.TimestampValidBits == 0 {
+		return nil, ErrUnsupported
+	}
+
+	var properties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(physicalDevice, &properties)
+	properties.Deref()
+	properties.Limits.Deref()
+
+	p := &Profiler{
+		device:    device,
+		period:    float64(properties.Limits.TimestampPeriod),
+		mask:      ^uint64(0),
+		maxScopes: maxScopes,
+		frames:    make([]frameScopes, frames),
+	}
+	if family.TimestampValidBits < 64 {
+		p.mask = 1<<family.TimestampValidBits - 1
+	}
+
+	poolInfo := &vk.QueryPoolCreateInfo{
+		SType:      vk.StructureTypeQueryPoolCreateInfo,
+		QueryType:  vk.QueryTypeTimestamp,
+		QueryCount: uint32(frames * maxScopes * 2),
+	}
+	if err := vk.Error(vk.CreateQueryPool(device, poolInfo, nil, &p.pool)); err != nil {
+		return nil, errors.Wrap(err, "can't create timestamp query pool")
+	}
+	return p, nil
+}
+
+// BeginFrame starts timing frame's command buffer, it has to be called
+// before any scopes are recorded into cb and outside a render pass. It
+// returns the timings from the last time frame was recorded, whose fence
+// must have been waited on.
+func (p *Profiler) BeginFrame(cb vk.CommandBuffer, frame int) []Result {
+	if p == nil {
+		return nil
+	}
+	p.current = frame
+	results := p.read(frame)
+
+	f := &p.frames[frame]
+	f.names = f.names[:0]
+	f.recorded = true
+	vk.CmdResetQueryPool(cb, p.pool, p.firstQuery(frame), uint32(p.maxScopes*2))
+	return results
+}
+
+// Scope is a timed range of a command buffer, End it in the same one.
+type Scope struct {
+	p     *Profiler
+	query uint32
+}
+
+// Begin starts timing a scope named name, scopes past the profiler's
+// maximum aren't timed.
+func (p *Profiler) Begin(cb vk.CommandBuffer, name string) Scope {
+	if p == nil {
+		return Scope{}
+	}
+	f := &p.frames[p.current]
+	if len(f.names) == p.maxScopes {
+		return Scope{}
+	}
+	query := p.firstQuery(p.current) + uint32(len(f.names)*2)
+	f.names = append(f.names, name)
+	vk.CmdWriteTimestamp(cb, vk.PipelineStageTopOfPipeBit, p.pool, query)
+	return Scope{p: p, query: query}
+}
+
+// End stops timing the scope once everything recorded before it finishes.
+func (s Scope) End(cb vk.CommandBuffer) {
+	if s.p == nil {
+		return
+	}
+	vk.CmdWriteTimestamp(cb, vk.PipelineStageBottomOfPipeBit, s.p.pool, s.query+1)
+}
+
+// Destroy releases the query pool.
+func (p *Profiler) Destroy() {
+	if p == nil || p.pool == vk.NullQueryPool {
+		return
+	}
+	vk.DestroyQueryPool(p.device, p.pool, nil)
+	p.pool = vk.NullQueryPool
+}
+
+func (p *Profiler) firstQuery(frame int) uint32 {
+	return uint32(frame * p.maxScopes * 2)
+}
+
+// read resolves the timestamps frame last recorded, nothing if it hasn't
+// been recorded or they aren't available.
+func (p *Profiler) read(frame int) []Result {
+	f := &p.frames[frame]
+	if !f.recorded || len(f.names) == 0 {
+		return nil
+	}
+	f.recorded = false
+
+	timestamps := make([]uint64, len(f.names)*2)
+	result := vk.GetQueryPoolResults(p.device, p.pool,
+		p.firstQuery(frame), uint32(len(timestamps)),
+		uint(len(timestamps)*8), unsafe.Pointer(&timestamps[0]), 8,
+		vk.QueryResultFlags(vk.QueryResult64Bit),
+	)
+	if result != vk.Success {
+		return nil
+	}
+
+	results := make([]Result, len(f.names))
+	for i, name := range f.names {
+		ticks := (timestamps[i*2+1] - timestamps[i*2]) & p.mask
+		results[i] = Result{
+			Name:     name,
+			Duration: time.Duration(float64(ticks) * p.period),
+		}
+	}
+	return results
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// QueueFamilies are the queue family indices the application uses on a
+// physical device, -1 meaning no suitable family was found.
+type QueueFamilies struct {
+	Graphics int
+	Present  int
+	// Compute prefers a family without graphics support so compute work can
+	// overlap rendering, otherwise it's a family shared with graphics.
+	Compute int
+	// Transfer prefers a transfer only family, usually a DMA engine, so
+	// uploads can overlap rendering, otherwise it falls back like Compute.
+	// Dedicated transfer families can have a coarse image transfer
+	// granularity that copies have to respect.
+	Transfer int
+}
+
+// isComplete reports whether every family was found, the present family is
+// only needed when presenting.
+func (qf QueueFamilies) isComplete(presenting bool) bool {
+	return qf.Graphics >= 0 && (qf.Present >= 0 || !presenting) && qf.Compute >= 0 && qf.Transfer >= 0
+}
+
+// DedicatedCompute reports whether compute work runs on its own family.
+func (qf QueueFamilies) DedicatedCompute() bool {
+	return qf.Compute != qf.Graphics
+}
+
+// DedicatedTransfer reports whether transfers run on their own family.
+func (qf QueueFamilies) DedicatedTransfer() bool {
+	return qf.Transfer != qf.Graphics && qf.Transfer != qf.Compute
+}
+
+// unique returns the distinct queue family indices, families are frequently
+// shared and a family can only be requested once.
+func (qf QueueFamilies) unique() []uint32 {
+	return uniqueFamilies(qf.Graphics, qf.Present, qf.Compute, qf.Transfer)
+}
+
+// presentation returns the distinct families that touch swapchain images.
+func (qf QueueFamilies) presentation() []uint32 {
+	return uniqueFamilies(qf.Graphics, qf.Present)
+}
+
+func uniqueFamilies(families ...int) []uint32 {
+	var indices []uint32
+	seen := map[int]bool{}
+	for _, f := range families {
+		if f < 0 || seen[f] {
+			continue
+		}
+		seen[f] = true
+		indices = append(indices, uint32(f))
+	}
+	return indices
+}
+
+func findQueueFamilies(api Vulkan, device vk.PhysicalDevice, surface vk.Surface) (QueueFamilies, error) {
+	families := QueueFamilies{
+		Graphics: -1,
+		Present:  -1,
+		Compute:  -1,
+		Transfer: -1,
+	}
+
+	properties := api.QueueFamilyProperties(device)
+	has := func(i int, bit vk.QueueFlagBits) bool {
+		return properties[i].QueueCount > 0 && properties[i].QueueFlags&vk.QueueFlags(bit) != 0
+	}
+	first := func(match func(i int) bool) int {
+		for i := range properties {
+			if match(i) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// Without a surface nothing is presented and no family is needed for it
+	presentSupport := make([]bool, len(properties))
+	for i, qf := range properties {
+		if surface == vk.NullSurface {
+			break
+		}
+		supported, err := api.SurfaceSupport(device, uint32(i), surface)
+		if err != nil {
+			return families, errors.Wrap(err, "can't query surface support")
+		}
+		presentSupport[i] = qf.QueueCount > 0 && supported
+	}
+
+	// Presenting from the graphics family avoids transferring swapchain
+	// image ownership between families
+	families.Graphics = first(func(i int) bool {
+		return has(i, vk.QueueGraphicsBit) && presentSupport[i]
+	})
+	if families.Graphics < 0 {
+		families.Graphics = first(func(i int) bool { return has(i, vk.QueueGraphicsBit) })
+	}
+	if families.Graphics >= 0 && presentSupport[families.Graphics] {
+		families.Present = families.Graphics
+	} else {
+		families.Present = first(func(i int) bool { return presentSupport[i] })
+	}
+
+	families.Compute = first(func(i int) bool {
+		return has(i, vk.QueueComputeBit) && !has(i, vk.QueueGraphicsBit)
+	})
+	if families.Compute < 0 {
+		families.Compute = first(func(i int) bool { return has(i, vk.QueueComputeBit) })
+	}
+
+	// Graphics and compute families support transfers whether or not they
+	// advertise it
+	families.Transfer = first(func(i int) bool {
+		return has(i, vk.QueueTransferBit) && !has(i, vk.QueueGraphicsBit) && !has(i, vk.QueueComputeBit)
+	})
+	if families.Transfer < 0 {
+		families.Transfer = families.Compute
+	}
+
+	return families, nil
+}
+
+// createQueues fetches the first queue of every family used.
+func (app *HelloTriangleApplication) createQueues() error {
+	queues := []struct {
+		family int
+		queue  *vk.Queue
+		name   string
+	}{
+		{app.queueFamilies.Graphics, &app.graphicsQueue, "graphics"},
+		{app.queueFamilies.Present, &app.presentQueue, "present"},
+		{app.queueFamilies.Compute, &app.computeQueue, "compute"},
+		{app.queueFamilies.Transfer, &app.transferQueue, "transfer"},
+	}
+	for _, q := range queues {
+		if q.family < 0 {
+			continue
+		}
+		var queue vk.Queue
+		vk.GetDeviceQueue(app.device, uint32(q.family), 0, &queue)
+		if queue == nil {
+			return errors.Errorf("can't get %s queue", q.name)
+		}
+		*q.queue = queue
+	}
+	return nil
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/raytracing"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	defaultRayTracingKey = glfw.KeyF7
+	// rayTracingScore is added to devices that can ray trace when it's
+	// asked for, more than any difference DefaultDeviceScorer makes.
+	rayTracingScore = 1 << 20
+	// rayTracingFormat is what the ray generation shader writes, blitted
+	// into the target which is usually BGRA and sRGB and can't be stored to.
+	rayTracingFormat = vk.FormatR8g8b8a8Unorm
+	// rayTracedMeshSize is the radius the mesh is scaled to beside the
+	// sample's triangle.
+	rayTracedMeshSize = 0.6
+)
+
+// Instance custom indices raytrace.rchit tells the sample's triangle and
+// floor from the mesh by.
+const (
+	rayTracedSampleIndex = 0
+	rayTracedMeshIndex   = 1
+)
+
+var (
+	// rayTracedVertices are a floor with a triangle standing on it, the
+	// triangle first so it's primitive 0 in raytrace.rchit.
+	rayTracedVertices = []vmath.Vec3{
+		{-2, -2, 0}, {2, -2, 0}, {2, 2, 0}, {-2, 2, 0},
+		{-0.6, 0, 0.2}, {0.6, 0, 0.2}, {0, 0, 1.2},
+	}
+	rayTracedIndices = []uint32{4, 5, 6, 0, 1, 2, 0, 2, 3}
+	// rayTracedMeshPosition is where the mesh spins, off to the side of the
+	// triangle and above the floor.
+	rayTracedMeshPosition = vmath.Vec3{1.2, 0.6, 0.7}
+)
+
+// RayTraceConstants is pushed once per trace, matching the push_constant
+// blocks in raytrace.rgen and raytrace.rchit.
+type RayTraceConstants struct {
+	InverseViewProj vmath.Mat4
+	LightDirection  vmath.Vec4
+	// MeshIndex16 is 1 when the mesh's indices are 16 bit.
+	MeshIndex16 uint32
+}
+
+var rayTraceConstants = pipeline.NewPushConstants[RayTraceConstants](
+	vk.ShaderStageFlags(raytracing.ShaderStageRaygenBit|raytracing.ShaderStageClosestHitBit), 0)
+
+func (app *HelloTriangleApplication) rayTracingKey() glfw.Key {
+	if app.RayTracingKey == 0 {
+		return defaultRayTracingKey
+	}
+	return app.RayTracingKey
+}
+
+// createRayTracing builds the ray traced sample's scene and the mesh into
+// acceleration structures and creates the pipeline tracing them and its
+// shader binding table. It's created whenever the device can ray trace so the key can
+// switch to it, the RayTracing option only picks how it starts.
+func (app *HelloTriangleApplication) createRayTracing() error {
+	if !app.rayTracing {
+		if app.RayTracing {
+			app.logger.Info("Rasterizing", logging.F("reason", "no device supports ray tracing"))
+		}
+		return nil
+	}
+
+	rt, err := raytracing.Load(app.getInstanceProcAddr, app.instance, app.device)
+	if err != nil {
+		return err
+	}
+	app.rayTracer = rt
+	app.rayTracingProps = raytracing.QueryProperties(app.physicalDevice)
+
+	if err := app.buildRayTracedScene(); err != nil {
+		return errors.Wrap(err, "can't build ray traced scene")
+	}
+
+	bindings := []vk.DescriptorSetLayoutBinding{
+		{
+			Binding:         0,
+			DescriptorType:  raytracing.DescriptorTypeAccelerationStructure,
+			DescriptorCount: 1,
+			StageFlags:      vk.ShaderStageFlags(raytracing.ShaderStageRaygenBit),
+		},
+		{
+			Binding:         1,
+			DescriptorType:  vk.DescriptorTypeStorageImage,
+			DescriptorCount: 1,
+			StageFlags:      vk.ShaderStageFlags(raytracing.ShaderStageRaygenBit),
+		},
+		{
+			Binding:         2,
+			DescriptorType:  vk.DescriptorTypeStorageBuffer,
+			DescriptorCount: 1,
+			StageFlags:      vk.ShaderStageFlags(raytracing.ShaderStageClosestHitBit),
+		},
+		{
+			Binding:         3,
+			DescriptorType:  vk.DescriptorTypeStorageBuffer,
+			DescriptorCount: 1,
+			StageFlags:      vk.ShaderStageFlags(raytracing.ShaderStageClosestHitBit),
+		},
+	}
+	layoutInfo := &vk.DescriptorSetLayoutCreateInfo{
+		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+		BindingCount: uint32(len(bindings)),
+		PBindings:    bindings,
+	}
+	if err := vk.Error(vk.CreateDescriptorSetLayout(app.device, layoutInfo, nil, &app.rayTracingSetLayout)); err != nil {
+		return errors.Wrap(err, "can't create ray tracing descriptor set layout")
+	}
+	app.track("descriptor set layout", app.rayTracingSetLayout)
+	layout, err := pipeline.NewLayout(app.device, []vk.DescriptorSetLayout{app.rayTracingSetLayout}, []vk.PushConstantRange{rayTraceConstants.Range()})
+	if err != nil {
+		return err
+	}
+	app.rayTracingLayout = layout
+	app.name(layout, "ray tracing pipeline layout")
+
+	stages := []struct {
+		name  string
+		code  []byte
+		stage vk.ShaderStageFlagBits
+	}{
+		{"raytrace.rgen", shaders.RayTraceRgen(), raytracing.ShaderStageRaygenBit},
+		{"raytrace.rmiss", shaders.RayTraceMiss(), raytracing.ShaderStageMissBit},
+		{"shadow.rmiss", shaders.ShadowMiss(), raytracing.ShaderStageMissBit},
+		{"raytrace.rchit", shaders.RayTraceChit(), raytracing.ShaderStageClosestHitBit},
+	}
+	rtStages := make([]raytracing.Stage, 0, len(stages))
+	for _, s := range stages {
+		module, err := app.createShaderModule(app.shaderCode(s.name, s.code))
+		if err != nil {
+			return errors.Wrapf(err, "can't create %s shader", s.name)
+		}
+		defer vk.DestroyShaderModule(app.device, module, nil)
+		rtStages = append(rtStages, raytracing.Stage{Stage: s.stage, Module: module})
+	}
+	// Ray generation, then the misses in the order traceRayEXT indexes them,
+	// then the hit group, as the shader binding table lays them out
+	groups := []raytracing.Group{
+		raytracing.GeneralGroup(0),
+		raytracing.GeneralGroup(1),
+		raytracing.GeneralGroup(2),
+		raytracing.HitGroup(3),
+	}
+	// Shadow rays are traced from the ray generation shader, not from hits
+	if app.rayTracingPipeline, err = rt.CreatePipeline(layout, rtStages, groups, 1); err != nil {
+		return err
+	}
+	app.track("pipeline", app.rayTracingPipeline)
+	app.name(app.rayTracingPipeline, "ray tracing pipeline")
+
+	if app.rayTracingSBT, err = rt.NewShaderBindingTable(app.gpuContext(), app.rayTracingProps, app.rayTracingPipeline, 2, 1); err != nil {
+		return err
+	}
+	app.name(app.rayTracingSBT.Buffer.Handle, "shader binding table")
+
+	app.rayTracingDescriptors = descriptors.NewAllocator(app.device, []descriptors.Ratio{
+		{Type: raytracing.DescriptorTypeAccelerationStructure, PerSet: 1},
+		{Type: vk.DescriptorTypeStorageImage, PerSet: 1},
+		{Type: vk.DescriptorTypeStorageBuffer, PerSet: 2},
+	}, 1)
+	if app.rayTracingSet, err = app.rayTracingDescriptors.Allocate(app.rayTracingSetLayout); err != nil {
+		return errors.Wrap(err, "can't allocate ray tracing descriptor set")
+	}
+	rt.WriteAccelerationStructure(app.rayTracingSet, 0, app.tlas.AccelerationStructure)
+	writes := make([]vk.WriteDescriptorSet, 0, 2)
+	for i, b := range []*gpu.Buffer{app.mesh.Vertices, app.mesh.Indices} {
+		writes = append(writes, vk.WriteDescriptorSet{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          app.rayTracingSet,
+			DstBinding:      uint32(2 + i),
+			DescriptorType:  vk.DescriptorTypeStorageBuffer,
+			DescriptorCount: 1,
+			PBufferInfo: []vk.DescriptorBufferInfo{{
+				Buffer: b.Handle,
+				Offset: 0,
+				Range:  b.Size,
+			}},
+		})
+	}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+
+	app.rayTraced = app.RayTracing
+	app.logger.Info("Ray tracing available",
+		logging.F("handleSize", app.rayTracingProps.HandleSize),
+		logging.F("maxRecursionDepth", app.rayTracingProps.MaxRecursionDepth),
+		logging.F("enabled", app.rayTraced))
+	return nil
+}
+
+// buildRayTracedScene uploads the sample's triangles and builds them and
+// the mesh into compacted bottom level structures, and creates the top
+// level structure placing them that's refitted every frame as the mesh
+// spins.
+func (app *HelloTriangleApplication) buildRayTracedScene() error {
+	rt := app.rayTracer
+	ctx := app.gpuContext()
+	usage := vk.BufferUsageFlags(raytracing.BufferUsageAccelerationStructureBuildInputReadOnlyBit | raytracing.BufferUsageShaderDeviceAddressBit)
+
+	vertexData := unsafe.Slice((*byte)(unsafe.Pointer(&rayTracedVertices[0])), len(rayTracedVertices)*int(unsafe.Sizeof(vmath.Vec3{})))
+	indexData := unsafe.Slice((*byte)(unsafe.Pointer(&rayTracedIndices[0])), len(rayTracedIndices)*4)
+	var err error
+	if app.rayTracedVertices, err = newRayTracingInput(ctx, vertexData, usage); err != nil {
+		return errors.Wrap(err, "can't create ray traced vertices")
+	}
+	if app.rayTracedIndices, err = newRayTracingInput(ctx, indexData, usage); err != nil {
+		return errors.Wrap(err, "can't create ray traced indices")
+	}
+
+	builder := rt.NewBuilder(ctx, app.rayTracingProps)
+	flags := raytracing.BuildPreferFastTrace | raytracing.BuildAllowCompaction
+	sample := rt.MeshTriangles(app.rayTracedVertices, vk.DeviceSize(unsafe.Sizeof(vmath.Vec3{})),
+		app.rayTracedIndices, vk.IndexTypeUint32, uint32(len(rayTracedIndices)))
+	if app.rayTracedSample, err = builder.Add([]raytracing.Geometry{sample}, flags); err != nil {
+		return err
+	}
+	mesh := rt.MeshTriangles(app.mesh.Vertices, vk.DeviceSize(unsafe.Sizeof(Vertex{})),
+		app.mesh.Indices, app.mesh.IndexType, app.mesh.IndexCount)
+	if app.rayTracedMesh, err = builder.Add([]raytracing.Geometry{mesh}, flags); err != nil {
+		return err
+	}
+	stats, err := builder.Build(app.commandPool, app.graphicsQueue)
+	if err != nil {
+		return err
+	}
+	app.name(app.rayTracedSample.Buffer.Handle, "ray traced sample")
+	app.name(app.rayTracedMesh.Buffer.Handle, "ray traced mesh")
+	app.logger.Info("Built acceleration structures",
+		logging.F("structures", stats.Structures),
+		logging.F("scratch", stats.Scratch),
+		logging.F("size", stats.Size),
+		logging.F("compacted", stats.Compacted))
+
+	// The instances change every frame so it's built for building quickly
+	if app.tlas, err = builder.NewTopLevel(2, app.framesInFlight(), raytracing.BuildPreferFastBuild); err != nil {
+		return err
+	}
+	app.name(app.tlas.Buffer.Handle, "top level acceleration structure")
+	return nil
+}
+
+// rayTracedInstances places the sample where it was made and the mesh
+// spinning beside it.
+func (app *HelloTriangleApplication) rayTracedInstances() []raytracing.Instance {
+	scale := float32(1)
+	if app.mesh.Radius > 0 {
+		scale = rayTracedMeshSize / app.mesh.Radius
+	}
+	spin := float32(time.Since(app.startTime).Seconds())
+	transform := vmath.Translate(rayTracedMeshPosition).
+		Mul(vmath.Rotate(spin, vmath.Vec3{0, 0, 1})).
+		Mul(vmath.Scale(vmath.Vec3{scale, scale, scale}))
+	return []raytracing.Instance{
+		raytracing.NewInstance(app.rayTracedSample, vmath.Ident4(), rayTracedSampleIndex),
+		raytracing.NewInstance(app.rayTracedMesh, transform, rayTracedMeshIndex),
+	}
+}
+
+// newRayTracingInput creates a host visible buffer of data for a build to
+// read, the sample's scene being too small for staging to matter.
+func newRayTracingInput(ctx gpu.Context, data []byte, usage vk.BufferUsageFlags) (*gpu.Buffer, error) {
+	b, err := gpu.NewBuffer(ctx, vk.DeviceSize(len(data)), usage, memory.CPUToGPU)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Upload(data); err != nil {
+		b.Destroy()
+		return nil, err
+	}
+	return b, nil
+}
+
+// createRayTracingTarget creates the image the primary window's rays are
+// traced into at the target's size and points the descriptor set at it.
+func (app *HelloTriangleApplication) createRayTracingTarget() error {
+	if app.rayTracer == nil || app.appWindow != app.windows[0] {
+		return nil
+	}
+
+	img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:  app.target.Extent.Width,
+		Height: app.target.Extent.Height,
+		Format: rayTracingFormat,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageStorageBit | vk.ImageUsageTransferSrcBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create ray tracing image")
+	}
+	app.rayTraceImage = img
+	app.name(img.Handle, "ray tracing image")
+
+	writes := []vk.WriteDescriptorSet{{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          app.rayTracingSet,
+		DstBinding:      1,
+		DescriptorType:  vk.DescriptorTypeStorageImage,
+		DescriptorCount: 1,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			ImageView:   img.View,
+			ImageLayout: vk.ImageLayoutGeneral,
+		}},
+	}}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+	return nil
+}
+
+// recordRayTracing refits the top level structure to where the mesh has
+// spun to, then traces the scene and blits it over the target image when
+// ray tracing is switched on, replacing whatever was rasterized into it
+// before the overlays are drawn on top.
+func (app *HelloTriangleApplication) recordRayTracing(cb vk.CommandBuffer, frame int, imageIndex uint32) {
+	if !app.rayTraced || app.rayTraceImage == nil {
+		return
+	}
+	scope := app.profiler.Begin(cb, "ray tracing")
+	defer scope.End(cb)
+
+	if err := app.tlas.CmdUpdate(cb, frame, app.rayTracedInstances()); err != nil {
+		app.logger.Warn("Can't update ray traced instances", logging.F("err", err))
+		return
+	}
+
+	img := app.rayTraceImage
+	extent := app.target.Extent
+	proj := app.camera.Projection(float32(extent.Width) / float32(extent.Height))
+
+	img.CmdTransitionTo(cb, vk.ImageLayoutGeneral)
+	vk.CmdBindPipeline(cb, raytracing.PipelineBindPointRayTracing, app.rayTracingPipeline)
+	vk.CmdBindDescriptorSets(cb, raytracing.PipelineBindPointRayTracing, app.rayTracingLayout, 0,
+		1, []vk.DescriptorSet{app.rayTracingSet}, 0, nil)
+	constants := RayTraceConstants{
+		InverseViewProj: proj.Mul(app.camera.View()).Inverse(),
+		LightDirection:  app.lightDirection().Vec4(0),
+	}
+	if app.mesh.IndexType == vk.IndexTypeUint16 {
+		constants.MeshIndex16 = 1
+	}
+	rayTraceConstants.Push(cb, app.rayTracingLayout, constants)
+	app.rayTracer.CmdTraceRays(cb, app.rayTracingSBT, img.Width, img.Height)
+	img.CmdTransitionTo(cb, vk.ImageLayoutTransferSrcOptimal)
+
+	target := app.target.Images[imageIndex]
+	cmdTargetBarrier(cb, target, app.target.FinalLayout, vk.ImageLayoutTransferDstOptimal,
+		vk.AccessFlags(vk.AccessColorAttachmentWriteBit), vk.AccessFlags(vk.AccessTransferWriteBit),
+		vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit))
+	layers := vk.ImageSubresourceLayers{
+		AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+		LayerCount: 1,
+	}
+	corner := vk.Offset3D{X: int32(extent.Width), Y: int32(extent.Height), Z: 1}
+	vk.CmdBlitImage(cb, img.Handle, vk.ImageLayoutTransferSrcOptimal, target, vk.ImageLayoutTransferDstOptimal,
+		1, []vk.ImageBlit{{
+			SrcSubresource: layers,
+			SrcOffsets:     [2]vk.Offset3D{{}, corner},
+			DstSubresource: layers,
+			DstOffsets:     [2]vk.Offset3D{{}, corner},
+		}}, vk.FilterNearest)
+	// Back where the render pass left it for the overlays' render passes
+	cmdTargetBarrier(cb, target, vk.ImageLayoutTransferDstOptimal, app.target.FinalLayout,
+		vk.AccessFlags(vk.AccessTransferWriteBit), vk.AccessFlags(vk.AccessColorAttachmentReadBit|vk.AccessColorAttachmentWriteBit),
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit))
+}
+
+// cmdTargetBarrier moves a target image, which isn't a gpu.Image tracking
+// its own layout, between layouts.
+func cmdTargetBarrier(cb vk.CommandBuffer, img vk.Image, oldLayout, newLayout vk.ImageLayout,
+	srcAccess, dstAccess vk.AccessFlags, srcStage, dstStage vk.PipelineStageFlags) {
+	vk.CmdPipelineBarrier(cb, srcStage, dstStage, 0,
+		0, nil,
+		0, nil,
+		1, []vk.ImageMemoryBarrier{{
+			SType:               vk.StructureTypeImageMemoryBarrier,
+			SrcAccessMask:       srcAccess,
+			DstAccessMask:       dstAccess,
+			OldLayout:           oldLayout,
+			NewLayout:           newLayout,
+			SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+			DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+			Image:               img,
+			SubresourceRange: vk.ImageSubresourceRange{
+				AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+				LevelCount: 1,
+				LayerCount: 1,
+			},
+		}},
+	)
+}
+
+// toggleRayTracing switches the primary window between the rasterized
+// scene and the ray traced sample.
+func (app *HelloTriangleApplication) toggleRayTracing() {
+	if app.rayTracer == nil {
+		app.logger.Info("Can't switch ray tracing", logging.F("reason", "not available"))
+		return
+	}
+	app.rayTraced = !app.rayTraced
+	app.logger.Info("Switched ray tracing", logging.F("enabled", app.rayTraced))
+}
+
+func (app *HelloTriangleApplication) destroyRayTracingTarget() {
+	if app.rayTraceImage != nil {
+		app.rayTraceImage.Destroy()
+		app.rayTraceImage = nil
+	}
+}
+
+func (app *HelloTriangleApplication) destroyRayTracing() {
+	if app.rayTracingDescriptors != nil {
+		app.rayTracingDescriptors.Destroy()
+	}
+	if app.rayTracingSBT != nil {
+		app.rayTracingSBT.Destroy()
+	}
+	if app.rayTracingPipeline != vk.NullPipeline {
+		app.release(app.rayTracingPipeline)
+		vk.DestroyPipeline(app.device, app.rayTracingPipeline, nil)
+	}
+	if app.rayTracingLayout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(app.device, app.rayTracingLayout, nil)
+	}
+	if app.rayTracingSetLayout != vk.NullDescriptorSetLayout {
+		app.release(app.rayTracingSetLayout)
+		vk.DestroyDescriptorSetLayout(app.device, app.rayTracingSetLayout, nil)
+	}
+	if app.tlas != nil {
+		app.tlas.Destroy()
+	}
+	for _, as := range []*raytracing.AccelerationStructure{app.rayTracedMesh, app.rayTracedSample} {
+		if as != nil {
+			as.Destroy()
+		}
+	}
+	for _, b := range []*gpu.Buffer{app.rayTracedIndices, app.rayTracedVertices} {
+		if b != nil {
+			b.Destroy()
+		}
+	}
+}
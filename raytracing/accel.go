@@ -0,0 +1,242 @@
+package raytracing
+
+/*
+#include "raytracing.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Level is a VkAccelerationStructureTypeKHR.
+type Level int32
+
+const (
+	// TopLevel structures hold instances of bottom level ones.
+	TopLevel Level = 0
+	// BottomLevel structures hold geometry.
+	BottomLevel Level = 1
+)
+
+// BuildFlags are VkBuildAccelerationStructureFlagsKHR.
+type BuildFlags uint32
+
+const (
+	BuildAllowUpdate     BuildFlags = 0x1
+	BuildAllowCompaction BuildFlags = 0x2
+	BuildPreferFastTrace BuildFlags = 0x4
+	BuildPreferFastBuild BuildFlags = 0x8
+)
+
+// geometryOpaque is VK_GEOMETRY_OPAQUE_BIT_KHR, skipping any hit shaders.
+const geometryOpaque = 0x1
+
+// Geometry is what a structure is built from, either Triangles or
+// Instances.
+type Geometry interface {
+	set(g *C.VkAccelerationStructureGeometryKHR)
+	primitives() uint32
+}
+
+// Triangles are indexed triangles in buffers created with
+// BufferUsageAccelerationStructureBuildInputReadOnlyBit and
+// BufferUsageShaderDeviceAddressBit. They're opaque.
+type Triangles struct {
+	VertexFormat  vk.Format
+	VertexAddress uint64
+	VertexStride  vk.DeviceSize
+	// MaxVertex is the highest index.
+	MaxVertex    uint32
+	IndexType    vk.IndexType
+	IndexAddress uint64
+	// Count is how many triangles there are.
+	Count uint32
+}
+
+func (t Triangles) set(g *C.VkAccelerationStructureGeometryKHR) {
+	C.setTriangles(g, geometryOpaque, C.int32_t(t.VertexFormat), C.VkDeviceAddress(t.VertexAddress),
+		C.VkDeviceSize(t.VertexStride), C.uint32_t(t.MaxVertex), C.int32_t(t.IndexType), C.VkDeviceAddress(t.IndexAddress))
+}
+
+func (t Triangles) primitives() uint32 {
+	return t.Count
+}
+
+// Instances are Count Instance structs at Address, for a top level
+// structure.
+type Instances struct {
+	Address uint64
+	Count   uint32
+}
+
+func (i Instances) set(g *C.VkAccelerationStructureGeometryKHR) {
+	C.setInstances(g, geometryOpaque, C.VkDeviceAddress(i.Address))
+}
+
+func (i Instances) primitives() uint32 {
+	return i.Count
+}
+
+// Instance is laid out like VkAccelerationStructureInstanceKHR, a bottom
+// level structure placed in a top level one.
+type Instance struct {
+	// Transform is the top three rows of a row major 4x4 matrix.
+	Transform [12]float32
+	// CustomIndexMask is the 24 bit gl_InstanceCustomIndexEXT with the 8 bit
+	// mask rays are culled against above it.
+	CustomIndexMask uint32
+	// SBTOffsetFlags is the 24 bit hit group offset with 8 bits of
+	// VkGeometryInstanceFlagsKHR above it.
+	SBTOffsetFlags uint32
+	// Reference is the bottom level structure's Address.
+	Reference uint64
+}
+
+// NewInstance places the bottom level structure blas with transform, a
+// column major matrix as vmath builds them. It's visible to every ray and
+// uses the first hit group.
+func NewInstance(blas *AccelerationStructure, transform [16]float32, customIndex uint32) Instance {
+	var rows [12]float32
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 4; c++ {
+			rows[r*4+c] = transform[c*4+r]
+		}
+	}
+	return Instance{
+		Transform:       rows,
+		CustomIndexMask: customIndex&0xffffff | 0xff<<24,
+		Reference:       blas.Address,
+	}
+}
+
+// Sizes is how big a structure and the scratch memory to build it are.
+type Sizes struct {
+	Structure     vk.DeviceSize
+	BuildScratch  vk.DeviceSize
+	UpdateScratch vk.DeviceSize
+}
+
+// BuildSizes is how big a structure of geometries built with flags is.
+func (d *Device) BuildSizes(level Level, flags BuildFlags, geometries []Geometry) Sizes {
+	cGeometries, counts := geometryInfos(geometries)
+	var sizes C.VkAccelerationStructureBuildSizesInfoKHR
+	C.getBuildSizes(&d.fn, d.cDevice(), C.int32_t(level), C.uint32_t(flags),
+		C.uint32_t(len(cGeometries)), &cGeometries[0], &counts[0], &sizes)
+	return Sizes{
+		Structure:     vk.DeviceSize(sizes.accelerationStructureSize),
+		BuildScratch:  vk.DeviceSize(sizes.buildScratchSize),
+		UpdateScratch: vk.DeviceSize(sizes.updateScratchSize),
+	}
+}
+
+func geometryInfos(geometries []Geometry) ([]C.VkAccelerationStructureGeometryKHR, []C.uint32_t) {
+	cGeometries := make([]C.VkAccelerationStructureGeometryKHR, len(geometries))
+	counts := make([]C.uint32_t, len(geometries))
+	for i, g := range geometries {
+		g.set(&cGeometries[i])
+		counts[i] = C.uint32_t(g.primitives())
+	}
+	return cGeometries, counts
+}
+
+// AccelerationStructure is an acceleration structure in a buffer of its
+// own.
+type AccelerationStructure struct {
+	device *Device
+	handle C.VkAccelerationStructureKHR
+
+	Level  Level
+	Buffer *gpu.Buffer
+	// Address is what instances refer to a bottom level structure by.
+	Address uint64
+
+	// flags, geometries and sizes are what a Builder built it with, for
+	// building it again and refitting it.
+	flags      BuildFlags
+	geometries []Geometry
+	sizes      Sizes
+}
+
+// NewAccelerationStructure creates an unbuilt structure of size bytes.
+func (d *Device) NewAccelerationStructure(ctx gpu.Context, level Level, size vk.DeviceSize) (*AccelerationStructure, error) {
+	usage := vk.BufferUsageFlags(BufferUsageAccelerationStructureStorageBit | BufferUsageShaderDeviceAddressBit)
+	buffer, err := gpu.NewBuffer(ctx, size, usage, memory.GPUOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create acceleration structure buffer")
+	}
+
+	as := &AccelerationStructure{device: d, Level: level, Buffer: buffer}
+	result := C.createAccelerationStructure(&d.fn, d.cDevice(), C.VkBuffer(unsafe.Pointer(buffer.Handle)),
+		0, C.VkDeviceSize(size), C.int32_t(level), &as.handle)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		buffer.Destroy()
+		return nil, errors.Wrap(err, "can't create acceleration structure")
+	}
+	as.Address = uint64(C.getAccelerationStructureDeviceAddress(&d.fn, d.cDevice(), as.handle))
+	return as, nil
+}
+
+// Mode is a VkBuildAccelerationStructureModeKHR.
+type Mode int32
+
+const (
+	// ModeBuild builds a structure from scratch.
+	ModeBuild Mode = 0
+	// ModeUpdate refits a structure built with BuildAllowUpdate to
+	// geometry that's moved, from src into as which can be the same.
+	ModeUpdate Mode = 1
+)
+
+// CmdBuild records building as from geometries with scratch memory at
+// scratch, which has to be aligned to the device's
+// minAccelerationStructureScratchOffsetAlignment. src is only used when
+// updating.
+func (as *AccelerationStructure) CmdBuild(cb vk.CommandBuffer, flags BuildFlags, mode Mode, src *AccelerationStructure, geometries []Geometry, scratch uint64) {
+	cGeometries, counts := geometryInfos(geometries)
+	ranges := make([]C.VkAccelerationStructureBuildRangeInfoKHR, len(geometries))
+	for i := range ranges {
+		ranges[i].primitiveCount = counts[i]
+	}
+	var srcHandle C.VkAccelerationStructureKHR
+	if src != nil {
+		srcHandle = src.handle
+	}
+	C.cmdBuild(&as.device.fn, C.VkCommandBuffer(unsafe.Pointer(cb)), C.int32_t(as.Level), C.uint32_t(flags), C.int32_t(mode),
+		srcHandle, as.handle, C.VkDeviceAddress(scratch),
+		C.uint32_t(len(cGeometries)), &cGeometries[0], &ranges[0])
+}
+
+// Destroy destroys the structure and its buffer.
+func (as *AccelerationStructure) Destroy() {
+	if as.handle != nil {
+		C.destroyAccelerationStructure(&as.device.fn, as.device.cDevice(), as.handle)
+		as.handle = nil
+	}
+	if as.Buffer != nil {
+		as.Buffer.Destroy()
+		as.Buffer = nil
+	}
+}
+
+// CmdBuildBarrier records a barrier making earlier structure builds
+// visible to later builds and ray tracing shaders.
+func CmdBuildBarrier(cb vk.CommandBuffer) {
+	vk.CmdPipelineBarrier(cb,
+		vk.PipelineStageFlags(PipelineStageAccelerationStructureBuildBit),
+		vk.PipelineStageFlags(PipelineStageAccelerationStructureBuildBit|PipelineStageRayTracingShaderBit),
+		0,
+		1, []vk.MemoryBarrier{{
+			SType:         vk.StructureTypeMemoryBarrier,
+			SrcAccessMask: vk.AccessFlags(AccessAccelerationStructureWriteBit),
+			DstAccessMask: vk.AccessFlags(AccessAccelerationStructureReadBit | AccessAccelerationStructureWriteBit),
+		}},
+		0, nil,
+		0, nil,
+	)
+}
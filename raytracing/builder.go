@@ -0,0 +1,372 @@
+package raytracing
+
+/*
+#include "raytracing.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DefaultMaxScratch is the most scratch memory a Builder's batch of builds
+// shares when MaxScratch isn't set.
+const DefaultMaxScratch = 64 << 20
+
+// queryTypeCompactedSize is VK_QUERY_TYPE_ACCELERATION_STRUCTURE_COMPACTED_SIZE_KHR.
+const queryTypeCompactedSize vk.QueryType = 1000150000
+
+const scratchUsage = vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit) | vk.BufferUsageFlags(BufferUsageShaderDeviceAddressBit)
+
+// Builder builds bottom level structures from meshes' vertex and index
+// buffers, and top level ones over them. Structures added are built
+// together by Build, in batches sharing one scratch buffer, and the ones
+// added with BuildAllowCompaction are then copied into buffers of the size
+// the build actually took.
+type Builder struct {
+	device *Device
+	ctx    gpu.Context
+	props  Properties
+	// MaxScratch caps the scratch memory a batch of builds shares,
+	// DefaultMaxScratch when zero. Batches are built one after the other
+	// reusing it, a structure needing more is a batch of its own.
+	MaxScratch vk.DeviceSize
+
+	pending []*AccelerationStructure
+}
+
+// NewBuilder creates a builder of structures in ctx's memory, respecting
+// props' alignments.
+func (d *Device) NewBuilder(ctx gpu.Context, props Properties) *Builder {
+	return &Builder{device: d, ctx: ctx, props: props}
+}
+
+// MeshTriangles is the opaque triangles of count indices of indexType from
+// the start of indices, into vertices whose positions are three floats at
+// the start of each stride bytes. Both buffers have to have been created
+// with BufferUsageAccelerationStructureBuildInputReadOnlyBit and
+// BufferUsageShaderDeviceAddressBit.
+func (d *Device) MeshTriangles(vertices *gpu.Buffer, stride vk.DeviceSize, indices *gpu.Buffer, indexType vk.IndexType, count uint32) Triangles {
+	return Triangles{
+		VertexFormat:  vk.FormatR32g32b32Sfloat,
+		VertexAddress: d.BufferAddress(vertices.Handle),
+		VertexStride:  stride,
+		MaxVertex:     uint32(vertices.Size/stride) - 1,
+		IndexType:     indexType,
+		IndexAddress:  d.BufferAddress(indices.Handle),
+		Count:         count / 3,
+	}
+}
+
+// Add creates a bottom level structure of geometries, built by the next
+// Build.
+func (b *Builder) Add(geometries []Geometry, flags BuildFlags) (*AccelerationStructure, error) {
+	if len(geometries) == 0 {
+		return nil, errors.New("acceleration structure has no geometry")
+	}
+	sizes := b.device.BuildSizes(BottomLevel, flags, geometries)
+	as, err := b.device.NewAccelerationStructure(b.ctx, BottomLevel, sizes.Structure)
+	if err != nil {
+		return nil, err
+	}
+	as.flags, as.geometries, as.sizes = flags, geometries, sizes
+	b.pending = append(b.pending, as)
+	return as, nil
+}
+
+// BuildStats describes what a Build did.
+type BuildStats struct {
+	Structures int
+	Batches    int
+	// Scratch is the size of the scratch buffer the batches shared.
+	Scratch vk.DeviceSize
+	// Size is the structures' size as built, Compacted after compaction.
+	Size      vk.DeviceSize
+	Compacted vk.DeviceSize
+}
+
+// Build builds every structure added since the last Build on queue and
+// waits for it, then compacts the ones added with BuildAllowCompaction.
+// Compacting moves a structure to another buffer, changing its Address,
+// so instances of it have to be made afterwards.
+func (b *Builder) Build(pool *commands.Pool, queue vk.Queue) (BuildStats, error) {
+	pending := b.pending
+	b.pending = nil
+	stats := BuildStats{Structures: len(pending)}
+	if len(pending) == 0 {
+		return stats, nil
+	}
+
+	alignment := uint64(b.props.ScratchAlignment)
+	batches, scratchSize := b.batches(pending, alignment)
+	stats.Batches = len(batches)
+	stats.Scratch = vk.DeviceSize(scratchSize)
+	// Buffers aren't necessarily aligned to the scratch alignment, builds
+	// start at the first address that is
+	scratch, err := gpu.NewBuffer(b.ctx, vk.DeviceSize(scratchSize+alignment), scratchUsage, memory.GPUOnly)
+	if err != nil {
+		return stats, errors.Wrap(err, "can't create acceleration structure scratch buffer")
+	}
+	defer scratch.Destroy()
+	base := align(b.device.BufferAddress(scratch.Handle), alignment)
+
+	var compacting []*AccelerationStructure
+	for _, as := range pending {
+		stats.Size += as.Buffer.Size
+		if as.flags&BuildAllowCompaction != 0 {
+			compacting = append(compacting, as)
+		}
+	}
+	queries := vk.NullQueryPool
+	if len(compacting) > 0 {
+		poolInfo := &vk.QueryPoolCreateInfo{
+			SType:      vk.StructureTypeQueryPoolCreateInfo,
+			QueryType:  queryTypeCompactedSize,
+			QueryCount: uint32(len(compacting)),
+		}
+		if err := vk.Error(vk.CreateQueryPool(b.device.device, poolInfo, nil, &queries)); err != nil {
+			return stats, errors.Wrap(err, "can't create compacted size query pool")
+		}
+		defer vk.DestroyQueryPool(b.device.device, queries, nil)
+	}
+
+	err = pool.OneTimeSubmit(queue, func(cb vk.CommandBuffer) {
+		for i, batch := range batches {
+			// The batch before has to be done with the scratch memory
+			if i > 0 {
+				CmdBuildBarrier(cb)
+			}
+			offset := uint64(0)
+			for _, as := range batch {
+				as.CmdBuild(cb, as.flags, ModeBuild, nil, as.geometries, base+offset)
+				offset += align(uint64(as.sizes.BuildScratch), alignment)
+			}
+		}
+		CmdBuildBarrier(cb)
+		if len(compacting) > 0 {
+			vk.CmdResetQueryPool(cb, queries, 0, uint32(len(compacting)))
+			handles := make([]C.VkAccelerationStructureKHR, len(compacting))
+			for i, as := range compacting {
+				handles[i] = as.handle
+			}
+			C.cmdWriteCompactedSizes(&b.device.fn, C.VkCommandBuffer(unsafe.Pointer(cb)),
+				C.uint32_t(len(handles)), &handles[0], C.VkQueryPool(unsafe.Pointer(queries)), 0)
+		}
+	})
+	if err != nil {
+		return stats, errors.Wrap(err, "can't build acceleration structures")
+	}
+
+	stats.Compacted = stats.Size
+	if len(compacting) > 0 {
+		saved, err := b.compact(pool, queue, compacting, queries)
+		if err != nil {
+			return stats, err
+		}
+		stats.Compacted -= saved
+	}
+	return stats, nil
+}
+
+// batches splits structures into batches whose scratch memory, each build's
+// aligned, fits in MaxScratch, returning them and the biggest batch's.
+func (b *Builder) batches(structures []*AccelerationStructure, alignment uint64) ([][]*AccelerationStructure, uint64) {
+	max := uint64(b.MaxScratch)
+	if max == 0 {
+		max = DefaultMaxScratch
+	}
+	var batches [][]*AccelerationStructure
+	var batch []*AccelerationStructure
+	var size, biggest uint64
+	for _, as := range structures {
+		scratch := align(uint64(as.sizes.BuildScratch), alignment)
+		if len(batch) > 0 && size+scratch > max {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, as)
+		size += scratch
+		if size > biggest {
+			biggest = size
+		}
+	}
+	return append(batches, batch), biggest
+}
+
+// compact copies structures into structures of the sizes queries say they
+// compact to, swapping them in place of the originals, and returns how
+// many bytes that saved.
+func (b *Builder) compact(pool *commands.Pool, queue vk.Queue, structures []*AccelerationStructure, queries vk.QueryPool) (vk.DeviceSize, error) {
+	sizes := make([]uint64, len(structures))
+	result := vk.GetQueryPoolResults(b.device.device, queries, 0, uint32(len(sizes)),
+		uint(len(sizes)*8), unsafe.Pointer(&sizes[0]), 8,
+		vk.QueryResultFlags(vk.QueryResult64Bit|vk.QueryResultWaitBit))
+	if err := vk.Error(result); err != nil {
+		return 0, errors.Wrap(err, "can't get compacted sizes")
+	}
+
+	compacted := make([]*AccelerationStructure, len(structures))
+	destroy := func() {
+		for _, as := range compacted {
+			if as != nil {
+				as.Destroy()
+			}
+		}
+	}
+	for i, as := range structures {
+		c, err := b.device.NewAccelerationStructure(b.ctx, as.Level, vk.DeviceSize(sizes[i]))
+		if err != nil {
+			destroy()
+			return 0, errors.Wrap(err, "can't create compacted acceleration structure")
+		}
+		compacted[i] = c
+	}
+	err := pool.OneTimeSubmit(queue, func(cb vk.CommandBuffer) {
+		for i, as := range structures {
+			C.cmdCompact(&b.device.fn, C.VkCommandBuffer(unsafe.Pointer(cb)), as.handle, compacted[i].handle)
+		}
+		CmdBuildBarrier(cb)
+	})
+	if err != nil {
+		destroy()
+		return 0, errors.Wrap(err, "can't compact acceleration structures")
+	}
+
+	var saved vk.DeviceSize
+	for i, as := range structures {
+		c := compacted[i]
+		saved += as.Buffer.Size - c.Buffer.Size
+		C.destroyAccelerationStructure(&b.device.fn, b.device.cDevice(), as.handle)
+		as.Buffer.Destroy()
+		as.handle, as.Buffer, as.Address = c.handle, c.Buffer, c.Address
+	}
+	return saved, nil
+}
+
+// CmdRefit records refitting as, added to a Builder with BuildAllowUpdate,
+// to its geometry having moved in the same buffers. Refitting is quicker
+// than building but traces slower the further the geometry moves. scratch
+// has to be UpdateScratch bytes aligned like a build's.
+func (as *AccelerationStructure) CmdRefit(cb vk.CommandBuffer, scratch uint64) error {
+	if as.flags&BuildAllowUpdate == 0 {
+		return errors.New("acceleration structure wasn't built to be updated")
+	}
+	as.CmdBuild(cb, as.flags, ModeUpdate, as, as.geometries, scratch)
+	return nil
+}
+
+// UpdateScratch is how much scratch memory CmdRefit takes.
+func (as *AccelerationStructure) UpdateScratch() vk.DeviceSize {
+	return as.sizes.UpdateScratch
+}
+
+// TopLevelStructure is a top level structure over instances that move
+// every frame. It's refitted while the number of instances stays the same,
+// which is quicker than rebuilding and fine for instances moving around
+// without changing the scene's shape much, and rebuilt when it changes.
+type TopLevelStructure struct {
+	*AccelerationStructure
+	MaxInstances uint32
+
+	// instances has room for MaxInstances per frame in flight so a frame
+	// doesn't overwrite the ones an earlier frame's build is still reading.
+	instances      *gpu.Buffer
+	instanceBase   uint64
+	scratch        *gpu.Buffer
+	scratchAddress uint64
+	// built is how many instances the structure was last built from, -1
+	// before it's been built.
+	built int
+}
+
+// NewTopLevel creates a top level structure of up to maxInstances, with
+// instances written by CmdUpdate for each of frames frames in flight.
+func (b *Builder) NewTopLevel(maxInstances uint32, frames int, flags BuildFlags) (*TopLevelStructure, error) {
+	flags |= BuildAllowUpdate
+	geometries := []Geometry{Instances{Count: maxInstances}}
+	sizes := b.device.BuildSizes(TopLevel, flags, geometries)
+	as, err := b.device.NewAccelerationStructure(b.ctx, TopLevel, sizes.Structure)
+	if err != nil {
+		return nil, err
+	}
+	as.flags, as.sizes = flags, sizes
+	t := &TopLevelStructure{AccelerationStructure: as, MaxInstances: maxInstances, built: -1}
+
+	size := vk.DeviceSize(frames) * vk.DeviceSize(maxInstances) * vk.DeviceSize(unsafe.Sizeof(Instance{}))
+	usage := vk.BufferUsageFlags(BufferUsageAccelerationStructureBuildInputReadOnlyBit | BufferUsageShaderDeviceAddressBit)
+	if t.instances, err = gpu.NewBuffer(b.ctx, size, usage, memory.CPUToGPU); err != nil {
+		t.Destroy()
+		return nil, errors.Wrap(err, "can't create instance buffer")
+	}
+	t.instanceBase = b.device.BufferAddress(t.instances.Handle)
+
+	scratch := sizes.BuildScratch
+	if sizes.UpdateScratch > scratch {
+		scratch = sizes.UpdateScratch
+	}
+	alignment := uint64(b.props.ScratchAlignment)
+	if t.scratch, err = gpu.NewBuffer(b.ctx, scratch+vk.DeviceSize(alignment), scratchUsage, memory.GPUOnly); err != nil {
+		t.Destroy()
+		return nil, errors.Wrap(err, "can't create top level scratch buffer")
+	}
+	t.scratchAddress = align(b.device.BufferAddress(t.scratch.Handle), alignment)
+	return t, nil
+}
+
+// CmdUpdate writes instances into frame's part of the instance buffer and
+// records refitting the structure to them, or building it when the number
+// of them changed. Rays traced afterwards see the new instances.
+func (t *TopLevelStructure) CmdUpdate(cb vk.CommandBuffer, frame int, instances []Instance) error {
+	if len(instances) > int(t.MaxInstances) {
+		return errors.Errorf("%d instances don't fit in a top level structure of %d", len(instances), t.MaxInstances)
+	}
+	stride := uint64(t.MaxInstances) * uint64(unsafe.Sizeof(Instance{}))
+	offset := uint64(frame) * stride
+	if len(instances) > 0 {
+		data := unsafe.Slice((*byte)(unsafe.Pointer(&instances[0])), len(instances)*int(unsafe.Sizeof(Instance{})))
+		copy(t.instances.Mapped()[offset:], data)
+	}
+
+	// Rays traced and builds recorded earlier have to be done with the
+	// structure and the scratch memory before they're rewritten
+	vk.CmdPipelineBarrier(cb,
+		vk.PipelineStageFlags(PipelineStageRayTracingShaderBit|PipelineStageAccelerationStructureBuildBit),
+		vk.PipelineStageFlags(PipelineStageAccelerationStructureBuildBit),
+		0,
+		1, []vk.MemoryBarrier{{
+			SType:         vk.StructureTypeMemoryBarrier,
+			SrcAccessMask: vk.AccessFlags(AccessAccelerationStructureReadBit | AccessAccelerationStructureWriteBit),
+			DstAccessMask: vk.AccessFlags(AccessAccelerationStructureReadBit | AccessAccelerationStructureWriteBit),
+		}},
+		0, nil,
+		0, nil,
+	)
+	mode, src := ModeBuild, (*AccelerationStructure)(nil)
+	if t.built == len(instances) {
+		mode, src = ModeUpdate, t.AccelerationStructure
+	}
+	geometries := []Geometry{Instances{Address: t.instanceBase + offset, Count: uint32(len(instances))}}
+	t.CmdBuild(cb, t.flags, mode, src, geometries, t.scratchAddress)
+	CmdBuildBarrier(cb)
+	t.built = len(instances)
+	return nil
+}
+
+// Destroy destroys the structure and its buffers.
+func (t *TopLevelStructure) Destroy() {
+	t.AccelerationStructure.Destroy()
+	if t.instances != nil {
+		t.instances.Destroy()
+		t.instances = nil
+	}
+	if t.scratch != nil {
+		t.scratch.Destroy()
+		t.scratch = nil
+	}
+}
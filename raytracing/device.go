@@ -0,0 +1,174 @@
+// Package raytracing implements the parts of VK_KHR_ray_tracing_pipeline,
+// VK_KHR_acceleration_structure and VK_KHR_buffer_device_address the
+// renderer uses, which vulkan-go doesn't bind. Entry points are loaded
+// through vkGetDeviceProcAddr so the only C dependency is the small set of
+// declarations in raytracing.h.
+package raytracing
+
+/*
+#include "raytracing.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Flags and enums the bindings predate.
+const (
+	BufferUsageShaderDeviceAddressBit                     vk.BufferUsageFlagBits = 0x00020000
+	BufferUsageShaderBindingTableBit                      vk.BufferUsageFlagBits = 0x00000400
+	BufferUsageAccelerationStructureBuildInputReadOnlyBit vk.BufferUsageFlagBits = 0x00080000
+	BufferUsageAccelerationStructureStorageBit            vk.BufferUsageFlagBits = 0x00100000
+
+	ShaderStageRaygenBit       vk.ShaderStageFlagBits = 0x00000100
+	ShaderStageAnyHitBit       vk.ShaderStageFlagBits = 0x00000200
+	ShaderStageClosestHitBit   vk.ShaderStageFlagBits = 0x00000400
+	ShaderStageMissBit         vk.ShaderStageFlagBits = 0x00000800
+	ShaderStageIntersectionBit vk.ShaderStageFlagBits = 0x00001000
+
+	PipelineStageRayTracingShaderBit           vk.PipelineStageFlagBits = 0x00200000
+	PipelineStageAccelerationStructureBuildBit vk.PipelineStageFlagBits = 0x02000000
+	AccessAccelerationStructureReadBit         vk.AccessFlagBits        = 0x00200000
+	AccessAccelerationStructureWriteBit        vk.AccessFlagBits        = 0x00400000
+	DescriptorTypeAccelerationStructure        vk.DescriptorType        = 1000150000
+	PipelineBindPointRayTracing                vk.PipelineBindPoint     = 1000165000
+	shaderUnused                                                        = ^uint32(0)
+)
+
+// Device is a logical device's ray tracing entry points.
+type Device struct {
+	device vk.Device
+	fn     C.LVFunctions
+}
+
+// Load loads device's entry points, it has to have been created with
+// Extensions and the Features enabled.
+func Load(getInstanceProcAddr unsafe.Pointer, instance vk.Instance, device vk.Device) (*Device, error) {
+	if getInstanceProcAddr == nil {
+		return nil, errors.New("vkGetInstanceProcAddr is nil")
+	}
+	d := &Device{device: device}
+	result := C.loadFunctions(getInstanceProcAddr, C.VkInstance(unsafe.Pointer(instance)), C.VkDevice(unsafe.Pointer(device)), &d.fn)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return nil, errors.Wrap(err, "can't load ray tracing functions")
+	}
+	return d, nil
+}
+
+// BufferAddress is buffer's address on the GPU, it has to have been created
+// with BufferUsageShaderDeviceAddressBit.
+func (d *Device) BufferAddress(buffer vk.Buffer) uint64 {
+	return uint64(C.getBufferDeviceAddress(&d.fn, d.cDevice(), C.VkBuffer(unsafe.Pointer(buffer))))
+}
+
+// Stage is a ray tracing shader.
+type Stage struct {
+	Stage  vk.ShaderStageFlagBits
+	Module vk.ShaderModule
+}
+
+// GroupType is a VkRayTracingShaderGroupTypeKHR.
+type GroupType int32
+
+const (
+	// GroupGeneral is a ray generation, miss or callable shader.
+	GroupGeneral GroupType = 0
+	// GroupTriangles is hit shaders for triangle geometry.
+	GroupTriangles GroupType = 1
+)
+
+// Group is a shader group, which the shader binding table has a record of.
+// Shaders are indexes into the pipeline's stages.
+type Group struct {
+	Type GroupType
+	// General is the stage of a general group.
+	General int
+	// ClosestHit and AnyHit are the stages of a triangles group, -1 when
+	// it doesn't have one.
+	ClosestHit int
+	AnyHit     int
+}
+
+// GeneralGroup is a group of stage alone.
+func GeneralGroup(stage int) Group {
+	return Group{Type: GroupGeneral, General: stage, ClosestHit: -1, AnyHit: -1}
+}
+
+// HitGroup is a triangles group with a closest hit stage.
+func HitGroup(closestHit int) Group {
+	return Group{Type: GroupTriangles, General: -1, ClosestHit: closestHit, AnyHit: -1}
+}
+
+// CreatePipeline creates a ray tracing pipeline from stages, whose entry
+// points are main, and groups. Rays can trace rays maxRecursionDepth deep.
+func (d *Device) CreatePipeline(layout vk.PipelineLayout, stages []Stage, groups []Group, maxRecursionDepth uint32) (vk.Pipeline, error) {
+	if len(stages) == 0 || len(groups) == 0 {
+		return vk.NullPipeline, errors.New("ray tracing pipeline needs stages and groups")
+	}
+	stageBits := make([]C.uint32_t, len(stages))
+	modules := make([]C.VkShaderModule, len(stages))
+	for i, s := range stages {
+		stageBits[i] = C.uint32_t(s.Stage)
+		modules[i] = C.VkShaderModule(unsafe.Pointer(s.Module))
+	}
+	cGroups := make([]C.LVShaderGroup, len(groups))
+	for i, g := range groups {
+		cGroups[i] = C.LVShaderGroup{
+			_type:              C.int32_t(g.Type),
+			generalShader:      shaderIndex(g.General),
+			closestHitShader:   shaderIndex(g.ClosestHit),
+			anyHitShader:       shaderIndex(g.AnyHit),
+			intersectionShader: C.uint32_t(shaderUnused),
+		}
+	}
+
+	var pipeline C.VkPipeline
+	result := C.createPipeline(&d.fn, d.cDevice(), C.VkPipelineLayout(unsafe.Pointer(layout)),
+		C.uint32_t(len(stages)), &stageBits[0], &modules[0],
+		C.uint32_t(len(groups)), &cGroups[0],
+		C.uint32_t(maxRecursionDepth), &pipeline)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return vk.NullPipeline, errors.Wrap(err, "can't create ray tracing pipeline")
+	}
+	return vk.Pipeline(unsafe.Pointer(pipeline)), nil
+}
+
+func shaderIndex(i int) C.uint32_t {
+	if i < 0 {
+		return C.uint32_t(shaderUnused)
+	}
+	return C.uint32_t(i)
+}
+
+// GroupHandles returns the handles of pipeline's first count groups, size
+// bytes each, to copy into a shader binding table.
+func (d *Device) GroupHandles(pipeline vk.Pipeline, count int, size uint32) ([]byte, error) {
+	data := make([]byte, count*int(size))
+	result := C.getGroupHandles(&d.fn, d.cDevice(), C.VkPipeline(unsafe.Pointer(pipeline)),
+		C.uint32_t(count), C.uintptr_t(len(data)), unsafe.Pointer(&data[0]))
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return nil, errors.Wrap(err, "can't get shader group handles")
+	}
+	return data, nil
+}
+
+// CmdTraceRays traces a width by height grid of rays with the bound ray
+// tracing pipeline and sbt's shaders.
+func (d *Device) CmdTraceRays(cb vk.CommandBuffer, sbt *ShaderBindingTable, width, height uint32) {
+	C.cmdTraceRays(&d.fn, C.VkCommandBuffer(unsafe.Pointer(cb)),
+		&sbt.raygen, &sbt.miss, &sbt.hit, &sbt.callable,
+		C.uint32_t(width), C.uint32_t(height), 1)
+}
+
+// WriteAccelerationStructure points binding of set at as.
+func (d *Device) WriteAccelerationStructure(set vk.DescriptorSet, binding uint32, as *AccelerationStructure) {
+	C.writeAccelerationStructure(&d.fn, d.cDevice(), C.VkDescriptorSet(unsafe.Pointer(set)), C.uint32_t(binding), as.handle)
+}
+
+func (d *Device) cDevice() C.VkDevice {
+	return C.VkDevice(unsafe.Pointer(d.device))
+}
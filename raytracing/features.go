@@ -0,0 +1,199 @@
+package raytracing
+
+import (
+	"runtime"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Device extensions ray tracing needs, the first three for the features
+// themselves and the rest for what they're built on.
+const (
+	PipelineExtension              = "VK_KHR_ray_tracing_pipeline"
+	AccelerationStructureExtension = "VK_KHR_acceleration_structure"
+	BufferDeviceAddressExtension   = "VK_KHR_buffer_device_address"
+)
+
+// Extensions are every device extension ray tracing needs.
+var Extensions = []string{
+	PipelineExtension,
+	AccelerationStructureExtension,
+	BufferDeviceAddressExtension,
+	"VK_KHR_deferred_host_operations",
+	"VK_EXT_descriptor_indexing",
+	"VK_KHR_spirv_1_4",
+	"VK_KHR_shader_float_controls",
+}
+
+// Structure types of the structs below, the bindings predate the
+// extensions.
+const (
+	structureTypeBufferDeviceAddressFeatures   vk.StructureType = 1000257000
+	structureTypeAccelerationStructureFeatures vk.StructureType = 1000150013
+	structureTypePipelineFeatures              vk.StructureType = 1000347000
+	structureTypePipelineProperties            vk.StructureType = 1000347001
+	structureTypeAccelerationStructureProps    vk.StructureType = 1000150014
+)
+
+// bufferDeviceAddressFeatures is laid out like
+// VkPhysicalDeviceBufferDeviceAddressFeaturesKHR.
+type bufferDeviceAddressFeatures struct {
+	sType                            vk.StructureType
+	pNext                            unsafe.Pointer
+	bufferDeviceAddress              vk.Bool32
+	bufferDeviceAddressCaptureReplay vk.Bool32
+	bufferDeviceAddressMultiDevice   vk.Bool32
+}
+
+// accelerationStructureFeatures is laid out like
+// VkPhysicalDeviceAccelerationStructureFeaturesKHR.
+type accelerationStructureFeatures struct {
+	sType                                                 vk.StructureType
+	pNext                                                 unsafe.Pointer
+	accelerationStructure                                 vk.Bool32
+	accelerationStructureCaptureReplay                    vk.Bool32
+	accelerationStructureIndirectBuild                    vk.Bool32
+	accelerationStructureHostCommands                     vk.Bool32
+	descriptorBindingAccelerationStructureUpdateAfterBind vk.Bool32
+}
+
+// pipelineFeatures is laid out like
+// VkPhysicalDeviceRayTracingPipelineFeaturesKHR.
+type pipelineFeatures struct {
+	sType                                                 vk.StructureType
+	pNext                                                 unsafe.Pointer
+	rayTracingPipeline                                    vk.Bool32
+	rayTracingPipelineShaderGroupHandleCaptureReplay      vk.Bool32
+	rayTracingPipelineShaderGroupHandleCaptureReplayMixed vk.Bool32
+	rayTracingPipelineTraceRaysIndirect                   vk.Bool32
+	rayTraversalPrimitiveCulling                          vk.Bool32
+}
+
+// pipelineProperties is laid out like
+// VkPhysicalDeviceRayTracingPipelinePropertiesKHR.
+type pipelineProperties struct {
+	sType                              vk.StructureType
+	pNext                              unsafe.Pointer
+	shaderGroupHandleSize              uint32
+	maxRayRecursionDepth               uint32
+	maxShaderGroupStride               uint32
+	shaderGroupBaseAlignment           uint32
+	shaderGroupHandleCaptureReplaySize uint32
+	maxRayDispatchInvocationCount      uint32
+	shaderGroupHandleAlignment         uint32
+	maxRayHitAttributeSize             uint32
+}
+
+// accelerationStructureProperties is laid out like
+// VkPhysicalDeviceAccelerationStructurePropertiesKHR.
+type accelerationStructureProperties struct {
+	sType                                                      vk.StructureType
+	pNext                                                      unsafe.Pointer
+	maxGeometryCount                                           uint64
+	maxInstanceCount                                           uint64
+	maxPrimitiveCount                                          uint64
+	maxPerStageDescriptorAccelerationStructures                uint32
+	maxPerStageDescriptorUpdateAfterBindAccelerationStructures uint32
+	maxDescriptorSetAccelerationStructures                     uint32
+	maxDescriptorSetUpdateAfterBindAccelerationStructures      uint32
+	minAccelerationStructureScratchOffsetAlignment             uint32
+}
+
+// Features is the chain of feature structs ray tracing needs, enabled,
+// to put on vk.DeviceCreateInfo's PNext. It has to be kept alive until the
+// device is created.
+type Features struct {
+	bufferDeviceAddress   bufferDeviceAddressFeatures
+	accelerationStructure accelerationStructureFeatures
+	pipeline              pipelineFeatures
+}
+
+// NewFeatures enables every feature ray tracing needs, chained in front of
+// next.
+func NewFeatures(next unsafe.Pointer) *Features {
+	f := &Features{}
+	f.pipeline = pipelineFeatures{
+		sType:              structureTypePipelineFeatures,
+		pNext:              next,
+		rayTracingPipeline: vk.True,
+	}
+	f.accelerationStructure = accelerationStructureFeatures{
+		sType:                 structureTypeAccelerationStructureFeatures,
+		pNext:                 unsafe.Pointer(&f.pipeline),
+		accelerationStructure: vk.True,
+	}
+	f.bufferDeviceAddress = bufferDeviceAddressFeatures{
+		sType:               structureTypeBufferDeviceAddressFeatures,
+		pNext:               unsafe.Pointer(&f.accelerationStructure),
+		bufferDeviceAddress: vk.True,
+	}
+	return f
+}
+
+// Pointer is the head of the chain.
+func (f *Features) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(&f.bufferDeviceAddress)
+}
+
+// Supported reports whether physicalDevice has every feature ray tracing
+// needs. Its extensions have to have been checked for Extensions first.
+func Supported(physicalDevice vk.PhysicalDevice) bool {
+	f := &Features{}
+	f.pipeline.sType = structureTypePipelineFeatures
+	f.accelerationStructure = accelerationStructureFeatures{
+		sType: structureTypeAccelerationStructureFeatures,
+		pNext: unsafe.Pointer(&f.pipeline),
+	}
+	f.bufferDeviceAddress = bufferDeviceAddressFeatures{
+		sType: structureTypeBufferDeviceAddressFeatures,
+		pNext: unsafe.Pointer(&f.accelerationStructure),
+	}
+	features := vk.PhysicalDeviceFeatures2{
+		SType: vk.StructureTypePhysicalDeviceFeatures2,
+		PNext: f.Pointer(),
+	}
+	vk.GetPhysicalDeviceFeatures2(physicalDevice, &features)
+	runtime.KeepAlive(f)
+	return f.bufferDeviceAddress.bufferDeviceAddress.B() &&
+		f.accelerationStructure.accelerationStructure.B() &&
+		f.pipeline.rayTracingPipeline.B()
+}
+
+// Properties are the limits shader binding tables and acceleration
+// structure builds have to respect.
+type Properties struct {
+	// HandleSize is the size of a shader group handle.
+	HandleSize uint32
+	// HandleAlignment is the alignment of each record in a table.
+	HandleAlignment uint32
+	// BaseAlignment is the alignment of the start of each table.
+	BaseAlignment uint32
+	// MaxRecursionDepth is how deep rays can trace rays.
+	MaxRecursionDepth uint32
+	// ScratchAlignment is the alignment of build scratch memory.
+	ScratchAlignment uint32
+}
+
+// QueryProperties returns physicalDevice's ray tracing limits.
+func QueryProperties(physicalDevice vk.PhysicalDevice) Properties {
+	as := &accelerationStructureProperties{sType: structureTypeAccelerationStructureProps}
+	rt := &pipelineProperties{
+		sType: structureTypePipelineProperties,
+		pNext: unsafe.Pointer(as),
+	}
+	properties := vk.PhysicalDeviceProperties2{
+		SType: vk.StructureTypePhysicalDeviceProperties2,
+		PNext: unsafe.Pointer(rt),
+	}
+	vk.GetPhysicalDeviceProperties2(physicalDevice, &properties)
+	runtime.KeepAlive(rt)
+	runtime.KeepAlive(as)
+	return Properties{
+		HandleSize:        rt.shaderGroupHandleSize,
+		HandleAlignment:   rt.shaderGroupHandleAlignment,
+		BaseAlignment:     rt.shaderGroupBaseAlignment,
+		MaxRecursionDepth: rt.maxRayRecursionDepth,
+		ScratchAlignment:  as.minAccelerationStructureScratchOffsetAlignment,
+	}
+}
@@ -0,0 +1,223 @@
+#include <stddef.h>
+
+#include "raytracing.h"
+
+typedef void (*PFN_vkVoidFunction)(void);
+typedef PFN_vkVoidFunction (*PFN_vkGetInstanceProcAddr)(VkInstance instance, const char* pName);
+typedef PFN_vkVoidFunction (*PFN_vkGetDeviceProcAddr)(VkDevice device, const char* pName);
+typedef VkDeviceAddress (*PFN_vkGetBufferDeviceAddressKHR)(VkDevice device, const VkBufferDeviceAddressInfo* pInfo);
+typedef VkResult (*PFN_vkCreateAccelerationStructureKHR)(VkDevice device, const VkAccelerationStructureCreateInfoKHR* pCreateInfo, const void* pAllocator, VkAccelerationStructureKHR* pAccelerationStructure);
+typedef void (*PFN_vkDestroyAccelerationStructureKHR)(VkDevice device, VkAccelerationStructureKHR accelerationStructure, const void* pAllocator);
+typedef void (*PFN_vkGetAccelerationStructureBuildSizesKHR)(VkDevice device, int32_t buildType, const VkAccelerationStructureBuildGeometryInfoKHR* pBuildInfo, const uint32_t* pMaxPrimitiveCounts, VkAccelerationStructureBuildSizesInfoKHR* pSizeInfo);
+typedef void (*PFN_vkCmdBuildAccelerationStructuresKHR)(VkCommandBuffer commandBuffer, uint32_t infoCount, const VkAccelerationStructureBuildGeometryInfoKHR* pInfos, const VkAccelerationStructureBuildRangeInfoKHR* const* ppBuildRangeInfos);
+typedef VkDeviceAddress (*PFN_vkGetAccelerationStructureDeviceAddressKHR)(VkDevice device, const VkAccelerationStructureDeviceAddressInfoKHR* pInfo);
+typedef void (*PFN_vkCmdWriteAccelerationStructuresPropertiesKHR)(VkCommandBuffer commandBuffer, uint32_t accelerationStructureCount, const VkAccelerationStructureKHR* pAccelerationStructures, int32_t queryType, VkQueryPool queryPool, uint32_t firstQuery);
+typedef void (*PFN_vkCmdCopyAccelerationStructureKHR)(VkCommandBuffer commandBuffer, const VkCopyAccelerationStructureInfoKHR* pInfo);
+typedef VkResult (*PFN_vkCreateRayTracingPipelinesKHR)(VkDevice device, const void* deferredOperation, const void* pipelineCache, uint32_t createInfoCount, const VkRayTracingPipelineCreateInfoKHR* pCreateInfos, const void* pAllocator, VkPipeline* pPipelines);
+typedef VkResult (*PFN_vkGetRayTracingShaderGroupHandlesKHR)(VkDevice device, VkPipeline pipeline, uint32_t firstGroup, uint32_t groupCount, size_t dataSize, void* pData);
+typedef void (*PFN_vkCmdTraceRaysKHR)(VkCommandBuffer commandBuffer, const VkStridedDeviceAddressRegionKHR* pRaygenShaderBindingTable, const VkStridedDeviceAddressRegionKHR* pMissShaderBindingTable, const VkStridedDeviceAddressRegionKHR* pHitShaderBindingTable, const VkStridedDeviceAddressRegionKHR* pCallableShaderBindingTable, uint32_t width, uint32_t height, uint32_t depth);
+typedef void (*PFN_vkUpdateDescriptorSets)(VkDevice device, uint32_t descriptorWriteCount, const VkWriteDescriptorSet* pDescriptorWrites, uint32_t descriptorCopyCount, const void* pDescriptorCopies);
+
+VkResult loadFunctions(void* getInstanceProcAddr, VkInstance instance, VkDevice device, LVFunctions* fn) {
+	PFN_vkGetDeviceProcAddr getDeviceProcAddr = (PFN_vkGetDeviceProcAddr)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(instance, "vkGetDeviceProcAddr");
+	if (getDeviceProcAddr == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+
+	fn->getBufferDeviceAddress = (void*)getDeviceProcAddr(device, "vkGetBufferDeviceAddressKHR");
+	fn->createAccelerationStructure = (void*)getDeviceProcAddr(device, "vkCreateAccelerationStructureKHR");
+	fn->destroyAccelerationStructure = (void*)getDeviceProcAddr(device, "vkDestroyAccelerationStructureKHR");
+	fn->getAccelerationStructureBuildSizes = (void*)getDeviceProcAddr(device, "vkGetAccelerationStructureBuildSizesKHR");
+	fn->cmdBuildAccelerationStructures = (void*)getDeviceProcAddr(device, "vkCmdBuildAccelerationStructuresKHR");
+	fn->getAccelerationStructureDeviceAddress = (void*)getDeviceProcAddr(device, "vkGetAccelerationStructureDeviceAddressKHR");
+	fn->cmdWriteAccelerationStructuresProperties = (void*)getDeviceProcAddr(device, "vkCmdWriteAccelerationStructuresPropertiesKHR");
+	fn->cmdCopyAccelerationStructure = (void*)getDeviceProcAddr(device, "vkCmdCopyAccelerationStructureKHR");
+	fn->createRayTracingPipelines = (void*)getDeviceProcAddr(device, "vkCreateRayTracingPipelinesKHR");
+	fn->getRayTracingShaderGroupHandles = (void*)getDeviceProcAddr(device, "vkGetRayTracingShaderGroupHandlesKHR");
+	fn->cmdTraceRays = (void*)getDeviceProcAddr(device, "vkCmdTraceRaysKHR");
+	fn->updateDescriptorSets = (void*)getDeviceProcAddr(device, "vkUpdateDescriptorSets");
+
+	void* all[] = {
+		fn->getBufferDeviceAddress,
+		fn->createAccelerationStructure,
+		fn->destroyAccelerationStructure,
+		fn->getAccelerationStructureBuildSizes,
+		fn->cmdBuildAccelerationStructures,
+		fn->getAccelerationStructureDeviceAddress,
+		fn->cmdWriteAccelerationStructuresProperties,
+		fn->cmdCopyAccelerationStructure,
+		fn->createRayTracingPipelines,
+		fn->getRayTracingShaderGroupHandles,
+		fn->cmdTraceRays,
+		fn->updateDescriptorSets,
+	};
+	for (size_t i = 0; i < sizeof(all) / sizeof(all[0]); i++) {
+		if (all[i] == NULL) {
+			return LV_ERROR_EXTENSION_NOT_PRESENT;
+		}
+	}
+	return 0;
+}
+
+VkDeviceAddress getBufferDeviceAddress(const LVFunctions* fn, VkDevice device, VkBuffer buffer) {
+	VkBufferDeviceAddressInfo info = {
+		.sType = LV_STRUCTURE_TYPE_BUFFER_DEVICE_ADDRESS_INFO,
+		.buffer = buffer,
+	};
+	return ((PFN_vkGetBufferDeviceAddressKHR)fn->getBufferDeviceAddress)(device, &info);
+}
+
+void setTriangles(VkAccelerationStructureGeometryKHR* geometry, uint32_t flags, int32_t vertexFormat, VkDeviceAddress vertexData, VkDeviceSize vertexStride, uint32_t maxVertex, int32_t indexType, VkDeviceAddress indexData) {
+	*geometry = (VkAccelerationStructureGeometryKHR){
+		.sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_GEOMETRY_KHR,
+		.geometryType = LV_GEOMETRY_TYPE_TRIANGLES_KHR,
+		.geometry.triangles = {
+			.sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_GEOMETRY_TRIANGLES_DATA_KHR,
+			.vertexFormat = vertexFormat,
+			.vertexData.deviceAddress = vertexData,
+			.vertexStride = vertexStride,
+			.maxVertex = maxVertex,
+			.indexType = indexType,
+			.indexData.deviceAddress = indexData,
+		},
+		.flags = flags,
+	};
+}
+
+void setInstances(VkAccelerationStructureGeometryKHR* geometry, uint32_t flags, VkDeviceAddress data) {
+	*geometry = (VkAccelerationStructureGeometryKHR){
+		.sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_GEOMETRY_KHR,
+		.geometryType = LV_GEOMETRY_TYPE_INSTANCES_KHR,
+		.geometry.instances = {
+			.sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_GEOMETRY_INSTANCES_DATA_KHR,
+			.data.deviceAddress = data,
+		},
+		.flags = flags,
+	};
+}
+
+VkResult createAccelerationStructure(const LVFunctions* fn, VkDevice device, VkBuffer buffer, VkDeviceSize offset, VkDeviceSize size, int32_t type, VkAccelerationStructureKHR* pAccelerationStructure) {
+	VkAccelerationStructureCreateInfoKHR createInfo = {
+		.sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_CREATE_INFO_KHR,
+		.buffer = buffer,
+		.offset = offset,
+		.size = size,
+		.type = type,
+	};
+	return ((PFN_vkCreateAccelerationStructureKHR)fn->createAccelerationStructure)(device, &createInfo, NULL, pAccelerationStructure);
+}
+
+void destroyAccelerationStructure(const LVFunctions* fn, VkDevice device, VkAccelerationStructureKHR accelerationStructure) {
+	((PFN_vkDestroyAccelerationStructureKHR)fn->destroyAccelerationStructure)(device, accelerationStructure, NULL);
+}
+
+VkDeviceAddress getAccelerationStructureDeviceAddress(const LVFunctions* fn, VkDevice device, VkAccelerationStructureKHR accelerationStructure) {
+	VkAccelerationStructureDeviceAddressInfoKHR info = {
+		.sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_DEVICE_ADDRESS_INFO_KHR,
+		.accelerationStructure = accelerationStructure,
+	};
+	return ((PFN_vkGetAccelerationStructureDeviceAddressKHR)fn->getAccelerationStructureDeviceAddress)(device, &info);
+}
+
+void getBuildSizes(const LVFunctions* fn, VkDevice device, int32_t type, uint32_t flags, uint32_t geometryCount, const VkAccelerationStructureGeometryKHR* geometries, const uint32_t* maxPrimitiveCounts, VkAccelerationStructureBuildSizesInfoKHR* sizes) {
+	VkAccelerationStructureBuildGeometryInfoKHR buildInfo = {
+		.sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_BUILD_GEOMETRY_INFO_KHR,
+		.type = type,
+		.flags = flags,
+		.geometryCount = geometryCount,
+		.pGeometries = geometries,
+	};
+	sizes->sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_BUILD_SIZES_INFO_KHR;
+	sizes->pNext = NULL;
+	((PFN_vkGetAccelerationStructureBuildSizesKHR)fn->getAccelerationStructureBuildSizes)(device, LV_ACCELERATION_STRUCTURE_BUILD_TYPE_DEVICE_KHR, &buildInfo, maxPrimitiveCounts, sizes);
+}
+
+void cmdBuild(const LVFunctions* fn, VkCommandBuffer cb, int32_t type, uint32_t flags, int32_t mode, VkAccelerationStructureKHR src, VkAccelerationStructureKHR dst, VkDeviceAddress scratch, uint32_t geometryCount, const VkAccelerationStructureGeometryKHR* geometries, const VkAccelerationStructureBuildRangeInfoKHR* ranges) {
+	VkAccelerationStructureBuildGeometryInfoKHR buildInfo = {
+		.sType = LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_BUILD_GEOMETRY_INFO_KHR,
+		.type = type,
+		.flags = flags,
+		.mode = mode,
+		.srcAccelerationStructure = src,
+		.dstAccelerationStructure = dst,
+		.geometryCount = geometryCount,
+		.pGeometries = geometries,
+		.scratchData.deviceAddress = scratch,
+	};
+	// One range per geometry, all of them for the one build
+	((PFN_vkCmdBuildAccelerationStructuresKHR)fn->cmdBuildAccelerationStructures)(cb, 1, &buildInfo, &ranges);
+}
+
+void cmdWriteCompactedSizes(const LVFunctions* fn, VkCommandBuffer cb, uint32_t count, const VkAccelerationStructureKHR* structures, VkQueryPool pool, uint32_t firstQuery) {
+	((PFN_vkCmdWriteAccelerationStructuresPropertiesKHR)fn->cmdWriteAccelerationStructuresProperties)(cb, count, structures, LV_QUERY_TYPE_ACCELERATION_STRUCTURE_COMPACTED_SIZE_KHR, pool, firstQuery);
+}
+
+void cmdCompact(const LVFunctions* fn, VkCommandBuffer cb, VkAccelerationStructureKHR src, VkAccelerationStructureKHR dst) {
+	VkCopyAccelerationStructureInfoKHR info = {
+		.sType = LV_STRUCTURE_TYPE_COPY_ACCELERATION_STRUCTURE_INFO_KHR,
+		.src = src,
+		.dst = dst,
+		.mode = LV_COPY_ACCELERATION_STRUCTURE_MODE_COMPACT_KHR,
+	};
+	((PFN_vkCmdCopyAccelerationStructureKHR)fn->cmdCopyAccelerationStructure)(cb, &info);
+}
+
+VkResult createPipeline(const LVFunctions* fn, VkDevice device, VkPipelineLayout layout, uint32_t stageCount, const uint32_t* stages, const VkShaderModule* modules, uint32_t groupCount, const LVShaderGroup* groups, uint32_t maxRecursionDepth, VkPipeline* pPipeline) {
+	VkPipelineShaderStageCreateInfo stageInfos[stageCount];
+	for (uint32_t i = 0; i < stageCount; i++) {
+		stageInfos[i] = (VkPipelineShaderStageCreateInfo){
+			.sType = LV_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO,
+			.stage = stages[i],
+			.module = modules[i],
+			.pName = "main",
+		};
+	}
+	VkRayTracingShaderGroupCreateInfoKHR groupInfos[groupCount];
+	for (uint32_t i = 0; i < groupCount; i++) {
+		groupInfos[i] = (VkRayTracingShaderGroupCreateInfoKHR){
+			.sType = LV_STRUCTURE_TYPE_RAY_TRACING_SHADER_GROUP_CREATE_INFO_KHR,
+			.type = groups[i].type,
+			.generalShader = groups[i].generalShader,
+			.closestHitShader = groups[i].closestHitShader,
+			.anyHitShader = groups[i].anyHitShader,
+			.intersectionShader = groups[i].intersectionShader,
+		};
+	}
+
+	VkRayTracingPipelineCreateInfoKHR createInfo = {
+		.sType = LV_STRUCTURE_TYPE_RAY_TRACING_PIPELINE_CREATE_INFO_KHR,
+		.stageCount = stageCount,
+		.pStages = stageInfos,
+		.groupCount = groupCount,
+		.pGroups = groupInfos,
+		.maxPipelineRayRecursionDepth = maxRecursionDepth,
+		.layout = layout,
+		.basePipelineIndex = -1,
+	};
+	return ((PFN_vkCreateRayTracingPipelinesKHR)fn->createRayTracingPipelines)(device, NULL, NULL, 1, &createInfo, NULL, pPipeline);
+}
+
+VkResult getGroupHandles(const LVFunctions* fn, VkDevice device, VkPipeline pipeline, uint32_t groupCount, uintptr_t dataSize, void* data) {
+	return ((PFN_vkGetRayTracingShaderGroupHandlesKHR)fn->getRayTracingShaderGroupHandles)(device, pipeline, 0, groupCount, dataSize, data);
+}
+
+void cmdTraceRays(const LVFunctions* fn, VkCommandBuffer cb, const VkStridedDeviceAddressRegionKHR* raygen, const VkStridedDeviceAddressRegionKHR* miss, const VkStridedDeviceAddressRegionKHR* hit, const VkStridedDeviceAddressRegionKHR* callable, uint32_t width, uint32_t height, uint32_t depth) {
+	((PFN_vkCmdTraceRaysKHR)fn->cmdTraceRays)(cb, raygen, miss, hit, callable, width, height, depth);
+}
+
+void writeAccelerationStructure(const LVFunctions* fn, VkDevice device, VkDescriptorSet set, uint32_t binding, VkAccelerationStructureKHR accelerationStructure) {
+	VkWriteDescriptorSetAccelerationStructureKHR asInfo = {
+		.sType = LV_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET_ACCELERATION_STRUCTURE_KHR,
+		.accelerationStructureCount = 1,
+		.pAccelerationStructures = &accelerationStructure,
+	};
+	VkWriteDescriptorSet write = {
+		.sType = LV_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET,
+		.pNext = &asInfo,
+		.dstSet = set,
+		.dstBinding = binding,
+		.descriptorCount = 1,
+		.descriptorType = LV_DESCRIPTOR_TYPE_ACCELERATION_STRUCTURE_KHR,
+	};
+	((PFN_vkUpdateDescriptorSets)fn->updateDescriptorSets)(device, 1, &write, 0, NULL);
+}
@@ -0,0 +1,259 @@
+// The subset of VK_KHR_ray_tracing_pipeline, VK_KHR_acceleration_structure
+// and VK_KHR_buffer_device_address the package needs, declared here so it
+// builds without the Vulkan headers. Layouts follow vulkan_core.h.
+#ifndef LEARNVULKAN_RAYTRACING_H
+#define LEARNVULKAN_RAYTRACING_H
+
+#include <stdint.h>
+
+typedef struct VkInstance_T* VkInstance;
+typedef struct VkDevice_T* VkDevice;
+typedef struct VkCommandBuffer_T* VkCommandBuffer;
+typedef struct VkBuffer_T* VkBuffer;
+typedef struct VkPipeline_T* VkPipeline;
+typedef struct VkPipelineLayout_T* VkPipelineLayout;
+typedef struct VkShaderModule_T* VkShaderModule;
+typedef struct VkDescriptorSet_T* VkDescriptorSet;
+typedef struct VkAccelerationStructureKHR_T* VkAccelerationStructureKHR;
+typedef struct VkQueryPool_T* VkQueryPool;
+typedef uint64_t VkDeviceAddress;
+typedef uint64_t VkDeviceSize;
+typedef uint32_t VkBool32;
+typedef int32_t VkResult;
+
+#define LV_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET 35
+#define LV_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO 18
+#define LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_BUILD_GEOMETRY_INFO_KHR 1000150000
+#define LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_DEVICE_ADDRESS_INFO_KHR 1000150002
+#define LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_GEOMETRY_INSTANCES_DATA_KHR 1000150004
+#define LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_GEOMETRY_TRIANGLES_DATA_KHR 1000150005
+#define LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_GEOMETRY_KHR 1000150006
+#define LV_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET_ACCELERATION_STRUCTURE_KHR 1000150007
+#define LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_CREATE_INFO_KHR 1000150017
+#define LV_STRUCTURE_TYPE_ACCELERATION_STRUCTURE_BUILD_SIZES_INFO_KHR 1000150020
+#define LV_STRUCTURE_TYPE_COPY_ACCELERATION_STRUCTURE_INFO_KHR 1000150010
+#define LV_STRUCTURE_TYPE_RAY_TRACING_PIPELINE_CREATE_INFO_KHR 1000150015
+#define LV_STRUCTURE_TYPE_RAY_TRACING_SHADER_GROUP_CREATE_INFO_KHR 1000150016
+#define LV_STRUCTURE_TYPE_BUFFER_DEVICE_ADDRESS_INFO 1000244001
+#define LV_DESCRIPTOR_TYPE_ACCELERATION_STRUCTURE_KHR 1000150000
+#define LV_GEOMETRY_TYPE_TRIANGLES_KHR 0
+#define LV_GEOMETRY_TYPE_INSTANCES_KHR 2
+#define LV_ACCELERATION_STRUCTURE_BUILD_TYPE_DEVICE_KHR 1
+#define LV_QUERY_TYPE_ACCELERATION_STRUCTURE_COMPACTED_SIZE_KHR 1000150000
+#define LV_COPY_ACCELERATION_STRUCTURE_MODE_COMPACT_KHR 1
+#define LV_SHADER_UNUSED_KHR (~0U)
+#define LV_ERROR_EXTENSION_NOT_PRESENT -7
+
+typedef struct VkStridedDeviceAddressRegionKHR {
+	VkDeviceAddress deviceAddress;
+	VkDeviceSize stride;
+	VkDeviceSize size;
+} VkStridedDeviceAddressRegionKHR;
+
+typedef struct VkPipelineShaderStageCreateInfo {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	uint32_t stage;
+	VkShaderModule module;
+	const char* pName;
+	const void* pSpecializationInfo;
+} VkPipelineShaderStageCreateInfo;
+
+typedef struct VkRayTracingShaderGroupCreateInfoKHR {
+	int32_t sType;
+	const void* pNext;
+	int32_t type;
+	uint32_t generalShader;
+	uint32_t closestHitShader;
+	uint32_t anyHitShader;
+	uint32_t intersectionShader;
+	const void* pShaderGroupCaptureReplayHandle;
+} VkRayTracingShaderGroupCreateInfoKHR;
+
+typedef struct VkRayTracingPipelineCreateInfoKHR {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	uint32_t stageCount;
+	const VkPipelineShaderStageCreateInfo* pStages;
+	uint32_t groupCount;
+	const VkRayTracingShaderGroupCreateInfoKHR* pGroups;
+	uint32_t maxPipelineRayRecursionDepth;
+	const void* pLibraryInfo;
+	const void* pLibraryInterface;
+	const void* pDynamicState;
+	VkPipelineLayout layout;
+	VkPipeline basePipelineHandle;
+	int32_t basePipelineIndex;
+} VkRayTracingPipelineCreateInfoKHR;
+
+// VkDeviceOrHostAddressConstKHR and VkDeviceOrHostAddressKHR, only device
+// addresses are used.
+typedef union VkDeviceOrHostAddressKHR {
+	VkDeviceAddress deviceAddress;
+	void* hostAddress;
+} VkDeviceOrHostAddressKHR;
+
+typedef struct VkAccelerationStructureGeometryTrianglesDataKHR {
+	int32_t sType;
+	const void* pNext;
+	int32_t vertexFormat;
+	VkDeviceOrHostAddressKHR vertexData;
+	VkDeviceSize vertexStride;
+	uint32_t maxVertex;
+	int32_t indexType;
+	VkDeviceOrHostAddressKHR indexData;
+	VkDeviceOrHostAddressKHR transformData;
+} VkAccelerationStructureGeometryTrianglesDataKHR;
+
+typedef struct VkAccelerationStructureGeometryInstancesDataKHR {
+	int32_t sType;
+	const void* pNext;
+	VkBool32 arrayOfPointers;
+	VkDeviceOrHostAddressKHR data;
+} VkAccelerationStructureGeometryInstancesDataKHR;
+
+// VkAccelerationStructureGeometryDataKHR without the AABB member, which is
+// never bigger than the triangles.
+typedef union VkAccelerationStructureGeometryDataKHR {
+	VkAccelerationStructureGeometryTrianglesDataKHR triangles;
+	VkAccelerationStructureGeometryInstancesDataKHR instances;
+} VkAccelerationStructureGeometryDataKHR;
+
+typedef struct VkAccelerationStructureGeometryKHR {
+	int32_t sType;
+	const void* pNext;
+	int32_t geometryType;
+	VkAccelerationStructureGeometryDataKHR geometry;
+	uint32_t flags;
+} VkAccelerationStructureGeometryKHR;
+
+typedef struct VkAccelerationStructureBuildGeometryInfoKHR {
+	int32_t sType;
+	const void* pNext;
+	int32_t type;
+	uint32_t flags;
+	int32_t mode;
+	VkAccelerationStructureKHR srcAccelerationStructure;
+	VkAccelerationStructureKHR dstAccelerationStructure;
+	uint32_t geometryCount;
+	const VkAccelerationStructureGeometryKHR* pGeometries;
+	const VkAccelerationStructureGeometryKHR* const* ppGeometries;
+	VkDeviceOrHostAddressKHR scratchData;
+} VkAccelerationStructureBuildGeometryInfoKHR;
+
+typedef struct VkAccelerationStructureBuildRangeInfoKHR {
+	uint32_t primitiveCount;
+	uint32_t primitiveOffset;
+	uint32_t firstVertex;
+	uint32_t transformOffset;
+} VkAccelerationStructureBuildRangeInfoKHR;
+
+typedef struct VkAccelerationStructureBuildSizesInfoKHR {
+	int32_t sType;
+	const void* pNext;
+	VkDeviceSize accelerationStructureSize;
+	VkDeviceSize updateScratchSize;
+	VkDeviceSize buildScratchSize;
+} VkAccelerationStructureBuildSizesInfoKHR;
+
+typedef struct VkAccelerationStructureCreateInfoKHR {
+	int32_t sType;
+	const void* pNext;
+	uint32_t createFlags;
+	VkBuffer buffer;
+	VkDeviceSize offset;
+	VkDeviceSize size;
+	int32_t type;
+	VkDeviceAddress deviceAddress;
+} VkAccelerationStructureCreateInfoKHR;
+
+typedef struct VkAccelerationStructureDeviceAddressInfoKHR {
+	int32_t sType;
+	const void* pNext;
+	VkAccelerationStructureKHR accelerationStructure;
+} VkAccelerationStructureDeviceAddressInfoKHR;
+
+typedef struct VkCopyAccelerationStructureInfoKHR {
+	int32_t sType;
+	const void* pNext;
+	VkAccelerationStructureKHR src;
+	VkAccelerationStructureKHR dst;
+	int32_t mode;
+} VkCopyAccelerationStructureInfoKHR;
+
+typedef struct VkBufferDeviceAddressInfo {
+	int32_t sType;
+	const void* pNext;
+	VkBuffer buffer;
+} VkBufferDeviceAddressInfo;
+
+typedef struct VkWriteDescriptorSetAccelerationStructureKHR {
+	int32_t sType;
+	const void* pNext;
+	uint32_t accelerationStructureCount;
+	const VkAccelerationStructureKHR* pAccelerationStructures;
+} VkWriteDescriptorSetAccelerationStructureKHR;
+
+typedef struct VkWriteDescriptorSet {
+	int32_t sType;
+	const void* pNext;
+	VkDescriptorSet dstSet;
+	uint32_t dstBinding;
+	uint32_t dstArrayElement;
+	uint32_t descriptorCount;
+	int32_t descriptorType;
+	const void* pImageInfo;
+	const void* pBufferInfo;
+	const void* pTexelBufferView;
+} VkWriteDescriptorSet;
+
+// LVShaderGroup is a VkRayTracingShaderGroupCreateInfoKHR without the parts
+// that are always the same.
+typedef struct LVShaderGroup {
+	int32_t type;
+	uint32_t generalShader;
+	uint32_t closestHitShader;
+	uint32_t anyHitShader;
+	uint32_t intersectionShader;
+} LVShaderGroup;
+
+// LVFunctions are the device's extension entry points.
+typedef struct LVFunctions {
+	void* getBufferDeviceAddress;
+	void* createAccelerationStructure;
+	void* destroyAccelerationStructure;
+	void* getAccelerationStructureBuildSizes;
+	void* cmdBuildAccelerationStructures;
+	void* getAccelerationStructureDeviceAddress;
+	void* cmdWriteAccelerationStructuresProperties;
+	void* cmdCopyAccelerationStructure;
+	void* createRayTracingPipelines;
+	void* getRayTracingShaderGroupHandles;
+	void* cmdTraceRays;
+	void* updateDescriptorSets;
+} LVFunctions;
+
+VkResult loadFunctions(void* getInstanceProcAddr, VkInstance instance, VkDevice device, LVFunctions* fn);
+
+VkDeviceAddress getBufferDeviceAddress(const LVFunctions* fn, VkDevice device, VkBuffer buffer);
+
+void setTriangles(VkAccelerationStructureGeometryKHR* geometry, uint32_t flags, int32_t vertexFormat, VkDeviceAddress vertexData, VkDeviceSize vertexStride, uint32_t maxVertex, int32_t indexType, VkDeviceAddress indexData);
+void setInstances(VkAccelerationStructureGeometryKHR* geometry, uint32_t flags, VkDeviceAddress data);
+
+VkResult createAccelerationStructure(const LVFunctions* fn, VkDevice device, VkBuffer buffer, VkDeviceSize offset, VkDeviceSize size, int32_t type, VkAccelerationStructureKHR* pAccelerationStructure);
+void destroyAccelerationStructure(const LVFunctions* fn, VkDevice device, VkAccelerationStructureKHR accelerationStructure);
+VkDeviceAddress getAccelerationStructureDeviceAddress(const LVFunctions* fn, VkDevice device, VkAccelerationStructureKHR accelerationStructure);
+void getBuildSizes(const LVFunctions* fn, VkDevice device, int32_t type, uint32_t flags, uint32_t geometryCount, const VkAccelerationStructureGeometryKHR* geometries, const uint32_t* maxPrimitiveCounts, VkAccelerationStructureBuildSizesInfoKHR* sizes);
+void cmdBuild(const LVFunctions* fn, VkCommandBuffer cb, int32_t type, uint32_t flags, int32_t mode, VkAccelerationStructureKHR src, VkAccelerationStructureKHR dst, VkDeviceAddress scratch, uint32_t geometryCount, const VkAccelerationStructureGeometryKHR* geometries, const VkAccelerationStructureBuildRangeInfoKHR* ranges);
+void cmdWriteCompactedSizes(const LVFunctions* fn, VkCommandBuffer cb, uint32_t count, const VkAccelerationStructureKHR* structures, VkQueryPool pool, uint32_t firstQuery);
+void cmdCompact(const LVFunctions* fn, VkCommandBuffer cb, VkAccelerationStructureKHR src, VkAccelerationStructureKHR dst);
+
+VkResult createPipeline(const LVFunctions* fn, VkDevice device, VkPipelineLayout layout, uint32_t stageCount, const uint32_t* stages, const VkShaderModule* modules, uint32_t groupCount, const LVShaderGroup* groups, uint32_t maxRecursionDepth, VkPipeline* pPipeline);
+VkResult getGroupHandles(const LVFunctions* fn, VkDevice device, VkPipeline pipeline, uint32_t groupCount, uintptr_t dataSize, void* data);
+void cmdTraceRays(const LVFunctions* fn, VkCommandBuffer cb, const VkStridedDeviceAddressRegionKHR* raygen, const VkStridedDeviceAddressRegionKHR* miss, const VkStridedDeviceAddressRegionKHR* hit, const VkStridedDeviceAddressRegionKHR* callable, uint32_t width, uint32_t height, uint32_t depth);
+
+void writeAccelerationStructure(const LVFunctions* fn, VkDevice device, VkDescriptorSet set, uint32_t binding, VkAccelerationStructureKHR accelerationStructure);
+
+#endif
@@ -0,0 +1,101 @@
+package raytracing
+
+/*
+#include "raytracing.h"
+*/
+import "C"
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// ShaderBindingTable holds a record of every group of a pipeline, split
+// into the regions vkCmdTraceRaysKHR takes.
+type ShaderBindingTable struct {
+	Buffer *gpu.Buffer
+
+	raygen, miss, hit, callable C.VkStridedDeviceAddressRegionKHR
+}
+
+// NewShaderBindingTable creates pipeline's table. Its groups have to be one
+// ray generation group, then misses miss groups, then hits hit groups.
+func (d *Device) NewShaderBindingTable(ctx gpu.Context, props Properties, pipeline vk.Pipeline, misses, hits int) (*ShaderBindingTable, error) {
+	groups := 1 + misses + hits
+	handles, err := d.GroupHandles(pipeline, groups, props.HandleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	stride := align(uint64(props.HandleSize), uint64(props.HandleAlignment))
+	base := uint64(props.BaseAlignment)
+	// The ray generation region's stride has to equal its size
+	raygenSize := align(stride, base)
+	missSize := align(stride*uint64(misses), base)
+	hitSize := align(stride*uint64(hits), base)
+
+	// Buffers aren't necessarily aligned to the base alignment, the
+	// regions start at the first address that is
+	size := raygenSize + missSize + hitSize + base
+	usage := vk.BufferUsageFlags(BufferUsageShaderBindingTableBit | BufferUsageShaderDeviceAddressBit)
+	buffer, err := gpu.NewBuffer(ctx, vk.DeviceSize(size), usage, memory.CPUToGPU)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create shader binding table")
+	}
+	address := d.BufferAddress(buffer.Handle)
+	start := align(address, base)
+
+	data := make([]byte, size)
+	offset := start - address
+	record := func(region uint64, i, group int) {
+		at := offset + region + uint64(i)*stride
+		copy(data[at:], handles[group*int(props.HandleSize):(group+1)*int(props.HandleSize)])
+	}
+	record(0, 0, 0)
+	for i := 0; i < misses; i++ {
+		record(raygenSize, i, 1+i)
+	}
+	for i := 0; i < hits; i++ {
+		record(raygenSize+missSize, i, 1+misses+i)
+	}
+	if err := buffer.Upload(data); err != nil {
+		buffer.Destroy()
+		return nil, errors.Wrap(err, "can't write shader binding table")
+	}
+
+	region := func(at, stride, size uint64) C.VkStridedDeviceAddressRegionKHR {
+		return C.VkStridedDeviceAddressRegionKHR{
+			deviceAddress: C.VkDeviceAddress(at),
+			stride:        C.VkDeviceSize(stride),
+			size:          C.VkDeviceSize(size),
+		}
+	}
+	sbt := &ShaderBindingTable{
+		Buffer: buffer,
+		raygen: region(start, raygenSize, raygenSize),
+	}
+	if misses > 0 {
+		sbt.miss = region(start+raygenSize, stride, missSize)
+	}
+	if hits > 0 {
+		sbt.hit = region(start+raygenSize+missSize, stride, hitSize)
+	}
+	return sbt, nil
+}
+
+// Destroy destroys the table's buffer.
+func (sbt *ShaderBindingTable) Destroy() {
+	if sbt.Buffer != nil {
+		sbt.Buffer.Destroy()
+		sbt.Buffer = nil
+	}
+}
+
+func align(n, alignment uint64) uint64 {
+	if alignment == 0 {
+		return n
+	}
+	return (n + alignment - 1) / alignment * alignment
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// readImage copies a 4 byte per pixel color image in layout into host
+// memory, returning it to layout afterwards. Rendering into it has to have
+// been submitted to the graphics queue already, the copy is ordered after it.
+func (app *HelloTriangleApplication) readImage(img vk.Image, extent vk.Extent2D, layout vk.ImageLayout) (*image.RGBA, error) {
+	rgba := image.NewRGBA(image.Rect(0, 0, int(extent.Width), int(extent.Height)))
+
+	readback, err := gpu.NewBuffer(app.gpuContext(),
+		vk.DeviceSize(len(rgba.Pix)),
+		vk.BufferUsageFlags(vk.BufferUsageTransferDstBit),
+		memory.GPUToCPU,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create readback buffer")
+	}
+	defer readback.Destroy()
+
+	err = app.commandPool.OneTimeSubmit(app.graphicsQueue, func(cb vk.CommandBuffer) {
+		cmdCopyImageToBuffer(cb, img, extent, layout, readback.Handle)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't copy image to readback buffer")
+	}
+
+	if err := readback.Download(rgba.Pix); err != nil {
+		return nil, errors.Wrap(err, "can't read readback buffer")
+	}
+	return rgba, nil
+}
+
+// cmdCopyImageToBuffer records a copy of a 4 byte per pixel color image in
+// layout into dst, ordered after color attachment writes and before host
+// reads. The image is returned to layout afterwards.
+func cmdCopyImageToBuffer(cb vk.CommandBuffer, img vk.Image, extent vk.Extent2D, layout vk.ImageLayout, dst vk.Buffer) {
+	barrier := vk.ImageMemoryBarrier{
+		SType:               vk.StructureTypeImageMemoryBarrier,
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		Image:               img,
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			BaseMipLevel:   0,
+			LevelCount:     1,
+			BaseArrayLayer: 0,
+			LayerCount:     1,
+		},
+	}
+
+	// Color writes have to land before the copy reads them
+	barrier.OldLayout = layout
+	barrier.NewLayout = vk.ImageLayoutTransferSrcOptimal
+	barrier.SrcAccessMask = vk.AccessFlags(vk.AccessColorAttachmentWriteBit)
+	barrier.DstAccessMask = vk.AccessFlags(vk.AccessTransferReadBit)
+	vk.CmdPipelineBarrier(cb,
+		vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+		0,
+		0, nil,
+		0, nil,
+		1, []vk.ImageMemoryBarrier{barrier},
+	)
+
+	vk.CmdCopyImageToBuffer(cb, img, vk.ImageLayoutTransferSrcOptimal, dst, 1, []vk.BufferImageCopy{{
+		BufferOffset: 0,
+		ImageSubresource: vk.ImageSubresourceLayers{
+			AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			MipLevel:       0,
+			BaseArrayLayer: 0,
+			LayerCount:     1,
+		},
+		ImageExtent: vk.Extent3D{
+			Width:  extent.Width,
+			Height: extent.Height,
+			Depth:  1,
+		},
+	}})
+
+	if layout != vk.ImageLayoutTransferSrcOptimal {
+		barrier.OldLayout = vk.ImageLayoutTransferSrcOptimal
+		barrier.NewLayout = layout
+		barrier.SrcAccessMask = vk.AccessFlags(vk.AccessTransferReadBit)
+		barrier.DstAccessMask = 0
+		vk.CmdPipelineBarrier(cb,
+			vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+			vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit),
+			0,
+			0, nil,
+			0, nil,
+			1, []vk.ImageMemoryBarrier{barrier},
+		)
+	}
+
+	vk.CmdPipelineBarrier(cb,
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+		vk.PipelineStageFlags(vk.PipelineStageHostBit),
+		0,
+		1, []vk.MemoryBarrier{{
+			SType:         vk.StructureTypeMemoryBarrier,
+			SrcAccessMask: vk.AccessFlags(vk.AccessTransferWriteBit),
+			DstAccessMask: vk.AccessFlags(vk.AccessHostReadBit),
+		}},
+		0, nil,
+		0, nil,
+	)
+}
+
+// normalizePixels rewrites 4 byte per pixel data in format as opaque RGBA.
+func normalizePixels(format vk.Format, pix []byte) error {
+	swizzle := false
+	switch format {
+	case vk.FormatR8g8b8a8Unorm, vk.FormatR8g8b8a8Srgb:
+	case vk.FormatB8g8r8a8Unorm, vk.FormatB8g8r8a8Srgb:
+		swizzle = true
+	default:
+		return errors.Errorf("can't convert format %d to RGBA", format)
+	}
+
+	for i := 0; i+3 < len(pix); i += 4 {
+		if swizzle {
+			pix[i], pix[i+2] = pix[i+2], pix[i]
+		}
+		// Windows are composited opaque whatever the alpha channel says
+		pix[i+3] = 0xff
+	}
+	return nil
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "can't create '%s'", path)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "can't encode '%s'", path)
+	}
+	return errors.Wrapf(f.Close(), "can't write '%s'", path)
+}
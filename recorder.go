@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Recording formats, raw is tightly packed RGBA that ffmpeg reads with
+// -f rawvideo -pix_fmt rgba.
+const (
+	RecordPNG = "png"
+	RecordRaw = "raw"
+)
+
+// recordedFrame is an entry of the recording's metadata.json.
+type recordedFrame struct {
+	File string `json:"file"`
+	// Frame is the application's frame number, Time the seconds since
+	// recording started when it was drawn.
+	Frame uint64  `json:"frame"`
+	Time  float64 `json:"time"`
+}
+
+type recordingMetadata struct {
+	Format string          `json:"format"`
+	Width  uint32          `json:"width"`
+	Height uint32          `json:"height"`
+	Every  int             `json:"every"`
+	Frames []recordedFrame `json:"frames"`
+}
+
+// pendingCapture is a copy recorded into a frame's command buffer whose
+// pixels are read back once the frame's fence signals.
+type pendingCapture struct {
+	file   string
+	format vk.Format
+	extent vk.Extent2D
+}
+
+type encodeJob struct {
+	path   string
+	pixels *image.RGBA
+}
+
+// frameRecorder writes every Nth frame to a directory. Copies are recorded
+// into the frame's own command buffer and read back the next time its frame
+// slot comes around, so capturing never waits on the GPU, and encoding
+// happens on background goroutines.
+type frameRecorder struct {
+	dir    string
+	every  int
+	format string
+	start  time.Time
+
+	// buffers and pending are indexed by frame in flight
+	buffers []*gpu.Buffer
+	pending []*pendingCapture
+
+	metadata recordingMetadata
+	jobs     chan encodeJob
+	wg       sync.WaitGroup
+	errOnce  sync.Once
+	err      error
+}
+
+func newFrameRecorder(dir string, every int, format string, framesInFlight int) (*frameRecorder, error) {
+	if every <= 0 {
+		every = 1
+	}
+	switch format {
+	case "":
+		format = RecordPNG
+	case RecordPNG, RecordRaw:
+	default:
+		return nil, errors.Errorf("unknown recording format '%s', use %s or %s", format, RecordPNG, RecordRaw)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "can't create recording directory '%s'", dir)
+	}
+
+	r := &frameRecorder{
+		dir:     dir,
+		every:   every,
+		format:  format,
+		start:   time.Now(),
+		buffers: make([]*gpu.Buffer, framesInFlight),
+		pending: make([]*pendingCapture, framesInFlight),
+		metadata: recordingMetadata{
+			Format: format,
+			Every:  every,
+		},
+		jobs: make(chan encodeJob, framesInFlight),
+	}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		r.wg.Add(1)
+		go r.encode()
+	}
+	return r, nil
+}
+
+func (r *frameRecorder) encode() {
+	defer r.wg.Done()
+	for job := range r.jobs {
+		var err error
+		if r.format == RecordRaw {
+			err = errors.Wrapf(os.WriteFile(job.path, job.pixels.Pix, 0644), "can't write '%s'", job.path)
+		} else {
+			err = writePNG(job.path, job.pixels)
+		}
+		if err != nil {
+			r.errOnce.Do(func() { r.err = err })
+		}
+	}
+}
+
+// prepare readies frame's readback buffer if frame number n is recorded,
+// reporting whether cmdCopy should be recorded for it. The frame's fence has
+// to have been waited on so its buffer is free.
+func (r *frameRecorder) prepare(app *HelloTriangleApplication, frame int, n uint64) (bool, error) {
+	if n%uint64(r.every) != 0 {
+		return false, nil
+	}
+	if err := normalizePixels(app.target.Format, nil); err != nil {
+		return false, err
+	}
+
+	extent := app.target.Extent
+	size := vk.DeviceSize(extent.Width) * vk.DeviceSize(extent.Height) * 4
+	if b := r.buffers[frame]; b == nil || b.Size < size {
+		if b != nil {
+			b.Destroy()
+		}
+		b, err := gpu.NewBuffer(app.gpuContext(),
+			size,
+			vk.BufferUsageFlags(vk.BufferUsageTransferDstBit),
+			memory.GPUToCPU,
+		)
+		if err != nil {
+			r.buffers[frame] = nil
+			return false, errors.Wrap(err, "can't create recording buffer")
+		}
+		r.buffers[frame] = b
+	}
+
+	file := fmt.Sprintf("frame-%06d.%s", len(r.metadata.Frames), r.format)
+	r.pending[frame] = &pendingCapture{
+		file:   file,
+		format: app.target.Format,
+		extent: extent,
+	}
+	r.metadata.Frames = append(r.metadata.Frames, recordedFrame{
+		File:  file,
+		Frame: n,
+		Time:  time.Since(r.start).Seconds(),
+	})
+	if r.metadata.Width == 0 {
+		r.metadata.Width, r.metadata.Height = extent.Width, extent.Height
+	}
+	return true, nil
+}
+
+// cmdCopy records copying img, which the frame just rendered, into the
+// frame's readback buffer.
+func (r *frameRecorder) cmdCopy(cb vk.CommandBuffer, frame int, img vk.Image, layout vk.ImageLayout) {
+	cmdCopyImageToBuffer(cb, img, r.pending[frame].extent, layout, r.buffers[frame].Handle)
+}
+
+// collect hands a finished capture in frame's slot to the encoders, the
+// frame's fence has to have signalled.
+func (r *frameRecorder) collect(frame int) error {
+	p := r.pending[frame]
+	if p == nil {
+		return nil
+	}
+	r.pending[frame] = nil
+
+	pixels := image.NewRGBA(image.Rect(0, 0, int(p.extent.Width), int(p.extent.Height)))
+	if err := r.buffers[frame].Download(pixels.Pix); err != nil {
+		return errors.Wrap(err, "can't read recording buffer")
+	}
+	if err := normalizePixels(p.format, pixels.Pix); err != nil {
+		return err
+	}
+	r.jobs <- encodeJob{
+		path:   filepath.Join(r.dir, p.file),
+		pixels: pixels,
+	}
+	return nil
+}
+
+// finish collects outstanding captures, waits for them to be written and
+// writes metadata.json. The device has to be idle.
+func (r *frameRecorder) finish() error {
+	var err error
+	for frame := range r.pending {
+		if cerr := r.collect(frame); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	close(r.jobs)
+	r.wg.Wait()
+	if err == nil {
+		err = r.err
+	}
+
+	metadata, merr := json.MarshalIndent(r.metadata, "", "  ")
+	if merr == nil {
+		path := filepath.Join(r.dir, "metadata.json")
+		merr = errors.Wrapf(os.WriteFile(path, metadata, 0644), "can't write '%s'", path)
+	}
+	if err == nil {
+		err = merr
+	}
+	return err
+}
+
+// Destroy releases the readback buffers.
+func (r *frameRecorder) Destroy() {
+	for i, b := range r.buffers {
+		if b != nil {
+			b.Destroy()
+			r.buffers[i] = nil
+		}
+	}
+}
+
+func (app *HelloTriangleApplication) startRecording() error {
+	if app.RecordDir == "" || app.Headless {
+		return nil
+	}
+
+	r, err := newFrameRecorder(app.RecordDir, app.RecordEvery, app.RecordFormat, app.framesInFlight())
+	if err != nil {
+		return err
+	}
+	app.recorder = r
+	app.logger.Info("Recording frames",
+		logging.F("dir", r.dir),
+		logging.F("every", r.every),
+		logging.F("format", r.format),
+	)
+	return nil
+}
+
+func (app *HelloTriangleApplication) finishRecording() error {
+	if app.recorder == nil {
+		return nil
+	}
+	err := app.recorder.finish()
+	app.logger.Info("Finished recording",
+		logging.F("dir", app.recorder.dir),
+		logging.F("frames", len(app.recorder.metadata.Frames)),
+	)
+	return err
+}
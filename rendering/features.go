@@ -0,0 +1,196 @@
+package rendering
+
+import (
+	"runtime"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Extension is VK_KHR_dynamic_rendering's name.
+const Extension = "VK_KHR_dynamic_rendering"
+
+// Extensions are every device extension dynamic rendering needs without
+// Vulkan 1.3, the rest are what VK_KHR_dynamic_rendering depends on.
+var Extensions = []string{
+	Extension,
+	"VK_KHR_depth_stencil_resolve",
+	"VK_KHR_create_renderpass2",
+}
+
+// Structure types the bindings predate.
+const (
+	structureTypeVulkan13Features                      vk.StructureType = 53
+	structureTypePipelineRenderingCreateInfo           vk.StructureType = 1000044002
+	structureTypeFeatures                              vk.StructureType = 1000044003
+	structureTypeCommandBufferInheritanceRenderingInfo vk.StructureType = 1000044004
+)
+
+// Features is laid out like VkPhysicalDeviceDynamicRenderingFeatures, to
+// put on vk.DeviceCreateInfo's PNext. It has to be kept alive until the
+// device is created.
+type Features struct {
+	sType            vk.StructureType
+	pNext            unsafe.Pointer
+	dynamicRendering vk.Bool32
+}
+
+// NewFeatures enables dynamic rendering, chained in front of next.
+func NewFeatures(next unsafe.Pointer) *Features {
+	return &Features{
+		sType:            structureTypeFeatures,
+		pNext:            next,
+		dynamicRendering: vk.True,
+	}
+}
+
+// Pointer is the struct to chain.
+func (f *Features) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(f)
+}
+
+// Supported reports whether physicalDevice has dynamic rendering. Its
+// extensions have to have been checked for Extensions first.
+func Supported(physicalDevice vk.PhysicalDevice) bool {
+	f := &Features{sType: structureTypeFeatures}
+	features := vk.PhysicalDeviceFeatures2{
+		SType: vk.StructureTypePhysicalDeviceFeatures2,
+		PNext: f.Pointer(),
+	}
+	vk.GetPhysicalDeviceFeatures2(physicalDevice, &features)
+	runtime.KeepAlive(f)
+	return f.dynamicRendering.B()
+}
+
+// CoreFeatures is laid out like VkPhysicalDeviceVulkan13Features, to put
+// on vk.DeviceCreateInfo's PNext of a Vulkan 1.3 device in place of
+// Features. It has to be kept alive until the device is created.
+type CoreFeatures struct {
+	sType                                              vk.StructureType
+	pNext                                              unsafe.Pointer
+	robustImageAccess                                  vk.Bool32
+	inlineUniformBlock                                 vk.Bool32
+	descriptorBindingInlineUniformBlockUpdateAfterBind vk.Bool32
+	pipelineCreationCacheControl                       vk.Bool32
+	privateData                                        vk.Bool32
+	shaderDemoteToHelperInvocation                     vk.Bool32
+	shaderTerminateInvocation                          vk.Bool32
+	subgroupSizeControl                                vk.Bool32
+	computeFullSubgroups                               vk.Bool32
+	synchronization2                                   vk.Bool32
+	textureCompressionASTCHDR                          vk.Bool32
+	shaderZeroInitializeWorkgroupMemory                vk.Bool32
+	dynamicRendering                                   vk.Bool32
+	shaderIntegerDotProduct                            vk.Bool32
+	maintenance4                                       vk.Bool32
+}
+
+// NewCoreFeatures enables Vulkan 1.3's dynamic rendering and nothing else
+// of 1.3, chained in front of next.
+func NewCoreFeatures(next unsafe.Pointer) *CoreFeatures {
+	return &CoreFeatures{
+		sType:            structureTypeVulkan13Features,
+		pNext:            next,
+		dynamicRendering: vk.True,
+	}
+}
+
+// Pointer is the struct to chain.
+func (f *CoreFeatures) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(f)
+}
+
+// CoreSupported reports whether physicalDevice has dynamic rendering in
+// core. It has to be a Vulkan 1.3 device on a Vulkan 1.3 instance.
+func CoreSupported(physicalDevice vk.PhysicalDevice) bool {
+	f := &CoreFeatures{sType: structureTypeVulkan13Features}
+	features := vk.PhysicalDeviceFeatures2{
+		SType: vk.StructureTypePhysicalDeviceFeatures2,
+		PNext: f.Pointer(),
+	}
+	vk.GetPhysicalDeviceFeatures2(physicalDevice, &features)
+	runtime.KeepAlive(f)
+	return f.dynamicRendering.B()
+}
+
+// PipelineInfo is laid out like VkPipelineRenderingCreateInfo, to put on
+// vk.GraphicsPipelineCreateInfo's PNext in place of a render pass. It has
+// to be kept alive until the pipeline is created.
+type PipelineInfo struct {
+	sType                   vk.StructureType
+	pNext                   unsafe.Pointer
+	viewMask                uint32
+	colorAttachmentCount    uint32
+	pColorAttachmentFormats *vk.Format
+	depthAttachmentFormat   vk.Format
+	stencilAttachmentFormat vk.Format
+
+	formats []vk.Format
+}
+
+// NewPipelineInfo describes pipelines that draw to colors and depth, which
+// can be vk.FormatUndefined.
+func NewPipelineInfo(colors []vk.Format, depth vk.Format) *PipelineInfo {
+	p := &PipelineInfo{
+		sType:                 structureTypePipelineRenderingCreateInfo,
+		colorAttachmentCount:  uint32(len(colors)),
+		depthAttachmentFormat: depth,
+		formats:               append([]vk.Format(nil), colors...),
+	}
+	if len(p.formats) > 0 {
+		p.pColorAttachmentFormats = &p.formats[0]
+	}
+	return p
+}
+
+// Pointer is the struct to chain, nil for a nil p so pipelines can chain
+// it whether or not they're drawn with dynamic rendering.
+func (p *PipelineInfo) Pointer() unsafe.Pointer {
+	if p == nil {
+		return nil
+	}
+	return unsafe.Pointer(p)
+}
+
+// InheritanceInfo is laid out like VkCommandBufferInheritanceRenderingInfo,
+// to put on vk.CommandBufferInheritanceInfo's PNext for secondary command
+// buffers executed inside CmdBeginRendering. It has to be kept alive until
+// they're begun.
+type InheritanceInfo struct {
+	sType                   vk.StructureType
+	pNext                   unsafe.Pointer
+	flags                   uint32
+	viewMask                uint32
+	colorAttachmentCount    uint32
+	pColorAttachmentFormats *vk.Format
+	depthAttachmentFormat   vk.Format
+	stencilAttachmentFormat vk.Format
+	rasterizationSamples    vk.SampleCountFlagBits
+
+	formats []vk.Format
+}
+
+// NewInheritanceInfo describes rendering begun with secondaries to colors
+// and depth, sampled samples times.
+func NewInheritanceInfo(colors []vk.Format, depth vk.Format, samples vk.SampleCountFlagBits) *InheritanceInfo {
+	i := &InheritanceInfo{
+		sType:                 structureTypeCommandBufferInheritanceRenderingInfo,
+		flags:                 renderingContentsSecondaryCommandBuffers,
+		colorAttachmentCount:  uint32(len(colors)),
+		depthAttachmentFormat: depth,
+		rasterizationSamples:  samples,
+		formats:               append([]vk.Format(nil), colors...),
+	}
+	if len(i.formats) > 0 {
+		i.pColorAttachmentFormats = &i.formats[0]
+	}
+	return i
+}
+
+// Pointer is the struct to chain, nil for a nil i.
+func (i *InheritanceInfo) Pointer() unsafe.Pointer {
+	if i == nil {
+		return nil
+	}
+	return unsafe.Pointer(i)
+}
@@ -0,0 +1,63 @@
+#include <stddef.h>
+
+#include "rendering.h"
+
+typedef void (*PFN_vkVoidFunction)(void);
+typedef PFN_vkVoidFunction (*PFN_vkGetInstanceProcAddr)(VkInstance instance, const char* pName);
+typedef PFN_vkVoidFunction (*PFN_vkGetDeviceProcAddr)(VkDevice device, const char* pName);
+typedef VkResult (*PFN_vkEnumerateInstanceVersion)(uint32_t* pApiVersion);
+typedef void (*PFN_vkCmdBeginRenderingKHR)(VkCommandBuffer commandBuffer, const VkRenderingInfo* pRenderingInfo);
+typedef void (*PFN_vkCmdEndRenderingKHR)(VkCommandBuffer commandBuffer);
+
+uint32_t loaderVersion(void* getInstanceProcAddr) {
+	// VK_MAKE_API_VERSION(0, 1, 0, 0), which loaders without
+	// vkEnumerateInstanceVersion are
+	uint32_t version = 1 << 22;
+	PFN_vkEnumerateInstanceVersion enumerateInstanceVersion = (PFN_vkEnumerateInstanceVersion)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(NULL, "vkEnumerateInstanceVersion");
+	if (enumerateInstanceVersion != NULL && enumerateInstanceVersion(&version) != 0) {
+		return 1 << 22;
+	}
+	return version;
+}
+
+VkResult loadRenderingFunctions(void* getInstanceProcAddr, VkInstance instance, VkDevice device, int core, LVFunctions* fn) {
+	PFN_vkGetDeviceProcAddr getDeviceProcAddr = (PFN_vkGetDeviceProcAddr)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(instance, "vkGetDeviceProcAddr");
+	if (getDeviceProcAddr == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+
+	if (core) {
+		fn->cmdBeginRendering = (void*)getDeviceProcAddr(device, "vkCmdBeginRendering");
+		fn->cmdEndRendering = (void*)getDeviceProcAddr(device, "vkCmdEndRendering");
+	} else {
+		fn->cmdBeginRendering = (void*)getDeviceProcAddr(device, "vkCmdBeginRenderingKHR");
+		fn->cmdEndRendering = (void*)getDeviceProcAddr(device, "vkCmdEndRenderingKHR");
+	}
+	if (fn->cmdBeginRendering == NULL || fn->cmdEndRendering == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+	return 0;
+}
+
+void cmdBeginRendering(const LVFunctions* fn, VkCommandBuffer cb, uint32_t flags, uint32_t width, uint32_t height, uint32_t colorCount, VkRenderingAttachmentInfo* colors, VkRenderingAttachmentInfo* depth) {
+	for (uint32_t i = 0; i < colorCount; i++) {
+		colors[i].sType = LV_STRUCTURE_TYPE_RENDERING_ATTACHMENT_INFO;
+	}
+	if (depth != NULL) {
+		depth->sType = LV_STRUCTURE_TYPE_RENDERING_ATTACHMENT_INFO;
+	}
+	VkRenderingInfo info = {
+		.sType = LV_STRUCTURE_TYPE_RENDERING_INFO,
+		.flags = flags,
+		.renderArea = {.width = width, .height = height},
+		.layerCount = 1,
+		.colorAttachmentCount = colorCount,
+		.pColorAttachments = colors,
+		.pDepthAttachment = depth,
+	};
+	((PFN_vkCmdBeginRenderingKHR)fn->cmdBeginRendering)(cb, &info);
+}
+
+void cmdEndRendering(const LVFunctions* fn, VkCommandBuffer cb) {
+	((PFN_vkCmdEndRenderingKHR)fn->cmdEndRendering)(cb);
+}
@@ -0,0 +1,131 @@
+// Package rendering implements the parts of dynamic rendering the renderer
+// uses, which vulkan-go doesn't bind. Render passes begun with it name their
+// attachments' image views directly, so there are no render pass or
+// framebuffer objects to create or recreate with the swapchain. Like
+// raytracing, entry points are loaded through vkGetDeviceProcAddr so the
+// only C dependency is rendering.h.
+//
+// Vulkan 1.3 devices have it in core, enabled with CoreFeatures, older ones
+// through VK_KHR_dynamic_rendering and Features. Both draw the same, the
+// extension's structures are core's.
+package rendering
+
+/*
+#include "rendering.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// ResolveModeAverage is VK_RESOLVE_MODE_AVERAGE_BIT, which multisampled
+// colour attachments resolve with. The bindings predate it.
+const ResolveModeAverage = 0x00000002
+
+// renderingContentsSecondaryCommandBuffers is
+// VK_RENDERING_CONTENTS_SECONDARY_COMMAND_BUFFERS_BIT.
+const renderingContentsSecondaryCommandBuffers = 0x00000001
+
+// Device is a logical device's dynamic rendering entry points.
+type Device struct {
+	fn C.LVFunctions
+}
+
+// APIVersion13 is VK_API_VERSION_1_3, which the bindings predate.
+var APIVersion13 = vk.MakeVersion(1, 3, 0)
+
+// LoaderVersion is the highest instance version the loader behind
+// getInstanceProcAddr supports, 1.0 for a nil one.
+func LoaderVersion(getInstanceProcAddr unsafe.Pointer) uint32 {
+	if getInstanceProcAddr == nil {
+		return vk.MakeVersion(1, 0, 0)
+	}
+	return uint32(C.loaderVersion(getInstanceProcAddr))
+}
+
+// Load loads device's entry points. When core it has to have been created
+// for Vulkan 1.3 with the CoreFeatures enabled, vkCmdBeginRendering is
+// loaded. Otherwise it has to have been created with Extensions and the
+// Features enabled, vkCmdBeginRenderingKHR is loaded.
+func Load(getInstanceProcAddr unsafe.Pointer, instance vk.Instance, device vk.Device, core bool) (*Device, error) {
+	if getInstanceProcAddr == nil {
+		return nil, errors.New("vkGetInstanceProcAddr is nil")
+	}
+	d := &Device{}
+	var coreFlag C.int
+	if core {
+		coreFlag = 1
+	}
+	result := C.loadRenderingFunctions(getInstanceProcAddr, C.VkInstance(unsafe.Pointer(instance)), C.VkDevice(unsafe.Pointer(device)), coreFlag, &d.fn)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return nil, errors.Wrap(err, "can't load dynamic rendering functions")
+	}
+	return d, nil
+}
+
+// Attachment is an image drawn to between CmdBeginRendering and
+// CmdEndRendering, in Layout. Images aren't transitioned by either, that's
+// up to the caller.
+type Attachment struct {
+	View    vk.ImageView
+	Layout  vk.ImageLayout
+	LoadOp  vk.AttachmentLoadOp
+	StoreOp vk.AttachmentStoreOp
+	Clear   vk.ClearValue
+	// ResolveView, when set, is resolved to in ResolveLayout with
+	// ResolveModeAverage at the end of rendering.
+	ResolveView   vk.ImageView
+	ResolveLayout vk.ImageLayout
+}
+
+func (a *Attachment) info() C.VkRenderingAttachmentInfo {
+	info := C.VkRenderingAttachmentInfo{
+		imageView:   C.VkImageView(unsafe.Pointer(a.View)),
+		imageLayout: C.int32_t(a.Layout),
+		loadOp:      C.int32_t(a.LoadOp),
+		storeOp:     C.int32_t(a.StoreOp),
+	}
+	*(*vk.ClearValue)(unsafe.Pointer(&info.clearValue)) = a.Clear
+	if a.ResolveView != vk.NullImageView {
+		info.resolveMode = ResolveModeAverage
+		info.resolveImageView = C.VkImageView(unsafe.Pointer(a.ResolveView))
+		info.resolveImageLayout = C.int32_t(a.ResolveLayout)
+	}
+	return info
+}
+
+// CmdBeginRendering begins rendering to colors and depth, which can be nil,
+// over extent. When secondaries the draws have to be recorded to secondary
+// command buffers inheriting an InheritanceInfo and executed, as with
+// vk.SubpassContentsSecondaryCommandBuffers.
+func (d *Device) CmdBeginRendering(cb vk.CommandBuffer, extent vk.Extent2D, colors []Attachment, depth *Attachment, secondaries bool) {
+	infos := make([]C.VkRenderingAttachmentInfo, len(colors))
+	for i := range colors {
+		infos[i] = colors[i].info()
+	}
+	var colorInfos, depthInfo *C.VkRenderingAttachmentInfo
+	if len(infos) > 0 {
+		colorInfos = &infos[0]
+	}
+	if depth != nil {
+		info := depth.info()
+		depthInfo = &info
+	}
+	var flags C.uint32_t
+	if secondaries {
+		flags = renderingContentsSecondaryCommandBuffers
+	}
+	C.cmdBeginRendering(&d.fn, C.VkCommandBuffer(unsafe.Pointer(cb)), flags,
+		C.uint32_t(extent.Width), C.uint32_t(extent.Height),
+		C.uint32_t(len(infos)), colorInfos, depthInfo)
+}
+
+// CmdEndRendering ends what CmdBeginRendering began, resolving any
+// attachments with a ResolveView.
+func (d *Device) CmdEndRendering(cb vk.CommandBuffer) {
+	C.cmdEndRendering(&d.fn, C.VkCommandBuffer(unsafe.Pointer(cb)))
+}
@@ -0,0 +1,72 @@
+// The subset of Vulkan 1.3's dynamic rendering and VK_KHR_dynamic_rendering
+// the package needs, declared here so it builds without the Vulkan headers.
+// Layouts follow vulkan_core.h, the extension's are the same.
+#ifndef LEARNVULKAN_RENDERING_H
+#define LEARNVULKAN_RENDERING_H
+
+#include <stdint.h>
+
+typedef struct VkInstance_T* VkInstance;
+typedef struct VkDevice_T* VkDevice;
+typedef struct VkCommandBuffer_T* VkCommandBuffer;
+typedef struct VkImageView_T* VkImageView;
+typedef int32_t VkResult;
+
+#define LV_STRUCTURE_TYPE_RENDERING_INFO 1000044000
+#define LV_STRUCTURE_TYPE_RENDERING_ATTACHMENT_INFO 1000044001
+#define LV_ERROR_EXTENSION_NOT_PRESENT -7
+
+typedef union VkClearValue {
+	float color[4];
+	struct {
+		float depth;
+		uint32_t stencil;
+	} depthStencil;
+} VkClearValue;
+
+typedef struct VkRect2D {
+	int32_t x;
+	int32_t y;
+	uint32_t width;
+	uint32_t height;
+} VkRect2D;
+
+typedef struct VkRenderingAttachmentInfo {
+	int32_t sType;
+	const void* pNext;
+	VkImageView imageView;
+	int32_t imageLayout;
+	uint32_t resolveMode;
+	VkImageView resolveImageView;
+	int32_t resolveImageLayout;
+	int32_t loadOp;
+	int32_t storeOp;
+	VkClearValue clearValue;
+} VkRenderingAttachmentInfo;
+
+typedef struct VkRenderingInfo {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	VkRect2D renderArea;
+	uint32_t layerCount;
+	uint32_t viewMask;
+	uint32_t colorAttachmentCount;
+	const VkRenderingAttachmentInfo* pColorAttachments;
+	const VkRenderingAttachmentInfo* pDepthAttachment;
+	const VkRenderingAttachmentInfo* pStencilAttachment;
+} VkRenderingInfo;
+
+// LVFunctions are the device's core or extension entry points.
+typedef struct LVFunctions {
+	void* cmdBeginRendering;
+	void* cmdEndRendering;
+} LVFunctions;
+
+uint32_t loaderVersion(void* getInstanceProcAddr);
+VkResult loadRenderingFunctions(void* getInstanceProcAddr, VkInstance instance, VkDevice device, int core, LVFunctions* fn);
+
+void cmdBeginRendering(const LVFunctions* fn, VkCommandBuffer cb, uint32_t flags, uint32_t width, uint32_t height, uint32_t colorCount, VkRenderingAttachmentInfo* colors, VkRenderingAttachmentInfo* depth);
+void cmdEndRendering(const LVFunctions* fn, VkCommandBuffer cb);
+
+#endif
@@ -0,0 +1,90 @@
+package renderpass
+
+import (
+	"runtime"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// multiviewCreateInfo is laid out like VkRenderPassMultiviewCreateInfo,
+// which the bindings only have with slices that don't survive being put on
+// a PNext.
+type multiviewCreateInfo struct {
+	sType                vk.StructureType
+	pNext                unsafe.Pointer
+	subpassCount         uint32
+	pViewMasks           *uint32
+	dependencyCount      uint32
+	pViewOffsets         *int32
+	correlationMaskCount uint32
+	pCorrelationMasks    *uint32
+}
+
+// Multiview makes every subpass draw once per bit set in viewMask, each
+// time into that layer of its attachments with gl_ViewIndex set to it. The
+// views are also correlated, hinting that they're rendered from nearby
+// viewpoints like a pair of eyes.
+func (b *Builder) Multiview(viewMask uint32) {
+	b.viewMask = viewMask
+}
+
+// multiview returns the struct for Build to chain when Multiview was set,
+// nil otherwise. masks has to be kept alive until the render pass is
+// created.
+func (b *Builder) multiview() (info *multiviewCreateInfo, masks []uint32) {
+	if b.viewMask == 0 {
+		return nil, nil
+	}
+	masks = make([]uint32, len(b.subpasses)+1)
+	for i := range b.subpasses {
+		masks[i] = b.viewMask
+	}
+	// The last one is the correlation mask
+	masks[len(b.subpasses)] = b.viewMask
+	return &multiviewCreateInfo{
+		sType:                vk.StructureTypeRenderPassMultiviewCreateInfo,
+		subpassCount:         uint32(len(b.subpasses)),
+		pViewMasks:           &masks[0],
+		correlationMaskCount: 1,
+		pCorrelationMasks:    &masks[len(b.subpasses)],
+	}, masks
+}
+
+// MultiviewFeatures is laid out like VkPhysicalDeviceMultiviewFeatures, to
+// put on vk.DeviceCreateInfo's PNext. It has to be kept alive until the
+// device is created.
+type MultiviewFeatures struct {
+	sType                       vk.StructureType
+	pNext                       unsafe.Pointer
+	multiview                   vk.Bool32
+	multiviewGeometryShader     vk.Bool32
+	multiviewTessellationShader vk.Bool32
+}
+
+// NewMultiviewFeatures enables multiview, chained in front of next.
+func NewMultiviewFeatures(next unsafe.Pointer) *MultiviewFeatures {
+	return &MultiviewFeatures{
+		sType:     vk.StructureTypePhysicalDeviceMultiviewFeatures,
+		pNext:     next,
+		multiview: vk.True,
+	}
+}
+
+// Pointer is the struct to chain.
+func (f *MultiviewFeatures) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(f)
+}
+
+// MultiviewSupported reports whether physicalDevice can render multiview
+// render passes. It's core in Vulkan 1.1 but still optional.
+func MultiviewSupported(physicalDevice vk.PhysicalDevice) bool {
+	f := &MultiviewFeatures{sType: vk.StructureTypePhysicalDeviceMultiviewFeatures}
+	features := vk.PhysicalDeviceFeatures2{
+		SType: vk.StructureTypePhysicalDeviceFeatures2,
+		PNext: f.Pointer(),
+	}
+	vk.GetPhysicalDeviceFeatures2(physicalDevice, &features)
+	runtime.KeepAlive(f)
+	return f.multiview.B()
+}
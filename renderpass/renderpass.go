@@ -0,0 +1,271 @@
+// Package renderpass builds vk.RenderPass objects from attachment, subpass and
+// dependency descriptions so each chapter doesn't repeat the boilerplate.
+package renderpass
+
+import (
+	"runtime"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Subpass lists the attachments a subpass uses by their index in the builder.
+// Colors may be empty for a depth only subpass.
+type Subpass struct {
+	Colors []uint32
+	// Resolves, when set, has one entry per color attachment to resolve it into.
+	Resolves []uint32
+	Inputs   []uint32
+	// Depth is the depth/stencil attachment, nil when the subpass has none.
+	Depth *uint32
+}
+
+// Builder accumulates the pieces of a render pass.
+type Builder struct {
+	attachments  []vk.AttachmentDescription
+	subpasses    []Subpass
+	dependencies []vk.SubpassDependency
+	viewMask     uint32
+}
+
+// NewBuilder returns an empty render pass builder.
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Attachment adds an attachment description and returns its index.
+func (b *Builder) Attachment(desc vk.AttachmentDescription) uint32 {
+	b.attachments = append(b.attachments, desc)
+	return uint32(len(b.attachments) - 1)
+}
+
+// Subpass adds a graphics subpass and returns its index.
+func (b *Builder) Subpass(sp Subpass) uint32 {
+	b.subpasses = append(b.subpasses, sp)
+	return uint32(len(b.subpasses) - 1)
+}
+
+// Dependency adds a dependency between two subpasses.
+func (b *Builder) Dependency(dep vk.SubpassDependency) {
+	b.dependencies = append(b.dependencies, dep)
+}
+
+// Build creates the render pass on the device.
+func (b *Builder) Build(device vk.Device) (vk.RenderPass, error) {
+	if len(b.subpasses) == 0 {
+		return vk.NullRenderPass, errors.New("render pass needs at least one subpass")
+	}
+
+	subpasses := make([]vk.SubpassDescription, len(b.subpasses))
+	for i, sp := range b.subpasses {
+		if len(sp.Resolves) > 0 && len(sp.Resolves) != len(sp.Colors) {
+			return vk.NullRenderPass, errors.Errorf("subpass %d has %d resolves for %d colors", i, len(sp.Resolves), len(sp.Colors))
+		}
+		if len(sp.Colors) == 0 && sp.Depth == nil {
+			return vk.NullRenderPass, errors.Errorf("subpass %d has no color or depth attachments", i)
+		}
+		if err := b.checkIndices(sp); err != nil {
+			return vk.NullRenderPass, errors.Wrapf(err, "invalid subpass %d", i)
+		}
+
+		desc := vk.SubpassDescription{
+			PipelineBindPoint:    vk.PipelineBindPointGraphics,
+			ColorAttachmentCount: uint32(len(sp.Colors)),
+			PColorAttachments:    references(sp.Colors, vk.ImageLayoutColorAttachmentOptimal),
+			InputAttachmentCount: uint32(len(sp.Inputs)),
+			PInputAttachments:    references(sp.Inputs, vk.ImageLayoutShaderReadOnlyOptimal),
+		}
+		if len(sp.Resolves) > 0 {
+			desc.PResolveAttachments = references(sp.Resolves, vk.ImageLayoutColorAttachmentOptimal)
+		}
+		if sp.Depth != nil {
+			desc.PDepthStencilAttachment = &vk.AttachmentReference{
+				Attachment: *sp.Depth,
+				Layout:     vk.ImageLayoutDepthStencilAttachmentOptimal,
+			}
+		}
+		subpasses[i] = desc
+	}
+
+	createInfo := &vk.RenderPassCreateInfo{
+		SType:           vk.StructureTypeRenderPassCreateInfo,
+		AttachmentCount: uint32(len(b.attachments)),
+		PAttachments:    b.attachments,
+		SubpassCount:    uint32(len(subpasses)),
+		PSubpasses:      subpasses,
+		DependencyCount: uint32(len(b.dependencies)),
+		PDependencies:   b.dependencies,
+	}
+	multiview, masks := b.multiview()
+	if multiview != nil {
+		createInfo.PNext = unsafe.Pointer(multiview)
+	}
+
+	var renderPass vk.RenderPass
+	err := vk.Error(vk.CreateRenderPass(device, createInfo, nil, &renderPass))
+	runtime.KeepAlive(multiview)
+	runtime.KeepAlive(masks)
+	if err != nil {
+		return vk.NullRenderPass, errors.Wrap(err, "can't create render pass")
+	}
+	return renderPass, nil
+}
+
+func (b *Builder) checkIndices(sp Subpass) error {
+	count := uint32(len(b.attachments))
+	for _, list := range [][]uint32{sp.Colors, sp.Resolves, sp.Inputs} {
+		for _, i := range list {
+			if i >= count {
+				return errors.Errorf("attachment %d out of range, only %d attachments", i, count)
+			}
+		}
+	}
+	if sp.Depth != nil && *sp.Depth >= count {
+		return errors.Errorf("depth attachment %d out of range, only %d attachments", *sp.Depth, count)
+	}
+	return nil
+}
+
+func references(indices []uint32, layout vk.ImageLayout) []vk.AttachmentReference {
+	if len(indices) == 0 {
+		return nil
+	}
+	refs := make([]vk.AttachmentReference, len(indices))
+	for i, index := range indices {
+		refs[i] = vk.AttachmentReference{
+			Attachment: index,
+			Layout:     layout,
+		}
+	}
+	return refs
+}
+
+// ColorAttachment describes a cleared and stored color attachment ending in finalLayout.
+func ColorAttachment(format vk.Format, samples vk.SampleCountFlagBits, finalLayout vk.ImageLayout) vk.AttachmentDescription {
+	return vk.AttachmentDescription{
+		Format:         format,
+		Samples:        samples,
+		LoadOp:         vk.AttachmentLoadOpClear,
+		StoreOp:        vk.AttachmentStoreOpStore,
+		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+		StencilStoreOp: vk.AttachmentStoreOpDontCare,
+		InitialLayout:  vk.ImageLayoutUndefined,
+		FinalLayout:    finalLayout,
+	}
+}
+
+// DepthAttachment describes a cleared depth attachment whose contents are discarded after the pass.
+func DepthAttachment(format vk.Format, samples vk.SampleCountFlagBits) vk.AttachmentDescription {
+	return vk.AttachmentDescription{
+		Format:         format,
+		Samples:        samples,
+		LoadOp:         vk.AttachmentLoadOpClear,
+		StoreOp:        vk.AttachmentStoreOpDontCare,
+		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+		StencilStoreOp: vk.AttachmentStoreOpDontCare,
+		InitialLayout:  vk.ImageLayoutUndefined,
+		FinalLayout:    vk.ImageLayoutDepthStencilAttachmentOptimal,
+	}
+}
+
+// DepthOnlyAttachment describes a cleared depth attachment that's stored
+// and left in finalLayout for later passes to sample, like a shadow map.
+func DepthOnlyAttachment(format vk.Format, finalLayout vk.ImageLayout) vk.AttachmentDescription {
+	return vk.AttachmentDescription{
+		Format:         format,
+		Samples:        vk.SampleCount1Bit,
+		LoadOp:         vk.AttachmentLoadOpClear,
+		StoreOp:        vk.AttachmentStoreOpStore,
+		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+		StencilStoreOp: vk.AttachmentStoreOpDontCare,
+		InitialLayout:  vk.ImageLayoutUndefined,
+		FinalLayout:    finalLayout,
+	}
+}
+
+// Ref returns a pointer to an attachment index, handy for Subpass.Depth.
+func Ref(index uint32) *uint32 {
+	return &index
+}
+
+// ExternalColorDependency makes the first subpass wait for the swapchain image
+// to be released by the presentation engine before writing color output.
+func ExternalColorDependency() vk.SubpassDependency {
+	return vk.SubpassDependency{
+		SrcSubpass:    vk.SubpassExternal,
+		DstSubpass:    0,
+		SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		SrcAccessMask: 0,
+		DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		DstAccessMask: vk.AccessFlags(vk.AccessColorAttachmentReadBit | vk.AccessColorAttachmentWriteBit),
+	}
+}
+
+// ExternalColorDepthDependency is ExternalColorDependency for subpasses with
+// a depth attachment too, which also has to wait for the previous use of the
+// depth buffer to finish before clearing it.
+func ExternalColorDepthDependency() vk.SubpassDependency {
+	return vk.SubpassDependency{
+		SrcSubpass:    vk.SubpassExternal,
+		DstSubpass:    0,
+		SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit | vk.PipelineStageLateFragmentTestsBit),
+		SrcAccessMask: vk.AccessFlags(vk.AccessDepthStencilAttachmentWriteBit),
+		DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit | vk.PipelineStageEarlyFragmentTestsBit),
+		DstAccessMask: vk.AccessFlags(vk.AccessColorAttachmentReadBit | vk.AccessColorAttachmentWriteBit | vk.AccessDepthStencilAttachmentWriteBit),
+	}
+}
+
+// InputAttachmentDependency makes subpass dst wait, pixel by pixel, for
+// subpass src's color and depth writes before reading them as input
+// attachments or depth testing against them.
+func InputAttachmentDependency(src, dst uint32) vk.SubpassDependency {
+	return vk.SubpassDependency{
+		SrcSubpass:      src,
+		DstSubpass:      dst,
+		SrcStageMask:    vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit | vk.PipelineStageLateFragmentTestsBit),
+		SrcAccessMask:   vk.AccessFlags(vk.AccessColorAttachmentWriteBit | vk.AccessDepthStencilAttachmentWriteBit),
+		DstStageMask:    vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit | vk.PipelineStageEarlyFragmentTestsBit),
+		DstAccessMask:   vk.AccessFlags(vk.AccessInputAttachmentReadBit | vk.AccessDepthStencilAttachmentReadBit),
+		DependencyFlags: vk.DependencyFlags(vk.DependencyByRegionBit),
+	}
+}
+
+// DepthOnlyDependencies order a depth only subpass between fragment shaders
+// sampling its attachment, the previous frame's before it is cleared and the
+// next pass's after it's written.
+func DepthOnlyDependencies() []vk.SubpassDependency {
+	return []vk.SubpassDependency{
+		{
+			SrcSubpass:    vk.SubpassExternal,
+			DstSubpass:    0,
+			SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit),
+			SrcAccessMask: vk.AccessFlags(vk.AccessShaderReadBit),
+			DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageEarlyFragmentTestsBit),
+			DstAccessMask: vk.AccessFlags(vk.AccessDepthStencilAttachmentWriteBit),
+		},
+		{
+			SrcSubpass:    0,
+			DstSubpass:    vk.SubpassExternal,
+			SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageLateFragmentTestsBit),
+			SrcAccessMask: vk.AccessFlags(vk.AccessDepthStencilAttachmentWriteBit),
+			DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit),
+			DstAccessMask: vk.AccessFlags(vk.AccessShaderReadBit),
+		},
+	}
+}
+
+// ResolveAttachment describes a single sampled attachment that a multisampled
+// color attachment is resolved into, its previous contents are never loaded.
+func ResolveAttachment(format vk.Format, finalLayout vk.ImageLayout) vk.AttachmentDescription {
+	return vk.AttachmentDescription{
+		Format:         format,
+		Samples:        vk.SampleCount1Bit,
+		LoadOp:         vk.AttachmentLoadOpDontCare,
+		StoreOp:        vk.AttachmentStoreOpStore,
+		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+		StencilStoreOp: vk.AttachmentStoreOpDontCare,
+		InitialLayout:  vk.ImageLayoutUndefined,
+		FinalLayout:    finalLayout,
+	}
+}
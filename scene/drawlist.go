@@ -0,0 +1,62 @@
+package scene
+
+import "github.com/delaneyj/learnvulkan/vmath"
+
+// Draw is a visible mesh and where it is.
+type Draw struct {
+	Node  *Node
+	Mesh  Mesh
+	World vmath.Mat4
+}
+
+// PlacedLight is a visible light and where it is.
+type PlacedLight struct {
+	Node  *Node
+	Light Light
+	World vmath.Mat4
+}
+
+// PlacedCamera is a visible camera and where it is.
+type PlacedCamera struct {
+	Node   *Node
+	Camera Camera
+	World  vmath.Mat4
+}
+
+// DrawList is what a hierarchy holds that isn't hidden, flattened in depth
+// first order with parents before children. It's meant to be kept and
+// collected into every frame, so its slices are reused.
+type DrawList struct {
+	Draws   []Draw
+	Lights  []PlacedLight
+	Cameras []PlacedCamera
+}
+
+// Collect updates the world transforms under root, hidden nodes included,
+// and replaces the list's contents with root's visible meshes, lights and
+// cameras.
+func (l *DrawList) Collect(root *Node) {
+	l.Draws = l.Draws[:0]
+	l.Lights = l.Lights[:0]
+	l.Cameras = l.Cameras[:0]
+	root.Update()
+	l.collect(root)
+}
+
+func (l *DrawList) collect(n *Node) {
+	if n.Hidden {
+		return
+	}
+	if n.Mesh != nil {
+		l.Draws = append(l.Draws, Draw{Node: n, Mesh: *n.Mesh, World: n.world})
+	}
+	if n.Light != nil {
+		l.Lights = append(l.Lights, PlacedLight{Node: n, Light: *n.Light, World: n.world})
+	}
+	if n.Camera != nil {
+		l.Cameras = append(l.Cameras, PlacedCamera{Node: n, Camera: *n.Camera, World: n.world})
+	}
+	for _, c := range n.children {
+		l.collect(c)
+	}
+}
@@ -0,0 +1,146 @@
+// Package scene is a hierarchy of nodes, each placed relative to its parent,
+// that's flattened every frame into the meshes, lights and cameras to draw
+// with. Meshes are referred to by index, so the package knows nothing about
+// how the renderer stores them.
+package scene
+
+import "github.com/delaneyj/learnvulkan/vmath"
+
+// Transform places a node relative to its parent, scaling first, then
+// rotating and then translating.
+type Transform struct {
+	Translation vmath.Vec3
+	// Rotation is a unit quaternion stored x, y, z, w.
+	Rotation vmath.Vec4
+	Scale    vmath.Vec3
+}
+
+// Identity is the transform that leaves a node where its parent is.
+func Identity() Transform {
+	return Transform{Rotation: vmath.Vec4{0, 0, 0, 1}, Scale: vmath.Vec3{1, 1, 1}}
+}
+
+// Matrix is the transform as a matrix.
+func (t Transform) Matrix() vmath.Mat4 {
+	return vmath.Translate(t.Translation).Mul(vmath.Quat(t.Rotation)).Mul(vmath.Scale(t.Scale))
+}
+
+// Mesh is a mesh drawn at its node.
+type Mesh struct {
+	// Index is which of the renderer's meshes it is.
+	Index int
+}
+
+// LightKind is how a Light shines.
+type LightKind uint32
+
+const (
+	// PointLight shines every way from its node.
+	PointLight LightKind = iota
+	// SpotLight shines in a cone down its node's -Z.
+	SpotLight
+	// DirectionalLight shines down its node's -Z from infinitely far
+	// away, so only its node's rotation matters.
+	DirectionalLight
+)
+
+// Light is a light at its node, shining down the node's -Z.
+type Light struct {
+	Kind      LightKind
+	Color     vmath.Vec3
+	Intensity float32
+	// Range is how far the light reaches, zero is unlimited. Directional
+	// lights reach everywhere.
+	Range float32
+	// InnerCone and OuterCone are a spot light's half angles in radians,
+	// it's full strength inside the inner one and fades out to the outer.
+	InnerCone, OuterCone float32
+}
+
+// Camera is a perspective camera at its node, looking down the node's -Z.
+type Camera struct {
+	// FovY is the vertical field of view in radians.
+	FovY      float32
+	Near, Far float32
+}
+
+// Node is a point in the hierarchy with what's there, Mesh, Light and
+// Camera each being optional. The zero Node isn't usable, New makes one.
+type Node struct {
+	Name  string
+	Local Transform
+	// Hidden leaves the node and everything under it out of draw lists.
+	Hidden bool
+	Mesh   *Mesh
+	Light  *Light
+	Camera *Camera
+
+	parent   *Node
+	children []*Node
+	world    vmath.Mat4
+}
+
+// New returns a node with the identity transform and no parent.
+func New(name string) *Node {
+	return &Node{Name: name, Local: Identity(), world: vmath.Ident4()}
+}
+
+// Add makes child the last of n's children, taking it from its previous
+// parent. It panics if child is n or one of n's ancestors, which would make
+// a cycle.
+func (n *Node) Add(child *Node) {
+	for a := n; a != nil; a = a.parent {
+		if a == child {
+			panic("scene: can't add " + child.Name + " under itself")
+		}
+	}
+	if child.parent != nil {
+		child.parent.Remove(child)
+	}
+	child.parent = n
+	n.children = append(n.children, child)
+}
+
+// Remove takes child out of n's children, it's a no-op if it isn't one.
+func (n *Node) Remove(child *Node) {
+	for i, c := range n.children {
+		if c == child {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			child.parent = nil
+			return
+		}
+	}
+}
+
+// Parent is the node n is under, nil for a root.
+func (n *Node) Parent() *Node {
+	return n.parent
+}
+
+// Children are the nodes directly under n, which mustn't be modified.
+func (n *Node) Children() []*Node {
+	return n.children
+}
+
+// World is n's transform from its local space to the root's, as of the
+// last Update or Collect covering it.
+func (n *Node) World() vmath.Mat4 {
+	return n.world
+}
+
+// Update recomputes the world transforms of n and everything under it,
+// starting from n's parent's.
+func (n *Node) Update() {
+	parent := vmath.Ident4()
+	if n.parent != nil {
+		parent = n.parent.world
+	}
+	n.update(parent)
+}
+
+func (n *Node) update(parent vmath.Mat4) {
+	n.world = parent.Mul(n.Local.Matrix())
+	for _, c := range n.children {
+		c.update(n.world)
+	}
+}
@@ -0,0 +1,113 @@
+package scene
+
+import (
+	"math"
+	"testing"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+func near(a, b vmath.Mat4) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWorldTransforms(t *testing.T) {
+	root := New("root")
+	root.Local.Translation = vmath.Vec3{1, 0, 0}
+	arm := New("arm")
+	arm.Local.Rotation = vmath.AxisAngle(vmath.Radians(90), vmath.Vec3{0, 0, 1})
+	hand := New("hand")
+	hand.Local.Translation = vmath.Vec3{2, 0, 0}
+	hand.Local.Scale = vmath.Vec3{2, 2, 2}
+	root.Add(arm)
+	arm.Add(hand)
+	root.Update()
+
+	// The hand is 2 along the arm, which is turned to point up Y
+	want := vmath.Translate(vmath.Vec3{1, 2, 0}).
+		Mul(vmath.Rotate(vmath.Radians(90), vmath.Vec3{0, 0, 1})).
+		Mul(vmath.Scale(vmath.Vec3{2, 2, 2}))
+	if got := hand.World(); !near(got, want) {
+		t.Errorf("hand world = %v, want %v", got, want)
+	}
+
+	// Updating a subtree starts from its parent's last world transform
+	hand.Local.Translation = vmath.Vec3{3, 0, 0}
+	hand.Update()
+	want[12], want[13] = 1, 3
+	if got := hand.World(); !near(got, want) {
+		t.Errorf("hand world after moving = %v, want %v", got, want)
+	}
+}
+
+func TestAddReparents(t *testing.T) {
+	a, b, c := New("a"), New("b"), New("c")
+	a.Add(c)
+	b.Add(c)
+	if len(a.Children()) != 0 || len(b.Children()) != 1 || c.Parent() != b {
+		t.Errorf("c wasn't moved from a to b: a has %d children, b %d, c's parent is %v", len(a.Children()), len(b.Children()), c.Parent())
+	}
+	b.Remove(c)
+	if c.Parent() != nil || len(b.Children()) != 0 {
+		t.Errorf("c wasn't removed from b")
+	}
+}
+
+func TestAddCycle(t *testing.T) {
+	a, b := New("a"), New("b")
+	a.Add(b)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("adding a node under its child didn't panic")
+		}
+	}()
+	b.Add(a)
+}
+
+func TestCollect(t *testing.T) {
+	root := New("root")
+	sun := New("sun")
+	sun.Light = &Light{Color: vmath.Vec3{1, 1, 1}, Intensity: 3}
+	root.Add(sun)
+	for _, name := range []string{"first", "second"} {
+		n := New(name)
+		n.Mesh = &Mesh{Index: len(root.Children())}
+		root.Add(n)
+	}
+	hidden := New("hidden")
+	hidden.Hidden = true
+	hidden.Camera = &Camera{FovY: 1, Near: 0.1, Far: 10}
+	under := New("under hidden")
+	under.Mesh = &Mesh{}
+	hidden.Add(under)
+	root.Add(hidden)
+	eye := New("eye")
+	eye.Camera = &Camera{FovY: 1, Near: 0.1, Far: 10}
+	root.Children()[1].Add(eye)
+
+	var l DrawList
+	l.Collect(root)
+	if len(l.Draws) != 2 || l.Draws[0].Node.Name != "first" || l.Draws[1].Node.Name != "second" || l.Draws[1].Mesh.Index != 2 {
+		t.Errorf("Draws = %v, want first and second", l.Draws)
+	}
+	if len(l.Lights) != 1 || l.Lights[0].Light.Intensity != 3 {
+		t.Errorf("Lights = %v, want the sun", l.Lights)
+	}
+	if len(l.Cameras) != 1 || l.Cameras[0].Node != eye {
+		t.Errorf("Cameras = %v, want just the eye", l.Cameras)
+	}
+	// Hidden nodes still have their transforms updated
+	under.Local.Translation = vmath.Vec3{0, 0, 5}
+	l.Collect(root)
+	if got := under.World(); got[14] != 5 {
+		t.Errorf("hidden node's world translation = %v, want z 5", got[12:15])
+	}
+	if len(l.Draws) != 2 {
+		t.Errorf("collecting again has %d draws, want 2", len(l.Draws))
+	}
+}
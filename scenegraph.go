@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/ecs"
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// buildScene spawns objectCount copies of the mesh on a grid, each spinning
+// in place, and the systems that run their scripts and keep the scene
+// graph in step with them.
+func (app *HelloTriangleApplication) buildScene() {
+	app.sceneRoot = scene.New("scene")
+	app.world = ecs.New()
+	count := app.objectCount()
+	for i := 0; i < count; i++ {
+		app.world.Spawn(ecs.At(objectPosition(i, count)), ecs.MeshRenderer{}, spinScript())
+	}
+	app.world.AddSystem(ecs.Scripts())
+	app.world.AddSystem(ecs.NewSceneSync(app.sceneRoot))
+	app.world.Tick(0)
+}
+
+// spinScript turns its entity around Z a quarter turn a second.
+func spinScript() ecs.Script {
+	var angle float32
+	return ecs.Script{Update: func(w *ecs.World, e ecs.Entity, dt float32) {
+		angle += dt * vmath.Radians(90)
+		w.Transform(e).Rotation = vmath.AxisAngle(angle, vmath.Vec3{0, 0, 1})
+	}}
+}
+
+// collectScene flattens the scene into the current window's draw list,
+// keeping as many draws as its uniform buffers have room for.
+func (app *HelloTriangleApplication) collectScene(capacity int) {
+	app.drawList.Collect(app.sceneRoot)
+	if len(app.drawList.Draws) > capacity {
+		app.drawList.Draws = app.drawList.Draws[:capacity]
+	}
+}
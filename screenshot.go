@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+const defaultScreenshotKey = glfw.KeyF12
+
+func (app *HelloTriangleApplication) screenshotKey() glfw.Key {
+	if app.ScreenshotKey == 0 {
+		return defaultScreenshotKey
+	}
+	return app.ScreenshotKey
+}
+
+// captureScreenshot saves swapchain image imageIndex as a timestamped PNG in
+// ScreenshotDir. The frame drawing into it has to have been submitted but
+// not presented yet.
+func (app *HelloTriangleApplication) captureScreenshot(imageIndex uint32) error {
+	// Check the format before going to the trouble of reading anything
+	if err := normalizePixels(app.target.Format, nil); err != nil {
+		return err
+	}
+
+	pixels, err := app.readImage(app.target.Images[imageIndex], app.target.Extent, app.target.FinalLayout)
+	if err != nil {
+		return errors.Wrap(err, "can't read swapchain image")
+	}
+
+	if err := normalizePixels(app.target.Format, pixels.Pix); err != nil {
+		return err
+	}
+
+	name := "screenshot-" + time.Now().Format("20060102-150405.000") + ".png"
+	path := filepath.Join(app.ScreenshotDir, name)
+	if err := writePNG(path, pixels); err != nil {
+		return err
+	}
+	app.logger.Info("Saved screenshot", logging.F("path", path))
+	return nil
+}
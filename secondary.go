@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/logging"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// createWorkers creates the current window's recording workers when
+// RecordThreads asks for more than one.
+func (app *HelloTriangleApplication) createWorkers() error {
+	if app.RecordThreads <= 1 {
+		return nil
+	}
+	workers, err := commands.NewWorkers(app.device, uint32(app.queueFamilies.Graphics), app.RecordThreads, app.framesInFlight())
+	if err != nil {
+		return err
+	}
+	app.workers = workers
+	app.logger.Info("Recording on multiple threads", logging.F("title", app.config.Title), logging.F("threads", workers.Count()))
+	return nil
+}
+
+// recordSecondaries has every worker record its share of the mesh's
+// triangles for frame into a secondary command buffer, nil when recording
+// inline.
+func (app *HelloTriangleApplication) recordSecondaries(frame int, imageIndex uint32) ([]vk.CommandBuffer, error) {
+	if app.workers == nil {
+		return nil, nil
+	}
+	workers := app.workers.Count()
+	draw := func(worker int, cb vk.CommandBuffer) {
+		first, count := meshChunk(app.mesh.IndexCount, worker, workers)
+		app.recordDraws(cb, frame, first, count)
+		// Secondaries execute in order so the last one draws the sky and
+		// particles after the scene, deferred draws them in the lighting
+		// subpass instead
+		if worker == workers-1 && !app.Deferred {
+			app.recordSkybox(cb)
+			app.recordParticles(cb)
+		}
+	}
+	if app.dynamicRendering {
+		return app.workers.RecordInheriting(frame, vk.CommandBufferInheritanceInfo{
+			SType: vk.StructureTypeCommandBufferInheritanceInfo,
+			PNext: app.sceneInheritance.Pointer(),
+		}, draw)
+	}
+	return app.workers.Record(frame, app.renderPass, 0, app.framebuffers[imageIndex], draw)
+}
+
+// meshChunk is worker's share of indexCount indices split between workers,
+// whole triangles only.
+func meshChunk(indexCount uint32, worker, workers int) (first, count uint32) {
+	triangles := uint64(indexCount / 3)
+	start := triangles * uint64(worker) / uint64(workers)
+	end := triangles * uint64(worker+1) / uint64(workers)
+	return uint32(start * 3), uint32((end - start) * 3)
+}
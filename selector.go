@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// selectIndexOrName finds the entry of names selector refers to, either its
+// index or a case insensitive substring of its name that only one entry
+// matches. kind names what's being selected in errors.
+func selectIndexOrName(kind, selector string, names []string) (int, error) {
+	available := func() string {
+		if len(names) == 0 {
+			return "none"
+		}
+		listed := make([]string, len(names))
+		for i, name := range names {
+			listed[i] = strconv.Itoa(i) + ": " + name
+		}
+		return strings.Join(listed, ", ")
+	}
+
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 0 || index >= len(names) {
+			return -1, errors.Errorf("no %s with index %d, available are %s", kind, index, available())
+		}
+		return index, nil
+	}
+
+	matched := -1
+	needle := strings.ToLower(selector)
+	for i, name := range names {
+		if !strings.Contains(strings.ToLower(name), needle) {
+			continue
+		}
+		if matched >= 0 {
+			return -1, errors.Errorf("%s '%s' matches both '%s' and '%s', use an index instead", kind, selector, names[matched], name)
+		}
+		matched = i
+	}
+	if matched < 0 {
+		return -1, errors.Errorf("no %s matches '%s', available are %s", kind, selector, available())
+	}
+	return matched, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/config"
+	"github.com/pkg/errors"
+)
+
+// defaultSettingsPath is the settings file read from the working directory
+// when --config isn't given, it's fine for it not to exist.
+const defaultSettingsPath = "learnvulkan.toml"
+
+// Settings are what a learnvulkan.toml or .json file can set, each is the
+// value of the command line flag of the same name unless it's given too.
+type Settings struct {
+	// Width and Height are the window's size, zero is the default.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Title is the window's title.
+	Title string `json:"title"`
+	// Fullscreen is the WIDTHxHEIGHT[@REFRESH] video mode to start
+	// fullscreen in, empty starts windowed.
+	Fullscreen string `json:"fullscreen"`
+	// Monitor is the index or name substring of the monitor to go
+	// fullscreen on.
+	Monitor string `json:"monitor"`
+	// GPU is the index or name substring of the GPU to use.
+	GPU string `json:"gpu"`
+	// Validation is prefer, require or disable.
+	Validation string `json:"validation"`
+	// PresentMode is fifo, mailbox, immediate or fifo-relaxed.
+	PresentMode string `json:"present_mode"`
+	// MSAA is the multisample count, one of 1, 2, 4 or 8.
+	MSAA int `json:"msaa"`
+	// Scene is one of scenes.
+	Scene string `json:"scene"`
+}
+
+// defaultScene is the scene without --scene, which turns nothing on.
+const defaultScene = "quad"
+
+// scenes are the demo scenes --scene picks from, each is the flags it sets.
+var scenes = map[string]map[string]string{
+	"quad":        {},
+	"grid":        {"objects": "25"},
+	"instanced":   {"instances": "10000"},
+	"particles":   {"particles": "100000", "bloom": "true"},
+	"deferred":    {"deferred": "true", "objects": "25"},
+	"ray-tracing": {"ray-tracing": "true"},
+	"meshlets":    {"mesh-shaders": "true"},
+	"stereo":      {"stereo": "true"},
+}
+
+// sceneNames lists scenes for messages.
+func sceneNames() string {
+	names := make([]string, 0, len(scenes))
+	for name := range scenes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// loadSettings reads the settings file at path. A missing file is only an
+// error when it was asked for, rather than being defaultSettingsPath.
+func loadSettings(path string, required bool) (Settings, error) {
+	var s Settings
+	if _, err := os.Stat(path); os.IsNotExist(err) && !required {
+		return s, nil
+	}
+	if err := config.Load(path, &s); err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
+
+// flagValues are the settings that are set, keyed by flag name.
+func (s Settings) flagValues() map[string]string {
+	values := map[string]string{}
+	for name, value := range map[string]string{
+		"title":        s.Title,
+		"fullscreen":   s.Fullscreen,
+		"monitor":      s.Monitor,
+		"gpu":          s.GPU,
+		"validation":   s.Validation,
+		"present-mode": s.PresentMode,
+		"scene":        s.Scene,
+	} {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	for name, value := range map[string]int{
+		"width":  s.Width,
+		"height": s.Height,
+		"msaa":   s.MSAA,
+	} {
+		if value > 0 {
+			values[name] = strconv.Itoa(value)
+		}
+	}
+	// $GPU is more specific than the file, like the flag it's the default of
+	if os.Getenv(gpuEnv) != "" {
+		delete(values, "gpu")
+	}
+	return values
+}
+
+// applyFlags sets the flags in fs that weren't given on the command line,
+// first to the settings' values and then to the chosen scene's. Flags
+// override the file, which overrides the scene.
+func (s Settings) applyFlags(fs *flag.FlagSet) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	set := func(values map[string]string) error {
+		for name, value := range values {
+			if given[name] {
+				continue
+			}
+			if err := fs.Set(name, value); err != nil {
+				return errors.Wrapf(err, "can't set --%s to '%s'", name, value)
+			}
+			given[name] = true
+		}
+		return nil
+	}
+
+	if err := set(s.flagValues()); err != nil {
+		return err
+	}
+	name := fs.Lookup("scene").Value.String()
+	scene, ok := scenes[name]
+	if !ok {
+		return errors.Errorf("unknown scene '%s', expected one of %s", name, sceneNames())
+	}
+	return set(scene)
+}
+
+// usage is --help, the flags and where their values come from when they
+// aren't given.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(out, "Draws a demo scene with Vulkan. Flags that aren't given take their value\n")
+	fmt.Fprintf(out, "from the settings file, %s or --config, then from --scene, then\n", defaultSettingsPath)
+	fmt.Fprintf(out, "their default. $%s is the default of --gpu.\n\nFlags:\n", gpuEnv)
+	flag.PrintDefaults()
+}
@@ -0,0 +1,43 @@
+#version 450
+#extension GL_GOOGLE_include_directive : require
+
+#include "pbr.glsl"
+#define LIGHTS_SET 0
+#define LIGHTS_BINDING 3
+#include "lights.glsl"
+#include "bindless.glsl"
+
+layout(set = 0, binding = 1) uniform sampler2DShadow shadowMap;
+
+layout(location = 0) in vec3 fragColor;
+layout(location = 1) in vec2 fragTexCoord;
+layout(location = 2) in vec4 fragLightPos;
+layout(location = 3) in vec3 fragWorldPos;
+layout(location = 4) in vec3 fragNormal;
+layout(location = 5) in vec4 fragTangent;
+
+layout(location = 0) out vec4 outColor;
+
+layout(push_constant) uniform DrawConstants {
+    vec4 tint;
+    vec4 lightDirection;
+    vec4 cameraPosition;
+    // MaterialConstants, the draw's index into materials
+    uint material;
+} draw;
+
+// How lit the fragment is, the comparison sampler filters the depth tests
+// of the neighbouring texels. Outside the map is the white border, lit.
+float lit() {
+    vec3 light = fragLightPos.xyz / fragLightPos.w;
+    return texture(shadowMap, vec3(light.xy * 0.5 + 0.5, light.z));
+}
+
+void main() {
+    Surface s = sampleSurface(draw.material, fragTexCoord, fragNormal, fragTangent, draw.tint);
+    vec3 V = normalize(draw.cameraPosition.xyz - fragWorldPos);
+    vec3 color = shade(s.baseColor.rgb, s.metallic, s.roughness, s.occlusion,
+                       s.normal, V, -draw.lightDirection.xyz, lit());
+    color += shadeLights(s.baseColor.rgb, s.metallic, s.roughness, s.normal, V, fragWorldPos);
+    outColor = vec4(color + s.emissive, s.baseColor.a);
+}
@@ -0,0 +1,43 @@
+// The bindless material set, included by bindless.frag and
+// gbufferbindless.frag in place of material.glsl. Every material's factors
+// and texture indices are in one buffer and every texture in one table,
+// both bound once, the draw's material index is pushed.
+#extension GL_EXT_nonuniform_qualifier : require
+
+#include "surface.glsl"
+
+struct Material {
+    vec4 baseColor;
+    vec4 emissive;
+    float metallic;
+    float roughness;
+    float normalScale;
+    float occlusionStrength;
+    // Indices into textures, textures a material doesn't have index white
+    // or a flat normal
+    uint baseColorMap;
+    uint metallicRoughnessMap;
+    uint normalMap;
+    uint occlusionMap;
+    uint emissiveMap;
+};
+
+layout(set = 1, binding = 0) readonly buffer Materials { Material materials[]; };
+layout(set = 1, binding = 1) uniform sampler2D textures[];
+
+// sampleSurface reads material index at uv, bending the interpolated
+// normal by the tangent space normal map. index is the same for the whole
+// draw so it doesn't have to be nonuniformEXT.
+Surface sampleSurface(uint index, vec2 uv, vec3 normal, vec4 tangent, vec4 tint) {
+    Material material = materials[index];
+    Surface s;
+    s.baseColor = texture(textures[material.baseColorMap], uv) * material.baseColor * tint;
+    // glTF packs roughness in green and metallic in blue
+    vec3 metallicRoughness = texture(textures[material.metallicRoughnessMap], uv).rgb;
+    s.metallic = metallicRoughness.b * material.metallic;
+    s.roughness = metallicRoughness.g * material.roughness;
+    s.occlusion = mix(1.0, texture(textures[material.occlusionMap], uv).r, material.occlusionStrength);
+    s.emissive = texture(textures[material.emissiveMap], uv).rgb * material.emissive.rgb;
+    s.normal = bendNormal(normal, tangent, texture(textures[material.normalMap], uv).xyz, material.normalScale);
+    return s;
+}
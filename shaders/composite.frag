@@ -0,0 +1,34 @@
+#version 450
+
+layout(binding = 0) uniform sampler2D scene;
+layout(binding = 1) uniform sampler2D bloomTexture;
+
+layout(location = 0) out vec4 outColor;
+
+layout(push_constant) uniform CompositeConstants {
+    float intensity;
+} composite;
+
+// tonemapACES is Krzysztof Narkowicz's fit of the ACES filmic curve,
+// mapping HDR color into [0, 1].
+vec3 tonemapACES(vec3 x) {
+    const float a = 2.51;
+    const float b = 0.03;
+    const float c = 2.43;
+    const float d = 0.59;
+    const float e = 0.14;
+    return clamp((x * (a * x + b)) / (x * (c * x + d) + e), 0.0, 1.0);
+}
+
+void main() {
+    // The scene is the target's size so it's read texel for pixel, the
+    // bloom is half that and filtered up
+    ivec2 pixel = ivec2(gl_FragCoord.xy);
+    vec2 uv = gl_FragCoord.xy / vec2(textureSize(scene, 0));
+    vec4 color = texelFetch(scene, pixel, 0);
+    vec3 bloom = texture(bloomTexture, uv).rgb;
+
+    // Bloom is added in linear HDR before tonemapping squeezes it, the
+    // target's sRGB format encodes the result
+    outColor = vec4(tonemapACES(color.rgb + bloom * composite.intensity), color.a);
+}
@@ -0,0 +1,11 @@
+//go:build shaderdisk
+
+package shaders
+
+import "io/fs"
+
+// embedded is nothing with the shaderdisk tag, Load reads from disk so
+// regenerated SPIR-V is picked up without rebuilding.
+func embedded() (fs.FS, bool) {
+	return nil, false
+}
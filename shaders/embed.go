@@ -0,0 +1,16 @@
+//go:build !shaderdisk
+
+package shaders
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.spv
+var files embed.FS
+
+// embedded is the SPIR-V built into the binary.
+func embedded() (fs.FS, bool) {
+	return files, true
+}
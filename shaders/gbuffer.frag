@@ -0,0 +1,40 @@
+#version 450
+#extension GL_GOOGLE_include_directive : require
+
+#include "material.glsl"
+
+layout(set = 0, binding = 1) uniform sampler2DShadow shadowMap;
+
+layout(location = 0) in vec3 fragColor;
+layout(location = 1) in vec2 fragTexCoord;
+layout(location = 2) in vec4 fragLightPos;
+layout(location = 3) in vec3 fragWorldPos;
+layout(location = 4) in vec3 fragNormal;
+layout(location = 5) in vec4 fragTangent;
+
+// Base color and occlusion
+layout(location = 0) out vec4 outAlbedo;
+// Normal and metallic
+layout(location = 1) out vec4 outNormal;
+// World position and roughness
+layout(location = 2) out vec4 outPosition;
+// Emissive and how lit the surface is by the light, tested here while the
+// light space position is at hand
+layout(location = 3) out vec4 outEmissive;
+
+layout(push_constant) uniform DrawConstants {
+    vec4 tint;
+    vec4 lightDirection;
+    vec4 cameraPosition;
+} draw;
+
+void main() {
+    vec3 light = fragLightPos.xyz / fragLightPos.w;
+    float lit = texture(shadowMap, vec3(light.xy * 0.5 + 0.5, light.z));
+
+    Surface s = sampleSurface(fragTexCoord, fragNormal, fragTangent, draw.tint);
+    outAlbedo = vec4(s.baseColor.rgb, s.occlusion);
+    outNormal = vec4(s.normal, s.metallic);
+    outPosition = vec4(fragWorldPos, s.roughness);
+    outEmissive = vec4(s.emissive, lit);
+}
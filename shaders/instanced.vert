@@ -0,0 +1,44 @@
+#version 450
+
+layout(binding = 0) uniform UniformBufferObject {
+    mat4 model;
+    mat4 view;
+    mat4 proj;
+    mat4 lightViewProj;
+} ubo;
+
+layout(location = 0) in vec3 inPosition;
+layout(location = 1) in vec3 inColor;
+layout(location = 2) in vec2 inTexCoord;
+layout(location = 3) in vec3 inNormal;
+layout(location = 4) in vec4 inTangent;
+
+// Per instance, the columns of the instance's model matrix
+layout(location = 5) in vec4 inModel0;
+layout(location = 6) in vec4 inModel1;
+layout(location = 7) in vec4 inModel2;
+layout(location = 8) in vec4 inModel3;
+
+layout(location = 0) out vec3 fragColor;
+layout(location = 1) out vec2 fragTexCoord;
+layout(location = 2) out vec4 fragLightPos;
+layout(location = 3) out vec3 fragWorldPos;
+layout(location = 4) out vec3 fragNormal;
+layout(location = 5) out vec4 fragTangent;
+
+void main() {
+    mat4 instanceModel = mat4(inModel0, inModel1, inModel2, inModel3);
+    vec4 world = ubo.model * instanceModel * vec4(inPosition, 1.0);
+    gl_Position = ubo.proj * ubo.view * world;
+    fragLightPos = ubo.lightViewProj * world;
+    fragWorldPos = world.xyz;
+    // The model matrices only rotate, translate and scale uniformly so
+    // they transform normals too
+    mat3 normalMatrix = mat3(ubo.model * instanceModel);
+    fragNormal = normalMatrix * inNormal;
+    fragTangent = vec4(normalMatrix * inTangent.xyz, inTangent.w);
+    fragColor = inColor;
+    fragTexCoord = inTexCoord;
+    // Only read by the point polygon mode, where it'd be undefined otherwise
+    gl_PointSize = 1.0;
+}
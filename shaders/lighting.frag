@@ -0,0 +1,39 @@
+#version 450
+#extension GL_GOOGLE_include_directive : require
+
+#include "pbr.glsl"
+#define LIGHTS_SET 0
+#define LIGHTS_BINDING 4
+#include "lights.glsl"
+
+layout(input_attachment_index = 0, binding = 0) uniform subpassInput gbufferAlbedo;
+layout(input_attachment_index = 1, binding = 1) uniform subpassInput gbufferNormal;
+layout(input_attachment_index = 2, binding = 2) uniform subpassInput gbufferPosition;
+layout(input_attachment_index = 3, binding = 3) uniform subpassInput gbufferEmissive;
+
+layout(location = 0) out vec4 outColor;
+
+layout(push_constant) uniform LightingConstants {
+    vec4 lightDirection;
+    vec4 cameraPosition;
+} lighting;
+
+void main() {
+    vec4 albedo = subpassLoad(gbufferAlbedo);
+    vec4 normal = subpassLoad(gbufferNormal);
+    vec4 position = subpassLoad(gbufferPosition);
+    vec4 emissive = subpassLoad(gbufferEmissive);
+    // Nothing was drawn here, the G-buffer still holds its clear values
+    if (normal.xyz == vec3(0.0)) {
+        outColor = vec4(0.0, 0.0, 0.0, 1.0);
+        return;
+    }
+
+    // The same shading as shader.frag
+    vec3 V = normalize(lighting.cameraPosition.xyz - position.xyz);
+    vec3 N = normalize(normal.xyz);
+    vec3 color = shade(albedo.rgb, normal.w, position.w, albedo.a,
+                       N, V, -lighting.lightDirection.xyz, emissive.a);
+    color += shadeLights(albedo.rgb, normal.w, position.w, N, V, position.xyz);
+    outColor = vec4(color + emissive.rgb, 1.0);
+}
@@ -0,0 +1,67 @@
+// The scene's dynamic lights, packed by the lights package. Included after
+// pbr.glsl by shader.frag, bindless.frag and lighting.frag, which define
+// LIGHTS_SET and LIGHTS_BINDING to say where the block is bound.
+
+// MAX_LIGHTS is lights.MaxLights.
+#define MAX_LIGHTS 64
+
+// The kinds of light, scene.LightKind.
+const uint POINT_LIGHT = 0;
+const uint SPOT_LIGHT = 1;
+const uint DIRECTIONAL_LIGHT = 2;
+
+struct Light {
+    // xyz is the world position, w the kind
+    vec4 position;
+    // xyz is the way spot and directional lights shine, w the range with
+    // zero unlimited
+    vec4 direction;
+    // The color scaled by the intensity
+    vec4 color;
+    // The cosines of a spot light's inner and outer half angles
+    vec4 cone;
+};
+
+layout(set = LIGHTS_SET, binding = LIGHTS_BINDING) uniform Lights {
+    uint count;
+    Light lights[MAX_LIGHTS];
+} lights;
+
+// attenuation is how much of a light is left distance away. It falls off
+// with the inverse square, windowed to reach zero at range so lights can be
+// skipped past it.
+float attenuation(float distance, float range) {
+    float falloff = 1.0 / max(distance * distance, 1e-4);
+    if (range <= 0.0) {
+        return falloff;
+    }
+    float window = clamp(1.0 - pow(distance / range, 4.0), 0.0, 1.0);
+    return falloff * window * window;
+}
+
+// shadeLights is the light every dynamic light reflects towards V, they
+// don't cast shadows.
+vec3 shadeLights(vec3 baseColor, float metallic, float roughness,
+                 vec3 N, vec3 V, vec3 position) {
+    vec3 color = vec3(0.0);
+    for (uint i = 0; i < min(lights.count, MAX_LIGHTS); i++) {
+        Light light = lights.lights[i];
+        uint kind = uint(light.position.w);
+        vec3 L = -light.direction.xyz;
+        float strength = 1.0;
+        if (kind != DIRECTIONAL_LIGHT) {
+            vec3 toLight = light.position.xyz - position;
+            float distance = length(toLight);
+            L = toLight / max(distance, 1e-4);
+            strength = attenuation(distance, light.direction.w);
+        }
+        if (kind == SPOT_LIGHT) {
+            float cosTheta = dot(-L, light.direction.xyz);
+            strength *= clamp((cosTheta - light.cone.y) / max(light.cone.x - light.cone.y, 1e-4), 0.0, 1.0);
+        }
+        if (strength > 0.0) {
+            color += brdf(baseColor, metallic, roughness, N, V, L) * light.color.rgb * strength;
+        }
+    }
+    return color;
+}
@@ -0,0 +1,34 @@
+// A Material's descriptor set, included by shader.frag and gbuffer.frag.
+// Textures a material doesn't have are bound to white, or a flat normal.
+
+#include "surface.glsl"
+
+layout(set = 1, binding = 0) uniform MaterialFactors {
+    vec4 baseColor;
+    vec4 emissive;
+    float metallic;
+    float roughness;
+    float normalScale;
+    float occlusionStrength;
+} material;
+
+layout(set = 1, binding = 1) uniform sampler2D baseColorMap;
+// glTF packs roughness in green and metallic in blue
+layout(set = 1, binding = 2) uniform sampler2D metallicRoughnessMap;
+layout(set = 1, binding = 3) uniform sampler2D normalMap;
+layout(set = 1, binding = 4) uniform sampler2D occlusionMap;
+layout(set = 1, binding = 5) uniform sampler2D emissiveMap;
+
+// sampleSurface reads the material at uv, bending the interpolated normal
+// by the tangent space normal map.
+Surface sampleSurface(vec2 uv, vec3 normal, vec4 tangent, vec4 tint) {
+    Surface s;
+    s.baseColor = texture(baseColorMap, uv) * material.baseColor * tint;
+    vec3 metallicRoughness = texture(metallicRoughnessMap, uv).rgb;
+    s.metallic = metallicRoughness.b * material.metallic;
+    s.roughness = metallicRoughness.g * material.roughness;
+    s.occlusion = mix(1.0, texture(occlusionMap, uv).r, material.occlusionStrength);
+    s.emissive = texture(emissiveMap, uv).rgb * material.emissive.rgb;
+    s.normal = bendNormal(normal, tangent, texture(normalMap, uv).xyz, material.normalScale);
+    return s;
+}
@@ -0,0 +1,38 @@
+// Blending morph targets. Included by skinned.vert and skinnedshadow.vert,
+// which morph vertices before skinning them.
+
+// MorphDelta is the main package's MorphDelta, how far a target moves a
+// vertex at a weight of one.
+struct MorphDelta {
+    vec4 position;
+    vec4 normal;
+    vec4 tangent;
+};
+
+// Where each vertex in the vertex buffer finds its targets: x is its first
+// MorphDelta, y how many targets there are and z the first of their
+// weights
+layout(std430, set = 0, binding = 6) readonly buffer MorphVertices {
+    uvec4 morphVertices[];
+};
+
+layout(std430, set = 0, binding = 7) readonly buffer MorphDeltas {
+    MorphDelta morphDeltas[];
+};
+
+// Every morphed node's target weights, written every frame
+layout(std430, set = 0, binding = 8) readonly buffer MorphWeights {
+    float morphWeights[];
+};
+
+// morph moves the vertex being shaded by its targets' weighted deltas.
+void morph(inout vec3 position, inout vec3 normal, inout vec3 tangent) {
+    uvec4 v = morphVertices[gl_VertexIndex];
+    for (uint t = 0; t < v.y; t++) {
+        float weight = morphWeights[v.z + t];
+        MorphDelta d = morphDeltas[v.x + t];
+        position += weight * d.position.xyz;
+        normal += weight * d.normal.xyz;
+        tangent += weight * d.tangent.xyz;
+    }
+}
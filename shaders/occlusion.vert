@@ -0,0 +1,29 @@
+#version 450
+
+// An object's world space bounding box and the camera's view projection
+layout(push_constant) uniform OcclusionConstants {
+    mat4 viewProj;
+    vec4 boxMin;
+    vec4 boxMax;
+} constants;
+
+// The box as 12 triangles, drawn without a vertex buffer. Which way they
+// face doesn't matter, they're drawn without culling
+const vec3 corners[8] = vec3[](
+    vec3(0, 0, 0), vec3(1, 0, 0), vec3(1, 1, 0), vec3(0, 1, 0),
+    vec3(0, 0, 1), vec3(1, 0, 1), vec3(1, 1, 1), vec3(0, 1, 1)
+);
+const int indices[36] = int[](
+    0, 1, 2, 2, 3, 0,
+    5, 4, 7, 7, 6, 5,
+    4, 0, 3, 3, 7, 4,
+    1, 5, 6, 6, 2, 1,
+    3, 2, 6, 6, 7, 3,
+    4, 5, 1, 1, 0, 4
+);
+
+void main() {
+    vec3 corner = corners[indices[gl_VertexIndex]];
+    vec3 position = mix(constants.boxMin.xyz, constants.boxMax.xyz, corner);
+    gl_Position = constants.viewProj * vec4(position, 1.0);
+}
@@ -0,0 +1,12 @@
+#version 450
+
+layout(location = 0) in vec2 fragCorner;
+layout(location = 1) in vec4 fragColor;
+
+layout(location = 0) out vec4 outColor;
+
+void main() {
+    // A soft round spot, blended additively
+    float falloff = max(1.0 - dot(fragCorner, fragCorner), 0.0);
+    outColor = vec4(fragColor.rgb * fragColor.a * falloff * falloff, 0.0);
+}
@@ -0,0 +1,39 @@
+#version 450
+
+// Draws each particle as a camera facing quad, one instance per particle
+// with the quad's corners built in
+layout(push_constant) uniform ParticleDrawConstants {
+    mat4 viewProj;
+    // The camera's right and up in world space, up's w is the quad's size
+    vec4 right;
+    vec4 up;
+} constants;
+
+layout(location = 0) in vec4 inPosition;
+layout(location = 1) in vec4 inVelocity;
+
+layout(location = 0) out vec2 fragCorner;
+layout(location = 1) out vec4 fragColor;
+
+const vec2 corners[6] = vec2[](
+    vec2(-1, -1), vec2(1, -1), vec2(1, 1),
+    vec2(1, 1), vec2(-1, 1), vec2(-1, -1)
+);
+
+void main() {
+    float age = inPosition.w;
+    float life = age / inVelocity.w;
+    if (age < 0.0) {
+        // Not born yet, outside the clip volume
+        gl_Position = vec4(0.0, 0.0, -1.0, 1.0);
+        return;
+    }
+
+    vec2 corner = corners[gl_VertexIndex];
+    float size = constants.up.w * (1.0 - 0.5 * life);
+    vec3 position = inPosition.xyz + (constants.right.xyz * corner.x + constants.up.xyz * corner.y) * size;
+    gl_Position = constants.viewProj * vec4(position, 1.0);
+    fragCorner = corner;
+    // White hot when born, cooling through orange to a faded red
+    fragColor = vec4(mix(vec3(4.0, 3.0, 1.5), vec3(1.0, 0.15, 0.02), life), 1.0 - life);
+}
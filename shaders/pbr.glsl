@@ -0,0 +1,58 @@
+// Cook-Torrance metallic-roughness shading, included by shader.frag and
+// lighting.frag so forward and deferred rendering match.
+
+const float PI = 3.14159265359;
+
+// ambient is how much of the base color shows without direct light.
+const float ambient = 0.3;
+
+// distributionGGX is the Trowbridge-Reitz GGX normal distribution.
+float distributionGGX(float NdotH, float roughness) {
+    float a = roughness * roughness;
+    float a2 = a * a;
+    float d = NdotH * NdotH * (a2 - 1.0) + 1.0;
+    return a2 / (PI * d * d);
+}
+
+// geometrySchlickGGX is Smith's shadowing-masking for one direction, with
+// k remapped for direct light.
+float geometrySchlickGGX(float NdotX, float roughness) {
+    float r = roughness + 1.0;
+    float k = r * r / 8.0;
+    return NdotX / (NdotX * (1.0 - k) + k);
+}
+
+vec3 fresnelSchlick(float cosTheta, vec3 F0) {
+    return F0 + (1.0 - F0) * pow(clamp(1.0 - cosTheta, 0.0, 1.0), 5.0);
+}
+
+// brdf is the light reflected towards V by a surface lit from L, per unit
+// of light arriving head on, including the cosine falloff.
+vec3 brdf(vec3 baseColor, float metallic, float roughness, vec3 N, vec3 V, vec3 L) {
+    roughness = clamp(roughness, 0.04, 1.0);
+    vec3 H = normalize(V + L);
+    float NdotL = max(dot(N, L), 0.0);
+    float NdotV = max(dot(N, V), 1e-4);
+    float NdotH = max(dot(N, H), 0.0);
+
+    // Dielectrics reflect about 4% head on, metals tint the reflection
+    vec3 F0 = mix(vec3(0.04), baseColor, metallic);
+    vec3 F = fresnelSchlick(max(dot(H, V), 0.0), F0);
+    float D = distributionGGX(NdotH, roughness);
+    float G = geometrySchlickGGX(NdotV, roughness) * geometrySchlickGGX(NdotL, roughness);
+    vec3 specular = D * G * F / (4.0 * NdotV * max(NdotL, 1e-4));
+
+    // What isn't reflected is diffused, except by metals which absorb it
+    vec3 diffuse = (1.0 - F) * (1.0 - metallic) * baseColor / PI;
+
+    return (diffuse + specular) * NdotL;
+}
+
+// shade lights a surface seen from V by a directional light arriving from
+// L, lit scaling the direct light for shadows. The light's intensity is PI
+// so a white Lambertian surface facing it comes out white.
+vec3 shade(vec3 baseColor, float metallic, float roughness, float occlusion,
+           vec3 N, vec3 V, vec3 L, float lit) {
+    vec3 direct = brdf(baseColor, metallic, roughness, N, V, L) * PI * lit;
+    return direct + ambient * baseColor * occlusion;
+}
@@ -0,0 +1,402 @@
+// Package shaders holds the compiled SPIR-V for every shader stage. The GLSL
+// sources live alongside and are compiled with go generate, which has to run
+// before building because the SPIR-V is embedded into the binary. Building
+// with the shaderdisk tag reads it from disk at startup instead, so shaders
+// can be regenerated without rebuilding.
+package shaders
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+//go:generate glslangValidator -V shader.vert -o vert.spv
+//go:generate glslangValidator -V shader.frag -o frag.spv
+//go:generate glslangValidator -V instanced.vert -o instanced.spv
+//go:generate glslangValidator -V ui.vert -o uivert.spv
+//go:generate glslangValidator -V ui.frag -o uifrag.spv
+//go:generate glslangValidator -V skybox.vert -o skyboxvert.spv
+//go:generate glslangValidator -V skybox.frag -o skyboxfrag.spv
+//go:generate glslangValidator -V equirect.comp -o equirect.spv
+//go:generate glslangValidator -V shadow.vert -o shadow.spv
+//go:generate glslangValidator -V shadowinstanced.vert -o shadowinstanced.spv
+//go:generate glslangValidator -V gbuffer.frag -o gbuffer.spv
+//go:generate glslangValidator -V lighting.vert -o lightingvert.spv
+//go:generate glslangValidator -V lighting.frag -o lightingfrag.spv
+//go:generate glslangValidator -V bloom.comp -o bloom.spv
+//go:generate glslangValidator -V composite.frag -o compositefrag.spv
+//go:generate glslangValidator -V particles.comp -o particles.spv
+//go:generate glslangValidator -V particle.vert -o particlevert.spv
+//go:generate glslangValidator -V particle.frag -o particlefrag.spv
+//go:generate glslangValidator -V text.vert -o textvert.spv
+//go:generate glslangValidator -V text.frag -o textfrag.spv
+//go:generate glslangValidator -V sprite.vert -o spritevert.spv
+//go:generate glslangValidator -V sprite.frag -o spritefrag.spv
+//go:generate glslangValidator -V saxpy.comp -o saxpy.spv
+//go:generate glslangValidator -V reduce.comp -o reduce.spv
+//go:generate glslangValidator -V --target-env spirv1.4 raytrace.rgen -o raytracergen.spv
+//go:generate glslangValidator -V --target-env spirv1.4 raytrace.rmiss -o raytracemiss.spv
+//go:generate glslangValidator -V --target-env spirv1.4 shadow.rmiss -o shadowmiss.spv
+//go:generate glslangValidator -V --target-env spirv1.4 raytrace.rchit -o raytracechit.spv
+//go:generate glslangValidator -V --target-env spirv1.4 meshlet.task -o meshlettask.spv
+//go:generate glslangValidator -V --target-env spirv1.4 meshlet.mesh -o meshletmesh.spv
+//go:generate glslangValidator -V bindless.frag -o bindlessfrag.spv
+//go:generate glslangValidator -V gbufferbindless.frag -o gbufferbindless.spv
+//go:generate glslangValidator -V stereo.vert -o stereo.spv
+//go:generate glslangValidator -V skinned.vert -o skinned.spv
+//go:generate glslangValidator -V skinnedshadow.vert -o skinnedshadow.spv
+//go:generate glslangValidator -V occlusion.vert -o occlusion.spv
+
+// The SPIR-V of each stage, filled in by Load.
+var (
+	vert            []byte
+	frag            []byte
+	instanced       []byte
+	uiVert          []byte
+	uiFrag          []byte
+	skyboxVert      []byte
+	skyboxFrag      []byte
+	equirect        []byte
+	shadow          []byte
+	shadowInstanced []byte
+	gbuffer         []byte
+	lightingVert    []byte
+	lightingFrag    []byte
+	bloom           []byte
+	compositeFrag   []byte
+	particles       []byte
+	particleVert    []byte
+	particleFrag    []byte
+	textVert        []byte
+	textFrag        []byte
+	spriteVert      []byte
+	spriteFrag      []byte
+	saxpy           []byte
+	reduce          []byte
+	rayTraceRgen    []byte
+	rayTraceMiss    []byte
+	shadowMiss      []byte
+	rayTraceChit    []byte
+	meshletTask     []byte
+	meshletMesh     []byte
+	bindlessFrag    []byte
+	gbufferBindless []byte
+	stereo          []byte
+	skinned         []byte
+	skinnedShadow   []byte
+	occlusion       []byte
+)
+
+// compiled pairs each go generate output with the variable Load reads it
+// into.
+var compiled = []struct {
+	file string
+	code *[]byte
+}{
+	{"vert.spv", &vert},
+	{"frag.spv", &frag},
+	{"instanced.spv", &instanced},
+	{"uivert.spv", &uiVert},
+	{"uifrag.spv", &uiFrag},
+	{"skyboxvert.spv", &skyboxVert},
+	{"skyboxfrag.spv", &skyboxFrag},
+	{"equirect.spv", &equirect},
+	{"shadow.spv", &shadow},
+	{"shadowinstanced.spv", &shadowInstanced},
+	{"gbuffer.spv", &gbuffer},
+	{"lightingvert.spv", &lightingVert},
+	{"lightingfrag.spv", &lightingFrag},
+	{"bloom.spv", &bloom},
+	{"compositefrag.spv", &compositeFrag},
+	{"particles.spv", &particles},
+	{"particlevert.spv", &particleVert},
+	{"particlefrag.spv", &particleFrag},
+	{"textvert.spv", &textVert},
+	{"textfrag.spv", &textFrag},
+	{"spritevert.spv", &spriteVert},
+	{"spritefrag.spv", &spriteFrag},
+	{"saxpy.spv", &saxpy},
+	{"reduce.spv", &reduce},
+	{"raytracergen.spv", &rayTraceRgen},
+	{"raytracemiss.spv", &rayTraceMiss},
+	{"shadowmiss.spv", &shadowMiss},
+	{"raytracechit.spv", &rayTraceChit},
+	{"meshlettask.spv", &meshletTask},
+	{"meshletmesh.spv", &meshletMesh},
+	{"bindlessfrag.spv", &bindlessFrag},
+	{"gbufferbindless.spv", &gbufferBindless},
+	{"stereo.spv", &stereo},
+	{"skinned.spv", &skinned},
+	{"skinnedshadow.spv", &skinnedShadow},
+	{"occlusion.spv", &occlusion},
+}
+
+// spirvMagic is the first word of every SPIR-V module.
+const spirvMagic = 0x07230203
+
+// spirvHeaderSize is the size of a SPIR-V module's header, five words.
+const spirvHeaderSize = 20
+
+// Load reads every stage's SPIR-V from the binary, or from dir when it was
+// built with the shaderdisk tag. An empty dir looks for a shaders directory
+// next to the executable, then in the working directory.
+func Load(dir string) error {
+	fsys, ok := embedded()
+	if !ok {
+		if dir == "" {
+			dir = findDir()
+		}
+		fsys = os.DirFS(dir)
+	}
+
+	for _, c := range compiled {
+		code, err := fs.ReadFile(fsys, c.file)
+		if err != nil {
+			return errors.Wrapf(err, "can't read '%s', run go generate ./shaders", c.file)
+		}
+		if err := validate(code); err != nil {
+			return errors.Wrapf(err, "'%s' isn't usable, run go generate ./shaders", c.file)
+		}
+		*c.code = code
+	}
+	return nil
+}
+
+// findDir is the shaders directory next to the executable when there is
+// one, so it runs from anywhere once installed alongside it.
+func findDir() string {
+	if exe, err := os.Executable(); err == nil {
+		dir := filepath.Join(filepath.Dir(exe), "shaders")
+		if _, err := os.Stat(filepath.Join(dir, compiled[0].file)); err == nil {
+			return dir
+		}
+	}
+	return "shaders"
+}
+
+// validate checks code is a whole number of words starting with a SPIR-V
+// header, which catches truncated or placeholder files before the driver
+// sees them.
+func validate(code []byte) error {
+	if len(code) < spirvHeaderSize || len(code)%4 != 0 {
+		return errors.Errorf("%d bytes isn't a SPIR-V module", len(code))
+	}
+	if magic := binary.LittleEndian.Uint32(code); magic != spirvMagic {
+		return errors.Errorf("magic number %#08x isn't SPIR-V's", magic)
+	}
+	return nil
+}
+
+// Vert is the SPIR-V of shader.vert.
+func Vert() []byte {
+	return vert
+}
+
+// Frag is the SPIR-V of shader.frag.
+func Frag() []byte {
+	return frag
+}
+
+// Instanced is the SPIR-V of instanced.vert, shader.vert with a per instance
+// model matrix.
+func Instanced() []byte {
+	return instanced
+}
+
+// UIVert is the SPIR-V of ui.vert, which places Dear ImGui's vertices.
+func UIVert() []byte {
+	return uiVert
+}
+
+// UIFrag is the SPIR-V of ui.frag, which shades Dear ImGui's triangles.
+func UIFrag() []byte {
+	return uiFrag
+}
+
+// SkyboxVert is the SPIR-V of skybox.vert, which draws a cube around the
+// camera on the far plane.
+func SkyboxVert() []byte {
+	return skyboxVert
+}
+
+// SkyboxFrag is the SPIR-V of skybox.frag, which samples the sky's cube map.
+func SkyboxFrag() []byte {
+	return skyboxFrag
+}
+
+// Equirect is the SPIR-V of equirect.comp, which projects an
+// equirectangular panorama onto a cube map.
+func Equirect() []byte {
+	return equirect
+}
+
+// Shadow is the SPIR-V of shadow.vert, which places shader.vert's vertices
+// in the light's view for the shadow map.
+func Shadow() []byte {
+	return shadow
+}
+
+// ShadowInstanced is the SPIR-V of shadowinstanced.vert, shadow.vert with a
+// per instance model matrix.
+func ShadowInstanced() []byte {
+	return shadowInstanced
+}
+
+// GBuffer is the SPIR-V of gbuffer.frag, which writes shader.frag's inputs
+// to the G-buffer for deferred lighting.
+func GBuffer() []byte {
+	return gbuffer
+}
+
+// LightingVert is the SPIR-V of lighting.vert, which draws a fullscreen
+// triangle.
+func LightingVert() []byte {
+	return lightingVert
+}
+
+// LightingFrag is the SPIR-V of lighting.frag, which shades the G-buffer.
+func LightingFrag() []byte {
+	return lightingFrag
+}
+
+// Bloom is the SPIR-V of bloom.comp, which thresholds, downsamples and
+// upsamples the bloom chain.
+func Bloom() []byte {
+	return bloom
+}
+
+// CompositeFrag is the SPIR-V of composite.frag, which adds the bloom to
+// the HDR scene and tonemaps it into the target.
+func CompositeFrag() []byte {
+	return compositeFrag
+}
+
+// Particles is the SPIR-V of particles.comp, which steps the particle
+// simulation.
+func Particles() []byte {
+	return particles
+}
+
+// ParticleVert is the SPIR-V of particle.vert, which draws a camera facing
+// quad per particle.
+func ParticleVert() []byte {
+	return particleVert
+}
+
+// ParticleFrag is the SPIR-V of particle.frag, which shades the particles'
+// quads as soft additive spots.
+func ParticleFrag() []byte {
+	return particleFrag
+}
+
+// TextVert is the SPIR-V of text.vert, which places the text module's
+// glyph quads.
+func TextVert() []byte {
+	return textVert
+}
+
+// TextFrag is the SPIR-V of text.frag, which shades glyphs from the signed
+// distance field atlas with a dark outline.
+func TextFrag() []byte {
+	return textFrag
+}
+
+// SpriteVert is the SPIR-V of sprite.vert, which projects the sprite
+// batch's quads.
+func SpriteVert() []byte {
+	return spriteVert
+}
+
+// SpriteFrag is the SPIR-V of sprite.frag, which shades sprites from their
+// texture.
+func SpriteFrag() []byte {
+	return spriteFrag
+}
+
+// Saxpy is the SPIR-V of saxpy.comp, which computes a * x + y over arrays
+// of floats for the compute example.
+func Saxpy() []byte {
+	return saxpy
+}
+
+// Reduce is the SPIR-V of reduce.comp, which sums an array of uints for the
+// GPGPU example.
+func Reduce() []byte {
+	return reduce
+}
+
+// RayTraceRgen is the SPIR-V of raytrace.rgen, which traces camera and
+// shadow rays through the ray tracing sample.
+func RayTraceRgen() []byte {
+	return rayTraceRgen
+}
+
+// RayTraceMiss is the SPIR-V of raytrace.rmiss, for camera rays that hit
+// nothing.
+func RayTraceMiss() []byte {
+	return rayTraceMiss
+}
+
+// ShadowMiss is the SPIR-V of shadow.rmiss, for shadow rays that reach the
+// light.
+func ShadowMiss() []byte {
+	return shadowMiss
+}
+
+// RayTraceChit is the SPIR-V of raytrace.rchit, which shades what camera
+// rays hit.
+func RayTraceChit() []byte {
+	return rayTraceChit
+}
+
+// MeshletTask is the SPIR-V of meshlet.task, which culls meshlets outside
+// the view and launches a mesh shader workgroup per visible one.
+func MeshletTask() []byte {
+	return meshletTask
+}
+
+// MeshletMesh is the SPIR-V of meshlet.mesh, which outputs a meshlet's
+// triangles with shader.vert's outputs.
+func MeshletMesh() []byte {
+	return meshletMesh
+}
+
+// BindlessFrag is the SPIR-V of bindless.frag, shader.frag reading its
+// material from the bindless table by a pushed index.
+func BindlessFrag() []byte {
+	return bindlessFrag
+}
+
+// GBufferBindless is the SPIR-V of gbufferbindless.frag, gbuffer.frag
+// reading its material from the bindless table by a pushed index.
+func GBufferBindless() []byte {
+	return gbufferBindless
+}
+
+// Stereo is the SPIR-V of stereo.vert, shader.vert placing vertices with
+// the view and projection of the eye gl_ViewIndex is drawing.
+func Stereo() []byte {
+	return stereo
+}
+
+// Skinned is the SPIR-V of skinned.vert, shader.vert blending each vertex's
+// morph targets and moving it by the animated joints it's weighted to.
+func Skinned() []byte {
+	return skinned
+}
+
+// SkinnedShadow is the SPIR-V of skinnedshadow.vert, shadow.vert morphed
+// and skinned like skinned.vert.
+func SkinnedShadow() []byte {
+	return skinnedShadow
+}
+
+// Occlusion is the SPIR-V of occlusion.vert, which draws a world space
+// bounding box for an occlusion query.
+func Occlusion() []byte {
+	return occlusion
+}
@@ -0,0 +1,21 @@
+#version 450
+
+layout(binding = 0) uniform UniformBufferObject {
+    mat4 model;
+    mat4 view;
+    mat4 proj;
+    mat4 lightViewProj;
+} ubo;
+
+layout(location = 0) in vec3 inPosition;
+
+// Per instance, the columns of the instance's model matrix
+layout(location = 5) in vec4 inModel0;
+layout(location = 6) in vec4 inModel1;
+layout(location = 7) in vec4 inModel2;
+layout(location = 8) in vec4 inModel3;
+
+void main() {
+    mat4 instanceModel = mat4(inModel0, inModel1, inModel2, inModel3);
+    gl_Position = ubo.lightViewProj * ubo.model * instanceModel * vec4(inPosition, 1.0);
+}
@@ -0,0 +1,33 @@
+// Skinning to the animated pose's joints. Included by skinned.vert and
+// skinnedshadow.vert after morph.glsl.
+
+// The pose's joint matrices, written every frame, already in the scene's Z
+// up world
+layout(std430, set = 0, binding = 4) readonly buffer Joints {
+    mat4 joints[];
+};
+
+// SkinVertex is the main package's SkinVertex.
+struct SkinVertex {
+    uvec4 joints;
+    // Sum to one, or are all zero when the vertex isn't skinned
+    vec4 weights;
+};
+
+// A SkinVertex for each vertex in the vertex buffer
+layout(std430, set = 0, binding = 5) readonly buffer SkinVertices {
+    SkinVertex skinVertices[];
+};
+
+// skinMatrix is the weighted sum of the matrices of the joints moving the
+// vertex being shaded.
+mat4 skinMatrix() {
+    SkinVertex v = skinVertices[gl_VertexIndex];
+    if (v.weights == vec4(0.0)) {
+        return mat4(1.0);
+    }
+    return v.weights.x * joints[v.joints.x] +
+        v.weights.y * joints[v.joints.y] +
+        v.weights.z * joints[v.joints.z] +
+        v.weights.w * joints[v.joints.w];
+}
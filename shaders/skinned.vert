@@ -0,0 +1,47 @@
+#version 450
+#extension GL_GOOGLE_include_directive : require
+
+#include "morph.glsl"
+#include "skin.glsl"
+
+layout(binding = 0) uniform UniformBufferObject {
+    mat4 model;
+    mat4 view;
+    mat4 proj;
+    mat4 lightViewProj;
+} ubo;
+
+layout(location = 0) in vec3 inPosition;
+layout(location = 1) in vec3 inColor;
+layout(location = 2) in vec2 inTexCoord;
+layout(location = 3) in vec3 inNormal;
+layout(location = 4) in vec4 inTangent;
+
+layout(location = 0) out vec3 fragColor;
+layout(location = 1) out vec2 fragTexCoord;
+layout(location = 2) out vec4 fragLightPos;
+layout(location = 3) out vec3 fragWorldPos;
+layout(location = 4) out vec3 fragNormal;
+layout(location = 5) out vec4 fragTangent;
+
+void main() {
+    vec3 position = inPosition;
+    vec3 normal = inNormal;
+    vec3 tangent = inTangent.xyz;
+    morph(position, normal, tangent);
+
+    mat4 model = ubo.model * skinMatrix();
+    vec4 world = model * vec4(position, 1.0);
+    gl_Position = ubo.proj * ubo.view * world;
+    fragLightPos = ubo.lightViewProj * world;
+    fragWorldPos = world.xyz;
+    // Joints scaling unevenly skew normals a little, which goes unnoticed
+    // next to the weights blending them
+    mat3 normalMatrix = mat3(model);
+    fragNormal = normalMatrix * normal;
+    fragTangent = vec4(normalMatrix * tangent, inTangent.w);
+    fragColor = inColor;
+    fragTexCoord = inTexCoord;
+    // Only read by the point polygon mode, where it'd be undefined otherwise
+    gl_PointSize = 1.0;
+}
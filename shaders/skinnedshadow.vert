@@ -0,0 +1,23 @@
+#version 450
+#extension GL_GOOGLE_include_directive : require
+
+#include "morph.glsl"
+#include "skin.glsl"
+
+layout(binding = 0) uniform UniformBufferObject {
+    mat4 model;
+    mat4 view;
+    mat4 proj;
+    mat4 lightViewProj;
+} ubo;
+
+layout(location = 0) in vec3 inPosition;
+
+void main() {
+    vec3 position = inPosition;
+    // The shadow only needs the position, the rest are thrown away
+    vec3 normal = vec3(0.0);
+    vec3 tangent = vec3(0.0);
+    morph(position, normal, tangent);
+    gl_Position = ubo.lightViewProj * ubo.model * skinMatrix() * vec4(position, 1.0);
+}
@@ -0,0 +1,11 @@
+#version 450
+
+layout(binding = 0) uniform samplerCube sky;
+
+layout(location = 0) in vec3 fragDirection;
+
+layout(location = 0) out vec4 outColor;
+
+void main() {
+    outColor = vec4(texture(sky, fragDirection).rgb, 1.0);
+}
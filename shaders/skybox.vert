@@ -0,0 +1,32 @@
+#version 450
+
+// The view and projection, without the view's translation so the sky stays
+// put as the camera moves
+layout(push_constant) uniform SkyboxConstants {
+    mat4 viewProj;
+} constants;
+
+layout(location = 0) out vec3 fragDirection;
+
+// A unit cube as 12 triangles facing inwards, drawn without a vertex buffer
+const vec3 corners[8] = vec3[](
+    vec3(-1, -1, -1), vec3(1, -1, -1), vec3(1, 1, -1), vec3(-1, 1, -1),
+    vec3(-1, -1, 1), vec3(1, -1, 1), vec3(1, 1, 1), vec3(-1, 1, 1)
+);
+const int indices[36] = int[](
+    0, 1, 2, 2, 3, 0,
+    5, 4, 7, 7, 6, 5,
+    4, 0, 3, 3, 7, 4,
+    1, 5, 6, 6, 2, 1,
+    3, 2, 6, 6, 7, 3,
+    4, 5, 1, 1, 0, 4
+);
+
+void main() {
+    vec3 position = corners[indices[gl_VertexIndex]];
+    // Cube maps are Y up, the world is Z up
+    fragDirection = vec3(position.x, position.z, -position.y);
+    // z = w puts the sky on the far plane, so it only passes the depth test
+    // where nothing else was drawn
+    gl_Position = (constants.viewProj * vec4(position, 1.0)).xyww;
+}
@@ -0,0 +1,40 @@
+#version 450
+#extension GL_EXT_multiview : require
+
+layout(binding = 0) uniform UniformBufferObject {
+    mat4 model;
+    mat4 view;
+    mat4 proj;
+    mat4 lightViewProj;
+} ubo;
+
+// One view and projection per eye, the left's at index 0
+layout(binding = 2) uniform StereoViews {
+    mat4 view[2];
+    mat4 proj[2];
+} stereo;
+
+layout(location = 0) in vec3 inPosition;
+layout(location = 1) in vec3 inColor;
+layout(location = 2) in vec2 inTexCoord;
+layout(location = 3) in vec3 inNormal;
+layout(location = 4) in vec4 inTangent;
+
+layout(location = 0) out vec3 fragColor;
+layout(location = 1) out vec2 fragTexCoord;
+layout(location = 2) out vec4 fragLightPos;
+layout(location = 3) out vec3 fragWorldPos;
+layout(location = 4) out vec3 fragNormal;
+layout(location = 5) out vec4 fragTangent;
+
+void main() {
+    vec4 world = ubo.model * vec4(inPosition, 1.0);
+    gl_Position = stereo.proj[gl_ViewIndex] * stereo.view[gl_ViewIndex] * world;
+    fragLightPos = ubo.lightViewProj * world;
+    fragWorldPos = world.xyz;
+    fragNormal = mat3(ubo.model) * inNormal;
+    fragTangent = vec4(mat3(ubo.model) * inTangent.xyz, inTangent.w);
+    fragColor = inColor;
+    fragTexCoord = inTexCoord;
+    gl_PointSize = 1.0;
+}
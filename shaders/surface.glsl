@@ -0,0 +1,22 @@
+// The Surface both material.glsl and bindless.glsl sample a material into.
+
+// Surface is the material at a fragment with its textures applied.
+struct Surface {
+    vec4 baseColor;
+    vec3 normal;
+    float metallic;
+    float roughness;
+    float occlusion;
+    vec3 emissive;
+};
+
+// bendNormal bends the interpolated normal by a tangent space normal map
+// texel scaled in XY by normalScale.
+vec3 bendNormal(vec3 normal, vec4 tangent, vec3 texel, float normalScale) {
+    vec3 N = normalize(normal);
+    vec3 T = normalize(tangent.xyz - N * dot(N, tangent.xyz));
+    vec3 B = cross(N, T) * tangent.w;
+    vec3 n = texel * 2.0 - 1.0;
+    n.xy *= normalScale;
+    return normalize(mat3(T, B, N) * n);
+}
@@ -0,0 +1,24 @@
+#version 450
+
+// The atlas is a signed distance field, 0.5 at a glyph's edge
+layout(binding = 0) uniform sampler2D atlas;
+
+layout(location = 0) in vec4 fragColor;
+layout(location = 1) in vec2 fragTexCoord;
+
+layout(location = 0) out vec4 outColor;
+
+// outlineWidth is how far the dark outline reaches past the edge, in
+// distance field units.
+const float outlineWidth = 0.2;
+
+void main() {
+    float distance = texture(atlas, fragTexCoord).r;
+    // Antialias over about a pixel whatever size the text is drawn at
+    float width = fwidth(distance);
+    float fill = smoothstep(0.5 - width, 0.5 + width, distance);
+    float outline = smoothstep(0.5 - outlineWidth - width, 0.5 - outlineWidth + width, distance);
+
+    vec3 color = fragColor.rgb * fill;
+    outColor = vec4(color, fragColor.a * outline);
+}
@@ -0,0 +1,19 @@
+#version 450
+
+layout(push_constant) uniform Transform {
+    vec2 scale;
+    vec2 translate;
+} transform;
+
+layout(location = 0) in vec2 inPosition;
+layout(location = 1) in vec2 inTexCoord;
+layout(location = 2) in vec4 inColor;
+
+layout(location = 0) out vec4 fragColor;
+layout(location = 1) out vec2 fragTexCoord;
+
+void main() {
+    gl_Position = vec4(inPosition * transform.scale + transform.translate, 0.0, 1.0);
+    fragColor = inColor;
+    fragTexCoord = inTexCoord;
+}
@@ -0,0 +1,12 @@
+#version 450
+
+layout(binding = 0) uniform sampler2D fontSampler;
+
+layout(location = 0) in vec4 fragColor;
+layout(location = 1) in vec2 fragTexCoord;
+
+layout(location = 0) out vec4 outColor;
+
+void main() {
+    outColor = fragColor * texture(fontSampler, fragTexCoord);
+}
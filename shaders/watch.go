@@ -0,0 +1,195 @@
+package shaders
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// sourceExtensions are the GLSL stage extensions glslangValidator infers the
+// stage from.
+var sourceExtensions = map[string]bool{
+	".vert":  true,
+	".frag":  true,
+	".geom":  true,
+	".comp":  true,
+	".tesc":  true,
+	".tese":  true,
+	".rgen":  true,
+	".rmiss": true,
+	".rchit": true,
+	".rahit": true,
+	".rint":  true,
+	".task":  true,
+	".mesh":  true,
+}
+
+// spirv14Extensions are the stages that have to be compiled for SPIR-V 1.4.
+var spirv14Extensions = map[string]bool{
+	".rgen":  true,
+	".rmiss": true,
+	".rchit": true,
+	".rahit": true,
+	".rint":  true,
+	".task":  true,
+	".mesh":  true,
+}
+
+// includeExtension is the extension of GLSL files that are only ever
+// #included by stage sources, never compiled on their own.
+const includeExtension = ".glsl"
+
+// Watcher watches a directory of GLSL sources with fsnotify and reports the
+// stage sources that change, including those #including a changed file.
+type Watcher struct {
+	dir     string
+	watcher *fsnotify.Watcher
+	changes chan string
+	done    chan struct{}
+}
+
+// Watch starts watching dir, nothing is reported until a file in it is
+// written or replaced.
+func Watch(dir string) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create file watcher")
+	}
+	if err := fw.Add(dir); err != nil {
+		fw.Close()
+		return nil, errors.Wrapf(err, "can't watch shader sources in '%s'", dir)
+	}
+
+	w := &Watcher{
+		dir:     dir,
+		watcher: fw,
+		changes: make(chan string, len(sourceExtensions)),
+		done:    make(chan struct{}),
+	}
+	go w.watch()
+	return w, nil
+}
+
+// Changes receives the path of each stage source that needs recompiling.
+func (w *Watcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Close stops watching.
+func (w *Watcher) Close() {
+	close(w.done)
+	w.watcher.Close()
+}
+
+func (w *Watcher) watch() {
+	for {
+		var event fsnotify.Event
+		select {
+		case <-w.done:
+			return
+		case event = <-w.watcher.Events:
+		case <-w.watcher.Errors:
+			continue
+		}
+
+		// Editors that save by renaming a temporary file over the source
+		// create it rather than write it
+		if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+			continue
+		}
+
+		var changed []string
+		switch ext := filepath.Ext(event.Name); {
+		case sourceExtensions[ext]:
+			changed = []string{event.Name}
+		case ext == includeExtension:
+			// Files can be mid save, the next write catches up
+			changed, _ = includers(w.dir, filepath.Base(event.Name))
+		}
+		for _, path := range changed {
+			select {
+			case w.changes <- path:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// includeDirective matches a GLSL #include of a quoted file.
+var includeDirective = regexp.MustCompile(`(?m)^\s*#\s*include\s+"([^"]+)"`)
+
+// includers are the stage sources in dir that #include name, directly or
+// through other included files.
+func includers(dir, name string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || !sourceExtensions[filepath.Ext(e.Name())] {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if includes(dir, path, name, map[string]bool{}) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// includes reports whether the file at path #includes name, following
+// includes relative to dir. seen stops include cycles.
+func includes(dir, path, name string, seen map[string]bool) bool {
+	if seen[path] {
+		return false
+	}
+	seen[path] = true
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for _, m := range includeDirective.FindAllSubmatch(source, -1) {
+		included := string(m[1])
+		if included == name || includes(dir, filepath.Join(dir, included), name, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile turns a GLSL source file into SPIR-V with glslangValidator, the
+// compiler output is part of the error when it fails.
+func Compile(path string) ([]byte, error) {
+	out, err := os.CreateTemp("", "*.spv")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create temporary SPIR-V file")
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	args := []string{"-V"}
+	if spirv14Extensions[filepath.Ext(path)] {
+		args = append(args, "--target-env", "spirv1.4")
+	}
+	cmd := exec.Command("glslangValidator", append(args, path, "-o", out.Name())...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if len(output) == 0 {
+			return nil, errors.Wrapf(err, "can't compile '%s'", path)
+		}
+		return nil, errors.Errorf("can't compile '%s': %v\n%s", path, err, output)
+	}
+
+	spirv, err := os.ReadFile(out.Name())
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read compiled '%s'", path)
+	}
+	return spirv, nil
+}
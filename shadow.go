@@ -0,0 +1,297 @@
+package main
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/renderpass"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// shadowMapSize is the width and height of each window's shadow map.
+const shadowMapSize = 2048
+
+// shadowBinding is the binding of the shadow map in shader.frag.
+const shadowBinding = 1
+
+// defaultLightDirection shines down and across the scene so objects shadow
+// their neighbours.
+var defaultLightDirection = vmath.Vec3{-0.4, -0.6, -1}
+
+// ShadowBias pushes the shadow map's depths away from the light so surfaces
+// don't shadow themselves, Constant in units of the depth format's precision
+// and Slope scaled by how steeply the surface faces away from the light.
+type ShadowBias struct {
+	Constant float32
+	Slope    float32
+}
+
+var defaultShadowBias = ShadowBias{Constant: 1.25, Slope: 1.75}
+
+func (app *HelloTriangleApplication) lightDirection() vmath.Vec3 {
+	if app.LightDirection == (vmath.Vec3{}) {
+		return defaultLightDirection.Normalize()
+	}
+	return app.LightDirection.Normalize()
+}
+
+// shadowVertexShader is the name and embedded SPIR-V of the vertex shader
+// the shadow pipeline uses, matching vertexShader.
+func (app *HelloTriangleApplication) shadowVertexShader() (string, []byte) {
+	if app.instanced() {
+		return "shadowinstanced.vert", shaders.ShadowInstanced()
+	}
+	if app.skinned() {
+		return "skinnedshadow.vert", shaders.SkinnedShadow()
+	}
+	return "shadow.vert", shaders.Shadow()
+}
+
+// sceneRadius bounds every object around the origin.
+func (app *HelloTriangleApplication) sceneRadius() float32 {
+	side := math.Ceil(math.Sqrt(float64(app.objectCount())))
+	grid := float32(side-1) / 2 * objectGridSpacing * math.Sqrt2
+	return grid + app.mesh.Radius
+}
+
+// lightViewProj looks along the light's direction with an orthographic
+// projection that just takes in the whole scene, so none of the shadow map
+// is wasted.
+func (app *HelloTriangleApplication) lightViewProj() vmath.Mat4 {
+	radius := app.sceneRadius()
+	direction := app.lightDirection()
+	up := vmath.Vec3{0, 0, 1}
+	if math.Abs(float64(direction[2])) > 0.99 {
+		up = vmath.Vec3{0, 1, 0}
+	}
+	view := vmath.LookAt(direction.Mul(-2*radius), vmath.Vec3{}, up)
+	proj := vmath.Ortho(-radius, radius, -radius, radius, radius, 3*radius)
+	return proj.Mul(view)
+}
+
+// createShadowSampler creates the comparison sampler shader.frag reads the
+// shadow map through. Where the device can filter the depth format the four
+// nearest comparisons are blended, softening the shadows' edges.
+func (app *HelloTriangleApplication) createShadowSampler() error {
+	var properties vk.FormatProperties
+	vk.GetPhysicalDeviceFormatProperties(app.physicalDevice, app.depthFormat, &properties)
+	properties.Deref()
+	if properties.OptimalTilingFeatures&vk.FormatFeatureFlags(vk.FormatFeatureSampledImageBit) == 0 {
+		return errors.New("depth format can't be sampled for shadows")
+	}
+	filter := vk.FilterNearest
+	if properties.OptimalTilingFeatures&vk.FormatFeatureFlags(vk.FormatFeatureSampledImageFilterLinearBit) != 0 {
+		filter = vk.FilterLinear
+	}
+
+	samplerInfo := &vk.SamplerCreateInfo{
+		SType:        vk.StructureTypeSamplerCreateInfo,
+		MagFilter:    filter,
+		MinFilter:    filter,
+		AddressModeU: vk.SamplerAddressModeClampToBorder,
+		AddressModeV: vk.SamplerAddressModeClampToBorder,
+		AddressModeW: vk.SamplerAddressModeClampToBorder,
+		// Beyond the map is as far as can be, so lit
+		BorderColor:   vk.BorderColorFloatOpaqueWhite,
+		CompareEnable: vk.True,
+		CompareOp:     vk.CompareOpLessOrEqual,
+		MipmapMode:    vk.SamplerMipmapModeNearest,
+	}
+
+	var sampler vk.Sampler
+	if err := vk.Error(vk.CreateSampler(app.device, samplerInfo, nil, &sampler)); err != nil {
+		return errors.Wrap(err, "can't create shadow sampler")
+	}
+	app.track("sampler", sampler)
+	app.shadowSampler = sampler
+	return nil
+}
+
+// createShadowResources creates the current window's shadow map along with
+// the depth only render pass and framebuffer that draw into it. None of it
+// depends on the swapchain.
+func (app *HelloTriangleApplication) createShadowResources() error {
+	img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:   shadowMapSize,
+		Height:  shadowMapSize,
+		Samples: vk.SampleCount1Bit,
+		Format:  app.depthFormat,
+		Tiling:  vk.ImageTilingOptimal,
+		Usage:   vk.ImageUsageFlags(vk.ImageUsageDepthStencilAttachmentBit | vk.ImageUsageSampledBit),
+		Aspect:  vk.ImageAspectFlags(vk.ImageAspectDepthBit),
+		Memory:  memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create shadow map")
+	}
+	app.shadowMap = img
+	app.name(img.Handle, "shadow map")
+
+	b := renderpass.NewBuilder()
+	depth := b.Attachment(renderpass.DepthOnlyAttachment(app.depthFormat, vk.ImageLayoutShaderReadOnlyOptimal))
+	b.Subpass(renderpass.Subpass{Depth: renderpass.Ref(depth)})
+	for _, dep := range renderpass.DepthOnlyDependencies() {
+		b.Dependency(dep)
+	}
+	renderPass, err := b.Build(app.device)
+	if err != nil {
+		return errors.Wrap(err, "can't build shadow render pass")
+	}
+	app.shadowRenderPass = renderPass
+
+	framebufferInfo := &vk.FramebufferCreateInfo{
+		SType:           vk.StructureTypeFramebufferCreateInfo,
+		RenderPass:      app.shadowRenderPass,
+		AttachmentCount: 1,
+		PAttachments:    []vk.ImageView{app.shadowMap.View},
+		Width:           shadowMapSize,
+		Height:          shadowMapSize,
+		Layers:          1,
+	}
+	var framebuffer vk.Framebuffer
+	if err := vk.Error(vk.CreateFramebuffer(app.device, framebufferInfo, nil, &framebuffer)); err != nil {
+		return errors.Wrap(err, "can't create shadow framebuffer")
+	}
+	app.track("framebuffer", framebuffer)
+	app.shadowFramebuffer = framebuffer
+	return nil
+}
+
+// createShadowPipeline creates the depth only pipeline drawing the scene
+// from the light. It shares the graphics pipeline's layout and vertex
+// input, shadow.vert only reading the position. The depth bias is dynamic so
+// the UI can tune it without rebuilding the pipeline.
+func (app *HelloTriangleApplication) createShadowPipeline(bindings []vk.VertexInputBindingDescription, attributes []vk.VertexInputAttributeDescription) error {
+	vertShaderModule, err := app.createShaderModule(app.shaderCode(app.shadowVertexShader()))
+	if err != nil {
+		return errors.Wrap(err, "can't create shadow vertex shader")
+	}
+	defer vk.DestroyShaderModule(app.device, vertShaderModule, nil)
+
+	dynamicStates := []vk.DynamicState{vk.DynamicStateDepthBias}
+	pipelineInfos := []vk.GraphicsPipelineCreateInfo{{
+		SType:      vk.StructureTypeGraphicsPipelineCreateInfo,
+		StageCount: 1,
+		PStages: []vk.PipelineShaderStageCreateInfo{{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageVertexBit,
+			Module: vertShaderModule,
+			PName:  "main\x00",
+		}},
+		PVertexInputState: &vk.PipelineVertexInputStateCreateInfo{
+			SType:                           vk.StructureTypePipelineVertexInputStateCreateInfo,
+			VertexBindingDescriptionCount:   uint32(len(bindings)),
+			PVertexBindingDescriptions:      bindings,
+			VertexAttributeDescriptionCount: uint32(len(attributes)),
+			PVertexAttributeDescriptions:    attributes,
+		},
+		PInputAssemblyState: &vk.PipelineInputAssemblyStateCreateInfo{
+			SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+			Topology: vk.PrimitiveTopologyTriangleList,
+		},
+		PViewportState: &vk.PipelineViewportStateCreateInfo{
+			SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+			ViewportCount: 1,
+			PViewports: []vk.Viewport{{
+				Width:    shadowMapSize,
+				Height:   shadowMapSize,
+				MinDepth: 0,
+				MaxDepth: 1,
+			}},
+			ScissorCount: 1,
+			PScissors:    []vk.Rect2D{{Extent: vk.Extent2D{Width: shadowMapSize, Height: shadowMapSize}}},
+		},
+		// Both sides cast shadows, the quad only has one
+		PRasterizationState: &vk.PipelineRasterizationStateCreateInfo{
+			SType:           vk.StructureTypePipelineRasterizationStateCreateInfo,
+			PolygonMode:     vk.PolygonModeFill,
+			LineWidth:       1,
+			CullMode:        vk.CullModeFlags(vk.CullModeNone),
+			FrontFace:       vk.FrontFaceCounterClockwise,
+			DepthBiasEnable: vk.True,
+		},
+		PMultisampleState: &vk.PipelineMultisampleStateCreateInfo{
+			SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+			RasterizationSamples: vk.SampleCount1Bit,
+			MinSampleShading:     1,
+		},
+		PDepthStencilState: &vk.PipelineDepthStencilStateCreateInfo{
+			SType:            vk.StructureTypePipelineDepthStencilStateCreateInfo,
+			DepthTestEnable:  vk.True,
+			DepthWriteEnable: vk.True,
+			DepthCompareOp:   vk.CompareOpLess,
+		},
+		PColorBlendState: &vk.PipelineColorBlendStateCreateInfo{
+			SType: vk.StructureTypePipelineColorBlendStateCreateInfo,
+		},
+		PDynamicState: &vk.PipelineDynamicStateCreateInfo{
+			SType:             vk.StructureTypePipelineDynamicStateCreateInfo,
+			DynamicStateCount: uint32(len(dynamicStates)),
+			PDynamicStates:    dynamicStates,
+		},
+		Layout:            app.pipelineLayout,
+		RenderPass:        app.shadowRenderPass,
+		Subpass:           0,
+		BasePipelineIndex: -1,
+	}}
+
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, 1, pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create shadow pipeline")
+	}
+	app.track("pipeline", pipelines[0])
+	app.shadowPipeline = pipelines[0]
+	app.name(app.shadowPipeline, "shadow pipeline")
+	return nil
+}
+
+// recordShadows draws every object into the shadow map from the light,
+// leaving it ready for the render pass to sample.
+func (app *HelloTriangleApplication) recordShadows(cb vk.CommandBuffer, frame int) {
+	renderPassInfo := &vk.RenderPassBeginInfo{
+		SType:       vk.StructureTypeRenderPassBeginInfo,
+		RenderPass:  app.shadowRenderPass,
+		Framebuffer: app.shadowFramebuffer,
+		RenderArea: vk.Rect2D{
+			Extent: vk.Extent2D{Width: shadowMapSize, Height: shadowMapSize},
+		},
+		ClearValueCount: 1,
+		PClearValues:    []vk.ClearValue{vk.NewClearDepthStencil(1, 0)},
+	}
+	scope := app.profiler.Begin(cb, "shadows")
+	vk.CmdBeginRenderPass(cb, renderPassInfo, vk.SubpassContentsInline)
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.shadowPipeline)
+	vk.CmdSetDepthBias(cb, app.shadowBias.Constant, 0, app.shadowBias.Slope)
+	app.drawObjects(cb, frame, 0, app.mesh.IndexCount, false, false)
+	vk.CmdEndRenderPass(cb)
+	scope.End(cb)
+}
+
+func (app *HelloTriangleApplication) destroyShadowPipeline() {
+	if app.shadowPipeline != vk.NullPipeline {
+		app.destroyPipeline(app.shadowPipeline)
+		app.shadowPipeline = vk.NullPipeline
+	}
+}
+
+// destroyShadowResources destroys the current window's shadow map, render
+// pass and framebuffer.
+func (app *HelloTriangleApplication) destroyShadowResources() {
+	if app.shadowFramebuffer != vk.NullFramebuffer {
+		app.release(app.shadowFramebuffer)
+		vk.DestroyFramebuffer(app.device, app.shadowFramebuffer, nil)
+		app.shadowFramebuffer = vk.NullFramebuffer
+	}
+	if app.shadowRenderPass != vk.NullRenderPass {
+		vk.DestroyRenderPass(app.device, app.shadowRenderPass, nil)
+		app.shadowRenderPass = vk.NullRenderPass
+	}
+	if app.shadowMap != nil {
+		app.shadowMap.Destroy()
+		app.shadowMap = nil
+	}
+}
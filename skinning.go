@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/animation"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/models"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/inkyblackness/imgui-go/v4"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// jointsBinding is the binding of skin.glsl's joint matrices in set 0.
+	jointsBinding = 4
+	// skinVerticesBinding is the binding of its SkinVertices.
+	skinVerticesBinding = 5
+	// morphVerticesBinding, morphDeltasBinding and morphWeightsBinding
+	// are the bindings of morph.glsl's buffers.
+	morphVerticesBinding = 6
+	morphDeltasBinding   = 7
+	morphWeightsBinding  = 8
+	// crossFadeSeconds is how long the animation window takes to fade
+	// from one clip to another.
+	crossFadeSeconds = 0.3
+)
+
+// SkinVertex is a vertex's joints and their weights, matching skin.glsl's
+// std430 SkinVertex. They're kept out of Vertex so the pipelines drawing
+// the bind pose don't need to know about them.
+type SkinVertex struct {
+	Joints  [4]uint32
+	Weights [4]float32
+}
+
+// MorphVertex is where a vertex finds its morph targets, matching
+// morph.glsl's MorphVertices. First is its first MorphDelta, Count how many
+// targets there are and Weights the first of their weights.
+type MorphVertex struct {
+	First   uint32
+	Count   uint32
+	Weights uint32
+	_       uint32
+}
+
+// MorphDelta is how far a morph target moves a vertex at a weight of one,
+// matching morph.glsl's std430 MorphDelta. W is unused.
+type MorphDelta struct {
+	Position [4]float32
+	Normal   [4]float32
+	Tangent  [4]float32
+}
+
+var (
+	// yUpToZUpMatrix turns glTF's Y up into the scene's Z up like
+	// yUpToZUp, zUpToYUpMatrix back again.
+	yUpToZUpMatrix = vmath.Rotate(vmath.Radians(90), vmath.Vec3{1, 0, 0})
+	zUpToYUpMatrix = yUpToZUpMatrix.Transpose()
+)
+
+// loadModel reads a glTF model ahead of the meshes being created from it, so
+// the vertex shader is known to be skinned before the descriptor set layout
+// is made from its bindings. A model with joints or morph targets gets a
+// player looping its first clip, unless it's instanced, which draws the
+// bind pose.
+func (app *HelloTriangleApplication) loadModel() error {
+	switch strings.ToLower(filepath.Ext(app.ModelPath)) {
+	case ".gltf", ".glb":
+	default:
+		return nil
+	}
+	model, err := models.LoadGLTF(app.ModelPath)
+	if err != nil {
+		return errors.Wrapf(err, "can't load '%s'", app.ModelPath)
+	}
+	app.gltfModel = model
+
+	if model.Skeleton == nil || (len(model.Skeleton.Joints) == 0 && len(model.Morphs) == 0) || app.instanced() {
+		return nil
+	}
+	app.animator = animation.NewPlayer(model.Skeleton)
+	app.clips = model.Clips
+	if len(app.clips) > 0 {
+		app.animator.Play(app.clips[0])
+	}
+	var weights int
+	app.morphOffsets = make([]int, len(model.Skeleton.Nodes))
+	for i, n := range model.Skeleton.Nodes {
+		app.morphOffsets[i] = weights
+		weights += len(n.Weights)
+	}
+	// Storage buffers can't be empty, there's a spare joint and weight for
+	// models that only skin or only morph
+	app.jointMatrices = make([]vmath.Mat4, len(model.Skeleton.Joints)+1)
+	app.morphWeights = make([]float32, weights+1)
+	app.animate(0)
+	app.logger.Info("Loaded skeleton",
+		logging.F("joints", len(model.Skeleton.Joints)),
+		logging.F("morphs", len(model.Morphs)),
+		logging.F("clips", len(app.clips)),
+	)
+	return nil
+}
+
+// skinned is whether the mesh is drawn with skinned.vert, which morphs and
+// skins it.
+func (app *HelloTriangleApplication) skinned() bool {
+	return app.animator != nil
+}
+
+// createSkin uploads the joints and weights and morph targets of the
+// model's vertices, in the order the vertex buffer has them, when it's
+// skinned.
+func (app *HelloTriangleApplication) createSkin(model *models.Model) error {
+	if !app.skinned() {
+		return nil
+	}
+	skin := make([]SkinVertex, len(model.Vertices))
+	for i, v := range model.Vertices {
+		skin[i] = SkinVertex{Joints: v.Joints, Weights: v.Weights}
+	}
+
+	// Each morphed vertex's deltas are together, a target after another
+	morphs := make([]MorphVertex, len(model.Vertices))
+	deltas := []MorphDelta{{}}
+	toZUp := func(v [3]float32) [4]float32 {
+		return yUpToZUpMatrix.MulVec4(vmath.Vec3(v).Vec4(0))
+	}
+	for _, m := range model.Morphs {
+		for i := uint32(0); i < m.VertexCount; i++ {
+			morphs[m.FirstVertex+i] = MorphVertex{
+				First:   uint32(len(deltas)),
+				Count:   uint32(len(m.Targets)),
+				Weights: uint32(app.morphOffsets[m.Node]),
+			}
+			for _, t := range m.Targets {
+				d := MorphDelta{Position: toZUp(t.Positions[i])}
+				if t.Normals != nil {
+					d.Normal = toZUp(t.Normals[i])
+				}
+				if t.Tangents != nil {
+					d.Tangent = toZUp(t.Tangents[i])
+				}
+				deltas = append(deltas, d)
+			}
+		}
+	}
+
+	var err error
+	ctx := app.meshContext()
+	if app.skinVertices, err = gpu.NewStorageBuffer(ctx, skin); err != nil {
+		return errors.Wrap(err, "can't upload skin vertices")
+	}
+	app.name(app.skinVertices.Handle, "skin vertices")
+	if app.morphVertices, err = gpu.NewStorageBuffer(ctx, morphs); err != nil {
+		return errors.Wrap(err, "can't upload morph vertices")
+	}
+	app.name(app.morphVertices.Handle, "morph vertices")
+	if app.morphDeltas, err = gpu.NewStorageBuffer(ctx, deltas); err != nil {
+		return errors.Wrap(err, "can't upload morph deltas")
+	}
+	app.name(app.morphDeltas.Handle, "morph deltas")
+	return nil
+}
+
+// animate advances the playing clips dt seconds and poses the joints, in
+// the scene's Z up world, and the morph target weights.
+func (app *HelloTriangleApplication) animate(dt float32) {
+	if app.animator == nil {
+		return
+	}
+	app.animator.Update(dt)
+	app.animator.JointMatrices(app.jointMatrices)
+	for i, m := range app.jointMatrices {
+		app.jointMatrices[i] = yUpToZUpMatrix.Mul(m).Mul(zUpToYUpMatrix)
+	}
+	for i, w := range app.animator.Weights() {
+		copy(app.morphWeights[app.morphOffsets[i]:], w)
+	}
+}
+
+// createPoseBuffers creates a host visible buffer of joint matrices and one
+// of morph target weights per frame in flight when skinned.
+func (app *HelloTriangleApplication) createPoseBuffers() error {
+	if !app.skinned() {
+		return nil
+	}
+	frames := app.framesInFlight()
+	usage := vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit)
+	jointsSize := vk.DeviceSize(len(app.jointMatrices)) * vk.DeviceSize(unsafe.Sizeof(vmath.Mat4{}))
+	weightsSize := vk.DeviceSize(len(app.morphWeights)) * vk.DeviceSize(unsafe.Sizeof(float32(0)))
+	app.jointBuffers = make([]*gpu.Buffer, 0, frames)
+	app.morphWeightBuffers = make([]*gpu.Buffer, 0, frames)
+	for i := 0; i < frames; i++ {
+		joints, err := gpu.NewBuffer(app.gpuContext(), jointsSize, usage, memory.CPUToGPU)
+		if err != nil {
+			return errors.Wrapf(err, "can't create joint buffer for frame %d", i)
+		}
+		app.name(joints.Handle, "joints %d", i)
+		app.jointBuffers = append(app.jointBuffers, joints)
+
+		weights, err := gpu.NewBuffer(app.gpuContext(), weightsSize, usage, memory.CPUToGPU)
+		if err != nil {
+			return errors.Wrapf(err, "can't create morph weight buffer for frame %d", i)
+		}
+		app.name(weights.Handle, "morph weights %d", i)
+		app.morphWeightBuffers = append(app.morphWeightBuffers, weights)
+	}
+	return nil
+}
+
+// skinWrites points the frame sets at frame's pose and the skin and morph
+// vertices when skinned.
+func (app *HelloTriangleApplication) skinWrites(frame int, set vk.DescriptorSet) []vk.WriteDescriptorSet {
+	if app.jointBuffers == nil {
+		return nil
+	}
+	buffers := map[uint32]*gpu.Buffer{
+		jointsBinding:        app.jointBuffers[frame],
+		skinVerticesBinding:  app.skinVertices,
+		morphVerticesBinding: app.morphVertices,
+		morphDeltasBinding:   app.morphDeltas,
+		morphWeightsBinding:  app.morphWeightBuffers[frame],
+	}
+	var writes []vk.WriteDescriptorSet
+	for _, binding := range []uint32{jointsBinding, skinVerticesBinding, morphVerticesBinding, morphDeltasBinding, morphWeightsBinding} {
+		writes = append(writes, vk.WriteDescriptorSet{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      binding,
+			DescriptorType:  vk.DescriptorTypeStorageBuffer,
+			DescriptorCount: 1,
+			PBufferInfo: []vk.DescriptorBufferInfo{{
+				Buffer: buffers[binding].Handle,
+				Offset: 0,
+				Range:  buffers[binding].Size,
+			}},
+		})
+	}
+	return writes
+}
+
+// updatePose uploads the posed joints and morph target weights for frame.
+func (app *HelloTriangleApplication) updatePose(frame int) error {
+	if app.jointBuffers == nil {
+		return nil
+	}
+	joints := unsafe.Slice((*byte)(unsafe.Pointer(&app.jointMatrices[0])), len(app.jointMatrices)*int(unsafe.Sizeof(vmath.Mat4{})))
+	if err := app.jointBuffers[frame].Upload(joints); err != nil {
+		return errors.Wrap(err, "can't write joints")
+	}
+	return errors.Wrap(app.morphWeightBuffers[frame].Upload(floatBytes(app.morphWeights)), "can't write morph weights")
+}
+
+func (app *HelloTriangleApplication) destroyPoseBuffers() {
+	for _, b := range append(app.jointBuffers, app.morphWeightBuffers...) {
+		b.Destroy()
+	}
+	app.jointBuffers = nil
+	app.morphWeightBuffers = nil
+}
+
+func (app *HelloTriangleApplication) destroySkin() {
+	for _, b := range []*gpu.Buffer{app.skinVertices, app.morphVertices, app.morphDeltas} {
+		if b != nil {
+			b.Destroy()
+		}
+	}
+	app.skinVertices = nil
+	app.morphVertices = nil
+	app.morphDeltas = nil
+}
+
+// animationUI is the window for switching between the model's clips, which
+// cross-fade into each other, and adjusting the tracks playing.
+func (app *HelloTriangleApplication) animationUI() {
+	if app.animator == nil {
+		return
+	}
+	imgui.Begin("Animation")
+	for i, clip := range app.clips {
+		if imgui.Button(fmt.Sprintf("%s###clip%d", clip.Name, i)) {
+			app.animator.CrossFade(clip, crossFadeSeconds)
+		}
+	}
+	if len(app.clips) == 0 {
+		imgui.Text("The model has no clips")
+	}
+
+	var stop *animation.Track
+	for i, t := range app.animator.Tracks() {
+		imgui.PushID(fmt.Sprint(i))
+		imgui.Separator()
+		imgui.Text(fmt.Sprintf("%s %.2f/%.2fs", t.Clip.Name, t.Time, t.Clip.Duration))
+		imgui.SliderFloat("Weight", &t.Weight, 0, 1)
+		imgui.SliderFloat("Speed", &t.Speed, -2, 2)
+		imgui.Checkbox("Loop", &t.Loop)
+		if imgui.Button("Stop") {
+			stop = t
+		}
+		imgui.PopID()
+	}
+	if stop != nil {
+		app.animator.Stop(stop)
+	}
+	imgui.End()
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/hdr"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// skyboxVertices is the 12 triangles of the cube skybox.vert draws.
+	skyboxVertices = 36
+	// equirectGroupSize is equirect.comp's local size in x and y.
+	equirectGroupSize = 8
+	// skyboxFormat holds HDR skies, it's storable and linearly filterable
+	// everywhere.
+	skyboxFormat = vk.FormatR16g16b16a16Sfloat
+)
+
+// skyboxFaces are the file names, without extension, of a skybox
+// directory's faces in cube layer order.
+var skyboxFaces = []string{"px", "nx", "py", "ny", "pz", "nz"}
+
+// skyboxFaceExtensions are tried in order for each face.
+var skyboxFaceExtensions = []string{".png", ".jpg", ".jpeg"}
+
+// SkyboxConstants is pushed once per skybox draw, matching the push_constant
+// block in skybox.vert.
+type SkyboxConstants struct {
+	ViewProj vmath.Mat4
+}
+
+var skyboxConstants = pipeline.NewPushConstants[SkyboxConstants](vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0)
+
+// createSkybox loads the Skybox option's cube map and creates the layouts
+// every window's skybox pipeline shares. Uploads are recorded, they finish
+// with the rest in finishUploads.
+func (app *HelloTriangleApplication) createSkybox() error {
+	if app.Skybox == "" {
+		return nil
+	}
+
+	if err := app.createSkyboxSampler(); err != nil {
+		return err
+	}
+
+	var err error
+	if strings.EqualFold(filepath.Ext(app.Skybox), ".hdr") {
+		err = app.loadEquirectSkybox(app.Skybox)
+	} else {
+		err = app.loadSkyboxFaces(app.Skybox)
+	}
+	if err != nil {
+		return err
+	}
+	app.name(app.skyboxImage.Handle, "skybox '%s'", app.Skybox)
+
+	vert, err := spirv.Reflect(app.shaderCode("skybox.vert", shaders.SkyboxVert()))
+	if err != nil {
+		return errors.Wrap(err, "can't reflect skybox vertex shader")
+	}
+	frag, err := spirv.Reflect(app.shaderCode("skybox.frag", shaders.SkyboxFrag()))
+	if err != nil {
+		return errors.Wrap(err, "can't reflect skybox fragment shader")
+	}
+	bindings, err := pipeline.MergeBindings(vert, frag)
+	if err != nil {
+		return err
+	}
+	layouts, err := pipeline.NewSetLayouts(app.device, bindings)
+	if err != nil {
+		return err
+	}
+	if len(layouts) != 1 {
+		for _, l := range layouts {
+			vk.DestroyDescriptorSetLayout(app.device, l, nil)
+		}
+		return errors.Errorf("skybox shaders use %d descriptor sets, expected 1", len(layouts))
+	}
+	app.skyboxSetLayout = layouts[0]
+
+	layout, err := pipeline.NewLayout(app.device, layouts, []vk.PushConstantRange{skyboxConstants.Range()})
+	if err != nil {
+		return err
+	}
+	app.skyboxPipelineLayout = layout
+	return nil
+}
+
+// createSkyboxSampler creates the sampler for the skybox, clamping so face
+// edges don't wrap around to the opposite side.
+func (app *HelloTriangleApplication) createSkyboxSampler() error {
+	samplerInfo := &vk.SamplerCreateInfo{
+		SType:        vk.StructureTypeSamplerCreateInfo,
+		MagFilter:    vk.FilterLinear,
+		MinFilter:    vk.FilterLinear,
+		AddressModeU: vk.SamplerAddressModeClampToEdge,
+		AddressModeV: vk.SamplerAddressModeClampToEdge,
+		AddressModeW: vk.SamplerAddressModeClampToEdge,
+		BorderColor:  vk.BorderColorFloatOpaqueBlack,
+		CompareOp:    vk.CompareOpAlways,
+		MipmapMode:   vk.SamplerMipmapModeLinear,
+		MaxLod:       vk.LodClampNone,
+	}
+	if err := vk.Error(vk.CreateSampler(app.device, samplerInfo, nil, &app.skyboxSampler)); err != nil {
+		return errors.Wrap(err, "can't create skybox sampler")
+	}
+	app.track("sampler", app.skyboxSampler)
+	return nil
+}
+
+// loadSkyboxFaces loads six square images named after skyboxFaces from dir
+// into the layers of a cube map.
+func (app *HelloTriangleApplication) loadSkyboxFaces(dir string) error {
+	var pixels []byte
+	var size int
+	for _, face := range skyboxFaces {
+		path, err := findSkyboxFace(dir, face)
+		if err != nil {
+			return err
+		}
+		rgba, err := loadRGBA(path)
+		if err != nil {
+			return errors.Wrap(err, "can't load skybox face")
+		}
+		width, height := rgba.Rect.Dx(), rgba.Rect.Dy()
+		if size == 0 {
+			size = width
+		}
+		if width != size || height != size {
+			return errors.Errorf("skybox face '%s' is %dx%d, every face has to be %dx%d", path, width, height, size, size)
+		}
+		pixels = append(pixels, rgba.Pix...)
+	}
+
+	img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:  uint32(size),
+		Height: uint32(size),
+		Cube:   true,
+		Format: vk.FormatR8g8b8a8Srgb,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create skybox image")
+	}
+	app.skyboxImage = img
+
+	if err := app.uploader.Image(img, pixels); err != nil {
+		return errors.Wrap(err, "can't stage skybox faces")
+	}
+	return app.uploader.Record(func(cb vk.CommandBuffer) {
+		img.CmdTransitionTo(cb, vk.ImageLayoutShaderReadOnlyOptimal)
+	})
+}
+
+func findSkyboxFace(dir, face string) (string, error) {
+	for _, ext := range skyboxFaceExtensions {
+		path := filepath.Join(dir, face+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.Errorf("no skybox face '%s' in '%s'", face, dir)
+}
+
+// loadEquirectSkybox projects the equirectangular panorama in an .hdr file
+// onto a cube map with equirect.comp. Each face gets a quarter of the
+// panorama's width, about what the panorama has per 90 degrees. The
+// conversion is waited for so its resources can go.
+func (app *HelloTriangleApplication) loadEquirectSkybox(path string) error {
+	panorama, err := hdr.Load(path)
+	if err != nil {
+		return errors.Wrap(err, "can't load skybox")
+	}
+
+	equirect, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:  uint32(panorama.Width),
+		Height: uint32(panorama.Height),
+		Format: skyboxFormat,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create equirectangular image")
+	}
+	defer equirect.Destroy()
+	if err := app.uploader.Image(equirect, halfFloatRGBA(panorama)); err != nil {
+		return errors.Wrap(err, "can't stage equirectangular image")
+	}
+
+	size := uint32(panorama.Width / 4)
+	if size == 0 {
+		size = 1
+	}
+	cube, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:  size,
+		Height: size,
+		Cube:   true,
+		Format: skyboxFormat,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageStorageBit | vk.ImageUsageSampledBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create skybox image")
+	}
+	app.skyboxImage = cube
+
+	code := app.shaderCode("equirect.comp", shaders.Equirect())
+	module, err := spirv.Reflect(code)
+	if err != nil {
+		return errors.Wrap(err, "can't reflect equirectangular conversion shader")
+	}
+	bindings, err := pipeline.MergeBindings(module)
+	if err != nil {
+		return err
+	}
+	setLayouts, err := pipeline.NewSetLayouts(app.device, bindings)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, l := range setLayouts {
+			vk.DestroyDescriptorSetLayout(app.device, l, nil)
+		}
+	}()
+	if len(setLayouts) != 1 {
+		return errors.Errorf("equirectangular conversion shader uses %d descriptor sets, expected 1", len(setLayouts))
+	}
+
+	layout, err := pipeline.NewLayout(app.device, setLayouts, nil)
+	if err != nil {
+		return err
+	}
+	defer vk.DestroyPipelineLayout(app.device, layout, nil)
+
+	compute, err := pipeline.NewCompute(app.device, layout, code)
+	if err != nil {
+		return errors.Wrap(err, "can't create equirectangular conversion pipeline")
+	}
+	defer vk.DestroyPipeline(app.device, compute, nil)
+
+	allocator := descriptors.NewAllocator(app.device, descriptors.Ratios(bindings), 1)
+	defer allocator.Destroy()
+	set, err := allocator.Allocate(setLayouts[0])
+	if err != nil {
+		return errors.Wrap(err, "can't allocate equirectangular conversion descriptor set")
+	}
+	writes := []vk.WriteDescriptorSet{
+		{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      0,
+			DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+			DescriptorCount: 1,
+			PImageInfo: []vk.DescriptorImageInfo{{
+				ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+				ImageView:   equirect.View,
+				Sampler:     app.skyboxSampler,
+			}},
+		},
+		{
+			SType:           vk.StructureTypeWriteDescriptorSet,
+			DstSet:          set,
+			DstBinding:      1,
+			DescriptorType:  vk.DescriptorTypeStorageImage,
+			DescriptorCount: 1,
+			PImageInfo: []vk.DescriptorImageInfo{{
+				ImageLayout: vk.ImageLayoutGeneral,
+				ImageView:   cube.View,
+			}},
+		},
+	}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+
+	groups := (size + equirectGroupSize - 1) / equirectGroupSize
+	if err := app.uploader.Record(func(cb vk.CommandBuffer) {
+		equirect.CmdTransitionTo(cb, vk.ImageLayoutShaderReadOnlyOptimal)
+		cube.CmdTransitionTo(cb, vk.ImageLayoutGeneral)
+		vk.CmdBindPipeline(cb, vk.PipelineBindPointCompute, compute)
+		vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointCompute, layout, 0, 1, []vk.DescriptorSet{set}, 0, nil)
+		vk.CmdDispatch(cb, groups, groups, 6)
+		cube.CmdTransitionTo(cb, vk.ImageLayoutShaderReadOnlyOptimal)
+	}); err != nil {
+		return errors.Wrap(err, "can't record equirectangular conversion")
+	}
+	return errors.Wrap(app.finishUploads(), "can't convert equirectangular image")
+}
+
+// halfFloatRGBA packs img's pixels as half float RGBA with opaque alpha,
+// half floats filter linearly on every device where 32 bit floats may not.
+func halfFloatRGBA(img *hdr.Image) []byte {
+	one := halfFloat(1)
+	out := make([]byte, img.Width*img.Height*8)
+	for i := 0; i < img.Width*img.Height; i++ {
+		texel := out[i*8 : i*8+8]
+		for c := 0; c < 3; c++ {
+			h := halfFloat(img.Pix[i*3+c])
+			texel[c*2], texel[c*2+1] = byte(h), byte(h>>8)
+		}
+		texel[6], texel[7] = byte(one), byte(one>>8)
+	}
+	return out
+}
+
+// halfFloat converts f to IEEE 754 half precision by truncating, flushing
+// values too small for it to zero and clamping ones too large to the
+// largest finite half.
+func halfFloat(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int(bits>>23&0xff) - 127 + 15
+	switch {
+	case exponent <= 0:
+		return sign
+	case exponent >= 31:
+		return sign | 0x7bff
+	}
+	return sign | uint16(exponent)<<10 | uint16(bits&0x7fffff>>13)
+}
+
+// createSkyboxSet points the current window's skybox descriptor set at the
+// cube map.
+func (app *HelloTriangleApplication) createSkyboxSet() error {
+	if app.skyboxImage == nil {
+		return nil
+	}
+	set, err := app.descriptorAllocator.Allocate(app.skyboxSetLayout)
+	if err != nil {
+		return errors.Wrap(err, "can't allocate skybox descriptor set")
+	}
+	writes := []vk.WriteDescriptorSet{{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          set,
+		DstBinding:      0,
+		DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+		DescriptorCount: 1,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+			ImageView:   app.skyboxImage.View,
+			Sampler:     app.skyboxSampler,
+		}},
+	}}
+	vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+	app.skyboxSet = set
+	return nil
+}
+
+// createSkyboxPipeline creates the current window's skybox pipeline. It
+// draws after the scene without writing depth, the sky being on the far
+// plane only passes LESS_OR_EQUAL where the depth buffer is still clear.
+func (app *HelloTriangleApplication) createSkyboxPipeline() error {
+	if app.skyboxImage == nil {
+		return nil
+	}
+
+	vertShaderModule, err := app.createShaderModule(app.shaderCode("skybox.vert", shaders.SkyboxVert()))
+	if err != nil {
+		return errors.Wrap(err, "can't create skybox vertex shader")
+	}
+	defer vk.DestroyShaderModule(app.device, vertShaderModule, nil)
+
+	fragShaderModule, err := app.createShaderModule(app.shaderCode("skybox.frag", shaders.SkyboxFrag()))
+	if err != nil {
+		return errors.Wrap(err, "can't create skybox fragment shader")
+	}
+	defer vk.DestroyShaderModule(app.device, fragShaderModule, nil)
+
+	subpass := uint32(0)
+	if app.Deferred {
+		subpass = lightingSubpass
+	}
+
+	extent := app.target.Extent
+	pipelineInfos := []vk.GraphicsPipelineCreateInfo{{
+		SType:      vk.StructureTypeGraphicsPipelineCreateInfo,
+		PNext:      app.sceneRendering.Pointer(),
+		StageCount: 2,
+		PStages: []vk.PipelineShaderStageCreateInfo{
+			{
+				SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+				Stage:  vk.ShaderStageVertexBit,
+				Module: vertShaderModule,
+				PName:  "main\x00",
+			},
+			{
+				SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+				Stage:  vk.ShaderStageFragmentBit,
+				Module: fragShaderModule,
+				PName:  "main\x00",
+			},
+		},
+		// The cube's corners are built into the vertex shader
+		PVertexInputState: &vk.PipelineVertexInputStateCreateInfo{
+			SType: vk.StructureTypePipelineVertexInputStateCreateInfo,
+		},
+		PInputAssemblyState: &vk.PipelineInputAssemblyStateCreateInfo{
+			SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+			Topology: vk.PrimitiveTopologyTriangleList,
+		},
+		PViewportState: &vk.PipelineViewportStateCreateInfo{
+			SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+			ViewportCount: 1,
+			PViewports: []vk.Viewport{{
+				Width:    float32(extent.Width),
+				Height:   float32(extent.Height),
+				MinDepth: 0,
+				MaxDepth: 1,
+			}},
+			ScissorCount: 1,
+			PScissors:    []vk.Rect2D{{Extent: extent}},
+		},
+		// The camera is inside the cube so there's nothing to cull
+		PRasterizationState: &vk.PipelineRasterizationStateCreateInfo{
+			SType:       vk.StructureTypePipelineRasterizationStateCreateInfo,
+			PolygonMode: vk.PolygonModeFill,
+			LineWidth:   1,
+			CullMode:    vk.CullModeFlags(vk.CullModeNone),
+			FrontFace:   vk.FrontFaceCounterClockwise,
+		},
+		PMultisampleState: &vk.PipelineMultisampleStateCreateInfo{
+			SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+			RasterizationSamples: app.msaaSamples,
+			MinSampleShading:     1,
+		},
+		PDepthStencilState: &vk.PipelineDepthStencilStateCreateInfo{
+			SType:            vk.StructureTypePipelineDepthStencilStateCreateInfo,
+			DepthTestEnable:  vk.True,
+			DepthWriteEnable: vk.False,
+			DepthCompareOp:   vk.CompareOpLessOrEqual,
+		},
+		PColorBlendState: &vk.PipelineColorBlendStateCreateInfo{
+			SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+			AttachmentCount: 1,
+			PAttachments: []vk.PipelineColorBlendAttachmentState{{
+				ColorWriteMask: vk.ColorComponentFlags(
+					vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit,
+				),
+			}},
+		},
+		Layout:            app.skyboxPipelineLayout,
+		RenderPass:        app.renderPass,
+		Subpass:           subpass,
+		BasePipelineIndex: -1,
+	}}
+
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, 1, pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create skybox pipeline")
+	}
+	app.track("pipeline", pipelines[0])
+	app.skyboxPipeline = pipelines[0]
+	app.name(app.skyboxPipeline, "skybox pipeline")
+	return nil
+}
+
+// recordSkybox draws the sky behind whatever's been drawn so far.
+func (app *HelloTriangleApplication) recordSkybox(cb vk.CommandBuffer) {
+	if app.skyboxPipeline == vk.NullPipeline {
+		return
+	}
+
+	// Only the view's rotation, the sky is infinitely far away
+	view := app.camera.View()
+	view[12], view[13], view[14] = 0, 0, 0
+	extent := app.target.Extent
+	proj := app.camera.Projection(float32(extent.Width) / float32(extent.Height))
+
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.skyboxPipeline)
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, app.skyboxPipelineLayout, 0,
+		1, []vk.DescriptorSet{app.skyboxSet}, 0, nil)
+	skyboxConstants.Push(cb, app.skyboxPipelineLayout, SkyboxConstants{ViewProj: proj.Mul(view)})
+	vk.CmdDraw(cb, skyboxVertices, 1, 0, 0)
+	app.countDraws(1)
+}
+
+func (app *HelloTriangleApplication) destroySkyboxPipeline() {
+	if app.skyboxPipeline != vk.NullPipeline {
+		app.destroyPipeline(app.skyboxPipeline)
+		app.skyboxPipeline = vk.NullPipeline
+	}
+}
+
+func (app *HelloTriangleApplication) destroySkybox() {
+	if app.skyboxPipelineLayout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(app.device, app.skyboxPipelineLayout, nil)
+	}
+	if app.skyboxSetLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(app.device, app.skyboxSetLayout, nil)
+	}
+	if app.skyboxSampler != vk.NullSampler {
+		app.release(app.skyboxSampler)
+		vk.DestroySampler(app.device, app.skyboxSampler, nil)
+	}
+	if app.skyboxImage != nil {
+		app.skyboxImage.Destroy()
+	}
+}
@@ -0,0 +1,416 @@
+// Package spirv reflects compiled SPIR-V modules so pipeline layouts and
+// vertex input state can be derived from the shaders instead of kept in sync
+// by hand.
+package spirv
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const magic = 0x07230203
+
+// Opcodes used by reflection, from the SPIR-V specification.
+const (
+	opEntryPoint       = 15
+	opTypeBool         = 20
+	opTypeInt          = 21
+	opTypeFloat        = 22
+	opTypeVector       = 23
+	opTypeMatrix       = 24
+	opTypeImage        = 25
+	opTypeSampler      = 26
+	opTypeSampledImage = 27
+	opTypeArray        = 28
+	opTypeRuntimeArray = 29
+	opTypeStruct       = 30
+	opTypePointer      = 32
+	opConstant         = 43
+	opVariable         = 59
+	opDecorate         = 71
+	opMemberDecorate   = 72
+)
+
+// Decorations used by reflection.
+const (
+	decorationBufferBlock   = 3
+	decorationArrayStride   = 6
+	decorationMatrixStride  = 7
+	decorationBuiltIn       = 11
+	decorationLocation      = 30
+	decorationBinding       = 33
+	decorationDescriptorSet = 34
+	decorationOffset        = 35
+)
+
+// Storage classes used by reflection.
+const (
+	storageUniformConstant = 0
+	storageInput           = 1
+	storageUniform         = 2
+	storagePushConstant    = 9
+	storageStorageBuffer   = 12
+)
+
+// Image dimensions that change the descriptor type.
+const (
+	dimBuffer      = 5
+	dimSubpassData = 6
+)
+
+var executionModelStages = map[uint32]vk.ShaderStageFlagBits{
+	0: vk.ShaderStageVertexBit,
+	1: vk.ShaderStageTessellationControlBit,
+	2: vk.ShaderStageTessellationEvaluationBit,
+	3: vk.ShaderStageGeometryBit,
+	4: vk.ShaderStageFragmentBit,
+	5: vk.ShaderStageComputeBit,
+	// TaskEXT and MeshEXT, whose stage bits the bindings predate
+	5364: vk.ShaderStageFlagBits(0x00000040),
+	5365: vk.ShaderStageFlagBits(0x00000080),
+}
+
+// Binding is a descriptor the shader declares.
+type Binding struct {
+	Set     uint32
+	Binding uint32
+	Type    vk.DescriptorType
+	// Count is 0 for an unsized array, whose size is up to the layout.
+	Count uint32
+}
+
+// Input is a vertex shader input variable.
+type Input struct {
+	Location uint32
+	Format   vk.Format
+	Size     uint32
+}
+
+// Module is what a shader stage exposes to the pipeline.
+type Module struct {
+	Stage      vk.ShaderStageFlagBits
+	EntryPoint string
+	Bindings   []Binding
+	// PushConstantSize is the size of the push constant block in bytes, 0
+	// when the stage doesn't declare one.
+	PushConstantSize uint32
+	// Inputs are sorted by location and only filled for vertex shaders.
+	Inputs []Input
+}
+
+type typeInfo struct {
+	op       uint32
+	operands []uint32
+}
+
+type reflector struct {
+	types     map[uint32]typeInfo
+	constants map[uint32]uint32
+	// decorations maps id -> decoration -> first literal
+	decorations map[uint32]map[uint32]uint32
+	// memberDecorations maps struct id -> member -> decoration -> first literal
+	memberDecorations map[uint32]map[uint32]map[uint32]uint32
+	variables         []variable
+}
+
+type variable struct {
+	id      uint32
+	typeID  uint32
+	storage uint32
+}
+
+// Reflect parses a SPIR-V module with a single entry point.
+func Reflect(code []byte) (*Module, error) {
+	if len(code) < 20 || len(code)%4 != 0 {
+		return nil, errors.Errorf("SPIR-V size %d is too small or not a multiple of 4", len(code))
+	}
+	words := make([]uint32, len(code)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(code[i*4:])
+	}
+	if words[0] != magic {
+		return nil, errors.Errorf("bad SPIR-V magic number %#x", words[0])
+	}
+
+	r := &reflector{
+		types:             map[uint32]typeInfo{},
+		constants:         map[uint32]uint32{},
+		decorations:       map[uint32]map[uint32]uint32{},
+		memberDecorations: map[uint32]map[uint32]map[uint32]uint32{},
+	}
+	m := &Module{}
+	entryPoints := 0
+
+	for i := 5; i < len(words); {
+		count, op := words[i]>>16, words[i]&0xffff
+		if count == 0 || i+int(count) > len(words) {
+			return nil, errors.Errorf("truncated instruction at word %d", i)
+		}
+		operands := words[i+1 : i+int(count)]
+		i += int(count)
+
+		switch op {
+		case opEntryPoint:
+			stage, ok := executionModelStages[operands[0]]
+			if !ok {
+				return nil, errors.Errorf("unsupported execution model %d", operands[0])
+			}
+			m.Stage = stage
+			m.EntryPoint = literalString(operands[2:])
+			entryPoints++
+		case opTypeBool, opTypeInt, opTypeFloat, opTypeVector, opTypeMatrix,
+			opTypeImage, opTypeSampler, opTypeSampledImage, opTypeArray,
+			opTypeRuntimeArray, opTypeStruct, opTypePointer:
+			r.types[operands[0]] = typeInfo{op: op, operands: operands[1:]}
+		case opConstant:
+			// Array lengths are 32 bit integers, wider constants aren't needed
+			if len(operands) >= 3 {
+				r.constants[operands[1]] = operands[2]
+			}
+		case opVariable:
+			r.variables = append(r.variables, variable{id: operands[1], typeID: operands[0], storage: operands[2]})
+		case opDecorate:
+			decorations := r.decorations[operands[0]]
+			if decorations == nil {
+				decorations = map[uint32]uint32{}
+				r.decorations[operands[0]] = decorations
+			}
+			decorations[operands[1]] = firstLiteral(operands[2:])
+		case opMemberDecorate:
+			members := r.memberDecorations[operands[0]]
+			if members == nil {
+				members = map[uint32]map[uint32]uint32{}
+				r.memberDecorations[operands[0]] = members
+			}
+			decorations := members[operands[1]]
+			if decorations == nil {
+				decorations = map[uint32]uint32{}
+				members[operands[1]] = decorations
+			}
+			decorations[operands[2]] = firstLiteral(operands[3:])
+		}
+	}
+
+	if entryPoints != 1 {
+		return nil, errors.Errorf("module has %d entry points, expected 1", entryPoints)
+	}
+
+	for _, v := range r.variables {
+		pointer, ok := r.types[v.typeID]
+		if !ok || pointer.op != opTypePointer {
+			return nil, errors.Errorf("variable %d isn't a pointer", v.id)
+		}
+		pointee := pointer.operands[1]
+
+		switch v.storage {
+		case storageUniformConstant, storageUniform, storageStorageBuffer:
+			b, err := r.binding(v, pointee)
+			if err != nil {
+				return nil, errors.Wrapf(err, "variable %d", v.id)
+			}
+			m.Bindings = append(m.Bindings, b)
+		case storagePushConstant:
+			size, err := r.size(pointee)
+			if err != nil {
+				return nil, errors.Wrap(err, "can't size push constant block")
+			}
+			m.PushConstantSize = size
+		case storageInput:
+			if m.Stage != vk.ShaderStageVertexBit {
+				continue
+			}
+			if _, builtin := r.decorations[v.id][decorationBuiltIn]; builtin {
+				continue
+			}
+			in, err := r.input(v, pointee)
+			if err != nil {
+				return nil, errors.Wrapf(err, "variable %d", v.id)
+			}
+			m.Inputs = append(m.Inputs, in)
+		}
+	}
+
+	sort.Slice(m.Bindings, func(i, j int) bool {
+		a, b := m.Bindings[i], m.Bindings[j]
+		if a.Set != b.Set {
+			return a.Set < b.Set
+		}
+		return a.Binding < b.Binding
+	})
+	sort.Slice(m.Inputs, func(i, j int) bool {
+		return m.Inputs[i].Location < m.Inputs[j].Location
+	})
+
+	return m, nil
+}
+
+func (r *reflector) binding(v variable, typeID uint32) (Binding, error) {
+	decorations := r.decorations[v.id]
+	b := Binding{
+		Set:     decorations[decorationDescriptorSet],
+		Binding: decorations[decorationBinding],
+		Count:   1,
+	}
+
+	t := r.types[typeID]
+	switch t.op {
+	case opTypeArray:
+		length, ok := r.constants[t.operands[1]]
+		if !ok {
+			return Binding{}, errors.New("descriptor array length isn't a constant")
+		}
+		b.Count = length
+		typeID = t.operands[0]
+		t = r.types[typeID]
+	case opTypeRuntimeArray:
+		b.Count = 0
+		typeID = t.operands[0]
+		t = r.types[typeID]
+	}
+
+	switch {
+	case t.op == opTypeSampledImage:
+		b.Type = vk.DescriptorTypeCombinedImageSampler
+	case t.op == opTypeSampler:
+		b.Type = vk.DescriptorTypeSampler
+	case t.op == opTypeImage:
+		// Operands after the id: sampled type, dim, depth, arrayed, ms, sampled
+		dim, sampled := t.operands[1], t.operands[5]
+		switch {
+		case dim == dimSubpassData:
+			b.Type = vk.DescriptorTypeInputAttachment
+		case dim == dimBuffer && sampled == 2:
+			b.Type = vk.DescriptorTypeStorageTexelBuffer
+		case dim == dimBuffer:
+			b.Type = vk.DescriptorTypeUniformTexelBuffer
+		case sampled == 2:
+			b.Type = vk.DescriptorTypeStorageImage
+		default:
+			b.Type = vk.DescriptorTypeSampledImage
+		}
+	case t.op == opTypeStruct && v.storage == storageStorageBuffer:
+		b.Type = vk.DescriptorTypeStorageBuffer
+	case t.op == opTypeStruct:
+		// Before SPIR-V 1.3 storage buffers are Uniform blocks decorated BufferBlock
+		if _, ok := r.decorations[typeID][decorationBufferBlock]; ok {
+			b.Type = vk.DescriptorTypeStorageBuffer
+		} else {
+			b.Type = vk.DescriptorTypeUniformBuffer
+		}
+	default:
+		return Binding{}, errors.Errorf("unsupported descriptor type opcode %d", t.op)
+	}
+	return b, nil
+}
+
+func (r *reflector) input(v variable, typeID uint32) (Input, error) {
+	location, ok := r.decorations[v.id][decorationLocation]
+	if !ok {
+		return Input{}, errors.New("vertex input has no location")
+	}
+
+	components := uint32(1)
+	t := r.types[typeID]
+	if t.op == opTypeVector {
+		components = t.operands[1]
+		t = r.types[t.operands[0]]
+	}
+
+	var formats []vk.Format
+	switch {
+	case t.op == opTypeFloat && t.operands[0] == 32:
+		formats = []vk.Format{vk.FormatR32Sfloat, vk.FormatR32g32Sfloat, vk.FormatR32g32b32Sfloat, vk.FormatR32g32b32a32Sfloat}
+	case t.op == opTypeInt && t.operands[0] == 32 && t.operands[1] == 1:
+		formats = []vk.Format{vk.FormatR32Sint, vk.FormatR32g32Sint, vk.FormatR32g32b32Sint, vk.FormatR32g32b32a32Sint}
+	case t.op == opTypeInt && t.operands[0] == 32:
+		formats = []vk.Format{vk.FormatR32Uint, vk.FormatR32g32Uint, vk.FormatR32g32b32Uint, vk.FormatR32g32b32a32Uint}
+	default:
+		return Input{}, errors.Errorf("vertex input at location %d must be a 32 bit scalar or vector", location)
+	}
+	if components < 1 || components > 4 {
+		return Input{}, errors.Errorf("vertex input at location %d has %d components", location, components)
+	}
+
+	return Input{
+		Location: location,
+		Format:   formats[components-1],
+		Size:     components * 4,
+	}, nil
+}
+
+// size is the number of bytes a type occupies in an explicitly laid out
+// block, which is enough for push constant ranges.
+func (r *reflector) size(typeID uint32) (uint32, error) {
+	t, ok := r.types[typeID]
+	if !ok {
+		return 0, errors.Errorf("unknown type %d", typeID)
+	}
+
+	switch t.op {
+	case opTypeBool:
+		return 4, nil
+	case opTypeInt, opTypeFloat:
+		return t.operands[0] / 8, nil
+	case opTypeVector:
+		component, err := r.size(t.operands[0])
+		return component * t.operands[1], err
+	case opTypeMatrix:
+		column, err := r.size(t.operands[0])
+		return column * t.operands[1], err
+	case opTypeArray:
+		length, ok := r.constants[t.operands[1]]
+		if !ok {
+			return 0, errors.New("array length isn't a constant")
+		}
+		if stride, ok := r.decorations[typeID][decorationArrayStride]; ok {
+			return stride * length, nil
+		}
+		element, err := r.size(t.operands[0])
+		return element * length, err
+	case opTypeStruct:
+		var end uint32
+		for i, member := range t.operands {
+			decorations := r.memberDecorations[typeID][uint32(i)]
+			size, err := r.size(member)
+			if err != nil {
+				return 0, err
+			}
+			// Matrices in blocks are laid out with an explicit column stride
+			if stride, ok := decorations[decorationMatrixStride]; ok {
+				if m := r.types[member]; m.op == opTypeMatrix {
+					size = stride * m.operands[1]
+				}
+			}
+			if memberEnd := decorations[decorationOffset] + size; memberEnd > end {
+				end = memberEnd
+			}
+		}
+		return end, nil
+	}
+	return 0, errors.Errorf("can't size type opcode %d", t.op)
+}
+
+func firstLiteral(literals []uint32) uint32 {
+	if len(literals) == 0 {
+		return 0
+	}
+	return literals[0]
+}
+
+// literalString decodes a nul terminated UTF-8 string packed into words.
+func literalString(words []uint32) string {
+	var b []byte
+	for _, w := range words {
+		for i := uint(0); i < 4; i++ {
+			c := byte(w >> (8 * i))
+			if c == 0 {
+				return string(b)
+			}
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,49 @@
+package sprite
+
+import (
+	"strconv"
+
+	"github.com/delaneyj/learnvulkan/vmath"
+)
+
+// Atlas is a texture holding many sprites, each a named region of it, so
+// they're all drawn in one draw call.
+type Atlas struct {
+	Texture *Texture
+	Regions map[string]Rect
+}
+
+// NewGridAtlas cuts texture into cells of cellWidth by cellHeight pixels,
+// the way sprite sheets are laid out. The cells are named by their index,
+// from "0" at the top left going along each row in turn.
+func NewGridAtlas(texture *Texture, cellWidth, cellHeight int) *Atlas {
+	a := &Atlas{Texture: texture, Regions: map[string]Rect{}}
+	columns, rows := texture.Width/cellWidth, texture.Height/cellHeight
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			a.Regions[strconv.Itoa(row*columns+column)] = Rect{
+				X: float32(column * cellWidth),
+				Y: float32(row * cellHeight),
+				W: float32(cellWidth),
+				H: float32(cellHeight),
+			}
+		}
+	}
+	return a
+}
+
+// Draw draws the region name into b like Batch.Draw, reporting whether the
+// atlas has it.
+func (a *Atlas) Draw(b *Batch, name string, transform vmath.Mat4) bool {
+	return a.DrawTinted(b, name, transform, white)
+}
+
+// DrawTinted is Draw with the region's colors multiplied by tint.
+func (a *Atlas) DrawTinted(b *Batch, name string, transform vmath.Mat4, tint vmath.Vec4) bool {
+	region, ok := a.Regions[name]
+	if !ok {
+		return false
+	}
+	b.DrawTinted(a.Texture, region, transform, tint)
+	return true
+}
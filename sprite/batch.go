@@ -0,0 +1,537 @@
+// Package sprite draws textured 2D quads in batches, the way 2D games draw
+// their sprites. Everything drawn between Begin and End goes into one
+// vertex buffer and is drawn with as few draw calls as the order of the
+// textures allows.
+package sprite
+
+import (
+	"image"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/renderpass"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// minBufferSize is the smallest per frame vertex buffer, so the first few
+// frames don't grow it every time.
+const minBufferSize = 64 << 10
+
+var white = vmath.Vec4{1, 1, 1, 1}
+
+// Vertex is a corner of a sprite's quad, matching sprite.vert's inputs.
+type Vertex struct {
+	Position [2]float32
+	TexCoord [2]float32
+	Color    [4]float32
+}
+
+// projection matches the push_constant block in sprite.vert.
+type projection struct {
+	Matrix vmath.Mat4
+}
+
+var projectionConstants = pipeline.NewPushConstants[projection](vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0)
+
+// Rect is a rectangle in pixels, from its top left corner.
+type Rect struct {
+	X, Y, W, H float32
+}
+
+// Texture is an image sprites are drawn from, created by a Batch and
+// destroyed along with it.
+type Texture struct {
+	Width, Height int
+	image         *gpu.Image
+	set           vk.DescriptorSet
+}
+
+// Bounds is the whole texture.
+func (t *Texture) Bounds() Rect {
+	return Rect{W: float32(t.Width), H: float32(t.Height)}
+}
+
+// run is consecutive vertices drawn from the same texture.
+type run struct {
+	texture *Texture
+	first   uint32
+	count   uint32
+}
+
+// frameBuffer is the vertices of one frame in flight and how they're drawn.
+type frameBuffer struct {
+	vertices   *gpu.Buffer
+	runs       []run
+	projection vmath.Mat4
+}
+
+// Batch draws sprites into the images of a render target, on top of what's
+// already there. Everything but the target lives as long as the batch, the
+// target has to be recreated with the swapchain.
+type Batch struct {
+	ctx gpu.Context
+
+	vert, frag  vk.ShaderModule
+	setLayout   vk.DescriptorSetLayout
+	layout      vk.PipelineLayout
+	descriptors *descriptors.Allocator
+	sampler     vk.Sampler
+	textures    []*Texture
+	frames      []frameBuffer
+
+	// The batch between Begin and End
+	drawing    bool
+	frame      int
+	projection vmath.Mat4
+	vertices   []Vertex
+	runs       []run
+
+	renderPass   vk.RenderPass
+	pipeline     vk.Pipeline
+	framebuffers []vk.Framebuffer
+	extent       vk.Extent2D
+}
+
+// NewBatch creates a batch with frames frames in flight from the SPIR-V of
+// sprite.vert and sprite.frag.
+func NewBatch(ctx gpu.Context, vert, frag []byte, frames int) (*Batch, error) {
+	b := &Batch{
+		ctx:    ctx,
+		frames: make([]frameBuffer, frames),
+	}
+
+	var err error
+	if b.vert, err = pipeline.NewShaderModule(ctx.Device, vert); err != nil {
+		return nil, errors.Wrap(err, "can't create sprite vertex shader")
+	}
+	if b.frag, err = pipeline.NewShaderModule(ctx.Device, frag); err != nil {
+		b.Destroy()
+		return nil, errors.Wrap(err, "can't create sprite fragment shader")
+	}
+
+	textureBinding := pipeline.StageBinding{Stages: vk.ShaderStageFlags(vk.ShaderStageFragmentBit)}
+	textureBinding.Type = vk.DescriptorTypeCombinedImageSampler
+	textureBinding.Count = 1
+	bindings := []pipeline.StageBinding{textureBinding}
+
+	layouts, err := pipeline.NewSetLayouts(ctx.Device, bindings)
+	if err != nil {
+		b.Destroy()
+		return nil, err
+	}
+	b.setLayout = layouts[0]
+
+	if b.layout, err = pipeline.NewLayout(ctx.Device, layouts, []vk.PushConstantRange{projectionConstants.Range()}); err != nil {
+		b.Destroy()
+		return nil, err
+	}
+	b.descriptors = descriptors.NewAllocator(ctx.Device, descriptors.Ratios(bindings), 0)
+
+	samplerInfo := &vk.SamplerCreateInfo{
+		SType:        vk.StructureTypeSamplerCreateInfo,
+		MagFilter:    vk.FilterLinear,
+		MinFilter:    vk.FilterLinear,
+		MipmapMode:   vk.SamplerMipmapModeNearest,
+		AddressModeU: vk.SamplerAddressModeClampToEdge,
+		AddressModeV: vk.SamplerAddressModeClampToEdge,
+		AddressModeW: vk.SamplerAddressModeClampToEdge,
+		BorderColor:  vk.BorderColorFloatTransparentBlack,
+	}
+	if err := vk.Error(vk.CreateSampler(ctx.Device, samplerInfo, nil, &b.sampler)); err != nil {
+		b.Destroy()
+		return nil, errors.Wrap(err, "can't create sprite sampler")
+	}
+	return b, nil
+}
+
+// NewTexture uploads pixels to a texture of format, sRGB for colors.
+func (b *Batch) NewTexture(pixels *image.RGBA, format vk.Format) (*Texture, error) {
+	width, height := pixels.Rect.Dx(), pixels.Rect.Dy()
+	size := vk.DeviceSize(len(pixels.Pix))
+
+	staging, err := gpu.NewBuffer(b.ctx, size, vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit), memory.CPUToGPU)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create staging buffer")
+	}
+	defer staging.Destroy()
+	if err := staging.Upload(pixels.Pix); err != nil {
+		return nil, err
+	}
+
+	img, err := gpu.NewImage(b.ctx, gpu.ImageInfo{
+		Width:  uint32(width),
+		Height: uint32(height),
+		Format: format,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create sprite texture")
+	}
+	if err := img.CopyFromBuffer(staging); err != nil {
+		img.Destroy()
+		return nil, err
+	}
+	if err := img.TransitionTo(vk.ImageLayoutShaderReadOnlyOptimal); err != nil {
+		img.Destroy()
+		return nil, err
+	}
+
+	set, err := b.descriptors.Allocate(b.setLayout)
+	if err != nil {
+		img.Destroy()
+		return nil, err
+	}
+	vk.UpdateDescriptorSets(b.ctx.Device, 1, []vk.WriteDescriptorSet{{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          set,
+		DstBinding:      0,
+		DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+		DescriptorCount: 1,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+			ImageView:   img.View,
+			Sampler:     b.sampler,
+		}},
+	}}, 0, nil)
+
+	t := &Texture{Width: width, Height: height, image: img, set: set}
+	b.textures = append(b.textures, t)
+	return t, nil
+}
+
+// Projection is an orthographic projection of width by height pixels, with
+// 0, 0 at the target's top left and Y pointing down.
+func Projection(width, height float32) vmath.Mat4 {
+	return vmath.Ortho(0, width, height, 0, -1, 1)
+}
+
+// Begin starts the batch drawn in frame, seen through projection.
+func (b *Batch) Begin(frame int, projection vmath.Mat4) {
+	if b.drawing {
+		panic("sprite: Begin called twice without End")
+	}
+	b.drawing = true
+	b.frame = frame
+	b.projection = projection
+	b.vertices = b.vertices[:0]
+	b.runs = b.runs[:0]
+}
+
+// Draw draws the src region of texture, a zero src meaning all of it, as a
+// quad of src's size in pixels placed by transform. The quad's top left is
+// at the origin before it's transformed.
+func (b *Batch) Draw(texture *Texture, src Rect, transform vmath.Mat4) {
+	b.DrawTinted(texture, src, transform, white)
+}
+
+// DrawTinted is Draw with the texture's colors multiplied by tint.
+func (b *Batch) DrawTinted(texture *Texture, src Rect, transform vmath.Mat4, tint vmath.Vec4) {
+	if !b.drawing {
+		panic("sprite: Draw called outside Begin and End")
+	}
+	if src == (Rect{}) {
+		src = texture.Bounds()
+	}
+
+	corner := func(x, y float32) Vertex {
+		p := transform.MulVec4(vmath.Vec4{x * src.W, y * src.H, 0, 1})
+		return Vertex{
+			Position: [2]float32{p[0], p[1]},
+			TexCoord: [2]float32{
+				(src.X + x*src.W) / float32(texture.Width),
+				(src.Y + y*src.H) / float32(texture.Height),
+			},
+			Color: [4]float32(tint),
+		}
+	}
+	topLeft, topRight := corner(0, 0), corner(1, 0)
+	bottomLeft, bottomRight := corner(0, 1), corner(1, 1)
+
+	// Sprites from the same texture as the last one join its draw call
+	if n := len(b.runs); n == 0 || b.runs[n-1].texture != texture {
+		b.runs = append(b.runs, run{texture: texture, first: uint32(len(b.vertices))})
+	}
+	b.vertices = append(b.vertices, topLeft, topRight, bottomRight, bottomRight, bottomLeft, topLeft)
+	b.runs[len(b.runs)-1].count += 6
+}
+
+// End uploads the batch into its frame's buffer, growing it when it
+// doesn't fit. The frame's previous commands must have finished executing.
+func (b *Batch) End() error {
+	if !b.drawing {
+		panic("sprite: End called without Begin")
+	}
+	b.drawing = false
+
+	buffer := &b.frames[b.frame]
+	size := len(b.vertices) * int(unsafe.Sizeof(Vertex{}))
+	var err error
+	if buffer.vertices, err = b.fit(buffer.vertices, size); err != nil {
+		return errors.Wrap(err, "can't grow sprite vertex buffer")
+	}
+	if size > 0 {
+		copy(buffer.vertices.Mapped(), unsafe.Slice((*byte)(unsafe.Pointer(&b.vertices[0])), size))
+	}
+	buffer.runs = append(buffer.runs[:0], b.runs...)
+	buffer.projection = b.projection
+	return nil
+}
+
+// CreateTarget creates the render pass, pipeline and framebuffers for
+// drawing into views, images of format that are in finalLayout both before
+// and after the sprites are drawn.
+func (b *Batch) CreateTarget(format vk.Format, finalLayout vk.ImageLayout, views []vk.ImageView, extent vk.Extent2D) error {
+	// Sprites are drawn over the frame, which has to be loaded and finished first
+	rb := renderpass.NewBuilder()
+	attachment := renderpass.ColorAttachment(format, vk.SampleCount1Bit, finalLayout)
+	attachment.LoadOp = vk.AttachmentLoadOpLoad
+	attachment.InitialLayout = finalLayout
+	color := rb.Attachment(attachment)
+	rb.Subpass(renderpass.Subpass{Colors: []uint32{color}})
+	rb.Dependency(vk.SubpassDependency{
+		SrcSubpass:    vk.SubpassExternal,
+		DstSubpass:    0,
+		SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		SrcAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+		DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		DstAccessMask: vk.AccessFlags(vk.AccessColorAttachmentReadBit | vk.AccessColorAttachmentWriteBit),
+	})
+
+	var err error
+	if b.renderPass, err = rb.Build(b.ctx.Device); err != nil {
+		return errors.Wrap(err, "can't build sprite render pass")
+	}
+	b.extent = extent
+	if err := b.createPipeline(); err != nil {
+		b.DestroyTarget()
+		return err
+	}
+
+	for i, view := range views {
+		createInfo := &vk.FramebufferCreateInfo{
+			SType:           vk.StructureTypeFramebufferCreateInfo,
+			RenderPass:      b.renderPass,
+			AttachmentCount: 1,
+			PAttachments:    []vk.ImageView{view},
+			Width:           extent.Width,
+			Height:          extent.Height,
+			Layers:          1,
+		}
+		var fb vk.Framebuffer
+		if err := vk.Error(vk.CreateFramebuffer(b.ctx.Device, createInfo, nil, &fb)); err != nil {
+			b.DestroyTarget()
+			return errors.Wrapf(err, "can't create sprite framebuffer %d", i)
+		}
+		b.framebuffers = append(b.framebuffers, fb)
+	}
+	return nil
+}
+
+func (b *Batch) createPipeline() error {
+	stages := []vk.PipelineShaderStageCreateInfo{
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageVertexBit,
+			Module: b.vert,
+			PName:  "main\x00",
+		},
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageFragmentBit,
+			Module: b.frag,
+			PName:  "main\x00",
+		},
+	}
+
+	vertexInput := &vk.PipelineVertexInputStateCreateInfo{
+		SType:                         vk.StructureTypePipelineVertexInputStateCreateInfo,
+		VertexBindingDescriptionCount: 1,
+		PVertexBindingDescriptions: []vk.VertexInputBindingDescription{{
+			Binding:   0,
+			Stride:    uint32(unsafe.Sizeof(Vertex{})),
+			InputRate: vk.VertexInputRateVertex,
+		}},
+		VertexAttributeDescriptionCount: 3,
+		PVertexAttributeDescriptions: []vk.VertexInputAttributeDescription{
+			{Location: 0, Binding: 0, Format: vk.FormatR32g32Sfloat, Offset: uint32(unsafe.Offsetof(Vertex{}.Position))},
+			{Location: 1, Binding: 0, Format: vk.FormatR32g32Sfloat, Offset: uint32(unsafe.Offsetof(Vertex{}.TexCoord))},
+			{Location: 2, Binding: 0, Format: vk.FormatR32g32b32a32Sfloat, Offset: uint32(unsafe.Offsetof(Vertex{}.Color))},
+		},
+	}
+
+	inputAssembly := &vk.PipelineInputAssemblyStateCreateInfo{
+		SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+		Topology: vk.PrimitiveTopologyTriangleList,
+	}
+
+	viewportState := &vk.PipelineViewportStateCreateInfo{
+		SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+		ViewportCount: 1,
+		PViewports: []vk.Viewport{{
+			Width:    float32(b.extent.Width),
+			Height:   float32(b.extent.Height),
+			MinDepth: 0,
+			MaxDepth: 1,
+		}},
+		ScissorCount: 1,
+		PScissors:    []vk.Rect2D{{Extent: b.extent}},
+	}
+
+	// Sprites can be flipped by their transform, so both windings are drawn
+	rasterizer := &vk.PipelineRasterizationStateCreateInfo{
+		SType:       vk.StructureTypePipelineRasterizationStateCreateInfo,
+		PolygonMode: vk.PolygonModeFill,
+		CullMode:    vk.CullModeFlags(vk.CullModeNone),
+		FrontFace:   vk.FrontFaceCounterClockwise,
+		LineWidth:   1,
+	}
+
+	multisampling := &vk.PipelineMultisampleStateCreateInfo{
+		SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+		RasterizationSamples: vk.SampleCount1Bit,
+	}
+
+	colorBlending := &vk.PipelineColorBlendStateCreateInfo{
+		SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+		AttachmentCount: 1,
+		PAttachments: []vk.PipelineColorBlendAttachmentState{{
+			BlendEnable:         vk.True,
+			SrcColorBlendFactor: vk.BlendFactorSrcAlpha,
+			DstColorBlendFactor: vk.BlendFactorOneMinusSrcAlpha,
+			ColorBlendOp:        vk.BlendOpAdd,
+			SrcAlphaBlendFactor: vk.BlendFactorOne,
+			DstAlphaBlendFactor: vk.BlendFactorOneMinusSrcAlpha,
+			AlphaBlendOp:        vk.BlendOpAdd,
+			ColorWriteMask: vk.ColorComponentFlags(
+				vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit,
+			),
+		}},
+	}
+
+	pipelineInfos := []vk.GraphicsPipelineCreateInfo{{
+		SType:               vk.StructureTypeGraphicsPipelineCreateInfo,
+		StageCount:          uint32(len(stages)),
+		PStages:             stages,
+		PVertexInputState:   vertexInput,
+		PInputAssemblyState: inputAssembly,
+		PViewportState:      viewportState,
+		PRasterizationState: rasterizer,
+		PMultisampleState:   multisampling,
+		PColorBlendState:    colorBlending,
+		Layout:              b.layout,
+		RenderPass:          b.renderPass,
+		Subpass:             0,
+		BasePipelineIndex:   -1,
+	}}
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(b.ctx.Device, vk.NullPipelineCache, 1, pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create sprite pipeline")
+	}
+	b.pipeline = pipelines[0]
+	return nil
+}
+
+// DestroyTarget destroys what CreateTarget created.
+func (b *Batch) DestroyTarget() {
+	for _, fb := range b.framebuffers {
+		vk.DestroyFramebuffer(b.ctx.Device, fb, nil)
+	}
+	b.framebuffers = nil
+	if b.pipeline != vk.NullPipeline {
+		vk.DestroyPipeline(b.ctx.Device, b.pipeline, nil)
+		b.pipeline = vk.NullPipeline
+	}
+	if b.renderPass != vk.NullRenderPass {
+		vk.DestroyRenderPass(b.ctx.Device, b.renderPass, nil)
+		b.renderPass = vk.NullRenderPass
+	}
+}
+
+// Record records drawing the sprites uploaded for frame into the target's
+// image imageIndex, one draw call per run of sprites from a texture. It
+// returns how many draw calls it recorded.
+func (b *Batch) Record(cb vk.CommandBuffer, frame int, imageIndex uint32) int {
+	buffer := b.frames[frame]
+	if len(buffer.runs) == 0 {
+		return 0
+	}
+
+	vk.CmdBeginRenderPass(cb, &vk.RenderPassBeginInfo{
+		SType:       vk.StructureTypeRenderPassBeginInfo,
+		RenderPass:  b.renderPass,
+		Framebuffer: b.framebuffers[imageIndex],
+		RenderArea:  vk.Rect2D{Extent: b.extent},
+	}, vk.SubpassContentsInline)
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, b.pipeline)
+	vk.CmdBindVertexBuffers(cb, 0, 1, []vk.Buffer{buffer.vertices.Handle}, []vk.DeviceSize{0})
+	projectionConstants.Push(cb, b.layout, projection{Matrix: buffer.projection})
+	for _, r := range buffer.runs {
+		vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, b.layout, 0, 1, []vk.DescriptorSet{r.texture.set}, 0, nil)
+		vk.CmdDraw(cb, r.count, 1, r.first, 0)
+	}
+	vk.CmdEndRenderPass(cb)
+	return len(buffer.runs)
+}
+
+// fit returns buffer if it holds size bytes, otherwise a new host visible
+// vertex buffer twice as big as needed in place of it.
+func (b *Batch) fit(buffer *gpu.Buffer, size int) (*gpu.Buffer, error) {
+	if buffer != nil && vk.DeviceSize(size) <= buffer.Size {
+		return buffer, nil
+	}
+	if buffer != nil {
+		buffer.Destroy()
+	}
+	capacity := 2 * size
+	if capacity < minBufferSize {
+		capacity = minBufferSize
+	}
+	return gpu.NewBuffer(b.ctx, vk.DeviceSize(capacity), vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit), memory.CPUToGPU)
+}
+
+// Destroy destroys the batch along with its target and textures. Nothing
+// it recorded can still be executing.
+func (b *Batch) Destroy() {
+	b.DestroyTarget()
+	for _, buffer := range b.frames {
+		if buffer.vertices != nil {
+			buffer.vertices.Destroy()
+		}
+	}
+	b.frames = nil
+	for _, t := range b.textures {
+		t.image.Destroy()
+	}
+	b.textures = nil
+
+	device := b.ctx.Device
+	if b.descriptors != nil {
+		b.descriptors.Destroy()
+		b.descriptors = nil
+	}
+	if b.sampler != vk.NullSampler {
+		vk.DestroySampler(device, b.sampler, nil)
+		b.sampler = vk.NullSampler
+	}
+	if b.layout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(device, b.layout, nil)
+		b.layout = vk.NullPipelineLayout
+	}
+	if b.setLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(device, b.setLayout, nil)
+		b.setLayout = vk.NullDescriptorSetLayout
+	}
+	for _, module := range []vk.ShaderModule{b.vert, b.frag} {
+		if module != vk.NullShaderModule {
+			vk.DestroyShaderModule(device, module, nil)
+		}
+	}
+	b.vert, b.frag = vk.NullShaderModule, vk.NullShaderModule
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/sprite"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// demoSpriteGrid is how many cells across and down the demo cuts the
+	// texture into.
+	demoSpriteGrid = 4
+	// demoSpriteRadius is how far the demo's ring of sprites is from the
+	// window's centre, as a fraction of its smaller side.
+	demoSpriteRadius = 0.35
+	// demoSpriteSize is the demo's sprites' size in pixels.
+	demoSpriteSize = 96
+)
+
+// demoSprites is what --sprites draws without OnSprites, the texture cut
+// into a sprite sheet.
+type demoSprites struct {
+	atlas *sprite.Atlas
+}
+
+// createSprites gives the primary window a sprite batch when the Sprites
+// option is set, loading textures with OnSpritesLoad or the demo's.
+func (app *HelloTriangleApplication) createSprites() error {
+	if !app.Sprites || app.window == nil || app.appWindow != app.windows[0] {
+		return nil
+	}
+
+	batch, err := sprite.NewBatch(app.gpuContext(), shaders.SpriteVert(), shaders.SpriteFrag(), app.framesInFlight())
+	if err != nil {
+		return errors.Wrap(err, "can't create sprite batch")
+	}
+	app.spriteBatch = batch
+
+	if app.OnSpritesLoad != nil {
+		if err := app.OnSpritesLoad(batch); err != nil {
+			return errors.Wrap(err, "can't load sprites")
+		}
+	} else if app.OnSprites == nil {
+		if err := app.loadDemoSprites(); err != nil {
+			return err
+		}
+	}
+	return app.createSpriteTarget()
+}
+
+// loadDemoSprites cuts the texture into a sprite sheet for the demo.
+func (app *HelloTriangleApplication) loadDemoSprites() error {
+	pixels, err := loadRGBA(texturePath)
+	if err != nil {
+		return errors.Wrap(err, "can't load sprite texture")
+	}
+	texture, err := app.spriteBatch.NewTexture(pixels, vk.FormatR8g8b8a8Srgb)
+	if err != nil {
+		return err
+	}
+	app.demoSprites = &demoSprites{
+		atlas: sprite.NewGridAtlas(texture, texture.Width/demoSpriteGrid, texture.Height/demoSpriteGrid),
+	}
+	return nil
+}
+
+// createSpriteTarget points the sprite batch at the current swapchain
+// images.
+func (app *HelloTriangleApplication) createSpriteTarget() error {
+	if app.spriteBatch == nil {
+		return nil
+	}
+	return errors.Wrap(
+		app.spriteBatch.CreateTarget(app.target.Format, app.target.FinalLayout, app.imageViews, app.target.Extent),
+		"can't create sprite render target",
+	)
+}
+
+// buildSprites batches this frame's sprites and uploads them for frame.
+func (app *HelloTriangleApplication) buildSprites(frame int) error {
+	if app.spriteBatch == nil {
+		return nil
+	}
+
+	extent := app.target.Extent
+	app.spriteBatch.Begin(frame, sprite.Projection(float32(extent.Width), float32(extent.Height)))
+	elapsed := time.Since(app.startTime)
+	switch {
+	case app.OnSprites != nil:
+		app.OnSprites(app.spriteBatch, elapsed)
+	case app.demoSprites != nil:
+		app.demoSprites.draw(app.spriteBatch, extent, elapsed)
+	}
+	return errors.Wrap(app.spriteBatch.End(), "can't upload sprites")
+}
+
+// draw spins a ring of the sheet's cells around the window's centre, each
+// turning about its own.
+func (d *demoSprites) draw(b *sprite.Batch, extent vk.Extent2D, elapsed time.Duration) {
+	t := float32(elapsed.Seconds())
+	cx, cy := float32(extent.Width)/2, float32(extent.Height)/2
+	radius := demoSpriteRadius * float32(math.Min(float64(extent.Width), float64(extent.Height)))
+	cells := len(d.atlas.Regions)
+	for i := 0; i < cells; i++ {
+		name := strconv.Itoa(i)
+		cell := d.atlas.Regions[name]
+		angle := t/2 + 2*math.Pi*float32(i)/float32(cells)
+		x := cx + radius*float32(math.Cos(float64(angle)))
+		y := cy + radius*float32(math.Sin(float64(angle)))
+
+		// Scale the cell to size and centre it on its place in the ring
+		transform := vmath.Translate(vmath.Vec3{x, y, 0}).
+			Mul(vmath.Rotate(t, vmath.Vec3{0, 0, 1})).
+			Mul(vmath.Scale(vmath.Vec3{demoSpriteSize / cell.W, demoSpriteSize / cell.H, 1})).
+			Mul(vmath.Translate(vmath.Vec3{-cell.W / 2, -cell.H / 2, 0}))
+		d.atlas.Draw(b, name, transform)
+	}
+}
+
+// recordSprites draws the sprites batched for frame over the swapchain
+// image.
+func (app *HelloTriangleApplication) recordSprites(cb vk.CommandBuffer, frame int, imageIndex uint32) {
+	if app.spriteBatch == nil {
+		return
+	}
+	scope := app.profiler.Begin(cb, "sprites")
+	app.countDraws(app.spriteBatch.Record(cb, frame, imageIndex))
+	scope.End(cb)
+}
@@ -0,0 +1,255 @@
+// Package stats keeps rolling frame timings, so performance can be compared
+// between runs and chapters instead of guessed at.
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultWindow is how many recent frames a summary covers.
+const DefaultWindow = 240
+
+// Frames collects the timing of the most recent frames.
+type Frames struct {
+	window   int
+	cpu      ring
+	interval ring
+	// gpu are the GPU times of each named scope.
+	gpu map[string]*ring
+	// counts are per frame counters like pipeline statistics.
+	counts map[string]*counter
+	count  uint64
+	// lastPresent is when the previous frame was presented, zero before
+	// the first.
+	lastPresent time.Time
+}
+
+// New creates a collector summarizing the last window frames, zero uses
+// DefaultWindow.
+func New(window int) *Frames {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Frames{
+		window:   window,
+		cpu:      newRing(window),
+		interval: newRing(window),
+		gpu:      map[string]*ring{},
+		counts:   map[string]*counter{},
+	}
+}
+
+// Record adds a frame that took cpu to record and submit and was presented
+// at presented.
+func (f *Frames) Record(cpu time.Duration, presented time.Time) {
+	f.count++
+	f.cpu.add(cpu)
+	if !f.lastPresent.IsZero() {
+		f.interval.add(presented.Sub(f.lastPresent))
+	}
+	f.lastPresent = presented
+}
+
+// RecordGPU adds how long a named scope of a frame took on the GPU.
+func (f *Frames) RecordGPU(scope string, d time.Duration) {
+	r, ok := f.gpu[scope]
+	if !ok {
+		r = &ring{samples: make([]time.Duration, f.window)}
+		f.gpu[scope] = r
+	}
+	r.add(d)
+}
+
+// RecordCount adds a frame's value of a named counter.
+func (f *Frames) RecordCount(name string, n uint64) {
+	c, ok := f.counts[name]
+	if !ok {
+		c = &counter{samples: make([]uint64, f.window)}
+		f.counts[name] = c
+	}
+	c.add(n)
+}
+
+// Reset forgets every frame, for when something like a swapchain rebuild or
+// a pause would skew the numbers.
+func (f *Frames) Reset() {
+	f.cpu.reset()
+	f.interval.reset()
+	for _, r := range f.gpu {
+		r.reset()
+	}
+	for _, c := range f.counts {
+		c.reset()
+	}
+	f.lastPresent = time.Time{}
+}
+
+// Intervals are the times between the recent frames' presents, oldest
+// first, for graphing.
+func (f *Frames) Intervals() []time.Duration {
+	return f.interval.ordered()
+}
+
+// Timing summarizes one measurement over the recent frames.
+type Timing struct {
+	Min  time.Duration
+	Mean time.Duration
+	P50  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+func (t Timing) String() string {
+	return fmt.Sprintf("mean %v p50 %v p95 %v p99 %v max %v",
+		round(t.Mean), round(t.P50), round(t.P95), round(t.P99), round(t.Max))
+}
+
+// Summary is the timing of the recent frames.
+type Summary struct {
+	// Frames is how many frames have been recorded in total.
+	Frames uint64
+	// FPS is the frame rate going by the mean present to present time.
+	FPS float64
+	// CPU is how long frames took to record and submit, leaving out
+	// waiting for the GPU and the swapchain.
+	CPU Timing
+	// Present is the time between consecutive presents.
+	Present Timing
+	// GPU is how long each profiled scope took on the GPU, empty without
+	// GPU profiling.
+	GPU map[string]Timing
+	// Counts is the mean per frame of each counter, like pipeline
+	// statistics.
+	Counts map[string]uint64
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%.1f fps, cpu %s, present %s", s.FPS, s.CPU, s.Present)
+}
+
+// Summary summarizes the recent frames.
+func (f *Frames) Summary() Summary {
+	s := Summary{
+		Frames:  f.count,
+		CPU:     f.cpu.timing(),
+		Present: f.interval.timing(),
+		GPU:     make(map[string]Timing, len(f.gpu)),
+		Counts:  make(map[string]uint64, len(f.counts)),
+	}
+	for scope, r := range f.gpu {
+		s.GPU[scope] = r.timing()
+	}
+	for name, c := range f.counts {
+		s.Counts[name] = c.mean()
+	}
+	if s.Present.Mean > 0 {
+		s.FPS = float64(time.Second) / float64(s.Present.Mean)
+	}
+	return s
+}
+
+// ring holds the most recent samples, overwriting the oldest once full.
+type ring struct {
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newRing(size int) ring {
+	return ring{samples: make([]time.Duration, size)}
+}
+
+func (r *ring) add(d time.Duration) {
+	r.samples[r.next] = d
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *ring) reset() {
+	r.next = 0
+	r.full = false
+}
+
+// ordered copies the samples out oldest first.
+func (r *ring) ordered() []time.Duration {
+	if !r.full {
+		return append([]time.Duration(nil), r.samples[:r.next]...)
+	}
+	return append(append([]time.Duration(nil), r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+func (r *ring) timing() Timing {
+	n := r.next
+	if r.full {
+		n = len(r.samples)
+	}
+	if n == 0 {
+		return Timing{}
+	}
+
+	sorted := append([]time.Duration(nil), r.samples[:n]...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	percentile := func(p int) time.Duration {
+		return sorted[(n-1)*p/100]
+	}
+	return Timing{
+		Min:  sorted[0],
+		Mean: total / time.Duration(n),
+		P50:  percentile(50),
+		P95:  percentile(95),
+		P99:  percentile(99),
+		Max:  sorted[n-1],
+	}
+}
+
+// counter holds the most recent values of a counter like ring.
+type counter struct {
+	samples []uint64
+	next    int
+	full    bool
+}
+
+func (c *counter) add(n uint64) {
+	c.samples[c.next] = n
+	c.next++
+	if c.next == len(c.samples) {
+		c.next = 0
+		c.full = true
+	}
+}
+
+func (c *counter) reset() {
+	c.next = 0
+	c.full = false
+}
+
+func (c *counter) mean() uint64 {
+	n := c.next
+	if c.full {
+		n = len(c.samples)
+	}
+	if n == 0 {
+		return 0
+	}
+	var total uint64
+	for _, v := range c.samples[:n] {
+		total += v
+	}
+	return total / uint64(n)
+}
+
+// round trims durations to a readable precision.
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
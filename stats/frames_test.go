@@ -0,0 +1,117 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ms(n ...int) []time.Duration {
+	d := make([]time.Duration, len(n))
+	for i, v := range n {
+		d[i] = time.Duration(v) * time.Millisecond
+	}
+	return d
+}
+
+func TestTiming(t *testing.T) {
+	// Both are added out of order so the percentiles have to sort.
+	oneToHundred := make([]int, 100)
+	for i := range oneToHundred {
+		oneToHundred[i] = (i*37)%100 + 1
+	}
+	oneToNinetyNine := make([]int, 99)
+	for i := range oneToNinetyNine {
+		oneToNinetyNine[i] = (i*37)%99 + 1
+	}
+
+	tests := []struct {
+		name    string
+		window  int
+		samples []time.Duration
+		want    Timing
+	}{
+		{
+			name: "empty",
+			want: Timing{},
+		},
+		{
+			name:    "one sample",
+			window:  8,
+			samples: ms(5),
+			want:    Timing{Min: 5 * time.Millisecond, Mean: 5 * time.Millisecond, P50: 5 * time.Millisecond, P95: 5 * time.Millisecond, P99: 5 * time.Millisecond, Max: 5 * time.Millisecond},
+		},
+		{
+			name:    "unsorted",
+			window:  8,
+			samples: ms(3, 1, 2),
+			want:    Timing{Min: time.Millisecond, Mean: 2 * time.Millisecond, P50: 2 * time.Millisecond, P95: 2 * time.Millisecond, P99: 2 * time.Millisecond, Max: 3 * time.Millisecond},
+		},
+		{
+			name:    "one to a hundred",
+			window:  100,
+			samples: ms(oneToHundred...),
+			want:    Timing{Min: time.Millisecond, Mean: 50500 * time.Microsecond, P50: 50 * time.Millisecond, P95: 95 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond},
+		},
+		{
+			name:    "only the window is summarized",
+			window:  4,
+			samples: ms(100, 100, 3, 4, 5, 6),
+			want:    Timing{Min: 3 * time.Millisecond, Mean: 4500 * time.Microsecond, P50: 4 * time.Millisecond, P95: 5 * time.Millisecond, P99: 5 * time.Millisecond, Max: 6 * time.Millisecond},
+		},
+		{
+			name:    "outlier only moves the tail",
+			window:  100,
+			samples: append(ms(oneToNinetyNine...), time.Second),
+			want:    Timing{Min: time.Millisecond, Mean: 59500 * time.Microsecond, P50: 50 * time.Millisecond, P95: 95 * time.Millisecond, P99: 99 * time.Millisecond, Max: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRing(tt.window)
+			for _, d := range tt.samples {
+				r.add(d)
+			}
+			if got := r.timing(); got != tt.want {
+				t.Errorf("timing = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFramesSummary(t *testing.T) {
+	f := New(4)
+	start := time.Unix(0, 0)
+	for i, cpu := range ms(1, 2, 3, 4, 5) {
+		f.Record(cpu, start.Add(time.Duration(i)*10*time.Millisecond))
+	}
+	f.RecordGPU("scene", 2*time.Millisecond)
+	f.RecordCount("triangles", 10)
+	f.RecordCount("triangles", 20)
+
+	s := f.Summary()
+	if s.Frames != 5 {
+		t.Errorf("Frames = %d, want 5", s.Frames)
+	}
+	if s.FPS != 100 {
+		t.Errorf("FPS = %v, want 100", s.FPS)
+	}
+	if want := (Timing{Min: 2 * time.Millisecond, Mean: 3500 * time.Microsecond, P50: 3 * time.Millisecond, P95: 4 * time.Millisecond, P99: 4 * time.Millisecond, Max: 5 * time.Millisecond}); s.CPU != want {
+		t.Errorf("CPU = %+v, want %+v", s.CPU, want)
+	}
+	if got := s.GPU["scene"].Max; got != 2*time.Millisecond {
+		t.Errorf("GPU scene max = %v, want 2ms", got)
+	}
+	if got := s.Counts["triangles"]; got != 15 {
+		t.Errorf("triangles = %d, want 15", got)
+	}
+	if got, want := f.Intervals(), ms(10, 10, 10, 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("Intervals = %v, want %v", got, want)
+	}
+
+	f.Reset()
+	if s := f.Summary(); s.CPU != (Timing{}) || s.FPS != 0 || len(f.Intervals()) != 0 {
+		t.Errorf("after Reset summary = %+v", s)
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/renderpass"
+	"github.com/delaneyj/learnvulkan/shaders"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// defaultStereoSeparation is roughly the distance between a person's
+	// eyes, in the scene's units of about a metre.
+	defaultStereoSeparation = 0.064
+	// stereoBinding is the binding of StereoViews in set 0, only declared
+	// by stereo.vert.
+	stereoBinding = 2
+	// stereoViewMask draws every subpass of the stereo render pass into
+	// layers 0 and 1, the left and right eyes.
+	stereoViewMask = 0b11
+)
+
+// StereoViews matches the std140 StereoViews block in stereo.vert, a view
+// and projection per eye indexed by gl_ViewIndex.
+type StereoViews struct {
+	View [2]vmath.Mat4
+	Proj [2]vmath.Mat4
+}
+
+// wantsStereo is whether the primary window would be drawn in stereo on a
+// device with multiview, OpenXR's eyes are too. Deferred's lighting and
+// instancing's vertex shader have no stereo variants.
+func (app *HelloTriangleApplication) wantsStereo() bool {
+	return (app.Stereo || app.OpenXR) && !app.Deferred && !app.instanced()
+}
+
+// reportStereo logs why stereo was asked for but isn't drawn.
+func (app *HelloTriangleApplication) reportStereo() {
+	if app.stereo || !(app.Stereo || app.OpenXR) {
+		return
+	}
+	reason := "no device supports multiview"
+	switch {
+	case app.Deferred:
+		reason = "deferred shading has no stereo lighting pass"
+	case app.instanced():
+		reason = "instancing has no stereo vertex shader"
+	}
+	app.logger.Info("Drawing in mono", logging.F("reason", reason))
+}
+
+// stereoWindow is whether the current window is drawn in stereo, only the
+// primary one is.
+func (app *HelloTriangleApplication) stereoWindow() bool {
+	return app.stereo && app.appWindow == app.windows[0]
+}
+
+func (app *HelloTriangleApplication) stereoSeparation() float32 {
+	if app.StereoSeparation == 0 {
+		return defaultStereoSeparation
+	}
+	return app.StereoSeparation
+}
+
+// stereoEyeExtent is the size of each eye's layer, the headset's
+// recommended size with OpenXR and otherwise half the target's width so the
+// two fit side by side.
+func (app *HelloTriangleApplication) stereoEyeExtent() vk.Extent2D {
+	if app.xrSession != nil {
+		return vk.Extent2D{Width: app.xrSession.Width, Height: app.xrSession.Height}
+	}
+	width := app.target.Extent.Width / 2
+	if width == 0 {
+		width = 1
+	}
+	return vk.Extent2D{Width: width, Height: app.target.Extent.Height}
+}
+
+// reflectStereoShader reflects stereo.vert when drawing in stereo so its
+// StereoViews binding is part of set 0.
+func (app *HelloTriangleApplication) reflectStereoShader() ([]*spirv.Module, error) {
+	if !app.stereo {
+		return nil, nil
+	}
+	vert, err := spirv.Reflect(app.shaderCode("stereo.vert", shaders.Stereo()))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't reflect stereo vertex shader")
+	}
+	return []*spirv.Module{vert}, nil
+}
+
+// createStereoRenderPass creates the primary window's multiview render
+// pass, drawing each subpass once per eye into a layer of its 2D array
+// attachments. The color layers are left to be blitted into the target.
+func (app *HelloTriangleApplication) createStereoRenderPass() error {
+	if !app.stereoWindow() {
+		return nil
+	}
+
+	b := renderpass.NewBuilder()
+	color := b.Attachment(renderpass.ColorAttachment(app.target.Format, vk.SampleCount1Bit, vk.ImageLayoutTransferSrcOptimal))
+	depth := b.Attachment(renderpass.DepthAttachment(app.depthFormat, vk.SampleCount1Bit))
+	b.Subpass(renderpass.Subpass{
+		Colors: []uint32{color},
+		Depth:  renderpass.Ref(depth),
+	})
+	// The previous frame's blit reads the color layers before they're
+	// cleared, and this frame's has to wait for them to be written
+	b.Dependency(vk.SubpassDependency{
+		SrcSubpass:    vk.SubpassExternal,
+		DstSubpass:    0,
+		SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageTransferBit | vk.PipelineStageLateFragmentTestsBit),
+		SrcAccessMask: vk.AccessFlags(vk.AccessDepthStencilAttachmentWriteBit),
+		DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit | vk.PipelineStageEarlyFragmentTestsBit),
+		DstAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit | vk.AccessDepthStencilAttachmentWriteBit),
+	})
+	b.Dependency(vk.SubpassDependency{
+		SrcSubpass:    0,
+		DstSubpass:    vk.SubpassExternal,
+		SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		SrcAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+		DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+		DstAccessMask: vk.AccessFlags(vk.AccessTransferReadBit),
+	})
+	b.Multiview(stereoViewMask)
+
+	rp, err := b.Build(app.device)
+	if err != nil {
+		return err
+	}
+	app.stereoRenderPass = rp
+	app.name(rp, "stereo render pass")
+	return nil
+}
+
+// createStereoTarget creates the primary window's layered color and depth
+// images, a layer per eye at stereoEyeExtent, and their framebuffer.
+func (app *HelloTriangleApplication) createStereoTarget() error {
+	if app.stereoRenderPass == vk.NullRenderPass {
+		return nil
+	}
+
+	extent := app.stereoEyeExtent()
+	color, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:  extent.Width,
+		Height: extent.Height,
+		Layers: 2,
+		Format: app.target.Format,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit | vk.ImageUsageTransferSrcBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create stereo color image")
+	}
+	app.stereoColor = color
+	app.name(color.Handle, "stereo color")
+
+	depth, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:  extent.Width,
+		Height: extent.Height,
+		Layers: 2,
+		Format: app.depthFormat,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageTransientAttachmentBit | vk.ImageUsageDepthStencilAttachmentBit),
+		Aspect: vk.ImageAspectFlags(vk.ImageAspectDepthBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create stereo depth image")
+	}
+	app.stereoDepth = depth
+
+	// Multiview framebuffers have a single layer, the view mask picks them
+	framebufferInfo := &vk.FramebufferCreateInfo{
+		SType:           vk.StructureTypeFramebufferCreateInfo,
+		RenderPass:      app.stereoRenderPass,
+		AttachmentCount: 2,
+		PAttachments:    []vk.ImageView{color.View, depth.View},
+		Width:           extent.Width,
+		Height:          extent.Height,
+		Layers:          1,
+	}
+	var fb vk.Framebuffer
+	if err := vk.Error(vk.CreateFramebuffer(app.device, framebufferInfo, nil, &fb)); err != nil {
+		return errors.Wrap(err, "can't create stereo framebuffer")
+	}
+	app.track("framebuffer", fb)
+	app.stereoFramebuffer = fb
+	return nil
+}
+
+// createStereoPipeline creates the primary window's stereo pipeline from
+// the graphics pipeline's filled variant, info, with stereo.vert in place of
+// its vertex shader. It shares the graphics pipeline's layout so
+// drawObjects can draw with it.
+func (app *HelloTriangleApplication) createStereoPipeline(fragShaderModule vk.ShaderModule, info vk.GraphicsPipelineCreateInfo) error {
+	if app.stereoRenderPass == vk.NullRenderPass {
+		return nil
+	}
+
+	vertShaderModule, err := app.createShaderModule(app.shaderCode("stereo.vert", shaders.Stereo()))
+	if err != nil {
+		return errors.Wrap(err, "can't create stereo vertex shader")
+	}
+	defer vk.DestroyShaderModule(app.device, vertShaderModule, nil)
+
+	shaderStages := []vk.PipelineShaderStageCreateInfo{
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageVertexBit,
+			Module: vertShaderModule,
+			PName:  "main\x00",
+		},
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageFragmentBit,
+			Module: fragShaderModule,
+			PName:  "main\x00",
+		},
+	}
+
+	extent := app.stereoEyeExtent()
+	viewportState := &vk.PipelineViewportStateCreateInfo{
+		SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+		ViewportCount: 1,
+		PViewports: []vk.Viewport{{
+			Width:    float32(extent.Width),
+			Height:   float32(extent.Height),
+			MinDepth: 0,
+			MaxDepth: 1,
+		}},
+		ScissorCount: 1,
+		PScissors:    []vk.Rect2D{{Extent: extent}},
+	}
+	multisampling := *info.PMultisampleState
+	multisampling.RasterizationSamples = vk.SampleCount1Bit
+
+	info.PNext = nil
+	info.StageCount = uint32(len(shaderStages))
+	info.PStages = shaderStages
+	info.PViewportState = viewportState
+	info.PMultisampleState = &multisampling
+	info.RenderPass = app.stereoRenderPass
+
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(app.device, vk.NullPipelineCache, 1, []vk.GraphicsPipelineCreateInfo{info}, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create stereo pipeline")
+	}
+	app.track("pipeline", pipelines[0])
+	app.stereoPipeline = pipelines[0]
+	app.name(app.stereoPipeline, "stereo pipeline")
+	return nil
+}
+
+// createStereoBuffers creates a StereoViews buffer per frame in flight for
+// the primary window.
+func (app *HelloTriangleApplication) createStereoBuffers() error {
+	if !app.stereoWindow() {
+		return nil
+	}
+	frames := app.framesInFlight()
+	app.stereoBuffers = make([]*gpu.UniformBuffer[StereoViews], 0, frames)
+	for i := 0; i < frames; i++ {
+		b, err := gpu.NewUniformBuffer[StereoViews](app.gpuContext())
+		if err != nil {
+			return errors.Wrapf(err, "can't create stereo views buffer for frame %d", i)
+		}
+		app.name(b.Handle, "stereo views %d", i)
+		app.stereoBuffers = append(app.stereoBuffers, b)
+	}
+	return nil
+}
+
+// stereoWrites points the primary window's frame sets at their StereoViews.
+func (app *HelloTriangleApplication) stereoWrites(frame int, set vk.DescriptorSet) []vk.WriteDescriptorSet {
+	if app.stereoBuffers == nil {
+		return nil
+	}
+	return []vk.WriteDescriptorSet{{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          set,
+		DstBinding:      stereoBinding,
+		DescriptorType:  vk.DescriptorTypeUniformBuffer,
+		DescriptorCount: 1,
+		PBufferInfo: []vk.DescriptorBufferInfo{{
+			Buffer: app.stereoBuffers[frame].Handle,
+			Offset: 0,
+			Range:  app.stereoBuffers[frame].Size,
+		}},
+	}}
+}
+
+// updateStereoViews places the eyes either side of the camera, half the
+// separation along its right axis, each looking down its view. With a
+// headset frame to draw they're where the headset says instead.
+func (app *HelloTriangleApplication) updateStereoViews(frame int) error {
+	if app.stereoBuffers == nil {
+		return nil
+	}
+	if app.xrFrame != nil && app.xrFrame.ShouldRender {
+		return app.stereoBuffers[frame].Write(app.xrStereoViews())
+	}
+	extent := app.stereoEyeExtent()
+	view := app.camera.View()
+	proj := app.camera.Projection(float32(extent.Width) / float32(extent.Height))
+	half := app.stereoSeparation() / 2
+	return app.stereoBuffers[frame].Write(StereoViews{
+		// Moving an eye left moves the world right in its view
+		View: [2]vmath.Mat4{
+			vmath.Translate(vmath.Vec3{half, 0, 0}).Mul(view),
+			vmath.Translate(vmath.Vec3{-half, 0, 0}).Mul(view),
+		},
+		Proj: [2]vmath.Mat4{proj, proj},
+	})
+}
+
+// recordStereo draws the scene once for both eyes with multiview and blits
+// them side by side over the target image, left eye on the left, replacing
+// the mono scene before the overlays are drawn on top. With OpenXR they're
+// copied to the headset too. The ray traced sample takes priority when it's
+// switched on.
+func (app *HelloTriangleApplication) recordStereo(cb vk.CommandBuffer, frame int, imageIndex uint32) {
+	if app.stereoPipeline == vk.NullPipeline || app.rayTraced {
+		return
+	}
+	scope := app.profiler.Begin(cb, "stereo")
+	defer scope.End(cb)
+
+	extent := app.stereoEyeExtent()
+	vk.CmdBeginRenderPass(cb, &vk.RenderPassBeginInfo{
+		SType:       vk.StructureTypeRenderPassBeginInfo,
+		RenderPass:  app.stereoRenderPass,
+		Framebuffer: app.stereoFramebuffer,
+		RenderArea: vk.Rect2D{
+			Offset: vk.Offset2D{X: 0, Y: 0},
+			Extent: extent,
+		},
+		ClearValueCount: 2,
+		PClearValues: []vk.ClearValue{
+			vk.NewClearValue([]float32{0, 0, 0, 1}),
+			vk.NewClearDepthStencil(1, 0),
+		},
+	}, vk.SubpassContentsInline)
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, app.stereoPipeline)
+	drawConstants.Push(cb, app.pipelineLayout, app.currentDrawConstants())
+	app.drawObjects(cb, frame, 0, app.mesh.IndexCount, false, false)
+	vk.CmdEndRenderPass(cb)
+	app.stereoColor.Layout = vk.ImageLayoutTransferSrcOptimal
+
+	target := app.target.Images[imageIndex]
+	cmdTargetBarrier(cb, target, app.target.FinalLayout, vk.ImageLayoutTransferDstOptimal,
+		vk.AccessFlags(vk.AccessColorAttachmentWriteBit), vk.AccessFlags(vk.AccessTransferWriteBit),
+		vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit))
+	eye := vk.Offset3D{X: int32(extent.Width), Y: int32(extent.Height), Z: 1}
+	// Headset eyes are a different size to the window's halves
+	half := vk.Offset3D{X: int32(app.target.Extent.Width / 2), Y: int32(app.target.Extent.Height), Z: 1}
+	filter := vk.FilterNearest
+	if half != eye {
+		filter = vk.FilterLinear
+	}
+	blits := make([]vk.ImageBlit, 2)
+	for i := range blits {
+		left := int32(i) * half.X
+		blits[i] = vk.ImageBlit{
+			SrcSubresource: vk.ImageSubresourceLayers{
+				AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+				BaseArrayLayer: uint32(i),
+				LayerCount:     1,
+			},
+			SrcOffsets: [2]vk.Offset3D{{}, eye},
+			DstSubresource: vk.ImageSubresourceLayers{
+				AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+				LayerCount: 1,
+			},
+			DstOffsets: [2]vk.Offset3D{{X: left}, {X: left + half.X, Y: half.Y, Z: 1}},
+		}
+	}
+	vk.CmdBlitImage(cb, app.stereoColor.Handle, vk.ImageLayoutTransferSrcOptimal, target, vk.ImageLayoutTransferDstOptimal,
+		uint32(len(blits)), blits, filter)
+	// Back where the render pass left it for the overlays' render passes
+	cmdTargetBarrier(cb, target, vk.ImageLayoutTransferDstOptimal, app.target.FinalLayout,
+		vk.AccessFlags(vk.AccessTransferWriteBit), vk.AccessFlags(vk.AccessColorAttachmentReadBit|vk.AccessColorAttachmentWriteBit),
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit))
+
+	app.recordXR(cb)
+}
+
+func (app *HelloTriangleApplication) destroyStereoPipeline() {
+	if app.stereoPipeline != vk.NullPipeline {
+		app.destroyPipeline(app.stereoPipeline)
+		app.stereoPipeline = vk.NullPipeline
+	}
+}
+
+// destroyStereoTarget destroys the stereo render pass along with its
+// images, which all depend on the target's size or format.
+func (app *HelloTriangleApplication) destroyStereoTarget() {
+	if app.stereoFramebuffer != vk.NullFramebuffer {
+		app.release(app.stereoFramebuffer)
+		vk.DestroyFramebuffer(app.device, app.stereoFramebuffer, nil)
+		app.stereoFramebuffer = vk.NullFramebuffer
+	}
+	if app.stereoColor != nil {
+		app.stereoColor.Destroy()
+		app.stereoColor = nil
+	}
+	if app.stereoDepth != nil {
+		app.stereoDepth.Destroy()
+		app.stereoDepth = nil
+	}
+	if app.stereoRenderPass != vk.NullRenderPass {
+		vk.DestroyRenderPass(app.device, app.stereoRenderPass, nil)
+		app.stereoRenderPass = vk.NullRenderPass
+	}
+}
+
+func (app *HelloTriangleApplication) destroyStereoBuffers() {
+	for _, b := range app.stereoBuffers {
+		b.Destroy()
+	}
+	app.stereoBuffers = nil
+}
@@ -0,0 +1,17 @@
+#include <stddef.h>
+
+#include "surface.h"
+
+typedef void (*PFN_vkVoidFunction)(void);
+typedef PFN_vkVoidFunction (*PFN_vkGetInstanceProcAddr)(VkInstance instance, const char* pName);
+// Every platform's vkCreate*SurfaceKHR has this signature, only the create
+// info differs.
+typedef VkResult (*PFN_vkCreateSurfaceKHR)(VkInstance instance, const void* pCreateInfo, const void* pAllocator, VkSurfaceKHR* pSurface);
+
+VkResult createSurface(void* getInstanceProcAddr, VkInstance instance, const char* name, const void* createInfo, VkSurfaceKHR* surface) {
+	PFN_vkCreateSurfaceKHR create = (PFN_vkCreateSurfaceKHR)((PFN_vkGetInstanceProcAddr)getInstanceProcAddr)(instance, name);
+	if (create == NULL) {
+		return LV_ERROR_EXTENSION_NOT_PRESENT;
+	}
+	return create(instance, createInfo, NULL, surface);
+}
@@ -0,0 +1,54 @@
+// Package surface creates Vulkan surfaces for native windows the
+// application didn't open, for embedding the renderer in an existing
+// application's window or a compositor's surface without GLFW. Each
+// platform's window is behind build tags: Win32 on Windows, and Xlib, XCB
+// and Wayland elsewhere. Like interop, entry points are loaded through
+// vkGetInstanceProcAddr so the only C dependency is surface.h.
+package surface
+
+/*
+#include <stdlib.h>
+
+#include "surface.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Extension is VK_KHR_surface, which every platform's surface extension
+// builds on.
+const Extension = "VK_KHR_surface"
+
+// Window is a native window to create a surface for. The handles in it
+// belong to the embedder, who has to keep them alive until the surface is
+// destroyed.
+type Window interface {
+	// Extensions are the instance extensions creating the surface needs.
+	Extensions() []string
+	// createInfo is the vkCreate*SurfaceKHR entry point creating the
+	// surface and its create info.
+	createInfo() (string, unsafe.Pointer)
+}
+
+// Create creates a surface for w on instance, which has to have been
+// created with w's Extensions. It's destroyed with vk.DestroySurface.
+func Create(getInstanceProcAddr unsafe.Pointer, instance vk.Instance, w Window) (vk.Surface, error) {
+	if getInstanceProcAddr == nil {
+		return vk.NullSurface, errors.New("vkGetInstanceProcAddr is nil")
+	}
+	name, info := w.createInfo()
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var s C.VkSurfaceKHR
+	result := C.createSurface(getInstanceProcAddr, C.VkInstance(unsafe.Pointer(instance)), cName, info, &s)
+	if err := vk.Error(vk.Result(result)); err != nil {
+		return vk.NullSurface, errors.Wrapf(err, "can't create surface with %s", name)
+	}
+	return vk.SurfaceFromPointer(uintptr(unsafe.Pointer(s))), nil
+}
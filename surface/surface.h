@@ -0,0 +1,62 @@
+// The subset of VK_KHR_win32_surface, VK_KHR_xlib_surface,
+// VK_KHR_xcb_surface and VK_KHR_wayland_surface the package needs, declared
+// here so it builds without the Vulkan or windowing system headers. Layouts
+// follow vulkan_win32.h, vulkan_xlib.h, vulkan_xcb.h and vulkan_wayland.h.
+#ifndef LEARNVULKAN_SURFACE_H
+#define LEARNVULKAN_SURFACE_H
+
+#include <stdint.h>
+
+typedef struct VkInstance_T* VkInstance;
+typedef struct VkSurfaceKHR_T* VkSurfaceKHR;
+typedef int32_t VkResult;
+
+#define LV_STRUCTURE_TYPE_XLIB_SURFACE_CREATE_INFO_KHR 1000004000
+#define LV_STRUCTURE_TYPE_XCB_SURFACE_CREATE_INFO_KHR 1000005000
+#define LV_STRUCTURE_TYPE_WAYLAND_SURFACE_CREATE_INFO_KHR 1000006000
+#define LV_STRUCTURE_TYPE_WIN32_SURFACE_CREATE_INFO_KHR 1000009000
+#define LV_ERROR_EXTENSION_NOT_PRESENT -7
+
+// LVWin32SurfaceCreateInfo is laid out like VkWin32SurfaceCreateInfoKHR.
+typedef struct LVWin32SurfaceCreateInfo {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	void* hinstance;
+	void* hwnd;
+} LVWin32SurfaceCreateInfo;
+
+// LVXlibSurfaceCreateInfo is laid out like VkXlibSurfaceCreateInfoKHR, an
+// Xlib Window is an unsigned long XID.
+typedef struct LVXlibSurfaceCreateInfo {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	void* dpy;
+	unsigned long window;
+} LVXlibSurfaceCreateInfo;
+
+// LVXcbSurfaceCreateInfo is laid out like VkXcbSurfaceCreateInfoKHR.
+typedef struct LVXcbSurfaceCreateInfo {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	void* connection;
+	uint32_t window;
+} LVXcbSurfaceCreateInfo;
+
+// LVWaylandSurfaceCreateInfo is laid out like
+// VkWaylandSurfaceCreateInfoKHR.
+typedef struct LVWaylandSurfaceCreateInfo {
+	int32_t sType;
+	const void* pNext;
+	uint32_t flags;
+	void* display;
+	void* surface;
+} LVWaylandSurfaceCreateInfo;
+
+// createSurface looks up the instance entry point called name, one of the
+// vkCreate*SurfaceKHR functions, and calls it with createInfo.
+VkResult createSurface(void* getInstanceProcAddr, VkInstance instance, const char* name, const void* createInfo, VkSurfaceKHR* surface);
+
+#endif
@@ -0,0 +1,69 @@
+//go:build linux || freebsd
+
+package surface
+
+/*
+#include "surface.h"
+*/
+import "C"
+
+import "unsafe"
+
+// Xlib is an X11 window opened through Xlib, its Display* and Window.
+type Xlib struct {
+	Display unsafe.Pointer
+	Window  uint64
+}
+
+// Extensions are VK_KHR_surface and VK_KHR_xlib_surface.
+func (w Xlib) Extensions() []string {
+	return []string{Extension, "VK_KHR_xlib_surface"}
+}
+
+func (w Xlib) createInfo() (string, unsafe.Pointer) {
+	return "vkCreateXlibSurfaceKHR", unsafe.Pointer(&C.LVXlibSurfaceCreateInfo{
+		sType:  C.LV_STRUCTURE_TYPE_XLIB_SURFACE_CREATE_INFO_KHR,
+		dpy:    w.Display,
+		window: C.ulong(w.Window),
+	})
+}
+
+// XCB is an X11 window opened through XCB, its xcb_connection_t* and
+// xcb_window_t.
+type XCB struct {
+	Connection unsafe.Pointer
+	Window     uint32
+}
+
+// Extensions are VK_KHR_surface and VK_KHR_xcb_surface.
+func (w XCB) Extensions() []string {
+	return []string{Extension, "VK_KHR_xcb_surface"}
+}
+
+func (w XCB) createInfo() (string, unsafe.Pointer) {
+	return "vkCreateXcbSurfaceKHR", unsafe.Pointer(&C.LVXcbSurfaceCreateInfo{
+		sType:      C.LV_STRUCTURE_TYPE_XCB_SURFACE_CREATE_INFO_KHR,
+		connection: w.Connection,
+		window:     C.uint32_t(w.Window),
+	})
+}
+
+// Wayland is a wl_surface on a wl_display. Wayland surfaces have no size
+// of their own, the embedder decides it.
+type Wayland struct {
+	Display unsafe.Pointer
+	Surface unsafe.Pointer
+}
+
+// Extensions are VK_KHR_surface and VK_KHR_wayland_surface.
+func (w Wayland) Extensions() []string {
+	return []string{Extension, "VK_KHR_wayland_surface"}
+}
+
+func (w Wayland) createInfo() (string, unsafe.Pointer) {
+	return "vkCreateWaylandSurfaceKHR", unsafe.Pointer(&C.LVWaylandSurfaceCreateInfo{
+		sType:   C.LV_STRUCTURE_TYPE_WAYLAND_SURFACE_CREATE_INFO_KHR,
+		display: w.Display,
+		surface: w.Surface,
+	})
+}
@@ -0,0 +1,27 @@
+package surface
+
+/*
+#include "surface.h"
+*/
+import "C"
+
+import "unsafe"
+
+// Win32 is a window's HINSTANCE and HWND.
+type Win32 struct {
+	Instance unsafe.Pointer
+	Window   unsafe.Pointer
+}
+
+// Extensions are VK_KHR_surface and VK_KHR_win32_surface.
+func (w Win32) Extensions() []string {
+	return []string{Extension, "VK_KHR_win32_surface"}
+}
+
+func (w Win32) createInfo() (string, unsafe.Pointer) {
+	return "vkCreateWin32SurfaceKHR", unsafe.Pointer(&C.LVWin32SurfaceCreateInfo{
+		sType:     C.LV_STRUCTURE_TYPE_WIN32_SURFACE_CREATE_INFO_KHR,
+		hinstance: w.Instance,
+		hwnd:      w.Window,
+	})
+}
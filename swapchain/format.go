@@ -0,0 +1,27 @@
+package swapchain
+
+import (
+	"fmt"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// formatNames covers the formats surfaces commonly offer.
+var formatNames = map[vk.Format]string{
+	vk.FormatB8g8r8a8Srgb:           "B8G8R8A8_SRGB",
+	vk.FormatB8g8r8a8Unorm:          "B8G8R8A8_UNORM",
+	vk.FormatR8g8b8a8Srgb:           "R8G8B8A8_SRGB",
+	vk.FormatR8g8b8a8Unorm:          "R8G8B8A8_UNORM",
+	vk.FormatA2b10g10r10UnormPack32: "A2B10G10R10_UNORM",
+	vk.FormatA2r10g10b10UnormPack32: "A2R10G10B10_UNORM",
+	vk.FormatR16g16b16a16Sfloat:     "R16G16B16A16_SFLOAT",
+}
+
+// FormatName is f's name without the VK_FORMAT_ prefix, or its number for
+// formats surfaces don't usually offer.
+func FormatName(f vk.Format) string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("format %d", f)
+}
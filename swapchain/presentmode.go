@@ -0,0 +1,40 @@
+package swapchain
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// PresentModes are the present modes in the order they're cycled through,
+// FIFO first as it's the only one guaranteed to be available.
+var PresentModes = []vk.PresentMode{
+	vk.PresentModeFifo,
+	vk.PresentModeMailbox,
+	vk.PresentModeImmediate,
+	vk.PresentModeFifoRelaxed,
+}
+
+var presentModeNames = map[vk.PresentMode]string{
+	vk.PresentModeFifo:        "fifo",
+	vk.PresentModeMailbox:     "mailbox",
+	vk.PresentModeImmediate:   "immediate",
+	vk.PresentModeFifoRelaxed: "fifo-relaxed",
+}
+
+// PresentModeName is the name ParsePresentMode accepts for pm.
+func PresentModeName(pm vk.PresentMode) string {
+	if name, ok := presentModeNames[pm]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParsePresentMode parses fifo, mailbox, immediate or fifo-relaxed.
+func ParsePresentMode(name string) (vk.PresentMode, error) {
+	for pm, n := range presentModeNames {
+		if n == name {
+			return pm, nil
+		}
+	}
+	return 0, errors.Errorf("unknown present mode '%s', use fifo, mailbox, immediate or fifo-relaxed", name)
+}
@@ -0,0 +1,261 @@
+// Package swapchain negotiates and owns a Vulkan swapchain for a surface.
+package swapchain
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// SupportDetails is what a physical device supports for presenting to a surface.
+type SupportDetails struct {
+	Capabilities vk.SurfaceCapabilities
+	Formats      []vk.SurfaceFormat
+	PresentModes []vk.PresentMode
+}
+
+// Adequate reports whether there is at least one format and present mode to pick from.
+func (sd SupportDetails) Adequate() bool {
+	return len(sd.Formats) > 0 && len(sd.PresentModes) > 0
+}
+
+// QuerySupport gathers the surface capabilities, formats and present modes of a physical device.
+func QuerySupport(physicalDevice vk.PhysicalDevice, surface vk.Surface) (SupportDetails, error) {
+	var details SupportDetails
+
+	if err := vk.Error(vk.GetPhysicalDeviceSurfaceCapabilities(physicalDevice, surface, &details.Capabilities)); err != nil {
+		return details, errors.Wrap(err, "can't get surface capabilities")
+	}
+	details.Capabilities.Deref()
+	details.Capabilities.CurrentExtent.Deref()
+	details.Capabilities.MinImageExtent.Deref()
+	details.Capabilities.MaxImageExtent.Deref()
+
+	var formatCount uint32
+	if err := vk.Error(vk.GetPhysicalDeviceSurfaceFormats(physicalDevice, surface, &formatCount, nil)); err != nil {
+		return details, errors.Wrap(err, "can't get surface format count")
+	}
+	details.Formats = make([]vk.SurfaceFormat, formatCount)
+	if err := vk.Error(vk.GetPhysicalDeviceSurfaceFormats(physicalDevice, surface, &formatCount, details.Formats)); err != nil {
+		return details, errors.Wrap(err, "can't get surface formats")
+	}
+	for i := range details.Formats {
+		details.Formats[i].Deref()
+	}
+
+	var presentModeCount uint32
+	if err := vk.Error(vk.GetPhysicalDeviceSurfacePresentModes(physicalDevice, surface, &presentModeCount, nil)); err != nil {
+		return details, errors.Wrap(err, "can't get present mode count")
+	}
+	details.PresentModes = make([]vk.PresentMode, presentModeCount)
+	if err := vk.Error(vk.GetPhysicalDeviceSurfacePresentModes(physicalDevice, surface, &presentModeCount, details.PresentModes)); err != nil {
+		return details, errors.Wrap(err, "can't get present modes")
+	}
+
+	return details, nil
+}
+
+// Config describes the swapchain to create.
+type Config struct {
+	PhysicalDevice vk.PhysicalDevice
+	Device         vk.Device
+	Surface        vk.Surface
+
+	// FramebufferWidth and FramebufferHeight are the size of the window's
+	// framebuffer in pixels, used when the surface leaves the extent up to us.
+	FramebufferWidth  int
+	FramebufferHeight int
+
+	// QueueFamilyIndices are the families that will touch the swapchain images,
+	// more than one distinct family makes the images concurrently shared.
+	QueueFamilyIndices []uint32
+
+	// PresentModes are the preferred present modes, the first the surface
+	// supports is used. Empty prefers mailbox, FIFO is the fallback either way.
+	PresentModes []vk.PresentMode
+
+	// Formats are the preferred image formats, the first the surface
+	// supports in the sRGB nonlinear color space is used. Empty prefers
+	// 8 bit sRGB formats, the surface's first format is the fallback.
+	Formats []vk.Format
+
+	// Usage is added to COLOR_ATTACHMENT for the images, such as
+	// TRANSFER_SRC to read them back. It has to be supported by the surface.
+	Usage vk.ImageUsageFlags
+
+	// Logger reports the negotiated swapchain, nil uses logging.Default().
+	Logger logging.Logger
+}
+
+// Swapchain owns a vk.Swapchain and the images it presents.
+type Swapchain struct {
+	device vk.Device
+
+	Handle      vk.Swapchain
+	Images      []vk.Image
+	Format      vk.Format
+	ColorSpace  vk.ColorSpace
+	PresentMode vk.PresentMode
+	Extent      vk.Extent2D
+}
+
+// New negotiates a format, present mode and extent with the surface and creates the swapchain.
+func New(cfg Config) (*Swapchain, error) {
+	support, err := QuerySupport(cfg.PhysicalDevice, cfg.Surface)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't query swapchain support")
+	}
+	if !support.Adequate() {
+		return nil, errors.New("surface has no formats or present modes")
+	}
+
+	usage := vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit) | cfg.Usage
+	if unsupported := usage &^ support.Capabilities.SupportedUsageFlags; unsupported != 0 {
+		return nil, errors.Errorf("surface doesn't support swapchain image usage %#x", unsupported)
+	}
+
+	surfaceFormat := chooseSurfaceFormat(support.Formats, cfg.Formats)
+	presentMode := choosePresentMode(support.PresentModes, cfg.PresentModes)
+	extent := chooseExtent(support.Capabilities, cfg.FramebufferWidth, cfg.FramebufferHeight)
+
+	// One more than the minimum so we don't wait on the driver before acquiring
+	imageCount := support.Capabilities.MinImageCount + 1
+	if max := support.Capabilities.MaxImageCount; max > 0 && imageCount > max {
+		imageCount = max
+	}
+
+	createInfo := &vk.SwapchainCreateInfo{
+		SType:            vk.StructureTypeSwapchainCreateInfo,
+		Surface:          cfg.Surface,
+		MinImageCount:    imageCount,
+		ImageFormat:      surfaceFormat.Format,
+		ImageColorSpace:  surfaceFormat.ColorSpace,
+		ImageExtent:      extent,
+		ImageArrayLayers: 1,
+		ImageUsage:       usage,
+		ImageSharingMode: vk.SharingModeExclusive,
+		PreTransform:     support.Capabilities.CurrentTransform,
+		CompositeAlpha:   vk.CompositeAlphaOpaqueBit,
+		PresentMode:      presentMode,
+		Clipped:          vk.True,
+		OldSwapchain:     vk.NullSwapchain,
+	}
+
+	if len(cfg.QueueFamilyIndices) > 1 {
+		createInfo.ImageSharingMode = vk.SharingModeConcurrent
+		createInfo.QueueFamilyIndexCount = uint32(len(cfg.QueueFamilyIndices))
+		createInfo.PQueueFamilyIndices = cfg.QueueFamilyIndices
+	}
+
+	var handle vk.Swapchain
+	if err := vk.Error(vk.CreateSwapchain(cfg.Device, createInfo, nil, &handle)); err != nil {
+		return nil, errors.Wrap(err, "can't create swapchain")
+	}
+
+	sc := &Swapchain{
+		device:      cfg.Device,
+		Handle:      handle,
+		Format:      surfaceFormat.Format,
+		ColorSpace:  surfaceFormat.ColorSpace,
+		PresentMode: presentMode,
+		Extent:      extent,
+	}
+
+	var swapchainImageCount uint32
+	if err := vk.Error(vk.GetSwapchainImages(cfg.Device, handle, &swapchainImageCount, nil)); err != nil {
+		sc.Destroy()
+		return nil, errors.Wrap(err, "can't get swapchain image count")
+	}
+	sc.Images = make([]vk.Image, swapchainImageCount)
+	if err := vk.Error(vk.GetSwapchainImages(cfg.Device, handle, &swapchainImageCount, sc.Images)); err != nil {
+		sc.Destroy()
+		return nil, errors.Wrap(err, "can't get swapchain images")
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+	logger.Info("Created swapchain",
+		logging.F("width", extent.Width),
+		logging.F("height", extent.Height),
+		logging.F("images", len(sc.Images)),
+		logging.F("format", sc.Format),
+		logging.F("presentMode", PresentModeName(sc.PresentMode)),
+	)
+
+	return sc, nil
+}
+
+// Destroy releases the swapchain, its images are owned by it and go with it.
+func (sc *Swapchain) Destroy() {
+	if sc.Handle != vk.NullSwapchain {
+		vk.DestroySwapchain(sc.device, sc.Handle, nil)
+		sc.Handle = vk.NullSwapchain
+	}
+	sc.Images = nil
+}
+
+func chooseSurfaceFormat(available []vk.SurfaceFormat, preferred []vk.Format) vk.SurfaceFormat {
+	if len(preferred) == 0 {
+		preferred = []vk.Format{vk.FormatB8g8r8a8Srgb, vk.FormatR8g8b8a8Srgb}
+	}
+
+	// The surface has no preferred format so we can pick the one we want
+	if len(available) == 1 && available[0].Format == vk.FormatUndefined {
+		return vk.SurfaceFormat{
+			Format:     preferred[0],
+			ColorSpace: vk.ColorSpaceSrgbNonlinear,
+		}
+	}
+
+	for _, want := range preferred {
+		for _, f := range available {
+			if f.Format == want && f.ColorSpace == vk.ColorSpaceSrgbNonlinear {
+				return f
+			}
+		}
+	}
+
+	return available[0]
+}
+
+func choosePresentMode(available, preferred []vk.PresentMode) vk.PresentMode {
+	if len(preferred) == 0 {
+		preferred = []vk.PresentMode{vk.PresentModeMailbox}
+	}
+	for _, want := range preferred {
+		for _, pm := range available {
+			if pm == want {
+				return pm
+			}
+		}
+	}
+
+	// FIFO is the only mode guaranteed to be available
+	return vk.PresentModeFifo
+}
+
+func chooseExtent(capabilities vk.SurfaceCapabilities, framebufferWidth, framebufferHeight int) vk.Extent2D {
+	// The window manager already decided the extent for us
+	if capabilities.CurrentExtent.Width != math.MaxUint32 {
+		return capabilities.CurrentExtent
+	}
+
+	return vk.Extent2D{
+		Width:  clamp(uint32(framebufferWidth), capabilities.MinImageExtent.Width, capabilities.MaxImageExtent.Width),
+		Height: clamp(uint32(framebufferHeight), capabilities.MinImageExtent.Height, capabilities.MaxImageExtent.Height),
+	}
+}
+
+func clamp(v, min, max uint32) uint32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
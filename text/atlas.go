@@ -0,0 +1,100 @@
+// Package text draws screen space text from a signed distance field atlas
+// of a built in 8x8 bitmap font, so it stays sharp at any size. Strings
+// are batched into quads that are drawn over a render target in one go.
+package text
+
+import "math"
+
+const (
+	firstRune = ' '
+	lastRune  = '~'
+	// glyphSize is the width and height of a glyph in font pixels.
+	glyphSize = 8
+	// texelsPerPixel is how many atlas texels a font pixel covers.
+	texelsPerPixel = 4
+	// padding is the texels around each glyph in its cell, wide enough for
+	// the distance field to fall off and outlines to fit.
+	padding = 8
+	// cellSize is a glyph's cell in the atlas, in texels.
+	cellSize = glyphSize*texelsPerPixel + 2*padding
+	// spread is the distance in texels from an edge at which the field
+	// reaches 0 outside a glyph and 1 inside.
+	spread = padding
+	// atlasColumns is how many cells there are in a row of the atlas.
+	atlasColumns = 16
+)
+
+// Atlas is a single channel signed distance field of every glyph, 0.5
+// being the glyph's edge. Glyphs are in rows of cells in rune order.
+type Atlas struct {
+	Width, Height int
+	Pixels        []byte
+}
+
+// BakeAtlas renders the font into an atlas. Distances are measured to the
+// edges of the font's square pixels, so corners stay square at any size.
+func BakeAtlas() *Atlas {
+	glyphs := int(lastRune - firstRune + 1)
+	rows := (glyphs + atlasColumns - 1) / atlasColumns
+	a := &Atlas{
+		Width:  atlasColumns * cellSize,
+		Height: rows * cellSize,
+	}
+	a.Pixels = make([]byte, a.Width*a.Height)
+
+	for r := rune(firstRune); r <= lastRune; r++ {
+		cellX, cellY := a.cell(r)
+		for ty := 0; ty < cellSize; ty++ {
+			for tx := 0; tx < cellSize; tx++ {
+				// Texel centre in font pixels
+				px := (float64(tx-padding) + 0.5) / texelsPerPixel
+				py := (float64(ty-padding) + 0.5) / texelsPerPixel
+				d := edgeDistance(r, px, py) * texelsPerPixel
+				v := 0.5 + d/(2*spread)
+				a.Pixels[(cellY+ty)*a.Width+cellX+tx] = byte(math.Round(255 * math.Max(0, math.Min(1, v))))
+			}
+		}
+	}
+	return a
+}
+
+// cell is the top left texel of r's cell.
+func (a *Atlas) cell(r rune) (x, y int) {
+	i := int(r - firstRune)
+	return (i % atlasColumns) * cellSize, (i / atlasColumns) * cellSize
+}
+
+// edgeDistance is the signed distance, in font pixels, from x, y to the
+// nearest edge of r's glyph, positive inside it.
+func edgeDistance(r rune, x, y float64) float64 {
+	inside := glyphPixel(r, int(math.Floor(x)), int(math.Floor(y)))
+	// Anything further than spread away clamps to 0 or 1 anyway
+	reach := int(math.Ceil(float64(spread)/texelsPerPixel)) + 1
+	cx, cy := int(math.Floor(x)), int(math.Floor(y))
+	nearest := math.Inf(1)
+	for py := cy - reach; py <= cy+reach; py++ {
+		for px := cx - reach; px <= cx+reach; px++ {
+			if glyphPixel(r, px, py) == inside {
+				continue
+			}
+			dx := math.Max(0, math.Max(float64(px)-x, x-float64(px+1)))
+			dy := math.Max(0, math.Max(float64(py)-y, y-float64(py+1)))
+			nearest = math.Min(nearest, math.Hypot(dx, dy))
+		}
+	}
+	if inside {
+		return nearest
+	}
+	return -nearest
+}
+
+// texCoords are the normalized corners of r's cell, '?' standing in for
+// runes the font doesn't have.
+func (a *Atlas) texCoords(r rune) (u0, v0, u1, v1 float32) {
+	if r < firstRune || r > lastRune {
+		r = '?'
+	}
+	x, y := a.cell(r)
+	return float32(x) / float32(a.Width), float32(y) / float32(a.Height),
+		float32(x+cellSize) / float32(a.Width), float32(y+cellSize) / float32(a.Height)
+}
@@ -0,0 +1,483 @@
+package text
+
+import (
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/renderpass"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// minBufferSize is the smallest per frame vertex buffer, so the first few
+// frames don't grow it every time.
+const minBufferSize = 64 << 10
+
+// quadVertices is the two triangles drawn per glyph.
+const quadVertices = 6
+
+// LineHeight is how far apart lines of text size pixels tall are.
+func LineHeight(size float32) float32 {
+	return size * 1.25
+}
+
+// Vertex is a corner of a glyph's quad, matching text.vert's inputs.
+type Vertex struct {
+	// Position is in pixels from the target's top left.
+	Position [2]float32
+	TexCoord [2]float32
+	Color    [4]float32
+}
+
+// transform maps pixels to clip space, matching the push_constant block in
+// text.vert.
+type transform struct {
+	Scale     [2]float32
+	Translate [2]float32
+}
+
+var transformConstants = pipeline.NewPushConstants[transform](vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0)
+
+// frameBuffer is the vertices of one frame in flight.
+type frameBuffer struct {
+	vertices *gpu.Buffer
+	count    uint32
+}
+
+// Renderer draws text queued with Print into the images of a render target,
+// on top of what's already there. Everything but the target lives as long
+// as the renderer, the target has to be recreated with the swapchain.
+type Renderer struct {
+	ctx gpu.Context
+
+	vert, frag  vk.ShaderModule
+	setLayout   vk.DescriptorSetLayout
+	layout      vk.PipelineLayout
+	descriptors *descriptors.Allocator
+	atlasSet    vk.DescriptorSet
+	atlas       *Atlas
+	font        *gpu.Image
+	sampler     vk.Sampler
+	frames      []frameBuffer
+	// queued are the vertices printed since the last Upload.
+	queued []Vertex
+
+	renderPass   vk.RenderPass
+	pipeline     vk.Pipeline
+	framebuffers []vk.Framebuffer
+	extent       vk.Extent2D
+}
+
+// NewRenderer creates a renderer with frames frames in flight from the
+// SPIR-V of text.vert and text.frag, baking and uploading the font atlas.
+func NewRenderer(ctx gpu.Context, vert, frag []byte, frames int) (*Renderer, error) {
+	r := &Renderer{
+		ctx:    ctx,
+		frames: make([]frameBuffer, frames),
+	}
+
+	var err error
+	if r.vert, err = pipeline.NewShaderModule(ctx.Device, vert); err != nil {
+		return nil, errors.Wrap(err, "can't create text vertex shader")
+	}
+	if r.frag, err = pipeline.NewShaderModule(ctx.Device, frag); err != nil {
+		r.Destroy()
+		return nil, errors.Wrap(err, "can't create text fragment shader")
+	}
+
+	atlasBinding := pipeline.StageBinding{Stages: vk.ShaderStageFlags(vk.ShaderStageFragmentBit)}
+	atlasBinding.Type = vk.DescriptorTypeCombinedImageSampler
+	atlasBinding.Count = 1
+	bindings := []pipeline.StageBinding{atlasBinding}
+
+	layouts, err := pipeline.NewSetLayouts(ctx.Device, bindings)
+	if err != nil {
+		r.Destroy()
+		return nil, err
+	}
+	r.setLayout = layouts[0]
+
+	if r.layout, err = pipeline.NewLayout(ctx.Device, layouts, []vk.PushConstantRange{transformConstants.Range()}); err != nil {
+		r.Destroy()
+		return nil, err
+	}
+
+	if err := r.createFont(); err != nil {
+		r.Destroy()
+		return nil, errors.Wrap(err, "can't create font atlas")
+	}
+
+	r.descriptors = descriptors.NewAllocator(ctx.Device, descriptors.Ratios(bindings), 1)
+	if r.atlasSet, err = r.descriptors.Allocate(r.setLayout); err != nil {
+		r.Destroy()
+		return nil, err
+	}
+	vk.UpdateDescriptorSets(ctx.Device, 1, []vk.WriteDescriptorSet{{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          r.atlasSet,
+		DstBinding:      0,
+		DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+		DescriptorCount: 1,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+			ImageView:   r.font.View,
+			Sampler:     r.sampler,
+		}},
+	}}, 0, nil)
+	return r, nil
+}
+
+// createFont bakes and uploads the font atlas and creates the sampler it's
+// read with. The distance field is filtered linearly, which keeps edges
+// smooth when it's magnified.
+func (r *Renderer) createFont() error {
+	r.atlas = BakeAtlas()
+	size := vk.DeviceSize(len(r.atlas.Pixels))
+
+	staging, err := gpu.NewBuffer(r.ctx, size, vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit), memory.CPUToGPU)
+	if err != nil {
+		return errors.Wrap(err, "can't create staging buffer")
+	}
+	defer staging.Destroy()
+	if err := staging.Upload(r.atlas.Pixels); err != nil {
+		return err
+	}
+
+	r.font, err = gpu.NewImage(r.ctx, gpu.ImageInfo{
+		Width:  uint32(r.atlas.Width),
+		Height: uint32(r.atlas.Height),
+		Format: vk.FormatR8Unorm,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.font.CopyFromBuffer(staging); err != nil {
+		return err
+	}
+	if err := r.font.TransitionTo(vk.ImageLayoutShaderReadOnlyOptimal); err != nil {
+		return err
+	}
+
+	samplerInfo := &vk.SamplerCreateInfo{
+		SType:        vk.StructureTypeSamplerCreateInfo,
+		MagFilter:    vk.FilterLinear,
+		MinFilter:    vk.FilterLinear,
+		MipmapMode:   vk.SamplerMipmapModeNearest,
+		AddressModeU: vk.SamplerAddressModeClampToEdge,
+		AddressModeV: vk.SamplerAddressModeClampToEdge,
+		AddressModeW: vk.SamplerAddressModeClampToEdge,
+		BorderColor:  vk.BorderColorFloatTransparentBlack,
+	}
+	if err := vk.Error(vk.CreateSampler(r.ctx.Device, samplerInfo, nil, &r.sampler)); err != nil {
+		return errors.Wrap(err, "can't create font sampler")
+	}
+	return nil
+}
+
+// CreateTarget creates the render pass, pipeline and framebuffers for
+// drawing into views, images of format that are in finalLayout both before
+// and after the text is drawn.
+func (r *Renderer) CreateTarget(format vk.Format, finalLayout vk.ImageLayout, views []vk.ImageView, extent vk.Extent2D) error {
+	// Text is drawn over the frame, which has to be loaded and finished first
+	b := renderpass.NewBuilder()
+	attachment := renderpass.ColorAttachment(format, vk.SampleCount1Bit, finalLayout)
+	attachment.LoadOp = vk.AttachmentLoadOpLoad
+	attachment.InitialLayout = finalLayout
+	color := b.Attachment(attachment)
+	b.Subpass(renderpass.Subpass{Colors: []uint32{color}})
+	b.Dependency(vk.SubpassDependency{
+		SrcSubpass:    vk.SubpassExternal,
+		DstSubpass:    0,
+		SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		SrcAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+		DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		DstAccessMask: vk.AccessFlags(vk.AccessColorAttachmentReadBit | vk.AccessColorAttachmentWriteBit),
+	})
+
+	var err error
+	if r.renderPass, err = b.Build(r.ctx.Device); err != nil {
+		return errors.Wrap(err, "can't build text render pass")
+	}
+	r.extent = extent
+	if err := r.createPipeline(); err != nil {
+		r.DestroyTarget()
+		return err
+	}
+
+	for i, view := range views {
+		createInfo := &vk.FramebufferCreateInfo{
+			SType:           vk.StructureTypeFramebufferCreateInfo,
+			RenderPass:      r.renderPass,
+			AttachmentCount: 1,
+			PAttachments:    []vk.ImageView{view},
+			Width:           extent.Width,
+			Height:          extent.Height,
+			Layers:          1,
+		}
+		var fb vk.Framebuffer
+		if err := vk.Error(vk.CreateFramebuffer(r.ctx.Device, createInfo, nil, &fb)); err != nil {
+			r.DestroyTarget()
+			return errors.Wrapf(err, "can't create text framebuffer %d", i)
+		}
+		r.framebuffers = append(r.framebuffers, fb)
+	}
+	return nil
+}
+
+func (r *Renderer) createPipeline() error {
+	stages := []vk.PipelineShaderStageCreateInfo{
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageVertexBit,
+			Module: r.vert,
+			PName:  "main\x00",
+		},
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageFragmentBit,
+			Module: r.frag,
+			PName:  "main\x00",
+		},
+	}
+
+	vertexInput := &vk.PipelineVertexInputStateCreateInfo{
+		SType:                         vk.StructureTypePipelineVertexInputStateCreateInfo,
+		VertexBindingDescriptionCount: 1,
+		PVertexBindingDescriptions: []vk.VertexInputBindingDescription{{
+			Binding:   0,
+			Stride:    uint32(unsafe.Sizeof(Vertex{})),
+			InputRate: vk.VertexInputRateVertex,
+		}},
+		VertexAttributeDescriptionCount: 3,
+		PVertexAttributeDescriptions: []vk.VertexInputAttributeDescription{
+			{Location: 0, Binding: 0, Format: vk.FormatR32g32Sfloat, Offset: uint32(unsafe.Offsetof(Vertex{}.Position))},
+			{Location: 1, Binding: 0, Format: vk.FormatR32g32Sfloat, Offset: uint32(unsafe.Offsetof(Vertex{}.TexCoord))},
+			{Location: 2, Binding: 0, Format: vk.FormatR32g32b32a32Sfloat, Offset: uint32(unsafe.Offsetof(Vertex{}.Color))},
+		},
+	}
+
+	inputAssembly := &vk.PipelineInputAssemblyStateCreateInfo{
+		SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+		Topology: vk.PrimitiveTopologyTriangleList,
+	}
+
+	viewportState := &vk.PipelineViewportStateCreateInfo{
+		SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+		ViewportCount: 1,
+		PViewports: []vk.Viewport{{
+			Width:    float32(r.extent.Width),
+			Height:   float32(r.extent.Height),
+			MinDepth: 0,
+			MaxDepth: 1,
+		}},
+		ScissorCount: 1,
+		PScissors:    []vk.Rect2D{{Extent: r.extent}},
+	}
+
+	rasterizer := &vk.PipelineRasterizationStateCreateInfo{
+		SType:       vk.StructureTypePipelineRasterizationStateCreateInfo,
+		PolygonMode: vk.PolygonModeFill,
+		CullMode:    vk.CullModeFlags(vk.CullModeNone),
+		FrontFace:   vk.FrontFaceCounterClockwise,
+		LineWidth:   1,
+	}
+
+	multisampling := &vk.PipelineMultisampleStateCreateInfo{
+		SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+		RasterizationSamples: vk.SampleCount1Bit,
+	}
+
+	colorBlending := &vk.PipelineColorBlendStateCreateInfo{
+		SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+		AttachmentCount: 1,
+		PAttachments: []vk.PipelineColorBlendAttachmentState{{
+			BlendEnable:         vk.True,
+			SrcColorBlendFactor: vk.BlendFactorSrcAlpha,
+			DstColorBlendFactor: vk.BlendFactorOneMinusSrcAlpha,
+			ColorBlendOp:        vk.BlendOpAdd,
+			SrcAlphaBlendFactor: vk.BlendFactorOne,
+			DstAlphaBlendFactor: vk.BlendFactorOneMinusSrcAlpha,
+			AlphaBlendOp:        vk.BlendOpAdd,
+			ColorWriteMask: vk.ColorComponentFlags(
+				vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit,
+			),
+		}},
+	}
+
+	pipelineInfos := []vk.GraphicsPipelineCreateInfo{{
+		SType:               vk.StructureTypeGraphicsPipelineCreateInfo,
+		StageCount:          uint32(len(stages)),
+		PStages:             stages,
+		PVertexInputState:   vertexInput,
+		PInputAssemblyState: inputAssembly,
+		PViewportState:      viewportState,
+		PRasterizationState: rasterizer,
+		PMultisampleState:   multisampling,
+		PColorBlendState:    colorBlending,
+		Layout:              r.layout,
+		RenderPass:          r.renderPass,
+		Subpass:             0,
+		BasePipelineIndex:   -1,
+	}}
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(r.ctx.Device, vk.NullPipelineCache, 1, pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create text pipeline")
+	}
+	r.pipeline = pipelines[0]
+	return nil
+}
+
+// DestroyTarget destroys what CreateTarget created.
+func (r *Renderer) DestroyTarget() {
+	for _, fb := range r.framebuffers {
+		vk.DestroyFramebuffer(r.ctx.Device, fb, nil)
+	}
+	r.framebuffers = nil
+	if r.pipeline != vk.NullPipeline {
+		vk.DestroyPipeline(r.ctx.Device, r.pipeline, nil)
+		r.pipeline = vk.NullPipeline
+	}
+	if r.renderPass != vk.NullRenderPass {
+		vk.DestroyRenderPass(r.ctx.Device, r.renderPass, nil)
+		r.renderPass = vk.NullRenderPass
+	}
+}
+
+// Print queues s to be drawn size pixels tall with its top left at x, y
+// pixels from the target's top left, returning the y of the line after
+// it. Newlines start a new line at x, runes the font doesn't have are
+// drawn as '?'.
+func (r *Renderer) Print(x, y, size float32, color [4]float32, s string) float32 {
+	scale := size / glyphSize
+	// The quad covers the glyph's padding too, for its outline
+	pad := float32(padding) / texelsPerPixel * scale
+	quad := float32(cellSize) / texelsPerPixel * scale
+
+	penX := x
+	for _, c := range s {
+		if c == '\n' {
+			penX = x
+			y += LineHeight(size)
+			continue
+		}
+		u0, v0, u1, v1 := r.atlas.texCoords(c)
+		x0, y0 := penX-pad, y-pad
+		x1, y1 := x0+quad, y0+quad
+		r.queued = append(r.queued,
+			Vertex{Position: [2]float32{x0, y0}, TexCoord: [2]float32{u0, v0}, Color: color},
+			Vertex{Position: [2]float32{x1, y0}, TexCoord: [2]float32{u1, v0}, Color: color},
+			Vertex{Position: [2]float32{x1, y1}, TexCoord: [2]float32{u1, v1}, Color: color},
+			Vertex{Position: [2]float32{x1, y1}, TexCoord: [2]float32{u1, v1}, Color: color},
+			Vertex{Position: [2]float32{x0, y1}, TexCoord: [2]float32{u0, v1}, Color: color},
+			Vertex{Position: [2]float32{x0, y0}, TexCoord: [2]float32{u0, v0}, Color: color},
+		)
+		penX += size
+	}
+	return y + LineHeight(size)
+}
+
+// Upload copies the text printed since the last Upload into frame's
+// buffer, growing it when it doesn't fit, and starts a new batch. frame's
+// previous commands must have finished executing.
+func (r *Renderer) Upload(frame int) error {
+	buffer := &r.frames[frame]
+	size := len(r.queued) * int(unsafe.Sizeof(Vertex{}))
+	var err error
+	if buffer.vertices, err = r.fit(buffer.vertices, size); err != nil {
+		return errors.Wrap(err, "can't grow text vertex buffer")
+	}
+	if size > 0 {
+		copy(buffer.vertices.Mapped(), unsafe.Slice((*byte)(unsafe.Pointer(&r.queued[0])), size))
+	}
+	buffer.count = uint32(len(r.queued))
+	r.queued = r.queued[:0]
+	return nil
+}
+
+// Record records drawing the text uploaded for frame into the target's
+// image imageIndex, returning how many draw calls it recorded.
+func (r *Renderer) Record(cb vk.CommandBuffer, frame int, imageIndex uint32) int {
+	buffer := r.frames[frame]
+	if buffer.count == 0 {
+		return 0
+	}
+
+	vk.CmdBeginRenderPass(cb, &vk.RenderPassBeginInfo{
+		SType:       vk.StructureTypeRenderPassBeginInfo,
+		RenderPass:  r.renderPass,
+		Framebuffer: r.framebuffers[imageIndex],
+		RenderArea:  vk.Rect2D{Extent: r.extent},
+	}, vk.SubpassContentsInline)
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, r.pipeline)
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, r.layout, 0, 1, []vk.DescriptorSet{r.atlasSet}, 0, nil)
+	vk.CmdBindVertexBuffers(cb, 0, 1, []vk.Buffer{buffer.vertices.Handle}, []vk.DeviceSize{0})
+	transformConstants.Push(cb, r.layout, transform{
+		Scale:     [2]float32{2 / float32(r.extent.Width), 2 / float32(r.extent.Height)},
+		Translate: [2]float32{-1, -1},
+	})
+	vk.CmdDraw(cb, buffer.count, 1, 0, 0)
+	vk.CmdEndRenderPass(cb)
+	return 1
+}
+
+// fit returns b if it holds size bytes, otherwise a new host visible
+// vertex buffer twice as big as needed in place of it.
+func (r *Renderer) fit(b *gpu.Buffer, size int) (*gpu.Buffer, error) {
+	if b != nil && vk.DeviceSize(size) <= b.Size {
+		return b, nil
+	}
+	if b != nil {
+		b.Destroy()
+	}
+	capacity := 2 * size
+	if capacity < minBufferSize {
+		capacity = minBufferSize
+	}
+	return gpu.NewBuffer(r.ctx, vk.DeviceSize(capacity), vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit), memory.CPUToGPU)
+}
+
+// Destroy destroys the renderer along with its target. Nothing it recorded
+// can still be executing.
+func (r *Renderer) Destroy() {
+	r.DestroyTarget()
+	for _, buffer := range r.frames {
+		if buffer.vertices != nil {
+			buffer.vertices.Destroy()
+		}
+	}
+	r.frames = nil
+
+	device := r.ctx.Device
+	if r.descriptors != nil {
+		r.descriptors.Destroy()
+		r.descriptors = nil
+	}
+	if r.sampler != vk.NullSampler {
+		vk.DestroySampler(device, r.sampler, nil)
+		r.sampler = vk.NullSampler
+	}
+	if r.font != nil {
+		r.font.Destroy()
+		r.font = nil
+	}
+	if r.layout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(device, r.layout, nil)
+		r.layout = vk.NullPipelineLayout
+	}
+	if r.setLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(device, r.setLayout, nil)
+		r.setLayout = vk.NullDescriptorSetLayout
+	}
+	for _, module := range []vk.ShaderModule{r.vert, r.frag} {
+		if module != vk.NullShaderModule {
+			vk.DestroyShaderModule(device, module, nil)
+		}
+	}
+	r.vert, r.frag = vk.NullShaderModule, vk.NullShaderModule
+}
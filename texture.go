@@ -0,0 +1,155 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	_ "image/jpeg" // register JPEG decoding for image.Decode
+	_ "image/png"  // register PNG decoding for image.Decode
+	"io"
+	"os"
+
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const texturePath = "textures/texture.png"
+
+// LODConfig controls which mip levels the texture sampler reads from.
+type LODConfig struct {
+	// MinLOD and MaxLOD clamp the level of detail, 0 being the full size
+	// image, use vk.LodClampNone for MaxLOD to allow the whole chain.
+	MinLOD float32
+	MaxLOD float32
+	// Bias is added to the computed level of detail, positive values pick
+	// smaller mips and blur the texture.
+	Bias float32
+}
+
+var defaultLODConfig = LODConfig{
+	MinLOD: 0,
+	MaxLOD: vk.LodClampNone,
+	Bias:   0,
+}
+
+// loadRGBA decodes a PNG or JPEG file into tightly packed 8 bit RGBA pixels.
+func loadRGBA(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open image '%s'", path)
+	}
+	defer f.Close()
+
+	rgba, err := decodeRGBA(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't decode image '%s'", path)
+	}
+	return rgba, nil
+}
+
+// decodeRGBA decodes PNG or JPEG data into tightly packed 8 bit RGBA pixels.
+func decodeRGBA(r io.Reader) (*image.RGBA, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba, nil
+}
+
+func (app *HelloTriangleApplication) createTextureImage() error {
+	pixels, err := loadRGBA(texturePath)
+	if err != nil {
+		return errors.Wrap(err, "can't load texture")
+	}
+
+	img, err := app.createTexture(pixels, vk.FormatR8g8b8a8Srgb, "texture '"+texturePath+"'")
+	if err != nil {
+		return err
+	}
+	app.textureImage = img
+	return nil
+}
+
+// createTexture uploads pixels to a sampled image of format with a full mip
+// chain. format is sRGB for colors and UNORM for data like normals.
+func (app *HelloTriangleApplication) createTexture(pixels *image.RGBA, format vk.Format, name string) (*gpu.Image, error) {
+	width, height := uint32(pixels.Rect.Dx()), uint32(pixels.Rect.Dy())
+	mipLevels := mipLevelsFor(width, height)
+
+	img, err := gpu.NewImage(app.gpuContext(), gpu.ImageInfo{
+		Width:     width,
+		Height:    height,
+		MipLevels: mipLevels,
+		Format:    format,
+		Tiling:    vk.ImageTilingOptimal,
+		// Mip levels are blitted from each other so the image is also a transfer source
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageTransferSrcBit | vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't create %s image", name)
+	}
+	app.name(img.Handle, "%s", name)
+
+	if err := app.uploader.Image(img, pixels.Pix); err != nil {
+		img.Destroy()
+		return nil, errors.Wrapf(err, "can't stage %s pixels", name)
+	}
+	if err := app.generateMipmaps(img); err != nil {
+		img.Destroy()
+		return nil, errors.Wrapf(err, "can't generate %s mipmaps", name)
+	}
+	return img, nil
+}
+
+func (app *HelloTriangleApplication) createTextureSampler() error {
+	var properties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(app.physicalDevice, &properties)
+	properties.Deref()
+	properties.Limits.Deref()
+
+	lod := defaultLODConfig
+	if app.TextureLOD != nil {
+		lod = *app.TextureLOD
+	}
+	if lod.MinLOD > lod.MaxLOD {
+		return errors.Errorf("texture min LOD %g is above max LOD %g", lod.MinLOD, lod.MaxLOD)
+	}
+	if lod.Bias != 0 && app.portability != nil && !app.portability.SamplerMipLodBias() {
+		app.logger.Warn("Ignoring texture LOD bias", logging.F("bias", lod.Bias), logging.F("reason", "no samplerMipLodBias portability feature"))
+		lod.Bias = 0
+	}
+
+	samplerInfo := &vk.SamplerCreateInfo{
+		SType:                   vk.StructureTypeSamplerCreateInfo,
+		MagFilter:               vk.FilterLinear,
+		MinFilter:               vk.FilterLinear,
+		AddressModeU:            vk.SamplerAddressModeRepeat,
+		AddressModeV:            vk.SamplerAddressModeRepeat,
+		AddressModeW:            vk.SamplerAddressModeRepeat,
+		AnisotropyEnable:        vk.True,
+		MaxAnisotropy:           properties.Limits.MaxSamplerAnisotropy,
+		BorderColor:             vk.BorderColorIntOpaqueBlack,
+		UnnormalizedCoordinates: vk.False,
+		CompareEnable:           vk.False,
+		CompareOp:               vk.CompareOpAlways,
+		MipmapMode:              vk.SamplerMipmapModeLinear,
+		MipLodBias:              lod.Bias,
+		MinLod:                  lod.MinLOD,
+		MaxLod:                  lod.MaxLOD,
+	}
+
+	var sampler vk.Sampler
+	if err := vk.Error(vk.CreateSampler(app.device, samplerInfo, nil, &sampler)); err != nil {
+		return errors.Wrap(err, "can't create texture sampler")
+	}
+	app.track("sampler", sampler)
+	app.textureSampler = sampler
+	return nil
+}
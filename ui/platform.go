@@ -0,0 +1,136 @@
+// Package ui draws Dear ImGui windows over a frame, feeding it GLFW input and
+// rendering its draw lists with Vulkan in a render pass of its own.
+package ui
+
+import (
+	"time"
+
+	"github.com/inkyblackness/imgui-go/v4"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+// mouseButtons are the GLFW buttons ImGui knows as left, right and middle.
+var mouseButtons = []glfw.MouseButton{glfw.MouseButton1, glfw.MouseButton2, glfw.MouseButton3}
+
+// keys maps ImGui's navigation and shortcut keys to GLFW's.
+var keys = map[int]glfw.Key{
+	imgui.KeyTab:        glfw.KeyTab,
+	imgui.KeyLeftArrow:  glfw.KeyLeft,
+	imgui.KeyRightArrow: glfw.KeyRight,
+	imgui.KeyUpArrow:    glfw.KeyUp,
+	imgui.KeyDownArrow:  glfw.KeyDown,
+	imgui.KeyPageUp:     glfw.KeyPageUp,
+	imgui.KeyPageDown:   glfw.KeyPageDown,
+	imgui.KeyHome:       glfw.KeyHome,
+	imgui.KeyEnd:        glfw.KeyEnd,
+	imgui.KeyInsert:     glfw.KeyInsert,
+	imgui.KeyDelete:     glfw.KeyDelete,
+	imgui.KeyBackspace:  glfw.KeyBackspace,
+	imgui.KeySpace:      glfw.KeySpace,
+	imgui.KeyEnter:      glfw.KeyEnter,
+	imgui.KeyEscape:     glfw.KeyEscape,
+	imgui.KeyA:          glfw.KeyA,
+	imgui.KeyC:          glfw.KeyC,
+	imgui.KeyV:          glfw.KeyV,
+	imgui.KeyX:          glfw.KeyX,
+	imgui.KeyY:          glfw.KeyY,
+	imgui.KeyZ:          glfw.KeyZ,
+}
+
+// Platform owns the ImGui context and feeds it a GLFW window's input. The
+// mouse is polled every frame, keys, characters and scrolling only arrive
+// through callbacks so the window's callbacks have to pass them on. ImGui
+// has a single current context, so there's one Platform at a time.
+type Platform struct {
+	context *imgui.Context
+	io      imgui.IO
+	window  *glfw.Window
+	// scroll is the scrolling since the last frame.
+	scroll    imgui.Vec2
+	lastFrame time.Time
+}
+
+// NewPlatform creates an ImGui context for window. Settings aren't saved to
+// imgui.ini so runs don't leave files behind.
+func NewPlatform(window *glfw.Window) *Platform {
+	p := &Platform{
+		context: imgui.CreateContext(nil),
+		io:      imgui.CurrentIO(),
+		window:  window,
+	}
+	p.io.SetIniFilename("")
+	for imguiKey, glfwKey := range keys {
+		p.io.KeyMap(imguiKey, int(glfwKey))
+	}
+	return p
+}
+
+// Key passes on a key event from the window's key callback.
+func (p *Platform) Key(key glfw.Key, action glfw.Action) {
+	switch action {
+	case glfw.Press:
+		p.io.KeyPress(int(key))
+	case glfw.Release:
+		p.io.KeyRelease(int(key))
+	}
+	p.io.KeyCtrl(int(glfw.KeyLeftControl), int(glfw.KeyRightControl))
+	p.io.KeyShift(int(glfw.KeyLeftShift), int(glfw.KeyRightShift))
+	p.io.KeyAlt(int(glfw.KeyLeftAlt), int(glfw.KeyRightAlt))
+	p.io.KeySuper(int(glfw.KeyLeftSuper), int(glfw.KeyRightSuper))
+}
+
+// Char passes on typed text from the window's char callback.
+func (p *Platform) Char(char rune) {
+	p.io.AddInputCharacters(string(char))
+}
+
+// Scroll passes on scrolling from the window's scroll callback.
+func (p *Platform) Scroll(x, y float64) {
+	p.scroll.X += float32(x)
+	p.scroll.Y += float32(y)
+}
+
+// WantsMouse reports whether the mouse is over ImGui, so the application
+// should ignore it.
+func (p *Platform) WantsMouse() bool {
+	return p.io.WantCaptureMouse()
+}
+
+// WantsKeyboard reports whether ImGui has keyboard focus, so the
+// application should ignore keys.
+func (p *Platform) WantsKeyboard() bool {
+	return p.io.WantCaptureKeyboard()
+}
+
+// NewFrame starts an ImGui frame with the window's current size and mouse.
+// Build windows after it and finish with imgui.Render.
+func (p *Platform) NewFrame() {
+	now := time.Now()
+	dt := float32(1) / 60
+	if !p.lastFrame.IsZero() {
+		dt = float32(now.Sub(p.lastFrame).Seconds())
+	}
+	p.lastFrame = now
+	p.io.SetDeltaTime(dt)
+
+	width, height := p.window.GetSize()
+	p.io.SetDisplaySize(imgui.Vec2{X: float32(width), Y: float32(height)})
+
+	x, y := p.window.GetCursorPos()
+	p.io.SetMousePosition(imgui.Vec2{X: float32(x), Y: float32(y)})
+	for i, button := range mouseButtons {
+		p.io.SetMouseButtonDown(i, p.window.GetMouseButton(button) == glfw.Press)
+	}
+	p.io.AddMouseWheelDelta(p.scroll.X, p.scroll.Y)
+	p.scroll = imgui.Vec2{}
+
+	imgui.NewFrame()
+}
+
+// Destroy destroys the ImGui context.
+func (p *Platform) Destroy() {
+	if p.context != nil {
+		p.context.Destroy()
+		p.context = nil
+	}
+}
@@ -0,0 +1,523 @@
+package ui
+
+import (
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/memory"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/renderpass"
+	"github.com/inkyblackness/imgui-go/v4"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// fontTextureID is the font atlas's texture ID, the only texture drawn.
+const fontTextureID imgui.TextureID = 1
+
+// minBufferSize is the smallest per frame vertex or index buffer, so the
+// first few frames don't grow them every time.
+const minBufferSize = 64 << 10
+
+// transform maps ImGui's display coordinates to clip space, matching the
+// push_constant block in ui.vert.
+type transform struct {
+	Scale     [2]float32
+	Translate [2]float32
+}
+
+var transformConstants = pipeline.NewPushConstants[transform](vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0)
+
+// frameBuffers are the vertices and indices of one frame in flight.
+type frameBuffers struct {
+	vertices *gpu.Buffer
+	indices  *gpu.Buffer
+}
+
+// Renderer draws ImGui's draw data into the images of a render target, on
+// top of what's already there. Everything but the target lives as long as
+// the renderer, the target has to be recreated with the swapchain.
+type Renderer struct {
+	ctx gpu.Context
+
+	vert, frag  vk.ShaderModule
+	setLayout   vk.DescriptorSetLayout
+	layout      vk.PipelineLayout
+	descriptors *descriptors.Allocator
+	fontSet     vk.DescriptorSet
+	font        *gpu.Image
+	sampler     vk.Sampler
+	frames      []frameBuffers
+
+	renderPass   vk.RenderPass
+	pipeline     vk.Pipeline
+	framebuffers []vk.Framebuffer
+	extent       vk.Extent2D
+}
+
+// NewRenderer creates a renderer with frames frames in flight from the
+// SPIR-V of ui.vert and ui.frag, uploading the current ImGui context's font
+// atlas.
+func NewRenderer(ctx gpu.Context, vert, frag []byte, frames int) (*Renderer, error) {
+	r := &Renderer{
+		ctx:    ctx,
+		frames: make([]frameBuffers, frames),
+	}
+
+	var err error
+	if r.vert, err = pipeline.NewShaderModule(ctx.Device, vert); err != nil {
+		return nil, errors.Wrap(err, "can't create UI vertex shader")
+	}
+	if r.frag, err = pipeline.NewShaderModule(ctx.Device, frag); err != nil {
+		r.Destroy()
+		return nil, errors.Wrap(err, "can't create UI fragment shader")
+	}
+
+	fontBinding := pipeline.StageBinding{Stages: vk.ShaderStageFlags(vk.ShaderStageFragmentBit)}
+	fontBinding.Type = vk.DescriptorTypeCombinedImageSampler
+	fontBinding.Count = 1
+	bindings := []pipeline.StageBinding{fontBinding}
+
+	layouts, err := pipeline.NewSetLayouts(ctx.Device, bindings)
+	if err != nil {
+		r.Destroy()
+		return nil, err
+	}
+	r.setLayout = layouts[0]
+
+	if r.layout, err = pipeline.NewLayout(ctx.Device, layouts, []vk.PushConstantRange{transformConstants.Range()}); err != nil {
+		r.Destroy()
+		return nil, err
+	}
+
+	if err := r.createFont(); err != nil {
+		r.Destroy()
+		return nil, errors.Wrap(err, "can't create font atlas")
+	}
+
+	r.descriptors = descriptors.NewAllocator(ctx.Device, descriptors.Ratios(bindings), 1)
+	if r.fontSet, err = r.descriptors.Allocate(r.setLayout); err != nil {
+		r.Destroy()
+		return nil, err
+	}
+	vk.UpdateDescriptorSets(ctx.Device, 1, []vk.WriteDescriptorSet{{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          r.fontSet,
+		DstBinding:      0,
+		DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+		DescriptorCount: 1,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+			ImageView:   r.font.View,
+			Sampler:     r.sampler,
+		}},
+	}}, 0, nil)
+	return r, nil
+}
+
+// createFont uploads the font atlas and creates the sampler it's read with.
+func (r *Renderer) createFont() error {
+	fonts := imgui.CurrentIO().Fonts()
+	atlas := fonts.TextureDataRGBA32()
+	size := vk.DeviceSize(atlas.Width * atlas.Height * 4)
+
+	staging, err := gpu.NewBuffer(r.ctx, size, vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit), memory.CPUToGPU)
+	if err != nil {
+		return errors.Wrap(err, "can't create staging buffer")
+	}
+	defer staging.Destroy()
+	if err := staging.Upload(unsafe.Slice((*byte)(atlas.Pixels), size)); err != nil {
+		return err
+	}
+
+	r.font, err = gpu.NewImage(r.ctx, gpu.ImageInfo{
+		Width:  uint32(atlas.Width),
+		Height: uint32(atlas.Height),
+		Format: vk.FormatR8g8b8a8Unorm,
+		Tiling: vk.ImageTilingOptimal,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageTransferDstBit | vk.ImageUsageSampledBit),
+		Memory: memory.GPUOnly,
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.font.CopyFromBuffer(staging); err != nil {
+		return err
+	}
+	if err := r.font.TransitionTo(vk.ImageLayoutShaderReadOnlyOptimal); err != nil {
+		return err
+	}
+	fonts.SetTextureID(fontTextureID)
+
+	samplerInfo := &vk.SamplerCreateInfo{
+		SType:        vk.StructureTypeSamplerCreateInfo,
+		MagFilter:    vk.FilterLinear,
+		MinFilter:    vk.FilterLinear,
+		MipmapMode:   vk.SamplerMipmapModeLinear,
+		AddressModeU: vk.SamplerAddressModeClampToEdge,
+		AddressModeV: vk.SamplerAddressModeClampToEdge,
+		AddressModeW: vk.SamplerAddressModeClampToEdge,
+		MaxLod:       1,
+		BorderColor:  vk.BorderColorFloatTransparentBlack,
+	}
+	if err := vk.Error(vk.CreateSampler(r.ctx.Device, samplerInfo, nil, &r.sampler)); err != nil {
+		return errors.Wrap(err, "can't create font sampler")
+	}
+	return nil
+}
+
+// CreateTarget creates the render pass, pipeline and framebuffers for
+// drawing into views, images of format that are in finalLayout both before
+// and after the UI is drawn.
+func (r *Renderer) CreateTarget(format vk.Format, finalLayout vk.ImageLayout, views []vk.ImageView, extent vk.Extent2D) error {
+	// The UI is drawn over the frame, which has to be loaded and finished first
+	b := renderpass.NewBuilder()
+	attachment := renderpass.ColorAttachment(format, vk.SampleCount1Bit, finalLayout)
+	attachment.LoadOp = vk.AttachmentLoadOpLoad
+	attachment.InitialLayout = finalLayout
+	color := b.Attachment(attachment)
+	b.Subpass(renderpass.Subpass{Colors: []uint32{color}})
+	b.Dependency(vk.SubpassDependency{
+		SrcSubpass:    vk.SubpassExternal,
+		DstSubpass:    0,
+		SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		SrcAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+		DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		DstAccessMask: vk.AccessFlags(vk.AccessColorAttachmentReadBit | vk.AccessColorAttachmentWriteBit),
+	})
+
+	var err error
+	if r.renderPass, err = b.Build(r.ctx.Device); err != nil {
+		return errors.Wrap(err, "can't build UI render pass")
+	}
+	if err := r.createPipeline(); err != nil {
+		r.DestroyTarget()
+		return err
+	}
+
+	r.extent = extent
+	for i, view := range views {
+		createInfo := &vk.FramebufferCreateInfo{
+			SType:           vk.StructureTypeFramebufferCreateInfo,
+			RenderPass:      r.renderPass,
+			AttachmentCount: 1,
+			PAttachments:    []vk.ImageView{view},
+			Width:           extent.Width,
+			Height:          extent.Height,
+			Layers:          1,
+		}
+		var fb vk.Framebuffer
+		if err := vk.Error(vk.CreateFramebuffer(r.ctx.Device, createInfo, nil, &fb)); err != nil {
+			r.DestroyTarget()
+			return errors.Wrapf(err, "can't create UI framebuffer %d", i)
+		}
+		r.framebuffers = append(r.framebuffers, fb)
+	}
+	return nil
+}
+
+func (r *Renderer) createPipeline() error {
+	vertexSize, posOffset, uvOffset, colorOffset := imgui.VertexBufferLayout()
+
+	stages := []vk.PipelineShaderStageCreateInfo{
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageVertexBit,
+			Module: r.vert,
+			PName:  "main\x00",
+		},
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageFragmentBit,
+			Module: r.frag,
+			PName:  "main\x00",
+		},
+	}
+
+	vertexInput := &vk.PipelineVertexInputStateCreateInfo{
+		SType:                         vk.StructureTypePipelineVertexInputStateCreateInfo,
+		VertexBindingDescriptionCount: 1,
+		PVertexBindingDescriptions: []vk.VertexInputBindingDescription{{
+			Binding:   0,
+			Stride:    uint32(vertexSize),
+			InputRate: vk.VertexInputRateVertex,
+		}},
+		VertexAttributeDescriptionCount: 3,
+		PVertexAttributeDescriptions: []vk.VertexInputAttributeDescription{
+			{Location: 0, Binding: 0, Format: vk.FormatR32g32Sfloat, Offset: uint32(posOffset)},
+			{Location: 1, Binding: 0, Format: vk.FormatR32g32Sfloat, Offset: uint32(uvOffset)},
+			// Colors are packed as 8 bit RGBA
+			{Location: 2, Binding: 0, Format: vk.FormatR8g8b8a8Unorm, Offset: uint32(colorOffset)},
+		},
+	}
+
+	inputAssembly := &vk.PipelineInputAssemblyStateCreateInfo{
+		SType:    vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+		Topology: vk.PrimitiveTopologyTriangleList,
+	}
+
+	// The viewport and scissor change with the target and every draw command
+	viewportState := &vk.PipelineViewportStateCreateInfo{
+		SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+		ViewportCount: 1,
+		ScissorCount:  1,
+	}
+	dynamicStates := []vk.DynamicState{vk.DynamicStateViewport, vk.DynamicStateScissor}
+	dynamicState := &vk.PipelineDynamicStateCreateInfo{
+		SType:             vk.StructureTypePipelineDynamicStateCreateInfo,
+		DynamicStateCount: uint32(len(dynamicStates)),
+		PDynamicStates:    dynamicStates,
+	}
+
+	rasterizer := &vk.PipelineRasterizationStateCreateInfo{
+		SType:       vk.StructureTypePipelineRasterizationStateCreateInfo,
+		PolygonMode: vk.PolygonModeFill,
+		CullMode:    vk.CullModeFlags(vk.CullModeNone),
+		FrontFace:   vk.FrontFaceCounterClockwise,
+		LineWidth:   1,
+	}
+
+	multisampling := &vk.PipelineMultisampleStateCreateInfo{
+		SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+		RasterizationSamples: vk.SampleCount1Bit,
+	}
+
+	colorBlending := &vk.PipelineColorBlendStateCreateInfo{
+		SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+		AttachmentCount: 1,
+		PAttachments: []vk.PipelineColorBlendAttachmentState{{
+			BlendEnable:         vk.True,
+			SrcColorBlendFactor: vk.BlendFactorSrcAlpha,
+			DstColorBlendFactor: vk.BlendFactorOneMinusSrcAlpha,
+			ColorBlendOp:        vk.BlendOpAdd,
+			SrcAlphaBlendFactor: vk.BlendFactorOne,
+			DstAlphaBlendFactor: vk.BlendFactorOneMinusSrcAlpha,
+			AlphaBlendOp:        vk.BlendOpAdd,
+			ColorWriteMask: vk.ColorComponentFlags(
+				vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit,
+			),
+		}},
+	}
+
+	pipelineInfos := []vk.GraphicsPipelineCreateInfo{{
+		SType:               vk.StructureTypeGraphicsPipelineCreateInfo,
+		StageCount:          uint32(len(stages)),
+		PStages:             stages,
+		PVertexInputState:   vertexInput,
+		PInputAssemblyState: inputAssembly,
+		PViewportState:      viewportState,
+		PRasterizationState: rasterizer,
+		PMultisampleState:   multisampling,
+		PColorBlendState:    colorBlending,
+		PDynamicState:       dynamicState,
+		Layout:              r.layout,
+		RenderPass:          r.renderPass,
+		Subpass:             0,
+		BasePipelineIndex:   -1,
+	}}
+	pipelines := make([]vk.Pipeline, 1)
+	if err := vk.Error(vk.CreateGraphicsPipelines(r.ctx.Device, vk.NullPipelineCache, 1, pipelineInfos, nil, pipelines)); err != nil {
+		return errors.Wrap(err, "can't create UI pipeline")
+	}
+	r.pipeline = pipelines[0]
+	return nil
+}
+
+// DestroyTarget destroys what CreateTarget created.
+func (r *Renderer) DestroyTarget() {
+	for _, fb := range r.framebuffers {
+		vk.DestroyFramebuffer(r.ctx.Device, fb, nil)
+	}
+	r.framebuffers = nil
+	if r.pipeline != vk.NullPipeline {
+		vk.DestroyPipeline(r.ctx.Device, r.pipeline, nil)
+		r.pipeline = vk.NullPipeline
+	}
+	if r.renderPass != vk.NullRenderPass {
+		vk.DestroyRenderPass(r.ctx.Device, r.renderPass, nil)
+		r.renderPass = vk.NullRenderPass
+	}
+}
+
+// Upload copies data's vertices and indices into frame's buffers, growing
+// them when they don't fit. frame's previous commands must have finished
+// executing.
+func (r *Renderer) Upload(frame int, data imgui.DrawData) error {
+	if !data.Valid() {
+		return nil
+	}
+	lists := data.CommandLists()
+	var verticesSize, indicesSize int
+	for _, list := range lists {
+		_, v := list.VertexBuffer()
+		_, i := list.IndexBuffer()
+		verticesSize += v
+		indicesSize += i
+	}
+
+	buffers := &r.frames[frame]
+	var err error
+	if buffers.vertices, err = r.fit(buffers.vertices, verticesSize, vk.BufferUsageVertexBufferBit); err != nil {
+		return errors.Wrap(err, "can't grow UI vertex buffer")
+	}
+	if buffers.indices, err = r.fit(buffers.indices, indicesSize, vk.BufferUsageIndexBufferBit); err != nil {
+		return errors.Wrap(err, "can't grow UI index buffer")
+	}
+
+	// Lists go one after the other, Record offsets each list's draws to match
+	vertices, indices := buffers.vertices.Mapped(), buffers.indices.Mapped()
+	var vertexOffset, indexOffset int
+	for _, list := range lists {
+		v, vSize := list.VertexBuffer()
+		i, iSize := list.IndexBuffer()
+		vertexOffset += copy(vertices[vertexOffset:], unsafe.Slice((*byte)(v), vSize))
+		indexOffset += copy(indices[indexOffset:], unsafe.Slice((*byte)(i), iSize))
+	}
+	return nil
+}
+
+// Record records drawing data, already uploaded for frame, into the
+// target's image imageIndex. displaySize is the size ImGui laid the frame
+// out for. It returns how many draw calls it recorded.
+func (r *Renderer) Record(cb vk.CommandBuffer, frame int, imageIndex uint32, data imgui.DrawData, displaySize imgui.Vec2) int {
+	if !data.Valid() || displaySize.X <= 0 || displaySize.Y <= 0 {
+		return 0
+	}
+	lists := data.CommandLists()
+
+	renderPassInfo := &vk.RenderPassBeginInfo{
+		SType:       vk.StructureTypeRenderPassBeginInfo,
+		RenderPass:  r.renderPass,
+		Framebuffer: r.framebuffers[imageIndex],
+		RenderArea: vk.Rect2D{
+			Extent: r.extent,
+		},
+	}
+	vk.CmdBeginRenderPass(cb, renderPassInfo, vk.SubpassContentsInline)
+	defer vk.CmdEndRenderPass(cb)
+	if len(lists) == 0 {
+		return 0
+	}
+
+	buffers := r.frames[frame]
+	indexType := vk.IndexTypeUint16
+	if imgui.IndexBufferLayout() == 4 {
+		indexType = vk.IndexTypeUint32
+	}
+	vk.CmdBindPipeline(cb, vk.PipelineBindPointGraphics, r.pipeline)
+	vk.CmdBindDescriptorSets(cb, vk.PipelineBindPointGraphics, r.layout, 0, 1, []vk.DescriptorSet{r.fontSet}, 0, nil)
+	vk.CmdBindVertexBuffers(cb, 0, 1, []vk.Buffer{buffers.vertices.Handle}, []vk.DeviceSize{0})
+	vk.CmdBindIndexBuffer(cb, buffers.indices.Handle, 0, indexType)
+	vk.CmdSetViewport(cb, 0, 1, []vk.Viewport{{
+		Width:    float32(r.extent.Width),
+		Height:   float32(r.extent.Height),
+		MinDepth: 0,
+		MaxDepth: 1,
+	}})
+	transformConstants.Push(cb, r.layout, transform{
+		Scale:     [2]float32{2 / displaySize.X, 2 / displaySize.Y},
+		Translate: [2]float32{-1, -1},
+	})
+
+	// Clip rectangles are in display coordinates, the framebuffer may have
+	// more pixels than that on HiDPI screens
+	scaleX := float32(r.extent.Width) / displaySize.X
+	scaleY := float32(r.extent.Height) / displaySize.Y
+
+	vertexSize, _, _, _ := imgui.VertexBufferLayout()
+	var firstIndex, firstVertex, draws int
+	for _, list := range lists {
+		_, verticesSize := list.VertexBuffer()
+		for _, cmd := range list.Commands() {
+			if cmd.HasUserCallback() {
+				cmd.CallUserCallback(list)
+				continue
+			}
+			clip := cmd.ClipRect()
+			x0, y0 := clamp(clip.X*scaleX, r.extent.Width), clamp(clip.Y*scaleY, r.extent.Height)
+			x1, y1 := clamp(clip.Z*scaleX, r.extent.Width), clamp(clip.W*scaleY, r.extent.Height)
+			if x1 > x0 && y1 > y0 {
+				vk.CmdSetScissor(cb, 0, 1, []vk.Rect2D{{
+					Offset: vk.Offset2D{X: int32(x0), Y: int32(y0)},
+					Extent: vk.Extent2D{Width: x1 - x0, Height: y1 - y0},
+				}})
+				vk.CmdDrawIndexed(cb, uint32(cmd.ElementCount()), 1, uint32(firstIndex), int32(firstVertex), 0)
+				draws++
+			}
+			firstIndex += cmd.ElementCount()
+		}
+		firstVertex += verticesSize / vertexSize
+	}
+	return draws
+}
+
+// fit returns b if it holds size bytes, otherwise a new host visible buffer
+// twice as big as needed in place of it.
+func (r *Renderer) fit(b *gpu.Buffer, size int, usage vk.BufferUsageFlagBits) (*gpu.Buffer, error) {
+	if b != nil && vk.DeviceSize(size) <= b.Size {
+		return b, nil
+	}
+	if b != nil {
+		b.Destroy()
+	}
+	capacity := 2 * size
+	if capacity < minBufferSize {
+		capacity = minBufferSize
+	}
+	return gpu.NewBuffer(r.ctx, vk.DeviceSize(capacity), vk.BufferUsageFlags(usage), memory.CPUToGPU)
+}
+
+// Destroy destroys the renderer along with its target. Nothing it recorded
+// can still be executing.
+func (r *Renderer) Destroy() {
+	r.DestroyTarget()
+	for _, buffers := range r.frames {
+		if buffers.vertices != nil {
+			buffers.vertices.Destroy()
+		}
+		if buffers.indices != nil {
+			buffers.indices.Destroy()
+		}
+	}
+	r.frames = nil
+
+	device := r.ctx.Device
+	if r.descriptors != nil {
+		r.descriptors.Destroy()
+		r.descriptors = nil
+	}
+	if r.sampler != vk.NullSampler {
+		vk.DestroySampler(device, r.sampler, nil)
+		r.sampler = vk.NullSampler
+	}
+	if r.font != nil {
+		r.font.Destroy()
+		r.font = nil
+	}
+	if r.layout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(device, r.layout, nil)
+		r.layout = vk.NullPipelineLayout
+	}
+	if r.setLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(device, r.setLayout, nil)
+		r.setLayout = vk.NullDescriptorSetLayout
+	}
+	for _, module := range []vk.ShaderModule{r.vert, r.frag} {
+		if module != vk.NullShaderModule {
+			vk.DestroyShaderModule(device, module, nil)
+		}
+	}
+	r.vert, r.frag = vk.NullShaderModule, vk.NullShaderModule
+}
+
+// clamp limits a clip coordinate to the framebuffer.
+func clamp(v float32, max uint32) uint32 {
+	switch {
+	case v < 0:
+		return 0
+	case v > float32(max):
+		return max
+	}
+	return uint32(v)
+}
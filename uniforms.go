@@ -0,0 +1,239 @@
+package main
+
+import (
+	"math"
+
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/pipeline"
+	"github.com/delaneyj/learnvulkan/spirv"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// UniformBufferObject matches the std140 layout of the vertex shader's UBO.
+// LightViewProj places the object in the shadow map.
+type UniformBufferObject struct {
+	Model         vmath.Mat4
+	View          vmath.Mat4
+	Proj          vmath.Mat4
+	LightViewProj vmath.Mat4
+}
+
+// uniformBinding is the binding of the UniformBufferObject, it's bound as a
+// dynamic uniform buffer with an object per offset.
+const uniformBinding = 0
+
+// objectGridSpacing is the distance between neighbouring objects.
+const objectGridSpacing = 1.2
+
+// mergeShaderBindings combines the shaders' bindings, with the
+// UniformBufferObject made dynamic and the texture table sized when
+// bindless.
+func (app *HelloTriangleApplication) mergeShaderBindings(modules ...*spirv.Module) ([]pipeline.StageBinding, error) {
+	bindings, err := pipeline.MergeBindings(modules...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't merge shader bindings")
+	}
+	if err := pipeline.MakeDynamic(bindings, 0, uniformBinding); err != nil {
+		return nil, errors.Wrap(err, "can't make the uniform buffer dynamic")
+	}
+	if app.bindless {
+		if err := pipeline.MakeBindless(bindings, materialSet, bindlessTexturesBinding, maxBindlessTextures); err != nil {
+			return nil, errors.Wrap(err, "can't make the texture table bindless")
+		}
+	}
+	return bindings, nil
+}
+
+// createDescriptorSetLayout builds the layouts from the bindings the shaders
+// declare, the per object set 0 and the material set, and the meshlet set
+// when mesh shading. Set 0 also has stereo.vert's views when stereo.
+func (app *HelloTriangleApplication) createDescriptorSetLayout() error {
+	vert, frag, err := app.reflectShaders()
+	if err != nil {
+		return err
+	}
+	meshlets, err := app.reflectMeshletShaders()
+	if err != nil {
+		return err
+	}
+
+	stereo, err := app.reflectStereoShader()
+	if err != nil {
+		return err
+	}
+
+	modules := append([]*spirv.Module{vert, frag}, meshlets...)
+	bindings, err := app.mergeShaderBindings(append(modules, stereo...)...)
+	if err != nil {
+		return err
+	}
+
+	layouts, err := pipeline.NewSetLayouts(app.device, bindings)
+	if err != nil {
+		return err
+	}
+	sets := materialSet + 1
+	if meshlets != nil {
+		sets = meshletSet + 1
+	}
+	if len(layouts) != sets {
+		for _, l := range layouts {
+			vk.DestroyDescriptorSetLayout(app.device, l, nil)
+		}
+		return errors.Errorf("shaders use %d descriptor sets, expected %d", len(layouts), sets)
+	}
+
+	app.descriptorSetLayout = layouts[0]
+	app.materialSetLayout = layouts[materialSet]
+	if meshlets != nil {
+		app.meshletSetLayout = layouts[meshletSet]
+	}
+	app.shaderBindings = bindings
+	return nil
+}
+
+// objectCount is how many copies of the mesh are drawn.
+func (app *HelloTriangleApplication) objectCount() int {
+	if app.Objects < 1 {
+		return 1
+	}
+	return app.Objects
+}
+
+// objectPosition places object i of count on a square grid centred on the
+// origin.
+func objectPosition(i, count int) vmath.Vec3 {
+	side := int(math.Ceil(math.Sqrt(float64(count))))
+	centre := float32(side-1) / 2
+	x, y := float32(i%side), float32(i/side)
+	return vmath.Vec3{(x - centre) * objectGridSpacing, (y - centre) * objectGridSpacing, 0}
+}
+
+// createUniformBuffers creates a dynamic uniform buffer per frame in flight
+// with a UniformBufferObject for every object, and the frames' lights and
+// poses.
+func (app *HelloTriangleApplication) createUniformBuffers() error {
+	var properties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(app.physicalDevice, &properties)
+	properties.Deref()
+	properties.Limits.Deref()
+	alignment := properties.Limits.MinUniformBufferOffsetAlignment
+
+	frames := app.framesInFlight()
+	app.uniformBuffers = make([]*gpu.DynamicUniformBuffer[UniformBufferObject], 0, frames)
+	for i := 0; i < frames; i++ {
+		b, err := gpu.NewDynamicUniformBuffer[UniformBufferObject](app.gpuContext(), app.objectCount(), alignment)
+		if err != nil {
+			return errors.Wrapf(err, "can't create uniform buffer for frame %d", i)
+		}
+		app.name(b.Handle, "uniform buffer %d", i)
+		app.uniformBuffers = append(app.uniformBuffers, b)
+	}
+	if err := app.createLightBuffers(); err != nil {
+		return err
+	}
+	if err := app.createPoseBuffers(); err != nil {
+		return err
+	}
+	return app.createStereoBuffers()
+}
+
+// createDescriptorAllocators creates the allocator for the window's long
+// lived sets and one per frame in flight for transient sets, which is reset
+// once the frame's fence has been waited on. Pools are sized by the shaders'
+// bindings, the lighting, bloom and particle passes' included, and more are created
+// as they fill up.
+func (app *HelloTriangleApplication) createDescriptorAllocators() {
+	var bindings []pipeline.StageBinding
+	for _, b := range [][]pipeline.StageBinding{app.shaderBindings, app.lightingBindings, app.bloomBindings, app.compositeBindings, app.particleBindings} {
+		bindings = append(bindings, b...)
+	}
+	ratios := descriptors.Ratios(bindings)
+	frames := app.framesInFlight()
+
+	app.descriptorAllocator = descriptors.NewAllocator(app.device, ratios, uint32(frames))
+	app.transientDescriptors = make([]*descriptors.Allocator, frames)
+	for i := range app.transientDescriptors {
+		app.transientDescriptors[i] = descriptors.NewAllocator(app.device, ratios, 0)
+	}
+}
+
+func (app *HelloTriangleApplication) createDescriptorSets() error {
+	app.descriptorSets = make([]vk.DescriptorSet, app.framesInFlight())
+	for i := range app.descriptorSets {
+		set, err := app.descriptorAllocator.Allocate(app.descriptorSetLayout)
+		if err != nil {
+			return errors.Wrapf(err, "can't allocate descriptor set for frame %d", i)
+		}
+		app.descriptorSets[i] = set
+	}
+
+	for i, set := range app.descriptorSets {
+		writes := []vk.WriteDescriptorSet{
+			{
+				SType:           vk.StructureTypeWriteDescriptorSet,
+				DstSet:          set,
+				DstBinding:      uniformBinding,
+				DstArrayElement: 0,
+				DescriptorType:  vk.DescriptorTypeUniformBufferDynamic,
+				DescriptorCount: 1,
+				PBufferInfo: []vk.DescriptorBufferInfo{{
+					Buffer: app.uniformBuffers[i].Handle,
+					Offset: 0,
+					Range:  app.uniformBuffers[i].Range,
+				}},
+			},
+			{
+				SType:           vk.StructureTypeWriteDescriptorSet,
+				DstSet:          set,
+				DstBinding:      shadowBinding,
+				DstArrayElement: 0,
+				DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+				DescriptorCount: 1,
+				PImageInfo: []vk.DescriptorImageInfo{{
+					ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+					ImageView:   app.shadowMap.View,
+					Sampler:     app.shadowSampler,
+				}},
+			},
+		}
+		writes = append(writes, app.frameLightsWrites(i, set)...)
+		writes = append(writes, app.stereoWrites(i, set)...)
+		writes = append(writes, app.skinWrites(i, set)...)
+		vk.UpdateDescriptorSets(app.device, uint32(len(writes)), writes, 0, nil)
+	}
+	return nil
+}
+
+// updateUniformBuffer places every object in the scene's draw list and
+// views them through the current window's camera, culling those outside
+// its frustum, and uploads the list's lights and the animated pose.
+func (app *HelloTriangleApplication) updateUniformBuffer(frame int) error {
+	extent := app.target.Extent
+
+	ubo := UniformBufferObject{
+		View:          app.camera.View(),
+		Proj:          app.camera.Projection(float32(extent.Width) / float32(extent.Height)),
+		LightViewProj: app.lightViewProj(),
+	}
+	buffer := app.uniformBuffers[frame]
+	app.collectScene(buffer.Count)
+	app.sortDraws()
+	app.cullDraws(frame, ubo.Proj.Mul(ubo.View))
+	for i, d := range app.drawList.Draws {
+		ubo.Model = d.World
+		if err := buffer.Write(i, ubo); err != nil {
+			return errors.Wrapf(err, "can't write object %d", i)
+		}
+	}
+	if err := app.updateLights(frame); err != nil {
+		return err
+	}
+	if err := app.updatePose(frame); err != nil {
+		return err
+	}
+	return app.updateStereoViews(frame)
+}
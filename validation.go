@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/delaneyj/learnvulkan/debugutils"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	// khronosValidationLayer is the single validation layer SDKs have
+	// shipped since 1.1.106.
+	khronosValidationLayer = "VK_LAYER_KHRONOS_validation"
+	// lunargValidationLayer is the meta-layer older SDKs loaded the
+	// component layers through, newer ones don't ship it at all.
+	lunargValidationLayer = "VK_LAYER_LUNARG_standard_validation"
+)
+
+// validationComponentLayers are the layers lunargValidationLayer loaded, in
+// the order it loaded them. Runtimes without an SDK, like Android's, can
+// have them on their own.
+var validationComponentLayers = []string{
+	"VK_LAYER_GOOGLE_threading",
+	"VK_LAYER_LUNARG_parameter_validation",
+	"VK_LAYER_LUNARG_object_tracker",
+	"VK_LAYER_LUNARG_core_validation",
+	"VK_LAYER_GOOGLE_unique_objects",
+}
+
+// findValidationLayers picks the validation layers to enable out of the
+// available ones: the Khronos layer, or else the LUNARG meta-layer, or else
+// whichever component layers there are, returning the components it had to
+// do without. No layers means none are installed.
+func findValidationLayers(available map[string]bool) (layers, missing []string) {
+	for _, name := range []string{khronosValidationLayer, lunargValidationLayer} {
+		if available[name] {
+			return []string{name}, nil
+		}
+	}
+	for _, name := range validationComponentLayers {
+		if available[name] {
+			layers = append(layers, name)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(layers) == 0 {
+		return nil, nil
+	}
+	return layers, missing
+}
+
+// ValidationPolicy decides what happens when the validation layers aren't
+// installed.
+type ValidationPolicy int
+
+const (
+	// ValidationPrefer uses the validation layers when they're installed
+	// and runs without them, with a warning, when they're not.
+	ValidationPrefer ValidationPolicy = iota
+	// ValidationRequire fails when the validation layers aren't installed.
+	ValidationRequire
+	// ValidationDisable never uses the validation layers.
+	ValidationDisable
+)
+
+var validationPolicies = []string{
+	ValidationPrefer:  "prefer",
+	ValidationRequire: "require",
+	ValidationDisable: "disable",
+}
+
+// validationPolicyNames lists the policies for messages.
+func validationPolicyNames() string {
+	return strings.Join(validationPolicies, ", ")
+}
+
+func (p ValidationPolicy) String() string {
+	if p < 0 || int(p) >= len(validationPolicies) {
+		return fmt.Sprintf("ValidationPolicy(%d)", int(p))
+	}
+	return validationPolicies[p]
+}
+
+// Set parses a policy's name, so it can be a flag.
+func (p *ValidationPolicy) Set(s string) error {
+	for i, name := range validationPolicies {
+		if s == name {
+			*p = ValidationPolicy(i)
+			return nil
+		}
+	}
+	return errors.Errorf("unknown validation policy '%s', expected one of %s", s, validationPolicyNames())
+}
+
+// ValidationConfig controls how validation layer messages are reported.
+type ValidationConfig struct {
+	// Policy is whether to use the validation layers and what to do when
+	// they aren't installed, the zero value uses them when they are.
+	Policy ValidationPolicy
+	// MinSeverity drops messages less severe than it, zero means everything.
+	MinSeverity debugutils.Severity
+	// IgnoredMessageIDs are message ID numbers that are dropped regardless of
+	// severity, for known noise. The ID of a message is logged alongside it.
+	IgnoredMessageIDs []int32
+	// TreatWarningsAsErrors makes warnings fail the run like errors do.
+	// Validation errors always end Run with an error.
+	TreatWarningsAsErrors bool
+	// Callback receives delivered messages instead of the Logger.
+	Callback debugutils.Callback
+}
+
+// validationFailure holds the first message that should fail the run, it's
+// set from whichever thread the validation layers call back on.
+type validationFailure struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *validationFailure) set(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+func (f *validationFailure) get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// validationEnabled is whether the instance and device have the validation
+// layers, which selectValidationLayers decides.
+func (app *HelloTriangleApplication) validationEnabled() bool {
+	return len(app.validationLayers) > 0
+}
+
+// selectValidationLayers picks the validation layers the instance is
+// created with going by the Validation policy.
+func (app *HelloTriangleApplication) selectValidationLayers() error {
+	app.validationLayers = nil
+	policy := app.Validation.Policy
+	if policy == ValidationDisable {
+		app.logger.Info("Validation layers disabled")
+		return nil
+	}
+
+	available, err := app.availableInstanceLayers()
+	if err != nil {
+		return err
+	}
+	layers, missing := findValidationLayers(available)
+	if len(layers) == 0 {
+		tried := append([]string{khronosValidationLayer, lunargValidationLayer}, validationComponentLayers...)
+		if policy == ValidationRequire {
+			return errors.Errorf("validation layers required but none of %s are installed", strings.Join(tried, ", "))
+		}
+		app.logger.Warn("Running without validation layers",
+			logging.F("reason", "not installed"),
+			logging.F("tried", strings.Join(tried, ",")),
+		)
+		return nil
+	}
+
+	if len(missing) > 0 {
+		app.logger.Warn("Validation is incomplete, component layers are missing",
+			logging.F("missing", strings.Join(missing, ",")),
+		)
+	}
+	app.validationLayers = layers
+	app.logger.Info("Validation layers enabled", logging.F("layers", strings.Join(layers, ",")))
+	return nil
+}
+
+// availableInstanceLayers returns the names of every installed instance
+// layer.
+func (app *HelloTriangleApplication) availableInstanceLayers() (map[string]bool, error) {
+	layers, err := app.vulkan().InstanceLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	available := make(map[string]bool, len(layers))
+	for _, layer := range layers {
+		name := vk.ToString(layer.LayerName[:])
+		app.logger.Debug("Available layer",
+			logging.F("name", name),
+			logging.F("description", vk.ToString(layer.Description[:])),
+		)
+		available[name] = true
+	}
+	return available, nil
+}
+
+func (app *HelloTriangleApplication) setupDebugMessenger() error {
+	if !app.validationEnabled() {
+		return nil
+	}
+
+	v := app.Validation
+	// Warnings that fail the run have to be delivered even when they
+	// wouldn't be reported
+	minSeverity := v.MinSeverity
+	if v.TreatWarningsAsErrors && minSeverity > debugutils.SeverityWarning {
+		minSeverity = debugutils.SeverityWarning
+	}
+
+	ignore := func(debugutils.Message) {}
+	ignored := make(map[int32]debugutils.Callback, len(v.IgnoredMessageIDs))
+	for _, id := range v.IgnoredMessageIDs {
+		ignored[id] = ignore
+	}
+
+	messenger, err := debugutils.New(app.getInstanceProcAddr, app.instance, debugutils.Config{
+		MinSeverity: minSeverity,
+		Callback:    app.handleValidationMessage,
+		IDCallbacks: ignored,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create debug messenger")
+	}
+	app.debugMessenger = messenger
+	return nil
+}
+
+// handleValidationMessage reports msg and records it if it fails the run.
+func (app *HelloTriangleApplication) handleValidationMessage(msg debugutils.Message) {
+	v := app.Validation
+
+	if msg.Severity >= v.MinSeverity {
+		if v.Callback != nil {
+			v.Callback(msg)
+		} else {
+			app.logDebugMessage(msg)
+		}
+		if app.Overlay {
+			app.debugMessages.add(msg)
+		}
+	}
+
+	fails := msg.Severity >= debugutils.SeverityError ||
+		(v.TreatWarningsAsErrors && msg.Severity >= debugutils.SeverityWarning)
+	if fails {
+		app.validationFailure.set(errors.Errorf("validation %s %s (%d): %s", msg.Severity, msg.IDName, msg.ID, msg.Text))
+	}
+}
+
+// validationError is the first validation message that failed the run.
+func (app *HelloTriangleApplication) validationError() error {
+	return app.validationFailure.get()
+}
+
+// logDebugMessage forwards a validation message to the logger at the
+// matching level.
+func (app *HelloTriangleApplication) logDebugMessage(msg debugutils.Message) {
+	fields := []logging.Field{
+		logging.F("id", msg.IDName),
+		logging.F("idNumber", msg.ID),
+		logging.F("types", msg.Types),
+	}
+	for i, o := range msg.Objects {
+		fields = append(fields, logging.F(fmt.Sprintf("object%d", i), debugObjectString(o)))
+	}
+
+	switch {
+	case msg.Severity >= debugutils.SeverityError:
+		app.logger.Error(msg.Text, fields...)
+	case msg.Severity >= debugutils.SeverityWarning:
+		app.logger.Warn(msg.Text, fields...)
+	case msg.Severity >= debugutils.SeverityInfo:
+		app.logger.Info(msg.Text, fields...)
+	default:
+		app.logger.Debug(msg.Text, fields...)
+	}
+}
+
+func debugObjectString(o debugutils.Object) string {
+	if o.Name != "" {
+		return fmt.Sprintf("%s(%#x)", o.Name, o.Handle)
+	}
+	return fmt.Sprintf("%#x", o.Handle)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/models"
+)
+
+// Vertex is the layout of a single vertex in the vertex buffer, its fields
+// must follow the vertex shader inputs in location order.
+type Vertex struct {
+	Pos      [3]float32
+	Color    [3]float32
+	TexCoord [2]float32
+	Normal   [3]float32
+	// Tangent points along increasing U, W is the bitangent's sign.
+	Tangent [4]float32
+}
+
+var (
+	// The quad faces up Z with U running along -X and V along +Y
+	quadNormal  = [3]float32{0, 0, 1}
+	quadTangent = [4]float32{-1, 0, 0, -1}
+
+	quadVertices = []Vertex{
+		{Pos: [3]float32{-0.5, -0.5, 0}, Color: [3]float32{1, 0, 0}, TexCoord: [2]float32{1, 0}, Normal: quadNormal, Tangent: quadTangent},
+		{Pos: [3]float32{0.5, -0.5, 0}, Color: [3]float32{0, 1, 0}, TexCoord: [2]float32{0, 0}, Normal: quadNormal, Tangent: quadTangent},
+		{Pos: [3]float32{0.5, 0.5, 0}, Color: [3]float32{0, 0, 1}, TexCoord: [2]float32{0, 1}, Normal: quadNormal, Tangent: quadTangent},
+		{Pos: [3]float32{-0.5, 0.5, 0}, Color: [3]float32{1, 1, 1}, TexCoord: [2]float32{1, 1}, Normal: quadNormal, Tangent: quadTangent},
+	}
+	quadIndices = []uint32{
+		0, 1, 2, 2, 3, 0,
+	}
+)
+
+// modelVertices converts loaded model vertices to the application's layout.
+func modelVertices(vertices []models.Vertex) []Vertex {
+	converted := make([]Vertex, len(vertices))
+	for i, v := range vertices {
+		converted[i] = Vertex{
+			Pos:      v.Position,
+			Color:    v.Color,
+			TexCoord: v.TexCoord,
+			Normal:   v.Normal,
+			Tangent:  v.Tangent,
+		}
+	}
+	return converted
+}
+
+// yUpToZUp rotates glTF's Y up vertices into the scene's Z up world.
+func yUpToZUp(vertices []Vertex) {
+	rotate := func(v [3]float32) [3]float32 {
+		return [3]float32{v[0], -v[2], v[1]}
+	}
+	for i := range vertices {
+		v := &vertices[i]
+		v.Pos = rotate(v.Pos)
+		v.Normal = rotate(v.Normal)
+		t := rotate([3]float32{v.Tangent[0], v.Tangent[1], v.Tangent[2]})
+		v.Tangent = [4]float32{t[0], t[1], t[2], v.Tangent[3]}
+	}
+}
@@ -0,0 +1,255 @@
+// Package vmath is the small amount of linear algebra the samples need.
+// Matrices are column-major to match GLSL, and projections target Vulkan's
+// clip space (Y pointing down, depth in [0, 1]).
+package vmath
+
+import "math"
+
+// Vec3 is a 3 component vector.
+type Vec3 [3]float32
+
+// Vec4 is a 4 component vector.
+type Vec4 [4]float32
+
+// Mat4 is a column-major 4x4 matrix, element (row r, column c) is at [c*4+r].
+type Mat4 [16]float32
+
+func (v Vec3) Add(o Vec3) Vec3 {
+	return Vec3{v[0] + o[0], v[1] + o[1], v[2] + o[2]}
+}
+
+func (v Vec3) Sub(o Vec3) Vec3 {
+	return Vec3{v[0] - o[0], v[1] - o[1], v[2] - o[2]}
+}
+
+func (v Vec3) Mul(s float32) Vec3 {
+	return Vec3{v[0] * s, v[1] * s, v[2] * s}
+}
+
+func (v Vec3) Dot(o Vec3) float32 {
+	return v[0]*o[0] + v[1]*o[1] + v[2]*o[2]
+}
+
+func (v Vec3) Cross(o Vec3) Vec3 {
+	return Vec3{
+		v[1]*o[2] - v[2]*o[1],
+		v[2]*o[0] - v[0]*o[2],
+		v[0]*o[1] - v[1]*o[0],
+	}
+}
+
+func (v Vec3) Len() float32 {
+	return float32(math.Sqrt(float64(v.Dot(v))))
+}
+
+// Normalize returns v scaled to unit length, the zero vector stays zero.
+func (v Vec3) Normalize() Vec3 {
+	l := v.Len()
+	if l == 0 {
+		return v
+	}
+	return v.Mul(1 / l)
+}
+
+// Vec4 extends v with w.
+func (v Vec3) Vec4(w float32) Vec4 {
+	return Vec4{v[0], v[1], v[2], w}
+}
+
+// Vec3 drops the w component.
+func (v Vec4) Vec3() Vec3 {
+	return Vec3{v[0], v[1], v[2]}
+}
+
+// Ident4 is the 4x4 identity matrix.
+func Ident4() Mat4 {
+	return Mat4{
+		1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 1, 0,
+		0, 0, 0, 1,
+	}
+}
+
+// At returns the element in row r, column c.
+func (m Mat4) At(r, c int) float32 {
+	return m[c*4+r]
+}
+
+// Mul returns m * o, so o is applied first when transforming vectors.
+func (m Mat4) Mul(o Mat4) Mat4 {
+	var out Mat4
+	for c := 0; c < 4; c++ {
+		for r := 0; r < 4; r++ {
+			var sum float32
+			for k := 0; k < 4; k++ {
+				sum += m[k*4+r] * o[c*4+k]
+			}
+			out[c*4+r] = sum
+		}
+	}
+	return out
+}
+
+// MulVec4 transforms v by m.
+func (m Mat4) MulVec4(v Vec4) Vec4 {
+	var out Vec4
+	for r := 0; r < 4; r++ {
+		out[r] = m[r]*v[0] + m[4+r]*v[1] + m[8+r]*v[2] + m[12+r]*v[3]
+	}
+	return out
+}
+
+// Transpose swaps rows and columns.
+func (m Mat4) Transpose() Mat4 {
+	var out Mat4
+	for c := 0; c < 4; c++ {
+		for r := 0; r < 4; r++ {
+			out[r*4+c] = m[c*4+r]
+		}
+	}
+	return out
+}
+
+// Inverse returns the inverse of m, or the identity if m is singular.
+func (m Mat4) Inverse() Mat4 {
+	var inv Mat4
+	inv[0] = m[5]*m[10]*m[15] - m[5]*m[11]*m[14] - m[9]*m[6]*m[15] + m[9]*m[7]*m[14] + m[13]*m[6]*m[11] - m[13]*m[7]*m[10]
+	inv[4] = -m[4]*m[10]*m[15] + m[4]*m[11]*m[14] + m[8]*m[6]*m[15] - m[8]*m[7]*m[14] - m[12]*m[6]*m[11] + m[12]*m[7]*m[10]
+	inv[8] = m[4]*m[9]*m[15] - m[4]*m[11]*m[13] - m[8]*m[5]*m[15] + m[8]*m[7]*m[13] + m[12]*m[5]*m[11] - m[12]*m[7]*m[9]
+	inv[12] = -m[4]*m[9]*m[14] + m[4]*m[10]*m[13] + m[8]*m[5]*m[14] - m[8]*m[6]*m[13] - m[12]*m[5]*m[10] + m[12]*m[6]*m[9]
+	inv[1] = -m[1]*m[10]*m[15] + m[1]*m[11]*m[14] + m[9]*m[2]*m[15] - m[9]*m[3]*m[14] - m[13]*m[2]*m[11] + m[13]*m[3]*m[10]
+	inv[5] = m[0]*m[10]*m[15] - m[0]*m[11]*m[14] - m[8]*m[2]*m[15] + m[8]*m[3]*m[14] + m[12]*m[2]*m[11] - m[12]*m[3]*m[10]
+	inv[9] = -m[0]*m[9]*m[15] + m[0]*m[11]*m[13] + m[8]*m[1]*m[15] - m[8]*m[3]*m[13] - m[12]*m[1]*m[11] + m[12]*m[3]*m[9]
+	inv[13] = m[0]*m[9]*m[14] - m[0]*m[10]*m[13] - m[8]*m[1]*m[14] + m[8]*m[2]*m[13] + m[12]*m[1]*m[10] - m[12]*m[2]*m[9]
+	inv[2] = m[1]*m[6]*m[15] - m[1]*m[7]*m[14] - m[5]*m[2]*m[15] + m[5]*m[3]*m[14] + m[13]*m[2]*m[7] - m[13]*m[3]*m[6]
+	inv[6] = -m[0]*m[6]*m[15] + m[0]*m[7]*m[14] + m[4]*m[2]*m[15] - m[4]*m[3]*m[14] - m[12]*m[2]*m[7] + m[12]*m[3]*m[6]
+	inv[10] = m[0]*m[5]*m[15] - m[0]*m[7]*m[13] - m[4]*m[1]*m[15] + m[4]*m[3]*m[13] + m[12]*m[1]*m[7] - m[12]*m[3]*m[5]
+	inv[14] = -m[0]*m[5]*m[14] + m[0]*m[6]*m[13] + m[4]*m[1]*m[14] - m[4]*m[2]*m[13] - m[12]*m[1]*m[6] + m[12]*m[2]*m[5]
+	inv[3] = -m[1]*m[6]*m[11] + m[1]*m[7]*m[10] + m[5]*m[2]*m[11] - m[5]*m[3]*m[10] - m[9]*m[2]*m[7] + m[9]*m[3]*m[6]
+	inv[7] = m[0]*m[6]*m[11] - m[0]*m[7]*m[10] - m[4]*m[2]*m[11] + m[4]*m[3]*m[10] + m[8]*m[2]*m[7] - m[8]*m[3]*m[6]
+	inv[11] = -m[0]*m[5]*m[11] + m[0]*m[7]*m[9] + m[4]*m[1]*m[11] - m[4]*m[3]*m[9] - m[8]*m[1]*m[7] + m[8]*m[3]*m[5]
+	inv[15] = m[0]*m[5]*m[10] - m[0]*m[6]*m[9] - m[4]*m[1]*m[10] + m[4]*m[2]*m[9] + m[8]*m[1]*m[6] - m[8]*m[2]*m[5]
+
+	det := m[0]*inv[0] + m[1]*inv[4] + m[2]*inv[8] + m[3]*inv[12]
+	if det == 0 {
+		return Ident4()
+	}
+	det = 1 / det
+	for i := range inv {
+		inv[i] *= det
+	}
+	return inv
+}
+
+// Translate builds a translation matrix.
+func Translate(v Vec3) Mat4 {
+	m := Ident4()
+	m[12], m[13], m[14] = v[0], v[1], v[2]
+	return m
+}
+
+// Scale builds a scaling matrix.
+func Scale(v Vec3) Mat4 {
+	m := Ident4()
+	m[0], m[5], m[10] = v[0], v[1], v[2]
+	return m
+}
+
+// Rotate builds a rotation of angle radians around axis.
+func Rotate(angle float32, axis Vec3) Mat4 {
+	a := axis.Normalize()
+	s := float32(math.Sin(float64(angle)))
+	c := float32(math.Cos(float64(angle)))
+	t := 1 - c
+	x, y, z := a[0], a[1], a[2]
+	return Mat4{
+		t*x*x + c, t*x*y + s*z, t*x*z - s*y, 0,
+		t*x*y - s*z, t*y*y + c, t*y*z + s*x, 0,
+		t*x*z + s*y, t*y*z - s*x, t*z*z + c, 0,
+		0, 0, 0, 1,
+	}
+}
+
+// Quat builds the rotation of the unit quaternion q, stored x, y, z, w.
+func Quat(q Vec4) Mat4 {
+	x, y, z, w := q[0], q[1], q[2], q[3]
+	return Mat4{
+		1 - 2*(y*y+z*z), 2 * (x*y + z*w), 2 * (x*z - y*w), 0,
+		2 * (x*y - z*w), 1 - 2*(x*x+z*z), 2 * (y*z + x*w), 0,
+		2 * (x*z + y*w), 2 * (y*z - x*w), 1 - 2*(x*x+y*y), 0,
+		0, 0, 0, 1,
+	}
+}
+
+// AxisAngle is the unit quaternion, stored x, y, z, w, rotating angle
+// radians around axis.
+func AxisAngle(angle float32, axis Vec3) Vec4 {
+	a := axis.Normalize()
+	s := float32(math.Sin(float64(angle) / 2))
+	c := float32(math.Cos(float64(angle) / 2))
+	return Vec4{a[0] * s, a[1] * s, a[2] * s, c}
+}
+
+// LookAt builds a right handed view matrix looking from eye at center.
+func LookAt(eye, center, up Vec3) Mat4 {
+	f := center.Sub(eye).Normalize()
+	s := f.Cross(up).Normalize()
+	u := s.Cross(f)
+	return Mat4{
+		s[0], u[0], -f[0], 0,
+		s[1], u[1], -f[1], 0,
+		s[2], u[2], -f[2], 0,
+		-s.Dot(eye), -u.Dot(eye), f.Dot(eye), 1,
+	}
+}
+
+// Perspective builds a right handed projection into Vulkan clip space with
+// fovy in radians. Y is flipped since Vulkan's clip space Y points down.
+func Perspective(fovy, aspect, near, far float32) Mat4 {
+	f := float32(1 / math.Tan(float64(fovy)/2))
+	return Mat4{
+		f / aspect, 0, 0, 0,
+		0, -f, 0, 0,
+		0, 0, far / (near - far), -1,
+		0, 0, near * far / (near - far), 0,
+	}
+}
+
+// PerspectiveFov is Perspective for a frustum that needn't be symmetric,
+// like a headset eye's. The angles are in radians from the view direction
+// to each side, left and down negative.
+func PerspectiveFov(left, right, up, down, near, far float32) Mat4 {
+	l := float32(math.Tan(float64(left)))
+	r := float32(math.Tan(float64(right)))
+	u := float32(math.Tan(float64(up)))
+	d := float32(math.Tan(float64(down)))
+	w, h := r-l, u-d
+	return Mat4{
+		2 / w, 0, 0, 0,
+		0, -2 / h, 0, 0,
+		(r + l) / w, -(u + d) / h, far / (near - far), -1,
+		0, 0, near * far / (near - far), 0,
+	}
+}
+
+// Ortho builds an orthographic projection into Vulkan clip space with depth
+// mapped to [0, 1] and Y flipped to point up.
+func Ortho(left, right, bottom, top, near, far float32) Mat4 {
+	return Mat4{
+		2 / (right - left), 0, 0, 0,
+		0, -2 / (top - bottom), 0, 0,
+		0, 0, 1 / (near - far), 0,
+		-(right + left) / (right - left), (top + bottom) / (top - bottom), near / (near - far), 1,
+	}
+}
+
+// Radians converts degrees to radians.
+func Radians(degrees float32) float32 {
+	return degrees * math.Pi / 180
+}
+
+// Degrees converts radians to degrees.
+func Degrees(radians float32) float32 {
+	return radians * 180 / math.Pi
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/swapchain"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Vulkan is the part of the Vulkan API that creating the instance, picking
+// the validation layers and picking the physical device go through, so
+// their logic can be tested against a fake without a loader or GPU.
+// Everything returned is already dereferenced. Optional features like ray
+// tracing are still queried directly, and only when a device has their
+// extensions.
+type Vulkan interface {
+	InstanceLayers() ([]vk.LayerProperties, error)
+	InstanceExtensions() ([]vk.ExtensionProperties, error)
+	CreateInstance(createInfo *vk.InstanceCreateInfo) (vk.Instance, error)
+	PhysicalDevices(instance vk.Instance) ([]vk.PhysicalDevice, error)
+	PhysicalDeviceProperties(device vk.PhysicalDevice) vk.PhysicalDeviceProperties
+	PhysicalDeviceFeatures(device vk.PhysicalDevice) vk.PhysicalDeviceFeatures
+	QueueFamilyProperties(device vk.PhysicalDevice) []vk.QueueFamilyProperties
+	SurfaceSupport(device vk.PhysicalDevice, family uint32, surface vk.Surface) (bool, error)
+	DeviceExtensions(device vk.PhysicalDevice) ([]vk.ExtensionProperties, error)
+	SwapchainSupport(device vk.PhysicalDevice, surface vk.Surface) (swapchain.SupportDetails, error)
+}
+
+// loaderVulkan is Vulkan through the loader vk.Init set up.
+type loaderVulkan struct{}
+
+// vulkan is the API the application was given, the loader by default.
+func (app *HelloTriangleApplication) vulkan() Vulkan {
+	if app.Vulkan == nil {
+		return loaderVulkan{}
+	}
+	return app.Vulkan
+}
+
+func (loaderVulkan) InstanceLayers() ([]vk.LayerProperties, error) {
+	var count uint32
+	if err := vk.Error(vk.EnumerateInstanceLayerProperties(&count, nil)); err != nil {
+		return nil, errors.Wrap(err, "can't get layer count")
+	}
+	layers := make([]vk.LayerProperties, count)
+	if err := vk.Error(vk.EnumerateInstanceLayerProperties(&count, layers)); err != nil {
+		return nil, errors.Wrap(err, "can't get layers")
+	}
+	for i := range layers {
+		layers[i].Deref()
+	}
+	return layers, nil
+}
+
+func (loaderVulkan) InstanceExtensions() ([]vk.ExtensionProperties, error) {
+	var count uint32
+	if err := vk.Error(vk.EnumerateInstanceExtensionProperties("", &count, nil)); err != nil {
+		return nil, errors.Wrap(err, "can't get instance extension count")
+	}
+	extensions := make([]vk.ExtensionProperties, count)
+	if err := vk.Error(vk.EnumerateInstanceExtensionProperties("", &count, extensions)); err != nil {
+		return nil, errors.Wrap(err, "can't get instance extensions")
+	}
+	for i := range extensions {
+		extensions[i].Deref()
+	}
+	return extensions, nil
+}
+
+func (loaderVulkan) CreateInstance(createInfo *vk.InstanceCreateInfo) (vk.Instance, error) {
+	var instance vk.Instance
+	if err := vk.Error(vk.CreateInstance(createInfo, nil, &instance)); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+func (loaderVulkan) PhysicalDevices(instance vk.Instance) ([]vk.PhysicalDevice, error) {
+	var count uint32
+	if err := vk.Error(vk.EnumeratePhysicalDevices(instance, &count, nil)); err != nil {
+		return nil, errors.Wrap(err, "can't get physical device count")
+	}
+	devices := make([]vk.PhysicalDevice, count)
+	if err := vk.Error(vk.EnumeratePhysicalDevices(instance, &count, devices)); err != nil {
+		return nil, errors.Wrap(err, "can't get physical devices")
+	}
+	return devices, nil
+}
+
+func (loaderVulkan) PhysicalDeviceProperties(device vk.PhysicalDevice) vk.PhysicalDeviceProperties {
+	var properties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(device, &properties)
+	properties.Deref()
+	properties.Limits.Deref()
+	return properties
+}
+
+func (loaderVulkan) PhysicalDeviceFeatures(device vk.PhysicalDevice) vk.PhysicalDeviceFeatures {
+	var features vk.PhysicalDeviceFeatures
+	vk.GetPhysicalDeviceFeatures(device, &features)
+	features.Deref()
+	return features
+}
+
+func (loaderVulkan) QueueFamilyProperties(device vk.PhysicalDevice) []vk.QueueFamilyProperties {
+	return queueFamilyProperties(device)
+}
+
+func (loaderVulkan) SurfaceSupport(device vk.PhysicalDevice, family uint32, surface vk.Surface) (bool, error) {
+	var supported vk.Bool32
+	if err := vk.Error(vk.GetPhysicalDeviceSurfaceSupport(device, family, surface, &supported)); err != nil {
+		return false, err
+	}
+	return supported.B(), nil
+}
+
+func (loaderVulkan) DeviceExtensions(device vk.PhysicalDevice) ([]vk.ExtensionProperties, error) {
+	var count uint32
+	if err := vk.Error(vk.EnumerateDeviceExtensionProperties(device, "", &count, nil)); err != nil {
+		return nil, errors.Wrap(err, "can't get device extension count")
+	}
+	extensions := make([]vk.ExtensionProperties, count)
+	if err := vk.Error(vk.EnumerateDeviceExtensionProperties(device, "", &count, extensions)); err != nil {
+		return nil, errors.Wrap(err, "can't get device extensions")
+	}
+	for i := range extensions {
+		extensions[i].Deref()
+	}
+	return extensions, nil
+}
+
+func (loaderVulkan) SwapchainSupport(device vk.PhysicalDevice, surface vk.Surface) (swapchain.SupportDetails, error) {
+	return swapchain.QuerySupport(device, surface)
+}
+
+// extensionNames returns the names of extensions.
+func extensionNames(extensions []vk.ExtensionProperties) map[string]bool {
+	names := make(map[string]bool, len(extensions))
+	for _, ex := range extensions {
+		names[vk.ToString(ex.ExtensionName[:])] = true
+	}
+	return names
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/swapchain"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// fakeDevice is a physical device fakeVulkan reports.
+type fakeDevice struct {
+	name         string
+	deviceType   vk.PhysicalDeviceType
+	maxImage2D   uint32
+	noAnisotropy bool
+	queues       []vk.QueueFlagBits
+	extensions   []string
+}
+
+// fakeVulkan answers Vulkan from its fields instead of a loader.
+type fakeVulkan struct {
+	layers     []string
+	extensions []string
+	devices    []fakeDevice
+	// handles map the handles PhysicalDevices returned to devices.
+	handles map[vk.PhysicalDevice]*fakeDevice
+	// created is the last createInfo CreateInstance was given.
+	created *vk.InstanceCreateInfo
+}
+
+func cName(s string) (name [256]byte) {
+	copy(name[:], s)
+	return name
+}
+
+func (f *fakeVulkan) device(d vk.PhysicalDevice) *fakeDevice {
+	return f.handles[d]
+}
+
+func (f *fakeVulkan) InstanceLayers() ([]vk.LayerProperties, error) {
+	layers := make([]vk.LayerProperties, len(f.layers))
+	for i, name := range f.layers {
+		layers[i].LayerName = cName(name)
+	}
+	return layers, nil
+}
+
+func (f *fakeVulkan) InstanceExtensions() ([]vk.ExtensionProperties, error) {
+	return fakeExtensions(f.extensions), nil
+}
+
+func (f *fakeVulkan) CreateInstance(createInfo *vk.InstanceCreateInfo) (vk.Instance, error) {
+	f.created = createInfo
+	return vk.Instance(unsafe.Pointer(new(byte))), nil
+}
+
+func (f *fakeVulkan) PhysicalDevices(instance vk.Instance) ([]vk.PhysicalDevice, error) {
+	f.handles = map[vk.PhysicalDevice]*fakeDevice{}
+	devices := make([]vk.PhysicalDevice, len(f.devices))
+	for i := range f.devices {
+		devices[i] = vk.PhysicalDevice(unsafe.Pointer(new(byte)))
+		f.handles[devices[i]] = &f.devices[i]
+	}
+	return devices, nil
+}
+
+func (f *fakeVulkan) PhysicalDeviceProperties(d vk.PhysicalDevice) vk.PhysicalDeviceProperties {
+	device := f.device(d)
+	var properties vk.PhysicalDeviceProperties
+	properties.DeviceName = cName(device.name)
+	properties.DeviceType = device.deviceType
+	properties.Limits.MaxImageDimension2D = device.maxImage2D
+	return properties
+}
+
+func (f *fakeVulkan) PhysicalDeviceFeatures(d vk.PhysicalDevice) vk.PhysicalDeviceFeatures {
+	var features vk.PhysicalDeviceFeatures
+	if !f.device(d).noAnisotropy {
+		features.SamplerAnisotropy = vk.True
+	}
+	return features
+}
+
+func (f *fakeVulkan) QueueFamilyProperties(d vk.PhysicalDevice) []vk.QueueFamilyProperties {
+	queues := f.device(d).queues
+	families := make([]vk.QueueFamilyProperties, len(queues))
+	for i, flags := range queues {
+		families[i] = vk.QueueFamilyProperties{QueueFlags: vk.QueueFlags(flags), QueueCount: 1}
+	}
+	return families
+}
+
+func (f *fakeVulkan) SurfaceSupport(d vk.PhysicalDevice, family uint32, surface vk.Surface) (bool, error) {
+	return false, errors.New("headless tests have no surface")
+}
+
+func (f *fakeVulkan) DeviceExtensions(d vk.PhysicalDevice) ([]vk.ExtensionProperties, error) {
+	return fakeExtensions(f.device(d).extensions), nil
+}
+
+func (f *fakeVulkan) SwapchainSupport(d vk.PhysicalDevice, surface vk.Surface) (swapchain.SupportDetails, error) {
+	return swapchain.SupportDetails{}, errors.New("headless tests have no surface")
+}
+
+func fakeExtensions(names []string) []vk.ExtensionProperties {
+	extensions := make([]vk.ExtensionProperties, len(names))
+	for i, name := range names {
+		extensions[i].ExtensionName = cName(name)
+	}
+	return extensions
+}
+
+// newFakeApp is a headless application going through api.
+func newFakeApp(api *fakeVulkan) *HelloTriangleApplication {
+	return &HelloTriangleApplication{
+		Headless: true,
+		Vulkan:   api,
+		logger:   logging.Discard(),
+	}
+}
+
+const graphicsQueue = vk.QueueGraphicsBit | vk.QueueComputeBit | vk.QueueTransferBit
+
+func TestPickPhysicalDevice(t *testing.T) {
+	integrated := fakeDevice{
+		name:       "Intel UHD",
+		deviceType: vk.PhysicalDeviceTypeIntegratedGpu,
+		maxImage2D: 16384,
+		queues:     []vk.QueueFlagBits{graphicsQueue},
+		extensions: []string{"VK_KHR_example"},
+	}
+	discrete := fakeDevice{
+		name:       "NVIDIA RTX",
+		deviceType: vk.PhysicalDeviceTypeDiscreteGpu,
+		maxImage2D: 32768,
+		queues:     []vk.QueueFlagBits{graphicsQueue, vk.QueueComputeBit, vk.QueueTransferBit},
+	}
+	noAnisotropy := discrete
+	noAnisotropy.noAnisotropy = true
+	noGraphics := discrete
+	noGraphics.queues = []vk.QueueFlagBits{vk.QueueComputeBit}
+
+	tests := []struct {
+		name     string
+		devices  []fakeDevice
+		gpu      string
+		required []string
+		scorer   DeviceScorer
+		want     string
+		wantErr  string
+	}{
+		{
+			name:    "prefers discrete",
+			devices: []fakeDevice{integrated, discrete},
+			want:    "NVIDIA RTX",
+		},
+		{
+			name:    "skips no anisotropy",
+			devices: []fakeDevice{noAnisotropy, integrated},
+			want:    "Intel UHD",
+		},
+		{
+			name:    "skips missing queue families",
+			devices: []fakeDevice{noGraphics, integrated},
+			want:    "Intel UHD",
+		},
+		{
+			name:     "skips missing extensions",
+			devices:  []fakeDevice{integrated, discrete},
+			required: []string{"VK_KHR_example"},
+			want:     "Intel UHD",
+		},
+		{
+			name:    "requested by name",
+			devices: []fakeDevice{integrated, discrete},
+			gpu:     "intel",
+			want:    "Intel UHD",
+		},
+		{
+			name:    "requested by index",
+			devices: []fakeDevice{integrated, discrete},
+			gpu:     "0",
+			want:    "Intel UHD",
+		},
+		{
+			name:    "scorer decides",
+			devices: []fakeDevice{integrated, discrete},
+			scorer: func(properties vk.PhysicalDeviceProperties, features vk.PhysicalDeviceFeatures, queues QueueInfo) int {
+				if properties.DeviceType == vk.PhysicalDeviceTypeDiscreteGpu {
+					return -1
+				}
+				return 0
+			},
+			want: "Intel UHD",
+		},
+		{
+			name:    "no devices",
+			wantErr: "no phyical device detected",
+		},
+		{
+			name:    "none suitable",
+			devices: []fakeDevice{noAnisotropy, noGraphics},
+			wantErr: "failed to find suitable GPU",
+		},
+		{
+			name:    "requested unsuitable",
+			devices: []fakeDevice{noAnisotropy, integrated},
+			gpu:     "nvidia",
+			wantErr: "requested GPU 'NVIDIA RTX' isn't suitable",
+		},
+		{
+			name:    "requested missing",
+			devices: []fakeDevice{integrated},
+			gpu:     "amd",
+			wantErr: "no GPU matches 'amd'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeVulkan{devices: tt.devices}
+			app := newFakeApp(api)
+			app.GPU = tt.gpu
+			app.RequiredDeviceExtensions = tt.required
+			app.DeviceScorer = tt.scorer
+
+			err := app.pickPhysicalDevice()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("pickPhysicalDevice error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pickPhysicalDevice: %v", err)
+			}
+			if got := api.device(app.physicalDevice).name; got != tt.want {
+				t.Errorf("picked %q, want %q", got, tt.want)
+			}
+			if !app.queueFamilies.isComplete(false) {
+				t.Errorf("queue families %+v aren't complete", app.queueFamilies)
+			}
+		})
+	}
+}
+
+func TestFindQueueFamiliesPrefersDedicated(t *testing.T) {
+	api := &fakeVulkan{devices: []fakeDevice{{
+		queues: []vk.QueueFlagBits{graphicsQueue, vk.QueueComputeBit | vk.QueueTransferBit, vk.QueueTransferBit},
+	}}}
+	devices, _ := api.PhysicalDevices(nil)
+
+	families, err := findQueueFamilies(api, devices[0], vk.NullSurface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := QueueFamilies{Graphics: 0, Present: -1, Compute: 1, Transfer: 2}
+	if families != want {
+		t.Errorf("findQueueFamilies = %+v, want %+v", families, want)
+	}
+}
+
+func TestFindValidationLayers(t *testing.T) {
+	tests := []struct {
+		name        string
+		available   []string
+		wantLayers  []string
+		wantMissing []string
+	}{
+		{
+			name:       "khronos",
+			available:  []string{"VK_LAYER_LUNARG_standard_validation", "VK_LAYER_KHRONOS_validation"},
+			wantLayers: []string{"VK_LAYER_KHRONOS_validation"},
+		},
+		{
+			name:       "lunarg",
+			available:  []string{"VK_LAYER_LUNARG_standard_validation", "VK_LAYER_GOOGLE_threading"},
+			wantLayers: []string{"VK_LAYER_LUNARG_standard_validation"},
+		},
+		{
+			name:       "components",
+			available:  []string{"VK_LAYER_LUNARG_core_validation", "VK_LAYER_GOOGLE_threading"},
+			wantLayers: []string{"VK_LAYER_GOOGLE_threading", "VK_LAYER_LUNARG_core_validation"},
+			wantMissing: []string{
+				"VK_LAYER_LUNARG_parameter_validation",
+				"VK_LAYER_LUNARG_object_tracker",
+				"VK_LAYER_GOOGLE_unique_objects",
+			},
+		},
+		{
+			name:      "none",
+			available: []string{"VK_LAYER_MESA_overlay"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			available := map[string]bool{}
+			for _, name := range tt.available {
+				available[name] = true
+			}
+			layers, missing := findValidationLayers(available)
+			if strings.Join(layers, ",") != strings.Join(tt.wantLayers, ",") {
+				t.Errorf("layers = %v, want %v", layers, tt.wantLayers)
+			}
+			if strings.Join(missing, ",") != strings.Join(tt.wantMissing, ",") {
+				t.Errorf("missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceValidationPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		layers     []string
+		policy     ValidationPolicy
+		wantLayers []string
+		wantErr    bool
+	}{
+		{"prefer installed", []string{"VK_LAYER_KHRONOS_validation"}, ValidationPrefer, []string{"VK_LAYER_KHRONOS_validation"}, false},
+		{"prefer missing", nil, ValidationPrefer, nil, false},
+		{"require installed", []string{"VK_LAYER_KHRONOS_validation"}, ValidationRequire, []string{"VK_LAYER_KHRONOS_validation"}, false},
+		{"require missing", nil, ValidationRequire, nil, true},
+		{"disable", []string{"VK_LAYER_KHRONOS_validation"}, ValidationDisable, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeVulkan{layers: tt.layers}
+			app := newFakeApp(api)
+			app.Validation.Policy = tt.policy
+
+			err := app.createInstance()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("createInstance succeeded, want an error")
+				}
+				if api.created != nil {
+					t.Error("instance created anyway")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("createInstance: %v", err)
+			}
+
+			got := api.created
+			if int(got.EnabledLayerCount) != len(tt.wantLayers) {
+				t.Fatalf("EnabledLayerCount = %d, want %d", got.EnabledLayerCount, len(tt.wantLayers))
+			}
+			for i, name := range tt.wantLayers {
+				if got.PpEnabledLayerNames[i] != name+"\x00" {
+					t.Errorf("layer %d = %q, want %q", i, got.PpEnabledLayerNames[i], name)
+				}
+			}
+			debugUtils := false
+			for _, name := range got.PpEnabledExtensionNames {
+				debugUtils = debugUtils || name == vk.ExtDebugUtilsExtensionName+"\x00"
+			}
+			if debugUtils != (len(tt.wantLayers) > 0) {
+				t.Errorf("debug utils enabled = %v with layers %v", debugUtils, tt.wantLayers)
+			}
+		})
+	}
+}
+
+func TestValidationPolicySet(t *testing.T) {
+	for _, name := range []string{"prefer", "require", "disable"} {
+		var p ValidationPolicy
+		if err := p.Set(name); err != nil {
+			t.Fatalf("Set(%q): %v", name, err)
+		}
+		if p.String() != name {
+			t.Errorf("Set(%q) = %s", name, p)
+		}
+	}
+	var p ValidationPolicy
+	if err := p.Set("true"); err == nil {
+		t.Error("Set(\"true\") succeeded, want an error")
+	}
+}
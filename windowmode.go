@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+)
+
+// WindowMode is how the window occupies the screen, Alt+Enter cycles
+// through them in order.
+type WindowMode int
+
+const (
+	// Windowed is a normal decorated window.
+	Windowed WindowMode = iota
+	// Fullscreen takes exclusive ownership of the monitor, changing its
+	// video mode to the one in FullscreenConfig.
+	Fullscreen
+	// Borderless is an undecorated window covering the monitor at its
+	// current video mode, quicker to switch to and from than Fullscreen.
+	Borderless
+
+	windowModeCount
+)
+
+func (m WindowMode) String() string {
+	switch m {
+	case Windowed:
+		return "windowed"
+	case Fullscreen:
+		return "fullscreen"
+	case Borderless:
+		return "borderless"
+	}
+	return "unknown"
+}
+
+// FullscreenConfig is the video mode used for exclusive fullscreen, zero
+// fields keep the monitor's current value.
+type FullscreenConfig struct {
+	Width       int
+	Height      int
+	RefreshRate int
+}
+
+// ParseFullscreenConfig parses WIDTHxHEIGHT with an optional @REFRESH
+// rate, such as 1920x1080@144.
+func ParseFullscreenConfig(s string) (FullscreenConfig, error) {
+	bad := errors.Errorf("bad video mode '%s', expected WIDTHxHEIGHT or WIDTHxHEIGHT@REFRESH", s)
+
+	size, refresh, hasRefresh := strings.Cut(s, "@")
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return FullscreenConfig{}, bad
+	}
+	var cfg FullscreenConfig
+	var err error
+	if cfg.Width, err = strconv.Atoi(w); err != nil || cfg.Width <= 0 {
+		return FullscreenConfig{}, bad
+	}
+	if cfg.Height, err = strconv.Atoi(h); err != nil || cfg.Height <= 0 {
+		return FullscreenConfig{}, bad
+	}
+	if hasRefresh {
+		if cfg.RefreshRate, err = strconv.Atoi(refresh); err != nil || cfg.RefreshRate <= 0 {
+			return FullscreenConfig{}, bad
+		}
+	}
+	return cfg, nil
+}
+
+// selectMonitor resolves the Config.Monitor option, falling back to the primary
+// monitor, and checks it has the Fullscreen video mode.
+func (app *HelloTriangleApplication) selectMonitor() error {
+	var monitor *glfw.Monitor
+	if app.config.Monitor == "" {
+		monitor = glfw.GetPrimaryMonitor()
+		if monitor == nil {
+			return errors.New("no monitor connected")
+		}
+	} else {
+		monitors := glfw.GetMonitors()
+		names := make([]string, len(monitors))
+		for i, m := range monitors {
+			names[i] = m.GetName()
+		}
+		index, err := selectIndexOrName("monitor", app.config.Monitor, names)
+		if err != nil {
+			return err
+		}
+		monitor = monitors[index]
+	}
+
+	if _, err := app.fullscreenVideoMode(monitor); err != nil {
+		return err
+	}
+
+	app.monitor = monitor
+	mode := monitor.GetVideoMode()
+	app.logger.Info("Selected monitor",
+		logging.F("monitor", monitor.GetName()),
+		logging.F("mode", fmt.Sprintf("%dx%d@%d", mode.Width, mode.Height, mode.RefreshRate)),
+	)
+	return nil
+}
+
+// fullscreenMonitor is the monitor Fullscreen and Borderless cover.
+func (app *HelloTriangleApplication) fullscreenMonitor() (*glfw.Monitor, error) {
+	if app.monitor == nil {
+		return nil, errors.New("no monitor selected")
+	}
+	return app.monitor, nil
+}
+
+// fullscreenVideoMode finds the monitor's video mode matching Fullscreen.
+func (app *HelloTriangleApplication) fullscreenVideoMode(monitor *glfw.Monitor) (*glfw.VidMode, error) {
+	current := monitor.GetVideoMode()
+	want := app.Fullscreen
+	if want.Width == 0 {
+		want.Width = current.Width
+	}
+	if want.Height == 0 {
+		want.Height = current.Height
+	}
+	if want.RefreshRate == 0 {
+		want.RefreshRate = current.RefreshRate
+	}
+
+	for _, mode := range monitor.GetVideoModes() {
+		if mode.Width == want.Width && mode.Height == want.Height && mode.RefreshRate == want.RefreshRate {
+			return mode, nil
+		}
+	}
+	return nil, errors.Errorf("monitor '%s' has no %dx%d %dHz video mode", monitor.GetName(), want.Width, want.Height, want.RefreshRate)
+}
+
+// setWindowMode moves the window into mode. The framebuffer size changes so
+// the swapchain is rebuilt before the next frame.
+func (app *HelloTriangleApplication) setWindowMode(mode WindowMode) error {
+	w := app.window
+	if mode == app.windowMode {
+		return nil
+	}
+
+	// Remember where the window was so switching back restores it
+	if app.windowMode == Windowed {
+		app.windowedX, app.windowedY = w.GetPos()
+		app.windowedWidth, app.windowedHeight = w.GetSize()
+	}
+
+	switch mode {
+	case Windowed:
+		w.SetMonitor(nil, app.windowedX, app.windowedY, app.windowedWidth, app.windowedHeight, 0)
+		w.SetAttrib(glfw.Decorated, glfwBool(!app.config.Undecorated))
+	case Fullscreen:
+		monitor, err := app.fullscreenMonitor()
+		if err != nil {
+			return err
+		}
+		vidMode, err := app.fullscreenVideoMode(monitor)
+		if err != nil {
+			return err
+		}
+		w.SetAttrib(glfw.Decorated, glfwBool(!app.config.Undecorated))
+		w.SetMonitor(monitor, 0, 0, vidMode.Width, vidMode.Height, vidMode.RefreshRate)
+	case Borderless:
+		monitor, err := app.fullscreenMonitor()
+		if err != nil {
+			return err
+		}
+		x, y := monitor.GetPos()
+		vidMode := monitor.GetVideoMode()
+		w.SetMonitor(nil, x, y, vidMode.Width, vidMode.Height, 0)
+		w.SetAttrib(glfw.Decorated, glfw.False)
+	default:
+		return errors.Errorf("unknown window mode %d", mode)
+	}
+
+	app.windowMode = mode
+	app.framebufferResized = true
+	app.logger.Info("Changed window mode", logging.F("mode", mode))
+	return nil
+}
+
+// cycleWindowMode switches to the next window mode, a mode that can't be
+// entered is logged and skipped over.
+func (app *HelloTriangleApplication) cycleWindowMode() {
+	for i := 1; i < int(windowModeCount); i++ {
+		next := (app.windowMode + WindowMode(i)) % windowModeCount
+		err := app.setWindowMode(next)
+		if err == nil {
+			return
+		}
+		app.logger.Warn("Can't change window mode", logging.F("mode", next), logging.F("err", err))
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/camera"
+	"github.com/delaneyj/learnvulkan/commands"
+	"github.com/delaneyj/learnvulkan/culling"
+	"github.com/delaneyj/learnvulkan/descriptors"
+	"github.com/delaneyj/learnvulkan/gpu"
+	"github.com/delaneyj/learnvulkan/lights"
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/occlusion"
+	"github.com/delaneyj/learnvulkan/postprocess"
+	"github.com/delaneyj/learnvulkan/profiler"
+	"github.com/delaneyj/learnvulkan/rendering"
+	"github.com/delaneyj/learnvulkan/scene"
+	"github.com/delaneyj/learnvulkan/sprite"
+	"github.com/delaneyj/learnvulkan/stats"
+	"github.com/delaneyj/learnvulkan/swapchain"
+	"github.com/delaneyj/learnvulkan/text"
+	"github.com/delaneyj/learnvulkan/ui"
+	"github.com/pkg/errors"
+	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// appWindow is everything that belongs to one window, from the GLFW window
+// and its surface down to the frame synchronisation. Windows share the
+// instance, device, textures and meshes. When headless there's a single
+// appWindow without a GLFW window or surface.
+type appWindow struct {
+	config         AppConfig
+	window         *glfw.Window
+	windowMode     WindowMode
+	monitor        *glfw.Monitor
+	windowedX      int
+	windowedY      int
+	windowedWidth  int
+	windowedHeight int
+	contentScale   ContentScale
+
+	camera           *camera.Camera
+	cameraController camera.Controller
+
+	surface        vk.Surface
+	swapchain      *swapchain.Swapchain
+	presentModes   []vk.PresentMode
+	offscreenImage *gpu.Image
+	target         renderTarget
+	imageViews     []vk.ImageView
+	renderPass     vk.RenderPass
+	colorImage     *gpu.Image
+	depthImage     *gpu.Image
+	// gbuffer holds gbufferFormats' attachments when deferred.
+	gbuffer []*gpu.Image
+	// shadowMap is drawn from the light by shadowRenderPass before every
+	// frame's render pass samples it.
+	shadowMap         *gpu.Image
+	shadowRenderPass  vk.RenderPass
+	shadowFramebuffer vk.Framebuffer
+	// sceneColor is the HDR image the scene is drawn into with bloom, which
+	// postChain's passes bloom and tonemap into the target through
+	// compositeRenderPass. The chain's intermediate images come from
+	// postPool.
+	sceneColor            *gpu.Image
+	postPool              *postprocess.Pool
+	postChain             *postprocess.Chain
+	compositeRenderPass   vk.RenderPass
+	compositeFramebuffers []vk.Framebuffer
+
+	descriptorAllocator *descriptors.Allocator
+	// transientDescriptors are for sets that only live for a frame, there's
+	// one per frame in flight that's reset when the frame comes around.
+	transientDescriptors []*descriptors.Allocator
+	descriptorSets       []vk.DescriptorSet
+	materialSets         []vk.DescriptorSet
+	skyboxSet            vk.DescriptorSet
+	lightingSets         []vk.DescriptorSet
+	bloomSets            []vk.DescriptorSet
+	compositeSet         vk.DescriptorSet
+	particleSets         [2]vk.DescriptorSet
+	uniformBuffers       []*gpu.DynamicUniformBuffer[UniformBufferObject]
+	lightBuffers         []*gpu.UniformBuffer[lights.Block]
+	// jointBuffers and morphWeightBuffers are the skinned pose's joint
+	// matrices and morph target weights, nil when not skinned.
+	jointBuffers       []*gpu.Buffer
+	morphWeightBuffers []*gpu.Buffer
+	pipelineLayout     vk.PipelineLayout
+	// graphicsPipelines has a variant for each PipelineVariant and each of
+	// polygonModes within it, polygonMode indexes the mode drawn with.
+	graphicsPipelines []vk.Pipeline
+	polygonMode       int
+	shadowPipeline    vk.Pipeline
+	lightingPipeline  vk.Pipeline
+	compositePipeline vk.Pipeline
+	skyboxPipeline    vk.Pipeline
+	particlePipeline  vk.Pipeline
+	framebuffers      []vk.Framebuffer
+	commandBuffers    []vk.CommandBuffer
+
+	imageAvailableSemaphores []vk.Semaphore
+	renderFinishedSemaphores []vk.Semaphore
+	inFlightFences           []vk.Fence
+	imagesInFlight           []vk.Fence
+	currentFrame             int
+	framebufferResized       bool
+	paused                   bool
+	screenshotRequested      bool
+	presentModeToggled       bool
+	polygonModeToggled       bool
+	gammaToggled             bool
+	windowModeToggled        bool
+	frameCount               uint64
+	recorder                 *frameRecorder
+	frameStats               *stats.Frames
+	profiler                 *profiler.Profiler
+	pipelineStats            *profiler.PipelineStats
+	workers                  *commands.Workers
+	// uiRenderer draws the UI over the primary window, nil elsewhere or
+	// without the UI option.
+	uiRenderer *ui.Renderer
+	// draws counts the draw calls recorded for the frame being drawn,
+	// atomically since workers record them in parallel.
+	draws uint64
+	// drawList is the scene as of the frame being drawn, each draw using
+	// the uniform buffer's object at its index.
+	drawList scene.DrawList
+	// materialDraws are drawList's objects' mesh groups in the order
+	// they're drawn.
+	materialDraws []materialDraw
+	// visible is whether each of drawList's objects is in the camera's
+	// frustum, see cullDraws. freezeFrustum keeps culling against
+	// frozenFrustum instead.
+	visible       []bool
+	freezeFrustum bool
+	frozenFrustum *culling.Frustum
+	// lods are the level of detail each of drawList's objects is drawn at,
+	// see selectLOD. lodColors tints them by it.
+	lods      []int
+	lodColors bool
+	// wrongGamma presents linear colors without encoding them, see
+	// swapchainFormats.
+	wrongGamma bool
+	// occlusionQueries test occlusionBoxes, the boxes of the frame's
+	// objects in the frustum, against a depth pre-pass drawn with
+	// depthPrepassPipeline, see recordOcclusion. occlusionNodes are the
+	// nodes each frame in flight queried in order, occluded the latest
+	// results. All are nil without occlusion culling.
+	occlusionQueries     *occlusion.Queries
+	occlusionBoxes       []culling.AABB
+	occlusionNodes       [][]*scene.Node
+	occluded             culling.Occlusion[*scene.Node]
+	depthPrepassPipeline vk.Pipeline
+	occlusionPipeline    vk.Pipeline
+	occlusionLayout      vk.PipelineLayout
+	// textRenderer draws the overlay, nil without the Overlay option.
+	textRenderer *text.Renderer
+	// spriteBatch draws sprites over the primary window, nil elsewhere or
+	// without the Sprites option. demoSprites is its demo's sprite sheet.
+	spriteBatch *sprite.Batch
+	demoSprites *demoSprites
+	// rayTraceImage is what the ray traced sample is traced into before
+	// it's blitted into the primary window, nil elsewhere or when the
+	// device can't ray trace.
+	rayTraceImage *gpu.Image
+	// meshletPipelines are graphicsPipelines' variants drawing with task
+	// and mesh shaders when mesh shading, meshletSet the mesh's meshlets.
+	meshletPipelines []vk.Pipeline
+	meshletLayout    vk.PipelineLayout
+	meshletSet       vk.DescriptorSet
+	// stereoRenderPass draws the primary window's scene for both eyes into
+	// the layers of stereoColor and stereoDepth, with stereoPipeline reading
+	// stereoBuffers' views. All are nil elsewhere or when not stereo.
+	stereoRenderPass  vk.RenderPass
+	stereoColor       *gpu.Image
+	stereoDepth       *gpu.Image
+	stereoFramebuffer vk.Framebuffer
+	stereoPipeline    vk.Pipeline
+	stereoBuffers     []*gpu.UniformBuffer[StereoViews]
+	// sceneRendering describes the scene's attachments to its pipelines in
+	// place of renderPass with dynamic rendering, sceneInheritance to its
+	// secondary command buffers. Both are nil with render passes.
+	sceneRendering   *rendering.PipelineInfo
+	sceneInheritance *rendering.InheritanceInfo
+	// bindlessSet is the material table when bindless, allocated from
+	// bindlessPool which update after bind sets need.
+	bindlessPool vk.DescriptorPool
+	bindlessSet  vk.DescriptorSet
+}
+
+// forEachWindow makes each window current in turn and calls fn, stopping at
+// the first error. The primary window is current again afterwards.
+func (app *HelloTriangleApplication) forEachWindow(fn func() error) error {
+	defer func() { app.appWindow = app.windows[0] }()
+	for _, w := range app.windows {
+		app.appWindow = w
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createWindowResources creates the current window's swapchain and
+// everything drawing a frame into it needs.
+func (app *HelloTriangleApplication) createWindowResources() error {
+	// A benchmark's report covers all of its frames
+	app.frameStats = stats.New(app.Bench)
+
+	if err := app.createCamera(); err != nil {
+		return errors.Wrap(err, "can't create camera")
+	}
+
+	if err := app.createSwapchain(); err != nil {
+		return errors.Wrap(err, "can't create swapchain")
+	}
+
+	if err := app.createImageViews(); err != nil {
+		return errors.Wrap(err, "can't create image views")
+	}
+
+	if err := app.createRenderPass(); err != nil {
+		return errors.Wrap(err, "can't create render pass")
+	}
+
+	if err := app.createCompositeRenderPass(); err != nil {
+		return errors.Wrap(err, "can't create composite render pass")
+	}
+
+	if err := app.createStereoRenderPass(); err != nil {
+		return errors.Wrap(err, "can't create stereo render pass")
+	}
+
+	if err := app.createShadowResources(); err != nil {
+		return errors.Wrap(err, "can't create shadow resources")
+	}
+
+	if err := app.createGraphicsPipeline(); err != nil {
+		return errors.Wrap(err, "can't create graphics pipeline")
+	}
+
+	if err := app.createColorResources(); err != nil {
+		return errors.Wrap(err, "can't create color resources")
+	}
+
+	if err := app.createDepthResources(); err != nil {
+		return errors.Wrap(err, "can't create depth resources")
+	}
+
+	if err := app.createGBuffer(); err != nil {
+		return errors.Wrap(err, "can't create G-buffer")
+	}
+
+	if err := app.createPostProcess(); err != nil {
+		return errors.Wrap(err, "can't create post-process chain")
+	}
+
+	if err := app.createFramebuffers(); err != nil {
+		return errors.Wrap(err, "can't create framebuffers")
+	}
+
+	if err := app.createUI(); err != nil {
+		return errors.Wrap(err, "can't create UI")
+	}
+
+	if err := app.createSprites(); err != nil {
+		return errors.Wrap(err, "can't create sprites")
+	}
+
+	if err := app.createOverlay(); err != nil {
+		return errors.Wrap(err, "can't create overlay")
+	}
+
+	if err := app.createRayTracingTarget(); err != nil {
+		return errors.Wrap(err, "can't create ray tracing target")
+	}
+
+	if err := app.createStereoTarget(); err != nil {
+		return errors.Wrap(err, "can't create stereo target")
+	}
+
+	if err := app.createUniformBuffers(); err != nil {
+		return errors.Wrap(err, "can't create uniform buffers")
+	}
+
+	app.createDescriptorAllocators()
+
+	if err := app.createDescriptorSets(); err != nil {
+		return errors.Wrap(err, "can't create descriptor sets")
+	}
+
+	if err := app.createMaterialSets(); err != nil {
+		return errors.Wrap(err, "can't create material descriptor sets")
+	}
+
+	if err := app.createSkyboxSet(); err != nil {
+		return errors.Wrap(err, "can't create skybox descriptor set")
+	}
+
+	if err := app.createLightingSet(); err != nil {
+		return errors.Wrap(err, "can't create lighting descriptor set")
+	}
+
+	if err := app.createBloomSets(); err != nil {
+		return errors.Wrap(err, "can't create bloom descriptor sets")
+	}
+
+	if err := app.createParticleSets(); err != nil {
+		return errors.Wrap(err, "can't create particle descriptor sets")
+	}
+
+	if err := app.createMeshletSet(); err != nil {
+		return errors.Wrap(err, "can't create meshlet descriptor set")
+	}
+
+	if err := app.createCommandBuffers(); err != nil {
+		return errors.Wrap(err, "can't create command buffers")
+	}
+
+	if err := app.createSyncObjects(); err != nil {
+		return errors.Wrap(err, "can't create sync objects")
+	}
+
+	if err := app.createWorkers(); err != nil {
+		return errors.Wrap(err, "can't create recording workers")
+	}
+
+	if err := app.createProfiler(); err != nil {
+		return errors.Wrap(err, "can't create GPU profiler")
+	}
+
+	if err := app.createPipelineStats(); err != nil {
+		return errors.Wrap(err, "can't create pipeline statistics query")
+	}
+
+	if err := app.createOcclusionQueries(); err != nil {
+		return errors.Wrap(err, "can't create occlusion queries")
+	}
+
+	return nil
+}
+
+// destroyWindow destroys the current window along with its resources. The
+// window mustn't have frames in flight.
+func (app *HelloTriangleApplication) destroyWindow() {
+	app.destroySyncObjects()
+
+	if app.commandPool != nil {
+		app.commandPool.Free(app.commandBuffers)
+	}
+	app.commandBuffers = nil
+
+	if app.workers != nil {
+		app.workers.Destroy()
+		app.workers = nil
+	}
+
+	app.profiler.Destroy()
+	app.profiler = nil
+	app.pipelineStats.Destroy()
+	app.pipelineStats = nil
+	app.destroyOcclusionQueries()
+
+	if app.recorder != nil {
+		app.recorder.Destroy()
+		app.recorder = nil
+	}
+
+	app.cleanupSwapchain()
+	app.destroyShadowResources()
+
+	if app.uiRenderer != nil {
+		app.uiRenderer.Destroy()
+		app.uiRenderer = nil
+	}
+	if app.textRenderer != nil {
+		app.textRenderer.Destroy()
+		app.textRenderer = nil
+	}
+	if app.spriteBatch != nil {
+		app.spriteBatch.Destroy()
+		app.spriteBatch = nil
+		app.demoSprites = nil
+	}
+
+	if app.descriptorAllocator != nil {
+		app.descriptorAllocator.Destroy()
+		app.descriptorAllocator = nil
+	}
+	for _, a := range app.transientDescriptors {
+		a.Destroy()
+	}
+	app.transientDescriptors = nil
+	app.descriptorSets = nil
+	app.materialSets = nil
+	app.destroyBindlessSet()
+	app.skyboxSet = vk.NullDescriptorSet
+	app.lightingSets = nil
+	app.bloomSets = nil
+	app.compositeSet = vk.NullDescriptorSet
+	app.particleSets = [2]vk.DescriptorSet{}
+	for _, b := range app.uniformBuffers {
+		b.Destroy()
+	}
+	app.uniformBuffers = nil
+	app.destroyLightBuffers()
+	app.destroyPoseBuffers()
+	app.destroyStereoBuffers()
+
+	if app.surface != vk.NullSurface {
+		vk.DestroySurface(app.instance, app.surface, nil)
+		app.surface = vk.NullSurface
+	}
+
+	if app.window != nil {
+		app.window.Destroy()
+		app.window = nil
+	}
+}
+
+// openExtraWindows opens a window for each of the Windows options, sharing
+// the primary window's device.
+func (app *HelloTriangleApplication) openExtraWindows() error {
+	if app.NativeWindow != nil {
+		return nil
+	}
+	primary := app.appWindow
+	defer func() { app.appWindow = primary }()
+
+	for i, cfg := range app.Windows {
+		// Added before anything's created so cleanup finds partial windows
+		w := &appWindow{
+			config:       cfg.withDefaults(),
+			presentModes: primary.presentModes,
+		}
+		app.windows = append(app.windows, w)
+		app.appWindow = w
+
+		if err := app.openWindow(); err != nil {
+			return errors.Wrapf(err, "can't open window %d", i+1)
+		}
+		if err := app.createSurface(); err != nil {
+			return errors.Wrapf(err, "can't create surface for window %d", i+1)
+		}
+		if err := app.checkPresentSupport(); err != nil {
+			return errors.Wrapf(err, "can't present to window %d", i+1)
+		}
+		if err := app.createWindowResources(); err != nil {
+			return errors.Wrapf(err, "can't create resources for window %d", i+1)
+		}
+		app.logger.Info("Opened window", logging.F("title", w.config.Title))
+	}
+	return nil
+}
+
+// checkPresentSupport makes sure the present queue picked for the primary
+// window can present to the current window's surface too. Windows on a
+// monitor driven by another GPU might not be.
+func (app *HelloTriangleApplication) checkPresentSupport() error {
+	var supported vk.Bool32
+	family := uint32(app.queueFamilies.Present)
+	if err := vk.Error(vk.GetPhysicalDeviceSurfaceSupport(app.physicalDevice, family, app.surface, &supported)); err != nil {
+		return errors.Wrap(err, "can't query surface support")
+	}
+	if !supported.B() {
+		return errors.Errorf("queue family %d can't present to the surface", family)
+	}
+	return nil
+}
+
+// closeExtraWindows destroys the extra windows that have been asked to
+// close. Closing the primary window ends the main loop instead.
+func (app *HelloTriangleApplication) closeExtraWindows() error {
+	primary := app.appWindow
+	defer func() { app.appWindow = primary }()
+
+	open := app.windows[:1]
+	for _, w := range app.windows[1:] {
+		if !w.window.ShouldClose() {
+			open = append(open, w)
+			continue
+		}
+
+		// Frames in flight are only tracked per window so wait for all of them
+		if err := app.waitIdle(); err != nil {
+			return err
+		}
+		app.appWindow = w
+		app.destroyWindow()
+		app.logger.Info("Closed window", logging.F("title", w.config.Title))
+	}
+	app.windows = open
+	return nil
+}
+
+// minimized reports whether the current window has nowhere to draw. A
+// swapchain can't have a zero extent, which is what some platforms report
+// for minimized windows.
+func (app *HelloTriangleApplication) minimized() bool {
+	if app.window != nil && app.window.GetAttrib(glfw.Iconified) == glfw.True {
+		return true
+	}
+	width, height := app.framebufferSize()
+	return width == 0 || height == 0
+}
+
+// allMinimized reports whether no window has anywhere to draw.
+func (app *HelloTriangleApplication) allMinimized() bool {
+	minimized := true
+	app.forEachWindow(func() error {
+		minimized = minimized && app.minimized()
+		return nil
+	})
+	return minimized
+}
+
+// pauseWhileMinimized stops drawing into the current window while it's
+// minimized and rebuilds its swapchain when it's restored, the old one is
+// out of date by then. It reports whether the window is paused.
+func (app *HelloTriangleApplication) pauseWhileMinimized() (bool, error) {
+	if app.minimized() {
+		if !app.paused {
+			app.paused = true
+			app.logger.Info("Paused rendering", logging.F("title", app.config.Title))
+		}
+		return true, nil
+	}
+	if !app.paused {
+		return false, nil
+	}
+
+	app.paused = false
+	app.framebufferResized = false
+	if err := app.recreateSwapchain(); err != nil {
+		return false, errors.Wrap(err, "can't recreate swapchain")
+	}
+	// Frames either side of the pause aren't comparable
+	app.frameStats.Reset()
+	app.logger.Info("Resumed rendering", logging.F("title", app.config.Title))
+	return false, nil
+}
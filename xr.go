@@ -0,0 +1,267 @@
+package main
+
+import (
+	"github.com/delaneyj/learnvulkan/logging"
+	"github.com/delaneyj/learnvulkan/openxr"
+	"github.com/delaneyj/learnvulkan/vmath"
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// xrFormats are the swapchain formats preferred for the headset, sRGB
+// first like the window's.
+var xrFormats = []vk.Format{
+	vk.FormatB8g8r8a8Srgb,
+	vk.FormatR8g8b8a8Srgb,
+	vk.FormatB8g8r8a8Unorm,
+	vk.FormatR8g8b8a8Unorm,
+}
+
+// createXRInstance creates the OpenXR instance before the Vulkan one, which
+// has to be created with the extensions the runtime asks for. Without a
+// runtime or headset the application carries on without OpenXR.
+func (app *HelloTriangleApplication) createXRInstance() {
+	if !app.OpenXR {
+		return
+	}
+	if app.Headless {
+		app.logger.Info("Not using OpenXR", logging.F("reason", "headless rendering has no frame loop to drive it"))
+		return
+	}
+
+	instance, err := openxr.NewInstance(app.config.Title)
+	if err != nil {
+		app.logger.Info("Not using OpenXR", logging.F("reason", err))
+		return
+	}
+	instanceExtensions, err := instance.VulkanInstanceExtensions()
+	if err == nil {
+		app.xrDeviceExtensions, err = instance.VulkanDeviceExtensions()
+	}
+	if err != nil {
+		instance.Destroy()
+		app.logger.Info("Not using OpenXR", logging.F("reason", err))
+		return
+	}
+	for _, name := range instanceExtensions {
+		app.xrInstanceExtensions = append(app.xrInstanceExtensions, name+"\x00")
+	}
+	app.xrInstance = instance
+	app.logger.Info("Using OpenXR",
+		logging.F("instanceExtensions", instanceExtensions),
+		logging.F("deviceExtensions", app.xrDeviceExtensions),
+	)
+}
+
+// xrPhysicalDevice is the index in devices of the one the headset is
+// plugged into, -1 without OpenXR.
+func (app *HelloTriangleApplication) xrPhysicalDevice(devices []vk.PhysicalDevice) (int, error) {
+	if app.xrInstance == nil {
+		return -1, nil
+	}
+	d, err := app.xrInstance.PhysicalDevice(app.instance)
+	if err != nil {
+		return -1, err
+	}
+	for i, candidate := range devices {
+		if candidate == d {
+			if app.GPU != "" {
+				app.logger.Info("Ignoring requested GPU", logging.F("gpu", app.GPU), logging.F("reason", "OpenXR picks the headset's"))
+			}
+			return i, nil
+		}
+	}
+	return -1, errors.New("OpenXR's device isn't one of the instance's")
+}
+
+// createXRSession starts an OpenXR session on the graphics queue with a
+// swapchain per eye, once the device exists. The eyes are drawn by the
+// stereo pipeline so without multiview there's no session.
+func (app *HelloTriangleApplication) createXRSession() error {
+	if app.xrInstance == nil {
+		return nil
+	}
+	if !app.stereo {
+		app.logger.Info("Not using OpenXR", logging.F("reason", "the eyes are drawn in stereo, which isn't available"))
+		app.xrInstance.Destroy()
+		app.xrInstance = nil
+		return nil
+	}
+
+	session, err := app.xrInstance.NewSession(openxr.GraphicsBinding{
+		Instance:       app.instance,
+		PhysicalDevice: app.physicalDevice,
+		Device:         app.device,
+		QueueFamily:    uint32(app.queueFamilies.Graphics),
+		QueueIndex:     0,
+	})
+	if err != nil {
+		return err
+	}
+	app.xrSession = session
+
+	formats, err := session.Formats()
+	if err != nil {
+		return err
+	}
+	format, ok := chooseXRFormat(formats)
+	if !ok {
+		return errors.Errorf("OpenXR has none of the swapchain formats %v", xrFormats)
+	}
+	for i := range app.xrSwapchains {
+		sc, err := session.NewSwapchain(format)
+		if err != nil {
+			return errors.Wrapf(err, "can't create swapchain for eye %d", i)
+		}
+		app.xrSwapchains[i] = sc
+		for j, img := range sc.Images {
+			app.name(img, "xr eye %d image %d", i, j)
+		}
+	}
+	app.logger.Info("Created OpenXR session",
+		logging.F("width", session.Width),
+		logging.F("height", session.Height),
+		logging.F("format", format),
+	)
+	return nil
+}
+
+func chooseXRFormat(available []vk.Format) (vk.Format, bool) {
+	for _, want := range xrFormats {
+		for _, f := range available {
+			if f == want {
+				return f, true
+			}
+		}
+	}
+	return vk.FormatUndefined, false
+}
+
+// beginXRFrame handles the session's events and, while it's running, waits
+// for the headset's next frame and acquires an image per eye to draw it
+// into. exit is true once the runtime has ended the session for good.
+func (app *HelloTriangleApplication) beginXRFrame() (exit bool, err error) {
+	app.xrFrame = nil
+	app.xrRendered = false
+	if app.xrSession == nil {
+		return false, nil
+	}
+
+	if exit, err := app.xrSession.PollEvents(); exit || err != nil {
+		return exit, err
+	}
+	if !app.xrSession.Running() {
+		return false, nil
+	}
+
+	frame, err := app.xrSession.BeginFrame()
+	if err != nil {
+		return false, err
+	}
+	app.xrFrame = frame
+	if !frame.ShouldRender {
+		return false, nil
+	}
+	for i, sc := range app.xrSwapchains {
+		index, err := sc.Acquire()
+		if err != nil {
+			return false, errors.Wrapf(err, "can't acquire image for eye %d", i)
+		}
+		app.xrImages[i] = index
+	}
+	return false, nil
+}
+
+// endXRFrame hands the eyes' images back and ends the frame, showing them
+// when recordXR drew into them and nothing otherwise. The draws have to
+// have been submitted.
+func (app *HelloTriangleApplication) endXRFrame() error {
+	frame := app.xrFrame
+	if frame == nil {
+		return nil
+	}
+	app.xrFrame = nil
+
+	if frame.ShouldRender {
+		for i, sc := range app.xrSwapchains {
+			if err := sc.Release(); err != nil {
+				return errors.Wrapf(err, "can't release image for eye %d", i)
+			}
+		}
+	}
+	var swapchains []*openxr.Swapchain
+	if app.xrRendered {
+		swapchains = app.xrSwapchains[:]
+	}
+	return app.xrSession.EndFrame(frame, swapchains)
+}
+
+// xrStereoViews are the eyes where the headset says they are, relative to
+// the camera, so moving the head looks around the scene from wherever the
+// camera's been flown to.
+func (app *HelloTriangleApplication) xrStereoViews() StereoViews {
+	view := app.camera.View()
+	var views StereoViews
+	for i, v := range app.xrFrame.Views {
+		pose := vmath.Translate(vmath.Vec3{v.Position[0], v.Position[1], v.Position[2]}).
+			Mul(vmath.Quat(vmath.Vec4{v.Orientation[0], v.Orientation[1], v.Orientation[2], v.Orientation[3]}))
+		views.View[i] = pose.Inverse().Mul(view)
+		views.Proj[i] = vmath.PerspectiveFov(v.Fov.Left, v.Fov.Right, v.Fov.Up, v.Fov.Down, app.camera.Near, app.camera.Far)
+	}
+	return views
+}
+
+// recordXR copies the eyes' layers into the images acquired for them. The
+// stereo color image is already a transfer source from the window's blit.
+func (app *HelloTriangleApplication) recordXR(cb vk.CommandBuffer) {
+	if app.xrFrame == nil || !app.xrFrame.ShouldRender {
+		return
+	}
+
+	extent := app.stereoEyeExtent()
+	eye := vk.Offset3D{X: int32(extent.Width), Y: int32(extent.Height), Z: 1}
+	for i, sc := range app.xrSwapchains {
+		img := sc.Images[app.xrImages[i]]
+		// Every pixel is overwritten, whatever was there doesn't matter
+		cmdTargetBarrier(cb, img, vk.ImageLayoutUndefined, vk.ImageLayoutTransferDstOptimal,
+			0, vk.AccessFlags(vk.AccessTransferWriteBit),
+			vk.PipelineStageFlags(vk.PipelineStageTopOfPipeBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit))
+		vk.CmdBlitImage(cb, app.stereoColor.Handle, vk.ImageLayoutTransferSrcOptimal, img, vk.ImageLayoutTransferDstOptimal,
+			1, []vk.ImageBlit{{
+				SrcSubresource: vk.ImageSubresourceLayers{
+					AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+					BaseArrayLayer: uint32(i),
+					LayerCount:     1,
+				},
+				SrcOffsets: [2]vk.Offset3D{{}, eye},
+				DstSubresource: vk.ImageSubresourceLayers{
+					AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+					LayerCount: 1,
+				},
+				DstOffsets: [2]vk.Offset3D{{}, eye},
+			}}, vk.FilterNearest)
+		// The runtime expects them back as color attachments
+		cmdTargetBarrier(cb, img, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutColorAttachmentOptimal,
+			vk.AccessFlags(vk.AccessTransferWriteBit), 0,
+			vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit))
+	}
+	app.xrRendered = true
+}
+
+// destroyXR ends OpenXR before the device it renders with is destroyed.
+func (app *HelloTriangleApplication) destroyXR() {
+	for i, sc := range app.xrSwapchains {
+		if sc != nil {
+			sc.Destroy()
+			app.xrSwapchains[i] = nil
+		}
+	}
+	if app.xrSession != nil {
+		app.xrSession.Destroy()
+		app.xrSession = nil
+	}
+	if app.xrInstance != nil {
+		app.xrInstance.Destroy()
+		app.xrInstance = nil
+	}
+}